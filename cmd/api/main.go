@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -18,14 +20,18 @@ import (
 	"mcmm/internal/config"
 	"mcmm/internal/cronjob"
 	"mcmm/internal/log"
+	"mcmm/internal/metrics"
 	"mcmm/internal/pgsql"
 	"mcmm/internal/servertap"
+	"mcmm/internal/webservice"
 	"mcmm/internal/worker"
 )
 
 const (
 	startupTimeout     = 10 * time.Second
 	defaultGameVersion = "1.21.1"
+	dbHealthInterval   = 30 * time.Second
+	mojangProfileURL   = "https://api.mojang.com/users/profiles/minecraft/"
 )
 
 func main() {
@@ -38,15 +44,32 @@ func main() {
 	if err != nil {
 		logger.Fatalf("Failed to load config: %v", err)
 	}
+	if cfg.LogFormat == log.FormatJSON {
+		log.SetupLoggerWithFormat(log.LevelDebug, cfg.LogFormat)
+		logger = log.Logger.With("component", "main")
+	}
 	config.LogSummary(cfg)
+	if err := servertap.SetPlayerNamePattern(cfg.PlayerNamePattern); err != nil {
+		logger.Fatalf("Failed to apply player_name_pattern: %v", err)
+	}
 	logger.Info("[ok] Configuration loaded")
 
+	if cfg.BootstrapAdminResolve {
+		logger.Info("[step] Resolving bootstrap admin UUID from Mojang")
+		if id, err := resolveMojangUUID(cfg.BootstrapAdminName); err != nil {
+			logger.Warnf("[warn] Keeping configured bootstrap_admin_uuid=%s: %v", cfg.BootstrapAdminUUID, err)
+		} else {
+			cfg.BootstrapAdminUUID = id
+			logger.Infof("[ok] Bootstrap admin %s resolved to %s", cfg.BootstrapAdminName, id)
+		}
+	}
+
 	logger.Info("[step] Preparing runtime directories")
-	if err := ensureDirs([]string{cfg.TemplateRootPath, cfg.InstanceRootPath, cfg.VersionRootPath, cfg.ArchiveRootPath}); err != nil {
+	if err := ensureDirs([]string{cfg.TemplateRootPath, cfg.InstanceRootPath, cfg.VersionRootPath, cfg.ArchiveRootPath, cfg.StagingRootPath}); err != nil {
 		logger.Fatalf("Failed to prepare runtime directories: %v", err)
 	}
-	logger.Infof("[ok] Runtime directories ready (template=%s instance=%s version=%s archive=%s)",
-		cfg.TemplateRootPath, cfg.InstanceRootPath, cfg.VersionRootPath, cfg.ArchiveRootPath)
+	logger.Infof("[ok] Runtime directories ready (template=%s instance=%s version=%s archive=%s staging=%s)",
+		cfg.TemplateRootPath, cfg.InstanceRootPath, cfg.VersionRootPath, cfg.ArchiveRootPath, cfg.StagingRootPath)
 
 	logger.Info("[step] Initializing PostgreSQL connector")
 	connector := pgsql.NewConnector(cfg.DBURL)
@@ -56,32 +79,84 @@ func main() {
 		logger.Fatalf("Failed to connect database: %v", err)
 	}
 	defer connector.Close()
+	connector.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	connector.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	connector.SetConnMaxLifetime(time.Duration(cfg.DBConnMaxLifetimeSec) * time.Second)
+	dbMonitorCtx, dbMonitorCancel := context.WithCancel(context.Background())
+	defer dbMonitorCancel()
+	connector.StartHealthMonitor(dbMonitorCtx, dbHealthInterval)
 	logger.Info("[ok] Database connected")
 
 	logger.Info("[step] Building repository set")
 	repos := pgsql.NewRepos(connector)
 	logger.Info("[ok] Repositories assembled")
+	metricsRegistry := metrics.NewDefaultRegistry(repos)
+
+	instanceKeys, err := servertap.NewInstanceKeyring(cfg.InstanceKeySecret)
+	if err != nil {
+		logger.Fatalf("Failed to initialize instance keyring: %v", err)
+	}
 
 	logger.Info("[step] Initializing worker")
 	workerSvc, err := worker.NewWorkerI(repos, worker.Options{
-		InstanceRootDir:       cfg.InstanceRootPath,
-		VersionRootDir:        cfg.VersionRootPath,
-		ComposeTemplateDir:    cfg.VersionRootPath,
-		ArchiveRootDir:        cfg.ArchiveRootPath,
-		DefaultGameVersion:    defaultGameVersion,
-		ServerTapPort:         cfg.MiniServerTapPort,
-		InstanceNetwork:       cfg.InstanceNetwork,
-		InstanceTapURLPattern: cfg.MiniTapHostPattern,
-		ServerTapAuthKey:      cfg.ServerTapKey,
-		ServerTapAuthName:     cfg.ServerTapAuthHeader,
-		BootstrapAdminName:    cfg.BootstrapAdminName,
-		Now:                   time.Now,
+		InstanceRootDir:         cfg.InstanceRootPath,
+		VersionRootDir:          cfg.VersionRootPath,
+		ComposeTemplateDir:      cfg.VersionRootPath,
+		ArchiveRootDir:          cfg.ArchiveRootPath,
+		StagingRootDir:          cfg.StagingRootPath,
+		DefaultGameVersion:      defaultGameVersion,
+		ServerTapPort:           cfg.MiniServerTapPort,
+		InstanceNetwork:         cfg.InstanceNetwork,
+		HostPortMin:             cfg.HostPortMin,
+		HostPortMax:             cfg.HostPortMax,
+		CPULimit:                cfg.InstanceCPULimit,
+		MemLimitMB:              cfg.InstanceMemLimitMB,
+		PostCreateHook:          postCreateHook(cfg),
+		PostCreateHookTimeout:   time.Duration(cfg.PostCreateHookTimeoutS) * time.Second,
+		PreDestroyHook:          preDestroyHook(cfg),
+		PreDestroyHookTimeout:   time.Duration(cfg.PreDestroyHookTimeoutS) * time.Second,
+		PreDestroyHookAbort:     cfg.PreDestroyHookAbort,
+		InstanceTapURLPattern:   cfg.MiniTapHostPattern,
+		ServerTapAuthKey:        cfg.ServerTapKey,
+		ServerTapAuthName:       cfg.ServerTapAuthHeader,
+		ServerTapTLS:            serverTapTLS(cfg),
+		BootstrapAdminName:      cfg.BootstrapAdminName,
+		InstanceKeys:            instanceKeys,
+		PreStopTimeout:          time.Duration(cfg.PreStopTimeoutSec) * time.Second,
+		MaxConcurrentStarts:     cfg.MaxConcurrentStarts,
+		MultiverseImport:        cfg.MultiverseImport,
+		StartMaxAttempts:        cfg.StartMaxAttempts,
+		StartRetryBackoff:       time.Duration(cfg.StartRetryBackoffSec) * time.Second,
+		ServerTapMaxRetries:     cfg.ServerTapMaxRetries,
+		ServerTapRetryBaseDelay: time.Duration(cfg.ServerTapRetryBaseSec) * time.Second,
+		ServerTapRetryMaxDelay:  time.Duration(cfg.ServerTapRetryMaxSec) * time.Second,
+		Now:                     time.Now,
+		Metrics:                 metricsRegistry,
 	})
 	if err != nil {
 		logger.Fatalf("Failed to initialize worker: %v", err)
 	}
 	logger.Info("[ok] Worker initialized")
 
+	logger.Info("[step] Sweeping stale staging files")
+	swept, err := workerSvc.SweepStaleFiles(time.Duration(cfg.StagingSweepHours) * time.Hour)
+	for _, p := range swept {
+		logger.Infof("removed stale file: %s", p)
+	}
+	if err != nil {
+		logger.Warnf("Stale file sweep incomplete: %v", err)
+	}
+	logger.Infof("[ok] Stale file sweep done (removed=%d older_than=%dh)", len(swept), cfg.StagingSweepHours)
+
+	if cfg.ServerTapPreflight && cfg.LobbyServerTapURL != "" {
+		logger.Info("[step] Preflight lobby ServerTap")
+		if err := preflightLobbyServerTap(cfg); err != nil {
+			logger.Warnf("[warn] Lobby ServerTap unreachable at %s: %v", cfg.LobbyServerTapURL, err)
+		} else {
+			logger.Info("[ok] Lobby ServerTap reachable")
+		}
+	}
+
 	logger.Info("[step] Starting HTTP server")
 	mux := http.NewServeMux()
 	cmdService := cmdreceiver.NewServiceI(
@@ -96,22 +171,50 @@ func main() {
 		cfg.ProxyAuthHeader,
 		cfg.ProxyAuthToken,
 	)
+	cmdService.SetActionCooldown(time.Duration(cfg.CommandCooldownSec) * time.Second)
+	cmdService.SetMetrics(metricsRegistry)
+	cmdService.SetLockdownKickMessage(cfg.LockdownKickMessage)
+	cmdService.SetStorageTypes(cfg.StorageTypes, cfg.DefaultStorageType)
+	cmdService.SetServerIDPrefix(cfg.ServerIDPrefix)
+	cmdService.SetBulkPowerConcurrency(cfg.BulkPowerConcurrency)
+	cmdService.SetDisabledActions(cfg.DisabledActions)
+	cmdService.SetRequestExpiry(time.Duration(cfg.RequestExpiryHours) * time.Hour)
+	cmdService.SetInstanceKeyring(instanceKeys)
+	cmdService.SetServerTapTLS(serverTapTLS(cfg))
+	cmdService.SetTxConnector(connector)
+	cmdService.SetNotifyLimits(cfg.NotifyConcurrency, time.Duration(cfg.NotifyTellTimeoutSec)*time.Second)
+	cmdService.SetStarterWorld(cmdreceiver.StarterWorldOptions{
+		Enabled:     cfg.StarterWorld,
+		TemplateTag: cfg.DefaultTemplateTag,
+		Quota:       cfg.StarterWorldQuota,
+	})
+	if cfg.NotifyWebhookURL != "" {
+		cmdService.SetWebhookNotifier(cmdreceiver.NewWebhookNotifier(cfg.NotifyWebhookURL, 5*time.Second), cfg.NotifyWebhookOnly)
+	}
 	cmdHandler := cmdreceiver.NewHandlerI(cmdService)
 	cmdHandler.Register(mux)
+	adminHandler := webservice.NewAdminHandlerI(workerSvc, cfg.AdminAuthHeader, cfg.AdminToken)
+	adminHandler.Register(mux)
+	webservice.NewHealthHandlerI(cmdService).Register(mux)
+	mux.Handle("/metrics", metricsRegistry)
 	httpServer := &http.Server{Addr: cfg.HTTPAddr, Handler: mux}
 	cronCtx, cronCancel := context.WithCancel(context.Background())
 	defer cronCancel()
 
 	logger.Info("[step] Starting cron scheduler")
-	scheduler := cronjob.NewScheduler(repos, workerSvc, cronjob.Options{
-		OffInterval:       time.Duration(cfg.OffHour) * time.Hour,
-		RemoveDays:        cfg.RemoveDay,
-		InstanceTapURLFmt: cfg.MiniTapHostPattern,
-		ServerTapTimeout:  6 * time.Second,
-		ServerTapAuthName: cfg.ServerTapAuthHeader,
-		ServerTapAuthKey:  cfg.ServerTapKey,
-		Now:               time.Now,
-	})
+	schedOpts := schedulerOptions(cfg)
+	schedOpts.InstanceKeys = instanceKeys
+	schedOpts.NotifyOwner = func(ctx context.Context, userID int64, msg string) {
+		cmdService.Notify(ctx, cmdreceiver.NotifyTargets{UserIDs: []int64{userID}}, msg)
+	}
+	if cfg.OrphanOwnerName != "" {
+		if u, err := repos.User.ReadByName(cronCtx, cfg.OrphanOwnerName); err != nil {
+			logger.Warnf("orphan_owner_name=%s not found, orphaned instances are only reported: %v", cfg.OrphanOwnerName, err)
+		} else {
+			schedOpts.OrphanOwnerID = u.ID
+		}
+	}
+	scheduler := cronjob.NewScheduler(repos, workerSvc, schedOpts)
 	scheduler.Start(cronCtx)
 	logger.Info("[ok] Cron scheduler started")
 
@@ -126,16 +229,14 @@ func main() {
 	// so player join events are accepted during version scanning.
 	go func() {
 		logger.Info("[step] Verifying lobby ServerTap by admin access setup")
-		verifyCtx, verifyCancel := context.WithTimeout(context.Background(), 20*time.Second)
-		defer verifyCancel()
-		if err := ensureLobbyAdminAccess(verifyCtx, cfg, repos, logger); err != nil {
+		if err := ensureLobbyAdminAccess(context.Background(), cfg, repos, logger); err != nil {
 			logger.Warnf("[warn] Lobby ServerTap admin setup failed: %v", err)
 		} else {
 			logger.Info("[ok] Lobby ServerTap reachable and admin commands applied")
 		}
 
 		logger.Info("[step] Runtime bootstrap self-check")
-		if err := bootstrapRuntimeSelfCheck(context.Background(), cfg, repos, workerSvc, logger); err != nil {
+		if err := bootstrapRuntimeSelfCheck(context.Background(), cfg, repos, workerSvc, cmdService.SetVersionsInstalled, logger); err != nil {
 			logger.Errorf("runtime bootstrap self-check failed: %v", err)
 		} else {
 			logger.Info("[ok] Runtime bootstrap self-check completed")
@@ -145,9 +246,20 @@ func main() {
 	logger.Info("[ok] Service bootstrap completed")
 	logger.Info("--- MCMultiverse Manager is running ---")
 
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		current := cfg
+		for range hup {
+			current = reloadConfig(current, scheduler, cmdService, workerSvc, logger)
+		}
+	}()
+
+	// SIGINT/SIGTERM leave managed worlds running; SIGUSR1 saves and stops
+	// them first (drain), for restarting the manager host.
 	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
-	<-stop
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1)
+	sig := <-stop
 
 	logger.Info("--- Stopping MCMultiverse Manager ---")
 	logger.Info("[step] Shutting down HTTP server")
@@ -160,6 +272,27 @@ func main() {
 		logger.Info("[ok] HTTP server stopped")
 	}
 
+	if sig == syscall.SIGUSR1 {
+		logger.Infof("[step] Draining running instances (timeout %ds)", cfg.DrainTimeoutSec)
+		drainCtx, drainCancel := context.WithTimeout(context.Background(), time.Duration(cfg.DrainTimeoutSec)*time.Second)
+		stopped, err := workerSvc.DrainAll(drainCtx)
+		drainCancel()
+		if err != nil {
+			logger.Warnf("drain incomplete, stopped=%d: %v", len(stopped), err)
+		} else {
+			logger.Infof("[ok] Drained %d instances", len(stopped))
+		}
+	}
+
+	logger.Infof("[step] Waiting for post-create hooks (timeout %ds)", cfg.PostCreateHookTimeoutS)
+	hooksCtx, hooksCancel := context.WithTimeout(context.Background(), time.Duration(cfg.PostCreateHookTimeoutS)*time.Second)
+	if err := workerSvc.WaitHooks(hooksCtx); err != nil {
+		logger.Warnf("post-create hooks still running at shutdown: %v", err)
+	} else {
+		logger.Info("[ok] Post-create hooks finished")
+	}
+	hooksCancel()
+
 	logger.Info("[step] Closing database connector")
 	if err := connector.Close(); err != nil {
 		logger.Warnf("database close warning: %v", err)
@@ -182,22 +315,230 @@ func ensureDirs(dirs []string) error {
 	return nil
 }
 
+// postCreateHook is the hook command, or empty while the hook is disabled.
+func postCreateHook(cfg config.Config) string {
+	if !cfg.PostCreateHookEnabled {
+		return ""
+	}
+	return cfg.PostCreateHook
+}
+
+// preDestroyHook is the hook command, or empty while the hook is disabled.
+func preDestroyHook(cfg config.Config) string {
+	if !cfg.PreDestroyHookEnabled {
+		return ""
+	}
+	return cfg.PreDestroyHook
+}
+
+func serverTapTLS(cfg config.Config) servertap.TLSOptions {
+	return servertap.TLSOptions{InsecureSkipVerify: cfg.ServerTapInsecure, CAFile: cfg.ServerTapCAFile}
+}
+
+func schedulerOptions(cfg config.Config) cronjob.Options {
+	return cronjob.Options{
+		OffInterval:        time.Duration(cfg.OffHour) * time.Hour,
+		RemoveDays:         cfg.RemoveDay,
+		IdleGrace:          time.Duration(cfg.IdleGraceMinutes) * time.Minute,
+		RequestRetention:   time.Duration(cfg.RequestRetentionDay) * 24 * time.Hour,
+		InstanceTapURLFmt:  cfg.MiniTapHostPattern,
+		ServerTapTimeout:   6 * time.Second,
+		ServerTapAuthName:  cfg.ServerTapAuthHeader,
+		ServerTapAuthKey:   cfg.ServerTapKey,
+		ServerTapTLS:       serverTapTLS(cfg),
+		Now:                time.Now,
+		IdleWarningLead:    time.Duration(cfg.IdleWarningMinutes) * time.Minute,
+		MaxArchiveBytes:    cfg.MaxArchiveBytes,
+		ArchivePruneNotice: time.Duration(cfg.ArchivePruneNoticeDay) * 24 * time.Hour,
+		IdleOffMessage:     cfg.IdleOffMessage,
+		HealthStaleAfter:   time.Duration(cfg.HealthStaleMinutes) * time.Minute,
+		AutoRecover: cronjob.AutoRecoverPolicy{
+			MaxAttempts: cfg.AutoRecoverAttempts,
+			Window:      time.Duration(cfg.AutoRecoverWindowMin) * time.Minute,
+		},
+	}
+}
+
+// reloadConfig re-reads the config on SIGHUP and applies the reloadable keys
+// to the running services. Other changed keys are logged and ignored; the
+// returned config is what is now in effect.
+func reloadConfig(cur config.Config, scheduler *cronjob.Scheduler, svc *cmdreceiver.ServiceI, w *worker.WorkerI, logger interface {
+	Infof(string, ...any)
+	Warnf(string, ...any)
+	Errorf(string, ...any)
+}) config.Config {
+	next, err := config.Load()
+	if err != nil {
+		logger.Errorf("config reload failed, keeping current config: %v", err)
+		return cur
+	}
+	if next.BootstrapAdminResolve {
+		// the running value came from Mojang, not the file
+		next.BootstrapAdminUUID = cur.BootstrapAdminUUID
+	}
+	changes := cur.Diff(next)
+	applied := cur
+	var keys []string
+	for _, ch := range changes {
+		if !ch.Reloadable {
+			logger.Warnf("config reload: %s changed but needs a restart; ignored", ch.Key)
+			continue
+		}
+		keys = append(keys, ch.Key)
+	}
+	if len(keys) == 0 {
+		logger.Infof("config reload: nothing to apply")
+		return cur
+	}
+	applied.ServerTapKey = next.ServerTapKey
+	applied.ServerTapAuthHeader = next.ServerTapAuthHeader
+	applied.OffHour = next.OffHour
+	applied.RemoveDay = next.RemoveDay
+	applied.IdleGraceMinutes = next.IdleGraceMinutes
+	applied.IdleWarningMinutes = next.IdleWarningMinutes
+	applied.RequestRetentionDay = next.RequestRetentionDay
+	applied.CommandCooldownSec = next.CommandCooldownSec
+
+	scheduler.UpdateOptions(schedulerOptions(applied))
+	svc.SetServerTapAuth(applied.ServerTapAuthHeader, applied.ServerTapKey)
+	svc.SetActionCooldown(time.Duration(applied.CommandCooldownSec) * time.Second)
+	w.SetServerTapAuth(applied.ServerTapAuthHeader, applied.ServerTapKey)
+	logger.Infof("config reload applied: %s", strings.Join(keys, ","))
+	return applied
+}
+
+// preflightLobbyServerTap pings the lobby once so a wrong URL or key shows up
+// at startup; the caller only warns because the lobby may come up later.
+func preflightLobbyServerTap(cfg config.Config) error {
+	conn, err := servertap.NewConnectorWithOptions(cfg.LobbyServerTapURL, servertap.ConnectorOptions{
+		Timeout:    5 * time.Second,
+		AuthHeader: cfg.ServerTapAuthHeader,
+		AuthKey:    cfg.ServerTapKey,
+		TLS:        serverTapTLS(cfg),
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return conn.Ping(ctx)
+}
+
+// resolveMojangUUID looks up the online-mode UUID of a player name and
+// returns it in the dashed form stored in users.mc_uuid.
+func resolveMojangUUID(name string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, mojangProfileURL+url.PathEscape(name), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("no Mojang profile named %q", name)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("mojang returned status %d", resp.StatusCode)
+	}
+	var profile struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
+		return "", err
+	}
+	id := strings.ToLower(profile.ID)
+	if len(id) != 32 {
+		return "", fmt.Errorf("unexpected Mojang id %q", profile.ID)
+	}
+	return id[0:8] + "-" + id[8:12] + "-" + id[12:16] + "-" + id[16:20] + "-" + id[20:], nil
+}
+
+const (
+	lobbySetupAttemptTimeout = 20 * time.Second
+	lobbySetupMaxInterval    = 2 * time.Minute
+)
+
+// ensureLobbyAdminAccess opens the lobby to players and ops every admin
+// there. The lobby is often still booting when the manager starts, so the
+// setup is retried lobby_setup_attempts times with a doubling wait.
 func ensureLobbyAdminAccess(ctx context.Context, cfg config.Config, repos pgsql.Repos, logger interface {
 	Infof(string, ...any)
 	Warnf(string, ...any)
 	Errorf(string, ...any)
 }) error {
-	conn, err := servertap.NewConnectorWithAuth(cfg.LobbyServerTapURL, 6*time.Second, cfg.ServerTapAuthHeader, cfg.ServerTapKey)
+	conn, err := servertap.NewConnectorWithOptions(cfg.LobbyServerTapURL, servertap.ConnectorOptions{
+		Timeout:    6 * time.Second,
+		AuthHeader: cfg.ServerTapAuthHeader,
+		AuthKey:    cfg.ServerTapKey,
+		TLS:        serverTapTLS(cfg),
+	})
 	if err != nil {
 		return err
 	}
+	interval := time.Duration(cfg.LobbySetupIntervalSec) * time.Second
+	return retryLobbySetup(ctx, cfg.LobbySetupAttempts, interval, sleepContext, func(ctx context.Context) error {
+		return applyLobbyAdminAccess(ctx, conn, repos, cfg.BootstrapAdminName, logger)
+	}, logger)
+}
+
+// retryLobbySetup runs setup up to attempts times, each bounded by
+// lobbySetupAttemptTimeout. The wait between attempts starts at interval and
+// doubles up to lobbySetupMaxInterval. Rejected credentials are not retried.
+func retryLobbySetup(ctx context.Context, attempts int, interval time.Duration, sleep func(context.Context, time.Duration) error, setup func(context.Context) error, logger interface {
+	Infof(string, ...any)
+	Warnf(string, ...any)
+}) error {
+	attempts = max(attempts, 1)
+	wait := interval
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, lobbySetupAttemptTimeout)
+		err = setup(attemptCtx)
+		cancel()
+		if err == nil {
+			if attempt > 1 {
+				logger.Infof("[main] lobby admin setup succeeded on attempt %d/%d", attempt, attempts)
+			}
+			return nil
+		}
+		if servertap.IsAuthError(err) || attempt == attempts {
+			break
+		}
+		logger.Warnf("[main] lobby admin setup attempt %d/%d failed, retry in %s: %v", attempt, attempts, wait, err)
+		if serr := sleep(ctx, wait); serr != nil {
+			return fmt.Errorf("%w (retry aborted: %w)", err, serr)
+		}
+		wait = min(wait*2, lobbySetupMaxInterval)
+	}
+	return err
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
 
+func applyLobbyAdminAccess(ctx context.Context, conn servertap.Executor, repos pgsql.Repos, bootstrapAdminName string, logger interface {
+	Infof(string, ...any)
+	Warnf(string, ...any)
+	Errorf(string, ...any)
+}) error {
 	admins, err := repos.User.ListByRole(ctx, "admin")
 	if err != nil {
 		return fmt.Errorf("load admin users: %w", err)
 	}
-	if len(admins) == 0 && strings.TrimSpace(cfg.BootstrapAdminName) != "" {
-		admins = append(admins, pgsql.User{MCName: strings.TrimSpace(cfg.BootstrapAdminName), ServerRole: "admin"})
+	if len(admins) == 0 && strings.TrimSpace(bootstrapAdminName) != "" {
+		admins = append(admins, pgsql.User{MCName: strings.TrimSpace(bootstrapAdminName), ServerRole: "admin"})
 	}
 	if len(admins) == 0 {
 		return fmt.Errorf("no admin user found")
@@ -218,7 +559,12 @@ func ensureLobbyAdminAccess(ctx context.Context, cfg config.Config, repos pgsql.
 		if _, exists := seen[key]; exists {
 			continue
 		}
-		if _, err := conn.Execute(ctx, servertap.ExecuteRequest{Command: "op " + name}); err != nil {
+		cmd, err := servertap.NewCommandBuilder("op").PlayerArg(name).BuildChecked()
+		if err != nil {
+			logger.Warnf("[main] skip lobby op: %v", err)
+			continue
+		}
+		if _, err := conn.Execute(ctx, servertap.ExecuteRequest{Command: cmd}); err != nil {
 			return err
 		}
 		seen[key] = struct{}{}
@@ -227,17 +573,24 @@ func ensureLobbyAdminAccess(ctx context.Context, cfg config.Config, repos pgsql.
 	return nil
 }
 
-func bootstrapRuntimeSelfCheck(ctx context.Context, cfg config.Config, repos pgsql.Repos, w worker.Worker, logger interface {
+func bootstrapRuntimeSelfCheck(ctx context.Context, cfg config.Config, repos pgsql.Repos, w worker.Worker, setVersionsInstalled func(bool), logger interface {
 	Infof(string, ...any)
 	Warnf(string, ...any)
 	Errorf(string, ...any)
 }) error {
-	versions, err := detectRunnableVersions(cfg.VersionRootPath)
+	supported, err := w.SupportedVersions()
 	if err != nil {
+		setVersionsInstalled(false)
 		return err
 	}
+	var versions []string
+	for _, vs := range supported {
+		versions = append(versions, vs.Installed...)
+	}
+	sort.Strings(versions)
+	setVersionsInstalled(len(versions) > 0)
 	if len(versions) == 0 {
-		logger.Warnf("no runnable versions found under %s", cfg.VersionRootPath)
+		logger.Warnf("no runnable versions found under %s; create actions are refused until one is installed", cfg.VersionRootPath)
 		return nil
 	}
 
@@ -275,37 +628,17 @@ func bootstrapRuntimeSelfCheck(ctx context.Context, cfg config.Config, repos pgs
 		}
 		runtimeID := sql.NullString{String: "runtime-" + strings.ReplaceAll(ver, ".", "_"), Valid: true}
 
-		instanceID, err := repos.MapInstance.Create(ctx, pgsql.MapInstance{
+		report := worker.RunSelfTestCycle(ctx, repos, w, worker.SelfTestCycle{
 			Alias:       "bootstrap-" + strings.ReplaceAll(ver, ".", "-"),
 			OwnerID:     admin.ID,
-			SourceType:  "empty",
 			GameVersion: ver,
-			AccessMode:  "privacy",
-			Status:      string(worker.StatusWaiting),
+			Cleanup:     cfg.PurgeBootstrapInstances,
 		})
-		if err != nil {
-			alias := "bootstrap-" + strings.ReplaceAll(ver, ".", "-")
-			existing, readErr := repos.MapInstance.ReadByAlias(ctx, alias)
-			if readErr != nil {
-				logFail(ver, "create instance", err)
-				continue
-			}
-			instanceID = existing.ID
-		}
-		_, _ = repos.InstanceMember.Create(ctx, pgsql.InstanceMember{InstanceID: instanceID, UserID: admin.ID, Role: "owner"})
-
-		if err := w.StartEmpty(ctx, instanceID, ver); err != nil {
-			logFail(ver, "start empty", err)
-			continue
-		}
-		if err := w.StopAndArchive(ctx, instanceID); err != nil {
-			logFail(ver, "stop/archive", err)
+		if !report.Passed() {
+			logFail(ver, "self-test cycle", errors.New(report.Summary()))
 			continue
 		}
-		// if err := w.DeleteArchived(ctx, instanceID); err != nil {
-		// 	logFail(ver, "delete archived", err)
-		// 	continue
-		// }
+		logger.Infof("[bootstrap] %s cycle passed: %s", ver, report.Summary())
 		_ = repos.GameVersion.UpsertCheckResult(ctx, ver, runtimeID, coreJar, "verified", sql.NullString{})
 	}
 
@@ -327,26 +660,6 @@ func detectCoreJarName(versionRoot string, version string) (string, error) {
 	return filepath.Base(matches[len(matches)-1]), nil
 }
 
-func detectRunnableVersions(versionRoot string) ([]string, error) {
-	entries, err := os.ReadDir(versionRoot)
-	if err != nil {
-		return nil, err
-	}
-	out := make([]string, 0)
-	for _, e := range entries {
-		if !e.IsDir() {
-			continue
-		}
-		ver := e.Name()
-		jars, _ := filepath.Glob(filepath.Join(versionRoot, ver, "paper-*.jar"))
-		if len(jars) > 0 {
-			out = append(out, ver)
-		}
-	}
-	sort.Strings(out)
-	return out, nil
-}
-
 func ensureBootstrapAdmin(ctx context.Context, repos pgsql.Repos, uuid, name string) (pgsql.User, error) {
 	u, err := repos.User.ReadByUUID(ctx, uuid)
 	if err == nil {
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"mcmm/internal/log"
+	"mcmm/internal/pgsql"
+	"mcmm/internal/servertap"
+)
+
+// flakyLobby fails every command until up is set, as a lobby still booting.
+type flakyLobby struct {
+	up       bool
+	commands []string
+}
+
+func (l *flakyLobby) Execute(ctx context.Context, req servertap.ExecuteRequest) (servertap.ParsedResponse, error) {
+	if !l.up {
+		return servertap.ParsedResponse{}, errors.New("connection refused")
+	}
+	l.commands = append(l.commands, req.Command)
+	return servertap.ParsedResponse{}, nil
+}
+
+type adminUserRepo struct {
+	pgsql.UserRepo
+	admins []pgsql.User
+}
+
+func (r adminUserRepo) ListByRole(ctx context.Context, role string) ([]pgsql.User, error) {
+	return r.admins, nil
+}
+
+func TestRetryLobbySetup_SucceedsOnceLobbyComesUp(t *testing.T) {
+	lobby := &flakyLobby{}
+	repos := pgsql.Repos{User: adminUserRepo{admins: []pgsql.User{{MCName: "root"}, {MCName: "LCMonitor"}}}}
+	logger := log.Component("main")
+	var waits []time.Duration
+	sleep := func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		lobby.up = true
+		return nil
+	}
+	attempts := 0
+	err := retryLobbySetup(context.Background(), 3, 5*time.Second, sleep, func(ctx context.Context) error {
+		attempts++
+		return applyLobbyAdminAccess(ctx, lobby, repos, "", logger)
+	}, logger)
+	if err != nil {
+		t.Fatalf("setup should succeed on the second attempt: %v", err)
+	}
+	if attempts != 2 || !slices.Equal(waits, []time.Duration{5 * time.Second}) {
+		t.Fatalf("expected 2 attempts with one 5s wait, got attempts=%d waits=%v", attempts, waits)
+	}
+	if want := []string{"whitelist off", "op root", "op LCMonitor"}; !slices.Equal(lobby.commands, want) {
+		t.Fatalf("expected %v, got %v", want, lobby.commands)
+	}
+}
+
+func TestRetryLobbySetup_GivesUpAfterAttemptsWithGrowingWait(t *testing.T) {
+	var waits []time.Duration
+	sleep := func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	down := errors.New("connection refused")
+	err := retryLobbySetup(context.Background(), 4, time.Minute, sleep, func(ctx context.Context) error { return down }, log.Component("main"))
+	if !errors.Is(err, down) {
+		t.Fatalf("expected the last setup error, got %v", err)
+	}
+	if want := []time.Duration{time.Minute, 2 * time.Minute, 2 * time.Minute}; !slices.Equal(waits, want) {
+		t.Fatalf("expected waits %v, got %v", want, waits)
+	}
+}
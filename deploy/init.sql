@@ -61,20 +61,58 @@ CREATE INDEX IF NOT EXISTS idx_game_versions_status ON game_versions (status);
 CREATE TABLE IF NOT EXISTS map_instances (
   id BIGSERIAL PRIMARY KEY,
   alias TEXT NOT NULL UNIQUE,
+  display_name TEXT NOT NULL DEFAULT '',
   owner_id BIGINT NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
   template_id BIGINT REFERENCES map_templates(id) ON DELETE SET NULL,
   source_type TEXT NOT NULL CHECK (source_type IN ('template', 'upload', 'empty')),
   game_version TEXT NOT NULL,
   access_mode TEXT NOT NULL DEFAULT 'privacy' CHECK (access_mode IN ('privacy', 'public', 'lockdown')),
   status TEXT NOT NULL CHECK (status IN ('Waiting', 'Preparing', 'Starting', 'On', 'Stopping', 'Off', 'Archived')),
-  health_status TEXT NOT NULL DEFAULT 'unknown' CHECK (health_status IN ('unknown', 'healthy', 'start_failed', 'unreachable')),
+  health_status TEXT NOT NULL DEFAULT 'unknown' CHECK (health_status IN ('unknown', 'healthy', 'start_failed', 'unreachable', 'auth_failed')),
   last_error_msg TEXT,
   last_health_at TIMESTAMPTZ,
   created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
   updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
   last_active_at TIMESTAMPTZ,
-  archived_at TIMESTAMPTZ
+  archived_at TIMESTAMPTZ,
+  last_compose_output TEXT,
+  archive_pinned BOOLEAN NOT NULL DEFAULT FALSE,
+  notes TEXT NOT NULL DEFAULT '',
+  servertap_key TEXT NOT NULL DEFAULT '',
+  host_port INTEGER NOT NULL DEFAULT 0,
+  cpu_limit REAL NOT NULL DEFAULT 0,
+  mem_limit_mb INTEGER NOT NULL DEFAULT 0,
+  gamemode TEXT NOT NULL DEFAULT '',
+  difficulty TEXT NOT NULL DEFAULT '',
+  max_players INTEGER NOT NULL DEFAULT 0,
+  motd TEXT NOT NULL DEFAULT '',
+  storage_type TEXT NOT NULL DEFAULT '',
+  level_seed TEXT NOT NULL DEFAULT '',
+  recover_attempts INTEGER NOT NULL DEFAULT 0,
+  recover_window_at TIMESTAMPTZ,
+  started_on_at TIMESTAMPTZ,
+  prune_notice_at TIMESTAMPTZ
 );
+ALTER TABLE map_instances ADD COLUMN IF NOT EXISTS display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE map_instances ADD COLUMN IF NOT EXISTS last_compose_output TEXT;
+ALTER TABLE map_instances ADD COLUMN IF NOT EXISTS archive_pinned BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE map_instances ADD COLUMN IF NOT EXISTS notes TEXT NOT NULL DEFAULT '';
+ALTER TABLE map_instances ADD COLUMN IF NOT EXISTS servertap_key TEXT NOT NULL DEFAULT '';
+ALTER TABLE map_instances ADD COLUMN IF NOT EXISTS host_port INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE map_instances ADD COLUMN IF NOT EXISTS cpu_limit REAL NOT NULL DEFAULT 0;
+ALTER TABLE map_instances ADD COLUMN IF NOT EXISTS mem_limit_mb INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE map_instances ADD COLUMN IF NOT EXISTS gamemode TEXT NOT NULL DEFAULT '';
+ALTER TABLE map_instances ADD COLUMN IF NOT EXISTS difficulty TEXT NOT NULL DEFAULT '';
+ALTER TABLE map_instances ADD COLUMN IF NOT EXISTS max_players INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE map_instances ADD COLUMN IF NOT EXISTS motd TEXT NOT NULL DEFAULT '';
+ALTER TABLE map_instances ADD COLUMN IF NOT EXISTS storage_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE map_instances ADD COLUMN IF NOT EXISTS level_seed TEXT NOT NULL DEFAULT '';
+ALTER TABLE map_instances ADD COLUMN IF NOT EXISTS recover_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE map_instances ADD COLUMN IF NOT EXISTS recover_window_at TIMESTAMPTZ;
+ALTER TABLE map_instances ADD COLUMN IF NOT EXISTS started_on_at TIMESTAMPTZ;
+ALTER TABLE map_instances ADD COLUMN IF NOT EXISTS prune_notice_at TIMESTAMPTZ;
+ALTER TABLE map_instances DROP CONSTRAINT IF EXISTS map_instances_health_status_check;
+ALTER TABLE map_instances ADD CONSTRAINT map_instances_health_status_check CHECK (health_status IN ('unknown', 'healthy', 'start_failed', 'unreachable', 'auth_failed'));
 CREATE INDEX IF NOT EXISTS idx_map_instances_owner_id ON map_instances (owner_id);
 CREATE INDEX IF NOT EXISTS idx_map_instances_template_id ON map_instances (template_id);
 CREATE INDEX IF NOT EXISTS idx_map_instances_game_version ON map_instances (game_version);
@@ -86,12 +124,24 @@ CREATE TABLE IF NOT EXISTS instance_members (
   id BIGSERIAL PRIMARY KEY,
   instance_id BIGINT NOT NULL REFERENCES map_instances(id) ON DELETE CASCADE,
   user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-  role TEXT NOT NULL CHECK (role IN ('owner', 'member')),
+  role TEXT NOT NULL CHECK (role IN ('owner', 'manager', 'member')),
   created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
   UNIQUE (instance_id, user_id)
 );
+ALTER TABLE instance_members DROP CONSTRAINT IF EXISTS instance_members_role_check;
+ALTER TABLE instance_members ADD CONSTRAINT instance_members_role_check CHECK (role IN ('owner', 'manager', 'member'));
 CREATE INDEX IF NOT EXISTS idx_instance_members_user_id ON instance_members (user_id);
 
+-- Whitelist changes made while an instance is Off; replayed on its next start.
+CREATE TABLE IF NOT EXISTS pending_whitelist_ops (
+  id BIGSERIAL PRIMARY KEY,
+  instance_id BIGINT NOT NULL REFERENCES map_instances(id) ON DELETE CASCADE,
+  player_name TEXT NOT NULL,
+  action TEXT NOT NULL CHECK (action IN ('add', 'remove')),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pending_whitelist_ops_player ON pending_whitelist_ops (instance_id, LOWER(player_name));
+
 CREATE TABLE IF NOT EXISTS user_requests (
   id BIGSERIAL PRIMARY KEY,
   request_id UUID NOT NULL UNIQUE,
@@ -104,7 +154,7 @@ CREATE TABLE IF NOT EXISTS user_requests (
     status IN (
       'pending', 'approved', 'rejected', 'canceled',
       'processing', 'succeeded', 'failed',
-      'accepted'
+      'accepted', 'expired'
     )
   ),
   reviewed_by_user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
@@ -119,4 +169,34 @@ CREATE TABLE IF NOT EXISTS user_requests (
 CREATE INDEX IF NOT EXISTS idx_user_requests_request_type ON user_requests (request_type);
 CREATE INDEX IF NOT EXISTS idx_user_requests_actor_user_id ON user_requests (actor_user_id);
 CREATE INDEX IF NOT EXISTS idx_user_requests_target_instance_id ON user_requests (target_instance_id);
+ALTER TABLE user_requests DROP CONSTRAINT IF EXISTS user_requests_status_check;
+ALTER TABLE user_requests ADD CONSTRAINT user_requests_status_check CHECK (
+  status IN (
+    'pending', 'approved', 'rejected', 'canceled',
+    'processing', 'succeeded', 'failed',
+    'accepted', 'expired'
+  )
+);
 CREATE INDEX IF NOT EXISTS idx_user_requests_status ON user_requests (status);
+
+-- Terminal requests are moved here by the retention job; no FKs so history survives deletes.
+CREATE TABLE IF NOT EXISTS user_requests_archive (
+  id BIGINT PRIMARY KEY,
+  request_id UUID NOT NULL,
+  request_type TEXT NOT NULL,
+  actor_user_id BIGINT NOT NULL,
+  target_instance_id BIGINT,
+  template_id BIGINT,
+  requested_alias TEXT,
+  status TEXT NOT NULL,
+  reviewed_by_user_id BIGINT,
+  review_note TEXT,
+  response_payload JSONB NOT NULL DEFAULT '{}'::jsonb,
+  error_code TEXT,
+  error_msg TEXT,
+  expires_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL,
+  archived_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_user_requests_archive_actor_user_id ON user_requests_archive (actor_user_id);
@@ -9,36 +9,71 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
-	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"mcmm/internal/log"
+	"mcmm/internal/metrics"
 	"mcmm/internal/pgsql"
 	"mcmm/internal/servertap"
 	"mcmm/internal/worker"
 )
 
 type WorldCommandRequest struct {
-	Action       string `json:"action"`
-	ActorUUID    string `json:"actor_uuid"`
-	ActorName    string `json:"actor_name"`
-	WorldAlias   string `json:"world_alias"`
-	Target       string `json:"target_name"`
-	RequestID    string `json:"request_id"`
-	GameVersion  string `json:"game_version"`
-	TemplateName string `json:"template_name"`
-	Reason       string `json:"reason"`
-	AccessMode   string `json:"access_mode"`
+	Action          string `json:"action"`
+	ActorUUID       string `json:"actor_uuid"`
+	ActorName       string `json:"actor_name"`
+	WorldAlias      string `json:"world_alias"`
+	Target          string `json:"target_name"`
+	RequestID       string `json:"request_id"`
+	GameVersion     string `json:"game_version"`
+	TemplateName    string `json:"template_name"`
+	Reason          string `json:"reason"`
+	AccessMode      string `json:"access_mode"`
+	DisplayName     string `json:"display_name"`
+	NewAlias        string `json:"new_alias"`
+	Role            string `json:"role"`
+	Note            string `json:"note"`
+	Query           string `json:"query"`
+	Restart         bool   `json:"restart"`
+	Force           bool   `json:"force"`
+	IncludeArchived bool   `json:"include_archived"`
+	Page            int    `json:"page"`
+	PageSize        int    `json:"page_size"`
+	Status          string `json:"status"`
+	StorageType     string `json:"storage_type"`
+	ServerID        string `json:"server_id"`
+	Seed            string `json:"seed"`
+	Gamemode        string `json:"gamemode"`
+	Difficulty      string `json:"difficulty"`
+	MaxPlayers      int    `json:"max_players"`
+	MOTD            string `json:"motd"`
+
+	// CPULimit and MemLimitMB are only changed when present; 0 goes back to
+	// the configured default.
+	CPULimit   *float64 `json:"cpu_limit"`
+	MemLimitMB *int     `json:"mem_limit_mb"`
 }
 
 type WorldCommandResponse struct {
-	Status  string `json:"status"`
-	Message string `json:"message,omitempty"`
+	Status  string            `json:"status"`
+	Message string            `json:"message,omitempty"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	// Code classifies a worker failure (worker.ErrorCode) so clients need not
+	// parse Message.
+	Code string `json:"code,omitempty"`
+	// Stale marks a read answered from the last good result because the
+	// database was unavailable.
+	Stale bool `json:"stale,omitempty"`
 }
 
 type Service interface {
@@ -64,28 +99,96 @@ func (h *HandlerI) handleWorldCommand(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusMethodNotAllowed, WorldCommandResponse{Status: "error", Message: "method not allowed"})
 		return
 	}
-	if err := r.ParseForm(); err != nil {
-		writeJSON(w, http.StatusBadRequest, WorldCommandResponse{Status: "error", Message: "invalid form"})
-		return
+	var (
+		req    WorldCommandRequest
+		fields = fieldErrors{}
+	)
+	if isJSONRequest(r) {
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONCommandBytes))
+		if err := dec.Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, WorldCommandResponse{Status: "error", Message: "invalid json"})
+			return
+		}
+		req.Page = fields.jsonPage("page", req.Page)
+		req.PageSize = fields.jsonPage("page_size", req.PageSize)
+	} else {
+		if err := r.ParseForm(); err != nil {
+			writeJSON(w, http.StatusBadRequest, WorldCommandResponse{Status: "error", Message: "invalid form"})
+			return
+		}
+		req = worldCommandFromForm(r, fields)
 	}
-
-	req := WorldCommandRequest{
-		Action:       strings.TrimSpace(r.FormValue("action")),
-		ActorUUID:    strings.TrimSpace(r.FormValue("actor_uuid")),
-		ActorName:    strings.TrimSpace(r.FormValue("actor_name")),
-		WorldAlias:   strings.TrimSpace(r.FormValue("world_alias")),
-		Target:       strings.TrimSpace(r.FormValue("target_name")),
-		RequestID:    strings.TrimSpace(r.FormValue("request_id")),
-		GameVersion:  strings.TrimSpace(r.FormValue("game_version")),
-		TemplateName: strings.TrimSpace(r.FormValue("template_name")),
-		Reason:       strings.TrimSpace(r.FormValue("reason")),
-		AccessMode:   strings.TrimSpace(r.FormValue("access_mode")),
+	req.trimSpace()
+	if len(fields) > 0 {
+		status, resp := fields.response()
+		writeJSON(w, status, resp)
+		return
 	}
 
 	status, resp := h.service.HandleWorldCommand(r.Context(), req)
 	writeJSON(w, status, resp)
 }
 
+// maxJSONCommandBytes bounds a JSON world command body.
+const maxJSONCommandBytes = 1 << 20
+
+// isJSONRequest reports whether the body is application/json; anything else
+// is parsed as a form, which is what the MC plugin sends.
+func isJSONRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// worldCommandFromForm reads a WorldCommandRequest from form values, noting
+// malformed booleans and page numbers in fields.
+func worldCommandFromForm(r *http.Request, fields fieldErrors) WorldCommandRequest {
+	return WorldCommandRequest{
+		Action:          r.FormValue("action"),
+		ActorUUID:       r.FormValue("actor_uuid"),
+		ActorName:       r.FormValue("actor_name"),
+		WorldAlias:      r.FormValue("world_alias"),
+		Target:          r.FormValue("target_name"),
+		RequestID:       r.FormValue("request_id"),
+		GameVersion:     r.FormValue("game_version"),
+		TemplateName:    r.FormValue("template_name"),
+		Reason:          r.FormValue("reason"),
+		AccessMode:      r.FormValue("access_mode"),
+		DisplayName:     r.FormValue("display_name"),
+		NewAlias:        r.FormValue("new_alias"),
+		Role:            r.FormValue("role"),
+		Note:            r.FormValue("note"),
+		Query:           r.FormValue("query"),
+		Status:          r.FormValue("status"),
+		StorageType:     r.FormValue("storage_type"),
+		ServerID:        r.FormValue("server_id"),
+		Seed:            r.FormValue("seed"),
+		Gamemode:        r.FormValue("gamemode"),
+		Difficulty:      r.FormValue("difficulty"),
+		MOTD:            r.FormValue("motd"),
+		Restart:         fields.formBool(r, "restart"),
+		Force:           fields.formBool(r, "force"),
+		IncludeArchived: fields.formBool(r, "include_archived"),
+		Page:            fields.formPage(r, "page"),
+		PageSize:        fields.formPage(r, "page_size"),
+		MaxPlayers:      fields.formPositive(r, "max_players"),
+		CPULimit:        fields.formFloat(r, "cpu_limit"),
+		MemLimitMB:      fields.formInt(r, "mem_limit_mb"),
+	}
+}
+
+// trimSpace trims every string field, so form and JSON bodies reach the
+// service in the same shape.
+func (req *WorldCommandRequest) trimSpace() {
+	for _, f := range []*string{
+		&req.Action, &req.ActorUUID, &req.ActorName, &req.WorldAlias, &req.Target,
+		&req.RequestID, &req.GameVersion, &req.TemplateName, &req.Reason, &req.AccessMode,
+		&req.DisplayName, &req.NewAlias, &req.Role, &req.Note, &req.Query, &req.Status,
+		&req.StorageType, &req.ServerID, &req.Seed, &req.Gamemode, &req.Difficulty, &req.MOTD,
+	} {
+		*f = strings.TrimSpace(*f)
+	}
+}
+
 func (h *HandlerI) handlePlayerJoin(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeJSON(w, http.StatusMethodNotAllowed, WorldCommandResponse{Status: "error", Message: "method not allowed"})
@@ -103,6 +206,7 @@ func (h *HandlerI) handlePlayerJoin(w http.ResponseWriter, r *http.Request) {
 
 type ServiceI struct {
 	repos              pgsql.Repos
+	txConn             pgsql.SQLConnector
 	worker             worker.Worker
 	defaultGameVersion string
 	lobbyTapURL        string
@@ -112,6 +216,27 @@ type ServiceI struct {
 	proxyBridgeURL     string
 	proxyAuthHeader    string
 	proxyAuthToken     string
+	cooldown           *actionCooldown
+	metrics            *metrics.Registry
+	lobbyConnMu        sync.Mutex
+	lobbyConn          *servertap.Connector
+	tapNotifier        Notifier
+	webhook            Notifier
+	webhookOnly        bool
+	starterWorld       StarterWorldOptions
+	lockdownKickMsg    string
+	storageTypes       []string
+	defaultStorageType string
+	serverIDPrefix     string
+	bulkConcurrency    int
+	requestExpiry      time.Duration
+	disabledActions    map[string]bool
+	noVersions         atomic.Bool // set when the runtime self-check found no runnable version
+	instanceKeys       *servertap.InstanceKeyring
+	serverTapTLS       servertap.TLSOptions
+	versionCache       *versionListCache
+	readCache          *readFallbackCache
+	authMu             sync.RWMutex // guards serverTapKey/serverTapAuthName
 	logger             interface {
 		Infof(string, ...any)
 		Warnf(string, ...any)
@@ -119,8 +244,6 @@ type ServiceI struct {
 	}
 }
 
-var onlineListRegex = regexp.MustCompile(`(?i)players online:\s*(.+)$`)
-
 func NewServiceI(
 	repos pgsql.Repos,
 	w worker.Worker,
@@ -139,7 +262,7 @@ func NewServiceI(
 	if strings.TrimSpace(proxyAuthHeader) == "" {
 		proxyAuthHeader = "Authorization"
 	}
-	return &ServiceI{
+	s := &ServiceI{
 		repos:              repos,
 		worker:             w,
 		defaultGameVersion: defaultGameVersion,
@@ -150,11 +273,270 @@ func NewServiceI(
 		proxyBridgeURL:     strings.TrimRight(strings.TrimSpace(proxyBridgeURL), "/"),
 		proxyAuthHeader:    strings.TrimSpace(proxyAuthHeader),
 		proxyAuthToken:     strings.TrimSpace(proxyAuthToken),
+		cooldown:           newActionCooldown(defaultActionCooldown, time.Now),
+		versionCache:       newVersionListCache(defaultVersionListTTL, time.Now),
+		readCache:          newReadFallbackCache(defaultReadFallbackTTL, time.Now),
+		lockdownKickMsg:    DefaultLockdownKickMessage,
+		storageTypes:       []string{DefaultStorageType},
+		defaultStorageType: DefaultStorageType,
+		serverIDPrefix:     worker.DefaultServerIDPrefix,
+		bulkConcurrency:    defaultBulkPowerConcurrency,
 		logger:             log.Component("cmdreceiver"),
 	}
+	s.tapNotifier = NewServerTapNotifier(func() (servertap.Executor, error) { return s.lobbyConnector() })
+	return s
+}
+
+// SetWebhookNotifier sends request events (created, approved, failed) to n
+// as well; with replaceLobby they are no longer told in the lobby. Other
+// notifications stay lobby-only.
+func (s *ServiceI) SetWebhookNotifier(n Notifier, replaceLobby bool) {
+	s.webhook = n
+	s.webhookOnly = n != nil && replaceLobby
+}
+
+// SetNotifyLimits bounds the lobby `tell` fan-out: how many players are told
+// in parallel and how long a single tell may take.
+func (s *ServiceI) SetNotifyLimits(concurrency int, sendTimeout time.Duration) {
+	if n, ok := s.tapNotifier.(*ServerTapNotifier); ok {
+		n.SetLimits(concurrency, sendTimeout)
+	}
+}
+
+// DefaultLockdownKickMessage is the kick reason used when none is configured.
+const DefaultLockdownKickMessage = "Server is in lockdown"
+
+// SetLockdownKickMessage sets the reason shown to players removed by
+// instance_lockdown. {world}, {name} and {id} are replaced with the instance
+// alias, display name and id. Empty restores the default.
+func (s *ServiceI) SetLockdownKickMessage(tmpl string) {
+	tmpl = strings.TrimSpace(tmpl)
+	if tmpl == "" {
+		tmpl = DefaultLockdownKickMessage
+	}
+	s.lockdownKickMsg = tmpl
+}
+
+// DefaultStorageType is the only storage type offered when none are configured.
+const DefaultStorageType = "standard"
+
+// SetStorageTypes sets which storage_type values create actions accept and
+// the one new instances get when none is given. An empty list restores the
+// default; an empty def falls back to the first allowed type.
+func (s *ServiceI) SetStorageTypes(allowed []string, def string) {
+	types := make([]string, 0, len(allowed))
+	for _, t := range allowed {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			types = append(types, t)
+		}
+	}
+	if len(types) == 0 {
+		types = []string{DefaultStorageType}
+	}
+	def = strings.ToLower(strings.TrimSpace(def))
+	if def == "" {
+		def = types[0]
+	}
+	s.storageTypes = types
+	s.defaultStorageType = def
+}
+
+// storageTypeOrDefault returns t, or the configured default when t is empty.
+func (s *ServiceI) storageTypeOrDefault(t string) string {
+	if t == "" {
+		return s.defaultStorageType
+	}
+	return t
+}
+
+const defaultBulkPowerConcurrency = 4
+
+// SetBulkPowerConcurrency bounds how many instances instance_start_all and
+// instance_stop_all start or stop at once. Zero or less restores the default.
+func (s *ServiceI) SetBulkPowerConcurrency(n int) {
+	if n <= 0 {
+		n = defaultBulkPowerConcurrency
+	}
+	s.bulkConcurrency = n
+}
+
+// SetServerIDPrefix sets the prefix of the proxy server-ids players are sent
+// to (prefix + instance id). Empty restores worker.DefaultServerIDPrefix.
+// The proxy still reaches the instance by its container name.
+func (s *ServiceI) SetServerIDPrefix(prefix string) {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" {
+		prefix = worker.DefaultServerIDPrefix
+	}
+	s.serverIDPrefix = prefix
+}
+
+// SetDisabledActions turns the listed actions off for everyone, admins
+// included. Aliases share a switch: disabling world_remove also disables
+// delete. Names no action answers to are logged and ignored, so a typo in
+// the config does not silently leave the action enabled.
+func (s *ServiceI) SetDisabledActions(actions []string) {
+	disabled := make(map[string]bool, len(actions))
+	for _, a := range actions {
+		a = strings.ToLower(strings.TrimSpace(a))
+		if a == "" {
+			continue
+		}
+		if !knownActions[a] {
+			s.logger.Warnf("disabled_actions: unknown action %q ignored", a)
+			continue
+		}
+		disabled[canonicalAction(a)] = true
+	}
+	s.disabledActions = disabled
+}
+
+// SetRequestExpiry sets how long a new pending request waits for review
+// before the scheduler expires it. Zero leaves new requests without expiry.
+func (s *ServiceI) SetRequestExpiry(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	s.requestExpiry = d
+}
+
+// SetVersionsInstalled records whether the runtime self-check found any
+// runnable game version. While none are installed, create actions fail up
+// front instead of deep in the worker.
+func (s *ServiceI) SetVersionsInstalled(ok bool) {
+	s.noVersions.Store(!ok)
+}
+
+// VersionsInstalled reports false only once the self-check found no runnable
+// version; before it has run, creates are allowed. While false it looks at
+// the version directory again, so a version installed after startup is
+// picked up without a restart.
+func (s *ServiceI) VersionsInstalled() bool {
+	if !s.noVersions.Load() {
+		return true
+	}
+	if s.worker == nil {
+		return false
+	}
+	supported, err := s.worker.SupportedVersions()
+	if err != nil {
+		return false
+	}
+	for _, vs := range supported {
+		if len(vs.Installed) > 0 {
+			s.logger.Infof("game version %s installed since startup; create actions enabled", vs.Installed[0])
+			s.noVersions.Store(false)
+			return true
+		}
+	}
+	return false
+}
+
+// StarterWorldOptions controls the world created for a player on first join.
+// TemplateTag empty means an empty world. Quota skips provisioning once the
+// server already has that many non-archived worlds; zero means no cap.
+type StarterWorldOptions struct {
+	Enabled     bool
+	TemplateTag string
+	Quota       int
+}
+
+func (s *ServiceI) SetStarterWorld(opts StarterWorldOptions) {
+	opts.TemplateTag = strings.TrimSpace(opts.TemplateTag)
+	s.starterWorld = opts
+}
+
+// SetActionCooldown changes how long an actor must wait before repeating a
+// heavy action such as world_on/world_off. Zero disables the limit.
+func (s *ServiceI) SetActionCooldown(window time.Duration) {
+	if s.cooldown != nil {
+		s.cooldown.setWindow(window)
+		return
+	}
+	s.cooldown = newActionCooldown(window, time.Now)
+}
+
+// SetServerTapAuth swaps the ServerTap credentials used for lobby and
+// instance commands; the cached lobby connector is rebuilt on next use.
+func (s *ServiceI) SetServerTapAuth(authName string, key string) {
+	s.authMu.Lock()
+	s.serverTapAuthName = strings.TrimSpace(authName)
+	s.serverTapKey = strings.TrimSpace(key)
+	s.authMu.Unlock()
+	s.lobbyConnMu.Lock()
+	s.lobbyConn = nil
+	s.lobbyConnMu.Unlock()
+}
+
+func (s *ServiceI) serverTapAuth() (string, string) {
+	s.authMu.RLock()
+	defer s.authMu.RUnlock()
+	return s.serverTapAuthName, s.serverTapKey
+}
+
+// SetInstanceKeyring lets instance ServerTap calls use each instance's own
+// key. Nil keeps the global key for every instance.
+func (s *ServiceI) SetInstanceKeyring(k *servertap.InstanceKeyring) {
+	s.instanceKeys = k
+}
+
+// SetServerTapTLS sets the TLS options for https lobby and instance ServerTap
+// endpoints; the cached lobby connector is rebuilt on next use.
+func (s *ServiceI) SetServerTapTLS(opts servertap.TLSOptions) {
+	s.lobbyConnMu.Lock()
+	s.serverTapTLS = opts
+	s.lobbyConn = nil
+	s.lobbyConnMu.Unlock()
+}
+
+// SetTxConnector lets writes spanning several rows (world transfer) commit or
+// roll back together. Without it they go through the plain repos.
+func (s *ServiceI) SetTxConnector(c pgsql.SQLConnector) {
+	s.txConn = c
+}
+
+// inTx runs fn on repos bound to one transaction, or on s.repos when no
+// connector was set.
+func (s *ServiceI) inTx(ctx context.Context, fn func(repos pgsql.Repos) error) error {
+	if s.txConn == nil {
+		return fn(s.repos)
+	}
+	return s.repos.InTx(ctx, s.txConn, fn)
+}
+
+// instanceConnector connects to inst's ServerTap with its own key, falling
+// back to the global key.
+func (s *ServiceI) instanceConnector(inst pgsql.MapInstance) (*servertap.Connector, error) {
+	authName, key := s.serverTapAuth()
+	tapURL := fmt.Sprintf(s.instanceTapPattern, inst.ID)
+	return servertap.NewConnectorWithOptions(tapURL, servertap.ConnectorOptions{
+		Timeout:    5 * time.Second,
+		AuthHeader: authName,
+		AuthKey:    s.instanceKeys.KeyFor(inst.ServerTapKey, key),
+		TLS:        s.serverTapTLS,
+	})
+}
+
+// SetMetrics makes HandleWorldCommand count handled commands by action and
+// status code. A nil registry disables counting.
+func (s *ServiceI) SetMetrics(m *metrics.Registry) {
+	s.metrics = m
 }
 
 func (s *ServiceI) HandleWorldCommand(ctx context.Context, req WorldCommandRequest) (int, WorldCommandResponse) {
+	code, resp := s.handleWorldCommand(ctx, req)
+	if isReadOnlyAction(strings.TrimSpace(req.Action)) {
+		var stale bool
+		code, resp, stale = s.readCache.serve(readCacheKey(req), code, resp)
+		if stale {
+			s.logger.Warnf("world_cmd serving stale result action=%s uuid=%s", strings.TrimSpace(req.Action), strings.TrimSpace(req.ActorUUID))
+		}
+	}
+	s.metrics.Inc(metrics.WorldCommands, metrics.Labels{"action": metricsAction(req.Action), "code": strconv.Itoa(code)})
+	return code, resp
+}
+
+func (s *ServiceI) handleWorldCommand(ctx context.Context, req WorldCommandRequest) (int, WorldCommandResponse) {
 	req.Action = strings.TrimSpace(req.Action)
 	req.ActorUUID = strings.TrimSpace(req.ActorUUID)
 	req.ActorName = strings.TrimSpace(req.ActorName)
@@ -165,9 +547,35 @@ func (s *ServiceI) HandleWorldCommand(ctx context.Context, req WorldCommandReque
 	req.TemplateName = strings.TrimSpace(req.TemplateName)
 	req.Reason = strings.TrimSpace(req.Reason)
 	req.AccessMode = strings.TrimSpace(strings.ToLower(req.AccessMode))
+	req.DisplayName = strings.TrimSpace(req.DisplayName)
+	req.Role = strings.TrimSpace(strings.ToLower(req.Role))
+	req.Note = strings.TrimSpace(req.Note)
+	req.StorageType = strings.TrimSpace(strings.ToLower(req.StorageType))
+	req.ServerID = strings.TrimSpace(req.ServerID)
+	req.Seed = strings.TrimSpace(req.Seed)
+	req.Gamemode = strings.TrimSpace(strings.ToLower(req.Gamemode))
+	req.Difficulty = strings.TrimSpace(strings.ToLower(req.Difficulty))
+	req.MOTD = strings.TrimSpace(req.MOTD)
+
+	if s.disabledActions[canonicalAction(req.Action)] {
+		s.logger.Warnf("world_cmd disabled actor=%s uuid=%s action=%s", req.ActorName, req.ActorUUID, req.Action)
+		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "disabled by operator"}
+	}
 
-	if req.Action == "" || req.ActorUUID == "" {
-		return http.StatusBadRequest, WorldCommandResponse{Status: "error", Message: "missing required fields"}
+	fields := validateWorldCommand(req)
+	if isCreateAction(req.Action) {
+		if req.StorageType != "" {
+			fields.oneOf("storage_type", req.StorageType, s.storageTypes...)
+		}
+		if msg := levelSeedProblem(req.Seed); msg != "" {
+			fields["seed"] = msg
+		}
+	}
+	if len(fields) > 0 {
+		return fields.response()
+	}
+	if isCreateAction(req.Action) && !s.VersionsInstalled() {
+		return http.StatusServiceUnavailable, WorldCommandResponse{Status: "error", Message: "no game versions installed"}
 	}
 	if req.RequestID == "" {
 		req.RequestID = newUUIDLike()
@@ -186,26 +594,60 @@ func (s *ServiceI) HandleWorldCommand(ctx context.Context, req WorldCommandReque
 		s.logger.Warnf("world_cmd forbidden actor=%s uuid=%s role=%s action=%s", actor.MCName, actor.MCUUID, actor.ServerRole, req.Action)
 		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "op only"}
 	}
+	if !isCooldownAction(req.Action) {
+		return s.dispatchWorldCommand(ctx, req, actor)
+	}
+	if wait, ok := s.cooldown.allow(req.ActorUUID, req.Action); !ok {
+		s.logger.Warnf("world_cmd throttled actor=%s uuid=%s action=%s retry_in=%s", actor.MCName, actor.MCUUID, req.Action, wait)
+		return http.StatusTooManyRequests, WorldCommandResponse{
+			Status:  "error",
+			Message: fmt.Sprintf("slow down, retry in %ds", int(wait.Seconds()+0.999)),
+		}
+	}
+	code, resp := s.dispatchWorldCommand(ctx, req, actor)
+	switch code {
+	case http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound:
+		// Turned away before any work (bad input, unknown world, no
+		// permission): a corrected retry should not have to wait.
+		s.cooldown.release(req.ActorUUID, req.Action)
+	}
+	return code, resp
+}
 
+// dispatchWorldCommand runs the handler for an already validated and
+// authorized request.
+func (s *ServiceI) dispatchWorldCommand(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
 	switch req.Action {
 	case "create", "request_create":
 		return s.handleRequestCreate(ctx, req, actor)
 	case "request_list":
-		return s.handleRequestList(ctx, actor)
+		return s.handleRequestList(ctx, req, actor)
+	case "request_history":
+		return s.handleRequestHistory(ctx, req, actor)
 	case "request_approve":
 		return s.handleRequestApprove(ctx, req, actor)
 	case "request_reject":
 		return s.handleRequestReject(ctx, req, actor)
+	case "request_resubmit":
+		return s.handleRequestResubmit(ctx, req, actor)
 	case "request_cancel":
 		return s.handleRequestCancel(ctx, req, actor)
 	case "world_list":
-		return s.handleWorldList(ctx, actor)
+		return s.handleWorldList(ctx, req, actor)
+	case "world_mine":
+		return s.handleWorldMine(ctx, req, actor)
 	case "world_info":
 		return s.handleWorldInfo(ctx, req, actor)
+	case "world_timeline":
+		return s.handleWorldTimeline(ctx, req, actor)
 	case "world_join":
 		return s.handleWorldJoin(ctx, req, actor)
 	case "world_set_access":
 		return s.handleWorldSetAccess(ctx, req, actor)
+	case "world_set_name":
+		return s.handleWorldSetName(ctx, req, actor)
+	case "world_rename":
+		return s.handleWorldRename(ctx, req, actor)
 	case "world_on":
 		return s.handleWorldPower(ctx, req, actor, true)
 	case "world_off":
@@ -214,34 +656,82 @@ func (s *ServiceI) HandleWorldCommand(ctx context.Context, req WorldCommandReque
 		return s.handleLobbyJoin(ctx, actor)
 	case "world_remove", "delete":
 		return s.handleDelete(ctx, req, actor)
+	case "world_restore":
+		return s.handleWorldRestore(ctx, req, actor)
+	case "world_logs":
+		return s.handleWorldLogs(ctx, req, actor)
 	case "member_add":
 		return s.handleMemberAdd(ctx, req, actor)
 	case "member_remove":
 		return s.handleMemberRemove(ctx, req, actor)
+	case "member_set_role":
+		return s.handleMemberSetRole(ctx, req, actor)
+	case "world_transfer":
+		return s.handleWorldTransfer(ctx, req, actor)
+	case "world_set_properties":
+		return s.handleWorldSetProperties(ctx, req, actor)
+	case "instance_set_limits":
+		return s.handleInstanceSetLimits(ctx, req, actor)
 	case "player_invite":
 		return s.handleMemberAdd(ctx, req, actor)
 	case "player_reject":
 		return s.handleMemberRemove(ctx, req, actor)
 	case "player_list":
-		return s.handlePlayerList(ctx)
+		return s.handlePlayerList(ctx, req)
+	case "player_set_role":
+		return s.handlePlayerSetRole(ctx, req, actor)
 	case "instance_list":
 		return s.handleInstanceList(ctx, actor)
 	case "instance_create":
-		return s.handleInstanceCreate(ctx, req, actor)
+		return s.handleInstanceCreate(ctx, req, actor, true)
+	case "instance_provision":
+		return s.handleInstanceCreate(ctx, req, actor, false)
 	case "instance_stop":
 		return s.handleInstancePower(ctx, req, actor, false)
 	case "instance_on":
 		return s.handleInstancePower(ctx, req, actor, true)
 	case "instance_off":
 		return s.handleInstancePower(ctx, req, actor, false)
+	case "instance_start_all":
+		return s.handleInstancePowerAll(ctx, actor, true)
+	case "instance_stop_all":
+		return s.handleInstancePowerAll(ctx, actor, false)
 	case "instance_remove":
 		return s.handleInstanceRemove(ctx, req, actor)
+	case "instance_purge":
+		return s.handleInstancePurge(ctx, req, actor)
 	case "instance_lockdown":
 		return s.handleInstanceLockdown(ctx, req, actor)
 	case "instance_unlock":
 		return s.handleInstanceUnlock(ctx, req, actor)
+	case "world_set_version", "instance_set_version":
+		return s.handleWorldSetVersion(ctx, req, actor)
+	case "instance_pin":
+		return s.handleInstancePin(ctx, req, actor, true)
+	case "instance_unpin":
+		return s.handleInstancePin(ctx, req, actor, false)
+	case "world_repair":
+		return s.handleWorldRepair(ctx, req, actor)
+	case "instance_validate":
+		return s.handleInstanceValidate(ctx, req, actor)
+	case "world_rotate_key":
+		return s.handleWorldRotateKey(ctx, req, actor)
+	case "world_note":
+		return s.handleWorldNote(ctx, req, actor)
+	case "version_supported":
+		return s.handleVersionSupported(actor)
+	case "capacity":
+		return s.handleCapacity(ctx)
+	case "world_compose":
+		return s.handleWorldCompose(ctx, req)
+	case "instance_by_server":
+		return s.handleInstanceByServer(ctx, req)
 	case "template_list":
-		return s.handleTemplateList(ctx)
+		return s.handleTemplateList(ctx, req)
+	case "version_list":
+		return s.handleVersionList(ctx)
+	case "selftest_cycle":
+		return s.handleSelfTestCycle(ctx, req, actor)
 	case "create_legacy":
 		return s.handleCreate(ctx, req, actor)
 	default:
@@ -256,26 +746,114 @@ func (s *ServiceI) HandlePlayerJoin(ctx context.Context, actorUUID string, actor
 		return http.StatusBadRequest, WorldCommandResponse{Status: "error", Message: "missing actor_uuid or actor_name"}
 	}
 	s.logger.Infof("player_join actor=%s uuid=%s", actorName, actorUUID)
-	user, err := s.ensureActor(ctx, actorUUID, actorName)
+	user, created, err := s.upsertActor(ctx, actorUUID, actorName)
 	if err != nil {
 		s.logger.Errorf("player_join upsert failed actor=%s uuid=%s err=%v", actorName, actorUUID, err)
 		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "upsert user failed"}
 	}
 	s.logger.Infof("player_join synced actor=%s uuid=%s user_id=%d role=%s", actorName, actorUUID, user.ID, user.ServerRole)
+	if created && s.starterWorld.Enabled && s.VersionsInstalled() {
+		s.provisionStarterWorld(ctx, user)
+	}
 	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("player synced id=%d", user.ID)}
 }
 
-func (s *ServiceI) handleRequestCreate(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
-	if req.WorldAlias == "" {
-		return http.StatusBadRequest, WorldCommandResponse{Status: "error", Message: "world_alias is required"}
+// provisionStarterWorld creates and starts <name>_starter for a user created
+// by this join. It only runs for brand-new users and skips when the user
+// already owns a world, so later joins never provision again. Failures are
+// logged; the join itself still succeeds.
+func (s *ServiceI) provisionStarterWorld(ctx context.Context, user pgsql.User) {
+	opts := s.starterWorld
+	alias := buildOwnedAlias(user.MCName, "starter")
+	if owned, err := s.repos.MapInstance.ListByOwner(ctx, user.ID); err != nil || len(owned) > 0 {
+		return
+	}
+	if _, err := s.repos.MapInstance.ReadByAlias(ctx, alias); err == nil {
+		return
+	}
+	if opts.Quota > 0 {
+		all, err := s.repos.MapInstance.List(ctx)
+		if err != nil {
+			s.logger.Errorf("starter world skipped user_id=%d err=%v", user.ID, err)
+			return
+		}
+		live := 0
+		for _, inst := range all {
+			if inst.Status != string(worker.StatusArchived) {
+				live++
+			}
+		}
+		if live >= opts.Quota {
+			s.logger.Warnf("starter world skipped user_id=%d: %d worlds reach quota %d", user.ID, live, opts.Quota)
+			return
+		}
+	}
+
+	instance := pgsql.MapInstance{
+		Alias:       alias,
+		DisplayName: "starter",
+		OwnerID:     user.ID,
+		SourceType:  "empty",
+		GameVersion: s.defaultGameVersion,
+		StorageType: s.defaultStorageType,
+		AccessMode:  "privacy",
+		Status:      string(worker.StatusWaiting),
+	}
+	var template pgsql.MapTemplate
+	if opts.TemplateTag != "" {
+		t, err := s.resolveTemplate(ctx, opts.TemplateTag)
+		if err != nil {
+			s.logger.Errorf("starter world skipped user_id=%d: template %s not found", user.ID, opts.TemplateTag)
+			return
+		}
+		template = t
+		instance.TemplateID = sql.NullInt64{Int64: template.ID, Valid: true}
+		instance.SourceType = "template"
+		instance.GameVersion = template.GameVersion
+	}
+	instanceID, err := s.repos.MapInstance.Create(ctx, instance)
+	if err != nil {
+		s.logger.Errorf("starter world create failed user_id=%d alias=%s err=%v", user.ID, alias, err)
+		return
 	}
+	_, _ = s.repos.InstanceMember.Create(ctx, pgsql.InstanceMember{InstanceID: instanceID, UserID: user.ID, Role: "owner"})
+	s.logger.Infof("starter world provisioning user_id=%d instance=%d alias=%s template=%s", user.ID, instanceID, alias, displayTemplate(template.Tag))
+
+	go func() {
+		runCtx := context.Background()
+		var runErr error
+		if instance.TemplateID.Valid {
+			runErr = s.worker.StartFromTemplate(runCtx, instanceID, template)
+		} else {
+			runErr = s.worker.StartEmpty(runCtx, instanceID, instance.GameVersion)
+		}
+		if runErr != nil {
+			s.logger.Errorf("starter world start failed instance=%d alias=%s err=%v", instanceID, alias, runErr)
+			s.notifyTargets(runCtx, NotifyTargets{UserIDs: []int64{user.ID}}, fmt.Sprintf("[MCMM] your starter world #%d:%s could not start, ask an op for help", instanceID, alias))
+			return
+		}
+		s.notifyTargets(runCtx, NotifyTargets{UserIDs: []int64{user.ID}}, fmt.Sprintf("[MCMM] your starter world is ready: /mcmm world #%d:%s", instanceID, alias))
+	}()
+}
+
+func (s *ServiceI) handleRequestCreate(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
+	return s.createWorldRequest(ctx, req, actor, 0)
+}
+
+// maxPendingRequests caps how many pending world requests one player may
+// have waiting for review.
+const maxPendingRequests = 3
+
+// createWorldRequest files a pending world_create request. resubmittedFrom
+// links a resubmission to the original request number; zero for new ones.
+func (s *ServiceI) createWorldRequest(ctx context.Context, req WorldCommandRequest, actor pgsql.User, resubmittedFrom int64) (int, WorldCommandResponse) {
 	finalAlias := buildOwnedAlias(actor.MCName, req.WorldAlias)
 	if req.RequestID == "" {
 		req.RequestID = newUUIDLike()
 	}
 
 	if _, err := s.repos.MapInstance.ReadByAlias(ctx, finalAlias); err == nil {
-		return http.StatusConflict, WorldCommandResponse{Status: "error", Message: "world_alias already exists"}
+		return s.aliasTaken(ctx, actor.MCName, req.WorldAlias)
 	}
 
 	var (
@@ -300,7 +878,20 @@ func (s *ServiceI) handleRequestCreate(ctx context.Context, req WorldCommandRequ
 	if !errors.Is(err, sql.ErrNoRows) {
 		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "read request failed"}
 	}
+	if !isAdmin(actor) {
+		pending, err := s.repos.UserRequest.CountPendingByActor(ctx, actor.ID)
+		if err != nil {
+			return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "read request failed"}
+		}
+		if pending >= maxPendingRequests {
+			return http.StatusTooManyRequests, WorldCommandResponse{Status: "error", Message: fmt.Sprintf("too many pending requests (max %d)", maxPendingRequests)}
+		}
+	}
 
+	var expiresAt sql.NullTime
+	if s.requestExpiry > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().Add(s.requestExpiry), Valid: true}
+	}
 	requestNo, err := s.repos.UserRequest.Create(ctx, pgsql.UserRequest{
 		RequestID:      req.RequestID,
 		RequestType:    "world_create",
@@ -308,19 +899,30 @@ func (s *ServiceI) handleRequestCreate(ctx context.Context, req WorldCommandRequ
 		TemplateID:     templateID,
 		RequestedAlias: sql.NullString{String: finalAlias, Valid: true},
 		Status:         "pending",
-		ResponsePayload: json.RawMessage(
-			fmt.Sprintf(`{"template":"%s","world_alias":"%s"}`, req.TemplateName, finalAlias),
-		),
+		ExpiresAt:      expiresAt,
+		ResponsePayload: mustJSON(createRequestPayload{
+			Template:        req.TemplateName,
+			WorldAlias:      finalAlias,
+			DisplayName:     req.WorldAlias,
+			StorageType:     s.storageTypeOrDefault(req.StorageType),
+			LevelSeed:       req.Seed,
+			ResubmittedFrom: resubmittedFrom,
+		}),
 	})
 	if err != nil {
 		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "create request failed"}
 	}
-	_ = s.notifyLobbyAdminsRequestCreated(ctx, actor.MCName, finalAlias, req.TemplateName, requestNo, req.RequestID)
+	s.notifyLobbyAdminsRequestCreated(ctx, actor.MCName, finalAlias, req.TemplateName, requestNo)
 
+	verb := "created"
+	if resubmittedFrom > 0 {
+		verb = fmt.Sprintf("resubmitted from #%d", resubmittedFrom)
+	}
 	return http.StatusOK, WorldCommandResponse{
 		Status:  "accepted",
 		Message: fmt.Sprintf(
-			"request created: #%d world=%s template=%s",
+			"request %s: #%d world=%s template=%s",
+			verb,
 			requestNo,
 			finalAlias,
 			templateLabel,
@@ -328,42 +930,163 @@ func (s *ServiceI) handleRequestCreate(ctx context.Context, req WorldCommandRequ
 	}
 }
 
-func (s *ServiceI) handleRequestList(ctx context.Context, actor pgsql.User) (int, WorldCommandResponse) {
-	const limit = 20
-	var (
-		rows []pgsql.UserRequest
-		err  error
-	)
+// handleRequestResubmit files a fresh pending request from the actor's own
+// rejected, canceled or failed one. world_alias and template_name override
+// the original values when given.
+func (s *ServiceI) handleRequestResubmit(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
+	if req.RequestID == "" {
+		return http.StatusBadRequest, WorldCommandResponse{Status: "error", Message: "request_id_or_no is required"}
+	}
+	ur, err := s.resolveUserRequest(ctx, req.RequestID)
+	if err != nil {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "request not found"}
+	}
+	if ur.ActorUserID != actor.ID {
+		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "permission denied"}
+	}
+	if ur.RequestType != "world_create" {
+		return http.StatusBadRequest, WorldCommandResponse{Status: "error", Message: "request_type is not world_create"}
+	}
+	switch ur.Status {
+	case "rejected", "canceled", "failed", "expired":
+	default:
+		return http.StatusConflict, WorldCommandResponse{Status: "error", Message: fmt.Sprintf("request status is %s", ur.Status)}
+	}
+
+	var payload createRequestPayload
+	_ = json.Unmarshal(ur.ResponsePayload, &payload)
+	next := req
+	next.RequestID = ""
+	if next.WorldAlias == "" {
+		next.WorldAlias = payload.DisplayName
+	}
+	if next.WorldAlias == "" && ur.RequestedAlias.Valid {
+		next.WorldAlias = strings.TrimPrefix(ur.RequestedAlias.String, actor.MCName+"_")
+	}
+	if next.TemplateName == "" && ur.TemplateID.Valid {
+		next.TemplateName = fmt.Sprintf("#%d", ur.TemplateID.Int64)
+	}
+	if next.StorageType == "" {
+		next.StorageType = payload.StorageType
+	}
+	if next.Seed == "" {
+		next.Seed = payload.LevelSeed
+	}
+	return s.createWorldRequest(ctx, next, actor, ur.ID)
+}
+
+const (
+	requestListPageSize    = 20
+	requestListMaxPageSize = 100
+)
+
+// handleRequestList pages through requests newest first. Admins see pending
+// requests unless req.Status asks for another status; everyone else only
+// sees their own requests.
+func (s *ServiceI) handleRequestList(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
+	filter := pgsql.UserRequestFilter{Status: req.Status}
 	if isAdmin(actor) {
-		rows, err = s.repos.UserRequest.ListPending(ctx, limit)
+		if filter.Status == "" {
+			filter.Status = "pending"
+		}
 	} else {
-		rows, err = s.repos.UserRequest.ListByActor(ctx, actor.ID, limit)
+		filter.ActorUserID = actor.ID
+	}
+	page := pgsql.Page{Number: req.Page, Size: req.PageSize}
+	if page.Number <= 0 {
+		page.Number = 1
 	}
+	if page.Size <= 0 {
+		page.Size = requestListPageSize
+	}
+	rows, err := s.repos.UserRequest.ListFiltered(ctx, filter, page)
 	if err != nil {
 		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "list requests failed"}
 	}
+	if len(rows) == 0 && page.Number > 1 {
+		return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("no requests on page %d", page.Number)}
+	}
 	if len(rows) == 0 {
 		return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: "no requests"}
 	}
+	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: strings.Join(s.describeRequests(ctx, rows), ", ")}
+}
+
+// handleRequestHistory is the admin audit view: every request, newest first,
+// optionally narrowed by req.Status, one line each with when it was made.
+func (s *ServiceI) handleRequestHistory(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
+	page := pgsql.Page{Number: req.Page, Size: req.PageSize}
+	if page.Number <= 0 {
+		page.Number = 1
+	}
+	if page.Size <= 0 {
+		page.Size = requestListPageSize
+	}
+	rows, err := s.repos.UserRequest.ListFiltered(ctx, pgsql.UserRequestFilter{Status: req.Status}, page)
+	if err != nil {
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "list requests failed"}
+	}
+	if len(rows) == 0 {
+		return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("no requests on page %d", page.Number)}
+	}
+	status := req.Status
+	if status == "" {
+		status = "all"
+	}
+	lines := s.describeRequests(ctx, rows)
+	for i, r := range rows {
+		lines[i] += " at=" + r.CreatedAt.UTC().Format(time.RFC3339)
+	}
+	header := fmt.Sprintf("request history status=%s page=%d", status, page.Number)
+	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: header + "\n" + strings.Join(lines, "\n")}
+}
+
+// describeRequests renders one line per request for request_list and
+// request_history. Actor names are resolved in a single batch and each
+// template is read once.
+func (s *ServiceI) describeRequests(ctx context.Context, rows []pgsql.UserRequest) []string {
+	actorIDs := make([]int64, 0, len(rows))
+	for _, r := range rows {
+		actorIDs = append(actorIDs, r.ActorUserID)
+	}
+	actors, err := s.repos.User.ReadByIDs(ctx, actorIDs)
+	if err != nil {
+		s.logger.Warnf("request_list resolve actors failed: %v", err)
+	}
+	templates := map[int64]string{}
 	out := make([]string, 0, len(rows))
 	for _, r := range rows {
 		actorName := fmt.Sprintf("uid:%d", r.ActorUserID)
-		if u, uErr := s.repos.User.Read(ctx, r.ActorUserID); uErr == nil {
+		if u, ok := actors[r.ActorUserID]; ok {
 			actorName = u.MCName
 		}
 		worldAlias := "-"
 		if r.RequestedAlias.Valid {
 			worldAlias = r.RequestedAlias.String
 		}
+		if r.RequestType != "" && r.RequestType != "world_create" {
+			line := fmt.Sprintf("#%d:%s type=%s player=%s world=%s", r.ID, r.Status, r.RequestType, actorName, worldAlias)
+			if r.ErrorCode.Valid {
+				line += " error=" + r.ErrorCode.String
+			}
+			out = append(out, line)
+			continue
+		}
 		templateName := "empty"
 		if r.TemplateID.Valid {
-			if t, tErr := s.repos.MapTemplate.Read(ctx, r.TemplateID.Int64); tErr == nil {
-				templateName = fmt.Sprintf("#%d:%s", t.ID, t.Tag)
+			name, ok := templates[r.TemplateID.Int64]
+			if !ok {
+				name = "empty"
+				if t, tErr := s.repos.MapTemplate.Read(ctx, r.TemplateID.Int64); tErr == nil {
+					name = fmt.Sprintf("#%d:%s", t.ID, t.Tag)
+				}
+				templates[r.TemplateID.Int64] = name
 			}
+			templateName = name
 		}
 		out = append(out, fmt.Sprintf("#%d:%s player=%s world=%s template=%s", r.ID, r.Status, actorName, worldAlias, templateName))
 	}
-	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: strings.Join(out, ", ")}
+	return out
 }
 
 func (s *ServiceI) handleRequestApprove(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
@@ -409,12 +1132,17 @@ func (s *ServiceI) handleRequestApprove(ctx context.Context, req WorldCommandReq
 func (s *ServiceI) processApproveAsync(ur pgsql.UserRequest) {
 	ctx := context.Background()
 
+	var payload createRequestPayload
+	_ = json.Unmarshal(ur.ResponsePayload, &payload)
 	instance := pgsql.MapInstance{
 		Alias:       ur.RequestedAlias.String,
+		DisplayName: payload.DisplayName,
 		OwnerID:     ur.ActorUserID,
 		TemplateID:  ur.TemplateID,
 		SourceType:  "empty",
 		GameVersion: s.defaultGameVersion,
+		StorageType: s.storageTypeOrDefault(payload.StorageType),
+		LevelSeed:   payload.LevelSeed,
 		AccessMode:  "privacy",
 		Status:      string(worker.StatusWaiting),
 	}
@@ -448,13 +1176,13 @@ func (s *ServiceI) processApproveAsync(ur pgsql.UserRequest) {
 
 	if ur.TemplateID.Valid {
 		if err := s.worker.StartFromTemplate(ctx, instanceID, template); err != nil {
-			_ = s.repos.UserRequest.MarkRequestResult(ctx, ur.RequestID, "failed", json.RawMessage(`{"step":"start_template"}`), sql.NullString{String: "worker_error", Valid: true}, sql.NullString{String: err.Error(), Valid: true})
+			_ = s.repos.UserRequest.MarkRequestResult(ctx, ur.RequestID, "failed", json.RawMessage(`{"step":"start_template"}`), workerErrorCode(err), sql.NullString{String: err.Error(), Valid: true})
 			s.notifyApproveResult(ctx, ur, false, instanceID, "start template failed", instance.Alias, displayTemplate(template.Tag))
 			return
 		}
 	} else {
 		if err := s.worker.StartEmpty(ctx, instanceID, instance.GameVersion); err != nil {
-			_ = s.repos.UserRequest.MarkRequestResult(ctx, ur.RequestID, "failed", json.RawMessage(`{"step":"start_empty"}`), sql.NullString{String: "worker_error", Valid: true}, sql.NullString{String: err.Error(), Valid: true})
+			_ = s.repos.UserRequest.MarkRequestResult(ctx, ur.RequestID, "failed", json.RawMessage(`{"step":"start_empty"}`), workerErrorCode(err), sql.NullString{String: err.Error(), Valid: true})
 			s.notifyApproveResult(ctx, ur, false, instanceID, "start empty failed", instance.Alias, "empty")
 			return
 		}
@@ -512,12 +1240,36 @@ func (s *ServiceI) handleRequestCancel(ctx context.Context, req WorldCommandRequ
 	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: "request canceled"}
 }
 
-func (s *ServiceI) handleTemplateList(ctx context.Context) (int, WorldCommandResponse) {
-	templates, err := s.repos.MapTemplate.List(ctx)
+// handleTemplateList lists templates, optionally narrowed to one game_version
+// and/or a tag or display name substring (query). Unfiltered output keeps
+// the plain "templates: ..." form the plugin's tab completion parses.
+func (s *ServiceI) handleTemplateList(ctx context.Context, req WorldCommandRequest) (int, WorldCommandResponse) {
+	var (
+		templates []pgsql.MapTemplate
+		err       error
+	)
+	switch {
+	case req.Query != "":
+		templates, err = s.repos.MapTemplate.SearchByTag(ctx, req.Query, req.GameVersion)
+	case req.GameVersion != "":
+		templates, err = s.repos.MapTemplate.ListByGameVersion(ctx, req.GameVersion)
+	default:
+		templates, err = s.repos.MapTemplate.List(ctx)
+	}
 	if err != nil {
 		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "list templates failed"}
 	}
+	filters := make([]string, 0, 2)
+	if req.GameVersion != "" {
+		filters = append(filters, "game_version="+req.GameVersion)
+	}
+	if req.Query != "" {
+		filters = append(filters, "query="+req.Query)
+	}
 	if len(templates) == 0 {
+		if len(filters) > 0 {
+			return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: "no templates match " + strings.Join(filters, " ")}
+		}
 		return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: "no templates found"}
 	}
 	limit := len(templates)
@@ -530,6 +1282,9 @@ func (s *ServiceI) handleTemplateList(ctx context.Context) (int, WorldCommandRes
 		lines = append(lines, fmt.Sprintf("#%d:%s (%s)", t.ID, t.Tag, t.GameVersion))
 	}
 	msg := "templates: " + strings.Join(lines, ", ")
+	if len(filters) > 0 {
+		msg = fmt.Sprintf("templates matching %s (%d): %s", strings.Join(filters, " "), len(templates), strings.Join(lines, ", "))
+	}
 	if len(templates) > limit {
 		msg += fmt.Sprintf(" ... and %d more", len(templates)-limit)
 	}
@@ -537,6 +1292,13 @@ func (s *ServiceI) handleTemplateList(ctx context.Context) (int, WorldCommandRes
 }
 
 func (s *ServiceI) handleCreate(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
+	version := req.GameVersion
+	if version == "" {
+		version = s.defaultGameVersion
+	}
+	if status, resp, ok := s.checkGameVersion(ctx, version); !ok {
+		return status, resp
+	}
 	createdReq, created, err := s.repos.UserRequest.CreateAcceptedIfNotExists(
 		ctx,
 		req.RequestID,
@@ -551,15 +1313,14 @@ func (s *ServiceI) handleCreate(ctx context.Context, req WorldCommandRequest, ac
 		return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: "duplicate request_id, using existing request"}
 	}
 
-	version := req.GameVersion
-	if version == "" {
-		version = s.defaultGameVersion
-	}
 	instanceID, err := s.repos.MapInstance.Create(ctx, pgsql.MapInstance{
 		Alias:       req.WorldAlias,
+		DisplayName: req.WorldAlias,
 		OwnerID:     actor.ID,
 		SourceType:  "empty",
 		GameVersion: version,
+		StorageType: s.storageTypeOrDefault(req.StorageType),
+		LevelSeed:   req.Seed,
 		AccessMode:  "privacy",
 		Status:      string(worker.StatusWaiting),
 	})
@@ -578,34 +1339,98 @@ func (s *ServiceI) handleCreate(ctx context.Context, req WorldCommandRequest, ac
 	_ = s.repos.UserRequest.Update(ctx, createdReq)
 
 	if err := s.worker.StartEmpty(ctx, instanceID, version); err != nil {
-		_ = s.repos.UserRequest.MarkRequestResult(ctx, req.RequestID, "failed", json.RawMessage(`{"step":"start_empty"}`), sql.NullString{String: "worker_error", Valid: true}, sql.NullString{String: err.Error(), Valid: true})
-		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "worker start failed"}
+		_ = s.repos.UserRequest.MarkRequestResult(ctx, req.RequestID, "failed", json.RawMessage(`{"step":"start_empty"}`), workerErrorCode(err), sql.NullString{String: err.Error(), Valid: true})
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "worker start failed", Code: workerCode(err)}
 	}
 	payload := fmt.Sprintf(`{"instance_id":%d,"game_version":"%s"}`, instanceID, version)
 	_ = s.repos.UserRequest.MarkRequestResult(ctx, req.RequestID, "succeeded", json.RawMessage(payload), sql.NullString{}, sql.NullString{})
 	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("create accepted, instance_id=%d", instanceID)}
 }
 
-func (s *ServiceI) handleDelete(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
-	inst, err := s.resolveInstance(ctx, req.WorldAlias)
-	if err != nil {
-		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
-	}
-	instanceID := inst.ID
-	if !canManage(actor, inst.OwnerID) {
-		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "permission denied"}
-	}
+// workerCode is the worker.ErrorCode of a worker failure, for
+// WorldCommandResponse.Code.
+func workerCode(err error) string {
+	return string(worker.ClassifyErr(err))
+}
 
-	ur, _, err := s.repos.UserRequest.CreateAcceptedIfNotExists(
+// workerErrorCode is workerCode as a user_requests.error_code value.
+func workerErrorCode(err error) sql.NullString {
+	return sql.NullString{String: workerCode(err), Valid: true}
+}
+
+// trackAsyncRequest records a background worker op as a processing
+// user_request under req.RequestID (type = the action), so request_list shows
+// how it ended. The returned func stores the final status and error code;
+// recording problems are only logged and never block the op. When the
+// request_id was already recorded, the op must not run again: the existing
+// row comes back instead of a func.
+func (s *ServiceI) trackAsyncRequest(ctx context.Context, req WorldCommandRequest, actor pgsql.User, inst pgsql.MapInstance) (func(context.Context, error), *pgsql.UserRequest) {
+	if s.repos.UserRequest == nil {
+		return func(context.Context, error) {}, nil
+	}
+	ur, created, err := s.repos.UserRequest.CreateAcceptedIfNotExists(
 		ctx,
 		req.RequestID,
-		"delete_instance",
+		req.Action,
 		sql.NullInt64{Int64: actor.ID, Valid: true},
-		sql.NullInt64{Int64: instanceID, Valid: true},
+		sql.NullInt64{Int64: inst.ID, Valid: true},
+	)
+	if err != nil {
+		s.logger.Warnf("record %s request failed instance=%d err=%v", req.Action, inst.ID, err)
+		return func(context.Context, error) {}, nil
+	}
+	if !created {
+		return nil, &ur
+	}
+	ur.Status = "processing"
+	ur.RequestedAlias = sql.NullString{String: inst.Alias, Valid: true}
+	_ = s.repos.UserRequest.Update(ctx, ur)
+
+	requestID := req.RequestID
+	payload := json.RawMessage(fmt.Sprintf(`{"instance_id":%d}`, inst.ID))
+	return func(ctx context.Context, runErr error) {
+		if runErr != nil {
+			_ = s.repos.UserRequest.MarkRequestResult(ctx, requestID, "failed", payload, workerErrorCode(runErr), sql.NullString{String: runErr.Error(), Valid: true})
+			return
+		}
+		_ = s.repos.UserRequest.MarkRequestResult(ctx, requestID, "succeeded", payload, sql.NullString{}, sql.NullString{})
+	}, nil
+}
+
+// duplicateRequest answers a retried request_id with what the first attempt
+// recorded, instead of running the op again.
+func duplicateRequest(ur pgsql.UserRequest) (int, WorldCommandResponse) {
+	msg := fmt.Sprintf("duplicate request_id, request #%d is %s", ur.ID, ur.Status)
+	if ur.ErrorCode.String != "" {
+		msg += " error=" + ur.ErrorCode.String
+	}
+	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: msg, Code: ur.ErrorCode.String}
+}
+
+func (s *ServiceI) handleDelete(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
+	inst, err := s.resolveInstance(ctx, req.WorldAlias)
+	if err != nil {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
+	}
+	instanceID := inst.ID
+	// Archiving is the owner's call; managers only run the world.
+	if !isOwnerOrAdmin(actor, inst.OwnerID) {
+		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "permission denied"}
+	}
+
+	ur, created, err := s.repos.UserRequest.CreateAcceptedIfNotExists(
+		ctx,
+		req.RequestID,
+		"delete_instance",
+		sql.NullInt64{Int64: actor.ID, Valid: true},
+		sql.NullInt64{Int64: instanceID, Valid: true},
 	)
 	if err != nil {
 		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "delete request failed"}
 	}
+	if !created {
+		return duplicateRequest(ur)
+	}
 	ur.Status = "processing"
 	_ = s.repos.UserRequest.Update(ctx, ur)
 
@@ -613,7 +1438,7 @@ func (s *ServiceI) handleDelete(ctx context.Context, req WorldCommandRequest, ac
 		runCtx := context.Background()
 		if err := s.worker.StopAndArchive(runCtx, id); err != nil {
 			s.logger.Errorf("world remove failed instance=%d alias=%s err=%v", id, alias, err)
-			_ = s.repos.UserRequest.MarkRequestResult(runCtx, requestID, "failed", json.RawMessage(`{"step":"stop_archive"}`), sql.NullString{String: "worker_error", Valid: true}, sql.NullString{String: err.Error(), Valid: true})
+			_ = s.repos.UserRequest.MarkRequestResult(runCtx, requestID, "failed", json.RawMessage(`{"step":"stop_archive"}`), workerErrorCode(err), sql.NullString{String: err.Error(), Valid: true})
 			return
 		}
 		_ = s.repos.UserRequest.MarkRequestResult(runCtx, requestID, "succeeded", json.RawMessage(fmt.Sprintf(`{"instance_id":%d}`, id)), sql.NullString{}, sql.NullString{})
@@ -625,13 +1450,58 @@ func (s *ServiceI) handleDelete(ctx context.Context, req WorldCommandRequest, ac
 	}
 }
 
+func (s *ServiceI) handleWorldRestore(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
+	inst, err := s.resolveInstance(ctx, req.WorldAlias)
+	if err != nil {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
+	}
+	if !isOwnerOrAdmin(actor, inst.OwnerID) {
+		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "permission denied"}
+	}
+	if worker.Status(inst.Status) != worker.StatusArchived {
+		return http.StatusConflict, WorldCommandResponse{Status: "error", Message: fmt.Sprintf("world is not archived (status=%s)", inst.Status)}
+	}
+	if err := s.worker.RestoreArchived(ctx, inst.ID); err != nil {
+		s.logger.Errorf("world restore failed instance=%d alias=%s err=%v", inst.ID, inst.Alias, err)
+		if errors.Is(err, worker.ErrArchiveMissing) {
+			return http.StatusGone, WorldCommandResponse{Status: "error", Message: "archive already purged, cannot restore"}
+		}
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "world restore failed", Code: workerCode(err)}
+	}
+	return http.StatusOK, WorldCommandResponse{
+		Status:  "accepted",
+		Message: fmt.Sprintf("world restored: #%d:%s (off, use world on to start)", inst.ID, inst.Alias),
+	}
+}
+
+// handleWorldLogs shows what docker compose printed on the last start (or
+// failed stop), so owners can see why a world did not come up.
+func (s *ServiceI) handleWorldLogs(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
+	inst, err := s.resolveInstance(ctx, req.WorldAlias)
+	if err != nil {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
+	}
+	if !s.canManage(ctx, actor, inst) {
+		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "permission denied"}
+	}
+	if !inst.LastComposeOutput.Valid || inst.LastComposeOutput.String == "" {
+		return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("#%d:%s no compose output recorded", inst.ID, inst.Alias)}
+	}
+	msg := fmt.Sprintf("#%d:%s status=%s health=%s", inst.ID, inst.Alias, inst.Status, inst.HealthStatus)
+	if inst.LastErrorMsg.Valid && inst.LastErrorMsg.String != "" {
+		msg += " error=" + inst.LastErrorMsg.String
+	}
+	msg += "\n" + inst.LastComposeOutput.String
+	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: msg}
+}
+
 func (s *ServiceI) handleMemberAdd(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
 	inst, err := s.resolveInstance(ctx, req.WorldAlias)
 	if err != nil {
 		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
 	}
 	instanceID := inst.ID
-	if !canManage(actor, inst.OwnerID) {
+	if !s.canManage(ctx, actor, inst) {
 		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "permission denied"}
 	}
 	target, err := s.repos.User.ReadByName(ctx, req.Target)
@@ -659,13 +1529,22 @@ func (s *ServiceI) handleMemberRemove(ctx context.Context, req WorldCommandReque
 		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
 	}
 	instanceID := inst.ID
-	if !canManage(actor, inst.OwnerID) {
+	if !s.canManage(ctx, actor, inst) {
 		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "permission denied"}
 	}
 	target, err := s.repos.User.ReadByName(ctx, req.Target)
 	if err != nil {
 		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "target user not found"}
 	}
+	if !isOwnerOrAdmin(actor, inst.OwnerID) {
+		protected, err := s.isOwnerOrManager(ctx, inst, target.ID)
+		if err != nil {
+			return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "load members failed"}
+		}
+		if protected {
+			return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "managers can only remove members"}
+		}
+	}
 	if err := s.repos.InstanceMember.DeleteByInstanceAndUser(ctx, instanceID, target.ID); err != nil {
 		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "remove member failed"}
 	}
@@ -673,7 +1552,131 @@ func (s *ServiceI) handleMemberRemove(ctx context.Context, req WorldCommandReque
 	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: "member removed"}
 }
 
-func (s *ServiceI) handleWorldList(ctx context.Context, actor pgsql.User) (int, WorldCommandResponse) {
+const (
+	memberRoleOwner   = "owner"
+	memberRoleManager = "manager"
+	memberRoleMember  = "member"
+)
+
+// handleMemberSetRole lets the owner (or an admin) switch a member between
+// member and manager. Managers pass canManage but cannot change roles.
+func (s *ServiceI) handleMemberSetRole(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
+	role := req.Role
+	inst, err := s.resolveInstance(ctx, req.WorldAlias)
+	if err != nil {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
+	}
+	if !isOwnerOrAdmin(actor, inst.OwnerID) {
+		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "permission denied"}
+	}
+	target, err := s.repos.User.ReadByName(ctx, req.Target)
+	if err != nil {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "target user not found"}
+	}
+	members, err := s.repos.InstanceMember.ListByInstance(ctx, inst.ID)
+	if err != nil {
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "load members failed"}
+	}
+	var (
+		row    pgsql.InstanceMember
+		found  bool
+		owners int
+	)
+	for _, m := range members {
+		if strings.EqualFold(m.Role, memberRoleOwner) {
+			owners++
+		}
+		if m.UserID == target.ID {
+			row, found = m, true
+		}
+	}
+	if target.ID == inst.OwnerID || (found && strings.EqualFold(row.Role, memberRoleOwner) && owners <= 1) {
+		return http.StatusConflict, WorldCommandResponse{Status: "error", Message: "cannot change the role of the sole owner"}
+	}
+	if !found {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "target is not a member"}
+	}
+	if strings.EqualFold(row.Role, role) {
+		return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("%s is already %s", target.MCName, role)}
+	}
+	row.Role = role
+	if err := s.repos.InstanceMember.Update(ctx, row); err != nil {
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "update member role failed"}
+	}
+	s.logger.Infof("member role updated instance=%d target=%s role=%s by=%s", inst.ID, target.MCName, role, actor.MCName)
+	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("%s is now %s", target.MCName, role)}
+}
+
+// handleWorldTransfer hands the instance to target: OwnerID moves, target's
+// member row becomes owner (created if missing) and the previous owner stays
+// on as a plain member. The three writes share one transaction. A running
+// instance takes the previous owner's op away now; otherwise the access sync
+// on the next start does.
+func (s *ServiceI) handleWorldTransfer(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
+	inst, err := s.resolveInstance(ctx, req.WorldAlias)
+	if err != nil {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
+	}
+	if !isOwnerOrAdmin(actor, inst.OwnerID) {
+		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "permission denied"}
+	}
+	target, err := s.repos.User.ReadByName(ctx, req.Target)
+	if err != nil {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "target user not found (must join once)"}
+	}
+	if target.ID == inst.OwnerID {
+		return http.StatusConflict, WorldCommandResponse{Status: "error", Message: fmt.Sprintf("%s already owns #%d:%s", target.MCName, inst.ID, inst.Alias)}
+	}
+	members, err := s.repos.InstanceMember.ListByInstance(ctx, inst.ID)
+	if err != nil {
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "load members failed"}
+	}
+	prevOwner := inst.OwnerID
+	inst.OwnerID = target.ID
+	err = s.inTx(ctx, func(repos pgsql.Repos) error {
+		if err := setMemberRole(ctx, repos.InstanceMember, members, inst.ID, target.ID, memberRoleOwner); err != nil {
+			return fmt.Errorf("owner row: %w", err)
+		}
+		if err := setMemberRole(ctx, repos.InstanceMember, members, inst.ID, prevOwner, memberRoleMember); err != nil {
+			return fmt.Errorf("demote previous owner: %w", err)
+		}
+		return repos.MapInstance.Update(ctx, inst)
+	})
+	if err != nil {
+		s.logger.Errorf("world_transfer failed instance=%d target=%s err=%v", inst.ID, target.MCName, err)
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "transfer failed"}
+	}
+	_ = s.updateInstanceWhitelist(ctx, inst.ID, target.MCName, true)
+	if prev, err := s.repos.User.Read(ctx, prevOwner); err == nil {
+		_ = s.deopOnInstance(ctx, inst, prev.MCName)
+	} else {
+		s.logger.Warnf("world_transfer load previous owner instance=%d user_id=%d err=%v", inst.ID, prevOwner, err)
+	}
+	s.logger.Infof("world_transfer instance=%d alias=%s owner %d -> %d by=%s", inst.ID, inst.Alias, prevOwner, target.ID, actor.MCName)
+	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("#%d:%s now owned by %s", inst.ID, inst.Alias, target.MCName)}
+}
+
+// setMemberRole gives userID the role on the instance, updating their row
+// in members or creating one.
+func setMemberRole(ctx context.Context, repo pgsql.InstanceMemberRepo, members []pgsql.InstanceMember, instanceID int64, userID int64, role string) error {
+	for _, m := range members {
+		if m.UserID != userID {
+			continue
+		}
+		if strings.EqualFold(m.Role, role) {
+			return nil
+		}
+		m.Role = role
+		return repo.Update(ctx, m)
+	}
+	_, err := repo.Create(ctx, pgsql.InstanceMember{InstanceID: instanceID, UserID: userID, Role: role})
+	return err
+}
+
+// handleWorldList lists the worlds the actor can join. Archived worlds are
+// left out unless include_archived is set, in which case owners (and admins)
+// also see their archived worlds so they know a restore is possible.
+func (s *ServiceI) handleWorldList(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
 	all, err := s.repos.MapInstance.List(ctx)
 	if err != nil {
 		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "list worlds failed"}
@@ -694,12 +1697,18 @@ func (s *ServiceI) handleWorldList(ctx context.Context, actor pgsql.User) (int,
 	type worldView struct {
 		id     int64
 		alias  string
+		name   string
 		status string
 		role   string
 	}
 	picked := make(map[int64]worldView)
 	for _, inst := range all {
-		if inst.Status != string(worker.StatusOn) && inst.Status != string(worker.StatusOff) {
+		archived := inst.Status == string(worker.StatusArchived)
+		if archived {
+			if !req.IncludeArchived || (!isAdmin(actor) && inst.OwnerID != actor.ID) {
+				continue
+			}
+		} else if inst.Status != string(worker.StatusOn) && inst.Status != string(worker.StatusOff) {
 			continue
 		}
 		role := ""
@@ -708,6 +1717,8 @@ func (s *ServiceI) handleWorldList(ctx context.Context, actor pgsql.User) (int,
 			role = "admin"
 		case inst.OwnerID == actor.ID:
 			role = "owner"
+		case memberSet[inst.ID] == memberRoleManager:
+			role = memberRoleManager
 		case memberSet[inst.ID] != "":
 			role = "member"
 		case strings.EqualFold(inst.AccessMode, "public") && inst.Status == string(worker.StatusOn):
@@ -719,6 +1730,7 @@ func (s *ServiceI) handleWorldList(ctx context.Context, actor pgsql.User) (int,
 		picked[inst.ID] = worldView{
 			id:     inst.ID,
 			alias:  inst.Alias,
+			name:   displayName(inst),
 			status: inst.Status,
 			role:   role,
 		}
@@ -735,20 +1747,51 @@ func (s *ServiceI) handleWorldList(ctx context.Context, actor pgsql.User) (int,
 
 	items := make([]string, 0, len(rows))
 	for _, r := range rows {
-		items = append(items, fmt.Sprintf("#%d:%s:%s(%s)", r.id, r.alias, r.status, r.role))
+		item := fmt.Sprintf("#%d:%s:%s(%s)", r.id, r.alias, r.status, r.role)
+		if r.name != r.alias {
+			item += " name=" + r.name
+		}
+		items = append(items, item)
 	}
 	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: strings.Join(items, ", ")}
 }
 
-func (s *ServiceI) handleWorldSetAccess(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
-	if req.AccessMode != "public" && req.AccessMode != "privacy" {
-		return http.StatusBadRequest, WorldCommandResponse{Status: "error", Message: "access_mode must be public or privacy"}
+// handleWorldMine lists only the worlds the actor owns or is a member of,
+// with access mode and member count (owner excluded). Archived worlds are
+// left out unless include_archived is set.
+func (s *ServiceI) handleWorldMine(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
+	rows, err := s.repos.MapInstance.ListForUser(ctx, actor.ID, req.IncludeArchived)
+	if err != nil {
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "list worlds failed"}
+	}
+	if len(rows) == 0 {
+		return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: "no worlds"}
+	}
+
+	items := make([]string, 0, len(rows))
+	for _, r := range rows {
+		role := strings.ToLower(strings.TrimSpace(r.Role))
+		switch {
+		case r.OwnerID == actor.ID || strings.EqualFold(role, memberRoleOwner):
+			role = memberRoleOwner
+		case role == "":
+			role = "member"
+		}
+		item := fmt.Sprintf("#%d:%s:%s(%s) access=%s members=%d", r.ID, r.Alias, r.Status, role, r.AccessMode, r.MemberCount)
+		if name := displayName(r.MapInstance); name != r.Alias {
+			item += " name=" + name
+		}
+		items = append(items, item)
 	}
+	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: strings.Join(items, ", ")}
+}
+
+func (s *ServiceI) handleWorldSetAccess(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
 	inst, err := s.resolveInstance(ctx, req.WorldAlias)
 	if err != nil {
 		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
 	}
-	if !canManage(actor, inst.OwnerID) {
+	if !s.canManage(ctx, actor, inst) {
 		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "permission denied"}
 	}
 	inst.AccessMode = req.AccessMode
@@ -758,14 +1801,159 @@ func (s *ServiceI) handleWorldSetAccess(ctx context.Context, req WorldCommandReq
 	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: "access mode updated"}
 }
 
+func (s *ServiceI) handleWorldSetName(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
+	inst, err := s.resolveInstance(ctx, req.WorldAlias)
+	if err != nil {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
+	}
+	if !s.canManage(ctx, actor, inst) {
+		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "permission denied"}
+	}
+	inst.DisplayName = req.DisplayName
+	if err := s.repos.MapInstance.Update(ctx, inst); err != nil {
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "update display name failed"}
+	}
+	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("world renamed: #%d:%s", inst.ID, inst.DisplayName)}
+}
+
+// handleWorldSetProperties stores the server.properties settings the
+// request sets; fields left empty keep their current value. The worker
+// writes them into server.properties on the next start.
+func (s *ServiceI) handleWorldSetProperties(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
+	inst, err := s.resolveInstance(ctx, req.WorldAlias)
+	if errors.Is(err, sql.ErrNoRows) {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
+	}
+	if err != nil {
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "load instance failed"}
+	}
+	if !isOwnerOrAdmin(actor, inst.OwnerID) {
+		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "permission denied"}
+	}
+	if req.Gamemode != "" {
+		inst.Gamemode = req.Gamemode
+	}
+	if req.Difficulty != "" {
+		inst.Difficulty = req.Difficulty
+	}
+	if req.MaxPlayers > 0 {
+		inst.MaxPlayers = req.MaxPlayers
+	}
+	if req.MOTD != "" {
+		inst.MOTD = req.MOTD
+	}
+	if err := s.repos.MapInstance.Update(ctx, inst); err != nil {
+		s.logger.Errorf("world_set_properties update failed instance=%d err=%v", inst.ID, err)
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "update properties failed"}
+	}
+	s.logger.Infof("world_set_properties instance=%d gamemode=%s difficulty=%s max_players=%d by=%s", inst.ID, inst.Gamemode, inst.Difficulty, inst.MaxPlayers, actor.MCName)
+	parts := []string{fmt.Sprintf("world properties saved: #%d:%s", inst.ID, inst.Alias)}
+	if inst.Gamemode != "" {
+		parts = append(parts, "gamemode="+inst.Gamemode)
+	}
+	if inst.Difficulty != "" {
+		parts = append(parts, "difficulty="+inst.Difficulty)
+	}
+	if inst.MaxPlayers > 0 {
+		parts = append(parts, fmt.Sprintf("max_players=%d", inst.MaxPlayers))
+	}
+	if inst.MOTD != "" {
+		parts = append(parts, fmt.Sprintf("motd=%q", inst.MOTD))
+	}
+	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: strings.Join(parts, " ") + ", applied on next start"}
+}
+
+// handleInstanceSetLimits stores per-instance container limits for OPs. The
+// compose file is rendered on every start, so they take effect then; zero
+// falls back to instance_cpu_limit / instance_mem_limit_mb.
+func (s *ServiceI) handleInstanceSetLimits(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
+	inst, err := s.resolveInstance(ctx, req.WorldAlias)
+	if errors.Is(err, sql.ErrNoRows) {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
+	}
+	if err != nil {
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "load instance failed"}
+	}
+	if req.CPULimit != nil {
+		inst.CPULimit = *req.CPULimit
+	}
+	if req.MemLimitMB != nil {
+		inst.MemLimitMB = *req.MemLimitMB
+	}
+	if err := s.repos.MapInstance.Update(ctx, inst); err != nil {
+		s.logger.Errorf("instance_set_limits update failed instance=%d err=%v", inst.ID, err)
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "update limits failed"}
+	}
+	s.logger.Infof("instance_set_limits instance=%d cpu_limit=%g mem_limit_mb=%d by=%s", inst.ID, inst.CPULimit, inst.MemLimitMB, actor.MCName)
+	cpu, mem := "default", "default"
+	if inst.CPULimit > 0 {
+		cpu = strconv.FormatFloat(inst.CPULimit, 'f', -1, 64)
+	}
+	if inst.MemLimitMB > 0 {
+		mem = strconv.Itoa(inst.MemLimitMB)
+	}
+	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("instance limits saved: #%d:%s cpu_limit=%s mem_limit_mb=%s, applied on next start", inst.ID, inst.Alias, cpu, mem)}
+}
+
+// handleWorldRename changes an instance's alias, keeping the owner-name
+// prefix every alias gets at creation. Proxy server-ids are derived from the
+// instance id and do not change; a running world gets its Multiverse alias
+// refreshed in the background after the rename is saved.
+func (s *ServiceI) handleWorldRename(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
+	inst, err := s.resolveInstance(ctx, req.WorldAlias)
+	if errors.Is(err, sql.ErrNoRows) {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
+	}
+	if err != nil {
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "load instance failed"}
+	}
+	if !isOwnerOrAdmin(actor, inst.OwnerID) {
+		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "permission denied"}
+	}
+	owner, err := s.repos.User.Read(ctx, inst.OwnerID)
+	if err != nil {
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "load owner failed"}
+	}
+	newAlias := buildOwnedAlias(owner.MCName, req.NewAlias)
+	if newAlias == inst.Alias {
+		return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("alias unchanged: #%d:%s", inst.ID, inst.Alias)}
+	}
+	if _, err := s.repos.MapInstance.ReadByAlias(ctx, newAlias); err == nil {
+		return s.aliasTaken(ctx, owner.MCName, req.NewAlias)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "check alias failed"}
+	}
+	oldAlias := inst.Alias
+	inst.Alias = newAlias
+	if err := s.repos.MapInstance.Update(ctx, inst); pgsql.IsUniqueViolation(err) {
+		return s.aliasTaken(ctx, owner.MCName, req.NewAlias)
+	} else if err != nil {
+		s.logger.Errorf("world_rename update failed instance=%d alias=%s new_alias=%s err=%v", inst.ID, oldAlias, newAlias, err)
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "update alias failed"}
+	}
+	s.logger.Infof("world_rename instance=%d alias=%s -> %s by=%s", inst.ID, oldAlias, newAlias, actor.MCName)
+	if inst.Status == string(worker.StatusOn) {
+		go func(id int64) {
+			if err := s.worker.RefreshMultiverseAlias(context.Background(), id); err != nil {
+				s.logger.Warnf("world_rename refresh running instance=%d failed, in-game alias refreshes on next start: %v", id, err)
+			}
+		}(inst.ID)
+	}
+	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("world alias changed: #%d:%s -> %s", inst.ID, oldAlias, newAlias)}
+}
+
 func (s *ServiceI) handleWorldPower(ctx context.Context, req WorldCommandRequest, actor pgsql.User, on bool) (int, WorldCommandResponse) {
 	inst, err := s.resolveInstance(ctx, req.WorldAlias)
 	if err != nil {
 		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
 	}
-	if !canManage(actor, inst.OwnerID) {
+	if !s.canManage(ctx, actor, inst) {
 		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "permission denied"}
 	}
+	finish, dup := s.trackAsyncRequest(ctx, req, actor, inst)
+	if dup != nil {
+		return duplicateRequest(*dup)
+	}
 	go func(id int64, alias string, ownerID int64, actorID int64) {
 		runCtx := context.Background()
 		var runErr error
@@ -774,6 +1962,7 @@ func (s *ServiceI) handleWorldPower(ctx context.Context, req WorldCommandRequest
 		} else {
 			runErr = s.worker.StopOnly(runCtx, id)
 		}
+		finish(runCtx, runErr)
 		if runErr != nil {
 			s.logger.Errorf("world power failed instance=%d alias=%s on=%v err=%v", id, alias, on, runErr)
 			s.notifyInstancePowerResult(runCtx, id, alias, ownerID, actorID, "world", on, false, runErr.Error())
@@ -789,93 +1978,264 @@ func (s *ServiceI) handleWorldPower(ctx context.Context, req WorldCommandRequest
 
 func (s *ServiceI) handleWorldInfo(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
 	inst, err := s.resolveInstance(ctx, req.WorldAlias)
-	if err != nil {
+	if errors.Is(err, sql.ErrNoRows) {
 		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
 	}
-	members, err := s.repos.InstanceMember.ListByInstance(ctx, inst.ID)
+	if err != nil {
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "load instance failed"}
+	}
+	members, err := s.repos.InstanceMember.ListWithUsers(ctx, inst.ID)
 	if err != nil {
 		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "load members failed"}
 	}
 	names := make([]string, 0, len(members))
 	for _, m := range members {
-		u, err := s.repos.User.Read(ctx, m.UserID)
-		if err == nil {
-			names = append(names, u.MCName)
-		}
+		names = append(names, m.MCName)
 		if len(names) >= 10 {
 			break
 		}
 	}
-	msg := fmt.Sprintf("id=%d alias=%s status=%s access=%s members=%d", inst.ID, inst.Alias, inst.Status, inst.AccessMode, len(members))
+	msg := fmt.Sprintf("id=%d name=%s alias=%s status=%s access=%s members=%d", inst.ID, displayName(inst), inst.Alias, inst.Status, inst.AccessMode, len(members))
 	if len(names) > 0 {
 		msg += " [" + strings.Join(names, ",") + "]"
 	}
-	if !canManage(actor, inst.OwnerID) {
+	if inst.HealthStatus == string(worker.HealthAuthFailed) {
+		msg += " health=auth_failed (check servertap_key)"
+	}
+	msg += instanceActivity(inst, time.Now())
+	if !s.canManage(ctx, actor, inst) {
 		// non-owner can still read basic info
 		return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: msg}
 	}
+	if isAdmin(actor) {
+		msg += " " + instanceDiagnostics(inst)
+	}
+	// Free text with spaces: keep it last so it cannot be mistaken for
+	// the key=value fields around it.
+	if inst.Notes != "" {
+		msg += " note=" + inst.Notes
+	}
 	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: msg}
 }
 
-func (s *ServiceI) handleWorldJoin(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
-	inst, err := s.resolveInstance(ctx, req.WorldAlias)
-	if err != nil {
-		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
-	}
-	if inst.Status != string(worker.StatusOn) {
-		return http.StatusConflict, WorldCommandResponse{Status: "error", Message: "instance is not On"}
+// instanceActivity reports how long an On instance has been running, or when
+// an instance that is not On was last started.
+func instanceActivity(inst pgsql.MapInstance, now time.Time) string {
+	if inst.Status == string(worker.StatusOn) && inst.StartedOnAt.Valid {
+		return " uptime=" + formatUptime(now.Sub(inst.StartedOnAt.Time))
 	}
-	if !s.canJoinInstance(ctx, actor, inst) {
-		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "join denied"}
+	if inst.Status != string(worker.StatusOn) && inst.LastActiveAt.Valid {
+		return " last_active=" + inst.LastActiveAt.Time.UTC().Format(time.RFC3339)
 	}
-	if err := s.sendPlayerToInstance(ctx, actor.MCName, inst.ID); err != nil {
-		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "send player failed"}
+	return ""
+}
+
+// formatUptime renders d to the minute, e.g. "3h5m"; anything shorter is "<1m".
+func formatUptime(d time.Duration) string {
+	d = d.Truncate(time.Minute)
+	if d < time.Minute {
+		return "<1m"
 	}
-	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("joining #%d:%s", inst.ID, inst.Alias)}
+	return strings.TrimSuffix(d.String(), "0s")
 }
 
-func (s *ServiceI) handleLobbyJoin(ctx context.Context, actor pgsql.User) (int, WorldCommandResponse) {
-	if err := s.sendPlayerToServer(ctx, actor.MCName, "lobby"); err != nil {
-		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "send player to lobby failed"}
+// instanceDiagnostics is the admin-only part of world_info: what is needed to
+// debug a failed start. last_error goes last since it may contain spaces.
+func instanceDiagnostics(inst pgsql.MapInstance) string {
+	orDash := func(v string) string {
+		if v == "" {
+			return "-"
+		}
+		return v
 	}
-	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: "returning to lobby"}
+	parts := []string{
+		"health_status=" + orDash(inst.HealthStatus),
+		"game_version=" + orDash(inst.GameVersion),
+		"source_type=" + orDash(inst.SourceType),
+	}
+	if inst.LastHealthAt.Valid {
+		parts = append(parts, "last_health_at="+inst.LastHealthAt.Time.UTC().Format(time.RFC3339))
+	}
+	if inst.LastErrorMsg.Valid && inst.LastErrorMsg.String != "" {
+		parts = append(parts, "last_error_code="+string(worker.ClassifyError(inst.LastErrorMsg.String)))
+		parts = append(parts, "last_error="+inst.LastErrorMsg.String)
+	}
+	return strings.Join(parts, " ")
 }
 
-func (s *ServiceI) handleInstanceList(ctx context.Context, actor pgsql.User) (int, WorldCommandResponse) {
+// timelineEvent is one entry of world_timeline.
+type timelineEvent struct {
+	At   time.Time
+	Text string
+}
+
+// mergeTimeline combines per-source event lists into one list ordered by
+// time. Events at the same instant keep the order of their sources.
+func mergeTimeline(sources ...[]timelineEvent) []timelineEvent {
+	var out []timelineEvent
+	for _, src := range sources {
+		out = append(out, src...)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].At.Before(out[j].At) })
+	return out
+}
+
+// handleWorldTimeline is the admin post-incident view of one instance: its
+// lifecycle fields, member additions and every request that targeted it,
+// merged oldest first.
+func (s *ServiceI) handleWorldTimeline(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
 	if !isAdmin(actor) {
 		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "op only"}
 	}
-	list, err := s.repos.MapInstance.List(ctx)
+	inst, err := s.resolveInstance(ctx, req.WorldAlias)
+	if errors.Is(err, sql.ErrNoRows) {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
+	}
 	if err != nil {
-		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "list instances failed"}
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "load instance failed"}
 	}
-	if len(list) == 0 {
-		return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: "no instances"}
+	members, err := s.repos.InstanceMember.ListWithUsers(ctx, inst.ID)
+	if err != nil {
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "load members failed"}
 	}
-	items := make([]string, 0, len(list))
-	for _, inst := range list {
-		items = append(items, fmt.Sprintf("%d:%s:%s", inst.ID, inst.Alias, inst.Status))
+	var requests []pgsql.UserRequest
+	if s.repos.UserRequest != nil {
+		requests, err = s.repos.UserRequest.ListFiltered(ctx, pgsql.UserRequestFilter{TargetInstanceID: inst.ID}, pgsql.Page{Number: 1, Size: requestListMaxPageSize})
+		if err != nil {
+			return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "list requests failed"}
+		}
 	}
-	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: strings.Join(items, ", ")}
-}
 
-func (s *ServiceI) handleInstanceCreate(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
-	if !isAdmin(actor) {
-		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "op only"}
+	lifecycle := []timelineEvent{{At: inst.CreatedAt, Text: fmt.Sprintf("created source=%s version=%s", inst.SourceType, inst.GameVersion)}}
+	if inst.LastErrorMsg.Valid && inst.LastErrorMsg.String != "" && inst.LastHealthAt.Valid {
+		lifecycle = append(lifecycle, timelineEvent{At: inst.LastHealthAt.Time, Text: "failed code=" + string(worker.ClassifyError(inst.LastErrorMsg.String))})
 	}
-	if req.WorldAlias == "" {
-		return http.StatusBadRequest, WorldCommandResponse{Status: "error", Message: "world_alias is required"}
+	if inst.ArchivedAt.Valid {
+		lifecycle = append(lifecycle, timelineEvent{At: inst.ArchivedAt.Time, Text: "archived"})
 	}
-	finalAlias := buildOwnedAlias(actor.MCName, req.WorldAlias)
-	if _, err := s.repos.MapInstance.ReadByAlias(ctx, finalAlias); err == nil {
-		return http.StatusConflict, WorldCommandResponse{Status: "error", Message: "world_alias already exists"}
+
+	memberEvents := make([]timelineEvent, 0, len(members))
+	for _, m := range members {
+		memberEvents = append(memberEvents, timelineEvent{At: m.CreatedAt, Text: fmt.Sprintf("member %s role=%s", m.MCName, m.Role)})
+	}
+
+	actorIDs := make([]int64, 0, len(requests))
+	for _, r := range requests {
+		actorIDs = append(actorIDs, r.ActorUserID)
+	}
+	actors, err := s.repos.User.ReadByIDs(ctx, actorIDs)
+	if err != nil {
+		s.logger.Warnf("world_timeline resolve actors failed: %v", err)
+	}
+	requestEvents := make([]timelineEvent, 0, 2*len(requests))
+	for _, r := range requests {
+		actorName := fmt.Sprintf("uid:%d", r.ActorUserID)
+		if u, ok := actors[r.ActorUserID]; ok {
+			actorName = u.MCName
+		}
+		requestEvents = append(requestEvents, timelineEvent{At: r.CreatedAt, Text: fmt.Sprintf("#%d %s by %s", r.ID, r.RequestType, actorName)})
+		if r.Status == "pending" || r.Status == "processing" {
+			continue
+		}
+		text := fmt.Sprintf("#%d %s %s", r.ID, r.RequestType, r.Status)
+		if r.ErrorCode.Valid {
+			text += " error=" + r.ErrorCode.String
+		}
+		requestEvents = append(requestEvents, timelineEvent{At: r.UpdatedAt, Text: text})
+	}
+
+	events := mergeTimeline(lifecycle, memberEvents, requestEvents)
+	lines := make([]string, 0, len(events)+1)
+	lines = append(lines, fmt.Sprintf("timeline #%d:%s", inst.ID, inst.Alias))
+	for _, ev := range events {
+		lines = append(lines, ev.At.UTC().Format(time.RFC3339)+" "+ev.Text)
+	}
+	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: strings.Join(lines, "\n")}
+}
+
+// handleWorldNote sets the admin note shown in world_info; an empty note
+// clears it.
+func (s *ServiceI) handleWorldNote(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
+	if !isAdmin(actor) {
+		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "op only"}
+	}
+	inst, err := s.resolveInstance(ctx, req.WorldAlias)
+	if err != nil {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
+	}
+	inst.Notes = req.Note
+	if err := s.repos.MapInstance.Update(ctx, inst); err != nil {
+		s.logger.Errorf("world_note update failed instance=%d alias=%s err=%v", inst.ID, inst.Alias, err)
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "update note failed"}
+	}
+	if req.Note == "" {
+		return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("note cleared: #%d:%s", inst.ID, inst.Alias)}
+	}
+	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("note set: #%d:%s", inst.ID, inst.Alias)}
+}
+
+func (s *ServiceI) handleWorldJoin(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
+	inst, err := s.resolveInstance(ctx, req.WorldAlias)
+	if err != nil {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
+	}
+	if inst.Status != string(worker.StatusOn) {
+		return http.StatusConflict, WorldCommandResponse{Status: "error", Message: "instance is not On"}
+	}
+	if !s.canJoinInstance(ctx, actor, inst) {
+		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "join denied"}
+	}
+	if err := s.sendPlayerToInstance(ctx, actor.MCName, inst.ID); err != nil {
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "send player failed"}
+	}
+	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("joining #%d:%s", inst.ID, inst.Alias)}
+}
+
+func (s *ServiceI) handleLobbyJoin(ctx context.Context, actor pgsql.User) (int, WorldCommandResponse) {
+	if err := s.sendPlayerToServer(ctx, actor.MCName, "lobby"); err != nil {
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "send player to lobby failed"}
+	}
+	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: "returning to lobby"}
+}
+
+func (s *ServiceI) handleInstanceList(ctx context.Context, actor pgsql.User) (int, WorldCommandResponse) {
+	if !isAdmin(actor) {
+		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "op only"}
+	}
+	list, err := s.repos.MapInstance.List(ctx)
+	if err != nil {
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "list instances failed"}
+	}
+	if len(list) == 0 {
+		return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: "no instances"}
+	}
+	items := make([]string, 0, len(list))
+	for _, inst := range list {
+		items = append(items, fmt.Sprintf("%d:%s:%s", inst.ID, inst.Alias, inst.Status))
+	}
+	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: strings.Join(items, ", ")}
+}
+
+// handleInstanceCreate creates an instance directly (no request). With start
+// false it is only provisioned: volume and compose are prepared and the
+// instance stays Off until instance_on.
+func (s *ServiceI) handleInstanceCreate(ctx context.Context, req WorldCommandRequest, actor pgsql.User, start bool) (int, WorldCommandResponse) {
+	if !isAdmin(actor) {
+		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "op only"}
+	}
+	finalAlias := buildOwnedAlias(actor.MCName, req.WorldAlias)
+	if _, err := s.repos.MapInstance.ReadByAlias(ctx, finalAlias); err == nil {
+		return s.aliasTaken(ctx, actor.MCName, req.WorldAlias)
 	}
 
 	instance := pgsql.MapInstance{
 		Alias:       finalAlias,
+		DisplayName: req.WorldAlias,
 		OwnerID:     actor.ID,
 		SourceType:  "empty",
 		GameVersion: s.defaultGameVersion,
+		StorageType: s.storageTypeOrDefault(req.StorageType),
+		LevelSeed:   req.Seed,
 		AccessMode:  "privacy",
 		Status:      string(worker.StatusWaiting),
 	}
@@ -890,6 +2250,9 @@ func (s *ServiceI) handleInstanceCreate(ctx context.Context, req WorldCommandReq
 		instance.SourceType = "template"
 		instance.GameVersion = template.GameVersion
 	}
+	if status, resp, ok := s.checkGameVersion(ctx, instance.GameVersion); !ok {
+		return status, resp
+	}
 
 	instanceID, err := s.repos.MapInstance.Create(ctx, instance)
 	if err != nil {
@@ -900,18 +2263,33 @@ func (s *ServiceI) handleInstanceCreate(ctx context.Context, req WorldCommandReq
 	go func() {
 		runCtx := context.Background()
 		var runErr error
-		if instance.TemplateID.Valid {
+		switch {
+		case !start:
+			runErr = s.worker.Provision(runCtx, instanceID, instance.GameVersion, template.BlobPath)
+		case instance.TemplateID.Valid:
 			runErr = s.worker.StartFromTemplate(runCtx, instanceID, template)
-		} else {
+		default:
 			runErr = s.worker.StartEmpty(runCtx, instanceID, instance.GameVersion)
 		}
 		if runErr != nil {
-			s.logger.Errorf("instance_create failed instance=%d alias=%s err=%v", instanceID, finalAlias, runErr)
+			s.logger.Errorf("%s failed instance=%d alias=%s err=%v", req.Action, instanceID, finalAlias, runErr)
 			return
 		}
-		s.logger.Infof("instance_create done instance=%d alias=%s", instanceID, finalAlias)
+		s.logger.Infof("%s done instance=%d alias=%s", req.Action, instanceID, finalAlias)
 	}()
 
+	if !start {
+		return http.StatusAccepted, WorldCommandResponse{
+			Status: "accepted",
+			Message: fmt.Sprintf(
+				"instance provisioning: id=%d world=%s template=%s. start with: /mcmm instance on #%d",
+				instanceID,
+				finalAlias,
+				displayTemplate(template.Tag),
+				instanceID,
+			),
+		}
+	}
 	return http.StatusAccepted, WorldCommandResponse{
 		Status: "accepted",
 		Message: fmt.Sprintf(
@@ -933,6 +2311,10 @@ func (s *ServiceI) handleInstancePower(ctx context.Context, req WorldCommandRequ
 	if err != nil {
 		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
 	}
+	finish, dup := s.trackAsyncRequest(ctx, req, actor, inst)
+	if dup != nil {
+		return duplicateRequest(*dup)
+	}
 	go func(id int64, alias string, ownerID int64, actorID int64) {
 		runCtx := context.Background()
 		var runErr error
@@ -941,6 +2323,7 @@ func (s *ServiceI) handleInstancePower(ctx context.Context, req WorldCommandRequ
 		} else {
 			runErr = s.worker.StopOnly(runCtx, id)
 		}
+		finish(runCtx, runErr)
 		if runErr != nil {
 			s.logger.Errorf("instance power failed instance=%d alias=%s on=%v err=%v", id, alias, on, runErr)
 			s.notifyInstancePowerResult(runCtx, id, alias, ownerID, actorID, "instance", on, false, runErr.Error())
@@ -954,6 +2337,63 @@ func (s *ServiceI) handleInstancePower(ctx context.Context, req WorldCommandRequ
 	return http.StatusAccepted, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("instance stop requested: #%d:%s", inst.ID, inst.Alias)}
 }
 
+// handleInstancePowerAll starts every Off instance or stops every On one in
+// the background, at most bulkConcurrency at a time, and tells the actor the
+// totals when done. Other statuses are left alone.
+func (s *ServiceI) handleInstancePowerAll(ctx context.Context, actor pgsql.User, on bool) (int, WorldCommandResponse) {
+	list, err := s.repos.MapInstance.List(ctx)
+	if err != nil {
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "list instances failed"}
+	}
+	from, op, run := worker.StatusOn, "stop", s.worker.StopOnly
+	if on {
+		from, op, run = worker.StatusOff, "start", s.worker.StartExisting
+	}
+	targets := make([]pgsql.MapInstance, 0, len(list))
+	for _, inst := range list {
+		if inst.Status == string(from) {
+			targets = append(targets, inst)
+		}
+	}
+	if len(targets) == 0 {
+		return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("no %s instances to %s", from, op)}
+	}
+	go func(actorID int64, concurrency int) {
+		runCtx := context.Background()
+		sem := make(chan struct{}, concurrency)
+		var (
+			wg     sync.WaitGroup
+			mu     sync.Mutex
+			failed []string
+		)
+		for _, inst := range targets {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(inst pgsql.MapInstance) {
+				defer func() { <-sem; wg.Done() }()
+				if err := run(runCtx, inst.ID); err != nil {
+					s.logger.Errorf("instance %s_all failed instance=%d alias=%s err=%v", op, inst.ID, inst.Alias, err)
+					mu.Lock()
+					failed = append(failed, fmt.Sprintf("#%d:%s", inst.ID, inst.Alias))
+					mu.Unlock()
+				}
+			}(inst)
+		}
+		wg.Wait()
+		msg := fmt.Sprintf("[MCMM] instance %s all done: %d ok, %d failed", op, len(targets)-len(failed), len(failed))
+		if len(failed) > 0 {
+			sort.Strings(failed)
+			msg += " (" + strings.Join(failed, ", ") + ")"
+		}
+		s.logger.Infof("%s", msg)
+		s.notifyTargets(runCtx, NotifyTargets{UserIDs: []int64{actorID}}, msg)
+	}(actor.ID, s.bulkConcurrency)
+	return http.StatusAccepted, WorldCommandResponse{
+		Status:  "accepted",
+		Message: fmt.Sprintf("instance %s queued for %d instances (%d at a time)", op, len(targets), s.bulkConcurrency),
+	}
+}
+
 func (s *ServiceI) notifyInstancePowerResult(
 	ctx context.Context,
 	instanceID int64,
@@ -965,25 +2405,6 @@ func (s *ServiceI) notifyInstancePowerResult(
 	success bool,
 	reason string,
 ) {
-	if s.lobbyTapURL == "" {
-		return
-	}
-	conn, err := servertap.NewConnectorWithAuth(s.lobbyTapURL, 5*time.Second, s.serverTapAuthName, s.serverTapKey)
-	if err != nil {
-		return
-	}
-	names := make([]string, 0, 8)
-	if u, err := s.repos.User.Read(ctx, ownerID); err == nil {
-		names = append(names, u.MCName)
-	}
-	if u, err := s.repos.User.Read(ctx, actorID); err == nil {
-		names = append(names, u.MCName)
-	}
-	if admins, err := s.repos.User.ListByRole(ctx, "admin"); err == nil {
-		for _, a := range admins {
-			names = append(names, a.MCName)
-		}
-	}
 	op := "off"
 	if on {
 		op = "on"
@@ -994,7 +2415,7 @@ func (s *ServiceI) notifyInstancePowerResult(
 	} else {
 		msg = fmt.Sprintf("[MCMM] %s %s failed: #%d:%s (%s)", scope, op, instanceID, alias, reason)
 	}
-	_ = s.notifyPlayersViaLobbyTap(ctx, conn, names, msg)
+	s.notifyTargets(ctx, NotifyTargets{UserIDs: []int64{ownerID, actorID}, Admins: true}, msg)
 }
 
 func (s *ServiceI) handleInstanceRemove(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
@@ -1005,9 +2426,15 @@ func (s *ServiceI) handleInstanceRemove(ctx context.Context, req WorldCommandReq
 	if err != nil {
 		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
 	}
+	finish, dup := s.trackAsyncRequest(ctx, req, actor, inst)
+	if dup != nil {
+		return duplicateRequest(*dup)
+	}
 	go func() {
 		runCtx := context.Background()
-		if err := s.worker.StopAndArchive(runCtx, inst.ID); err != nil {
+		err := s.worker.StopAndArchive(runCtx, inst.ID)
+		finish(runCtx, err)
+		if err != nil {
 			s.logger.Errorf("instance_remove failed instance=%d alias=%s err=%v", inst.ID, inst.Alias, err)
 			return
 		}
@@ -1019,6 +2446,123 @@ func (s *ServiceI) handleInstanceRemove(ctx context.Context, req WorldCommandReq
 	}
 }
 
+// handleInstancePurge permanently deletes an archived instance: archive dir,
+// instance dir and the map_instances row. It cannot be undone by world_restore.
+func (s *ServiceI) handleInstancePurge(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
+	inst, err := s.resolveInstance(ctx, req.WorldAlias)
+	if err != nil {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
+	}
+	if worker.Status(inst.Status) != worker.StatusArchived {
+		return http.StatusConflict, WorldCommandResponse{Status: "error", Message: fmt.Sprintf("only archived instances can be purged (status=%s)", inst.Status)}
+	}
+	if err := s.worker.DeleteArchived(ctx, inst.ID); err != nil {
+		s.logger.Errorf("instance_purge failed instance=%d alias=%s err=%v", inst.ID, inst.Alias, err)
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "instance purge failed"}
+	}
+	s.logger.Infof("instance_purge done instance=%d alias=%s actor=%s", inst.ID, inst.Alias, actor.MCName)
+	return http.StatusOK, WorldCommandResponse{
+		Status:  "accepted",
+		Message: fmt.Sprintf("instance purged: #%d %s", inst.ID, inst.Alias),
+	}
+}
+
+// handleWorldSetVersion changes the game version of an instance. Without
+// restart it only corrects the metadata, which is refused for a running
+// instance since the container would keep the old runtime; with restart the
+// worker stops the instance if needed and starts it on the new version.
+func (s *ServiceI) handleWorldSetVersion(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
+	inst, err := s.resolveInstance(ctx, req.WorldAlias)
+	if err != nil {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
+	}
+	status := worker.Status(inst.Status)
+	switch status {
+	case worker.StatusOn, worker.StatusOff, worker.StatusArchived:
+	default:
+		return http.StatusConflict, WorldCommandResponse{Status: "error", Message: fmt.Sprintf("instance is busy (status=%s)", inst.Status)}
+	}
+	gv, err := s.repos.GameVersion.Read(ctx, req.GameVersion)
+	if err != nil || gv.Status != "verified" {
+		return fieldErrors{"game_version": "not a verified game version"}.response()
+	}
+	if isDowngrade(inst.GameVersion, req.GameVersion) && !req.Force {
+		return http.StatusConflict, WorldCommandResponse{Status: "error", Message: fmt.Sprintf(
+			"downgrade %s -> %s can corrupt the world, set force=true to proceed", inst.GameVersion, req.GameVersion)}
+	}
+	if status == worker.StatusOn && !req.Restart {
+		return http.StatusConflict, WorldCommandResponse{Status: "error", Message: "instance is running, set restart=true to switch its version"}
+	}
+	if !req.Restart {
+		from := inst.GameVersion
+		inst.GameVersion = req.GameVersion
+		if err := s.repos.MapInstance.Update(ctx, inst); err != nil {
+			s.logger.Errorf("world_set_version update failed instance=%d alias=%s err=%v", inst.ID, inst.Alias, err)
+			return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "update game version failed"}
+		}
+		s.logger.Infof("world_set_version instance=%d alias=%s %s -> %s actor=%s", inst.ID, inst.Alias, from, req.GameVersion, actor.MCName)
+		return http.StatusOK, WorldCommandResponse{
+			Status:  "accepted",
+			Message: fmt.Sprintf("game version set: #%d:%s %s -> %s", inst.ID, inst.Alias, from, req.GameVersion),
+		}
+	}
+	if status == worker.StatusArchived {
+		return http.StatusConflict, WorldCommandResponse{Status: "error", Message: "archived instance cannot be restarted, restore it first"}
+	}
+	go func(id int64, alias string, ownerID int64, actorID int64, version string) {
+		runCtx := context.Background()
+		if err := s.worker.SwitchVersion(runCtx, id, version); err != nil {
+			s.logger.Errorf("world_set_version restart failed instance=%d alias=%s version=%s err=%v", id, alias, version, err)
+			s.notifyTargets(runCtx, NotifyTargets{UserIDs: []int64{ownerID, actorID}, Admins: true},
+				fmt.Sprintf("[MCMM] version switch failed: #%d:%s -> %s (%v)", id, alias, version, err))
+			return
+		}
+		s.notifyTargets(runCtx, NotifyTargets{UserIDs: []int64{ownerID, actorID}, Admins: true},
+			fmt.Sprintf("[MCMM] version switch completed: #%d:%s now on %s", id, alias, version))
+	}(inst.ID, inst.Alias, inst.OwnerID, actor.ID, req.GameVersion)
+	return http.StatusAccepted, WorldCommandResponse{
+		Status:  "accepted",
+		Message: fmt.Sprintf("version switch started: #%d:%s -> %s", inst.ID, inst.Alias, req.GameVersion),
+	}
+}
+
+// isDowngrade reports whether to is an older release than from, comparing
+// dotted numeric parts ("1.21.10" > "1.21.4"). Unknown or non-numeric
+// versions are never treated as a downgrade.
+func isDowngrade(from, to string) bool {
+	a, okA := parseGameVersion(from)
+	b, okB := parseGameVersion(to)
+	if !okA || !okB {
+		return false
+	}
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			return y < x
+		}
+	}
+	return false
+}
+
+func parseGameVersion(v string) ([]int, bool) {
+	parts := strings.Split(strings.TrimSpace(v), ".")
+	out := make([]int, 0, len(parts))
+	for _, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, false
+		}
+		out = append(out, n)
+	}
+	return out, true
+}
+
 func (s *ServiceI) handleInstanceLockdown(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
 	if !isAdmin(actor) {
 		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "op only"}
@@ -1032,7 +2576,7 @@ func (s *ServiceI) handleInstanceLockdown(ctx context.Context, req WorldCommandR
 		s.logger.Errorf("instance lockdown update failed instance=%d alias=%s err=%v", inst.ID, inst.Alias, err)
 		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "instance lockdown failed"}
 	}
-	if err := s.kickNonAdminPlayers(ctx, inst.ID); err != nil {
+	if err := s.kickNonAdminPlayers(ctx, inst); err != nil {
 		s.logger.Warnf("instance lockdown kick non-admin failed instance=%d alias=%s err=%v", inst.ID, inst.Alias, err)
 	}
 	return http.StatusOK, WorldCommandResponse{
@@ -1060,29 +2604,389 @@ func (s *ServiceI) handleInstanceUnlock(ctx context.Context, req WorldCommandReq
 	}
 }
 
-func (s *ServiceI) handlePlayerList(ctx context.Context) (int, WorldCommandResponse) {
-	users, err := s.repos.User.List(ctx)
+// handleInstancePin marks an instance's archive as exempt from (or subject
+// to) pruning when archive usage exceeds max_archive_bytes.
+func (s *ServiceI) handleInstancePin(ctx context.Context, req WorldCommandRequest, actor pgsql.User, pinned bool) (int, WorldCommandResponse) {
+	if !isAdmin(actor) {
+		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "op only"}
+	}
+	inst, err := s.resolveInstance(ctx, req.WorldAlias)
+	if err != nil {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
+	}
+	inst.ArchivePinned = pinned
+	if err := s.repos.MapInstance.Update(ctx, inst); err != nil {
+		s.logger.Errorf("%s update failed instance=%d alias=%s err=%v", req.Action, inst.ID, inst.Alias, err)
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "update archive pin failed"}
+	}
+	if pinned {
+		return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("archive pinned: #%d:%s", inst.ID, inst.Alias)}
+	}
+	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("archive unpinned: #%d:%s", inst.ID, inst.Alias)}
+}
+
+// handleWorldRepair recreates missing volume scaffolding (whitelist.json,
+// world dirs) of a stopped instance; existing data is kept.
+func (s *ServiceI) handleWorldRepair(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
+	if !isAdmin(actor) {
+		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "op only"}
+	}
+	inst, err := s.resolveInstance(ctx, req.WorldAlias)
+	if err != nil {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
+	}
+	if worker.Status(inst.Status) != worker.StatusOff {
+		return http.StatusConflict, WorldCommandResponse{Status: "error", Message: fmt.Sprintf("instance must be Off to repair (status=%s)", inst.Status)}
+	}
+	repaired, err := s.worker.RepairVolume(ctx, inst.ID)
+	if err != nil {
+		s.logger.Errorf("world_repair failed instance=%d alias=%s err=%v", inst.ID, inst.Alias, err)
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "repair failed: " + err.Error(), Code: workerCode(err)}
+	}
+	if len(repaired) == 0 {
+		return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("nothing to repair: #%d:%s", inst.ID, inst.Alias)}
+	}
+	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("repaired #%d:%s recreated=%s", inst.ID, inst.Alias, strings.Join(repaired, ","))}
+}
+
+// handleWorldCompose shows the instance's compose file (or, before its first
+// start, what it would be) with secrets redacted; nothing is started.
+func (s *ServiceI) handleWorldCompose(ctx context.Context, req WorldCommandRequest) (int, WorldCommandResponse) {
+	inst, err := s.resolveInstance(ctx, req.WorldAlias)
+	if err != nil {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
+	}
+	content, err := s.worker.ComposePreview(ctx, inst.ID)
+	if err != nil {
+		s.logger.Errorf("world_compose failed instance=%d alias=%s err=%v", inst.ID, inst.Alias, err)
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "compose preview failed: " + err.Error()}
+	}
+	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("#%d:%s docker-compose.yml\n%s", inst.ID, inst.Alias, content)}
+}
+
+// handleInstanceValidate is a dry run of the start flow: it checks the
+// version dir, paper jar and runtime image for the instance's version (or
+// game_version when given) without starting anything.
+func (s *ServiceI) handleInstanceValidate(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
+	if !isAdmin(actor) {
+		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "op only"}
+	}
+	inst, err := s.resolveInstance(ctx, req.WorldAlias)
+	if err != nil {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
+	}
+	if _, ok := parseGameVersion(req.GameVersion); req.GameVersion != "" && !ok {
+		return fieldErrors{"game_version": "must look like 1.21.1"}.response()
+	}
+	version := req.GameVersion
+	if version == "" {
+		version = inst.GameVersion
+	}
+	if err := s.worker.ValidateStart(ctx, inst.ID, version); err != nil {
+		msg := strings.ReplaceAll(err.Error(), "\n", "; ")
+		return http.StatusConflict, WorldCommandResponse{Status: "error", Message: fmt.Sprintf("start check failed #%d:%s version=%s: %s", inst.ID, inst.Alias, version, msg), Code: workerCode(err)}
+	}
+	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("start check passed #%d:%s version=%s", inst.ID, inst.Alias, version)}
+}
+
+// handleWorldRotateKey gives the instance a new ServerTap key. An Off
+// instance is rotated in place; a running one is restarted in the background
+// and the owner and admins are told how it went.
+func (s *ServiceI) handleWorldRotateKey(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
+	if !isAdmin(actor) {
+		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "op only"}
+	}
+	inst, err := s.resolveInstance(ctx, req.WorldAlias)
+	if err != nil {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
+	}
+	switch worker.Status(inst.Status) {
+	case worker.StatusOff:
+		if err := s.worker.RotateServerTapKey(ctx, inst.ID); err != nil {
+			s.logger.Errorf("world_rotate_key failed instance=%d alias=%s err=%v", inst.ID, inst.Alias, err)
+			return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "rotate key failed: " + err.Error(), Code: workerCode(err)}
+		}
+		s.logger.Infof("world_rotate_key instance=%d alias=%s actor=%s", inst.ID, inst.Alias, actor.MCName)
+		return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("servertap key rotated: #%d:%s", inst.ID, inst.Alias)}
+	case worker.StatusOn:
+	default:
+		return http.StatusConflict, WorldCommandResponse{Status: "error", Message: fmt.Sprintf("instance is busy (status=%s)", inst.Status)}
+	}
+	go func(id int64, alias string, ownerID int64, actorID int64) {
+		runCtx := context.Background()
+		if err := s.worker.RotateServerTapKey(runCtx, id); err != nil {
+			s.logger.Errorf("world_rotate_key restart failed instance=%d alias=%s err=%v", id, alias, err)
+			s.notifyTargets(runCtx, NotifyTargets{UserIDs: []int64{ownerID, actorID}, Admins: true},
+				fmt.Sprintf("[MCMM] servertap key rotation failed: #%d:%s (%v)", id, alias, err))
+			return
+		}
+		s.notifyTargets(runCtx, NotifyTargets{UserIDs: []int64{ownerID, actorID}, Admins: true},
+			fmt.Sprintf("[MCMM] servertap key rotated: #%d:%s is back online", id, alias))
+	}(inst.ID, inst.Alias, inst.OwnerID, actor.ID)
+	return http.StatusAccepted, WorldCommandResponse{
+		Status:  "accepted",
+		Message: fmt.Sprintf("servertap key rotation started, restarting: #%d:%s", inst.ID, inst.Alias),
+	}
+}
+
+// handleVersionSupported reports each supported version prefix with its
+// runtime image and the installed versions that have a paper jar.
+func (s *ServiceI) handleVersionSupported(actor pgsql.User) (int, WorldCommandResponse) {
+	if !isAdmin(actor) {
+		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "op only"}
+	}
+	supported, err := s.worker.SupportedVersions()
+	if err != nil {
+		s.logger.Errorf("version_supported failed err=%v", err)
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "list versions failed"}
+	}
+	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: formatVersionSupport(supported)}
+}
+
+// handleInstanceByServer resolves a proxy server-id back to its instance, for
+// proxy callbacks that only know the server a player is on.
+func (s *ServiceI) handleInstanceByServer(ctx context.Context, req WorldCommandRequest) (int, WorldCommandResponse) {
+	id, err := worker.ParseServerID(s.serverIDPrefix, req.ServerID)
+	if err != nil {
+		return fieldErrors{"server_id": "not an instance server id"}.response()
+	}
+	inst, err := s.repos.MapInstance.Read(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "instance not found"}
+	}
+	if err != nil {
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "read instance failed"}
+	}
+	return http.StatusOK, WorldCommandResponse{
+		Status:  "accepted",
+		Message: fmt.Sprintf("server_id=%s instance=#%d alias=%s status=%s", req.ServerID, inst.ID, inst.Alias, inst.Status),
+	}
+}
+
+// handleCapacity reports what operators need to decide whether more worlds
+// can start. Op only (isOpOnlyAction).
+func (s *ServiceI) handleCapacity(ctx context.Context) (int, WorldCommandResponse) {
+	report, err := s.worker.Capacity(ctx)
+	if err != nil {
+		s.logger.Errorf("capacity failed err=%v", err)
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "read capacity failed"}
+	}
+	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: formatCapacity(report)}
+}
+
+func formatCapacity(r worker.CapacityReport) string {
+	heap := fmt.Sprintf("heap=%dMB/%dMB host", r.RunningHeapMB, r.HostMemoryMB)
+	if r.UnlimitedRunning > 0 {
+		heap += fmt.Sprintf(" (+%d unlimited)", r.UnlimitedRunning)
+	}
+	slots := "unlimited"
+	if r.StartSlotsTotal > 0 {
+		slots = fmt.Sprintf("%d/%d", r.StartSlotsInUse, r.StartSlotsTotal)
+	}
+	return fmt.Sprintf(
+		"capacity: instances=%d running=%d %s disk_free instance=%dMB archive=%dMB start_slots=%s",
+		r.TotalInstances,
+		r.RunningInstances,
+		heap,
+		r.InstanceDiskFree>>20,
+		r.ArchiveDiskFree>>20,
+		slots,
+	)
+}
+
+// checkGameVersion rejects a version that is unknown or not verified with a
+// 400 listing the verified ones, before any row or container is created.
+func (s *ServiceI) checkGameVersion(ctx context.Context, version string) (int, WorldCommandResponse, bool) {
+	gv, err := s.repos.GameVersion.Read(ctx, version)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		s.logger.Errorf("read game version=%s failed err=%v", version, err)
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "read game version failed"}, false
+	}
+	if err == nil && gv.Status == "verified" {
+		return 0, WorldCommandResponse{}, true
+	}
+	msg := "not a verified game version"
+	if verified, listErr := s.versionCache.get(ctx, s.repos.GameVersion.ListVerified); listErr == nil && len(verified) > 0 {
+		names := make([]string, 0, len(verified))
+		for _, v := range verified {
+			names = append(names, v.GameVersion)
+		}
+		msg += " (valid: " + strings.Join(names, ", ") + ")"
+	}
+	status, resp := fieldErrors{"game_version": msg}.response()
+	return status, resp, false
+}
+
+// handleVersionList tells players which game versions they can create
+// worlds on: the verified rows of game_versions with their core jar.
+func (s *ServiceI) handleVersionList(ctx context.Context) (int, WorldCommandResponse) {
+	versions, err := s.versionCache.get(ctx, s.repos.GameVersion.ListVerified)
+	if err != nil {
+		s.logger.Errorf("version_list failed err=%v", err)
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "list versions failed"}
+	}
+	if len(versions) == 0 {
+		return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: "no verified versions"}
+	}
+	items := make([]string, 0, len(versions))
+	for _, v := range versions {
+		items = append(items, fmt.Sprintf("%s(%s)", v.GameVersion, v.CoreJar))
+	}
+	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: "versions: " + strings.Join(items, ", ")}
+}
+
+func formatVersionSupport(supported []worker.VersionSupport) string {
+	lines := make([]string, 0, len(supported))
+	for _, v := range supported {
+		installed := "none"
+		if len(v.Installed) > 0 {
+			installed = strings.Join(v.Installed, ",")
+		}
+		lines = append(lines, fmt.Sprintf("%s.x -> %s installed=%s", v.Prefix, v.Image, installed))
+	}
+	return "versions: " + strings.Join(lines, "; ")
+}
+
+func (s *ServiceI) handleSelfTestCycle(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
+	if !isAdmin(actor) {
+		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "op only"}
+	}
+	version := req.GameVersion
+	if version == "" {
+		version = s.defaultGameVersion
+	}
+	alias := fmt.Sprintf("selftest-%s-%d", strings.ReplaceAll(version, ".", "-"), time.Now().Unix())
+	go func(actorID int64, actorName string) {
+		report := worker.RunSelfTestCycle(context.Background(), s.repos, s.worker, worker.SelfTestCycle{
+			Alias:       alias,
+			OwnerID:     actorID,
+			GameVersion: version,
+			Cleanup:     true,
+		})
+		result := "passed"
+		if !report.Passed() {
+			result = "failed"
+			s.logger.Errorf("selftest_cycle failed alias=%s instance=%d steps=%s", alias, report.InstanceID, report.Summary())
+		} else {
+			s.logger.Infof("selftest_cycle passed alias=%s instance=%d steps=%s", alias, report.InstanceID, report.Summary())
+		}
+		msg := fmt.Sprintf("[MCMM] selftest %s %s: %s", alias, result, report.Summary())
+		s.notifyTargets(context.Background(), NotifyTargets{Names: []string{actorName}}, msg)
+	}(actor.ID, actor.MCName)
+	return http.StatusAccepted, WorldCommandResponse{
+		Status:  "accepted",
+		Message: fmt.Sprintf("selftest started: world=%s version=%s", alias, version),
+	}
+}
+
+// handlePlayerSetRole changes a player's server role. A promoted admin is
+// opped and whitelisted on every running instance right away; stopped ones
+// pick the grant up on their next start. The last admin cannot be demoted.
+func (s *ServiceI) handlePlayerSetRole(ctx context.Context, req WorldCommandRequest, actor pgsql.User) (int, WorldCommandResponse) {
+	if !isAdmin(actor) {
+		return http.StatusForbidden, WorldCommandResponse{Status: "error", Message: "op only"}
+	}
+	target, err := s.repos.User.ReadByName(ctx, req.Target)
+	if err != nil {
+		return http.StatusNotFound, WorldCommandResponse{Status: "error", Message: "target user not found"}
+	}
+	if target.ServerRole == req.Role {
+		return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("%s is already %s", target.MCName, req.Role)}
+	}
+	if isAdmin(target) {
+		admins, err := s.repos.User.ListByRole(ctx, "admin")
+		if err != nil {
+			return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "load admins failed"}
+		}
+		if len(admins) <= 1 {
+			return http.StatusConflict, WorldCommandResponse{Status: "error", Message: "cannot demote the last admin"}
+		}
+	}
+	target.ServerRole = req.Role
+	if err := s.repos.User.Update(ctx, target); err != nil {
+		s.logger.Errorf("player_set_role update failed target=%s role=%s err=%v", target.MCName, req.Role, err)
+		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "update role failed"}
+	}
+	s.logger.Infof("player_set_role target=%s role=%s actor=%s", target.MCName, req.Role, actor.MCName)
+	if !isAdmin(target) {
+		return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("%s is now %s", target.MCName, req.Role)}
+	}
+	granted, err := s.worker.AllowAndOpUser(ctx, target.MCName)
+	if err != nil {
+		s.logger.Warnf("player_set_role op grant incomplete target=%s granted=%d err=%v", target.MCName, len(granted), err)
+		return http.StatusOK, WorldCommandResponse{
+			Status:  "accepted",
+			Message: fmt.Sprintf("%s is now admin, op granted on %d running instances (some failed: %v)", target.MCName, len(granted), err),
+		}
+	}
+	return http.StatusOK, WorldCommandResponse{
+		Status:  "accepted",
+		Message: fmt.Sprintf("%s is now admin, op granted on %d running instances", target.MCName, len(granted)),
+	}
+}
+
+const playerListPageSize = 200
+
+// handlePlayerList lists player names one page at a time, optionally only
+// those with role (e.g. admin). A single unfiltered page keeps the plain
+// "players: ..." form the plugin's tab completion parses.
+func (s *ServiceI) handlePlayerList(ctx context.Context, req WorldCommandRequest) (int, WorldCommandResponse) {
+	page := req.Page
+	if page <= 0 {
+		page = 1
+	}
+	offset := (page - 1) * playerListPageSize
+	var (
+		users []pgsql.User
+		total int64
+		err   error
+	)
+	if req.Role != "" {
+		// Role-filtered sets (admins) are small; page them in memory.
+		users, err = s.repos.User.ListByRole(ctx, req.Role)
+		total = int64(len(users))
+		if err == nil {
+			users = users[min(offset, len(users)):min(offset+playerListPageSize, len(users))]
+		}
+	} else if total, err = s.repos.User.Count(ctx); err == nil {
+		users, err = s.repos.User.List(ctx, playerListPageSize, offset)
+	}
 	if err != nil {
 		return http.StatusInternalServerError, WorldCommandResponse{Status: "error", Message: "list players failed"}
 	}
-	if len(users) == 0 {
+	pages := int((total + playerListPageSize - 1) / playerListPageSize)
+	if total == 0 {
 		return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: "no players"}
 	}
-	limit := len(users)
-	if limit > 200 {
-		limit = 200
+	if len(users) == 0 {
+		return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: fmt.Sprintf("no players on page %d (pages=%d)", page, pages)}
 	}
-	names := make([]string, 0, limit)
-	for i := 0; i < limit; i++ {
-		if strings.TrimSpace(users[i].MCName) == "" {
+	names := make([]string, 0, len(users))
+	for _, u := range users {
+		if strings.TrimSpace(u.MCName) == "" {
 			continue
 		}
-		names = append(names, users[i].MCName)
+		names = append(names, u.MCName)
+	}
+	header := "players"
+	if pages > 1 || req.Role != "" || req.Page > 0 {
+		filter := ""
+		if req.Role != "" {
+			filter = "role=" + req.Role + " "
+		}
+		header = fmt.Sprintf("players (%spage %d/%d, total=%d)", filter, page, pages, total)
 	}
-	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: "players: " + strings.Join(names, ", ")}
+	return http.StatusOK, WorldCommandResponse{Status: "accepted", Message: header + ": " + strings.Join(names, ", ")}
 }
 
 func (s *ServiceI) ensureActor(ctx context.Context, actorUUID, actorName string) (pgsql.User, error) {
+	u, _, err := s.upsertActor(ctx, actorUUID, actorName)
+	return u, err
+}
+
+// upsertActor is ensureActor that also reports whether the user row was
+// created by this call.
+func (s *ServiceI) upsertActor(ctx context.Context, actorUUID, actorName string) (pgsql.User, bool, error) {
 	actorUUID = strings.TrimSpace(actorUUID)
 	actorName = strings.TrimSpace(actorName)
 	if actorName == "" {
@@ -1092,19 +2996,21 @@ func (s *ServiceI) ensureActor(ctx context.Context, actorUUID, actorName string)
 	u, err := s.repos.User.ReadByUUID(ctx, actorUUID)
 	if err == nil {
 		if u.MCName != actorName {
+			// Upsert only touches mc_name, so a concurrent join or role
+			// change is never overwritten with this possibly stale row.
 			oldName := u.MCName
-			u.MCName = actorName
-			if upErr := s.repos.User.Update(ctx, u); upErr != nil {
+			if renamed, _, upErr := s.repos.User.Upsert(ctx, actorUUID, actorName); upErr != nil {
 				s.logger.Warnf("ensure_actor rename failed user_id=%d uuid=%s old=%s new=%s err=%v", u.ID, actorUUID, oldName, actorName, upErr)
 			} else {
+				u = renamed
 				s.logger.Infof("ensure_actor renamed user_id=%d uuid=%s old=%s new=%s", u.ID, actorUUID, oldName, actorName)
 			}
 		}
 		s.logger.Infof("ensure_actor hit_by_uuid user_id=%d actor=%s uuid=%s role=%s", u.ID, actorName, actorUUID, u.ServerRole)
-		return u, nil
+		return u, false, nil
 	}
 	if !errors.Is(err, sql.ErrNoRows) {
-		return pgsql.User{}, err
+		return pgsql.User{}, false, err
 	}
 
 	byName, nameErr := s.repos.User.ReadByName(ctx, actorName)
@@ -1112,46 +3018,351 @@ func (s *ServiceI) ensureActor(ctx context.Context, actorUUID, actorName string)
 		oldUUID := byName.MCUUID
 		byName.MCUUID = actorUUID
 		if upErr := s.repos.User.Update(ctx, byName); upErr != nil {
-			return pgsql.User{}, upErr
+			return pgsql.User{}, false, upErr
+		}
+		s.logger.Warnf("ensure_actor rebound_uuid user_id=%d actor=%s old_uuid=%s new_uuid=%s", byName.ID, actorName, oldUUID, actorUUID)
+		return byName, false, nil
+	}
+	if !errors.Is(nameErr, sql.ErrNoRows) {
+		return pgsql.User{}, false, nameErr
+	}
+
+	// A concurrent join for the same UUID may insert first; Upsert then
+	// returns that row instead of failing on the unique key.
+	u, created, err := s.repos.User.Upsert(ctx, actorUUID, actorName)
+	if err != nil {
+		return pgsql.User{}, false, err
+	}
+	if !created {
+		s.logger.Infof("ensure_actor lost create race user_id=%d actor=%s uuid=%s", u.ID, actorName, actorUUID)
+		return u, false, nil
+	}
+	s.logger.Infof("ensure_actor created user_id=%d actor=%s uuid=%s role=%s", u.ID, actorName, actorUUID, u.ServerRole)
+	return u, true, nil
+}
+
+func isOwnerOrAdmin(actor pgsql.User, ownerID int64) bool {
+	return actor.ServerRole == "admin" || actor.ID == ownerID
+}
+
+// canManage allows admins, the owner and members promoted to manager.
+func (s *ServiceI) canManage(ctx context.Context, actor pgsql.User, inst pgsql.MapInstance) bool {
+	if isOwnerOrAdmin(actor, inst.OwnerID) {
+		return true
+	}
+	members, err := s.repos.InstanceMember.ListByInstance(ctx, inst.ID)
+	if err != nil {
+		return false
+	}
+	for _, m := range members {
+		if m.UserID == actor.ID {
+			return strings.EqualFold(m.Role, memberRoleManager)
+		}
+	}
+	return false
+}
+
+// isOwnerOrManager reports whether userID owns inst or holds its owner or
+// manager role, i.e. a row only the owner or an admin may remove.
+func (s *ServiceI) isOwnerOrManager(ctx context.Context, inst pgsql.MapInstance, userID int64) (bool, error) {
+	if userID == inst.OwnerID {
+		return true, nil
+	}
+	members, err := s.repos.InstanceMember.ListByInstance(ctx, inst.ID)
+	if err != nil {
+		return false, err
+	}
+	for _, m := range members {
+		if m.UserID == userID {
+			return strings.EqualFold(m.Role, memberRoleOwner) || strings.EqualFold(m.Role, memberRoleManager), nil
+		}
+	}
+	return false, nil
+}
+
+func isAdmin(actor pgsql.User) bool {
+	return actor.ServerRole == "admin"
+}
+
+// isCreateAction reports whether action asks for a new instance, directly or
+// through a request.
+func isCreateAction(action string) bool {
+	switch action {
+	case "create", "request_create", "request_resubmit", "instance_create", "instance_provision", "create_legacy":
+		return true
+	default:
+		return false
+	}
+}
+
+func isOpOnlyAction(action string) bool {
+	switch action {
+	case "request_approve", "request_reject", "request_history", "instance_list", "instance_purge", "selftest_cycle",
+		"world_set_version", "instance_set_version", "world_repair", "world_note", "version_supported", "instance_validate",
+		"world_rotate_key", "player_set_role", "capacity", "instance_start_all", "instance_stop_all", "world_compose",
+		"world_timeline", "instance_set_limits":
+		return true
+	default:
+		return false
+	}
+}
+
+// knownActions is every action name handleWorldCommand dispatches, aliases
+// included.
+var knownActions = map[string]bool{
+	"create": true, "request_create": true, "request_list": true, "request_history": true,
+	"request_approve": true, "request_reject": true, "request_resubmit": true, "request_cancel": true,
+	"world_list": true, "world_mine": true, "world_info": true, "world_timeline": true, "world_join": true,
+	"world_set_access": true, "world_set_name": true, "world_rename": true, "world_set_properties": true, "instance_set_limits": true, "world_on": true, "world_off": true,
+	"lobby_join": true, "world_remove": true, "delete": true, "world_restore": true, "world_logs": true,
+	"member_add": true, "member_remove": true, "member_set_role": true, "world_transfer": true,
+	"player_invite": true, "player_reject": true, "player_list": true, "player_set_role": true,
+	"instance_list": true, "instance_create": true, "instance_provision": true, "instance_stop": true,
+	"instance_on": true, "instance_off": true, "instance_start_all": true, "instance_stop_all": true,
+	"instance_remove": true, "instance_purge": true, "instance_lockdown": true, "instance_unlock": true,
+	"world_set_version": true, "instance_set_version": true, "instance_pin": true, "instance_unpin": true,
+	"world_repair": true, "instance_validate": true, "world_rotate_key": true, "world_note": true,
+	"version_supported": true, "capacity": true, "world_compose": true, "instance_by_server": true,
+	"template_list": true, "version_list": true, "selftest_cycle": true, "create_legacy": true,
+}
+
+// metricsAction is the action label of a request: its canonical name, or
+// "unknown" so clients cannot mint new series with made-up actions.
+func metricsAction(action string) string {
+	action = strings.TrimSpace(action)
+	if !knownActions[action] {
+		return "unknown"
+	}
+	return canonicalAction(action)
+}
+
+// canonicalAction maps an action alias to the name it is served under.
+func canonicalAction(action string) string {
+	switch action {
+	case "delete":
+		return "world_remove"
+	case "create":
+		return "request_create"
+	case "instance_set_version":
+		return "world_set_version"
+	case "player_invite":
+		return "member_add"
+	case "player_reject":
+		return "member_remove"
+	case "instance_stop":
+		return "instance_off"
+	}
+	return action
+}
+
+// isCooldownAction lists actions that spawn compose/worker operations.
+func isCooldownAction(action string) bool {
+	switch action {
+	case "world_on", "world_off", "world_remove", "delete", "world_restore",
+		"instance_on", "instance_off", "instance_stop", "instance_start_all", "instance_stop_all", "instance_create", "instance_provision", "instance_remove",
+		"create", "request_create", "request_resubmit", "selftest_cycle", "world_rotate_key":
+		return true
+	default:
+		return false
+	}
+}
+
+const defaultActionCooldown = 3 * time.Second
+
+// actionCooldown rejects repeats of the same (actor, action) within window.
+type actionCooldown struct {
+	mu        sync.Mutex
+	window    time.Duration
+	now       func() time.Time
+	last      map[string]time.Time
+	lastPrune time.Time
+}
+
+func newActionCooldown(window time.Duration, now func() time.Time) *actionCooldown {
+	if window < 0 {
+		window = 0
+	}
+	return &actionCooldown{window: window, now: now, last: make(map[string]time.Time)}
+}
+
+// allow records the call and reports false with the remaining wait when the
+// same actor repeated the action too soon.
+func (c *actionCooldown) allow(actorUUID, action string) (time.Duration, bool) {
+	if c == nil {
+		return 0, true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.window <= 0 {
+		return 0, true
+	}
+	now := c.now()
+	c.pruneLocked(now)
+	key := strings.ToLower(actorUUID) + "|" + action
+	if at, ok := c.last[key]; ok {
+		if elapsed := now.Sub(at); elapsed < c.window {
+			return c.window - elapsed, false
+		}
+	}
+	c.last[key] = now
+	return 0, true
+}
+
+// release forgets the actor's last call of action, so the next one is not
+// throttled. The entry is still held while the call runs, which keeps
+// concurrent repeats out.
+func (c *actionCooldown) release(actorUUID, action string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	delete(c.last, strings.ToLower(actorUUID)+"|"+action)
+	c.mu.Unlock()
+}
+
+func (c *actionCooldown) setWindow(window time.Duration) {
+	if window < 0 {
+		window = 0
+	}
+	c.mu.Lock()
+	c.window = window
+	c.mu.Unlock()
+}
+
+// pruneLocked drops expired entries at most once per window.
+func (c *actionCooldown) pruneLocked(now time.Time) {
+	if now.Sub(c.lastPrune) < c.window {
+		return
+	}
+	for k, at := range c.last {
+		if now.Sub(at) >= c.window {
+			delete(c.last, k)
+		}
+	}
+	c.lastPrune = now
+}
+
+// isReadOnlyAction reports actions that only read state; their last good
+// result may be served stale when the database is briefly unavailable.
+func isReadOnlyAction(action string) bool {
+	switch action {
+	case "world_list", "world_mine", "world_info", "world_timeline", "request_list", "request_history", "template_list", "version_list":
+		return true
+	default:
+		return false
+	}
+}
+
+// readCacheKey identifies one read as seen by one actor, so a cached answer
+// is never shown to someone else.
+func readCacheKey(req WorldCommandRequest) string {
+	return strings.Join([]string{
+		strings.TrimSpace(req.Action),
+		strings.ToLower(strings.TrimSpace(req.ActorUUID)),
+		strings.TrimSpace(req.WorldAlias),
+		strings.TrimSpace(req.GameVersion),
+		strings.TrimSpace(req.Query),
+		strconv.FormatBool(req.IncludeArchived),
+		strings.TrimSpace(req.Status),
+		strconv.Itoa(req.Page),
+		strconv.Itoa(req.PageSize),
+	}, "|")
+}
+
+const defaultReadFallbackTTL = 2 * time.Minute
+
+// readFallbackCache remembers the last successful response of read-only
+// actions for ttl and answers with it, flagged stale, when the same read
+// fails with a server error.
+type readFallbackCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	now       func() time.Time
+	entries   map[string]cachedRead
+	lastPrune time.Time
+}
+
+type cachedRead struct {
+	code int
+	resp WorldCommandResponse
+	at   time.Time
+}
+
+func newReadFallbackCache(ttl time.Duration, now func() time.Time) *readFallbackCache {
+	return &readFallbackCache{ttl: ttl, now: now, entries: make(map[string]cachedRead)}
+}
+
+// serve stores a successful result, or swaps a 5xx for the cached one while
+// it is fresh. Other results pass through unchanged.
+func (c *readFallbackCache) serve(key string, code int, resp WorldCommandResponse) (int, WorldCommandResponse, bool) {
+	if c == nil || c.ttl <= 0 {
+		return code, resp, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.pruneLocked(now)
+	switch {
+	case code >= 200 && code < 300:
+		c.entries[key] = cachedRead{code: code, resp: resp, at: now}
+	case code >= 500:
+		if hit, ok := c.entries[key]; ok && now.Sub(hit.at) < c.ttl {
+			stale := hit.resp
+			stale.Stale = true
+			return hit.code, stale, true
 		}
-		s.logger.Warnf("ensure_actor rebound_uuid user_id=%d actor=%s old_uuid=%s new_uuid=%s", byName.ID, actorName, oldUUID, actorUUID)
-		return byName, nil
-	}
-	if !errors.Is(nameErr, sql.ErrNoRows) {
-		return pgsql.User{}, nameErr
 	}
+	return code, resp, false
+}
 
-	id, err := s.repos.User.Create(ctx, pgsql.User{
-		MCUUID:     actorUUID,
-		MCName:     actorName,
-		ServerRole: "user",
-	})
-	if err != nil {
-		return pgsql.User{}, err
+// pruneLocked drops expired entries at most once per ttl.
+func (c *readFallbackCache) pruneLocked(now time.Time) {
+	if now.Sub(c.lastPrune) < c.ttl {
+		return
 	}
-	created, err := s.repos.User.Read(ctx, id)
-	if err != nil {
-		return pgsql.User{}, err
+	for k, e := range c.entries {
+		if now.Sub(e.at) >= c.ttl {
+			delete(c.entries, k)
+		}
 	}
-	s.logger.Infof("ensure_actor created user_id=%d actor=%s uuid=%s role=%s", created.ID, actorName, actorUUID, created.ServerRole)
-	return created, nil
+	c.lastPrune = now
 }
 
-func canManage(actor pgsql.User, ownerID int64) bool {
-	return actor.ServerRole == "admin" || actor.ID == ownerID
+const defaultVersionListTTL = 30 * time.Second
+
+// versionListCache keeps the last ListVerified result for ttl so
+// version_list does not hit the database on every call.
+type versionListCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	now      func() time.Time
+	versions []pgsql.GameVersion
+	loadedAt time.Time
 }
 
-func isAdmin(actor pgsql.User) bool {
-	return actor.ServerRole == "admin"
+func newVersionListCache(ttl time.Duration, now func() time.Time) *versionListCache {
+	return &versionListCache{ttl: ttl, now: now}
 }
 
-func isOpOnlyAction(action string) bool {
-	switch action {
-	case "request_approve", "request_reject", "instance_list":
-		return true
-	default:
-		return false
+// get returns the cached rows while fresh, otherwise reloads them with load.
+// Failed loads are not cached.
+func (c *versionListCache) get(ctx context.Context, load func(context.Context) ([]pgsql.GameVersion, error)) ([]pgsql.GameVersion, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if c.versions != nil && now.Sub(c.loadedAt) < c.ttl {
+		return c.versions, nil
+	}
+	versions, err := load(ctx)
+	if err != nil {
+		return nil, err
 	}
+	if versions == nil {
+		versions = []pgsql.GameVersion{}
+	}
+	c.versions = versions
+	c.loadedAt = now
+	return versions, nil
 }
 
 func (s *ServiceI) canJoinInstance(ctx context.Context, actor pgsql.User, inst pgsql.MapInstance) bool {
@@ -1244,6 +3455,380 @@ func parseSharpNumericID(raw string) (int64, bool) {
 	return id, true
 }
 
+const (
+	maxDisplayNameLen = 48
+	maxNoteLen        = 200
+	maxLevelSeedLen   = 64
+	maxMOTDLen        = 120
+	maxMaxPlayers     = 1000
+	maxCPULimit       = 64
+	minMemLimitMB     = 512
+	maxMemLimitMB     = 256 * 1024
+)
+
+type createRequestPayload struct {
+	Template        string `json:"template"`
+	WorldAlias      string `json:"world_alias"`
+	DisplayName     string `json:"display_name,omitempty"`
+	StorageType     string `json:"storage_type,omitempty"`
+	LevelSeed       string `json:"level_seed,omitempty"`
+	ResubmittedFrom int64  `json:"resubmitted_from,omitempty"`
+}
+
+func mustJSON(v any) json.RawMessage {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return json.RawMessage(`{}`)
+	}
+	return b
+}
+
+// fieldErrors maps a request field (form name) to what is wrong with it.
+type fieldErrors map[string]string
+
+func (f fieldErrors) require(field string, value string) {
+	if value == "" {
+		f[field] = "required"
+	}
+}
+
+func (f fieldErrors) playerName(field string, value string) {
+	if value == "" {
+		f[field] = "required"
+	} else if servertap.ValidatePlayerName(value) != nil {
+		f[field] = "not a valid player name"
+	}
+}
+
+// formBool parses an optional boolean form field; empty means false.
+func (f fieldErrors) formBool(r *http.Request, field string) bool {
+	raw := strings.TrimSpace(r.FormValue(field))
+	if raw == "" {
+		return false
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		f[field] = "must be true|false"
+	}
+	return v
+}
+
+// jsonPage checks an optional 1-based page number from a JSON body; 0 (or
+// omitted) means unset.
+func (f fieldErrors) jsonPage(field string, v int) int {
+	if v < 0 {
+		f[field] = "must be a positive integer"
+		return 0
+	}
+	return v
+}
+
+// formPage parses an optional 1-based page number; empty means 0 (unset).
+func (f fieldErrors) formPage(r *http.Request, field string) int {
+	return f.formPositive(r, field)
+}
+
+// formPositive parses an optional positive integer; empty means 0 (unset).
+func (f fieldErrors) formPositive(r *http.Request, field string) int {
+	raw := strings.TrimSpace(r.FormValue(field))
+	if raw == "" {
+		return 0
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v <= 0 {
+		f[field] = "must be a positive integer"
+		return 0
+	}
+	return v
+}
+
+// formFloat parses an optional number; empty means nil (unset).
+func (f fieldErrors) formFloat(r *http.Request, field string) *float64 {
+	raw := strings.TrimSpace(r.FormValue(field))
+	if raw == "" {
+		return nil
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		f[field] = "must be a number"
+		return nil
+	}
+	return &v
+}
+
+// formInt parses an optional integer; empty means nil (unset).
+func (f fieldErrors) formInt(r *http.Request, field string) *int {
+	raw := strings.TrimSpace(r.FormValue(field))
+	if raw == "" {
+		return nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		f[field] = "must be an integer"
+		return nil
+	}
+	return &v
+}
+
+func (f fieldErrors) oneOf(field string, value string, allowed ...string) {
+	if value == "" {
+		f[field] = "required"
+		return
+	}
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	f[field] = "must be " + strings.Join(allowed, "|")
+}
+
+func (f fieldErrors) response() (int, WorldCommandResponse) {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+": "+f[k])
+	}
+	return http.StatusBadRequest, WorldCommandResponse{
+		Status:  "error",
+		Message: "invalid request: " + strings.Join(parts, "; "),
+		Fields:  map[string]string(f),
+	}
+}
+
+// validateWorldCommand checks the shape of a normalized request before any
+// lookup. Existence and permission checks stay in the handlers.
+func validateWorldCommand(req WorldCommandRequest) fieldErrors {
+	f := fieldErrors{}
+	f.require("action", req.Action)
+	f.require("actor_uuid", req.ActorUUID)
+	switch req.Action {
+	case "create", "request_create", "instance_create", "instance_provision", "create_legacy":
+		if msg := worldAliasProblem(req.WorldAlias); msg != "" {
+			f["world_alias"] = msg
+		}
+	case "world_restore", "world_logs", "instance_purge", "instance_pin", "instance_unpin", "world_repair", "instance_validate",
+		"world_rotate_key", "world_compose", "world_timeline":
+		f.require("world_alias", req.WorldAlias)
+	case "request_resubmit":
+		f.require("request_id", req.RequestID)
+		if req.WorldAlias != "" {
+			if msg := worldAliasProblem(req.WorldAlias); msg != "" {
+				f["world_alias"] = msg
+			}
+		}
+	case "world_set_access":
+		f.require("world_alias", req.WorldAlias)
+		f.oneOf("access_mode", req.AccessMode, "public", "privacy")
+	case "instance_by_server":
+		f.require("server_id", req.ServerID)
+	case "request_list", "request_history":
+		if req.Status != "" {
+			f.oneOf("status", req.Status, "pending", "processing", "succeeded", "failed", "rejected", "canceled", "expired")
+		}
+		if req.PageSize > requestListMaxPageSize {
+			f["page_size"] = fmt.Sprintf("must be at most %d", requestListMaxPageSize)
+		}
+	case "player_set_role":
+		f.require("target_name", req.Target)
+		f.oneOf("role", req.Role, "user", "admin")
+	case "player_list":
+		if req.Role != "" {
+			f.oneOf("role", req.Role, "admin", "user")
+		}
+	case "world_set_version", "instance_set_version":
+		f.require("world_alias", req.WorldAlias)
+		f.require("game_version", req.GameVersion)
+	case "world_note":
+		f.require("world_alias", req.WorldAlias)
+		if msg := noteProblem(req.Note); msg != "" {
+			f["note"] = msg
+		}
+	case "world_set_name":
+		f.require("world_alias", req.WorldAlias)
+		if msg := displayNameProblem(req.DisplayName); msg != "" {
+			f["display_name"] = msg
+		}
+	case "instance_set_limits":
+		f.require("world_alias", req.WorldAlias)
+		if req.CPULimit == nil && req.MemLimitMB == nil {
+			f["cpu_limit"] = "set cpu_limit and/or mem_limit_mb"
+		}
+		// Written this way so NaN fails too.
+		if req.CPULimit != nil && !(*req.CPULimit >= 0 && *req.CPULimit <= maxCPULimit) {
+			f["cpu_limit"] = fmt.Sprintf("must be between 0 and %d", maxCPULimit)
+		}
+		if req.MemLimitMB != nil && (*req.MemLimitMB < 0 || *req.MemLimitMB > maxMemLimitMB || (*req.MemLimitMB > 0 && *req.MemLimitMB < minMemLimitMB)) {
+			f["mem_limit_mb"] = fmt.Sprintf("must be 0 or between %d and %d", minMemLimitMB, maxMemLimitMB)
+		}
+	case "world_set_properties":
+		f.require("world_alias", req.WorldAlias)
+		if req.Gamemode == "" && req.Difficulty == "" && req.MaxPlayers == 0 && req.MOTD == "" {
+			f["gamemode"] = "set at least one of gamemode, difficulty, max_players, motd"
+		}
+		if req.Gamemode != "" {
+			f.oneOf("gamemode", req.Gamemode, "survival", "creative", "adventure", "spectator")
+		}
+		if req.Difficulty != "" {
+			f.oneOf("difficulty", req.Difficulty, "peaceful", "easy", "normal", "hard")
+		}
+		if req.MaxPlayers < 0 || req.MaxPlayers > maxMaxPlayers {
+			f["max_players"] = fmt.Sprintf("must be between 1 and %d", maxMaxPlayers)
+		}
+		if msg := motdProblem(req.MOTD); msg != "" {
+			f["motd"] = msg
+		}
+	case "world_rename":
+		f.require("world_alias", req.WorldAlias)
+		if msg := worldAliasProblem(req.NewAlias); msg != "" {
+			f["new_alias"] = msg
+		}
+	case "member_add", "member_remove", "player_invite", "player_reject":
+		f.require("world_alias", req.WorldAlias)
+		f.playerName("target_name", req.Target)
+	case "world_transfer":
+		f.require("world_alias", req.WorldAlias)
+		f.playerName("target_name", req.Target)
+	case "member_set_role":
+		f.require("world_alias", req.WorldAlias)
+		f.playerName("target_name", req.Target)
+		f.oneOf("role", req.Role, memberRoleMember, memberRoleManager)
+	}
+	return f
+}
+
+const maxWorldAliasLen = 32
+
+// worldAliasProblem rejects characters that break world_list parsing
+// (`#id:alias:status`) or command tokenization.
+func worldAliasProblem(alias string) string {
+	if alias == "" {
+		return "required"
+	}
+	if utf8.RuneCountInString(alias) > maxWorldAliasLen {
+		return fmt.Sprintf("must be at most %d characters", maxWorldAliasLen)
+	}
+	if strings.ContainsAny(alias, ":,#") {
+		return "must not contain ':', ',' or '#'"
+	}
+	for _, r := range alias {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return "must not contain spaces or control characters"
+		}
+	}
+	return ""
+}
+
+func displayNameProblem(name string) string {
+	if name == "" {
+		return "required"
+	}
+	if utf8.RuneCountInString(name) > maxDisplayNameLen {
+		return fmt.Sprintf("must be at most %d characters", maxDisplayNameLen)
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return "must not contain control characters"
+		}
+		// world_list items are comma separated.
+		if r == ',' {
+			return "must not contain commas"
+		}
+	}
+	return ""
+}
+
+func noteProblem(note string) string {
+	if utf8.RuneCountInString(note) > maxNoteLen {
+		return fmt.Sprintf("must be at most %d characters", maxNoteLen)
+	}
+	for _, r := range note {
+		if unicode.IsControl(r) {
+			return "must not contain control characters"
+		}
+	}
+	return ""
+}
+
+// levelSeedProblem checks an optional seed; it ends up as a single
+// server.properties line.
+func levelSeedProblem(seed string) string {
+	if utf8.RuneCountInString(seed) > maxLevelSeedLen {
+		return fmt.Sprintf("must be at most %d characters", maxLevelSeedLen)
+	}
+	for _, r := range seed {
+		if unicode.IsControl(r) {
+			return "must not contain control characters"
+		}
+	}
+	return ""
+}
+
+// motdProblem checks an optional MOTD; like the seed it becomes a single
+// server.properties line.
+func motdProblem(motd string) string {
+	if utf8.RuneCountInString(motd) > maxMOTDLen {
+		return fmt.Sprintf("must be at most %d characters", maxMOTDLen)
+	}
+	for _, r := range motd {
+		if unicode.IsControl(r) {
+			return "must not contain control characters"
+		}
+	}
+	return ""
+}
+
+// displayName falls back to the alias for rows created before display_name existed.
+func displayName(inst pgsql.MapInstance) string {
+	if strings.TrimSpace(inst.DisplayName) != "" {
+		return inst.DisplayName
+	}
+	return inst.Alias
+}
+
+// aliasTaken is the conflict response for a taken alias. It suggests the
+// first free numbered variant (castle -> castle2, castle2 -> castle3) when
+// one can be found.
+func (s *ServiceI) aliasTaken(ctx context.Context, ownerName string, rawAlias string) (int, WorldCommandResponse) {
+	resp := WorldCommandResponse{Status: "error", Message: "world_alias already exists"}
+	base := strings.TrimRight(strings.TrimSpace(rawAlias), "0123456789")
+	if base == "" {
+		base = strings.TrimSpace(rawAlias)
+	}
+	taken, err := s.repos.MapInstance.ListAliasesWithPrefix(ctx, buildOwnedAlias(ownerName, base))
+	if err != nil {
+		s.logger.Warnf("alias suggestion lookup failed owner=%s alias=%s: %v", ownerName, rawAlias, err)
+		return http.StatusConflict, resp
+	}
+	if suggestion := suggestFreeAlias(ownerName, base, taken); suggestion != "" {
+		resp.Message += ", try " + suggestion
+	}
+	return http.StatusConflict, resp
+}
+
+// suggestFreeAlias returns the first base<N> (N from 2) whose owned alias is
+// not in taken and that passes alias validation; empty if none up to 99.
+func suggestFreeAlias(ownerName string, base string, taken []string) string {
+	used := make(map[string]struct{}, len(taken))
+	for _, a := range taken {
+		used[a] = struct{}{}
+	}
+	for n := 2; n < 100; n++ {
+		candidate := base + strconv.Itoa(n)
+		if worldAliasProblem(candidate) != "" {
+			return ""
+		}
+		if _, ok := used[buildOwnedAlias(ownerName, candidate)]; !ok {
+			return candidate
+		}
+	}
+	return ""
+}
+
 func buildOwnedAlias(ownerName string, rawAlias string) string {
 	owner := strings.TrimSpace(ownerName)
 	alias := strings.TrimSpace(rawAlias)
@@ -1262,35 +3847,22 @@ func (s *ServiceI) notifyLobbyAdminsRequestCreated(
 	worldAlias string,
 	templateName string,
 	requestNo int64,
-	requestID string,
-) error {
-	if s.lobbyTapURL == "" {
-		return nil
-	}
-	conn, err := servertap.NewConnectorWithAuth(s.lobbyTapURL, 5*time.Second, s.serverTapAuthName, s.serverTapKey)
-	if err != nil {
-		return err
-	}
-	admins, err := s.repos.User.ListByRole(ctx, "admin")
-	if err != nil {
-		return err
-	}
-	if len(admins) == 0 {
-		return nil
-	}
+) {
 	tpl := strings.TrimSpace(templateName)
 	if tpl == "" {
 		tpl = "empty"
 	}
 	msg := fmt.Sprintf("[MCMM] req#%d from %s world=%s template=%s", requestNo, actorName, worldAlias, tpl)
-	names := make([]string, 0, len(admins))
-	for _, a := range admins {
-		names = append(names, a.MCName)
-	}
-	if err := s.notifyPlayersViaLobbyTap(ctx, conn, names, msg); err != nil {
-		s.logger.Warnf("notify admins failed req=%d/%s err=%v", requestNo, requestID, err)
-	}
-	return nil
+	s.notifyEvent(ctx, NotifyTargets{Admins: true}, NotifyEvent{
+		Kind:    "request_created",
+		Message: msg,
+		Fields: map[string]string{
+			"request_no": strconv.FormatInt(requestNo, 10),
+			"actor":      actorName,
+			"world":      worldAlias,
+			"template":   tpl,
+		},
+	})
 }
 
 func (s *ServiceI) notifyApproveResult(
@@ -1302,26 +3874,10 @@ func (s *ServiceI) notifyApproveResult(
 	worldAlias string,
 	templateName string,
 ) {
-	if s.lobbyTapURL == "" {
-		return
-	}
-	conn, err := servertap.NewConnectorWithAuth(s.lobbyTapURL, 5*time.Second, s.serverTapAuthName, s.serverTapKey)
-	if err != nil {
-		return
-	}
-	admins, err := s.repos.User.ListByRole(ctx, "admin")
-	if err != nil {
-		return
-	}
-	names := make([]string, 0, len(admins)+1)
-	for _, a := range admins {
-		names = append(names, a.MCName)
-	}
-	if owner, err := s.repos.User.Read(ctx, ur.ActorUserID); err == nil {
-		names = append(names, owner.MCName)
-	}
 	msg := ""
+	kind := "request_failed"
 	if success {
+		kind = "request_approved"
 		msg = fmt.Sprintf(
 			"[MCMM] req#%d approved. world=%s template=%s instance=%d. Use /mcmm world #%d:%s to join",
 			ur.ID,
@@ -1334,34 +3890,139 @@ func (s *ServiceI) notifyApproveResult(
 	} else {
 		msg = fmt.Sprintf("[MCMM] req#%d failed: %s", ur.ID, reason)
 	}
-	_ = s.notifyPlayersViaLobbyTap(ctx, conn, names, msg)
+	fields := map[string]string{
+		"request_no": strconv.FormatInt(ur.ID, 10),
+		"world":      worldAlias,
+		"template":   templateName,
+	}
+	if instanceID > 0 {
+		fields["instance_id"] = strconv.FormatInt(instanceID, 10)
+	}
+	if reason != "" {
+		fields["reason"] = reason
+	}
+	s.notifyEvent(ctx, NotifyTargets{UserIDs: []int64{ur.ActorUserID}, Admins: true}, NotifyEvent{Kind: kind, Message: msg, Fields: fields})
+}
+
+// NotifyTargets selects the recipients of a lobby notification. Users are
+// looked up by id; Admins adds every server admin.
+type NotifyTargets struct {
+	UserIDs []int64
+	Names   []string
+	Admins  bool
+}
+
+// Notify is notifyTargets for callers outside cmdreceiver, e.g. cron jobs.
+func (s *ServiceI) Notify(ctx context.Context, targets NotifyTargets, msg string) {
+	s.notifyTargets(ctx, targets, msg)
+}
+
+// notifyTargets tells msg to each target once (names compare case-insensitively)
+// through the lobby ServerTap. Delivery is best-effort: lookup and send failures
+// are logged and skipped. Does nothing when no lobby tap is configured.
+func (s *ServiceI) notifyTargets(ctx context.Context, targets NotifyTargets, msg string) {
+	s.deliver(ctx, targets, NotifyEvent{Kind: "message", Message: msg}, false)
+}
+
+// notifyEvent is notifyTargets for auditable events, which also go to the
+// webhook when one is configured.
+func (s *ServiceI) notifyEvent(ctx context.Context, targets NotifyTargets, ev NotifyEvent) {
+	s.deliver(ctx, targets, ev, true)
+}
+
+func (s *ServiceI) deliver(ctx context.Context, targets NotifyTargets, ev NotifyEvent, audit bool) {
+	toWebhook := audit && s.webhook != nil
+	toLobby := s.lobbyTapURL != "" && !(toWebhook && s.webhookOnly)
+	if !toLobby && !toWebhook {
+		return
+	}
+	ev.Recipients = s.resolveNotifyNames(ctx, targets)
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	if toLobby && len(ev.Recipients) > 0 {
+		if err := s.tapNotifier.Notify(ctx, ev); err != nil {
+			s.logger.Warnf("lobby notify incomplete kind=%s: %v", ev.Kind, err)
+		}
+	}
+	if toWebhook {
+		if err := s.webhook.Notify(ctx, ev); err != nil {
+			s.logger.Warnf("webhook notify failed kind=%s: %v", ev.Kind, err)
+		}
+	}
 }
 
-func (s *ServiceI) notifyPlayersViaLobbyTap(ctx context.Context, conn *servertap.Connector, names []string, msg string) error {
-	sent := map[string]struct{}{}
-	for _, raw := range names {
+func (s *ServiceI) resolveNotifyNames(ctx context.Context, targets NotifyTargets) []string {
+	seen := map[string]struct{}{}
+	names := make([]string, 0, len(targets.UserIDs)+len(targets.Names))
+	add := func(raw string) {
 		name := strings.TrimSpace(raw)
 		if name == "" {
-			continue
+			return
 		}
 		key := strings.ToLower(name)
-		if _, ok := sent[key]; ok {
-			continue
+		if _, ok := seen[key]; ok {
+			return
 		}
-		cmd := servertap.NewCommandBuilder("tell").Arg(name).RawArg(msg).Build()
-		if _, err := conn.Execute(ctx, servertap.ExecuteRequest{Command: cmd}); err != nil {
-			s.logger.Warnf("notify player failed player=%s err=%v", name, err)
-			continue
+		seen[key] = struct{}{}
+		names = append(names, name)
+	}
+	ids := make([]int64, 0, len(targets.UserIDs))
+	for _, id := range targets.UserIDs {
+		if id > 0 {
+			ids = append(ids, id)
 		}
-		sent[key] = struct{}{}
 	}
-	return nil
+	users, err := s.repos.User.ReadByIDs(ctx, ids)
+	if err != nil {
+		s.logger.Warnf("notify: resolve users failed: %v", err)
+	}
+	for _, id := range ids {
+		if u, ok := users[id]; ok {
+			add(u.MCName)
+		}
+	}
+	for _, n := range targets.Names {
+		add(n)
+	}
+	if targets.Admins {
+		admins, err := s.repos.User.ListByRole(ctx, "admin")
+		if err != nil {
+			s.logger.Warnf("notify: list admins failed: %v", err)
+		}
+		for _, a := range admins {
+			add(a.MCName)
+		}
+	}
+	return names
+}
+
+// lobbyConnector returns the shared lobby ServerTap connector, creating it on first use.
+func (s *ServiceI) lobbyConnector() (*servertap.Connector, error) {
+	s.lobbyConnMu.Lock()
+	defer s.lobbyConnMu.Unlock()
+	if s.lobbyConn != nil {
+		return s.lobbyConn, nil
+	}
+	authName, key := s.serverTapAuth()
+	conn, err := servertap.NewConnectorWithOptions(s.lobbyTapURL, servertap.ConnectorOptions{
+		Timeout:    5 * time.Second,
+		AuthHeader: authName,
+		AuthKey:    key,
+		TLS:        s.serverTapTLS,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.lobbyConn = conn
+	return conn, nil
 }
 
 func (s *ServiceI) sendPlayerToInstance(ctx context.Context, playerName string, instanceID int64) error {
-	serverID := fmt.Sprintf("mcmm-inst-%d", instanceID)
+	serverID := worker.ServerID(s.serverIDPrefix, instanceID)
 	if s.proxyBridgeURL != "" {
-		if err := s.proxyRegister(ctx, serverID, serverID, 25565); err != nil {
+		host := worker.ServerID(worker.DefaultServerIDPrefix, instanceID)
+		if err := s.proxyRegister(ctx, serverID, host, 25565); err != nil {
 			return fmt.Errorf("proxy register failed: %w", err)
 		}
 		return s.sendPlayerToServer(ctx, playerName, serverID)
@@ -1370,11 +4031,14 @@ func (s *ServiceI) sendPlayerToInstance(ctx context.Context, playerName string,
 	if s.lobbyTapURL == "" {
 		return fmt.Errorf("lobby servertap not configured")
 	}
-	conn, err := servertap.NewConnectorWithAuth(s.lobbyTapURL, 5*time.Second, s.serverTapAuthName, s.serverTapKey)
+	conn, err := s.lobbyConnector()
+	if err != nil {
+		return err
+	}
+	cmd, err := servertap.NewCommandBuilder("send").PlayerArg(playerName).Arg(serverID).BuildChecked()
 	if err != nil {
 		return err
 	}
-	cmd := servertap.NewCommandBuilder("send").Arg(playerName).Arg(serverID).Build()
 	_, err = conn.Execute(ctx, servertap.ExecuteRequest{Command: cmd})
 	return err
 }
@@ -1390,25 +4054,36 @@ func (s *ServiceI) sendPlayerToServer(ctx context.Context, playerName, serverID
 }
 
 func (s *ServiceI) updateInstanceWhitelist(ctx context.Context, instanceID int64, playerName string, add bool) error {
-	if strings.TrimSpace(s.instanceTapPattern) == "" {
-		return nil
+	verb := "remove"
+	if add {
+		verb = "add"
 	}
 	inst, err := s.repos.MapInstance.Read(ctx, instanceID)
 	if err != nil {
 		return err
 	}
-	// If container is not online, DB membership is enough; whitelist will be synced on next start.
+	// The server is not up to take the change; queue it for the next start,
+	// where the worker replays it after its access sync.
 	if inst.Status != string(worker.StatusOn) {
+		if s.repos.PendingWhitelist == nil {
+			return nil
+		}
+		err := s.repos.PendingWhitelist.Enqueue(ctx, pgsql.PendingWhitelistOp{InstanceID: instanceID, PlayerName: playerName, Action: verb})
+		if err != nil {
+			s.logger.Warnf("whitelist queue failed instance=%d action=%s player=%s err=%v", instanceID, verb, playerName, err)
+		}
+		return err
+	}
+	if strings.TrimSpace(s.instanceTapPattern) == "" {
 		return nil
 	}
-	tapURL := fmt.Sprintf(s.instanceTapPattern, instanceID)
-	conn, err := servertap.NewConnectorWithAuth(tapURL, 5*time.Second, s.serverTapAuthName, s.serverTapKey)
+	conn, err := s.instanceConnector(inst)
 	if err != nil {
 		return err
 	}
-	cmd := "whitelist remove " + playerName
-	if add {
-		cmd = "whitelist add " + playerName
+	cmd, err := servertap.NewCommandBuilder("whitelist").RawArg(verb).PlayerArg(playerName).BuildChecked()
+	if err != nil {
+		return err
 	}
 	_, err = conn.Execute(ctx, servertap.ExecuteRequest{Command: cmd})
 	if err != nil {
@@ -1417,8 +4092,35 @@ func (s *ServiceI) updateInstanceWhitelist(ctx context.Context, instanceID int64
 	return err
 }
 
-func (s *ServiceI) kickNonAdminPlayers(ctx context.Context, instanceID int64) error {
-	serverID := fmt.Sprintf("mcmm-inst-%d", instanceID)
+// deopOnInstance takes playerName's op away on a running instance. An
+// instance that is not On needs nothing: its access sync on start deops every
+// plain member.
+func (s *ServiceI) deopOnInstance(ctx context.Context, inst pgsql.MapInstance, playerName string) error {
+	if inst.Status != string(worker.StatusOn) || strings.TrimSpace(s.instanceTapPattern) == "" {
+		return nil
+	}
+	conn, err := s.instanceConnector(inst)
+	if err != nil {
+		return err
+	}
+	cmd, err := servertap.NewCommandBuilder("deop").PlayerArg(playerName).BuildChecked()
+	if err != nil {
+		return err
+	}
+	if _, err = conn.Execute(ctx, servertap.ExecuteRequest{Command: cmd}); err != nil {
+		s.logger.Warnf("deop failed instance=%d player=%s err=%v", inst.ID, playerName, err)
+	}
+	return err
+}
+
+func (s *ServiceI) kickNonAdminPlayers(ctx context.Context, inst pgsql.MapInstance) error {
+	instanceID := inst.ID
+	reason := servertap.FormatMessage(s.lockdownKickMsg, map[string]string{
+		"world": inst.Alias,
+		"name":  displayName(inst),
+		"id":    strconv.FormatInt(inst.ID, 10),
+	})
+	serverID := worker.ServerID(s.serverIDPrefix, instanceID)
 	if s.proxyBridgeURL != "" {
 		players, err := s.proxyListPlayersByServer(ctx, serverID)
 		if err == nil && len(players) > 0 {
@@ -1431,6 +4133,7 @@ func (s *ServiceI) kickNonAdminPlayers(ctx context.Context, instanceID int64) er
 					s.logger.Warnf("lockdown move to lobby failed instance=%d player=%s err=%v", instanceID, p, err)
 				} else {
 					s.logger.Infof("instance=%d moved player=%s to lobby due to lockdown", instanceID, p)
+					s.notifyTargets(ctx, NotifyTargets{Names: []string{p}}, "[MCMM] "+reason)
 				}
 			}
 			return nil
@@ -1443,8 +4146,7 @@ func (s *ServiceI) kickNonAdminPlayers(ctx context.Context, instanceID int64) er
 	if strings.TrimSpace(s.instanceTapPattern) == "" {
 		return nil
 	}
-	tapURL := fmt.Sprintf(s.instanceTapPattern, instanceID)
-	conn, err := servertap.NewConnectorWithAuth(tapURL, 5*time.Second, s.serverTapAuthName, s.serverTapKey)
+	conn, err := s.instanceConnector(inst)
 	if err != nil {
 		return err
 	}
@@ -1452,13 +4154,21 @@ func (s *ServiceI) kickNonAdminPlayers(ctx context.Context, instanceID int64) er
 	if err != nil {
 		return err
 	}
-	players := parseOnlinePlayers(resp.RawBody)
-	for _, p := range players {
+	list, err := servertap.ParsePlayerList(resp)
+	if err != nil {
+		s.logger.Warnf("parse player list failed instance=%d err=%v", instanceID, err)
+		return nil
+	}
+	for _, p := range list.Names {
 		u, err := s.repos.User.ReadByName(ctx, p)
 		if err == nil && strings.EqualFold(u.ServerRole, "admin") {
 			continue
 		}
-		cmd := servertap.NewCommandBuilder("kick").Arg(p).RawArg("Server is in lockdown").Build()
+		cmd, err := servertap.NewCommandBuilder("kick").PlayerArg(p).RawArg(reason).BuildChecked()
+		if err != nil {
+			s.logger.Warnf("kick skipped instance=%d: %v", instanceID, err)
+			continue
+		}
 		if _, err := conn.Execute(ctx, servertap.ExecuteRequest{Command: cmd}); err != nil {
 			s.logger.Warnf("kick failed instance=%d player=%s err=%v", instanceID, p, err)
 		} else {
@@ -1496,30 +4206,6 @@ func (s *ServiceI) proxyListPlayersByServer(ctx context.Context, serverID string
 	return parsed.Players, nil
 }
 
-func parseOnlinePlayers(raw string) []string {
-	body := strings.TrimSpace(raw)
-	if body == "" {
-		return nil
-	}
-	m := onlineListRegex.FindStringSubmatch(body)
-	if len(m) != 2 {
-		return nil
-	}
-	seg := strings.TrimSpace(m[1])
-	if seg == "" {
-		return nil
-	}
-	parts := strings.Split(seg, ",")
-	out := make([]string, 0, len(parts))
-	for _, part := range parts {
-		name := strings.TrimSpace(part)
-		if name != "" {
-			out = append(out, name)
-		}
-	}
-	return out
-}
-
 func (s *ServiceI) proxyRegister(ctx context.Context, serverID, host string, port int) error {
 	values := url.Values{}
 	values.Set("server_id", serverID)
@@ -2,21 +2,39 @@ package cmdreceiver
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"mcmm/internal/metrics"
+	"mcmm/internal/pgsql"
+	"mcmm/internal/servertap"
+	"mcmm/internal/worker"
+
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 type serviceMock struct {
 	status int
 	resp   WorldCommandResponse
 	called bool
+	req    WorldCommandRequest
 }
 
 func (m *serviceMock) HandleWorldCommand(ctx context.Context, req WorldCommandRequest) (int, WorldCommandResponse) {
 	m.called = true
+	m.req = req
 	if m.status == 0 {
 		m.status = http.StatusOK
 	}
@@ -72,3 +90,2723 @@ func TestHandleWorldCommand_PostSuccess(t *testing.T) {
 		t.Fatalf("service should be called")
 	}
 }
+
+func TestHandleWorldCommand_JSONBodyMatchesForm(t *testing.T) {
+	post := func(body, contentType string) (*serviceMock, *httptest.ResponseRecorder) {
+		sm := &serviceMock{}
+		mux := http.NewServeMux()
+		NewHandlerI(sm).Register(mux)
+		req := httptest.NewRequest(http.MethodPost, "/v1/cmd/world", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return sm, rec
+	}
+
+	form := url.Values{}
+	form.Set("action", " world_member_add ")
+	form.Set("actor_uuid", "uuid-alice")
+	form.Set("actor_name", "alice")
+	form.Set("world_alias", "castle")
+	form.Set("target_name", " bob")
+	form.Set("force", "true")
+	form.Set("page", "2")
+	fromForm, rec := post(form.Encode(), "application/x-www-form-urlencoded")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("form post failed: %d %s", rec.Code, rec.Body.String())
+	}
+	fromJSON, rec := post(`{"action":" world_member_add ","actor_uuid":"uuid-alice","actor_name":"alice",`+
+		`"world_alias":"castle","target_name":" bob","force":true,"page":2}`, "application/json; charset=utf-8")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("json post failed: %d %s", rec.Code, rec.Body.String())
+	}
+	if fromJSON.req != fromForm.req {
+		t.Fatalf("json and form should decode alike:\njson=%+v\nform=%+v", fromJSON.req, fromForm.req)
+	}
+	if fromJSON.req.Action != "world_member_add" || fromJSON.req.Target != "bob" {
+		t.Fatalf("json fields should be trimmed: %+v", fromJSON.req)
+	}
+
+	sm, rec := post(`{"action":`, "application/json")
+	if rec.Code != http.StatusBadRequest || sm.called {
+		t.Fatalf("malformed json should be 400 without a service call, got %d", rec.Code)
+	}
+	sm, rec = post(`{"action":"request_list","page":-1}`, "application/json")
+	if rec.Code != http.StatusBadRequest || sm.called || !strings.Contains(rec.Body.String(), `"page":"must be a positive integer"`) {
+		t.Fatalf("negative page should be a field error, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+type userRepoMock struct {
+	pgsql.UserRepo
+	users map[int64]pgsql.User
+}
+
+func (m *userRepoMock) ReadByUUID(ctx context.Context, mcUUID string) (pgsql.User, error) {
+	for _, u := range m.users {
+		if u.MCUUID == mcUUID {
+			return u, nil
+		}
+	}
+	return pgsql.User{}, sql.ErrNoRows
+}
+
+func (m *userRepoMock) ReadByName(ctx context.Context, mcName string) (pgsql.User, error) {
+	for _, u := range m.users {
+		if strings.EqualFold(u.MCName, mcName) {
+			return u, nil
+		}
+	}
+	return pgsql.User{}, sql.ErrNoRows
+}
+
+func (m *userRepoMock) ListByRole(ctx context.Context, role string) ([]pgsql.User, error) {
+	out := make([]pgsql.User, 0)
+	for id := int64(1); id <= int64(len(m.users)); id++ {
+		if u, ok := m.users[id]; ok && u.ServerRole == role {
+			out = append(out, u)
+		}
+	}
+	return out, nil
+}
+
+func (m *userRepoMock) ReadByIDs(ctx context.Context, ids []int64) (map[int64]pgsql.User, error) {
+	out := make(map[int64]pgsql.User, len(ids))
+	for _, id := range ids {
+		if u, ok := m.users[id]; ok {
+			out[id] = u
+		}
+	}
+	return out, nil
+}
+
+func (m *userRepoMock) List(ctx context.Context, limit int, offset int) ([]pgsql.User, error) {
+	out := make([]pgsql.User, 0)
+	for id := int64(offset + 1); id <= int64(len(m.users)) && len(out) < limit; id++ {
+		if u, ok := m.users[id]; ok {
+			out = append(out, u)
+		}
+	}
+	return out, nil
+}
+
+func (m *userRepoMock) Count(ctx context.Context) (int64, error) {
+	return int64(len(m.users)), nil
+}
+
+func (m *userRepoMock) Read(ctx context.Context, id int64) (pgsql.User, error) {
+	if u, ok := m.users[id]; ok {
+		return u, nil
+	}
+	return pgsql.User{}, sql.ErrNoRows
+}
+
+func (m *userRepoMock) Create(ctx context.Context, u pgsql.User) (int64, error) {
+	u.ID = int64(len(m.users) + 1)
+	m.users[u.ID] = u
+	return u.ID, nil
+}
+
+func (m *userRepoMock) Upsert(ctx context.Context, mcUUID string, mcName string) (pgsql.User, bool, error) {
+	if u, err := m.ReadByUUID(ctx, mcUUID); err == nil {
+		u.MCName = mcName
+		m.users[u.ID] = u
+		return u, false, nil
+	}
+	u := pgsql.User{ID: int64(len(m.users) + 1), MCUUID: mcUUID, MCName: mcName, ServerRole: "user"}
+	m.users[u.ID] = u
+	return u, true, nil
+}
+
+func (m *userRepoMock) Update(ctx context.Context, u pgsql.User) error {
+	if _, ok := m.users[u.ID]; !ok {
+		return sql.ErrNoRows
+	}
+	m.users[u.ID] = u
+	return nil
+}
+
+type mapInstanceRepoMock struct {
+	pgsql.MapInstanceRepo
+	instances map[int64]pgsql.MapInstance
+	// members backs ListForUser; nil means no member rows.
+	members *instanceMemberRepoMock
+}
+
+func (m *mapInstanceRepoMock) Read(ctx context.Context, id int64) (pgsql.MapInstance, error) {
+	if inst, ok := m.instances[id]; ok {
+		return inst, nil
+	}
+	return pgsql.MapInstance{}, sql.ErrNoRows
+}
+
+func (m *mapInstanceRepoMock) ReadByAlias(ctx context.Context, alias string) (pgsql.MapInstance, error) {
+	for _, inst := range m.instances {
+		if inst.Alias == alias {
+			return inst, nil
+		}
+	}
+	return pgsql.MapInstance{}, sql.ErrNoRows
+}
+
+func (m *mapInstanceRepoMock) ListAliasesWithPrefix(ctx context.Context, prefix string) ([]string, error) {
+	out := make([]string, 0)
+	for _, inst := range m.instances {
+		if strings.HasPrefix(inst.Alias, prefix) {
+			out = append(out, inst.Alias)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func (m *mapInstanceRepoMock) List(ctx context.Context) ([]pgsql.MapInstance, error) {
+	out := make([]pgsql.MapInstance, 0, len(m.instances))
+	for _, inst := range m.instances {
+		out = append(out, inst)
+	}
+	return out, nil
+}
+
+func (m *mapInstanceRepoMock) ListByOwner(ctx context.Context, ownerID int64) ([]pgsql.MapInstance, error) {
+	out := make([]pgsql.MapInstance, 0)
+	for _, inst := range m.instances {
+		if inst.OwnerID == ownerID {
+			out = append(out, inst)
+		}
+	}
+	return out, nil
+}
+
+func (m *mapInstanceRepoMock) ListForUser(ctx context.Context, userID int64, includeArchived bool) ([]pgsql.UserInstance, error) {
+	out := make([]pgsql.UserInstance, 0)
+	for _, inst := range m.instances {
+		if inst.Status == "Archived" && !includeArchived {
+			continue
+		}
+		ui := pgsql.UserInstance{MapInstance: inst}
+		member := inst.OwnerID == userID
+		if m.members != nil {
+			for _, mem := range m.members.members {
+				if mem.InstanceID != inst.ID {
+					continue
+				}
+				if mem.UserID == userID {
+					ui.Role = mem.Role
+					member = true
+				}
+				if mem.Role != "owner" {
+					ui.MemberCount++
+				}
+			}
+		}
+		if member {
+			out = append(out, ui)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (m *mapInstanceRepoMock) Create(ctx context.Context, inst pgsql.MapInstance) (int64, error) {
+	inst.ID = int64(len(m.instances) + 100)
+	m.instances[inst.ID] = inst
+	return inst.ID, nil
+}
+
+func (m *mapInstanceRepoMock) Update(ctx context.Context, inst pgsql.MapInstance) error {
+	m.instances[inst.ID] = inst
+	return nil
+}
+
+type instanceMemberRepoMock struct {
+	pgsql.InstanceMemberRepo
+	members []pgsql.InstanceMember
+	// users backs ListWithUsers; nil joins nothing.
+	users *userRepoMock
+}
+
+func (m *instanceMemberRepoMock) ListWithUsers(ctx context.Context, instanceID int64) ([]pgsql.MemberWithUser, error) {
+	out := make([]pgsql.MemberWithUser, 0)
+	if m.users == nil {
+		return out, nil
+	}
+	for _, mem := range m.members {
+		u, ok := m.users.users[mem.UserID]
+		if mem.InstanceID != instanceID || !ok {
+			continue
+		}
+		out = append(out, pgsql.MemberWithUser{InstanceMember: mem, MCUUID: u.MCUUID, MCName: u.MCName, ServerRole: u.ServerRole})
+	}
+	return out, nil
+}
+
+func (m *instanceMemberRepoMock) ListByInstance(ctx context.Context, instanceID int64) ([]pgsql.InstanceMember, error) {
+	out := make([]pgsql.InstanceMember, 0)
+	for _, mem := range m.members {
+		if mem.InstanceID == instanceID {
+			out = append(out, mem)
+		}
+	}
+	return out, nil
+}
+
+func (m *instanceMemberRepoMock) Create(ctx context.Context, member pgsql.InstanceMember) (int64, error) {
+	member.ID = int64(len(m.members) + 100)
+	m.members = append(m.members, member)
+	return member.ID, nil
+}
+
+func (m *instanceMemberRepoMock) Update(ctx context.Context, member pgsql.InstanceMember) error {
+	for i := range m.members {
+		if m.members[i].ID == member.ID {
+			m.members[i] = member
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *instanceMemberRepoMock) ListByUser(ctx context.Context, userID int64) ([]pgsql.InstanceMember, error) {
+	out := make([]pgsql.InstanceMember, 0)
+	for _, mem := range m.members {
+		if mem.UserID == userID {
+			out = append(out, mem)
+		}
+	}
+	return out, nil
+}
+
+func (m *instanceMemberRepoMock) DeleteByInstanceAndUser(ctx context.Context, instanceID int64, userID int64) error {
+	m.members = slices.DeleteFunc(m.members, func(mem pgsql.InstanceMember) bool {
+		return mem.InstanceID == instanceID && mem.UserID == userID
+	})
+	return nil
+}
+
+type pendingWhitelistRepoMock struct {
+	pgsql.PendingWhitelistRepo
+	ops []pgsql.PendingWhitelistOp
+}
+
+func (m *pendingWhitelistRepoMock) Enqueue(ctx context.Context, op pgsql.PendingWhitelistOp) error {
+	m.ops = append(m.ops, op)
+	return nil
+}
+
+func newDisplayNameFixture() (*ServiceI, *mapInstanceRepoMock) {
+	svc, instances, _ := newWorldFixture()
+	return svc, instances
+}
+
+func newWorldFixture() (*ServiceI, *mapInstanceRepoMock, *instanceMemberRepoMock) {
+	users := &userRepoMock{users: map[int64]pgsql.User{
+		1: {ID: 1, MCUUID: "uuid-alice", MCName: "alice", ServerRole: "user"},
+		2: {ID: 2, MCUUID: "uuid-bob", MCName: "bob", ServerRole: "user"},
+		3: {ID: 3, MCUUID: "uuid-carol", MCName: "carol", ServerRole: "user"},
+	}}
+	instances := &mapInstanceRepoMock{instances: map[int64]pgsql.MapInstance{
+		5: {ID: 5, Alias: "alice_castle", DisplayName: "castle", OwnerID: 1, Status: "On", AccessMode: "privacy"},
+	}}
+	members := &instanceMemberRepoMock{members: []pgsql.InstanceMember{
+		{ID: 10, InstanceID: 5, UserID: 1, Role: "owner"},
+		{ID: 11, InstanceID: 5, UserID: 2, Role: "member"},
+	}, users: users}
+	instances.members = members
+	repos := pgsql.Repos{User: users, MapInstance: instances, InstanceMember: members}
+	return NewServiceI(repos, nil, "", "", "", "", "", "", "", ""), instances, members
+}
+
+func TestWorldSetName_DisplayNameDiffersFromAlias(t *testing.T) {
+	svc, instances := newDisplayNameFixture()
+	ctx := context.Background()
+
+	status, resp := svc.HandleWorldCommand(ctx, WorldCommandRequest{
+		Action:      "world_set_name",
+		ActorUUID:   "uuid-alice",
+		ActorName:   "alice",
+		WorldAlias:  "#5",
+		DisplayName: "Castle Of Glass",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("set name failed: status=%d msg=%s", status, resp.Message)
+	}
+	inst := instances.instances[5]
+	if inst.DisplayName != "Castle Of Glass" || inst.Alias != "alice_castle" {
+		t.Fatalf("unexpected instance after rename: %+v", inst)
+	}
+
+	_, resp = svc.HandleWorldCommand(ctx, WorldCommandRequest{Action: "world_info", ActorUUID: "uuid-alice", ActorName: "alice", WorldAlias: "alice_castle"})
+	if !strings.Contains(resp.Message, "name=Castle Of Glass") || !strings.Contains(resp.Message, "alias=alice_castle") {
+		t.Fatalf("world_info should show both name and alias: %s", resp.Message)
+	}
+	if !strings.Contains(resp.Message, "members=2 [alice,bob]") {
+		t.Fatalf("world_info should list member names: %s", resp.Message)
+	}
+
+	_, resp = svc.HandleWorldCommand(ctx, WorldCommandRequest{Action: "world_list", ActorUUID: "uuid-alice", ActorName: "alice"})
+	if resp.Message != "#5:alice_castle:On(owner) name=Castle Of Glass" {
+		t.Fatalf("unexpected world_list: %s", resp.Message)
+	}
+}
+
+func TestWorldSetName_RejectsNonOwnerAndBadNames(t *testing.T) {
+	svc, instances := newDisplayNameFixture()
+	ctx := context.Background()
+
+	status, _ := svc.HandleWorldCommand(ctx, WorldCommandRequest{Action: "world_set_name", ActorUUID: "uuid-bob", ActorName: "bob", WorldAlias: "#5", DisplayName: "mine"})
+	if status != http.StatusForbidden {
+		t.Fatalf("non-owner rename should be forbidden, got=%d", status)
+	}
+	status, _ = svc.HandleWorldCommand(ctx, WorldCommandRequest{Action: "world_set_name", ActorUUID: "uuid-alice", ActorName: "alice", WorldAlias: "#5", DisplayName: "a, b"})
+	if status != http.StatusBadRequest {
+		t.Fatalf("comma in display name should be rejected, got=%d", status)
+	}
+	if instances.instances[5].DisplayName != "castle" {
+		t.Fatalf("display name should be unchanged: %+v", instances.instances[5])
+	}
+}
+
+func TestWorldSetProperties_StoresSetFieldsForOwner(t *testing.T) {
+	svc, instances, _ := newWorldFixture()
+	inst := instances.instances[5]
+	inst.Difficulty = "hard"
+	instances.instances[5] = inst
+	set := func(uuid, name string, req WorldCommandRequest) (int, WorldCommandResponse) {
+		req.Action, req.ActorUUID, req.ActorName, req.WorldAlias = "world_set_properties", uuid, name, "alice_castle"
+		return svc.HandleWorldCommand(context.Background(), req)
+	}
+
+	if status, _ := set("uuid-bob", "bob", WorldCommandRequest{Gamemode: "creative"}); status != http.StatusForbidden {
+		t.Fatalf("a plain member cannot change properties, got %d", status)
+	}
+	status, resp := set("uuid-alice", "alice", WorldCommandRequest{Gamemode: "god", MaxPlayers: 5000, MOTD: "a\nb"})
+	if status != http.StatusBadRequest || resp.Fields["gamemode"] == "" || resp.Fields["max_players"] == "" || resp.Fields["motd"] == "" {
+		t.Fatalf("invalid values should be rejected per field: %d %+v", status, resp)
+	}
+	if status, resp := set("uuid-alice", "alice", WorldCommandRequest{}); status != http.StatusBadRequest {
+		t.Fatalf("a request setting nothing should be rejected: %d %+v", status, resp)
+	}
+
+	status, resp = set("uuid-alice", "alice", WorldCommandRequest{Gamemode: "Creative", MaxPlayers: 8, MOTD: "Alice's castle"})
+	if status != http.StatusOK {
+		t.Fatalf("owner should set properties: %d %s", status, resp.Message)
+	}
+	got := instances.instances[5]
+	if got.Gamemode != "creative" || got.Difficulty != "hard" || got.MaxPlayers != 8 || got.MOTD != "Alice's castle" {
+		t.Fatalf("only the set fields should change: %+v", got)
+	}
+	if !strings.Contains(resp.Message, "difficulty=hard") || !strings.HasSuffix(resp.Message, "applied on next start") {
+		t.Fatalf("reply should list the stored values and when they apply: %s", resp.Message)
+	}
+}
+
+func TestInstanceSetLimits_OpOnlyAndKeepsUnsetLimit(t *testing.T) {
+	svc, instances, _ := newWorldFixture()
+	svc.repos.User.(*userRepoMock).users[9] = pgsql.User{ID: 9, MCUUID: "uuid-op", MCName: "op", ServerRole: "admin"}
+	inst := instances.instances[5]
+	inst.CPULimit = 1.5
+	instances.instances[5] = inst
+	cpu := func(v float64) *float64 { return &v }
+	mem := func(v int) *int { return &v }
+	set := func(uuid, name string, cpuLimit *float64, memLimit *int) (int, WorldCommandResponse) {
+		return svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+			Action: "instance_set_limits", ActorUUID: uuid, ActorName: name, WorldAlias: "alice_castle",
+			CPULimit: cpuLimit, MemLimitMB: memLimit,
+		})
+	}
+
+	if status, _ := set("uuid-alice", "alice", nil, mem(2048)); status != http.StatusForbidden {
+		t.Fatalf("owners cannot change limits, got %d", status)
+	}
+	status, resp := set("uuid-op", "op", cpu(-1), mem(100))
+	if status != http.StatusBadRequest || resp.Fields["cpu_limit"] == "" || resp.Fields["mem_limit_mb"] == "" {
+		t.Fatalf("out of range limits should be rejected: %d %+v", status, resp)
+	}
+	if status, _ := set("uuid-op", "op", nil, nil); status != http.StatusBadRequest {
+		t.Fatalf("a request setting nothing should be rejected, got %d", status)
+	}
+
+	status, resp = set("uuid-op", "op", nil, mem(4096))
+	if status != http.StatusOK || resp.Message != "instance limits saved: #5:alice_castle cpu_limit=1.5 mem_limit_mb=4096, applied on next start" {
+		t.Fatalf("unexpected reply: %d %s", status, resp.Message)
+	}
+	if got := instances.instances[5]; got.CPULimit != 1.5 || got.MemLimitMB != 4096 {
+		t.Fatalf("only mem_limit_mb should change: %+v", got)
+	}
+	status, resp = set("uuid-op", "op", cpu(0), nil)
+	if status != http.StatusOK || !strings.Contains(resp.Message, "cpu_limit=default") || instances.instances[5].CPULimit != 0 {
+		t.Fatalf("zero should go back to the default: %d %s", status, resp.Message)
+	}
+}
+
+func TestActionCooldown_RejectsRapidRepeats(t *testing.T) {
+	now := time.Date(2026, 2, 13, 12, 0, 0, 0, time.UTC)
+	c := newActionCooldown(3*time.Second, func() time.Time { return now })
+
+	if _, ok := c.allow("uuid-a", "world_on"); !ok {
+		t.Fatalf("first call should pass")
+	}
+	wait, ok := c.allow("uuid-a", "world_on")
+	if ok || wait != 3*time.Second {
+		t.Fatalf("immediate repeat should be throttled, ok=%v wait=%s", ok, wait)
+	}
+	if _, ok := c.allow("uuid-a", "world_off"); !ok {
+		t.Fatalf("different action should pass")
+	}
+	if _, ok := c.allow("uuid-b", "world_on"); !ok {
+		t.Fatalf("different actor should pass")
+	}
+
+	now = now.Add(2 * time.Second)
+	if wait, ok := c.allow("uuid-a", "world_on"); ok || wait != time.Second {
+		t.Fatalf("repeat within window should be throttled, ok=%v wait=%s", ok, wait)
+	}
+	now = now.Add(time.Second)
+	if _, ok := c.allow("uuid-a", "world_on"); !ok {
+		t.Fatalf("call after window should pass")
+	}
+
+	now = now.Add(10 * time.Second)
+	c.allow("uuid-c", "world_on")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.last) != 1 {
+		t.Fatalf("expired entries should be pruned, left=%d", len(c.last))
+	}
+}
+
+func TestActionCooldown_ConcurrentCallsAllowOnlyOne(t *testing.T) {
+	c := newActionCooldown(time.Minute, time.Now)
+	var passed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := c.allow("uuid-a", "world_off"); ok {
+				passed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if passed.Load() != 1 {
+		t.Fatalf("expected exactly one call to pass, got=%d", passed.Load())
+	}
+}
+
+func TestHandleWorldCommand_CooldownReturns429(t *testing.T) {
+	svc, _ := newDisplayNameFixture()
+	svc.worker = &failingStopWorkerMock{}
+	requests := &userRequestRepoMock{requests: map[int64]pgsql.UserRequest{}, marked: make(chan string, 1)}
+	svc.repos.UserRequest = requests
+	ctx := context.Background()
+	req := WorldCommandRequest{Action: "world_off", ActorUUID: "uuid-alice", ActorName: "alice", WorldAlias: "#404"}
+
+	// An unknown world or missing permission does not use up the cooldown.
+	for i := 0; i < 2; i++ {
+		if status, _ := svc.HandleWorldCommand(ctx, req); status != http.StatusNotFound {
+			t.Fatalf("call %d should reach the handler, got=%d", i, status)
+		}
+	}
+	bob := WorldCommandRequest{Action: "world_off", ActorUUID: "uuid-bob", ActorName: "bob", WorldAlias: "#5"}
+	for i := 0; i < 2; i++ {
+		if status, _ := svc.HandleWorldCommand(ctx, bob); status != http.StatusForbidden {
+			t.Fatalf("non-owner call %d should be forbidden, got=%d", i, status)
+		}
+	}
+
+	req.WorldAlias = "#5"
+	if status, resp := svc.HandleWorldCommand(ctx, req); status != http.StatusAccepted {
+		t.Fatalf("owner call should be accepted, got=%d msg=%s", status, resp.Message)
+	}
+	<-requests.marked
+	status, resp := svc.HandleWorldCommand(ctx, req)
+	if status != http.StatusTooManyRequests || !strings.Contains(resp.Message, "slow down") {
+		t.Fatalf("rapid repeat should be throttled, got=%d msg=%s", status, resp.Message)
+	}
+	if status, _ := svc.HandleWorldCommand(ctx, WorldCommandRequest{Action: "world_info", ActorUUID: "uuid-alice", ActorName: "alice", WorldAlias: "#5"}); status != http.StatusOK {
+		t.Fatalf("read-only actions should not be throttled, got=%d", status)
+	}
+}
+
+func TestMemberSetRole_PermissionChecks(t *testing.T) {
+	svc, instances, members := newWorldFixture()
+	ctx := context.Background()
+	setRole := func(actorUUID, actorName, target, role string) int {
+		status, _ := svc.HandleWorldCommand(ctx, WorldCommandRequest{
+			Action:     "member_set_role",
+			ActorUUID:  actorUUID,
+			ActorName:  actorName,
+			WorldAlias: "#5",
+			Target:     target,
+			Role:       role,
+		})
+		return status
+	}
+
+	if got := setRole("uuid-bob", "bob", "bob", "manager"); got != http.StatusForbidden {
+		t.Fatalf("member must not promote self, got=%d", got)
+	}
+	if got := setRole("uuid-alice", "alice", "bob", "admin"); got != http.StatusBadRequest {
+		t.Fatalf("invalid role should be rejected, got=%d", got)
+	}
+	if got := setRole("uuid-alice", "alice", "alice", "member"); got != http.StatusConflict {
+		t.Fatalf("sole owner must not be demoted, got=%d", got)
+	}
+	if got := setRole("uuid-alice", "alice", "carol", "manager"); got != http.StatusNotFound {
+		t.Fatalf("non-member target should be not found, got=%d", got)
+	}
+	if got := setRole("uuid-alice", "alice", "bob", "manager"); got != http.StatusOK {
+		t.Fatalf("owner should promote member, got=%d", got)
+	}
+	if members.members[1].Role != "manager" {
+		t.Fatalf("member row not updated: %+v", members.members[1])
+	}
+
+	status, _ := svc.HandleWorldCommand(ctx, WorldCommandRequest{Action: "world_set_name", ActorUUID: "uuid-bob", ActorName: "bob", WorldAlias: "#5", DisplayName: "Bob Managed"})
+	if status != http.StatusOK || instances.instances[5].DisplayName != "Bob Managed" {
+		t.Fatalf("manager should be able to manage the world, got=%d", status)
+	}
+	if got := setRole("uuid-bob", "bob", "bob", "member"); got != http.StatusForbidden {
+		t.Fatalf("manager must not change roles, got=%d", got)
+	}
+	_, resp := svc.HandleWorldCommand(ctx, WorldCommandRequest{Action: "world_list", ActorUUID: "uuid-bob", ActorName: "bob"})
+	if !strings.Contains(resp.Message, "(manager)") {
+		t.Fatalf("world_list should show manager role: %s", resp.Message)
+	}
+}
+
+func TestManager_CannotArchiveWorldOrRemoveOwnerAndManagers(t *testing.T) {
+	svc, instances, members := newWorldFixture()
+	svc.repos.User.(*userRepoMock).users[4] = pgsql.User{ID: 4, MCUUID: "uuid-dave", MCName: "dave", ServerRole: "user"}
+	members.members[1].Role = "manager"
+	members.members = append(members.members,
+		pgsql.InstanceMember{ID: 12, InstanceID: 5, UserID: 3, Role: "manager"},
+		pgsql.InstanceMember{ID: 13, InstanceID: 5, UserID: 4, Role: "member"},
+	)
+	ctx := context.Background()
+	asCarol := func(action, target string) (int, WorldCommandResponse) {
+		return svc.HandleWorldCommand(ctx, WorldCommandRequest{
+			Action: action, ActorUUID: "uuid-carol", ActorName: "carol", WorldAlias: "#5", Target: target,
+		})
+	}
+
+	if status, _ := asCarol("world_remove", ""); status != http.StatusForbidden {
+		t.Fatalf("manager must not archive the owner's world, got=%d", status)
+	}
+	inst := instances.instances[5]
+	inst.Status = "Archived"
+	instances.instances[5] = inst
+	if status, _ := asCarol("world_restore", ""); status != http.StatusForbidden {
+		t.Fatalf("manager must not restore the owner's world, got=%d", status)
+	}
+
+	for _, target := range []string{"alice", "bob"} {
+		status, resp := asCarol("member_remove", target)
+		if status != http.StatusForbidden || resp.Message != "managers can only remove members" {
+			t.Fatalf("manager must not remove %s: %d %s", target, status, resp.Message)
+		}
+	}
+	if len(members.members) != 4 {
+		t.Fatalf("refused removals must keep the rows: %+v", members.members)
+	}
+	if status, resp := asCarol("member_remove", "dave"); status != http.StatusOK {
+		t.Fatalf("manager should still remove a plain member: %d %s", status, resp.Message)
+	}
+}
+
+func TestWorldRestore_RequiresArchivedStatus(t *testing.T) {
+	svc, _ := newDisplayNameFixture()
+	status, resp := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+		Action:     "world_restore",
+		ActorUUID:  "uuid-alice",
+		ActorName:  "alice",
+		WorldAlias: "#5",
+	})
+	if status != http.StatusConflict {
+		t.Fatalf("restore of a live world should conflict, got=%d msg=%s", status, resp.Message)
+	}
+	status, _ = svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+		Action:     "world_restore",
+		ActorUUID:  "uuid-carol",
+		ActorName:  "carol",
+		WorldAlias: "#5",
+	})
+	if status != http.StatusForbidden {
+		t.Fatalf("non-member restore should be forbidden, got=%d", status)
+	}
+}
+
+func TestHandleWorldCommand_MetricsLabelOnlyKnownActions(t *testing.T) {
+	svc, _ := newDisplayNameFixture()
+	reg := metrics.NewRegistry()
+	reg.Counter(metrics.WorldCommands, "World commands.")
+	svc.SetMetrics(reg)
+	svc.SetDisabledActions([]string{"world_remove"})
+	for _, req := range []WorldCommandRequest{
+		{Action: "made_up_1"},
+		{Action: "made_up_2", ActorUUID: "uuid-alice", ActorName: "alice"},
+		{Action: "delete", ActorUUID: "uuid-alice", WorldAlias: "#5"},
+		{Action: "world_list"},
+	} {
+		svc.HandleWorldCommand(context.Background(), req)
+	}
+
+	var out strings.Builder
+	if err := reg.WriteText(context.Background(), &out); err != nil {
+		t.Fatalf("write metrics: %v", err)
+	}
+	text := out.String()
+	if strings.Contains(text, "made_up") || strings.Contains(text, `action="delete"`) {
+		t.Fatalf("client-chosen names must not become labels:\n%s", text)
+	}
+	for _, want := range []string{
+		`mcmm_world_commands_total{action="unknown",code="400"} 2`,
+		`mcmm_world_commands_total{action="world_remove",code="403"} 1`,
+		`mcmm_world_commands_total{action="world_list",code="400"} 1`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("missing %s in:\n%s", want, text)
+		}
+	}
+}
+
+func TestHandleWorldCommand_ReturnsFieldErrors(t *testing.T) {
+	svc, _ := newDisplayNameFixture()
+	tests := []struct {
+		name string
+		req  WorldCommandRequest
+		want map[string]string
+	}{
+		{
+			name: "missing actor",
+			req:  WorldCommandRequest{Action: "world_list"},
+			want: map[string]string{"actor_uuid": "required"},
+		},
+		{
+			name: "access mode",
+			req:  WorldCommandRequest{Action: "world_set_access", ActorUUID: "uuid-alice", AccessMode: "open"},
+			want: map[string]string{"world_alias": "required", "access_mode": "must be public|privacy"},
+		},
+		{
+			name: "create alias",
+			req:  WorldCommandRequest{Action: "request_create", ActorUUID: "uuid-alice", WorldAlias: "my:world"},
+			want: map[string]string{"world_alias": "must not contain ':', ',' or '#'"},
+		},
+		{
+			name: "member role",
+			req:  WorldCommandRequest{Action: "member_set_role", ActorUUID: "uuid-alice", WorldAlias: "#5", Role: "Owner"},
+			want: map[string]string{"target_name": "required", "role": "must be member|manager"},
+		},
+		{
+			name: "member add",
+			req:  WorldCommandRequest{Action: "member_add", ActorUUID: "uuid-alice", Target: "bob"},
+			want: map[string]string{"world_alias": "required"},
+		},
+		{
+			name: "member name charset",
+			req:  WorldCommandRequest{Action: "member_add", ActorUUID: "uuid-alice", WorldAlias: "#5", Target: "bob\nop mallory"},
+			want: map[string]string{"target_name": "not a valid player name"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			status, resp := svc.HandleWorldCommand(context.Background(), tc.req)
+			if status != http.StatusBadRequest {
+				t.Fatalf("status=%d want=400 msg=%s", status, resp.Message)
+			}
+			if len(resp.Fields) != len(tc.want) {
+				t.Fatalf("fields=%v want=%v", resp.Fields, tc.want)
+			}
+			for k, v := range tc.want {
+				if resp.Fields[k] != v {
+					t.Fatalf("fields[%s]=%q want=%q", k, resp.Fields[k], v)
+				}
+				if !strings.Contains(resp.Message, k+": "+v) {
+					t.Fatalf("message should mention %s: %s", k, resp.Message)
+				}
+			}
+		})
+	}
+}
+
+type purgeWorkerMock struct {
+	worker.Worker
+	purged []int64
+}
+
+func (m *purgeWorkerMock) DeleteArchived(ctx context.Context, instanceID int64) error {
+	m.purged = append(m.purged, instanceID)
+	return nil
+}
+
+func TestInstancePurge_OnlyArchivedByAdmin(t *testing.T) {
+	svc, instances, _ := newWorldFixture()
+	svc.repos.User.(*userRepoMock).users[9] = pgsql.User{ID: 9, MCUUID: "uuid-op", MCName: "op", ServerRole: "admin"}
+	wm := &purgeWorkerMock{}
+	svc.worker = wm
+	purge := func(actorUUID, actorName string) int {
+		status, _ := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+			Action:     "instance_purge",
+			ActorUUID:  actorUUID,
+			ActorName:  actorName,
+			WorldAlias: "#5",
+		})
+		return status
+	}
+
+	if got := purge("uuid-alice", "alice"); got != http.StatusForbidden {
+		t.Fatalf("owner must not purge, got=%d", got)
+	}
+	if got := purge("uuid-op", "op"); got != http.StatusConflict {
+		t.Fatalf("live instance must not be purged, got=%d", got)
+	}
+	if len(wm.purged) != 0 {
+		t.Fatalf("worker must not be called for a live instance: %v", wm.purged)
+	}
+
+	inst := instances.instances[5]
+	inst.Status = string(worker.StatusArchived)
+	instances.instances[5] = inst
+	if got := purge("uuid-op", "op"); got != http.StatusOK {
+		t.Fatalf("archived instance should be purged, got=%d", got)
+	}
+	if len(wm.purged) != 1 || wm.purged[0] != 5 {
+		t.Fatalf("unexpected purge calls: %v", wm.purged)
+	}
+}
+
+func TestNotifyTargets_DedupsRecipients(t *testing.T) {
+	var mu sync.Mutex
+	var commands []string
+	lobby := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		mu.Lock()
+		commands = append(commands, r.FormValue("command"))
+		mu.Unlock()
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer lobby.Close()
+
+	users := &userRepoMock{users: map[int64]pgsql.User{
+		1: {ID: 1, MCUUID: "uuid-alice", MCName: "alice", ServerRole: "admin"},
+		2: {ID: 2, MCUUID: "uuid-bob", MCName: "bob", ServerRole: "user"},
+		3: {ID: 3, MCUUID: "uuid-carol", MCName: "carol", ServerRole: "admin"},
+	}}
+	svc := NewServiceI(pgsql.Repos{User: users}, nil, "", lobby.URL, "", "", "", "", "", "")
+
+	// alice is owner, actor and admin; bob is both actor and named explicitly.
+	svc.notifyTargets(context.Background(), NotifyTargets{
+		UserIDs: []int64{1, 2, 1, 99},
+		Names:   []string{"BOB", " ", "bad name"},
+		Admins:  true,
+	}, "hello")
+
+	// Tells run in parallel, so only the set of commands is stable.
+	want := []string{"tell alice hello", "tell bob hello", "tell carol hello"}
+	mu.Lock()
+	defer mu.Unlock()
+	sort.Strings(commands)
+	if strings.Join(commands, "|") != strings.Join(want, "|") {
+		t.Fatalf("unexpected notifications: %q", commands)
+	}
+	if svc.lobbyConn == nil {
+		t.Fatalf("lobby connector should be cached for reuse")
+	}
+}
+
+type gameVersionRepoMock struct {
+	pgsql.GameVersionRepo
+	versions  map[string]pgsql.GameVersion
+	listCalls int
+}
+
+func (m *gameVersionRepoMock) ListVerified(ctx context.Context) ([]pgsql.GameVersion, error) {
+	m.listCalls++
+	out := make([]pgsql.GameVersion, 0, len(m.versions))
+	for _, gv := range m.versions {
+		if gv.Status == "verified" {
+			out = append(out, gv)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].GameVersion < out[j].GameVersion })
+	return out, nil
+}
+
+func (m *gameVersionRepoMock) Read(ctx context.Context, version string) (pgsql.GameVersion, error) {
+	gv, ok := m.versions[version]
+	if !ok {
+		return pgsql.GameVersion{}, sql.ErrNoRows
+	}
+	return gv, nil
+}
+
+func TestVersionList_ReturnsVerifiedVersionsAndCaches(t *testing.T) {
+	svc, _, _ := newWorldFixture()
+	versions := &gameVersionRepoMock{versions: map[string]pgsql.GameVersion{
+		"1.21.1": {GameVersion: "1.21.1", CoreJar: "paper-1.21.1.jar", Status: "verified"},
+		"1.21.4": {GameVersion: "1.21.4", CoreJar: "paper-1.21.4.jar", Status: "verified"},
+	}}
+	svc.repos.GameVersion = versions
+	now := time.Unix(1000, 0)
+	svc.versionCache = newVersionListCache(defaultVersionListTTL, func() time.Time { return now })
+	list := func() string {
+		status, resp := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{Action: "version_list", ActorUUID: "uuid-bob", ActorName: "bob"})
+		if status != http.StatusOK {
+			t.Fatalf("version_list failed: status=%d msg=%s", status, resp.Message)
+		}
+		return resp.Message
+	}
+
+	want := "versions: 1.21.1(paper-1.21.1.jar), 1.21.4(paper-1.21.4.jar)"
+	if got := list(); got != want {
+		t.Fatalf("unexpected version_list output:\n got=%s\nwant=%s", got, want)
+	}
+	list()
+	if versions.listCalls != 1 {
+		t.Fatalf("expected cached result on second call, ListVerified calls=%d", versions.listCalls)
+	}
+	now = now.Add(defaultVersionListTTL)
+	list()
+	if versions.listCalls != 2 {
+		t.Fatalf("expected reload after ttl, ListVerified calls=%d", versions.listCalls)
+	}
+}
+
+func TestCreate_RejectsUnverifiedOrUnknownGameVersion(t *testing.T) {
+	svc, instances, _ := newWorldFixture()
+	svc.repos.User.(*userRepoMock).users[9] = pgsql.User{ID: 9, MCUUID: "uuid-op", MCName: "op", ServerRole: "admin"}
+	svc.repos.GameVersion = &gameVersionRepoMock{versions: map[string]pgsql.GameVersion{
+		"1.21.1": {GameVersion: "1.21.1", Status: "verified"},
+		"1.21.4": {GameVersion: "1.21.4", Status: "verified"},
+		"1.20.6": {GameVersion: "1.20.6", Status: "failed"},
+	}}
+	svc.SetActionCooldown(0)
+	cases := []struct {
+		action  string
+		version string
+	}{
+		{"create_legacy", "1.20.6"},
+		{"create_legacy", "9.9.9"},
+		{"instance_create", "1.20.6"},
+		{"instance_create", "9.9.9"},
+	}
+	for _, tc := range cases {
+		svc.defaultGameVersion = tc.version
+		status, resp := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+			Action:      tc.action,
+			ActorUUID:   "uuid-op",
+			ActorName:   "op",
+			WorldAlias:  "newworld",
+			GameVersion: tc.version,
+		})
+		if status != http.StatusBadRequest {
+			t.Fatalf("%s game_version=%s: expected 400, got %d msg=%s", tc.action, tc.version, status, resp.Message)
+		}
+		want := "game_version: not a verified game version (valid: 1.21.1, 1.21.4)"
+		if !strings.Contains(resp.Message, want) {
+			t.Fatalf("%s game_version=%s: message should list valid versions, got %s", tc.action, tc.version, resp.Message)
+		}
+	}
+	if len(instances.instances) != 1 {
+		t.Fatalf("rejected creates must not add instances, got %d", len(instances.instances))
+	}
+}
+
+func TestRequestCreate_CapsPendingRequestsPerActor(t *testing.T) {
+	svc, _, _ := newWorldFixture()
+	requests := &userRequestRepoMock{requests: map[int64]pgsql.UserRequest{
+		// bob's pending request does not count against alice.
+		1: {ID: 1, ActorUserID: 2, Status: "pending"},
+		2: {ID: 2, ActorUserID: 1, Status: "rejected"},
+	}}
+	svc.repos.UserRequest = requests
+	svc.SetActionCooldown(0)
+	create := func(alias string) (int, WorldCommandResponse) {
+		return svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+			Action:     "request_create",
+			ActorUUID:  "uuid-alice",
+			ActorName:  "alice",
+			WorldAlias: alias,
+		})
+	}
+
+	for i := 0; i < maxPendingRequests; i++ {
+		if status, resp := create(fmt.Sprintf("farm%d", i)); status != http.StatusOK {
+			t.Fatalf("create %d failed: %d %s", i, status, resp.Message)
+		}
+	}
+	if status, resp := create("one_more"); status != http.StatusTooManyRequests {
+		t.Fatalf("expected the pending cap to apply, got %d %s", status, resp.Message)
+	}
+}
+
+func TestRequestCreate_ValidatesAndDefaultsStorageType(t *testing.T) {
+	svc, _, _ := newWorldFixture()
+	requests := &userRequestRepoMock{requests: map[int64]pgsql.UserRequest{}}
+	svc.repos.UserRequest = requests
+	svc.SetStorageTypes([]string{"ssd", "hdd"}, "hdd")
+	svc.SetActionCooldown(0)
+
+	status, resp := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+		Action:      "request_create",
+		ActorUUID:   "uuid-alice",
+		ActorName:   "alice",
+		WorldAlias:  "farm",
+		StorageType: "tape",
+	})
+	if status != http.StatusBadRequest || resp.Fields["storage_type"] != "must be ssd|hdd" {
+		t.Fatalf("unknown storage type should be rejected, got %d %+v", status, resp)
+	}
+	if len(requests.requests) != 0 {
+		t.Fatalf("rejected create must not file a request, got %d", len(requests.requests))
+	}
+
+	for _, tc := range []struct{ alias, storage, want string }{
+		{"farm", "", "hdd"},
+		{"mine", "SSD", "ssd"},
+	} {
+		status, resp = svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+			Action:      "request_create",
+			ActorUUID:   "uuid-alice",
+			ActorName:   "alice",
+			WorldAlias:  tc.alias,
+			StorageType: tc.storage,
+		})
+		if status != http.StatusOK {
+			t.Fatalf("create %s failed: %d %s", tc.alias, status, resp.Message)
+		}
+		var found bool
+		for _, r := range requests.requests {
+			if r.RequestedAlias.String != "alice_"+tc.alias {
+				continue
+			}
+			found = true
+			var payload createRequestPayload
+			if err := json.Unmarshal(r.ResponsePayload, &payload); err != nil {
+				t.Fatalf("payload: %v", err)
+			}
+			if payload.StorageType != tc.want {
+				t.Fatalf("%s: expected storage_type=%s, got %q", tc.alias, tc.want, payload.StorageType)
+			}
+		}
+		if !found {
+			t.Fatalf("request for %s not filed", tc.alias)
+		}
+	}
+}
+
+func TestRequestCreate_CarriesLevelSeed(t *testing.T) {
+	svc, _, _ := newWorldFixture()
+	requests := &userRequestRepoMock{requests: map[int64]pgsql.UserRequest{}}
+	svc.repos.UserRequest = requests
+	svc.SetActionCooldown(0)
+
+	status, resp := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+		Action:     "request_create",
+		ActorUUID:  "uuid-alice",
+		ActorName:  "alice",
+		WorldAlias: "farm",
+		Seed:       "abc\ndef",
+	})
+	if status != http.StatusBadRequest || resp.Fields["seed"] != "must not contain control characters" {
+		t.Fatalf("seed with a newline should be rejected, got %d %+v", status, resp)
+	}
+
+	status, resp = svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+		Action:     "request_create",
+		ActorUUID:  "uuid-alice",
+		ActorName:  "alice",
+		WorldAlias: "farm",
+		Seed:       " 8675309 ",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("create failed: %d %s", status, resp.Message)
+	}
+	if len(requests.requests) != 1 {
+		t.Fatalf("expected one filed request, got %d", len(requests.requests))
+	}
+	for _, r := range requests.requests {
+		var payload createRequestPayload
+		if err := json.Unmarshal(r.ResponsePayload, &payload); err != nil {
+			t.Fatalf("payload: %v", err)
+		}
+		if payload.LevelSeed != "8675309" {
+			t.Fatalf("expected seed 8675309 in the request, got %q", payload.LevelSeed)
+		}
+	}
+}
+
+func TestCreate_RefusedWhileNoVersionsInstalled(t *testing.T) {
+	svc, _, _ := newWorldFixture()
+	requests := &userRequestRepoMock{requests: map[int64]pgsql.UserRequest{}}
+	svc.repos.UserRequest = requests
+	svc.repos.User.(*userRepoMock).users[9] = pgsql.User{ID: 9, MCUUID: "uuid-op", MCName: "op", ServerRole: "admin"}
+	svc.SetActionCooldown(0)
+	svc.SetVersionsInstalled(false)
+
+	for _, action := range []string{"request_create", "instance_create"} {
+		status, resp := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+			Action:     action,
+			ActorUUID:  "uuid-op",
+			ActorName:  "op",
+			WorldAlias: "farm",
+		})
+		if status != http.StatusServiceUnavailable || resp.Message != "no game versions installed" {
+			t.Fatalf("%s without versions: got %d %+v", action, status, resp)
+		}
+	}
+	if len(requests.requests) != 0 {
+		t.Fatalf("refused create must not file a request, got %d", len(requests.requests))
+	}
+	status, resp := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+		Action:     "world_info",
+		ActorUUID:  "uuid-alice",
+		ActorName:  "alice",
+		WorldAlias: "alice_castle",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("non-create actions should still work, got %d %s", status, resp.Message)
+	}
+
+	svc.SetVersionsInstalled(true)
+	status, resp = svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+		Action:     "request_create",
+		ActorUUID:  "uuid-alice",
+		ActorName:  "alice",
+		WorldAlias: "farm",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("create after versions appear failed: %d %s", status, resp.Message)
+	}
+}
+
+func TestVersionsInstalled_PicksUpVersionInstalledAfterStartup(t *testing.T) {
+	svc, _, _ := newWorldFixture()
+	svc.worker = emptyVersionWorkerMock{}
+	svc.SetVersionsInstalled(false)
+	if svc.VersionsInstalled() {
+		t.Fatalf("no installed version should keep creates refused")
+	}
+
+	svc.worker = versionWorkerMock{}
+	if !svc.VersionsInstalled() {
+		t.Fatalf("a version installed after startup should be picked up")
+	}
+	svc.worker = emptyVersionWorkerMock{}
+	if !svc.VersionsInstalled() {
+		t.Fatalf("once seen, the flag should stay set without rescanning")
+	}
+}
+
+type emptyVersionWorkerMock struct {
+	worker.Worker
+}
+
+func (emptyVersionWorkerMock) SupportedVersions() ([]worker.VersionSupport, error) {
+	return []worker.VersionSupport{{Prefix: "1.21", Image: "mcmm-mini:java21-jlink"}}, nil
+}
+
+func TestMemberChanges_QueuedWhileInstanceOff(t *testing.T) {
+	svc, instances, members := newWorldFixture()
+	pending := &pendingWhitelistRepoMock{}
+	svc.repos.PendingWhitelist = pending
+	inst := instances.instances[5]
+	inst.Status = "Off"
+	instances.instances[5] = inst
+
+	for _, req := range []WorldCommandRequest{
+		{Action: "member_remove", ActorUUID: "uuid-alice", ActorName: "alice", WorldAlias: "#5", Target: "bob"},
+		{Action: "member_add", ActorUUID: "uuid-alice", ActorName: "alice", WorldAlias: "#5", Target: "carol"},
+	} {
+		if status, resp := svc.HandleWorldCommand(context.Background(), req); status != http.StatusOK {
+			t.Fatalf("%s failed: %d %s", req.Action, status, resp.Message)
+		}
+	}
+	for _, m := range members.members {
+		if m.UserID == 2 {
+			t.Fatalf("bob should no longer be a member: %+v", members.members)
+		}
+	}
+	want := []pgsql.PendingWhitelistOp{
+		{InstanceID: 5, PlayerName: "bob", Action: "remove"},
+		{InstanceID: 5, PlayerName: "carol", Action: "add"},
+	}
+	if !slices.Equal(pending.ops, want) {
+		t.Fatalf("expected queued ops %+v, got %+v", want, pending.ops)
+	}
+
+	inst.Status = "On"
+	instances.instances[5] = inst
+	if status, resp := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+		Action: "member_remove", ActorUUID: "uuid-alice", ActorName: "alice", WorldAlias: "#5", Target: "carol",
+	}); status != http.StatusOK {
+		t.Fatalf("member_remove while On failed: %d %s", status, resp.Message)
+	}
+	if len(pending.ops) != 2 {
+		t.Fatalf("a running instance should not queue, got %+v", pending.ops)
+	}
+}
+
+type composePreviewWorkerMock struct {
+	worker.Worker
+	previewed []int64
+}
+
+func (m *composePreviewWorkerMock) ComposePreview(ctx context.Context, instanceID int64) (string, error) {
+	m.previewed = append(m.previewed, instanceID)
+	return "services:\n  mcmm-inst-5:\n    mem_limit: 2048m\n", nil
+}
+
+func TestWorldCompose_OpOnlyReturnsPreview(t *testing.T) {
+	svc, _, _ := newWorldFixture()
+	w := &composePreviewWorkerMock{}
+	svc.worker = w
+	svc.repos.User.(*userRepoMock).users[9] = pgsql.User{ID: 9, MCUUID: "uuid-op", MCName: "op", ServerRole: "admin"}
+
+	status, _ := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+		Action: "world_compose", ActorUUID: "uuid-alice", ActorName: "alice", WorldAlias: "alice_castle",
+	})
+	if status != http.StatusForbidden {
+		t.Fatalf("owners should not read the compose file, got %d", status)
+	}
+	status, resp := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+		Action: "world_compose", ActorUUID: "uuid-op", ActorName: "op", WorldAlias: "alice_castle",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("world_compose failed: %d %s", status, resp.Message)
+	}
+	if want := "#5:alice_castle docker-compose.yml\nservices:\n  mcmm-inst-5:\n    mem_limit: 2048m\n"; resp.Message != want {
+		t.Fatalf("unexpected message:\n%s", resp.Message)
+	}
+	if !slices.Equal(w.previewed, []int64{5}) {
+		t.Fatalf("expected one preview of #5, got %v", w.previewed)
+	}
+}
+
+type validateWorkerMock struct {
+	worker.Worker
+	err error
+}
+
+func (m *validateWorkerMock) ValidateStart(ctx context.Context, instanceID int64, gameVersion string) error {
+	return m.err
+}
+
+func TestWorkerFailures_CarryErrorCode(t *testing.T) {
+	svc, instances, _ := newWorldFixture()
+	svc.worker = &validateWorkerMock{err: errors.New("version dir missing: /data/versions/1.20.4")}
+	svc.repos.User.(*userRepoMock).users[9] = pgsql.User{ID: 9, MCUUID: "uuid-op", MCName: "op", ServerRole: "admin"}
+
+	status, resp := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+		Action: "instance_validate", ActorUUID: "uuid-op", ActorName: "op", WorldAlias: "alice_castle",
+	})
+	if status != http.StatusConflict || resp.Code != string(worker.CodeJarMissing) {
+		t.Fatalf("expected 409 %s, got %d code=%q %s", worker.CodeJarMissing, status, resp.Code, resp.Message)
+	}
+	status, resp = svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+		Action: "instance_validate", ActorUUID: "uuid-op", ActorName: "op", WorldAlias: "alice_castle", GameVersion: "../../etc",
+	})
+	if status != http.StatusBadRequest || resp.Fields["game_version"] == "" {
+		t.Fatalf("a path-like game_version should be rejected, got %d %+v", status, resp)
+	}
+
+	inst := instances.instances[5]
+	inst.LastErrorMsg = sql.NullString{String: "prepare compose: unsupported game version: 1.12.2", Valid: true}
+	instances.instances[5] = inst
+	_, resp = svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+		Action: "world_info", ActorUUID: "uuid-op", ActorName: "op", WorldAlias: "alice_castle",
+	})
+	if !strings.Contains(resp.Message, "last_error_code=IMAGE_UNSUPPORTED") {
+		t.Fatalf("world_info should show the classified error code: %s", resp.Message)
+	}
+}
+
+func TestDisabledAction_RefusedEvenForAdmins(t *testing.T) {
+	svc, instances, _ := newWorldFixture()
+	svc.repos.User.(*userRepoMock).users[9] = pgsql.User{ID: 9, MCUUID: "uuid-op", MCName: "op", ServerRole: "admin"}
+	svc.SetDisabledActions([]string{" World_Remove ", "user_delete"})
+
+	for _, action := range []string{"world_remove", "delete"} {
+		status, resp := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+			Action: action, ActorUUID: "uuid-op", ActorName: "op", WorldAlias: "alice_castle",
+		})
+		if status != http.StatusForbidden || resp.Message != "disabled by operator" {
+			t.Fatalf("%s should be disabled for admins, got %d %s", action, status, resp.Message)
+		}
+	}
+	if _, ok := instances.instances[5]; !ok {
+		t.Fatalf("disabled remove must not touch the instance")
+	}
+	status, resp := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+		Action: "world_info", ActorUUID: "uuid-op", ActorName: "op", WorldAlias: "alice_castle",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("other actions should still work, got %d %s", status, resp.Message)
+	}
+}
+
+type warnRecorder struct {
+	warnings []string
+}
+
+func (r *warnRecorder) Infof(string, ...any) {}
+
+func (r *warnRecorder) Warnf(format string, args ...any) {
+	r.warnings = append(r.warnings, fmt.Sprintf(format, args...))
+}
+
+func (r *warnRecorder) Errorf(string, ...any) {}
+
+func TestSetDisabledActions_CoversAliasesAndWarnsOnUnknownNames(t *testing.T) {
+	svc, _, _ := newWorldFixture()
+	logs := &warnRecorder{}
+	svc.logger = logs
+	svc.SetDisabledActions([]string{"member_add", "player_reject", "instance_off", "world_delet"})
+
+	for _, action := range []string{"member_add", "player_invite", "member_remove", "player_reject", "instance_off", "instance_stop"} {
+		if !svc.disabledActions[canonicalAction(action)] {
+			t.Fatalf("%s should be disabled", action)
+		}
+	}
+	if len(svc.disabledActions) != 3 {
+		t.Fatalf("unknown names must not be recorded: %v", svc.disabledActions)
+	}
+	if len(logs.warnings) != 1 || !strings.Contains(logs.warnings[0], `"world_delet"`) {
+		t.Fatalf("unknown entry should be warned about once: %v", logs.warnings)
+	}
+}
+
+func TestWorldTransfer_MovesOwnershipAndMemberRoles(t *testing.T) {
+	svc, instances, members := newWorldFixture()
+	svc.repos.User.(*userRepoMock).users[9] = pgsql.User{ID: 9, MCUUID: "uuid-op", MCName: "op", ServerRole: "admin"}
+	var tapMu sync.Mutex
+	var tapCommands []string
+	tap := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tapMu.Lock()
+		tapCommands = append(tapCommands, r.FormValue("command"))
+		tapMu.Unlock()
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer tap.Close()
+	svc.instanceTapPattern = tap.URL + "/inst-%d"
+	transfer := func(uuid, name, target string) (int, WorldCommandResponse) {
+		return svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+			Action: "world_transfer", ActorUUID: uuid, ActorName: name, WorldAlias: "alice_castle", Target: target,
+		})
+	}
+	roles := func() map[int64]string {
+		out := map[int64]string{}
+		for _, m := range members.members {
+			if m.InstanceID == 5 {
+				out[m.UserID] = m.Role
+			}
+		}
+		return out
+	}
+
+	if status, _ := transfer("uuid-bob", "bob", "carol"); status != http.StatusForbidden {
+		t.Fatalf("a member must not transfer the world, got %d", status)
+	}
+	if status, resp := transfer("uuid-alice", "alice", "zed"); status != http.StatusNotFound {
+		t.Fatalf("unknown target should be 404, got %d %s", status, resp.Message)
+	}
+	if status, _ := transfer("uuid-alice", "alice", "alice"); status != http.StatusConflict {
+		t.Fatalf("transfer to the current owner should conflict, got %d", status)
+	}
+
+	status, resp := transfer("uuid-alice", "alice", "carol")
+	if status != http.StatusOK {
+		t.Fatalf("transfer failed: %d %s", status, resp.Message)
+	}
+	if got := instances.instances[5].OwnerID; got != 3 {
+		t.Fatalf("owner should be carol (3), got %d", got)
+	}
+	if got := roles(); got[1] != "member" || got[2] != "member" || got[3] != "owner" {
+		t.Fatalf("unexpected roles after transfer: %v", got)
+	}
+	tapMu.Lock()
+	deopped := slices.Contains(tapCommands, "deop alice")
+	tapMu.Unlock()
+	if !deopped {
+		t.Fatalf("the previous owner should lose op on the running world, commands=%v", tapCommands)
+	}
+
+	if status, _ := transfer("uuid-alice", "alice", "alice"); status != http.StatusForbidden {
+		t.Fatalf("the previous owner should lose the right to transfer, got %d", status)
+	}
+	if status, resp := transfer("uuid-op", "op", "bob"); status != http.StatusOK {
+		t.Fatalf("admin transfer failed: %d %s", status, resp.Message)
+	}
+	if got := roles(); got[1] != "member" || got[2] != "owner" || got[3] != "member" || len(got) != 3 {
+		t.Fatalf("unexpected roles after admin transfer: %v", got)
+	}
+}
+
+type switchVersionWorkerMock struct {
+	worker.Worker
+	switched chan string
+}
+
+func (m *switchVersionWorkerMock) SwitchVersion(ctx context.Context, instanceID int64, gameVersion string) error {
+	m.switched <- gameVersion
+	return nil
+}
+
+func TestWorldSetVersion_MetadataOnlyVsRestart(t *testing.T) {
+	svc, instances, _ := newWorldFixture()
+	svc.repos.User.(*userRepoMock).users[9] = pgsql.User{ID: 9, MCUUID: "uuid-op", MCName: "op", ServerRole: "admin"}
+	svc.repos.GameVersion = &gameVersionRepoMock{versions: map[string]pgsql.GameVersion{
+		"1.21.1": {GameVersion: "1.21.1", Status: "verified"},
+		"1.21.4": {GameVersion: "1.21.4", Status: "verified"},
+		"1.20.6": {GameVersion: "1.20.6", Status: "failed"},
+	}}
+	wm := &switchVersionWorkerMock{switched: make(chan string, 1)}
+	svc.worker = wm
+	inst := instances.instances[5]
+	inst.GameVersion = "1.21.1"
+	instances.instances[5] = inst
+	setVersion := func(version string, restart bool) (int, WorldCommandResponse) {
+		return svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+			Action:      "world_set_version",
+			ActorUUID:   "uuid-op",
+			ActorName:   "op",
+			WorldAlias:  "#5",
+			GameVersion: version,
+			Restart:     restart,
+		})
+	}
+
+	if status, resp := setVersion("1.20.6", false); status != http.StatusBadRequest || resp.Fields["game_version"] == "" {
+		t.Fatalf("unverified version must be rejected: status=%d fields=%v", status, resp.Fields)
+	}
+	if status, _ := setVersion("1.21.4", false); status != http.StatusConflict {
+		t.Fatalf("running instance needs restart flag, got=%d", status)
+	}
+	if got := instances.instances[5].GameVersion; got != "1.21.1" {
+		t.Fatalf("rejected request must not change metadata: %s", got)
+	}
+
+	if status, resp := setVersion("1.21.4", true); status != http.StatusAccepted {
+		t.Fatalf("restart switch should be accepted: status=%d msg=%s", status, resp.Message)
+	}
+	select {
+	case got := <-wm.switched:
+		if got != "1.21.4" {
+			t.Fatalf("worker switched to %s", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("worker SwitchVersion was not called")
+	}
+
+	inst = instances.instances[5]
+	inst.Status = string(worker.StatusOff)
+	instances.instances[5] = inst
+	if status, resp := setVersion("1.21.4", false); status != http.StatusOK {
+		t.Fatalf("metadata fix on stopped instance failed: status=%d msg=%s", status, resp.Message)
+	}
+	if got := instances.instances[5].GameVersion; got != "1.21.4" {
+		t.Fatalf("metadata not updated: %s", got)
+	}
+	select {
+	case got := <-wm.switched:
+		t.Fatalf("metadata-only change must not restart, switched to %s", got)
+	default:
+	}
+}
+
+func TestInstanceSetVersion_RefusesDowngradeWithoutForce(t *testing.T) {
+	svc, instances, _ := newWorldFixture()
+	svc.repos.User.(*userRepoMock).users[9] = pgsql.User{ID: 9, MCUUID: "uuid-op", MCName: "op", ServerRole: "admin"}
+	svc.repos.GameVersion = &gameVersionRepoMock{versions: map[string]pgsql.GameVersion{
+		"1.20.4":  {GameVersion: "1.20.4", Status: "verified"},
+		"1.21.10": {GameVersion: "1.21.10", Status: "verified"},
+		"1.21.2":  {GameVersion: "1.21.2", Status: "pending"},
+	}}
+	inst := instances.instances[5]
+	inst.Status = string(worker.StatusOff)
+	inst.GameVersion = "1.21.4"
+	instances.instances[5] = inst
+	setVersion := func(version string, force bool) (int, WorldCommandResponse) {
+		return svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+			Action:      "instance_set_version",
+			ActorUUID:   "uuid-op",
+			ActorName:   "op",
+			WorldAlias:  "#5",
+			GameVersion: version,
+			Force:       force,
+		})
+	}
+
+	if status, resp := setVersion("1.21.2", false); status != http.StatusBadRequest || resp.Fields["game_version"] == "" {
+		t.Fatalf("unverified version must be rejected: status=%d fields=%v", status, resp.Fields)
+	}
+	status, resp := setVersion("1.20.4", false)
+	if status != http.StatusConflict || !strings.Contains(resp.Message, "force=true") {
+		t.Fatalf("downgrade without force must be refused: status=%d msg=%s", status, resp.Message)
+	}
+	if got := instances.instances[5].GameVersion; got != "1.21.4" {
+		t.Fatalf("refused downgrade must not change metadata: %s", got)
+	}
+	if status, resp := setVersion("1.21.10", false); status != http.StatusOK {
+		t.Fatalf("upgrade should pass without force: status=%d msg=%s", status, resp.Message)
+	}
+	if status, resp := setVersion("1.20.4", true); status != http.StatusOK {
+		t.Fatalf("forced downgrade should pass: status=%d msg=%s", status, resp.Message)
+	}
+	if got := instances.instances[5].GameVersion; got != "1.20.4" {
+		t.Fatalf("forced downgrade not applied: %s", got)
+	}
+}
+
+func TestWorldMine_ListsOwnedAndMemberWorlds(t *testing.T) {
+	svc, instances, members := newWorldFixture()
+	instances.instances[6] = pgsql.MapInstance{ID: 6, Alias: "carol_farm", OwnerID: 3, Status: "Off", AccessMode: "public"}
+	instances.instances[7] = pgsql.MapInstance{ID: 7, Alias: "alice_old", OwnerID: 1, Status: "Archived", AccessMode: "privacy"}
+	instances.instances[8] = pgsql.MapInstance{ID: 8, Alias: "carol_secret", OwnerID: 3, Status: "On", AccessMode: "privacy"}
+	members.members = append(members.members,
+		pgsql.InstanceMember{ID: 12, InstanceID: 6, UserID: 3, Role: "owner"},
+		pgsql.InstanceMember{ID: 13, InstanceID: 6, UserID: 1, Role: "manager"},
+		pgsql.InstanceMember{ID: 14, InstanceID: 7, UserID: 1, Role: "owner"},
+		pgsql.InstanceMember{ID: 15, InstanceID: 8, UserID: 3, Role: "owner"},
+	)
+	mine := func(includeArchived bool) string {
+		status, resp := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+			Action:          "world_mine",
+			ActorUUID:       "uuid-alice",
+			ActorName:       "alice",
+			IncludeArchived: includeArchived,
+		})
+		if status != http.StatusOK {
+			t.Fatalf("world_mine failed: status=%d msg=%s", status, resp.Message)
+		}
+		return resp.Message
+	}
+
+	want := "#5:alice_castle:On(owner) access=privacy members=1 name=castle, #6:carol_farm:Off(manager) access=public members=1"
+	if got := mine(false); got != want {
+		t.Fatalf("unexpected world_mine output:\n got=%s\nwant=%s", got, want)
+	}
+	want += ", #7:alice_old:Archived(owner) access=privacy members=0"
+	if got := mine(true); got != want {
+		t.Fatalf("unexpected world_mine output with archived:\n got=%s\nwant=%s", got, want)
+	}
+}
+
+func TestWorldList_IncludeArchivedShowsOwnArchivedWorlds(t *testing.T) {
+	svc, instances, _ := newWorldFixture()
+	instances.instances[7] = pgsql.MapInstance{ID: 7, Alias: "alice_old", OwnerID: 1, Status: "Archived", AccessMode: "privacy"}
+	instances.instances[8] = pgsql.MapInstance{ID: 8, Alias: "carol_old", OwnerID: 3, Status: "Archived", AccessMode: "public"}
+	list := func(includeArchived bool) string {
+		status, resp := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+			Action:          "world_list",
+			ActorUUID:       "uuid-alice",
+			ActorName:       "alice",
+			IncludeArchived: includeArchived,
+		})
+		if status != http.StatusOK {
+			t.Fatalf("world_list failed: status=%d msg=%s", status, resp.Message)
+		}
+		return resp.Message
+	}
+
+	want := "#5:alice_castle:On(owner) name=castle"
+	if got := list(false); got != want {
+		t.Fatalf("unexpected world_list output:\n got=%s\nwant=%s", got, want)
+	}
+	want += ", #7:alice_old:Archived(owner)"
+	if got := list(true); got != want {
+		t.Fatalf("unexpected world_list output with archived:\n got=%s\nwant=%s", got, want)
+	}
+}
+
+// flakyInstanceRepo fails List while down is set, like a database blip.
+type flakyInstanceRepo struct {
+	*mapInstanceRepoMock
+	down bool
+}
+
+func (m *flakyInstanceRepo) List(ctx context.Context) ([]pgsql.MapInstance, error) {
+	if m.down {
+		return nil, errors.New("connection refused")
+	}
+	return m.mapInstanceRepoMock.List(ctx)
+}
+
+func TestWorldList_ServesStaleResultWhenDatabaseFails(t *testing.T) {
+	svc, instances, _ := newWorldFixture()
+	flaky := &flakyInstanceRepo{mapInstanceRepoMock: instances}
+	svc.repos.MapInstance = flaky
+	now := time.Unix(1000, 0)
+	svc.readCache = newReadFallbackCache(defaultReadFallbackTTL, func() time.Time { return now })
+	list := func(uuid, name string) (int, WorldCommandResponse) {
+		return svc.HandleWorldCommand(context.Background(), WorldCommandRequest{Action: "world_list", ActorUUID: uuid, ActorName: name})
+	}
+
+	status, fresh := list("uuid-alice", "alice")
+	if status != http.StatusOK || fresh.Stale {
+		t.Fatalf("expected fresh world_list, got status=%d resp=%+v", status, fresh)
+	}
+
+	flaky.down = true
+	status, stale := list("uuid-alice", "alice")
+	if status != http.StatusOK || !stale.Stale || stale.Message != fresh.Message {
+		t.Fatalf("expected cached world_list flagged stale, got status=%d resp=%+v", status, stale)
+	}
+	if status, _ := list("uuid-bob", "bob"); status != http.StatusInternalServerError {
+		t.Fatalf("another actor's cached list must not be served, got status=%d", status)
+	}
+
+	now = now.Add(defaultReadFallbackTTL)
+	if status, _ := list("uuid-alice", "alice"); status != http.StatusInternalServerError {
+		t.Fatalf("expired cache entry must not be served, got status=%d", status)
+	}
+}
+
+// lockedUserRepo is a goroutine-safe user table with a unique mc_uuid.
+type lockedUserRepo struct {
+	pgsql.UserRepo
+	mu     sync.Mutex
+	users  map[int64]pgsql.User
+	nextID int64
+}
+
+func (m *lockedUserRepo) findLocked(match func(pgsql.User) bool) (pgsql.User, error) {
+	for _, u := range m.users {
+		if match(u) {
+			return u, nil
+		}
+	}
+	return pgsql.User{}, sql.ErrNoRows
+}
+
+func (m *lockedUserRepo) ReadByUUID(ctx context.Context, mcUUID string) (pgsql.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.findLocked(func(u pgsql.User) bool { return u.MCUUID == mcUUID })
+}
+
+func (m *lockedUserRepo) ReadByName(ctx context.Context, mcName string) (pgsql.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.findLocked(func(u pgsql.User) bool { return strings.EqualFold(u.MCName, mcName) })
+}
+
+func (m *lockedUserRepo) Read(ctx context.Context, id int64) (pgsql.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.findLocked(func(u pgsql.User) bool { return u.ID == id })
+}
+
+func (m *lockedUserRepo) Upsert(ctx context.Context, mcUUID string, mcName string) (pgsql.User, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if u, err := m.findLocked(func(u pgsql.User) bool { return u.MCUUID == mcUUID }); err == nil {
+		u.MCName = mcName
+		m.users[u.ID] = u
+		return u, false, nil
+	}
+	m.nextID++
+	u := pgsql.User{ID: m.nextID, MCUUID: mcUUID, MCName: mcName, ServerRole: "user"}
+	m.users[u.ID] = u
+	return u, true, nil
+}
+
+func TestPlayerJoin_ConcurrentJoinsResolveToOneRow(t *testing.T) {
+	svc, _, _ := newWorldFixture()
+	users := &lockedUserRepo{users: map[int64]pgsql.User{}}
+	svc.repos.User = users
+	ctx := context.Background()
+	joinAll := func(name string) {
+		var wg sync.WaitGroup
+		codes := make([]int, 8)
+		for i := range codes {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				codes[i], _ = svc.HandlePlayerJoin(ctx, "uuid-erin", name)
+			}(i)
+		}
+		wg.Wait()
+		for i, code := range codes {
+			if code != http.StatusOK {
+				t.Fatalf("join #%d as %s failed: status=%d", i, name, code)
+			}
+		}
+	}
+
+	joinAll("erin")
+	if len(users.users) != 1 {
+		t.Fatalf("concurrent first joins should create one row, got %+v", users.users)
+	}
+	u := users.users[1]
+	u.ServerRole = "admin"
+	users.users[1] = u
+
+	joinAll("erin_renamed")
+	if len(users.users) != 1 {
+		t.Fatalf("concurrent renames should keep one row, got %+v", users.users)
+	}
+	if got := users.users[1]; got.MCName != "erin_renamed" || got.ServerRole != "admin" {
+		t.Fatalf("rename should only change the name, got %+v", got)
+	}
+}
+
+func TestPlayerList_PagesAndFiltersByRole(t *testing.T) {
+	svc, _, _ := newWorldFixture()
+	users := svc.repos.User.(*userRepoMock).users
+	for id := int64(4); id <= 205; id++ {
+		users[id] = pgsql.User{ID: id, MCUUID: fmt.Sprintf("uuid-p%d", id), MCName: fmt.Sprintf("p%d", id), ServerRole: "user"}
+	}
+	users[2] = pgsql.User{ID: 2, MCUUID: "uuid-bob", MCName: "bob", ServerRole: "admin"}
+	svc.SetActionCooldown(0)
+	list := func(page int, role string) string {
+		status, resp := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+			Action: "player_list", ActorUUID: "uuid-alice", ActorName: "alice", Page: page, Role: role,
+		})
+		if status != http.StatusOK {
+			t.Fatalf("player_list page=%d role=%s failed: status=%d msg=%s", page, role, status, resp.Message)
+		}
+		return resp.Message
+	}
+
+	first := list(0, "")
+	if !strings.HasPrefix(first, "players (page 1/2, total=205): alice, bob, carol, p4,") || strings.Contains(first, "p201") {
+		t.Fatalf("unexpected first page: %.120s", first)
+	}
+	if got, want := list(2, ""), "players (page 2/2, total=205): p201, p202, p203, p204, p205"; got != want {
+		t.Fatalf("unexpected second page:\n got=%s\nwant=%s", got, want)
+	}
+	if got, want := list(3, ""), "no players on page 3 (pages=2)"; got != want {
+		t.Fatalf("unexpected page past the end: got=%s want=%s", got, want)
+	}
+	if got, want := list(0, "ADMIN"), "players (role=admin page 1/1, total=1): bob"; got != want {
+		t.Fatalf("unexpected admin list: got=%s want=%s", got, want)
+	}
+}
+
+type starterWorkerMock struct {
+	worker.Worker
+	started chan int64
+}
+
+func (m *starterWorkerMock) StartEmpty(ctx context.Context, instanceID int64, gameVersion string) error {
+	m.started <- instanceID
+	return nil
+}
+
+func TestPlayerJoin_FirstJoinProvisionsOneStarterWorld(t *testing.T) {
+	svc, instances, members := newWorldFixture()
+	wm := &starterWorkerMock{started: make(chan int64, 2)}
+	svc.worker = wm
+	svc.SetStarterWorld(StarterWorldOptions{Enabled: true, Quota: 10})
+	ctx := context.Background()
+
+	if status, resp := svc.HandlePlayerJoin(ctx, "uuid-dave", "dave"); status != http.StatusOK {
+		t.Fatalf("first join failed: status=%d msg=%s", status, resp.Message)
+	}
+	select {
+	case <-wm.started:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("starter world was not started")
+	}
+	if status, _ := svc.HandlePlayerJoin(ctx, "uuid-dave", "dave"); status != http.StatusOK {
+		t.Fatalf("second join failed: status=%d", status)
+	}
+	if status, _ := svc.HandlePlayerJoin(ctx, "uuid-alice", "alice"); status != http.StatusOK {
+		t.Fatalf("existing player join failed: status=%d", status)
+	}
+
+	var starters []pgsql.MapInstance
+	for _, inst := range instances.instances {
+		if strings.HasSuffix(inst.Alias, "_starter") {
+			starters = append(starters, inst)
+		}
+	}
+	if len(starters) != 1 || starters[0].Alias != "dave_starter" || starters[0].SourceType != "empty" {
+		t.Fatalf("expected exactly one starter world for dave: %+v", starters)
+	}
+	owners := 0
+	for _, mem := range members.members {
+		if mem.InstanceID == starters[0].ID && mem.Role == "owner" && mem.UserID == starters[0].OwnerID {
+			owners++
+		}
+	}
+	if owners != 1 {
+		t.Fatalf("starter world should have its owner as member: %+v", members.members)
+	}
+	select {
+	case id := <-wm.started:
+		t.Fatalf("later joins must not provision again, started #%d", id)
+	default:
+	}
+}
+
+func TestWorldNote_RoundTripsThroughWorldInfo(t *testing.T) {
+	svc, instances, _ := newWorldFixture()
+	svc.repos.User.(*userRepoMock).users[9] = pgsql.User{ID: 9, MCUUID: "uuid-op", MCName: "op", ServerRole: "admin"}
+	ctx := context.Background()
+	command := func(action, uuid, name, note string) (int, WorldCommandResponse) {
+		return svc.HandleWorldCommand(ctx, WorldCommandRequest{
+			Action:     action,
+			ActorUUID:  uuid,
+			ActorName:  name,
+			WorldAlias: "#5",
+			Note:       note,
+		})
+	}
+
+	if status, _ := command("world_note", "uuid-alice", "alice", "mine"); status != http.StatusForbidden {
+		t.Fatalf("owner must not set admin notes, got=%d", status)
+	}
+	if status, resp := command("world_note", "uuid-op", "op", "event world, delete after Sunday"); status != http.StatusOK {
+		t.Fatalf("set note failed: status=%d msg=%s", status, resp.Message)
+	}
+	if got := instances.instances[5].Notes; got != "event world, delete after Sunday" {
+		t.Fatalf("note not stored: %q", got)
+	}
+
+	if _, resp := command("world_info", "uuid-alice", "alice", ""); !strings.HasSuffix(resp.Message, "note=event world, delete after Sunday") {
+		t.Fatalf("owner should see the note: %s", resp.Message)
+	}
+	if _, resp := command("world_info", "uuid-op", "op", ""); !strings.HasSuffix(resp.Message, " note=event world, delete after Sunday") {
+		t.Fatalf("note should come after the OP diagnostics: %s", resp.Message)
+	}
+	if _, resp := command("world_info", "uuid-carol", "carol", ""); strings.Contains(resp.Message, "note=") {
+		t.Fatalf("non-manager must not see the note: %s", resp.Message)
+	}
+
+	if status, resp := command("world_note", "uuid-op", "op", ""); status != http.StatusOK || instances.instances[5].Notes != "" {
+		t.Fatalf("empty note should clear: status=%d msg=%s", status, resp.Message)
+	}
+}
+
+func TestInstanceLockdown_KicksWithConfiguredMessage(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		kicks []string
+	)
+	tap := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		cmd := r.FormValue("command")
+		if cmd == "list" {
+			_, _ = w.Write([]byte("There are 2 of a max of 20 players online: bob, op"))
+			return
+		}
+		mu.Lock()
+		kicks = append(kicks, cmd)
+		mu.Unlock()
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer tap.Close()
+
+	svc, _, _ := newWorldFixture()
+	svc.repos.User.(*userRepoMock).users[9] = pgsql.User{ID: 9, MCUUID: "uuid-op", MCName: "op", ServerRole: "admin"}
+	svc.instanceTapPattern = tap.URL + "/inst-%d"
+	svc.SetLockdownKickMessage("{name} (#{id}) is closed for maintenance")
+
+	status, resp := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+		Action:     "instance_lockdown",
+		ActorUUID:  "uuid-op",
+		ActorName:  "op",
+		WorldAlias: "#5",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("lockdown failed: status=%d msg=%s", status, resp.Message)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(kicks) != 1 || kicks[0] != "kick bob castle (#5) is closed for maintenance" {
+		t.Fatalf("expected one kick with the configured message, got %q", kicks)
+	}
+}
+
+type versionWorkerMock struct {
+	worker.Worker
+}
+
+func (versionWorkerMock) SupportedVersions() ([]worker.VersionSupport, error) {
+	return []worker.VersionSupport{
+		{Prefix: "1.20", Image: "mcmm-mini:java17-jlink"},
+		{Prefix: "1.21", Image: "mcmm-mini:java21-jlink", Installed: []string{"1.21.1", "1.21.4"}},
+	}, nil
+}
+
+func TestVersionSupported_OpOnlyAndListsInstalled(t *testing.T) {
+	svc, _, _ := newWorldFixture()
+	svc.repos.User.(*userRepoMock).users[9] = pgsql.User{ID: 9, MCUUID: "uuid-op", MCName: "op", ServerRole: "admin"}
+	svc.worker = versionWorkerMock{}
+	ctx := context.Background()
+
+	if status, _ := svc.HandleWorldCommand(ctx, WorldCommandRequest{Action: "version_supported", ActorUUID: "uuid-alice", ActorName: "alice"}); status != http.StatusForbidden {
+		t.Fatalf("non-admin must be rejected, got=%d", status)
+	}
+	status, resp := svc.HandleWorldCommand(ctx, WorldCommandRequest{Action: "version_supported", ActorUUID: "uuid-op", ActorName: "op"})
+	if status != http.StatusOK {
+		t.Fatalf("version_supported failed: status=%d msg=%s", status, resp.Message)
+	}
+	want := "versions: 1.20.x -> mcmm-mini:java17-jlink installed=none; 1.21.x -> mcmm-mini:java21-jlink installed=1.21.1,1.21.4"
+	if resp.Message != want {
+		t.Fatalf("unexpected output:\n got=%s\nwant=%s", resp.Message, want)
+	}
+}
+
+type mapTemplateRepoMock struct {
+	pgsql.MapTemplateRepo
+	templates []pgsql.MapTemplate
+}
+
+func (m *mapTemplateRepoMock) List(ctx context.Context) ([]pgsql.MapTemplate, error) {
+	return append([]pgsql.MapTemplate(nil), m.templates...), nil
+}
+
+func (m *mapTemplateRepoMock) ListByGameVersion(ctx context.Context, gameVersion string) ([]pgsql.MapTemplate, error) {
+	out := make([]pgsql.MapTemplate, 0)
+	for _, t := range m.templates {
+		if t.GameVersion == gameVersion {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func (m *mapTemplateRepoMock) SearchByTag(ctx context.Context, substring string, gameVersion string) ([]pgsql.MapTemplate, error) {
+	out := make([]pgsql.MapTemplate, 0)
+	for _, t := range m.templates {
+		if gameVersion != "" && t.GameVersion != gameVersion {
+			continue
+		}
+		if strings.Contains(strings.ToLower(t.Tag), strings.ToLower(substring)) {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func TestTemplateList_FiltersByVersionAndQuery(t *testing.T) {
+	svc, _, _ := newWorldFixture()
+	svc.repos.MapTemplate = &mapTemplateRepoMock{templates: []pgsql.MapTemplate{
+		{ID: 1, Tag: "Skyblock", GameVersion: "1.21.1"},
+		{ID: 2, Tag: "parkour_sky", GameVersion: "1.20.4"},
+		{ID: 3, Tag: "castle", GameVersion: "1.21.1"},
+	}}
+	list := func(version, query string) string {
+		status, resp := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+			Action:      "template_list",
+			ActorUUID:   "uuid-carol",
+			ActorName:   "carol",
+			GameVersion: version,
+			Query:       query,
+		})
+		if status != http.StatusOK {
+			t.Fatalf("template_list failed: status=%d msg=%s", status, resp.Message)
+		}
+		return resp.Message
+	}
+
+	cases := []struct {
+		version, query, want string
+	}{
+		{"", "", "templates: #1:Skyblock (1.21.1), #2:parkour_sky (1.20.4), #3:castle (1.21.1)"},
+		{"1.21.1", "", "templates matching game_version=1.21.1 (2): #1:Skyblock (1.21.1), #3:castle (1.21.1)"},
+		{"", "SKY", "templates matching query=SKY (2): #1:Skyblock (1.21.1), #2:parkour_sky (1.20.4)"},
+		{"1.20.4", "sky", "templates matching game_version=1.20.4 query=sky (1): #2:parkour_sky (1.20.4)"},
+		{"1.16.5", "", "no templates match game_version=1.16.5"},
+	}
+	for _, c := range cases {
+		if got := list(c.version, c.query); got != c.want {
+			t.Fatalf("version=%q query=%q:\n got=%s\nwant=%s", c.version, c.query, got, c.want)
+		}
+	}
+}
+
+func (m *mapTemplateRepoMock) Read(ctx context.Context, id int64) (pgsql.MapTemplate, error) {
+	for _, t := range m.templates {
+		if t.ID == id {
+			return t, nil
+		}
+	}
+	return pgsql.MapTemplate{}, sql.ErrNoRows
+}
+
+type userRequestRepoMock struct {
+	pgsql.UserRequestRepo
+	requests map[int64]pgsql.UserRequest
+	// marked, when set, receives each request_id given a final result.
+	marked chan string
+}
+
+func (m *userRequestRepoMock) CreateAcceptedIfNotExists(ctx context.Context, requestID string, requestType string, actorUserID sql.NullInt64, targetInstanceID sql.NullInt64) (pgsql.UserRequest, bool, error) {
+	if r, err := m.ReadByRequestID(ctx, requestID); err == nil {
+		return r, false, nil
+	}
+	r := pgsql.UserRequest{RequestID: requestID, RequestType: requestType, ActorUserID: actorUserID.Int64, TargetInstanceID: targetInstanceID, Status: "accepted"}
+	r.ID, _ = m.Create(ctx, r)
+	return r, true, nil
+}
+
+func (m *userRequestRepoMock) Update(ctx context.Context, req pgsql.UserRequest) error {
+	m.requests[req.ID] = req
+	return nil
+}
+
+func (m *userRequestRepoMock) MarkRequestResult(ctx context.Context, requestID string, status string, responsePayload json.RawMessage, errorCode sql.NullString, errorMsg sql.NullString) error {
+	for id, r := range m.requests {
+		if r.RequestID == requestID {
+			r.Status, r.ResponsePayload, r.ErrorCode, r.ErrorMsg = status, responsePayload, errorCode, errorMsg
+			m.requests[id] = r
+		}
+	}
+	if m.marked != nil {
+		m.marked <- requestID
+	}
+	return nil
+}
+
+func (m *userRequestRepoMock) Create(ctx context.Context, req pgsql.UserRequest) (int64, error) {
+	req.ID = int64(len(m.requests) + 100)
+	m.requests[req.ID] = req
+	return req.ID, nil
+}
+
+func (m *userRequestRepoMock) Read(ctx context.Context, id int64) (pgsql.UserRequest, error) {
+	if r, ok := m.requests[id]; ok {
+		return r, nil
+	}
+	return pgsql.UserRequest{}, sql.ErrNoRows
+}
+
+func (m *userRequestRepoMock) ReadByRequestID(ctx context.Context, requestID string) (pgsql.UserRequest, error) {
+	for _, r := range m.requests {
+		if r.RequestID == requestID {
+			return r, nil
+		}
+	}
+	return pgsql.UserRequest{}, sql.ErrNoRows
+}
+
+func (m *userRequestRepoMock) ListByActor(ctx context.Context, actorUserID int64, limit int) ([]pgsql.UserRequest, error) {
+	out := make([]pgsql.UserRequest, 0)
+	for _, r := range m.requests {
+		if r.ActorUserID == actorUserID {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (m *userRequestRepoMock) CountPendingByActor(ctx context.Context, actorUserID int64) (int64, error) {
+	var n int64
+	for _, r := range m.requests {
+		if r.ActorUserID == actorUserID && r.Status == "pending" {
+			n++
+		}
+	}
+	return n, nil
+}
+
+type failingStopWorkerMock struct {
+	worker.Worker
+	stops atomic.Int32
+}
+
+func (m *failingStopWorkerMock) StopOnly(ctx context.Context, instanceID int64) error {
+	m.stops.Add(1)
+	return errors.New("stop compose: docker compose -f /x/docker-compose.yml down failed: exit status 1")
+}
+
+func TestWorldOff_FailureIsRecordedOnRequest(t *testing.T) {
+	svc, _, _ := newWorldFixture()
+	svc.worker = &failingStopWorkerMock{}
+	requests := &userRequestRepoMock{requests: map[int64]pgsql.UserRequest{}, marked: make(chan string, 1)}
+	svc.repos.UserRequest = requests
+
+	status, resp := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+		Action: "world_off", ActorUUID: "uuid-alice", ActorName: "alice", WorldAlias: "alice_castle", RequestID: "req-off-1",
+	})
+	if status != http.StatusAccepted {
+		t.Fatalf("world_off should be accepted, got %d %s", status, resp.Message)
+	}
+	select {
+	case id := <-requests.marked:
+		if id != "req-off-1" {
+			t.Fatalf("unexpected request marked: %s", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("power-off result was never recorded")
+	}
+	ur, err := requests.ReadByRequestID(context.Background(), "req-off-1")
+	if err != nil {
+		t.Fatalf("request row missing: %v", err)
+	}
+	if ur.Status != "failed" || ur.RequestType != "world_off" || ur.ActorUserID != 1 || ur.TargetInstanceID.Int64 != 5 {
+		t.Fatalf("unexpected request row: %+v", ur)
+	}
+	if ur.ErrorCode.String != string(worker.CodeDockerFailed) || !strings.Contains(ur.ErrorMsg.String, "exit status 1") {
+		t.Fatalf("expected the classified worker error, got code=%q msg=%q", ur.ErrorCode.String, ur.ErrorMsg.String)
+	}
+}
+
+func TestWorldOff_RetriedRequestIDReplaysRecordedResult(t *testing.T) {
+	svc, _, _ := newWorldFixture()
+	wm := &failingStopWorkerMock{}
+	svc.worker = wm
+	svc.SetActionCooldown(0)
+	requests := &userRequestRepoMock{requests: map[int64]pgsql.UserRequest{}, marked: make(chan string, 1)}
+	svc.repos.UserRequest = requests
+	req := WorldCommandRequest{Action: "world_off", ActorUUID: "uuid-alice", ActorName: "alice", WorldAlias: "alice_castle", RequestID: "req-off-1"}
+
+	if status, resp := svc.HandleWorldCommand(context.Background(), req); status != http.StatusAccepted {
+		t.Fatalf("world_off should be accepted, got %d %s", status, resp.Message)
+	}
+	select {
+	case <-requests.marked:
+	case <-time.After(2 * time.Second):
+		t.Fatal("power-off result was never recorded")
+	}
+
+	status, resp := svc.HandleWorldCommand(context.Background(), req)
+	if status != http.StatusOK || !strings.HasSuffix(resp.Message, "is failed error=DOCKER_FAILED") || resp.Code != string(worker.CodeDockerFailed) {
+		t.Fatalf("retry should replay the recorded failure: %d %+v", status, resp)
+	}
+	if n := wm.stops.Load(); n != 1 {
+		t.Fatalf("a retried request_id must not stop the world again, stops=%d", n)
+	}
+}
+
+func TestRequestResubmit_ClonesRejectedRequestAsPending(t *testing.T) {
+	svc, _, _ := newWorldFixture()
+	svc.repos.MapTemplate = &mapTemplateRepoMock{templates: []pgsql.MapTemplate{{ID: 2, Tag: "skyblock", GameVersion: "1.21.1"}}}
+	requests := &userRequestRepoMock{requests: map[int64]pgsql.UserRequest{
+		7: {
+			ID:              7,
+			RequestID:       "req-7",
+			RequestType:     "world_create",
+			ActorUserID:     1,
+			TemplateID:      sql.NullInt64{Int64: 2, Valid: true},
+			RequestedAlias:  sql.NullString{String: "alice_castle", Valid: true},
+			Status:          "rejected",
+			ResponsePayload: mustJSON(createRequestPayload{Template: "skyblock", WorldAlias: "alice_castle", DisplayName: "castle"}),
+		},
+		8: {ID: 8, RequestID: "req-8", RequestType: "world_create", ActorUserID: 1, Status: "pending"},
+	}}
+	svc.repos.UserRequest = requests
+	svc.SetActionCooldown(0)
+	ctx := context.Background()
+	resubmit := func(uuid, name, ident, alias string) (int, WorldCommandResponse) {
+		return svc.HandleWorldCommand(ctx, WorldCommandRequest{
+			Action:     "request_resubmit",
+			ActorUUID:  uuid,
+			ActorName:  name,
+			RequestID:  ident,
+			WorldAlias: alias,
+		})
+	}
+
+	if status, resp := resubmit("uuid-alice", "alice", "#7", ""); status != http.StatusConflict {
+		t.Fatalf("unchanged alias is still taken, got status=%d msg=%s", status, resp.Message)
+	}
+	if status, _ := resubmit("uuid-bob", "bob", "#7", "keep"); status != http.StatusForbidden {
+		t.Fatalf("only the requester may resubmit, got=%d", status)
+	}
+	if status, _ := resubmit("uuid-alice", "alice", "#8", "keep"); status != http.StatusConflict {
+		t.Fatalf("pending request must not be resubmitted, got=%d", status)
+	}
+
+	status, resp := resubmit("uuid-alice", "alice", "#7", "keep")
+	if status != http.StatusOK {
+		t.Fatalf("resubmit failed: status=%d msg=%s", status, resp.Message)
+	}
+	if want := "request resubmitted from #7: #102 world=alice_keep template=#2 skyblock"; resp.Message != want {
+		t.Fatalf("unexpected message:\n got=%s\nwant=%s", resp.Message, want)
+	}
+	fresh := requests.requests[102]
+	if fresh.Status != "pending" || fresh.RequestedAlias.String != "alice_keep" || fresh.TemplateID.Int64 != 2 || fresh.RequestID == "req-7" {
+		t.Fatalf("unexpected new request: %+v", fresh)
+	}
+	var payload createRequestPayload
+	if err := json.Unmarshal(fresh.ResponsePayload, &payload); err != nil || payload.ResubmittedFrom != 7 {
+		t.Fatalf("new request should link back to #7: %s %v", fresh.ResponsePayload, err)
+	}
+	if requests.requests[7].Status != "rejected" {
+		t.Fatalf("original request must stay untouched")
+	}
+
+	requests.requests[9] = pgsql.UserRequest{ID: 9, RequestID: "req-9", RequestType: "world_create", ActorUserID: 1, Status: "pending"}
+	if status, resp := resubmit("uuid-alice", "alice", "#7", "again"); status != http.StatusTooManyRequests {
+		t.Fatalf("pending quota should be enforced, got status=%d msg=%s", status, resp.Message)
+	}
+}
+
+func TestAliasConflict_SuggestsNextFreeAlias(t *testing.T) {
+	svc, instances, _ := newWorldFixture()
+	svc.repos.UserRequest = &userRequestRepoMock{requests: map[int64]pgsql.UserRequest{}}
+	svc.repos.User.(*userRepoMock).users[9] = pgsql.User{ID: 9, MCUUID: "uuid-op", MCName: "op", ServerRole: "admin"}
+	svc.SetActionCooldown(0)
+	instances.instances[6] = pgsql.MapInstance{ID: 6, Alias: "alice_castle2", OwnerID: 1, Status: "Off"}
+	instances.instances[7] = pgsql.MapInstance{ID: 7, Alias: "alice_castle3", OwnerID: 1, Status: "Archived"}
+	instances.instances[8] = pgsql.MapInstance{ID: 8, Alias: "op_castle", OwnerID: 9, Status: "Off"}
+	ctx := context.Background()
+
+	cases := []struct {
+		action, uuid, name, alias, want string
+	}{
+		{"request_create", "uuid-alice", "alice", "castle", "world_alias already exists, try castle4"},
+		{"request_create", "uuid-alice", "alice", "castle2", "world_alias already exists, try castle4"},
+		{"instance_create", "uuid-op", "op", "castle", "world_alias already exists, try castle2"},
+	}
+	for _, c := range cases {
+		status, resp := svc.HandleWorldCommand(ctx, WorldCommandRequest{
+			Action:     c.action,
+			ActorUUID:  c.uuid,
+			ActorName:  c.name,
+			WorldAlias: c.alias,
+		})
+		if status != http.StatusConflict || resp.Message != c.want {
+			t.Fatalf("%s %s: status=%d msg=%q, want %q", c.action, c.alias, status, resp.Message, c.want)
+		}
+	}
+}
+
+func (m *userRequestRepoMock) ListFiltered(ctx context.Context, filter pgsql.UserRequestFilter, page pgsql.Page) ([]pgsql.UserRequest, error) {
+	ids := make([]int64, 0, len(m.requests))
+	for id, r := range m.requests {
+		if filter.Status != "" && r.Status != filter.Status {
+			continue
+		}
+		if filter.ActorUserID != 0 && r.ActorUserID != filter.ActorUserID {
+			continue
+		}
+		if filter.TargetInstanceID != 0 && r.TargetInstanceID.Int64 != filter.TargetInstanceID {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] > ids[j] })
+	start := page.Offset()
+	if start > len(ids) {
+		start = len(ids)
+	}
+	end := start + page.Size
+	if end > len(ids) {
+		end = len(ids)
+	}
+	out := make([]pgsql.UserRequest, 0, end-start)
+	for _, id := range ids[start:end] {
+		out = append(out, m.requests[id])
+	}
+	return out, nil
+}
+
+func TestRequestList_PagesAndFiltersByStatus(t *testing.T) {
+	svc, _, _ := newWorldFixture()
+	svc.SetActionCooldown(0)
+	svc.repos.User.(*userRepoMock).users[9] = pgsql.User{ID: 9, MCUUID: "uuid-op", MCName: "op", ServerRole: "admin"}
+	svc.repos.MapTemplate = &mapTemplateRepoMock{}
+	requests := &userRequestRepoMock{requests: map[int64]pgsql.UserRequest{}}
+	for i := int64(1); i <= 25; i++ {
+		requests.requests[i] = pgsql.UserRequest{ID: i, ActorUserID: 1, Status: "pending"}
+	}
+	requests.requests[30] = pgsql.UserRequest{ID: 30, ActorUserID: 2, Status: "failed"}
+	requests.requests[31] = pgsql.UserRequest{ID: 31, ActorUserID: 2, Status: "processing"}
+	svc.repos.UserRequest = requests
+
+	code, resp := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{Action: "request_list", ActorUUID: "uuid-op", ActorName: "op"})
+	if code != http.StatusOK {
+		t.Fatalf("admin default list: code=%d resp=%+v", code, resp)
+	}
+	if n := strings.Count(resp.Message, ":pending"); n != 20 || !strings.HasPrefix(resp.Message, "#25:pending") {
+		t.Fatalf("default page should be the 20 newest pending requests, got %d: %q", n, resp.Message)
+	}
+
+	code, resp = svc.HandleWorldCommand(context.Background(), WorldCommandRequest{Action: "request_list", ActorUUID: "uuid-op", ActorName: "op", Page: 2})
+	if code != http.StatusOK || strings.Count(resp.Message, ":pending") != 5 || !strings.HasPrefix(resp.Message, "#5:pending") {
+		t.Fatalf("page 2 should hold the 5 oldest pending requests: code=%d resp=%+v", code, resp)
+	}
+
+	code, resp = svc.HandleWorldCommand(context.Background(), WorldCommandRequest{Action: "request_list", ActorUUID: "uuid-op", ActorName: "op", Status: "failed"})
+	if code != http.StatusOK || !strings.HasPrefix(resp.Message, "#30:failed player=bob") || strings.Contains(resp.Message, "pending") {
+		t.Fatalf("status filter: code=%d resp=%+v", code, resp)
+	}
+
+	code, resp = svc.HandleWorldCommand(context.Background(), WorldCommandRequest{Action: "request_list", ActorUUID: "uuid-op", ActorName: "op", Page: 9})
+	if code != http.StatusOK || resp.Message != "no requests on page 9" {
+		t.Fatalf("past the end: code=%d resp=%+v", code, resp)
+	}
+
+	// Non-admins only ever see their own requests, whatever the status.
+	code, resp = svc.HandleWorldCommand(context.Background(), WorldCommandRequest{Action: "request_list", ActorUUID: "uuid-bob", ActorName: "bob", PageSize: 1})
+	if code != http.StatusOK || resp.Message != "#31:processing player=bob world=- template=empty" {
+		t.Fatalf("bob page_size=1: code=%d resp=%+v", code, resp)
+	}
+
+	code, resp = svc.HandleWorldCommand(context.Background(), WorldCommandRequest{Action: "request_list", ActorUUID: "uuid-op", ActorName: "op", Status: "done"})
+	if code != http.StatusBadRequest || resp.Fields["status"] == "" {
+		t.Fatalf("unknown status should be rejected: code=%d resp=%+v", code, resp)
+	}
+	code, resp = svc.HandleWorldCommand(context.Background(), WorldCommandRequest{Action: "request_list", ActorUUID: "uuid-op", ActorName: "op", PageSize: 500})
+	if code != http.StatusBadRequest || resp.Fields["page_size"] == "" {
+		t.Fatalf("oversized page_size should be rejected: code=%d resp=%+v", code, resp)
+	}
+}
+
+// countingUserRepo counts per-id and batched user reads.
+type countingUserRepo struct {
+	*userRepoMock
+	reads, batches int
+}
+
+func (m *countingUserRepo) Read(ctx context.Context, id int64) (pgsql.User, error) {
+	m.reads++
+	return m.userRepoMock.Read(ctx, id)
+}
+
+func (m *countingUserRepo) ReadByIDs(ctx context.Context, ids []int64) (map[int64]pgsql.User, error) {
+	m.batches++
+	return m.userRepoMock.ReadByIDs(ctx, ids)
+}
+
+func TestRequestHistory_FiltersAndBatchesActorNames(t *testing.T) {
+	svc, _, _ := newWorldFixture()
+	svc.repos.User.(*userRepoMock).users[9] = pgsql.User{ID: 9, MCUUID: "uuid-op", MCName: "op", ServerRole: "admin"}
+	users := &countingUserRepo{userRepoMock: svc.repos.User.(*userRepoMock)}
+	svc.repos.User = users
+	svc.repos.MapTemplate = &mapTemplateRepoMock{}
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc.repos.UserRequest = &userRequestRepoMock{requests: map[int64]pgsql.UserRequest{
+		1: {ID: 1, ActorUserID: 1, Status: "succeeded", CreatedAt: at},
+		2: {ID: 2, ActorUserID: 2, Status: "rejected", CreatedAt: at.Add(time.Hour)},
+		3: {ID: 3, ActorUserID: 3, Status: "pending", CreatedAt: at.Add(2 * time.Hour)},
+		4: {ID: 4, ActorUserID: 1, Status: "failed", RequestType: "world_off", ErrorCode: sql.NullString{String: "DOCKER_FAILED", Valid: true}, CreatedAt: at.Add(3 * time.Hour)},
+	}}
+	history := func(uuid, name, status string) (int, WorldCommandResponse) {
+		return svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+			Action: "request_history", ActorUUID: uuid, ActorName: name, Status: status,
+		})
+	}
+
+	if status, _ := history("uuid-alice", "alice", ""); status != http.StatusForbidden {
+		t.Fatalf("request_history is op only, got %d", status)
+	}
+	users.reads, users.batches = 0, 0
+	status, resp := history("uuid-op", "op", "")
+	if status != http.StatusOK {
+		t.Fatalf("request_history failed: %d %s", status, resp.Message)
+	}
+	want := "request history status=all page=1\n" +
+		"#4:failed type=world_off player=alice world=- error=DOCKER_FAILED at=2026-03-01T15:00:00Z\n" +
+		"#3:pending player=carol world=- template=empty at=2026-03-01T14:00:00Z\n" +
+		"#2:rejected player=bob world=- template=empty at=2026-03-01T13:00:00Z\n" +
+		"#1:succeeded player=alice world=- template=empty at=2026-03-01T12:00:00Z"
+	if resp.Message != want {
+		t.Fatalf("unexpected history:\n%s", resp.Message)
+	}
+	if users.batches != 1 || users.reads != 0 {
+		t.Fatalf("actor names should come from one batch, got batches=%d reads=%d", users.batches, users.reads)
+	}
+
+	_, resp = history("uuid-op", "op", "rejected")
+	if !strings.HasPrefix(resp.Message, "request history status=rejected page=1\n#2:rejected") || strings.Count(resp.Message, "\n") != 1 {
+		t.Fatalf("status filter should keep only rejected rows:\n%s", resp.Message)
+	}
+	if status, resp := history("uuid-op", "op", "done"); status != http.StatusBadRequest || resp.Fields["status"] == "" {
+		t.Fatalf("unknown status should be rejected: %d %+v", status, resp)
+	}
+}
+
+func TestWorldTimeline_MergesSourcesInTimeOrder(t *testing.T) {
+	svc, instances, members := newWorldFixture()
+	svc.repos.User.(*userRepoMock).users[9] = pgsql.User{ID: 9, MCUUID: "uuid-op", MCName: "op", ServerRole: "admin"}
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	inst := instances.instances[5]
+	inst.SourceType, inst.GameVersion, inst.CreatedAt = "template", "1.21.1", t0.Add(time.Minute)
+	inst.LastErrorMsg = sql.NullString{String: "docker compose up failed", Valid: true}
+	inst.LastHealthAt = sql.NullTime{Time: t0.Add(5 * time.Hour), Valid: true}
+	inst.ArchivedAt = sql.NullTime{Time: t0.Add(6 * time.Hour), Valid: true}
+	instances.instances[5] = inst
+	members.members[0].CreatedAt = t0.Add(time.Minute)
+	members.members[1].CreatedAt = t0.Add(2 * time.Hour)
+	target := sql.NullInt64{Int64: 5, Valid: true}
+	svc.repos.UserRequest = &userRequestRepoMock{requests: map[int64]pgsql.UserRequest{
+		1: {ID: 1, RequestType: "world_create", ActorUserID: 1, TargetInstanceID: target, Status: "succeeded", CreatedAt: t0, UpdatedAt: t0.Add(time.Minute)},
+		2: {ID: 2, RequestType: "world_on", ActorUserID: 2, TargetInstanceID: target, Status: "failed",
+			ErrorCode: sql.NullString{String: "DOCKER_FAILED", Valid: true}, CreatedAt: t0.Add(3 * time.Hour), UpdatedAt: t0.Add(4 * time.Hour)},
+		3: {ID: 3, RequestType: "world_off", ActorUserID: 3, TargetInstanceID: sql.NullInt64{Int64: 6, Valid: true}, Status: "succeeded", CreatedAt: t0},
+	}}
+	timeline := func(uuid, name string) (int, WorldCommandResponse) {
+		return svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+			Action: "world_timeline", ActorUUID: uuid, ActorName: name, WorldAlias: "alice_castle",
+		})
+	}
+
+	if status, _ := timeline("uuid-alice", "alice"); status != http.StatusForbidden {
+		t.Fatalf("world_timeline is op only, got %d", status)
+	}
+	status, resp := timeline("uuid-op", "op")
+	if status != http.StatusOK {
+		t.Fatalf("world_timeline failed: %d %s", status, resp.Message)
+	}
+	want := strings.Join([]string{
+		"timeline #5:alice_castle",
+		"2026-03-01T12:00:00Z #1 world_create by alice",
+		"2026-03-01T12:01:00Z created source=template version=1.21.1",
+		"2026-03-01T12:01:00Z member alice role=owner",
+		"2026-03-01T12:01:00Z #1 world_create succeeded",
+		"2026-03-01T14:00:00Z member bob role=member",
+		"2026-03-01T15:00:00Z #2 world_on by bob",
+		"2026-03-01T16:00:00Z #2 world_on failed error=DOCKER_FAILED",
+		"2026-03-01T17:00:00Z failed code=DOCKER_FAILED",
+		"2026-03-01T18:00:00Z archived",
+	}, "\n")
+	if resp.Message != want {
+		t.Fatalf("unexpected timeline:\n%s", resp.Message)
+	}
+}
+
+func TestWorldInfo_ReportsUptimeFromStartedOnAt(t *testing.T) {
+	svc, instances, _ := newWorldFixture()
+	inst := instances.instances[5]
+	inst.StartedOnAt = sql.NullTime{Time: time.Now().Add(-(3*time.Hour + 5*time.Minute)), Valid: true}
+	instances.instances[5] = inst
+	info := func() string {
+		_, resp := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+			Action: "world_info", ActorUUID: "uuid-carol", ActorName: "carol", WorldAlias: "alice_castle",
+		})
+		return resp.Message
+	}
+
+	if msg := info(); !strings.Contains(msg, " uptime=3h5m") {
+		t.Fatalf("world_info should report uptime to everyone: %s", msg)
+	}
+
+	inst.Status = "Off"
+	inst.LastActiveAt = sql.NullTime{Time: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), Valid: true}
+	instances.instances[5] = inst
+	if msg := info(); strings.Contains(msg, "uptime=") || !strings.Contains(msg, " last_active=2026-03-01T12:00:00Z") {
+		t.Fatalf("an Off world should report when it last ran instead: %s", msg)
+	}
+
+	for d, want := range map[time.Duration]string{30 * time.Second: "<1m", 59 * time.Minute: "59m", 26*time.Hour + 90*time.Second: "26h1m"} {
+		if got := formatUptime(d); got != want {
+			t.Fatalf("formatUptime(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+type aliasWorkerMock struct {
+	worker.Worker
+	refreshed chan int64
+}
+
+func (m *aliasWorkerMock) RefreshMultiverseAlias(ctx context.Context, instanceID int64) error {
+	m.refreshed <- instanceID
+	return nil
+}
+
+// uniqueAliasRepoMock loses every update to a concurrent writer of the same alias.
+type uniqueAliasRepoMock struct {
+	*mapInstanceRepoMock
+}
+
+func (m uniqueAliasRepoMock) Update(ctx context.Context, inst pgsql.MapInstance) error {
+	return &pgconn.PgError{Code: "23505"}
+}
+
+func TestWorldRename_RejectsTakenAliasAndKeepsOwnerPrefix(t *testing.T) {
+	svc, instances, _ := newWorldFixture()
+	svc.repos.User.(*userRepoMock).users[9] = pgsql.User{ID: 9, MCUUID: "uuid-op", MCName: "op", ServerRole: "admin"}
+	instances.instances[6] = pgsql.MapInstance{ID: 6, Alias: "alice_tower", OwnerID: 1, Status: "Off", AccessMode: "privacy"}
+	wm := &aliasWorkerMock{refreshed: make(chan int64, 4)}
+	svc.worker = wm
+	rename := func(uuid, name, world, newAlias string) (int, WorldCommandResponse) {
+		return svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+			Action: "world_rename", ActorUUID: uuid, ActorName: name, WorldAlias: world, NewAlias: newAlias,
+		})
+	}
+
+	if status, _ := rename("uuid-bob", "bob", "alice_castle", "keep"); status != http.StatusForbidden {
+		t.Fatalf("a plain member cannot rename, got %d", status)
+	}
+	if status, resp := rename("uuid-alice", "alice", "alice_castle", "bad:name"); status != http.StatusBadRequest || resp.Fields["new_alias"] == "" {
+		t.Fatalf("invalid alias should be rejected: %d %+v", status, resp)
+	}
+	status, resp := rename("uuid-alice", "alice", "alice_castle", "tower")
+	if status != http.StatusConflict || resp.Message != "world_alias already exists, try tower2" {
+		t.Fatalf("taken alias should conflict: %d %s", status, resp.Message)
+	}
+	if instances.instances[5].Alias != "alice_castle" {
+		t.Fatalf("a conflicting rename must not change the alias: %+v", instances.instances[5])
+	}
+
+	status, resp = rename("uuid-alice", "alice", "alice_castle", "keep")
+	if status != http.StatusOK || resp.Message != "world alias changed: #5:alice_castle -> alice_keep" {
+		t.Fatalf("rename failed: %d %s", status, resp.Message)
+	}
+	if instances.instances[5].Alias != "alice_keep" {
+		t.Fatalf("running world should be renamed, alias=%s", instances.instances[5].Alias)
+	}
+	select {
+	case id := <-wm.refreshed:
+		if id != 5 {
+			t.Fatalf("refreshed the wrong instance: %d", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("running world should get its Multiverse alias refreshed")
+	}
+
+	status, resp = rename("uuid-op", "op", "#6", "fort")
+	if status != http.StatusOK || instances.instances[6].Alias != "alice_fort" {
+		t.Fatalf("an admin rename should keep the owner's prefix: %d %s alias=%s", status, resp.Message, instances.instances[6].Alias)
+	}
+	select {
+	case id := <-wm.refreshed:
+		t.Fatalf("an Off world needs no refresh, refreshed=%d", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	svc.repos.MapInstance = uniqueAliasRepoMock{instances}
+	status, resp = rename("uuid-alice", "alice", "alice_keep", "gate")
+	if status != http.StatusConflict || !strings.HasPrefix(resp.Message, "world_alias already exists") {
+		t.Fatalf("losing a concurrent rename should conflict, got %d %s", status, resp.Message)
+	}
+}
+
+func TestServerTapConnectors_UseConfiguredTLS(t *testing.T) {
+	tap := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer tap.Close()
+	svc, instances, _ := newWorldFixture()
+	svc.instanceTapPattern = tap.URL + "/inst-%d"
+	svc.lobbyTapURL = tap.URL
+	ctx := context.Background()
+	list := servertap.ExecuteRequest{Command: "list"}
+
+	conn, err := svc.instanceConnector(instances.instances[5])
+	if err != nil {
+		t.Fatalf("instance connector: %v", err)
+	}
+	if _, err := conn.Execute(ctx, list); err == nil {
+		t.Fatalf("a self-signed endpoint should be refused without TLS options")
+	}
+
+	svc.SetServerTapTLS(servertap.TLSOptions{InsecureSkipVerify: true})
+	if conn, err = svc.instanceConnector(instances.instances[5]); err != nil {
+		t.Fatalf("instance connector: %v", err)
+	}
+	if _, err := conn.Execute(ctx, list); err != nil {
+		t.Fatalf("instance call should honour insecure_skip_verify: %v", err)
+	}
+	lobby, err := svc.lobbyConnector()
+	if err != nil {
+		t.Fatalf("lobby connector: %v", err)
+	}
+	if _, err := lobby.Execute(ctx, list); err != nil {
+		t.Fatalf("lobby call should honour insecure_skip_verify: %v", err)
+	}
+}
+
+type opGrantWorkerMock struct {
+	worker.Worker
+	granted []string
+}
+
+func (m *opGrantWorkerMock) AllowAndOpUser(ctx context.Context, mcName string) ([]int64, error) {
+	m.granted = append(m.granted, mcName)
+	return []int64{5}, nil
+}
+
+func TestPlayerSetRole_PromotesAndGrantsOp(t *testing.T) {
+	svc, _, _ := newWorldFixture()
+	users := svc.repos.User.(*userRepoMock)
+	users.users[4] = pgsql.User{ID: 4, MCUUID: "uuid-op", MCName: "op", ServerRole: "admin"}
+	w := &opGrantWorkerMock{}
+	svc.worker = w
+	setRole := func(uuid, name, target, role string) (int, WorldCommandResponse) {
+		return svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+			Action: "player_set_role", ActorUUID: uuid, ActorName: name, Target: target, Role: role,
+		})
+	}
+
+	if code, resp := setRole("uuid-op", "op", "carol", "admin"); code != http.StatusOK || !strings.Contains(resp.Message, "op granted on 1 running instances") {
+		t.Fatalf("promote: code=%d resp=%+v", code, resp)
+	}
+	if users.users[3].ServerRole != "admin" || len(w.granted) != 1 || w.granted[0] != "carol" {
+		t.Fatalf("carol should be admin with op granted, role=%s granted=%v", users.users[3].ServerRole, w.granted)
+	}
+
+	if code, resp := setRole("uuid-op", "op", "carol", "user"); code != http.StatusOK || resp.Message != "carol is now user" {
+		t.Fatalf("demote: code=%d resp=%+v", code, resp)
+	}
+	if users.users[3].ServerRole != "user" || len(w.granted) != 1 {
+		t.Fatalf("demotion should not grant op, role=%s granted=%v", users.users[3].ServerRole, w.granted)
+	}
+
+	if code, resp := setRole("uuid-op", "op", "op", "user"); code != http.StatusConflict || resp.Message != "cannot demote the last admin" {
+		t.Fatalf("last admin: code=%d resp=%+v", code, resp)
+	}
+	if code, resp := setRole("uuid-op", "op", "nobody", "admin"); code != http.StatusNotFound {
+		t.Fatalf("unknown target: code=%d resp=%+v", code, resp)
+	}
+	if code, resp := setRole("uuid-op", "op", "carol", "owner"); code != http.StatusBadRequest || resp.Fields["role"] == "" {
+		t.Fatalf("bad role: code=%d resp=%+v", code, resp)
+	}
+}
+
+func TestPlayerSetRole_OpOnly(t *testing.T) {
+	svc, _, _ := newWorldFixture()
+	w := &opGrantWorkerMock{}
+	svc.worker = w
+
+	code, resp := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+		Action: "player_set_role", ActorUUID: "uuid-alice", ActorName: "alice", Target: "alice", Role: "admin",
+	})
+	if code != http.StatusForbidden || resp.Message != "op only" {
+		t.Fatalf("non-admin should be refused: code=%d resp=%+v", code, resp)
+	}
+	if svc.repos.User.(*userRepoMock).users[1].ServerRole != "user" || len(w.granted) != 0 {
+		t.Fatalf("a refused promotion must not change anything")
+	}
+}
+
+type capacityWorkerMock struct {
+	worker.Worker
+	report worker.CapacityReport
+}
+
+func (m *capacityWorkerMock) Capacity(ctx context.Context) (worker.CapacityReport, error) {
+	return m.report, nil
+}
+
+func TestCapacity_OpOnlyAndFormatsReport(t *testing.T) {
+	svc, _, _ := newWorldFixture()
+	svc.repos.User.(*userRepoMock).users[9] = pgsql.User{ID: 9, MCUUID: "uuid-op", MCName: "op", ServerRole: "admin"}
+	svc.worker = &capacityWorkerMock{report: worker.CapacityReport{
+		TotalInstances:   4,
+		RunningInstances: 2,
+		RunningHeapMB:    6144,
+		UnlimitedRunning: 1,
+		HostMemoryMB:     16384,
+		InstanceDiskFree: 50 << 30,
+		ArchiveDiskFree:  10 << 30,
+		StartSlotsInUse:  1,
+		StartSlotsTotal:  3,
+	}}
+
+	code, _ := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{Action: "capacity", ActorUUID: "uuid-alice", ActorName: "alice"})
+	if code != http.StatusForbidden {
+		t.Fatalf("capacity should be op only, got %d", code)
+	}
+	code, resp := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{Action: "capacity", ActorUUID: "uuid-op", ActorName: "op"})
+	want := "capacity: instances=4 running=2 heap=6144MB/16384MB host (+1 unlimited) disk_free instance=51200MB archive=10240MB start_slots=1/3"
+	if code != http.StatusOK || resp.Message != want {
+		t.Fatalf("unexpected capacity: %d %s", code, resp.Message)
+	}
+}
+
+func TestInstanceByServer_ResolvesConfiguredPrefix(t *testing.T) {
+	svc, _, _ := newWorldFixture()
+	svc.SetServerIDPrefix("world-")
+	lookup := func(serverID string) (int, WorldCommandResponse) {
+		return svc.HandleWorldCommand(context.Background(), WorldCommandRequest{
+			Action: "instance_by_server", ActorUUID: "uuid-bob", ActorName: "bob", ServerID: serverID,
+		})
+	}
+
+	code, resp := lookup("world-5")
+	if code != http.StatusOK || resp.Message != "server_id=world-5 instance=#5 alias=alice_castle status=On" {
+		t.Fatalf("unexpected lookup: %d %s", code, resp.Message)
+	}
+	if code, resp = lookup("mcmm-inst-5"); code != http.StatusBadRequest || resp.Fields["server_id"] == "" {
+		t.Fatalf("other prefixes should be rejected, got %d %+v", code, resp)
+	}
+	if code, _ = lookup("world-99"); code != http.StatusNotFound {
+		t.Fatalf("unknown instance should be 404, got %d", code)
+	}
+}
+
+func TestWorldInfo_ShowsDiagnosticsToAdminsOnly(t *testing.T) {
+	svc, instances, _ := newWorldFixture()
+	svc.repos.User.(*userRepoMock).users[9] = pgsql.User{ID: 9, MCUUID: "uuid-op", MCName: "op", ServerRole: "admin"}
+	inst := instances.instances[5]
+	inst.HealthStatus = "start_failed"
+	inst.GameVersion = "1.21.1"
+	inst.SourceType = "template"
+	inst.LastHealthAt = sql.NullTime{Time: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), Valid: true}
+	inst.LastErrorMsg = sql.NullString{String: "start compose: exit status 1", Valid: true}
+	instances.instances[5] = inst
+	info := func(uuid, name string) string {
+		_, resp := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{Action: "world_info", ActorUUID: uuid, ActorName: name, WorldAlias: "#5"})
+		return resp.Message
+	}
+
+	want := "health_status=start_failed game_version=1.21.1 source_type=template last_health_at=2026-03-01T12:00:00Z last_error_code=WORKER_ERROR last_error=start compose: exit status 1"
+	if msg := info("uuid-op", "op"); !strings.HasSuffix(msg, want) {
+		t.Fatalf("admin should see diagnostics, got %s", msg)
+	}
+	for _, who := range [][2]string{{"uuid-alice", "alice"}, {"uuid-bob", "bob"}} {
+		if msg := info(who[0], who[1]); strings.Contains(msg, "health_status=") || strings.Contains(msg, "last_error=") {
+			t.Fatalf("%s must not see diagnostics: %s", who[1], msg)
+		}
+	}
+}
+
+type bulkPowerWorkerMock struct {
+	worker.Worker
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+	stopped  []int64
+	done     chan int64
+}
+
+func (m *bulkPowerWorkerMock) StopOnly(ctx context.Context, instanceID int64) error {
+	m.mu.Lock()
+	m.inFlight++
+	m.peak = max(m.peak, m.inFlight)
+	m.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	m.mu.Lock()
+	m.inFlight--
+	m.stopped = append(m.stopped, instanceID)
+	m.mu.Unlock()
+	m.done <- instanceID
+	return nil
+}
+
+func TestInstanceStopAll_StopsOnlyRunningWithinConcurrency(t *testing.T) {
+	svc, instances, _ := newWorldFixture()
+	svc.repos.User.(*userRepoMock).users[9] = pgsql.User{ID: 9, MCUUID: "uuid-op", MCName: "op", ServerRole: "admin"}
+	for id, status := range map[int64]string{6: "On", 7: "Off", 8: "On", 9: "Archived", 10: "On", 11: "Starting", 12: "On"} {
+		instances.instances[id] = pgsql.MapInstance{ID: id, Alias: fmt.Sprintf("w%d", id), OwnerID: 1, Status: status}
+	}
+	wm := &bulkPowerWorkerMock{done: make(chan int64, 10)}
+	svc.worker = wm
+	svc.SetBulkPowerConcurrency(2)
+
+	code, resp := svc.HandleWorldCommand(context.Background(), WorldCommandRequest{Action: "instance_stop_all", ActorUUID: "uuid-alice", ActorName: "alice"})
+	if code != http.StatusForbidden {
+		t.Fatalf("stop all should be op only, got %d", code)
+	}
+	code, resp = svc.HandleWorldCommand(context.Background(), WorldCommandRequest{Action: "instance_stop_all", ActorUUID: "uuid-op", ActorName: "op"})
+	if code != http.StatusAccepted || resp.Message != "instance stop queued for 5 instances (2 at a time)" {
+		t.Fatalf("unexpected response: %d %s", code, resp.Message)
+	}
+	for i := 0; i < 5; i++ {
+		select {
+		case <-wm.done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for stops, got %v", wm.stopped)
+		}
+	}
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	slices.Sort(wm.stopped)
+	if !slices.Equal(wm.stopped, []int64{5, 6, 8, 10, 12}) {
+		t.Fatalf("only On instances should be stopped, got %v", wm.stopped)
+	}
+	if wm.peak > 2 {
+		t.Fatalf("at most 2 stops should run at once, peak=%d", wm.peak)
+	}
+}
@@ -0,0 +1,158 @@
+package cmdreceiver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"mcmm/internal/servertap"
+)
+
+// NotifyEvent is one notification. Recipients are the resolved player names;
+// Kind and Fields are for machine consumers such as webhooks.
+type NotifyEvent struct {
+	Kind       string
+	Message    string
+	Recipients []string
+	Fields     map[string]string
+	Time       time.Time
+}
+
+// Notifier delivers a NotifyEvent to one channel.
+type Notifier interface {
+	Notify(ctx context.Context, ev NotifyEvent) error
+}
+
+// ServerTapNotifier tells the message to every recipient through the lobby
+// ServerTap, one `tell` command per player. Up to concurrency tells run at
+// once and each is bounded by sendTimeout, so one slow player does not
+// stall the rest.
+type ServerTapNotifier struct {
+	connect     func() (servertap.Executor, error)
+	concurrency int
+	sendTimeout time.Duration
+}
+
+const (
+	defaultNotifyConcurrency = 4
+	defaultNotifySendTimeout = 5 * time.Second
+)
+
+func NewServerTapNotifier(connect func() (servertap.Executor, error)) *ServerTapNotifier {
+	return &ServerTapNotifier{
+		connect:     connect,
+		concurrency: defaultNotifyConcurrency,
+		sendTimeout: defaultNotifySendTimeout,
+	}
+}
+
+// SetLimits changes how many tells run in parallel and how long each may
+// take. Non-positive values restore the defaults.
+func (n *ServerTapNotifier) SetLimits(concurrency int, sendTimeout time.Duration) {
+	if concurrency <= 0 {
+		concurrency = defaultNotifyConcurrency
+	}
+	if sendTimeout <= 0 {
+		sendTimeout = defaultNotifySendTimeout
+	}
+	n.concurrency = concurrency
+	n.sendTimeout = sendTimeout
+}
+
+func (n *ServerTapNotifier) Notify(ctx context.Context, ev NotifyEvent) error {
+	if len(ev.Recipients) == 0 {
+		return nil
+	}
+	conn, err := n.connect()
+	if err != nil {
+		return fmt.Errorf("lobby connector: %w", err)
+	}
+	errs := make([]error, len(ev.Recipients))
+	sem := make(chan struct{}, n.concurrency)
+	var wg sync.WaitGroup
+	for i, name := range ev.Recipients {
+		cmd, err := servertap.NewCommandBuilder("tell").PlayerArg(name).RawArg(ev.Message).BuildChecked()
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			// Canceled while waiting for a slot: the rest are not sent.
+			for j := i; j < len(ev.Recipients); j++ {
+				errs[j] = fmt.Errorf("tell %s: %w", ev.Recipients[j], ctx.Err())
+			}
+			wg.Wait()
+			return errors.Join(errs...)
+		}
+		wg.Add(1)
+		go func(i int, name, cmd string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			sendCtx, cancel := context.WithTimeout(ctx, n.sendTimeout)
+			defer cancel()
+			if _, err := conn.Execute(sendCtx, servertap.ExecuteRequest{Command: cmd}); err != nil {
+				errs[i] = fmt.Errorf("tell %s: %w", name, err)
+			}
+		}(i, name, cmd)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// WebhookNotifier POSTs each event as JSON. The message is also sent as
+// `content`, so a Discord webhook URL works without an adapter.
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+type webhookPayload struct {
+	Content    string            `json:"content"`
+	Event      string            `json:"event"`
+	Recipients []string          `json:"recipients,omitempty"`
+	Fields     map[string]string `json:"fields,omitempty"`
+	Time       string            `json:"time"`
+}
+
+func NewWebhookNotifier(url string, timeout time.Duration) *WebhookNotifier {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &WebhookNotifier{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, ev NotifyEvent) error {
+	body, err := json.Marshal(webhookPayload{
+		Content:    ev.Message,
+		Event:      ev.Kind,
+		Recipients: ev.Recipients,
+		Fields:     ev.Fields,
+		Time:       ev.Time.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package cmdreceiver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mcmm/internal/pgsql"
+	"mcmm/internal/servertap"
+)
+
+func TestWebhookNotifier_PostsJSONPayload(t *testing.T) {
+	var got map[string]any
+	var contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("unexpected method %s", r.Method)
+		}
+		contentType = r.Header.Get("Content-Type")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	n := NewWebhookNotifier(srv.URL, time.Second)
+	err := n.Notify(context.Background(), NotifyEvent{
+		Kind:       "request_created",
+		Message:    "[MCMM] req#7 from alice world=alice_castle template=empty",
+		Recipients: []string{"op"},
+		Fields:     map[string]string{"request_no": "7"},
+		Time:       time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("notify failed: %v", err)
+	}
+	if contentType != "application/json" {
+		t.Fatalf("unexpected content type: %s", contentType)
+	}
+	if got["event"] != "request_created" || got["time"] != "2026-03-01T12:00:00Z" {
+		t.Fatalf("unexpected payload: %v", got)
+	}
+	if !strings.HasPrefix(got["content"].(string), "[MCMM] req#7") {
+		t.Fatalf("content should carry the message: %v", got["content"])
+	}
+	if fields := got["fields"].(map[string]any); fields["request_no"] != "7" {
+		t.Fatalf("unexpected fields: %v", fields)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	if err := NewWebhookNotifier(failing.URL, time.Second).Notify(context.Background(), NotifyEvent{Kind: "x"}); err == nil {
+		t.Fatalf("non-2xx response should be an error")
+	}
+}
+
+type recordingNotifier struct {
+	events []NotifyEvent
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, ev NotifyEvent) error {
+	n.events = append(n.events, ev)
+	return nil
+}
+
+func TestNotifyEvent_WebhookOnlyForRequestEvents(t *testing.T) {
+	users := &userRepoMock{users: map[int64]pgsql.User{
+		1: {ID: 1, MCUUID: "uuid-op", MCName: "op", ServerRole: "admin"},
+	}}
+	svc := NewServiceI(pgsql.Repos{User: users}, nil, "", "", "", "", "", "", "", "")
+	hook := &recordingNotifier{}
+	svc.SetWebhookNotifier(hook, true)
+
+	svc.notifyLobbyAdminsRequestCreated(context.Background(), "alice", "alice_castle", "", 7)
+	svc.notifyTargets(context.Background(), NotifyTargets{Admins: true}, "[MCMM] instance on completed")
+
+	if len(hook.events) != 1 {
+		t.Fatalf("only request events should reach the webhook: %+v", hook.events)
+	}
+	ev := hook.events[0]
+	if ev.Kind != "request_created" || ev.Fields["template"] != "empty" || strings.Join(ev.Recipients, ",") != "op" {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+}
+
+// slowTellExecutor answers every tell after delay; a tell to "stuck" blocks
+// until its context is done.
+type slowTellExecutor struct {
+	delay time.Duration
+	mu    sync.Mutex
+	told  []string
+}
+
+func (e *slowTellExecutor) Execute(ctx context.Context, req servertap.ExecuteRequest) (servertap.ParsedResponse, error) {
+	if strings.HasPrefix(req.Command, "tell stuck ") {
+		<-ctx.Done()
+		return servertap.ParsedResponse{}, ctx.Err()
+	}
+	time.Sleep(e.delay)
+	e.mu.Lock()
+	e.told = append(e.told, strings.Fields(req.Command)[1])
+	e.mu.Unlock()
+	return servertap.ParsedResponse{}, nil
+}
+
+func TestServerTapNotifier_TellsInParallelWithTimeout(t *testing.T) {
+	exec := &slowTellExecutor{delay: 50 * time.Millisecond}
+	n := NewServerTapNotifier(func() (servertap.Executor, error) { return exec, nil })
+	n.SetLimits(10, 200*time.Millisecond)
+
+	recipients := []string{"stuck"}
+	for i := 0; i < 20; i++ {
+		recipients = append(recipients, fmt.Sprintf("player%d", i))
+	}
+	start := time.Now()
+	err := n.Notify(context.Background(), NotifyEvent{Kind: "message", Message: "hello", Recipients: recipients})
+	elapsed := time.Since(start)
+
+	// Serially this would take 20*50ms plus the stuck tell's timeout.
+	if elapsed > 600*time.Millisecond {
+		t.Fatalf("notify took too long: %s", elapsed)
+	}
+	if err == nil || !strings.Contains(err.Error(), "tell stuck") {
+		t.Fatalf("expected the stuck tell to time out, got %v", err)
+	}
+	exec.mu.Lock()
+	defer exec.mu.Unlock()
+	if len(exec.told) != 20 {
+		t.Fatalf("expected 20 players told, got %d: %v", len(exec.told), exec.told)
+	}
+}
+
+// lingeringTellExecutor blocks "tell stuck" until its context ends and then
+// holds the slot a little longer; other tells are only recorded.
+type lingeringTellExecutor struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (e *lingeringTellExecutor) Execute(ctx context.Context, req servertap.ExecuteRequest) (servertap.ParsedResponse, error) {
+	if strings.HasPrefix(req.Command, "tell stuck ") {
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond)
+		return servertap.ParsedResponse{}, ctx.Err()
+	}
+	e.mu.Lock()
+	e.calls = append(e.calls, strings.Fields(req.Command)[1])
+	e.mu.Unlock()
+	return servertap.ParsedResponse{}, nil
+}
+
+func TestServerTapNotifier_StopsWaitingForSlotWhenCanceled(t *testing.T) {
+	exec := &lingeringTellExecutor{}
+	n := NewServerTapNotifier(func() (servertap.Executor, error) { return exec, nil })
+	n.SetLimits(1, time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := n.Notify(ctx, NotifyEvent{Kind: "message", Message: "hello", Recipients: []string{"stuck", "alice", "bob"}})
+	if err == nil {
+		t.Fatalf("expected an error for the unsent recipients")
+	}
+	for _, want := range []string{"tell alice: context deadline exceeded", "tell bob: context deadline exceeded"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("missing %q in %v", want, err)
+		}
+	}
+	exec.mu.Lock()
+	defer exec.mu.Unlock()
+	if len(exec.calls) != 0 {
+		t.Fatalf("no tell should be sent after cancel, got %v", exec.calls)
+	}
+}
@@ -3,8 +3,12 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
 	"strings"
 
 	ilog "mcmm/internal/log"
@@ -13,27 +17,89 @@ import (
 )
 
 type Config struct {
-	HTTPAddr            string         `yaml:"http_addr"`
-	DBURL               string         `yaml:"database_url"`
-	LobbyServerTapURL   string         `yaml:"lobby_servertap_url"`
-	ProxyBridgeURL      string         `yaml:"proxy_bridge_url"`
-	ProxyAuthHeader     string         `yaml:"proxy_auth_header"`
-	ProxyAuthToken      string         `yaml:"proxy_auth_token"`
-	ServerTapKey        string         `yaml:"servertap_key"`
-	ServerTapAuthHeader string         `yaml:"servertap_auth_header"`
-	OffHour             int            `yaml:"off_hour"`
-	RemoveDay           int            `yaml:"remove_day"`
-	MiniServerTapPort   int            `yaml:"mini_servertap_port"`
-	MiniTapHostPattern  string         `yaml:"mini_servertap_host_pattern"`
-	InstanceNetwork     string         `yaml:"instance_network"`
-	TemplateRootPath    string         `yaml:"template_root_path"`
-	VersionRootPath     string         `yaml:"version_root_path"`
-	InstanceRootPath    string         `yaml:"instance_root_path"`
-	ArchiveRootPath     string         `yaml:"archive_root_path"`
-	BootstrapAdminName  string         `yaml:"bootstrap_admin_name"`
-	BootstrapAdminUUID  string         `yaml:"bootstrap_admin_uuid"`
-	ServerPath          string         `yaml:"serverpath"`
-	Servers             []ServerConfig `yaml:"servers"`
+	HTTPAddr                string         `yaml:"http_addr"`
+	LogFormat               string         `yaml:"log_format"`
+	DBURL                   string         `yaml:"database_url"`
+	DBMaxOpenConns          int            `yaml:"db_max_open_conns"`
+	DBMaxIdleConns          int            `yaml:"db_max_idle_conns"`
+	DBConnMaxLifetimeSec    int            `yaml:"db_conn_max_lifetime_seconds"`
+	LobbyServerTapURL       string         `yaml:"lobby_servertap_url"`
+	ProxyBridgeURL          string         `yaml:"proxy_bridge_url"`
+	ProxyAuthHeader         string         `yaml:"proxy_auth_header"`
+	ProxyAuthToken          string         `yaml:"proxy_auth_token"`
+	AdminAuthHeader         string         `yaml:"admin_auth_header"`
+	AdminToken              string         `yaml:"admin_token"`
+	ServerTapKey            string         `yaml:"servertap_key"`
+	ServerTapAuthHeader     string         `yaml:"servertap_auth_header"`
+	InstanceKeySecret       string         `yaml:"instance_key_secret"`
+	ServerTapCAFile         string         `yaml:"servertap_ca_file"`
+	ServerTapInsecure       bool           `yaml:"servertap_tls_insecure_skip_verify"`
+	ServerTapPreflight      bool           `yaml:"servertap_preflight"`
+	NotifyWebhookURL        string         `yaml:"notify_webhook_url"`
+	NotifyWebhookOnly       bool           `yaml:"notify_webhook_only"`
+	NotifyConcurrency       int            `yaml:"notify_concurrency"`
+	NotifyTellTimeoutSec    int            `yaml:"notify_tell_timeout_seconds"`
+	OffHour                 int            `yaml:"off_hour"`
+	RemoveDay               int            `yaml:"remove_day"`
+	IdleGraceMinutes        int            `yaml:"idle_grace_minutes"`
+	IdleWarningMinutes      int            `yaml:"idle_warning_minutes"`
+	IdleOffMessage          string         `yaml:"idle_off_message"`
+	LockdownKickMessage     string         `yaml:"lockdown_kick_message"`
+	RequestRetentionDay     int            `yaml:"request_retention_days"`
+	RequestExpiryHours      int            `yaml:"request_expiry_hours"`
+	HealthStaleMinutes      int            `yaml:"health_stale_minutes"`
+	AutoRecoverAttempts     int            `yaml:"auto_recover_attempts"`
+	AutoRecoverWindowMin    int            `yaml:"auto_recover_window_minutes"`
+	DrainTimeoutSec         int            `yaml:"drain_timeout_seconds"`
+	PreStopTimeoutSec       int            `yaml:"pre_stop_timeout_seconds"`
+	LobbySetupAttempts      int            `yaml:"lobby_setup_attempts"`
+	LobbySetupIntervalSec   int            `yaml:"lobby_setup_interval_seconds"`
+	StorageTypes            []string       `yaml:"storage_types"`
+	DefaultStorageType      string         `yaml:"default_storage_type"`
+	ServerIDPrefix          string         `yaml:"server_id_prefix"`
+	BulkPowerConcurrency    int            `yaml:"bulk_power_concurrency"`
+	DisabledActions         []string       `yaml:"disabled_actions"`
+	MaxConcurrentStarts     int            `yaml:"max_concurrent_starts"`
+	MultiverseImport        bool           `yaml:"multiverse_import"`
+	StartMaxAttempts        int            `yaml:"start_max_attempts"`
+	StartRetryBackoffSec    int            `yaml:"start_retry_backoff_seconds"`
+	ServerTapMaxRetries     int            `yaml:"servertap_max_retries"`
+	ServerTapRetryBaseSec   int            `yaml:"servertap_retry_base_seconds"`
+	ServerTapRetryMaxSec    int            `yaml:"servertap_retry_max_seconds"`
+	PurgeBootstrapInstances bool           `yaml:"purge_bootstrap_instances"`
+	OrphanOwnerName         string         `yaml:"orphan_owner_name"`
+	PlayerNamePattern       string         `yaml:"player_name_pattern"`
+	StarterWorld            bool           `yaml:"starter_world"`
+	DefaultTemplateTag      string         `yaml:"default_template_tag"`
+	StarterWorldQuota       int            `yaml:"starter_world_quota"`
+	CommandCooldownSec      int            `yaml:"command_cooldown_seconds"`
+	MiniServerTapPort       int            `yaml:"mini_servertap_port"`
+	MiniTapHostPattern      string         `yaml:"mini_servertap_host_pattern"`
+	InstanceNetwork         string         `yaml:"instance_network"`
+	HostPortMin             int            `yaml:"host_port_min"`
+	HostPortMax             int            `yaml:"host_port_max"`
+	InstanceCPULimit        float64        `yaml:"instance_cpu_limit"`
+	InstanceMemLimitMB      int            `yaml:"instance_mem_limit_mb"`
+	PostCreateHookEnabled   bool           `yaml:"post_create_hook_enabled"`
+	PostCreateHook          string         `yaml:"post_create_hook"`
+	PostCreateHookTimeoutS  int            `yaml:"post_create_hook_timeout_seconds"`
+	PreDestroyHookEnabled   bool           `yaml:"pre_destroy_hook_enabled"`
+	PreDestroyHook          string         `yaml:"pre_destroy_hook"`
+	PreDestroyHookTimeoutS  int            `yaml:"pre_destroy_hook_timeout_seconds"`
+	PreDestroyHookAbort     bool           `yaml:"pre_destroy_hook_abort_on_failure"`
+	TemplateRootPath        string         `yaml:"template_root_path"`
+	VersionRootPath         string         `yaml:"version_root_path"`
+	InstanceRootPath        string         `yaml:"instance_root_path"`
+	ArchiveRootPath         string         `yaml:"archive_root_path"`
+	StagingRootPath         string         `yaml:"staging_root_path"`
+	StagingSweepHours       int            `yaml:"staging_sweep_hours"`
+	MaxArchiveBytes         int64          `yaml:"max_archive_bytes"`
+	ArchivePruneNoticeDay   int            `yaml:"archive_prune_notice_days"`
+	BootstrapAdminName      string         `yaml:"bootstrap_admin_name"`
+	BootstrapAdminUUID      string         `yaml:"bootstrap_admin_uuid"`
+	BootstrapAdminResolve   bool           `yaml:"bootstrap_admin_resolve_uuid"`
+	ServerPath              string         `yaml:"serverpath"`
+	Servers                 []ServerConfig `yaml:"servers"`
 }
 
 type ServerConfig struct {
@@ -47,43 +113,129 @@ type ServerConfig struct {
 	Enabled             bool   `yaml:"enabled"`
 }
 
+// Load reads CONFIG_PATH (or the resolved default path) and merges any files
+// listed in CONFIG_OVERRIDE_PATHS on top, in order.
 func Load() (Config, error) {
 	logger := ilog.Component("config")
-	if p := os.Getenv("CONFIG_PATH"); p != "" {
-		logger.Infof("CONFIG_PATH is set, loading: %s", p)
-		return LoadFromFile(p)
+	path := os.Getenv("CONFIG_PATH")
+	if path != "" {
+		logger.Infof("CONFIG_PATH is set, loading: %s", path)
+	} else {
+		path = resolveDefaultConfigPath()
+		logger.Infof("using resolved config path: %s", path)
+	}
+	paths := []string{path}
+	for _, p := range filepath.SplitList(os.Getenv("CONFIG_OVERRIDE_PATHS")) {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
 	}
-	path := resolveDefaultConfigPath()
-	logger.Infof("using resolved config path: %s", path)
-	return LoadFromFile(path)
+	return LoadWithOverrides(paths...)
 }
 
 func LoadFromFile(path string) (Config, error) {
+	return LoadWithOverrides(path)
+}
+
+// LoadWithOverrides deep-merges the YAML files in order, later files winning,
+// and validates the result. Mappings merge key by key; scalars and lists
+// (such as servers) are replaced whole.
+func LoadWithOverrides(paths ...string) (Config, error) {
 	logger := ilog.Component("config")
-	logger.Infof("reading config file: %s", path)
-	b, err := os.ReadFile(path)
-	if err != nil {
-		logger.Errorf("read failed: %v", err)
-		return Config{}, fmt.Errorf("failed to read config %s: %w", path, err)
+	if len(paths) == 0 {
+		return Config{}, errors.New("no config path given")
 	}
+	merged := map[string]any{}
+	for _, path := range paths {
+		logger.Infof("reading config file: %s", path)
+		b, err := os.ReadFile(path)
+		if err != nil {
+			logger.Errorf("read failed: %v", err)
+			return Config{}, fmt.Errorf("failed to read config %s: %w", path, err)
+		}
+		var doc map[string]any
+		logger.Infof("parsing yaml")
+		if err := yaml.Unmarshal(b, &doc); err != nil {
+			logger.Errorf("yaml parse failed: %v", err)
+			return Config{}, fmt.Errorf("failed to parse yaml %s: %w", path, err)
+		}
+		mergeYAML(merged, doc)
+	}
+	name := strings.Join(paths, ", ")
 
-	var cfg Config
-	logger.Infof("parsing yaml")
+	b, err := yaml.Marshal(merged)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to merge config %s: %w", name, err)
+	}
+	cfg := unsetConfig()
 	if err := yaml.Unmarshal(b, &cfg); err != nil {
-		logger.Errorf("yaml parse failed: %v", err)
-		return Config{}, fmt.Errorf("failed to parse yaml %s: %w", path, err)
+		logger.Errorf("yaml decode failed: %v", err)
+		return Config{}, fmt.Errorf("failed to parse yaml %s: %w", name, err)
 	}
 
 	logger.Infof("validating fields")
 	if err := cfg.Validate(); err != nil {
 		logger.Errorf("validation failed: %v", err)
-		return Config{}, fmt.Errorf("invalid config %s: %w", path, err)
+		return Config{}, fmt.Errorf("invalid config %s: %w", name, err)
 	}
 
-	logger.Infof("config loaded successfully (http_addr=%s)", cfg.HTTPAddr)
+	logger.Infof("config loaded successfully (http_addr=%s, files=%d)", cfg.HTTPAddr, len(paths))
 	return cfg, nil
 }
 
+// unsetInt marks an int key the files did not set. It is used for keys where
+// an explicit 0 turns a feature off, so Validate can still tell "0" from
+// "missing" and only default the latter.
+const unsetInt = -1
+
+// unsetConfig is the Config YAML is decoded into; keys absent from every
+// file keep these markers.
+func unsetConfig() Config {
+	return Config{RequestExpiryHours: unsetInt, CommandCooldownSec: unsetInt, RequestRetentionDay: unsetInt, ArchivePruneNoticeDay: unsetInt}
+}
+
+func mergeYAML(dst, src map[string]any) {
+	for k, v := range src {
+		if sv, ok := v.(map[string]any); ok {
+			if dv, ok := dst[k].(map[string]any); ok {
+				mergeYAML(dv, sv)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
+// normalizeStorageTypes lower-cases storage_types (default: standard) and
+// makes default_storage_type one of them (default: the first).
+func (c *Config) normalizeStorageTypes() error {
+	seen := map[string]struct{}{}
+	types := make([]string, 0, len(c.StorageTypes))
+	for _, t := range c.StorageTypes {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" {
+			continue
+		}
+		if _, ok := seen[t]; ok {
+			continue
+		}
+		seen[t] = struct{}{}
+		types = append(types, t)
+	}
+	if len(types) == 0 {
+		types = []string{"standard"}
+	}
+	c.StorageTypes = types
+	c.DefaultStorageType = strings.ToLower(strings.TrimSpace(c.DefaultStorageType))
+	if c.DefaultStorageType == "" {
+		c.DefaultStorageType = types[0]
+	}
+	if !slices.Contains(types, c.DefaultStorageType) {
+		return fmt.Errorf("default_storage_type %q is not one of storage_types %v", c.DefaultStorageType, types)
+	}
+	return nil
+}
+
 func (c *Config) Validate() error {
 	if c.HTTPAddr == "" {
 		return errors.New("http_addr is required")
@@ -91,6 +243,25 @@ func (c *Config) Validate() error {
 	if c.DBURL == "" {
 		return errors.New("database_url is required")
 	}
+	c.LogFormat = strings.ToLower(strings.TrimSpace(c.LogFormat))
+	if c.LogFormat == "" {
+		c.LogFormat = "console"
+	}
+	if c.LogFormat != "console" && c.LogFormat != "json" {
+		return fmt.Errorf("log_format must be console or json, got %q", c.LogFormat)
+	}
+	if c.DBMaxOpenConns <= 0 {
+		c.DBMaxOpenConns = 20
+	}
+	if c.DBMaxIdleConns <= 0 {
+		c.DBMaxIdleConns = 5
+	}
+	if c.DBMaxIdleConns > c.DBMaxOpenConns {
+		c.DBMaxIdleConns = c.DBMaxOpenConns
+	}
+	if c.DBConnMaxLifetimeSec <= 0 {
+		c.DBConnMaxLifetimeSec = 1800
+	}
 	if c.VersionRootPath == "" {
 		c.VersionRootPath = "deploy/version"
 	}
@@ -103,12 +274,30 @@ func (c *Config) Validate() error {
 	if c.ArchiveRootPath == "" {
 		c.ArchiveRootPath = "deploy/archived"
 	}
+	if c.StagingRootPath == "" {
+		c.StagingRootPath = "deploy/staging"
+	}
+	staging := filepath.Clean(c.StagingRootPath)
+	for _, root := range []struct{ name, path string }{
+		{"instance_root_path", c.InstanceRootPath},
+		{"version_root_path", c.VersionRootPath},
+		{"archive_root_path", c.ArchiveRootPath},
+		{"template_root_path", c.TemplateRootPath},
+	} {
+		if staging == filepath.Clean(root.path) {
+			return fmt.Errorf("staging_root_path must differ from %s (%s)", root.name, root.path)
+		}
+	}
 	if c.BootstrapAdminName == "" {
 		c.BootstrapAdminName = "admin"
 	}
 	if c.BootstrapAdminUUID == "" {
 		c.BootstrapAdminUUID = "00000000-0000-4000-8000-000000000001"
 	}
+	c.BootstrapAdminUUID = strings.ToLower(strings.TrimSpace(c.BootstrapAdminUUID))
+	if !uuidPattern.MatchString(c.BootstrapAdminUUID) {
+		return fmt.Errorf("bootstrap_admin_uuid %q is not a dashed uuid (xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx)", c.BootstrapAdminUUID)
+	}
 	if c.MiniServerTapPort <= 0 {
 		c.MiniServerTapPort = 4567
 	}
@@ -118,6 +307,112 @@ func (c *Config) Validate() error {
 	if c.RemoveDay <= 0 {
 		c.RemoveDay = 14
 	}
+	if c.IdleGraceMinutes < 0 {
+		c.IdleGraceMinutes = 0
+	}
+	if c.IdleWarningMinutes < 0 {
+		c.IdleWarningMinutes = 0
+	}
+	if c.RequestRetentionDay < 0 {
+		c.RequestRetentionDay = 30
+	}
+	if c.RequestExpiryHours < 0 {
+		c.RequestExpiryHours = 72
+	}
+	if c.HealthStaleMinutes < 0 {
+		c.HealthStaleMinutes = 0
+	}
+	if c.AutoRecoverAttempts < 0 {
+		c.AutoRecoverAttempts = 0
+	}
+	if c.AutoRecoverWindowMin <= 0 {
+		c.AutoRecoverWindowMin = 60
+	}
+	if c.DrainTimeoutSec <= 0 {
+		c.DrainTimeoutSec = 300
+	}
+	if c.PreStopTimeoutSec <= 0 {
+		c.PreStopTimeoutSec = 30
+	}
+	if c.LobbySetupAttempts <= 0 {
+		c.LobbySetupAttempts = 10
+	}
+	if c.LobbySetupIntervalSec <= 0 {
+		c.LobbySetupIntervalSec = 5
+	}
+	if c.BulkPowerConcurrency <= 0 {
+		c.BulkPowerConcurrency = 4
+	}
+	c.ServerIDPrefix = strings.TrimSpace(c.ServerIDPrefix)
+	if c.ServerIDPrefix == "" {
+		c.ServerIDPrefix = "mcmm-inst-"
+	}
+	if c.CommandCooldownSec < 0 {
+		c.CommandCooldownSec = 3
+	}
+	if c.MaxConcurrentStarts < 0 {
+		c.MaxConcurrentStarts = 0
+	}
+	if c.NotifyConcurrency <= 0 {
+		c.NotifyConcurrency = 4
+	}
+	if c.NotifyTellTimeoutSec <= 0 {
+		c.NotifyTellTimeoutSec = 5
+	}
+	if c.StartMaxAttempts <= 0 {
+		c.StartMaxAttempts = 3
+	}
+	if c.StartRetryBackoffSec <= 0 {
+		c.StartRetryBackoffSec = 15
+	}
+	if c.ServerTapMaxRetries <= 0 {
+		c.ServerTapMaxRetries = 3
+	}
+	if c.ServerTapRetryBaseSec <= 0 {
+		c.ServerTapRetryBaseSec = 5
+	}
+	if c.ServerTapRetryMaxSec < c.ServerTapRetryBaseSec {
+		c.ServerTapRetryMaxSec = max(30, c.ServerTapRetryBaseSec)
+	}
+	if c.StagingSweepHours <= 0 {
+		c.StagingSweepHours = 24
+	}
+	if c.MaxArchiveBytes < 0 {
+		return errors.New("max_archive_bytes must not be negative")
+	}
+	if c.ArchivePruneNoticeDay < 0 {
+		c.ArchivePruneNoticeDay = 3
+	}
+	if c.StarterWorldQuota < 0 {
+		return errors.New("starter_world_quota must not be negative")
+	}
+	if c.PostCreateHookEnabled && strings.TrimSpace(c.PostCreateHook) == "" {
+		return errors.New("post_create_hook is required when post_create_hook_enabled is true")
+	}
+	if c.PostCreateHookTimeoutS <= 0 {
+		c.PostCreateHookTimeoutS = 30
+	}
+	if c.PreDestroyHookEnabled && strings.TrimSpace(c.PreDestroyHook) == "" {
+		return errors.New("pre_destroy_hook is required when pre_destroy_hook_enabled is true")
+	}
+	if c.PreDestroyHookTimeoutS <= 0 {
+		c.PreDestroyHookTimeoutS = 30
+	}
+	if c.InstanceCPULimit < 0 || c.InstanceMemLimitMB < 0 {
+		return errors.New("instance_cpu_limit and instance_mem_limit_mb must not be negative")
+	}
+	if c.HostPortMin != 0 || c.HostPortMax != 0 {
+		if c.HostPortMin < 1 || c.HostPortMax > 65535 || c.HostPortMin > c.HostPortMax {
+			return fmt.Errorf("host_port_min/host_port_max must be a range within 1-65535, got %d-%d", c.HostPortMin, c.HostPortMax)
+		}
+	}
+	if err := c.normalizeStorageTypes(); err != nil {
+		return err
+	}
+	// An empty player_name_pattern keeps servertap.DefaultPlayerNamePattern.
+	if _, err := regexp.Compile(c.PlayerNamePattern); err != nil {
+		return fmt.Errorf("player_name_pattern is not a valid regexp: %w", err)
+	}
 	if c.MiniTapHostPattern == "" {
 		c.MiniTapHostPattern = fmt.Sprintf("http://mcmm-inst-%%d:%d", c.MiniServerTapPort)
 	}
@@ -127,9 +422,33 @@ func (c *Config) Validate() error {
 	if len(c.Servers) == 0 && c.LobbyServerTapURL == "" {
 		return errors.New("lobby_servertap_url is required when servers is empty")
 	}
+	if c.LobbyServerTapURL != "" {
+		if err := checkHTTPURL(c.LobbyServerTapURL); err != nil {
+			return fmt.Errorf("lobby_servertap_url %w", err)
+		}
+	}
+	if c.ProxyBridgeURL != "" {
+		if err := checkHTTPURL(c.ProxyBridgeURL); err != nil {
+			return fmt.Errorf("proxy_bridge_url %w", err)
+		}
+	}
+	if c.NotifyWebhookURL != "" {
+		if err := checkHTTPURL(c.NotifyWebhookURL); err != nil {
+			return fmt.Errorf("notify_webhook_url %w", err)
+		}
+	}
+	if strings.Count(c.MiniTapHostPattern, "%d") != 1 {
+		return errors.New("mini_servertap_host_pattern must contain exactly one %d")
+	}
+	if err := checkHTTPURL(c.MiniServerTapURL(1)); err != nil {
+		return fmt.Errorf("mini_servertap_host_pattern %w", err)
+	}
 	if c.ProxyAuthHeader == "" {
 		c.ProxyAuthHeader = "Authorization"
 	}
+	if c.AdminAuthHeader == "" {
+		c.AdminAuthHeader = "Authorization"
+	}
 	for i, s := range c.Servers {
 		if s.ID == "" {
 			return fmt.Errorf("servers[%d].id is required", i)
@@ -149,10 +468,20 @@ func (c *Config) Validate() error {
 
 func LogSummary(cfg Config) {
 	logger := ilog.Component("config")
-	logger.Infof("runtime paths: template=%s version=%s instance=%s archive=%s", cfg.TemplateRootPath, cfg.VersionRootPath, cfg.InstanceRootPath, cfg.ArchiveRootPath)
+	logger.Infof("db pool max_open_conns=%d max_idle_conns=%d conn_max_lifetime_seconds=%d", cfg.DBMaxOpenConns, cfg.DBMaxIdleConns, cfg.DBConnMaxLifetimeSec)
+	logger.Infof("runtime paths: template=%s version=%s instance=%s archive=%s staging=%s", cfg.TemplateRootPath, cfg.VersionRootPath, cfg.InstanceRootPath, cfg.ArchiveRootPath, cfg.StagingRootPath)
 	logger.Infof("servertap lobby=%s mini_pattern=%s instance_network=%s", cfg.LobbyServerTapURL, cfg.MiniTapHostPattern, cfg.InstanceNetwork)
-	logger.Infof("cron off_hour=%d remove_day=%d", cfg.OffHour, cfg.RemoveDay)
+	logger.Infof("cron off_hour=%d remove_day=%d idle_grace_minutes=%d idle_warning_minutes=%d request_retention_days=%d health_stale_minutes=%d auto_recover_attempts=%d auto_recover_window_minutes=%d", cfg.OffHour, cfg.RemoveDay, cfg.IdleGraceMinutes, cfg.IdleWarningMinutes, cfg.RequestRetentionDay, cfg.HealthStaleMinutes, cfg.AutoRecoverAttempts, cfg.AutoRecoverWindowMin)
+	logger.Infof("archive max_archive_bytes=%d (0 = unlimited) archive_prune_notice_days=%d", cfg.MaxArchiveBytes, cfg.ArchivePruneNoticeDay)
 	logger.Infof("proxy bridge url=%s auth_header=%s", cfg.ProxyBridgeURL, cfg.ProxyAuthHeader)
+	logger.Infof("command cooldown_seconds=%d player_name_pattern=%s", cfg.CommandCooldownSec, cfg.PlayerNamePattern)
+	logger.Infof("worker max_concurrent_starts=%d multiverse_import=%v", cfg.MaxConcurrentStarts, cfg.MultiverseImport)
+	logger.Infof("worker start_max_attempts=%d start_retry_backoff_seconds=%d", cfg.StartMaxAttempts, cfg.StartRetryBackoffSec)
+	logger.Infof("worker servertap_max_retries=%d servertap_retry_base_seconds=%d servertap_retry_max_seconds=%d", cfg.ServerTapMaxRetries, cfg.ServerTapRetryBaseSec, cfg.ServerTapRetryMaxSec)
+	logger.Infof("bootstrap purge_bootstrap_instances=%v", cfg.PurgeBootstrapInstances)
+	if cfg.AdminToken == "" {
+		logger.Warnf("admin_token is empty, /v1/admin endpoints are disabled")
+	}
 	if cfg.ServerTapAuthHeader == "" {
 		logger.Warnf("servertap_auth_header is empty, fallback should be 'key'")
 	} else {
@@ -161,6 +490,78 @@ func LogSummary(cfg Config) {
 	if cfg.ServerTapKey == "" {
 		logger.Warnf("servertap_key is empty")
 	}
+	if cfg.ServerTapInsecure {
+		logger.Warnf("servertap_tls_insecure_skip_verify is enabled, certificates are not verified")
+	}
+	logger.Infof("notify concurrency=%d tell_timeout_seconds=%d", cfg.NotifyConcurrency, cfg.NotifyTellTimeoutSec)
+	if cfg.NotifyWebhookURL != "" {
+		logger.Infof("notify webhook enabled (lobby tells replaced=%v)", cfg.NotifyWebhookOnly)
+	}
+	if cfg.ServerTapPreflight {
+		logger.Infof("servertap preflight enabled")
+	}
+	if cfg.ServerTapCAFile != "" {
+		logger.Infof("servertap ca_file=%s", cfg.ServerTapCAFile)
+	}
+}
+
+// reloadableKeys are the yaml keys a SIGHUP reload applies to the running
+// scheduler and cmdreceiver; everything else needs a restart.
+var reloadableKeys = map[string]bool{
+	"servertap_key":            true,
+	"servertap_auth_header":    true,
+	"off_hour":                 true,
+	"remove_day":               true,
+	"idle_grace_minutes":       true,
+	"idle_warning_minutes":     true,
+	"request_retention_days":   true,
+	"command_cooldown_seconds": true,
+}
+
+// FieldChange is one config key whose value differs between two configs.
+type FieldChange struct {
+	Key        string
+	Reloadable bool
+}
+
+// Diff lists the keys (in declaration order) whose values differ in other
+// and whether each can be applied without a restart.
+func (c Config) Diff(other Config) []FieldChange {
+	a := reflect.ValueOf(c)
+	b := reflect.ValueOf(other)
+	t := a.Type()
+	var out []FieldChange
+	for i := 0; i < t.NumField(); i++ {
+		if reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			continue
+		}
+		key := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if key == "" {
+			key = t.Field(i).Name
+		}
+		out = append(out, FieldChange{Key: key, Reloadable: reloadableKeys[key]})
+	}
+	return out
+}
+
+// uuidPattern matches a lowercase hyphenated UUID, the form Minecraft
+// player UUIDs are stored in.
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// checkHTTPURL only checks the shape (http/https scheme and a host);
+// reachability is left to the optional startup preflight.
+func checkHTTPURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("is not a valid URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("must use http or https (got %q)", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("must include a host (got %q)", raw)
+	}
+	return nil
 }
 
 func (c Config) MiniServerTapURL(instanceID int64) string {
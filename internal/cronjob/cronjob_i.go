@@ -2,10 +2,11 @@ package cronjob
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"mcmm/internal/log"
@@ -14,59 +15,198 @@ import (
 	"mcmm/internal/worker"
 )
 
-var playersRegex = regexp.MustCompile(`(?i)there are\s+(\d+)\s+out of`)
-
 type Scheduler struct {
 	repos pgsql.Repos
 	w     worker.Worker
-	opts  Options
-	log   interface {
+	// optsMu guards opts, which UpdateOptions may replace at runtime.
+	optsMu     sync.RWMutex
+	opts       Options
+	intervalCh chan time.Duration
+	log        interface {
 		Infof(string, ...any)
 		Warnf(string, ...any)
 		Errorf(string, ...any)
 	}
+
+	emptyMu    sync.Mutex
+	emptySince map[int64]time.Time
+	// pendingOff holds when a warned instance may be stopped.
+	pendingOff map[int64]time.Time
+	// restartCounts is the last container restart count seen per instance;
+	// only the health pass touches it.
+	restartCounts map[int64]int
+
+	// recovering holds instances with an auto-recover restart in flight.
+	recoverMu  sync.Mutex
+	recovering map[int64]bool
+	recoverWG  sync.WaitGroup
 }
 
 type Options struct {
 	OffInterval       time.Duration
 	RemoveDays        int
+	IdleGrace         time.Duration
+	RequestRetention  time.Duration
 	InstanceTapURLFmt string
 	ServerTapTimeout  time.Duration
 	ServerTapAuthName string
 	ServerTapAuthKey  string
+	ServerTapTLS      servertap.TLSOptions
 	Now               func() time.Time
+	// IdleWarningLead is how long players are warned before an idle auto-off.
+	// Zero stops without warning.
+	IdleWarningLead time.Duration
+	// MaxArchiveBytes caps the archive directories; the oldest unpinned
+	// archives are purged after each archive pass. Zero disables the cap.
+	MaxArchiveBytes int64
+	// ArchivePruneNotice is how long an owner is warned before a capped
+	// archive is purged. Zero purges on the pass after the warning.
+	ArchivePruneNotice time.Duration
+	// NotifyOwner tells an instance owner about an upcoming prune. Optional.
+	NotifyOwner func(ctx context.Context, userID int64, msg string)
+	// IdleOffMessage is the kick reason for players still connected when an
+	// idle instance is stopped; {world}, {name} and {id} are filled in.
+	IdleOffMessage string
+	// OrphanOwnerID receives instances whose owner user no longer exists.
+	// Zero only reports them.
+	OrphanOwnerID int64
+	// InstanceKeys opens per-instance ServerTap keys; nil uses ServerTapAuthKey.
+	InstanceKeys *servertap.InstanceKeyring
+	// HealthStaleAfter is how old an On instance's last health check may get
+	// before the health pass probes it again. Zero disables the pass.
+	HealthStaleAfter time.Duration
+	// AutoRecover lets the health pass restart unreachable instances.
+	AutoRecover AutoRecoverPolicy
 }
 
+// AutoRecoverPolicy caps health-driven restarts: at most MaxAttempts per
+// instance within Window. An instance still unreachable after that is
+// stopped and its owner told. Zero MaxAttempts disables recovery.
+type AutoRecoverPolicy struct {
+	MaxAttempts int
+	Window      time.Duration
+}
+
+// recoverRestartTimeout bounds one auto-recover stop/start.
+const recoverRestartTimeout = 5 * time.Minute
+
+// DefaultIdleOffMessage is used when Options.IdleOffMessage is empty.
+const DefaultIdleOffMessage = "World {world} was stopped because it was idle"
+
 func NewScheduler(repos pgsql.Repos, w worker.Worker, opts Options) *Scheduler {
+	return &Scheduler{
+		repos:         repos,
+		w:             w,
+		opts:          normalizeOptions(opts),
+		intervalCh:    make(chan time.Duration, 1),
+		log:           log.Component("cronjob"),
+		emptySince:    map[int64]time.Time{},
+		pendingOff:    map[int64]time.Time{},
+		restartCounts: map[int64]int{},
+		recovering:    map[int64]bool{},
+	}
+}
+
+func normalizeOptions(opts Options) Options {
 	if opts.OffInterval <= 0 {
 		opts.OffInterval = time.Hour
 	}
 	if opts.RemoveDays <= 0 {
 		opts.RemoveDays = 14
 	}
+	if opts.IdleGrace < 0 {
+		opts.IdleGrace = 0
+	}
+	if opts.IdleWarningLead < 0 {
+		opts.IdleWarningLead = 0
+	}
+	if opts.HealthStaleAfter < 0 {
+		opts.HealthStaleAfter = 0
+	}
+	if opts.AutoRecover.MaxAttempts < 0 {
+		opts.AutoRecover.MaxAttempts = 0
+	}
+	if opts.AutoRecover.MaxAttempts > 0 && opts.AutoRecover.Window <= 0 {
+		opts.AutoRecover.Window = time.Hour
+	}
 	if opts.Now == nil {
 		opts.Now = time.Now
 	}
-	return &Scheduler{
-		repos: repos,
-		w:     w,
-		opts:  opts,
-		log:   log.Component("cronjob"),
+	if strings.TrimSpace(opts.IdleOffMessage) == "" {
+		opts.IdleOffMessage = DefaultIdleOffMessage
 	}
+	return opts
+}
+
+// UpdateOptions applies the reloadable part of opts: intervals, limits and
+// ServerTap credentials. The tap URL pattern, TLS settings, clock, archive
+// cap, idle-off message, orphan owner, instance keyring, health threshold
+// and auto-recover policy are kept.
+// A changed OffInterval takes effect immediately.
+func (s *Scheduler) UpdateOptions(opts Options) {
+	s.optsMu.Lock()
+	cur := s.opts
+	next := normalizeOptions(Options{
+		OffInterval:        opts.OffInterval,
+		RemoveDays:         opts.RemoveDays,
+		IdleGrace:          opts.IdleGrace,
+		RequestRetention:   opts.RequestRetention,
+		InstanceTapURLFmt:  cur.InstanceTapURLFmt,
+		ServerTapTimeout:   opts.ServerTapTimeout,
+		ServerTapAuthName:  opts.ServerTapAuthName,
+		ServerTapAuthKey:   opts.ServerTapAuthKey,
+		ServerTapTLS:       cur.ServerTapTLS,
+		Now:                cur.Now,
+		IdleWarningLead:    opts.IdleWarningLead,
+		MaxArchiveBytes:    cur.MaxArchiveBytes,
+		ArchivePruneNotice: cur.ArchivePruneNotice,
+		NotifyOwner:        cur.NotifyOwner,
+		IdleOffMessage:     cur.IdleOffMessage,
+		OrphanOwnerID:      cur.OrphanOwnerID,
+		InstanceKeys:       cur.InstanceKeys,
+		HealthStaleAfter:   cur.HealthStaleAfter,
+		AutoRecover:        cur.AutoRecover,
+	})
+	s.opts = next
+	if next.OffInterval != cur.OffInterval {
+		// Senders are serialized by optsMu, so after dropping a stale queued
+		// reset there is always room for the latest one.
+		select {
+		case <-s.intervalCh:
+		default:
+		}
+		s.intervalCh <- next.OffInterval
+	}
+	s.optsMu.Unlock()
+}
+
+func (s *Scheduler) options() Options {
+	s.optsMu.RLock()
+	defer s.optsMu.RUnlock()
+	return s.opts
 }
 
 func (s *Scheduler) Start(ctx context.Context) {
+	opts := s.options()
 	go s.runIdleLoop(ctx)
 	go s.runArchiveLoop(ctx)
+	go s.runOrphanLoop(ctx)
+	if opts.HealthStaleAfter > 0 {
+		go s.runHealthLoop(ctx)
+	}
+	go s.runRequestRetentionLoop(ctx)
+	go s.runRequestExpiryLoop(ctx)
 }
 
 func (s *Scheduler) runIdleLoop(ctx context.Context) {
-	tk := time.NewTicker(s.opts.OffInterval)
+	tk := time.NewTicker(s.options().OffInterval)
 	defer tk.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case iv := <-s.intervalCh:
+			tk.Reset(iv)
 		case <-tk.C:
 			s.runIdleOnce(ctx)
 		}
@@ -86,17 +226,274 @@ func (s *Scheduler) runArchiveLoop(ctx context.Context) {
 	}
 }
 
+// runRequestRetentionLoop archives old terminal requests once at startup,
+// then daily. It keeps running while retention is off, so a reload that
+// turns it back on takes effect at the next tick.
+func (s *Scheduler) runRequestRetentionLoop(ctx context.Context) {
+	s.runRequestRetentionOnce(ctx)
+	tk := time.NewTicker(24 * time.Hour)
+	defer tk.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tk.C:
+			s.runRequestRetentionOnce(ctx)
+		}
+	}
+}
+
+// runRequestExpiryLoop expires overdue pending requests once at startup,
+// then hourly.
+func (s *Scheduler) runRequestExpiryLoop(ctx context.Context) {
+	s.runRequestExpiryOnce(ctx)
+	tk := time.NewTicker(time.Hour)
+	defer tk.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tk.C:
+			s.runRequestExpiryOnce(ctx)
+		}
+	}
+}
+
+// runOrphanLoop checks for orphaned instances once at startup, then daily.
+func (s *Scheduler) runOrphanLoop(ctx context.Context) {
+	s.runOrphanCheckOnce(ctx)
+	tk := time.NewTicker(24 * time.Hour)
+	defer tk.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tk.C:
+			s.runOrphanCheckOnce(ctx)
+		}
+	}
+}
+
+// runHealthLoop probes stale instances once at startup, which reconciles
+// rows left On across a manager or host restart, then every HealthStaleAfter.
+func (s *Scheduler) runHealthLoop(ctx context.Context) {
+	s.runHealthOnce(ctx)
+	tk := time.NewTicker(s.options().HealthStaleAfter)
+	defer tk.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tk.C:
+			s.runHealthOnce(ctx)
+		}
+	}
+}
+
+// runHealthOnce pings every On instance whose last health check is older
+// than HealthStaleAfter, least recently checked first, and records the
+// result. A dead container shows up as unreachable instead of staying a
+// silent On; with AutoRecover set it is restarted (see recoverInstance),
+// otherwise the status is left for an admin or the idle loop. A reachable
+// instance whose container docker restarted since the last pass gets its
+// access configured again.
+func (s *Scheduler) runHealthOnce(ctx context.Context) {
+	opts := s.options()
+	if opts.HealthStaleAfter <= 0 || strings.TrimSpace(opts.InstanceTapURLFmt) == "" {
+		return
+	}
+	now := opts.Now()
+	stale, err := s.repos.MapInstance.ListStaleOn(ctx, now.Add(-opts.HealthStaleAfter))
+	if err != nil {
+		s.log.Warnf("health check list stale instances failed: %v", err)
+		return
+	}
+	for _, inst := range stale {
+		health := worker.HealthHealthy
+		conn, err := s.instanceConnector(inst)
+		if err == nil {
+			err = conn.Ping(ctx)
+		}
+		if err != nil {
+			health = worker.HealthUnreachable
+			if servertap.IsAuthError(err) {
+				health = worker.HealthAuthFailed
+			}
+			s.log.Warnf("health check instance=%d alias=%s %s: %v", inst.ID, inst.Alias, health, err)
+		} else if s.containerRestarted(ctx, inst) {
+			s.log.Warnf("health check instance=%d alias=%s container restarted, reconfiguring access", inst.ID, inst.Alias)
+			if rErr := s.w.ReconfigureAccess(ctx, inst.ID); rErr != nil {
+				s.log.Warnf("health check reconfigure instance=%d failed: %v", inst.ID, rErr)
+			}
+			// ReconfigureAccess records the health result itself.
+			continue
+		}
+		// Re-read so a start/stop that raced the probe is not overwritten.
+		cur, readErr := s.repos.MapInstance.Read(ctx, inst.ID)
+		if readErr != nil {
+			s.log.Warnf("health check read instance=%d failed: %v", inst.ID, readErr)
+			continue
+		}
+		if cur.Status != string(worker.StatusOn) {
+			continue
+		}
+		if health == worker.HealthUnreachable && opts.AutoRecover.MaxAttempts > 0 {
+			s.recoverInstance(ctx, cur, now, err)
+			continue
+		}
+		cur.HealthStatus = string(health)
+		cur.LastHealthAt = sql.NullTime{Time: now, Valid: true}
+		if err != nil {
+			cur.LastErrorMsg = sql.NullString{String: err.Error(), Valid: true}
+		}
+		if err := s.repos.MapInstance.Update(ctx, cur); err != nil {
+			s.log.Warnf("health check update instance=%d failed: %v", inst.ID, err)
+		}
+	}
+	s.pruneRestartCounts(ctx)
+}
+
+// pruneRestartCounts forgets restart counts of instances that are no longer
+// On (stopped, archived or deleted); a later start begins a fresh count.
+func (s *Scheduler) pruneRestartCounts(ctx context.Context) {
+	if len(s.restartCounts) == 0 {
+		return
+	}
+	list, err := s.repos.MapInstance.List(ctx)
+	if err != nil {
+		s.log.Warnf("health check list instances failed: %v", err)
+		return
+	}
+	on := make(map[int64]bool, len(list))
+	for _, inst := range list {
+		if inst.Status == string(worker.StatusOn) {
+			on[inst.ID] = true
+		}
+	}
+	for id := range s.restartCounts {
+		if !on[id] {
+			delete(s.restartCounts, id)
+		}
+	}
+}
+
+// recoverInstance restarts an unreachable instance, counting the attempt on
+// the instance row. Attempts are counted per AutoRecover.Window; once the cap
+// is used up the instance is stopped, its owner told, and the count cleared
+// for when it is started again. The stop/start runs in the background (see
+// dispatchRecover) so one slow instance does not hold up the health pass.
+func (s *Scheduler) recoverInstance(ctx context.Context, inst pgsql.MapInstance, now time.Time, probeErr error) {
+	opts := s.options()
+	policy := opts.AutoRecover
+	if s.isRecovering(inst.ID) {
+		s.log.Infof("auto-recover instance=%d still in progress, skipping", inst.ID)
+		return
+	}
+	if !inst.RecoverWindowAt.Valid || now.Sub(inst.RecoverWindowAt.Time) >= policy.Window {
+		inst.RecoverAttempts = 0
+		inst.RecoverWindowAt = sql.NullTime{Time: now, Valid: true}
+	}
+	inst.HealthStatus = string(worker.HealthUnreachable)
+	inst.LastHealthAt = sql.NullTime{Time: now, Valid: true}
+	inst.LastErrorMsg = sql.NullString{String: probeErr.Error(), Valid: true}
+
+	if inst.RecoverAttempts >= policy.MaxAttempts {
+		s.log.Warnf("auto-recover instance=%d alias=%s gave up after %d attempts, stopping", inst.ID, inst.Alias, inst.RecoverAttempts)
+		inst.RecoverAttempts = 0
+		inst.RecoverWindowAt = sql.NullTime{}
+		if err := s.repos.MapInstance.Update(ctx, inst); err != nil {
+			s.log.Warnf("auto-recover update instance=%d failed: %v", inst.ID, err)
+		}
+		s.dispatchRecover(ctx, inst.ID, func(ctx context.Context) {
+			if err := s.w.StopOnly(ctx, inst.ID); err != nil {
+				s.log.Errorf("auto-recover stop instance=%d failed: %v", inst.ID, err)
+			}
+			if opts.NotifyOwner != nil {
+				opts.NotifyOwner(ctx, inst.OwnerID, fmt.Sprintf(
+					"[MCMM] #%d:%s stayed unreachable after %d restart(s) and was stopped: %v", inst.ID, inst.Alias, policy.MaxAttempts, probeErr))
+			}
+		})
+		return
+	}
+
+	// Record the attempt before restarting so a crash mid-restart still counts.
+	inst.RecoverAttempts++
+	if err := s.repos.MapInstance.Update(ctx, inst); err != nil {
+		s.log.Warnf("auto-recover update instance=%d failed: %v", inst.ID, err)
+		return
+	}
+	s.log.Warnf("auto-recover instance=%d alias=%s attempt %d/%d", inst.ID, inst.Alias, inst.RecoverAttempts, policy.MaxAttempts)
+	s.dispatchRecover(ctx, inst.ID, func(ctx context.Context) {
+		if err := s.w.StopOnly(ctx, inst.ID); err != nil {
+			s.log.Errorf("auto-recover stop instance=%d failed: %v", inst.ID, err)
+			return
+		}
+		if err := s.w.StartExisting(ctx, inst.ID); err != nil {
+			// A failed start leaves the instance Off, out of the health pass.
+			s.log.Errorf("auto-recover start instance=%d failed: %v", inst.ID, err)
+			if opts.NotifyOwner != nil {
+				opts.NotifyOwner(ctx, inst.OwnerID, fmt.Sprintf("[MCMM] #%d:%s was unreachable and could not be restarted: %v", inst.ID, inst.Alias, err))
+			}
+		}
+	})
+}
+
+// dispatchRecover runs fn for instanceID in its own goroutine, bounded by
+// ctx (the scheduler's, so shutdown cancels it) and recoverRestartTimeout.
+func (s *Scheduler) dispatchRecover(ctx context.Context, instanceID int64, fn func(ctx context.Context)) {
+	s.recoverMu.Lock()
+	s.recovering[instanceID] = true
+	s.recoverMu.Unlock()
+	s.recoverWG.Add(1)
+	go func() {
+		defer s.recoverWG.Done()
+		defer func() {
+			s.recoverMu.Lock()
+			delete(s.recovering, instanceID)
+			s.recoverMu.Unlock()
+		}()
+		runCtx, cancel := context.WithTimeout(ctx, recoverRestartTimeout)
+		defer cancel()
+		fn(runCtx)
+	}()
+}
+
+func (s *Scheduler) isRecovering(instanceID int64) bool {
+	s.recoverMu.Lock()
+	defer s.recoverMu.Unlock()
+	return s.recovering[instanceID]
+}
+
+// containerRestarted reports whether inst's restart count grew since the
+// previous health pass. The first count seen is only remembered.
+func (s *Scheduler) containerRestarted(ctx context.Context, inst pgsql.MapInstance) bool {
+	n, err := s.w.RestartCount(ctx, inst.ID)
+	if err != nil {
+		s.log.Warnf("health check restart count instance=%d failed: %v", inst.ID, err)
+		return false
+	}
+	prev, seen := s.restartCounts[inst.ID]
+	s.restartCounts[inst.ID] = n
+	return seen && n > prev
+}
+
 func (s *Scheduler) runIdleOnce(ctx context.Context) {
+	opts := s.options()
 	list, err := s.repos.MapInstance.List(ctx)
 	if err != nil {
 		s.log.Warnf("idle check list instances failed: %v", err)
 		return
 	}
+	now := opts.Now()
+	on := make(map[int64]bool, len(list))
+	// Instances that are no longer On, or no longer exist, lose their state.
+	defer s.keepIdleState(on)
 	for _, inst := range list {
 		if inst.Status != string(worker.StatusOn) {
 			continue
 		}
-		hasPlayers, known, err := s.instanceHasPlayers(ctx, inst.ID)
+		on[inst.ID] = true
+		hasPlayers, known, err := s.instanceHasPlayers(ctx, inst)
 		if err != nil {
 			s.log.Warnf("idle check instance=%d failed: %v", inst.ID, err)
 			continue
@@ -106,22 +503,137 @@ func (s *Scheduler) runIdleOnce(ctx context.Context) {
 			continue
 		}
 		if hasPlayers {
+			s.clearEmpty(inst.ID)
 			continue
 		}
+		since := s.markEmpty(inst.ID, now)
+		if empty := now.Sub(since); empty < opts.IdleGrace {
+			s.log.Infof("idle check instance=%d empty for %s, within grace %s", inst.ID, empty.Round(time.Second), opts.IdleGrace)
+			continue
+		}
+		if opts.IdleWarningLead > 0 {
+			deadline, warned := s.pendingOffAt(inst.ID)
+			if !warned {
+				s.warnIdleShutdown(ctx, inst, now)
+				continue
+			}
+			if now.Before(deadline) {
+				s.log.Infof("idle check instance=%d warned, auto-off at %s", inst.ID, deadline.Format(time.RFC3339))
+				continue
+			}
+		}
 		s.log.Infof("idle auto-off instance=%d alias=%s", inst.ID, inst.Alias)
+		s.clearEmpty(inst.ID)
+		s.kickForIdleOff(ctx, inst)
 		if err := s.w.StopOnly(context.Background(), inst.ID); err != nil {
 			s.log.Errorf("idle auto-off instance=%d failed: %v", inst.ID, err)
 		}
 	}
 }
 
+// markEmpty records the first time an instance was seen without players and returns it.
+func (s *Scheduler) markEmpty(instanceID int64, now time.Time) time.Time {
+	s.emptyMu.Lock()
+	defer s.emptyMu.Unlock()
+	if since, ok := s.emptySince[instanceID]; ok {
+		return since
+	}
+	s.emptySince[instanceID] = now
+	return now
+}
+
+func (s *Scheduler) clearEmpty(instanceID int64) {
+	s.emptyMu.Lock()
+	defer s.emptyMu.Unlock()
+	delete(s.emptySince, instanceID)
+	delete(s.pendingOff, instanceID)
+}
+
+// keepIdleState drops the empty and pending-off entries of instances not in on.
+func (s *Scheduler) keepIdleState(on map[int64]bool) {
+	s.emptyMu.Lock()
+	defer s.emptyMu.Unlock()
+	for id := range s.emptySince {
+		if !on[id] {
+			delete(s.emptySince, id)
+		}
+	}
+	for id := range s.pendingOff {
+		if !on[id] {
+			delete(s.pendingOff, id)
+		}
+	}
+}
+
+func (s *Scheduler) pendingOffAt(instanceID int64) (time.Time, bool) {
+	s.emptyMu.Lock()
+	defer s.emptyMu.Unlock()
+	at, ok := s.pendingOff[instanceID]
+	return at, ok
+}
+
+// warnIdleShutdown broadcasts the upcoming auto-off and schedules it. The
+// broadcast is best-effort; the stop is scheduled even if it fails.
+func (s *Scheduler) warnIdleShutdown(ctx context.Context, inst pgsql.MapInstance, now time.Time) {
+	opts := s.options()
+	deadline := now.Add(opts.IdleWarningLead)
+	s.emptyMu.Lock()
+	s.pendingOff[inst.ID] = deadline
+	s.emptyMu.Unlock()
+
+	msg := fmt.Sprintf("[MCMM] No players online, this world will shut down in %s.", formatLead(opts.IdleWarningLead))
+	cmd := servertap.NewCommandBuilder("say").RawArg(msg).Build()
+	s.log.Infof("idle warning instance=%d alias=%s auto-off at %s", inst.ID, inst.Alias, deadline.Format(time.RFC3339))
+	conn, err := s.instanceConnector(inst)
+	if err == nil {
+		_, err = conn.Execute(ctx, servertap.ExecuteRequest{Command: cmd})
+	}
+	if err != nil {
+		s.log.Warnf("idle warning broadcast instance=%d failed: %v", inst.ID, err)
+	}
+}
+
+// kickForIdleOff disconnects anyone who joined after the last player check
+// with the configured reason instead of a bare connection loss. Best-effort.
+func (s *Scheduler) kickForIdleOff(ctx context.Context, inst pgsql.MapInstance) {
+	reason := servertap.FormatMessage(s.options().IdleOffMessage, map[string]string{
+		"world": inst.Alias,
+		"name":  displayName(inst),
+		"id":    strconv.FormatInt(inst.ID, 10),
+	})
+	cmd := servertap.NewCommandBuilder("kick").RawArg("@a").RawArg(reason).Build()
+	conn, err := s.instanceConnector(inst)
+	if err == nil {
+		_, err = conn.Execute(ctx, servertap.ExecuteRequest{Command: cmd})
+	}
+	if err != nil {
+		s.log.Warnf("idle auto-off kick instance=%d failed: %v", inst.ID, err)
+	}
+}
+
+// displayName falls back to the alias for rows created before display_name existed.
+func displayName(inst pgsql.MapInstance) string {
+	if strings.TrimSpace(inst.DisplayName) != "" {
+		return inst.DisplayName
+	}
+	return inst.Alias
+}
+
+func formatLead(d time.Duration) string {
+	if d >= time.Minute && d%time.Minute == 0 {
+		return fmt.Sprintf("%d minute(s)", int(d/time.Minute))
+	}
+	return d.Round(time.Second).String()
+}
+
 func (s *Scheduler) runArchiveOnce(ctx context.Context) {
+	opts := s.options()
 	list, err := s.repos.MapInstance.List(ctx)
 	if err != nil {
 		s.log.Warnf("archive check list instances failed: %v", err)
 		return
 	}
-	cutoff := s.opts.Now().AddDate(0, 0, -s.opts.RemoveDays)
+	cutoff := opts.Now().AddDate(0, 0, -opts.RemoveDays)
 	for _, inst := range list {
 		if inst.Status != string(worker.StatusOff) {
 			continue
@@ -138,14 +650,119 @@ func (s *Scheduler) runArchiveOnce(ctx context.Context) {
 			s.log.Errorf("auto-archive instance=%d failed: %v", inst.ID, err)
 		}
 	}
+	s.runArchivePruneOnce(ctx)
+}
+
+func (s *Scheduler) runArchivePruneOnce(ctx context.Context) {
+	opts := s.options()
+	if opts.MaxArchiveBytes <= 0 {
+		return
+	}
+	pruned, err := s.w.PruneArchives(ctx, opts.MaxArchiveBytes, opts.ArchivePruneNotice, func(ctx context.Context, inst pgsql.MapInstance, size int64, deleteAfter time.Time) {
+		s.log.Infof("archive prune notice instance=%d alias=%s size=%d delete_after=%s", inst.ID, inst.Alias, size, deleteAfter.Format(time.RFC3339))
+		if opts.NotifyOwner != nil {
+			opts.NotifyOwner(ctx, inst.OwnerID, fmt.Sprintf("[MCMM] archive of #%d:%s will be deleted after %s to free archive space; restore it or ask an OP to pin it to keep it.", inst.ID, inst.Alias, deleteAfter.Format("2006-01-02 15:04 MST")))
+		}
+	})
+	if err != nil {
+		s.log.Warnf("archive prune incomplete: %v", err)
+	}
+	if len(pruned) > 0 {
+		s.log.Infof("archive prune removed %d archive(s) to stay under %d bytes", len(pruned), opts.MaxArchiveBytes)
+	}
+}
+
+// runRequestRetentionOnce moves terminal requests older than the retention
+// into user_requests_archive; zero retention keeps them in place.
+func (s *Scheduler) runRequestRetentionOnce(ctx context.Context) {
+	opts := s.options()
+	if opts.RequestRetention <= 0 {
+		return
+	}
+	cutoff := opts.Now().Add(-opts.RequestRetention)
+	n, err := s.repos.UserRequest.ArchiveTerminalBefore(ctx, cutoff)
+	if err != nil {
+		s.log.Warnf("request retention cleanup failed: %v", err)
+		return
+	}
+	if n > 0 {
+		s.log.Infof("request retention archived %d terminal requests older than %s", n, cutoff.Format(time.RFC3339))
+	}
 }
 
-func (s *Scheduler) instanceHasPlayers(ctx context.Context, instanceID int64) (hasPlayers bool, known bool, err error) {
-	if strings.TrimSpace(s.opts.InstanceTapURLFmt) == "" {
+// runRequestExpiryOnce marks pending requests past their expires_at as
+// expired, so they drop out of the review queue and later age into the archive.
+func (s *Scheduler) runRequestExpiryOnce(ctx context.Context) {
+	expired, err := s.repos.UserRequest.ExpireOverdue(ctx, s.options().Now())
+	if err != nil {
+		s.log.Warnf("request expiry failed: %v", err)
+		return
+	}
+	if len(expired) > 0 {
+		s.log.Infof("request expiry marked %d pending requests as expired", len(expired))
+	}
+}
+
+// runOrphanCheckOnce finds instances whose owner no longer exists. With
+// OrphanOwnerID set they are handed to that user (as owner member too);
+// otherwise they are only reported.
+func (s *Scheduler) runOrphanCheckOnce(ctx context.Context) {
+	opts := s.options()
+	orphans, err := s.repos.MapInstance.ListOrphanedOwners(ctx)
+	if err != nil {
+		s.log.Warnf("orphan check failed: %v", err)
+		return
+	}
+	if len(orphans) == 0 {
+		return
+	}
+	if opts.OrphanOwnerID <= 0 {
+		items := make([]string, 0, len(orphans))
+		for _, inst := range orphans {
+			items = append(items, fmt.Sprintf("#%d:%s(owner=%d)", inst.ID, inst.Alias, inst.OwnerID))
+		}
+		s.log.Warnf("orphan check found %d instance(s) without owner: %s", len(orphans), strings.Join(items, ", "))
+		return
+	}
+	for _, inst := range orphans {
+		prev := inst.OwnerID
+		inst.OwnerID = opts.OrphanOwnerID
+		if err := s.repos.MapInstance.Update(ctx, inst); err != nil {
+			s.log.Errorf("orphan reassign instance=%d failed: %v", inst.ID, err)
+			continue
+		}
+		if err := s.ensureOwnerMember(ctx, inst.ID, opts.OrphanOwnerID); err != nil {
+			s.log.Warnf("orphan reassign instance=%d owner membership failed: %v", inst.ID, err)
+		}
+		s.log.Warnf("orphan reassign instance=%d alias=%s owner %d -> %d", inst.ID, inst.Alias, prev, opts.OrphanOwnerID)
+	}
+}
+
+func (s *Scheduler) ensureOwnerMember(ctx context.Context, instanceID int64, userID int64) error {
+	members, err := s.repos.InstanceMember.ListByInstance(ctx, instanceID)
+	if err != nil {
+		return err
+	}
+	for _, m := range members {
+		if m.UserID != userID {
+			continue
+		}
+		if m.Role == "owner" {
+			return nil
+		}
+		m.Role = "owner"
+		return s.repos.InstanceMember.Update(ctx, m)
+	}
+	_, err = s.repos.InstanceMember.Create(ctx, pgsql.InstanceMember{InstanceID: instanceID, UserID: userID, Role: "owner"})
+	return err
+}
+
+func (s *Scheduler) instanceHasPlayers(ctx context.Context, inst pgsql.MapInstance) (hasPlayers bool, known bool, err error) {
+	opts := s.options()
+	if strings.TrimSpace(opts.InstanceTapURLFmt) == "" {
 		return false, false, nil
 	}
-	url := fmt.Sprintf(strings.TrimSpace(s.opts.InstanceTapURLFmt), instanceID)
-	conn, err := servertap.NewConnectorWithAuth(url, s.opts.ServerTapTimeout, s.opts.ServerTapAuthName, s.opts.ServerTapAuthKey)
+	conn, err := s.instanceConnector(inst)
 	if err != nil {
 		return false, false, err
 	}
@@ -153,17 +770,21 @@ func (s *Scheduler) instanceHasPlayers(ctx context.Context, instanceID int64) (h
 	if err != nil {
 		return false, false, err
 	}
-	body := strings.TrimSpace(resp.RawBody)
-	if body == "" {
-		return false, false, nil
-	}
-	m := playersRegex.FindStringSubmatch(body)
-	if len(m) != 2 {
-		return false, false, nil
-	}
-	n, err := strconv.Atoi(m[1])
+	list, err := servertap.ParsePlayerList(resp)
 	if err != nil {
 		return false, false, nil
 	}
-	return n > 0, true, nil
+	return list.Online > 0, true, nil
+}
+
+// instanceConnector uses the instance's own ServerTap key when one is stored.
+func (s *Scheduler) instanceConnector(inst pgsql.MapInstance) (*servertap.Connector, error) {
+	opts := s.options()
+	url := fmt.Sprintf(strings.TrimSpace(opts.InstanceTapURLFmt), inst.ID)
+	return servertap.NewConnectorWithOptions(url, servertap.ConnectorOptions{
+		Timeout:    opts.ServerTapTimeout,
+		AuthHeader: opts.ServerTapAuthName,
+		AuthKey:    opts.InstanceKeys.KeyFor(inst.ServerTapKey, opts.ServerTapAuthKey),
+		TLS:        opts.ServerTapTLS,
+	})
 }
@@ -0,0 +1,761 @@
+package cronjob
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mcmm/internal/pgsql"
+	"mcmm/internal/worker"
+)
+
+type mapInstanceRepoMock struct {
+	pgsql.MapInstanceRepo
+	list []pgsql.MapInstance
+}
+
+func (m mapInstanceRepoMock) List(ctx context.Context) ([]pgsql.MapInstance, error) {
+	return m.list, nil
+}
+
+type workerMock struct {
+	worker.Worker
+	mu           sync.Mutex
+	stopped      []int64
+	restarts     map[int64]int
+	reconfigured []int64
+	started      []int64
+}
+
+func (m *workerMock) StartExisting(ctx context.Context, instanceID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.started = append(m.started, instanceID)
+	return nil
+}
+
+func (m *workerMock) StopOnly(ctx context.Context, instanceID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stopped = append(m.stopped, instanceID)
+	return nil
+}
+
+func (m *workerMock) RestartCount(ctx context.Context, instanceID int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.restarts[instanceID], nil
+}
+
+func (m *workerMock) ReconfigureAccess(ctx context.Context, instanceID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reconfigured = append(m.reconfigured, instanceID)
+	return nil
+}
+
+func newEmptyTapServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("There are 0 out of 20 players online."))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRunIdleOnce_RespectsGracePeriod(t *testing.T) {
+	srv := newEmptyTapServer(t)
+	now := time.Date(2026, 2, 13, 12, 0, 0, 0, time.UTC)
+	repos := pgsql.Repos{MapInstance: mapInstanceRepoMock{list: []pgsql.MapInstance{
+		{ID: 7, Alias: "a_world", Status: string(worker.StatusOn)},
+	}}}
+	wm := &workerMock{}
+	s := NewScheduler(repos, wm, Options{
+		IdleGrace:         10 * time.Minute,
+		InstanceTapURLFmt: srv.URL + "/inst-%d",
+		ServerTapTimeout:  2 * time.Second,
+		Now:               func() time.Time { return now },
+	})
+
+	s.runIdleOnce(context.Background())
+	if len(wm.stopped) != 0 {
+		t.Fatalf("recently emptied instance should not be stopped, stopped=%v", wm.stopped)
+	}
+
+	now = now.Add(5 * time.Minute)
+	s.runIdleOnce(context.Background())
+	if len(wm.stopped) != 0 {
+		t.Fatalf("instance empty for 5m should not be stopped, stopped=%v", wm.stopped)
+	}
+
+	now = now.Add(6 * time.Minute)
+	s.runIdleOnce(context.Background())
+	if len(wm.stopped) != 1 || wm.stopped[0] != 7 {
+		t.Fatalf("instance empty past grace should be stopped, stopped=%v", wm.stopped)
+	}
+}
+
+func TestRunIdleOnce_ForgetsInstancesThatLeaveOn(t *testing.T) {
+	srv := newEmptyTapServer(t)
+	now := time.Date(2026, 2, 13, 12, 0, 0, 0, time.UTC)
+	repos := pgsql.Repos{MapInstance: mapInstanceRepoMock{list: []pgsql.MapInstance{
+		{ID: 7, Alias: "a_world", Status: string(worker.StatusOn)},
+		{ID: 8, Alias: "b_world", Status: string(worker.StatusOn)},
+		{ID: 9, Alias: "c_world", Status: string(worker.StatusOn)},
+	}}}
+	s := NewScheduler(repos, &workerMock{}, Options{
+		IdleGrace:         10 * time.Minute,
+		IdleWarningLead:   time.Minute,
+		InstanceTapURLFmt: srv.URL + "/inst-%d",
+		ServerTapTimeout:  2 * time.Second,
+		Now:               func() time.Time { return now },
+	})
+	s.runIdleOnce(context.Background())
+	s.emptyMu.Lock()
+	s.pendingOff[8] = now.Add(time.Minute)
+	s.emptyMu.Unlock()
+
+	// #8 was stopped by hand and #9 deleted since the last pass.
+	s.repos.MapInstance = mapInstanceRepoMock{list: []pgsql.MapInstance{
+		{ID: 7, Alias: "a_world", Status: string(worker.StatusOn)},
+		{ID: 8, Alias: "b_world", Status: string(worker.StatusOff)},
+	}}
+	now = now.Add(time.Minute)
+	s.runIdleOnce(context.Background())
+	s.emptyMu.Lock()
+	defer s.emptyMu.Unlock()
+	if len(s.emptySince) != 1 || s.emptySince[7].IsZero() || len(s.pendingOff) != 0 {
+		t.Fatalf("only #7 should still be tracked, empty=%v pending=%v", s.emptySince, s.pendingOff)
+	}
+}
+
+func TestRunIdleOnce_NoGraceStopsImmediately(t *testing.T) {
+	srv := newEmptyTapServer(t)
+	repos := pgsql.Repos{MapInstance: mapInstanceRepoMock{list: []pgsql.MapInstance{
+		{ID: 3, Alias: "b_world", Status: string(worker.StatusOn)},
+	}}}
+	wm := &workerMock{}
+	s := NewScheduler(repos, wm, Options{
+		InstanceTapURLFmt: srv.URL + "/inst-%d",
+		ServerTapTimeout:  2 * time.Second,
+	})
+
+	s.runIdleOnce(context.Background())
+	if len(wm.stopped) != 1 {
+		t.Fatalf("expected immediate stop without grace, stopped=%v", wm.stopped)
+	}
+}
+
+func TestRunIdleOnce_JSONPlayerListKeepsInstanceOn(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"players":[{"name":"alice"}]}`))
+	}))
+	t.Cleanup(srv.Close)
+	repos := pgsql.Repos{MapInstance: mapInstanceRepoMock{list: []pgsql.MapInstance{
+		{ID: 4, Alias: "c_world", Status: string(worker.StatusOn)},
+	}}}
+	wm := &workerMock{}
+	s := NewScheduler(repos, wm, Options{
+		InstanceTapURLFmt: srv.URL + "/inst-%d",
+		ServerTapTimeout:  2 * time.Second,
+	})
+
+	s.runIdleOnce(context.Background())
+	if len(wm.stopped) != 0 {
+		t.Fatalf("instance with players should stay on, stopped=%v", wm.stopped)
+	}
+}
+
+type userRequestRepoMock struct {
+	pgsql.UserRequestRepo
+	rows   []pgsql.UserRequest
+	cutoff time.Time
+}
+
+func (m *userRequestRepoMock) ArchiveTerminalBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	m.cutoff = cutoff
+	kept := m.rows[:0]
+	var n int64
+	for _, r := range m.rows {
+		switch r.Status {
+		case "succeeded", "failed", "rejected", "canceled":
+			if r.UpdatedAt.Before(cutoff) {
+				n++
+				continue
+			}
+		}
+		kept = append(kept, r)
+	}
+	m.rows = kept
+	return n, nil
+}
+
+func TestRunRequestRetentionOnce_RemovesOldTerminalRows(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	old := now.AddDate(0, 0, -40)
+	recent := now.AddDate(0, 0, -2)
+	reqRepo := &userRequestRepoMock{rows: []pgsql.UserRequest{
+		{ID: 1, Status: "succeeded", UpdatedAt: old},
+		{ID: 2, Status: "pending", UpdatedAt: old},
+		{ID: 3, Status: "failed", UpdatedAt: recent},
+		{ID: 4, Status: "rejected", UpdatedAt: old},
+	}}
+	s := NewScheduler(pgsql.Repos{UserRequest: reqRepo}, &workerMock{}, Options{
+		RequestRetention: 30 * 24 * time.Hour,
+		Now:              func() time.Time { return now },
+	})
+
+	s.runRequestRetentionOnce(context.Background())
+
+	if !reqRepo.cutoff.Equal(now.AddDate(0, 0, -30)) {
+		t.Fatalf("unexpected cutoff: %v", reqRepo.cutoff)
+	}
+	ids := make([]int64, 0, len(reqRepo.rows))
+	for _, r := range reqRepo.rows {
+		ids = append(ids, r.ID)
+	}
+	if len(ids) != 2 || ids[0] != 2 || ids[1] != 3 {
+		t.Fatalf("expected pending and recent rows to survive, got=%v", ids)
+	}
+}
+
+func TestRunRequestRetentionOnce_ZeroRetentionKeepsEverything(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	reqRepo := &userRequestRepoMock{rows: []pgsql.UserRequest{{ID: 1, Status: "succeeded", UpdatedAt: now.AddDate(-1, 0, 0)}}}
+	s := NewScheduler(pgsql.Repos{UserRequest: reqRepo}, &workerMock{}, Options{Now: func() time.Time { return now }})
+
+	s.runRequestRetentionOnce(context.Background())
+
+	if len(reqRepo.rows) != 1 || !reqRepo.cutoff.IsZero() {
+		t.Fatalf("zero retention must not archive anything, rows=%d cutoff=%v", len(reqRepo.rows), reqRepo.cutoff)
+	}
+}
+
+func (m *userRequestRepoMock) ExpireOverdue(ctx context.Context, now time.Time) ([]pgsql.UserRequest, error) {
+	var out []pgsql.UserRequest
+	for i, r := range m.rows {
+		if r.Status == "pending" && r.ExpiresAt.Valid && !r.ExpiresAt.Time.After(now) {
+			r.Status = "expired"
+			r.ErrorCode = sql.NullString{String: "expired", Valid: true}
+			m.rows[i] = r
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (m *userRequestRepoMock) Update(ctx context.Context, req pgsql.UserRequest) error {
+	for i := range m.rows {
+		if m.rows[i].ID == req.ID {
+			m.rows[i] = req
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func TestRunRequestExpiryOnce_ExpiresOverduePendingRequests(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) sql.NullTime { return sql.NullTime{Time: now.Add(d), Valid: true} }
+	reqRepo := &userRequestRepoMock{rows: []pgsql.UserRequest{
+		{ID: 1, Status: "pending", ExpiresAt: at(-time.Hour)},
+		{ID: 2, Status: "pending", ExpiresAt: at(time.Hour)},
+		{ID: 3, Status: "pending"},
+		{ID: 4, Status: "rejected", ExpiresAt: at(-time.Hour)},
+		{ID: 5, Status: "pending", ExpiresAt: at(0)},
+	}}
+	s := NewScheduler(pgsql.Repos{UserRequest: reqRepo}, &workerMock{}, Options{
+		Now: func() time.Time { return now },
+	})
+
+	s.runRequestExpiryOnce(context.Background())
+
+	want := []string{"expired", "pending", "pending", "rejected", "expired"}
+	for i, r := range reqRepo.rows {
+		if r.Status != want[i] {
+			t.Fatalf("request #%d: expected %s, got %s", r.ID, want[i], r.Status)
+		}
+	}
+	if code := reqRepo.rows[0].ErrorCode; !code.Valid || code.String != "expired" {
+		t.Fatalf("expected error_code=expired, got %+v", code)
+	}
+}
+
+func TestRunIdleOnce_WarnsBeforeAutoOff(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		says []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cmd := r.FormValue("command")
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.HasPrefix(cmd, "say ") {
+			says = append(says, cmd)
+			_, _ = w.Write([]byte("ok"))
+			return
+		}
+		_, _ = w.Write([]byte("There are 0 out of 20 players online."))
+	}))
+	t.Cleanup(srv.Close)
+	now := time.Date(2026, 2, 13, 12, 0, 0, 0, time.UTC)
+	repos := pgsql.Repos{MapInstance: mapInstanceRepoMock{list: []pgsql.MapInstance{
+		{ID: 8, Alias: "d_world", Status: string(worker.StatusOn)},
+	}}}
+	wm := &workerMock{}
+	s := NewScheduler(repos, wm, Options{
+		InstanceTapURLFmt: srv.URL + "/inst-%d",
+		ServerTapTimeout:  2 * time.Second,
+		IdleWarningLead:   5 * time.Minute,
+		Now:               func() time.Time { return now },
+	})
+
+	s.runIdleOnce(context.Background())
+	if len(wm.stopped) != 0 {
+		t.Fatalf("first empty tick must only warn, stopped=%v", wm.stopped)
+	}
+	if len(says) != 1 || !strings.Contains(says[0], "5 minute(s)") {
+		t.Fatalf("expected one shutdown warning, got %v", says)
+	}
+
+	now = now.Add(2 * time.Minute)
+	s.runIdleOnce(context.Background())
+	if len(wm.stopped) != 0 || len(says) != 1 {
+		t.Fatalf("within lead time nothing should happen, stopped=%v says=%v", wm.stopped, says)
+	}
+
+	now = now.Add(4 * time.Minute)
+	s.runIdleOnce(context.Background())
+	if len(wm.stopped) != 1 || wm.stopped[0] != 8 {
+		t.Fatalf("still empty after lead time should stop, stopped=%v", wm.stopped)
+	}
+}
+
+func TestRunIdleOnce_ReturningPlayerCancelsPendingOff(t *testing.T) {
+	var players atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "There are %d out of 20 players online.", players.Load())
+	}))
+	t.Cleanup(srv.Close)
+	now := time.Date(2026, 2, 13, 12, 0, 0, 0, time.UTC)
+	repos := pgsql.Repos{MapInstance: mapInstanceRepoMock{list: []pgsql.MapInstance{
+		{ID: 9, Alias: "e_world", Status: string(worker.StatusOn)},
+	}}}
+	wm := &workerMock{}
+	s := NewScheduler(repos, wm, Options{
+		InstanceTapURLFmt: srv.URL + "/inst-%d",
+		ServerTapTimeout:  2 * time.Second,
+		IdleWarningLead:   5 * time.Minute,
+		Now:               func() time.Time { return now },
+	})
+
+	s.runIdleOnce(context.Background())
+	players.Store(1)
+	now = now.Add(2 * time.Minute)
+	s.runIdleOnce(context.Background())
+	players.Store(0)
+	now = now.Add(4 * time.Minute)
+	s.runIdleOnce(context.Background())
+	if len(wm.stopped) != 0 {
+		t.Fatalf("returning player should reset the warning, stopped=%v", wm.stopped)
+	}
+}
+
+func TestUpdateOptions_KeepsFixedFieldsAndSwapsReloadable(t *testing.T) {
+	now := func() time.Time { return time.Unix(0, 0) }
+	s := NewScheduler(pgsql.Repos{}, nil, Options{
+		OffInterval:       time.Hour,
+		RemoveDays:        14,
+		InstanceTapURLFmt: "http://inst-%d:4567",
+		ServerTapAuthKey:  "old",
+		Now:               now,
+	})
+	s.UpdateOptions(Options{
+		OffInterval:       2 * time.Hour,
+		RemoveDays:        3,
+		InstanceTapURLFmt: "http://ignored-%d",
+		ServerTapAuthKey:  "new",
+	})
+	got := s.options()
+	if got.OffInterval != 2*time.Hour || got.RemoveDays != 3 || got.ServerTapAuthKey != "new" {
+		t.Fatalf("reloadable options not applied: %+v", got)
+	}
+	if got.InstanceTapURLFmt != "http://inst-%d:4567" || got.Now == nil || !got.Now().Equal(now()) {
+		t.Fatalf("fixed options must be kept: %+v", got)
+	}
+	select {
+	case iv := <-s.intervalCh:
+		if iv != 2*time.Hour {
+			t.Fatalf("unexpected interval reset: %s", iv)
+		}
+	default:
+		t.Fatalf("changed off interval should reset the idle ticker")
+	}
+}
+
+func TestRunIdleOnce_KicksWithConfiguredIdleOffMessage(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		kicks []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cmd := r.FormValue("command")
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.HasPrefix(cmd, "kick ") {
+			kicks = append(kicks, cmd)
+			_, _ = w.Write([]byte("ok"))
+			return
+		}
+		_, _ = w.Write([]byte("There are 0 out of 20 players online."))
+	}))
+	t.Cleanup(srv.Close)
+	repos := pgsql.Repos{MapInstance: mapInstanceRepoMock{list: []pgsql.MapInstance{
+		{ID: 9, Alias: "e_world", Status: string(worker.StatusOn)},
+	}}}
+	wm := &workerMock{}
+	s := NewScheduler(repos, wm, Options{
+		InstanceTapURLFmt: srv.URL + "/inst-%d",
+		ServerTapTimeout:  2 * time.Second,
+		// No display_name set: {name} falls back to the alias.
+		IdleOffMessage: "{name} went to sleep",
+	})
+
+	s.runIdleOnce(context.Background())
+	if len(wm.stopped) != 1 {
+		t.Fatalf("idle instance should stop, stopped=%v", wm.stopped)
+	}
+	if len(kicks) != 1 || kicks[0] != "kick @a e_world went to sleep" {
+		t.Fatalf("expected idle-off kick with configured message, got %q", kicks)
+	}
+}
+
+type orphanInstanceRepoMock struct {
+	pgsql.MapInstanceRepo
+	orphans []pgsql.MapInstance
+	updated []pgsql.MapInstance
+}
+
+func (m *orphanInstanceRepoMock) ListOrphanedOwners(ctx context.Context) ([]pgsql.MapInstance, error) {
+	return m.orphans, nil
+}
+
+func (m *orphanInstanceRepoMock) Update(ctx context.Context, inst pgsql.MapInstance) error {
+	m.updated = append(m.updated, inst)
+	return nil
+}
+
+type memberRepoMock struct {
+	pgsql.InstanceMemberRepo
+	members []pgsql.InstanceMember
+}
+
+func (m *memberRepoMock) ListByInstance(ctx context.Context, instanceID int64) ([]pgsql.InstanceMember, error) {
+	out := make([]pgsql.InstanceMember, 0)
+	for _, mem := range m.members {
+		if mem.InstanceID == instanceID {
+			out = append(out, mem)
+		}
+	}
+	return out, nil
+}
+
+func (m *memberRepoMock) Create(ctx context.Context, member pgsql.InstanceMember) (int64, error) {
+	member.ID = int64(len(m.members) + 1)
+	m.members = append(m.members, member)
+	return member.ID, nil
+}
+
+func (m *memberRepoMock) Update(ctx context.Context, member pgsql.InstanceMember) error {
+	for i := range m.members {
+		if m.members[i].ID == member.ID {
+			m.members[i] = member
+		}
+	}
+	return nil
+}
+
+func TestRunOrphanCheckOnce_ReassignsToOrphanOwner(t *testing.T) {
+	instances := &orphanInstanceRepoMock{orphans: []pgsql.MapInstance{
+		{ID: 4, Alias: "gone_farm", OwnerID: 40, Status: string(worker.StatusOff)},
+		{ID: 5, Alias: "gone_castle", OwnerID: 41, Status: string(worker.StatusArchived)},
+	}}
+	members := &memberRepoMock{members: []pgsql.InstanceMember{
+		{ID: 1, InstanceID: 5, UserID: 9, Role: "member"},
+	}}
+	repos := pgsql.Repos{MapInstance: instances, InstanceMember: members}
+
+	reportOnly := NewScheduler(repos, &workerMock{}, Options{})
+	reportOnly.runOrphanCheckOnce(context.Background())
+	if len(instances.updated) != 0 {
+		t.Fatalf("without an orphan owner instances must only be reported, updated=%v", instances.updated)
+	}
+
+	s := NewScheduler(repos, &workerMock{}, Options{OrphanOwnerID: 9})
+	s.runOrphanCheckOnce(context.Background())
+	if len(instances.updated) != 2 || instances.updated[0].OwnerID != 9 || instances.updated[1].OwnerID != 9 {
+		t.Fatalf("orphaned instances should be reassigned to user 9, updated=%+v", instances.updated)
+	}
+	roles := map[int64]string{}
+	for _, m := range members.members {
+		if m.UserID == 9 {
+			roles[m.InstanceID] = m.Role
+		}
+	}
+	if roles[4] != "owner" || roles[5] != "owner" || len(members.members) != 2 {
+		t.Fatalf("orphan owner should own both instances exactly once, members=%+v", members.members)
+	}
+}
+
+type healthInstanceRepoMock struct {
+	pgsql.MapInstanceRepo
+	instances map[int64]pgsql.MapInstance
+	cutoff    time.Time
+}
+
+func (m *healthInstanceRepoMock) ListStaleOn(ctx context.Context, olderThan time.Time) ([]pgsql.MapInstance, error) {
+	m.cutoff = olderThan
+	out := make([]pgsql.MapInstance, 0)
+	for _, id := range []int64{2, 3} {
+		out = append(out, m.instances[id])
+	}
+	return out, nil
+}
+
+func (m *healthInstanceRepoMock) List(ctx context.Context) ([]pgsql.MapInstance, error) {
+	out := make([]pgsql.MapInstance, 0, len(m.instances))
+	for _, inst := range m.instances {
+		out = append(out, inst)
+	}
+	return out, nil
+}
+
+func (m *healthInstanceRepoMock) Read(ctx context.Context, id int64) (pgsql.MapInstance, error) {
+	return m.instances[id], nil
+}
+
+func (m *healthInstanceRepoMock) Update(ctx context.Context, inst pgsql.MapInstance) error {
+	m.instances[inst.ID] = inst
+	return nil
+}
+
+func TestRunHealthOnce_ProbesStaleInstances(t *testing.T) {
+	// Stale instances are probed in order; the second (#3) is down.
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) > 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte("There are 0 out of 20 players online."))
+	}))
+	t.Cleanup(srv.Close)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	instances := &healthInstanceRepoMock{instances: map[int64]pgsql.MapInstance{
+		2: {ID: 2, Alias: "alive", Status: string(worker.StatusOn), HealthStatus: string(worker.HealthHealthy)},
+		3: {ID: 3, Alias: "dead", Status: string(worker.StatusOn), HealthStatus: string(worker.HealthHealthy)},
+	}}
+	s := NewScheduler(pgsql.Repos{MapInstance: instances}, &workerMock{}, Options{
+		InstanceTapURLFmt: srv.URL + "/inst-%d",
+		ServerTapTimeout:  2 * time.Second,
+		HealthStaleAfter:  10 * time.Minute,
+		Now:               func() time.Time { return now },
+	})
+
+	s.runHealthOnce(context.Background())
+	if want := now.Add(-10 * time.Minute); !instances.cutoff.Equal(want) {
+		t.Fatalf("unexpected stale cutoff: got=%s want=%s", instances.cutoff, want)
+	}
+	alive, dead := instances.instances[2], instances.instances[3]
+	if alive.HealthStatus != string(worker.HealthHealthy) || !alive.LastHealthAt.Valid || !alive.LastHealthAt.Time.Equal(now) {
+		t.Fatalf("reachable instance should be recorded healthy now, got %+v", alive)
+	}
+	if dead.HealthStatus != string(worker.HealthUnreachable) || !dead.LastErrorMsg.Valid {
+		t.Fatalf("unreachable instance should be flagged, got %+v", dead)
+	}
+	if dead.Status != string(worker.StatusOn) {
+		t.Fatalf("health pass must not change status, got %s", dead.Status)
+	}
+}
+
+func TestRunHealthOnce_AutoRecoverUpToCapThenStops(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	t.Cleanup(srv.Close)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	instances := &healthInstanceRepoMock{instances: map[int64]pgsql.MapInstance{
+		2: {ID: 2, Alias: "parked", Status: string(worker.StatusOff)},
+		3: {ID: 3, Alias: "dead", OwnerID: 7, Status: string(worker.StatusOn), HealthStatus: string(worker.HealthHealthy)},
+	}}
+	wm := &workerMock{}
+	var notified []string
+	s := NewScheduler(pgsql.Repos{MapInstance: instances}, wm, Options{
+		InstanceTapURLFmt: srv.URL + "/inst-%d",
+		ServerTapTimeout:  2 * time.Second,
+		HealthStaleAfter:  10 * time.Minute,
+		Now:               func() time.Time { return now },
+		AutoRecover:       AutoRecoverPolicy{MaxAttempts: 2, Window: time.Hour},
+		NotifyOwner: func(ctx context.Context, userID int64, msg string) {
+			notified = append(notified, fmt.Sprintf("%d:%s", userID, msg))
+		},
+	})
+
+	for pass := 1; pass <= 2; pass++ {
+		s.runHealthOnce(context.Background())
+		s.recoverWG.Wait()
+		if got := instances.instances[3].RecoverAttempts; got != pass {
+			t.Fatalf("pass %d: expected %d attempts recorded, got %d", pass, pass, got)
+		}
+		now = now.Add(10 * time.Minute)
+	}
+	if !slices.Equal(wm.started, []int64{3, 3}) || !slices.Equal(wm.stopped, []int64{3, 3}) {
+		t.Fatalf("expected two restarts of #3, stopped=%v started=%v", wm.stopped, wm.started)
+	}
+	if len(notified) != 0 {
+		t.Fatalf("owner should not be told while recovering, got %v", notified)
+	}
+
+	s.runHealthOnce(context.Background())
+	s.recoverWG.Wait()
+	if !slices.Equal(wm.started, []int64{3, 3}) || !slices.Equal(wm.stopped, []int64{3, 3, 3}) {
+		t.Fatalf("third failure should only stop, stopped=%v started=%v", wm.stopped, wm.started)
+	}
+	if len(notified) != 1 || !strings.HasPrefix(notified[0], "7:") || !strings.Contains(notified[0], "#3:dead") {
+		t.Fatalf("expected one owner notification, got %v", notified)
+	}
+	dead := instances.instances[3]
+	if dead.RecoverAttempts != 0 || dead.RecoverWindowAt.Valid || dead.HealthStatus != string(worker.HealthUnreachable) {
+		t.Fatalf("give-up should clear the count and record unreachable, got %+v", dead)
+	}
+}
+
+// hangingStopWorker never finishes a stop until its context ends.
+type hangingStopWorker struct {
+	workerMock
+	stopErr chan error
+}
+
+func (m *hangingStopWorker) StopOnly(ctx context.Context, instanceID int64) error {
+	<-ctx.Done()
+	m.stopErr <- ctx.Err()
+	return ctx.Err()
+}
+
+func TestRunHealthOnce_RecoverRunsInBackgroundAndStopsWithScheduler(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	t.Cleanup(srv.Close)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	instances := &healthInstanceRepoMock{instances: map[int64]pgsql.MapInstance{
+		2: {ID: 2, Alias: "dead_too", Status: string(worker.StatusOn)},
+		3: {ID: 3, Alias: "dead", Status: string(worker.StatusOn)},
+	}}
+	wm := &hangingStopWorker{stopErr: make(chan error, 2)}
+	s := NewScheduler(pgsql.Repos{MapInstance: instances}, wm, Options{
+		InstanceTapURLFmt: srv.URL + "/inst-%d",
+		ServerTapTimeout:  2 * time.Second,
+		HealthStaleAfter:  10 * time.Minute,
+		Now:               func() time.Time { return now },
+		AutoRecover:       AutoRecoverPolicy{MaxAttempts: 3, Window: time.Hour},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		s.runHealthOnce(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("a hanging restart must not hold up the health pass")
+	}
+	if instances.instances[2].RecoverAttempts != 1 || instances.instances[3].RecoverAttempts != 1 {
+		t.Fatalf("both instances should get an attempt in the same pass: %+v", instances.instances)
+	}
+	s.runHealthOnce(ctx)
+	if instances.instances[3].RecoverAttempts != 1 {
+		t.Fatalf("an instance with a restart in flight must not get another, got %d", instances.instances[3].RecoverAttempts)
+	}
+
+	cancel()
+	s.recoverWG.Wait()
+	for i := 0; i < 2; i++ {
+		if err := <-wm.stopErr; !errors.Is(err, context.Canceled) {
+			t.Fatalf("shutdown should cancel the restart, got %v", err)
+		}
+	}
+}
+
+func TestRunHealthOnce_ForgetsRestartCountsOfInstancesNoLongerOn(t *testing.T) {
+	srv := newEmptyTapServer(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	instances := &healthInstanceRepoMock{instances: map[int64]pgsql.MapInstance{
+		2: {ID: 2, Alias: "steady", Status: string(worker.StatusOn)},
+		3: {ID: 3, Alias: "leaving", Status: string(worker.StatusOn)},
+	}}
+	wm := &workerMock{restarts: map[int64]int{2: 1, 3: 4}}
+	s := NewScheduler(pgsql.Repos{MapInstance: instances}, wm, Options{
+		InstanceTapURLFmt: srv.URL + "/inst-%d",
+		ServerTapTimeout:  2 * time.Second,
+		HealthStaleAfter:  10 * time.Minute,
+		Now:               func() time.Time { return now },
+	})
+
+	s.runHealthOnce(context.Background())
+	if len(s.restartCounts) != 2 {
+		t.Fatalf("both counts should be remembered, got %v", s.restartCounts)
+	}
+	inst := instances.instances[3]
+	inst.Status = string(worker.StatusArchived)
+	instances.instances[3] = inst
+	s.runHealthOnce(context.Background())
+	if _, kept := s.restartCounts[3]; kept || len(s.restartCounts) != 1 {
+		t.Fatalf("the archived instance's count should be dropped, got %v", s.restartCounts)
+	}
+}
+
+func TestRunHealthOnce_ReconfiguresRestartedContainer(t *testing.T) {
+	srv := newEmptyTapServer(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	instances := &healthInstanceRepoMock{instances: map[int64]pgsql.MapInstance{
+		2: {ID: 2, Alias: "steady", Status: string(worker.StatusOn), HealthStatus: string(worker.HealthHealthy)},
+		3: {ID: 3, Alias: "crashy", Status: string(worker.StatusOn), HealthStatus: string(worker.HealthHealthy)},
+	}}
+	wm := &workerMock{restarts: map[int64]int{2: 1, 3: 0}}
+	s := NewScheduler(pgsql.Repos{MapInstance: instances}, wm, Options{
+		InstanceTapURLFmt: srv.URL + "/inst-%d",
+		ServerTapTimeout:  2 * time.Second,
+		HealthStaleAfter:  10 * time.Minute,
+		Now:               func() time.Time { return now },
+	})
+
+	// The first pass only learns the counts, even a non-zero one.
+	s.runHealthOnce(context.Background())
+	if len(wm.reconfigured) != 0 {
+		t.Fatalf("first pass must not reconfigure, got %v", wm.reconfigured)
+	}
+
+	wm.restarts[3] = 1
+	s.runHealthOnce(context.Background())
+	if len(wm.reconfigured) != 1 || wm.reconfigured[0] != 3 {
+		t.Fatalf("restarted container should be reconfigured once, got %v", wm.reconfigured)
+	}
+
+	s.runHealthOnce(context.Background())
+	if len(wm.reconfigured) != 1 {
+		t.Fatalf("unchanged restart count must not reconfigure again, got %v", wm.reconfigured)
+	}
+}
@@ -67,8 +67,24 @@ var colorPresetMap = map[string]string{
 	"white":  ansiWhite,
 }
 
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+)
+
 // SetupLogger Default: INFO
 func SetupLogger(logLevel string) {
+	SetupLoggerWithFormat(logLevel, FormatConsole)
+}
+
+// SetupLoggerWithFormat is SetupLogger with an output format. FormatJSON
+// writes one JSON object per line with component as a plain field and no
+// ANSI colors; anything else keeps the colored console output.
+func SetupLoggerWithFormat(logLevel string, format string) {
+	Logger = newLogger(logLevel, format, zapcore.AddSync(os.Stdout))
+}
+
+func newLogger(logLevel string, format string, out zapcore.WriteSyncer) *zap.SugaredLogger {
 	// set log level
 	var level zapcore.Level
 	switch strings.ToUpper(logLevel) {
@@ -84,6 +100,24 @@ func SetupLogger(logLevel string) {
 		level = zap.InfoLevel
 	}
 
+	if strings.EqualFold(strings.TrimSpace(format), FormatJSON) {
+		encoderConfig := zapcore.EncoderConfig{
+			TimeKey:        "time",
+			LevelKey:       "level",
+			NameKey:        "logger",
+			CallerKey:      "caller",
+			MessageKey:     "msg",
+			StacktraceKey:  "stacktrace",
+			LineEnding:     zapcore.DefaultLineEnding,
+			EncodeTime:     zapcore.ISO8601TimeEncoder,
+			EncodeLevel:    zapcore.LowercaseLevelEncoder,
+			EncodeDuration: zapcore.SecondsDurationEncoder,
+			EncodeCaller:   zapcore.ShortCallerEncoder,
+		}
+		core := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), out, zap.NewAtomicLevelAt(level))
+		return zap.New(core, zap.AddCaller()).Sugar()
+	}
+
 	encoderConfig := zapcore.EncoderConfig{
 		TimeKey:          "time",
 		LevelKey:         "level",
@@ -101,11 +135,11 @@ func SetupLogger(logLevel string) {
 
 	core := zapcore.NewCore(
 		zapcore.NewConsoleEncoder(encoderConfig),
-		zapcore.NewMultiWriteSyncer(zapcore.AddSync(os.Stdout)),
+		zapcore.NewMultiWriteSyncer(out),
 		zap.NewAtomicLevelAt(level),
 	)
 
-	Logger = zap.New(newComponentCore(core), zap.AddCaller()).Sugar()
+	return zap.New(newComponentCore(core), zap.AddCaller()).Sugar()
 }
 
 func Component(name string) *zap.SugaredLogger {
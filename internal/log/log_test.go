@@ -1,6 +1,13 @@
 package log
 
-import "testing"
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
 
 func TestSetupLogger(t *testing.T) {
 	SetupLogger(LevelDebug)
@@ -18,3 +25,30 @@ func TestSetupLogger(t *testing.T) {
 	Logger.Error("This is error level log")
 	Logger.Errorf("This is error level log: %s", "test")
 }
+
+func TestJSONFormatKeepsComponentField(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(LevelDebug, FormatJSON, zapcore.AddSync(&buf)).With("component", "worker")
+	logger.Infof("instance %d started", 5)
+	logger.Warnf("instance %d slow", 6)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %q", len(lines), buf.String())
+	}
+	for _, line := range lines {
+		if strings.Contains(line, "\u001b[") {
+			t.Fatalf("json output must not contain ANSI escapes: %q", line)
+		}
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("line is not json: %q: %v", line, err)
+		}
+		if entry["component"] != "worker" {
+			t.Fatalf("component should be a field: %v", entry)
+		}
+		if msg, _ := entry["msg"].(string); strings.HasPrefix(msg, "[") {
+			t.Fatalf("message should not carry the bracket prefix: %q", msg)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"mcmm/internal/log"
+	"mcmm/internal/pgsql"
+)
+
+const (
+	WorkerOperations = "mcmm_worker_operations_total"
+	WorldCommands    = "mcmm_world_commands_total"
+	Instances        = "mcmm_instances"
+	PendingRequests  = "mcmm_pending_requests"
+)
+
+type Labels map[string]string
+
+// Sample is one series of a gauge family.
+type Sample struct {
+	Labels Labels
+	Value  float64
+}
+
+// GaugeFunc is evaluated on every scrape.
+type GaugeFunc func(ctx context.Context) ([]Sample, error)
+
+type family struct {
+	help   string
+	kind   string
+	series map[string]float64
+	gauge  GaugeFunc
+}
+
+// Registry holds counters incremented in-process and gauges collected at
+// scrape time, and renders them in the Prometheus text exposition format.
+// A nil *Registry is valid and records nothing.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+	logger   interface {
+		Warnf(string, ...any)
+	}
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		families: make(map[string]*family),
+		logger:   log.Component("metrics"),
+	}
+}
+
+// NewDefaultRegistry describes the counters the worker and cmdreceiver
+// increment and registers the instance/request gauges backed by repos.
+func NewDefaultRegistry(repos pgsql.Repos) *Registry {
+	r := NewRegistry()
+	r.Counter(WorkerOperations, "Worker operations by operation and result.")
+	r.Counter(WorldCommands, "World commands handled by action and HTTP status code.")
+	if repos.MapInstance != nil {
+		r.Gauge(Instances, "Instances by status.", instancesByStatus(repos.MapInstance))
+	}
+	if repos.UserRequest != nil {
+		r.Gauge(PendingRequests, "User requests waiting for review.", pendingRequests(repos.UserRequest))
+	}
+	return r
+}
+
+func (r *Registry) Counter(name string, help string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.familyLocked(name, "counter").help = help
+}
+
+func (r *Registry) Gauge(name string, help string, fn GaugeFunc) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.familyLocked(name, "gauge")
+	f.help = help
+	f.gauge = fn
+}
+
+// Inc adds one to the counter series identified by labels.
+func (r *Registry) Inc(name string, labels Labels) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.familyLocked(name, "counter").series[formatLabels(labels)]++
+}
+
+// IncResult counts an operation as "success" or "failure" depending on err.
+func (r *Registry) IncResult(name string, labels Labels, err error) {
+	if r == nil {
+		return
+	}
+	l := Labels{"result": "success"}
+	if err != nil {
+		l["result"] = "failure"
+	}
+	for k, v := range labels {
+		l[k] = v
+	}
+	r.Inc(name, l)
+}
+
+func (r *Registry) familyLocked(name string, kind string) *family {
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{kind: kind, series: make(map[string]float64)}
+		r.families[name] = f
+	}
+	return f
+}
+
+// WriteText renders every family sorted by name. A failing gauge is logged
+// and left out so one broken query does not hide the other metrics.
+func (r *Registry) WriteText(ctx context.Context, w io.Writer) error {
+	type snapshot struct {
+		name   string
+		help   string
+		kind   string
+		series map[string]float64
+		gauge  GaugeFunc
+	}
+	r.mu.Lock()
+	snaps := make([]snapshot, 0, len(r.families))
+	for name, f := range r.families {
+		series := make(map[string]float64, len(f.series))
+		for k, v := range f.series {
+			series[k] = v
+		}
+		snaps = append(snaps, snapshot{name: name, help: f.help, kind: f.kind, series: series, gauge: f.gauge})
+	}
+	r.mu.Unlock()
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].name < snaps[j].name })
+
+	var b strings.Builder
+	for _, s := range snaps {
+		if s.gauge != nil {
+			samples, err := s.gauge(ctx)
+			if err != nil {
+				r.logger.Warnf("collect %s failed: %v", s.name, err)
+				continue
+			}
+			for _, sample := range samples {
+				s.series[formatLabels(sample.Labels)] = sample.Value
+			}
+		}
+		if s.help != "" {
+			fmt.Fprintf(&b, "# HELP %s %s\n", s.name, s.help)
+		}
+		fmt.Fprintf(&b, "# TYPE %s %s\n", s.name, s.kind)
+		keys := make([]string, 0, len(s.series))
+		for k := range s.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&b, "%s%s %s\n", s.name, k, strconv.FormatFloat(s.series[k], 'g', -1, 64))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ServeHTTP serves GET /metrics.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.WriteText(req.Context(), w)
+}
+
+func instancesByStatus(repo pgsql.MapInstanceRepo) GaugeFunc {
+	return func(ctx context.Context) ([]Sample, error) {
+		counts, err := repo.CountByStatus(ctx)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]Sample, 0, len(counts))
+		for status, n := range counts {
+			out = append(out, Sample{Labels: Labels{"status": status}, Value: float64(n)})
+		}
+		return out, nil
+	}
+}
+
+func pendingRequests(repo pgsql.UserRequestRepo) GaugeFunc {
+	return func(ctx context.Context) ([]Sample, error) {
+		n, err := repo.CountByStatus(ctx, "pending")
+		if err != nil {
+			return nil, err
+		}
+		return []Sample{{Value: float64(n)}}, nil
+	}
+}
+
+func formatLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+`="`+escapeLabelValue(labels[k])+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func escapeLabelValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	return strings.ReplaceAll(v, "\n", `\n`)
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"mcmm/internal/pgsql"
+)
+
+type mapInstanceRepoMock struct {
+	pgsql.MapInstanceRepo
+	rows []pgsql.MapInstance
+}
+
+func (m *mapInstanceRepoMock) CountByStatus(ctx context.Context) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	for _, inst := range m.rows {
+		counts[inst.Status]++
+	}
+	return counts, nil
+}
+
+type userRequestRepoMock struct {
+	pgsql.UserRequestRepo
+	pending int64
+	err     error
+}
+
+func (m *userRequestRepoMock) CountByStatus(ctx context.Context, status string) (int64, error) {
+	if status != "pending" {
+		return 0, nil
+	}
+	return m.pending, m.err
+}
+
+func TestRegistry_RendersSeededState(t *testing.T) {
+	r := NewDefaultRegistry(pgsql.Repos{
+		MapInstance: &mapInstanceRepoMock{rows: []pgsql.MapInstance{
+			{ID: 1, Status: "On"},
+			{ID: 2, Status: "Off"},
+			{ID: 3, Status: "On"},
+			{ID: 4, Status: "Archived"},
+		}},
+		UserRequest: &userRequestRepoMock{pending: 2},
+	})
+	r.IncResult(WorkerOperations, Labels{"op": "start"}, nil)
+	r.IncResult(WorkerOperations, Labels{"op": "start"}, nil)
+	r.IncResult(WorkerOperations, Labels{"op": "stop"}, errors.New("boom"))
+	r.Inc(WorldCommands, Labels{"action": "world_on", "code": "200"})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	want := `# HELP mcmm_instances Instances by status.
+# TYPE mcmm_instances gauge
+mcmm_instances{status="Archived"} 1
+mcmm_instances{status="Off"} 1
+mcmm_instances{status="On"} 2
+# HELP mcmm_pending_requests User requests waiting for review.
+# TYPE mcmm_pending_requests gauge
+mcmm_pending_requests 2
+# HELP mcmm_worker_operations_total Worker operations by operation and result.
+# TYPE mcmm_worker_operations_total counter
+mcmm_worker_operations_total{op="start",result="success"} 2
+mcmm_worker_operations_total{op="stop",result="failure"} 1
+# HELP mcmm_world_commands_total World commands handled by action and HTTP status code.
+# TYPE mcmm_world_commands_total counter
+mcmm_world_commands_total{action="world_on",code="200"} 1
+`
+	if got := rec.Body.String(); got != want {
+		t.Fatalf("unexpected exposition:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRegistry_SkipsFailingGaugeAndEscapesLabels(t *testing.T) {
+	r := NewDefaultRegistry(pgsql.Repos{
+		UserRequest: &userRequestRepoMock{err: errors.New("db down")},
+	})
+	r.Inc(WorldCommands, Labels{"action": "a\"b\\c\nd", "code": "400"})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	want := `# HELP mcmm_worker_operations_total Worker operations by operation and result.
+# TYPE mcmm_worker_operations_total counter
+# HELP mcmm_world_commands_total World commands handled by action and HTTP status code.
+# TYPE mcmm_world_commands_total counter
+mcmm_world_commands_total{action="a\"b\\c\nd",code="400"} 1
+`
+	if got := rec.Body.String(); got != want {
+		t.Fatalf("unexpected exposition:\n%s\nwant:\n%s", got, want)
+	}
+
+	var nilRegistry *Registry
+	nilRegistry.Inc(WorldCommands, nil)
+	nilRegistry.IncResult(WorkerOperations, nil, nil)
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"time"
 )
 
 // c-layer contracts exposed to other packages.
@@ -13,8 +15,11 @@ type UserRepo interface {
 	Read(ctx context.Context, id int64) (User, error)
 	ReadByUUID(ctx context.Context, mcUUID string) (User, error)
 	ReadByName(ctx context.Context, mcName string) (User, error)
-	List(ctx context.Context) ([]User, error)
+	ReadByIDs(ctx context.Context, ids []int64) (map[int64]User, error)
+	List(ctx context.Context, limit int, offset int) ([]User, error)
+	Count(ctx context.Context) (int64, error)
 	ListByRole(ctx context.Context, role string) ([]User, error)
+	Upsert(ctx context.Context, mcUUID string, mcName string) (User, bool, error)
 	Update(ctx context.Context, user User) error
 	Delete(ctx context.Context, id int64) error
 }
@@ -25,6 +30,7 @@ type MapTemplateRepo interface {
 	ReadByTag(ctx context.Context, tag string) (MapTemplate, error)
 	List(ctx context.Context) ([]MapTemplate, error)
 	ListByGameVersion(ctx context.Context, gameVersion string) ([]MapTemplate, error)
+	SearchByTag(ctx context.Context, substring string, gameVersion string) ([]MapTemplate, error)
 	ListGameVersions(ctx context.Context) ([]string, error)
 	Update(ctx context.Context, template MapTemplate) error
 	Delete(ctx context.Context, id int64) error
@@ -50,6 +56,12 @@ type MapInstanceRepo interface {
 	ReadByAlias(ctx context.Context, alias string) (MapInstance, error)
 	ListByOwner(ctx context.Context, ownerID int64) ([]MapInstance, error)
 	List(ctx context.Context) ([]MapInstance, error)
+	CountByStatus(ctx context.Context) (map[string]int64, error)
+	ListArchived(ctx context.Context) ([]MapInstance, error)
+	ListForUser(ctx context.Context, userID int64, includeArchived bool) ([]UserInstance, error)
+	ListAliasesWithPrefix(ctx context.Context, prefix string) ([]string, error)
+	ListOrphanedOwners(ctx context.Context) ([]MapInstance, error)
+	ListStaleOn(ctx context.Context, olderThan time.Time) ([]MapInstance, error)
 	Update(ctx context.Context, inst MapInstance) error
 	Delete(ctx context.Context, id int64) error
 }
@@ -58,42 +70,111 @@ type InstanceMemberRepo interface {
 	Create(ctx context.Context, member InstanceMember) (int64, error)
 	Read(ctx context.Context, id int64) (InstanceMember, error)
 	ListByInstance(ctx context.Context, instanceID int64) ([]InstanceMember, error)
+	ListWithUsers(ctx context.Context, instanceID int64) ([]MemberWithUser, error)
 	ListByUser(ctx context.Context, userID int64) ([]InstanceMember, error)
 	Update(ctx context.Context, member InstanceMember) error
 	Delete(ctx context.Context, id int64) error
 	DeleteByInstanceAndUser(ctx context.Context, instanceID int64, userID int64) error
 }
 
+// PendingWhitelistRepo queues whitelist changes made while an instance is
+// Off. Enqueue keeps one op per player, the latest winning.
+type PendingWhitelistRepo interface {
+	Enqueue(ctx context.Context, op PendingWhitelistOp) error
+	ListByInstance(ctx context.Context, instanceID int64) ([]PendingWhitelistOp, error)
+	DeleteThrough(ctx context.Context, instanceID int64, maxID int64) error
+}
+
 type UserRequestRepo interface {
 	Create(ctx context.Context, req UserRequest) (int64, error)
 	Read(ctx context.Context, id int64) (UserRequest, error)
 	ReadByRequestID(ctx context.Context, requestID string) (UserRequest, error)
 	ListByActor(ctx context.Context, actorUserID int64, limit int) ([]UserRequest, error)
 	ListPending(ctx context.Context, limit int) ([]UserRequest, error)
+	ListFiltered(ctx context.Context, filter UserRequestFilter, page Page) ([]UserRequest, error)
+	ExpireOverdue(ctx context.Context, now time.Time) ([]UserRequest, error)
+	CountByStatus(ctx context.Context, status string) (int64, error)
+	CountPendingByActor(ctx context.Context, actorUserID int64) (int64, error)
 	Update(ctx context.Context, req UserRequest) error
 	Delete(ctx context.Context, id int64) error
 	CreateAcceptedIfNotExists(ctx context.Context, requestID string, requestType string, actorUserID sql.NullInt64, targetInstanceID sql.NullInt64) (UserRequest, bool, error)
 	MarkRequestResult(ctx context.Context, requestID string, status string, responsePayload json.RawMessage, errorCode sql.NullString, errorMsg sql.NullString) error
+	ArchiveTerminalBefore(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// UserRequestFilter narrows UserRequestRepo.ListFiltered; zero fields match
+// every row.
+type UserRequestFilter struct {
+	Status           string
+	ActorUserID      int64
+	TargetInstanceID int64
+}
+
+// Page selects rows Size*(Number-1) .. Size*Number-1 of a listing; Number
+// starts at 1.
+type Page struct {
+	Number int
+	Size   int
+}
+
+// Offset is the number of rows before this page.
+func (p Page) Offset() int {
+	if p.Number <= 1 {
+		return 0
+	}
+	return (p.Number - 1) * p.Size
 }
 
 type Repos struct {
-	User           UserRepo
-	MapTemplate    MapTemplateRepo
-	ServerImage    ServerImageRepo
-	GameVersion    GameVersionRepo
-	MapInstance    MapInstanceRepo
-	InstanceMember InstanceMemberRepo
-	UserRequest    UserRequestRepo
+	User             UserRepo
+	MapTemplate      MapTemplateRepo
+	ServerImage      ServerImageRepo
+	GameVersion      GameVersionRepo
+	MapInstance      MapInstanceRepo
+	InstanceMember   InstanceMemberRepo
+	UserRequest      UserRequestRepo
+	PendingWhitelist PendingWhitelistRepo
+}
+
+// WithTx returns the SQL-backed repos bound to tx, so several writes commit or
+// roll back together:
+//
+//	tx, err := connector.BeginTx(ctx, nil)
+//	...
+//	txRepos := repos.WithTx(tx)
+//	defer tx.Rollback()
+//	... txRepos.MapInstance.Create / txRepos.InstanceMember.Create ...
+//	return tx.Commit()
+//
+// The result always holds the SQL implementations; repos swapped in for
+// tests are not carried over.
+func (r Repos) WithTx(tx *sql.Tx) Repos {
+	return NewRepos(txConnector{tx: tx})
+}
+
+// InTx runs fn with repos bound to one transaction on connector, committing
+// when fn returns nil and rolling back otherwise.
+func (r Repos) InTx(ctx context.Context, connector SQLConnector, fn func(Repos) error) error {
+	tx, err := connector.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err := fn(r.WithTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func NewRepos(connector SQLConnector) Repos {
 	return Repos{
-		User:           NewUserRepoI(connector),
-		MapTemplate:    NewMapTemplateRepoI(connector),
-		ServerImage:    NewServerImageRepoI(connector),
-		GameVersion:    NewGameVersionRepoI(connector),
-		MapInstance:    NewMapInstanceRepoI(connector),
-		InstanceMember: NewInstanceMemberRepoI(connector),
-		UserRequest:    NewUserRequestRepoI(connector),
+		User:             NewUserRepoI(connector),
+		MapTemplate:      NewMapTemplateRepoI(connector),
+		ServerImage:      NewServerImageRepoI(connector),
+		GameVersion:      NewGameVersionRepoI(connector),
+		MapInstance:      NewMapInstanceRepoI(connector),
+		InstanceMember:   NewInstanceMemberRepoI(connector),
+		UserRequest:      NewUserRequestRepoI(connector),
+		PendingWhitelist: NewPendingWhitelistRepoI(connector),
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -63,12 +64,44 @@ func (r *UserRepoI) ReadByName(ctx context.Context, mcName string) (User, error)
 	return user, nil
 }
 
-func (r *UserRepoI) List(ctx context.Context) ([]User, error) {
+// ReadByIDs loads the given users in one query, keyed by id. Ids without a
+// row are simply absent from the map.
+func (r *UserRepoI) ReadByIDs(ctx context.Context, ids []int64) (map[int64]User, error) {
+	out := make(map[int64]User, len(ids))
+	if len(ids) == 0 {
+		return out, nil
+	}
+	rows, err := r.connector.QueryContext(ctx, `
+		SELECT id, mc_uuid, mc_name, server_role, created_at
+		FROM users
+		WHERE id = ANY($1)
+	`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.MCUUID, &user.MCName, &user.ServerRole, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		out[user.ID] = user
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// List returns one page of users in id order.
+func (r *UserRepoI) List(ctx context.Context, limit int, offset int) ([]User, error) {
 	rows, err := r.connector.QueryContext(ctx, `
 		SELECT id, mc_uuid, mc_name, server_role, created_at
 		FROM users
 		ORDER BY id ASC
-	`)
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -88,6 +121,14 @@ func (r *UserRepoI) List(ctx context.Context) ([]User, error) {
 	return out, nil
 }
 
+func (r *UserRepoI) Count(ctx context.Context) (int64, error) {
+	var n int64
+	if err := r.connector.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
 func (r *UserRepoI) ListByRole(ctx context.Context, role string) ([]User, error) {
 	rows, err := r.connector.QueryContext(ctx, `
 		SELECT id, mc_uuid, mc_name, server_role, created_at
@@ -114,6 +155,23 @@ func (r *UserRepoI) ListByRole(ctx context.Context, role string) ([]User, error)
 	return out, nil
 }
 
+// Upsert creates the user as a plain "user" or, when mc_uuid already exists,
+// only renames it, in one statement so concurrent joins for the same UUID
+// cannot race between a read and a write. created reports whether the row
+// was inserted by this call.
+func (r *UserRepoI) Upsert(ctx context.Context, mcUUID string, mcName string) (user User, created bool, err error) {
+	err = r.connector.QueryRowContext(ctx, `
+		INSERT INTO users (mc_uuid, mc_name, server_role, created_at)
+		VALUES ($1, $2, 'user', NOW())
+		ON CONFLICT (mc_uuid) DO UPDATE SET mc_name = EXCLUDED.mc_name
+		RETURNING id, mc_uuid, mc_name, server_role, created_at, (xmax = 0)
+	`, mcUUID, mcName).Scan(&user.ID, &user.MCUUID, &user.MCName, &user.ServerRole, &user.CreatedAt, &created)
+	if err != nil {
+		return User{}, false, err
+	}
+	return user, created, nil
+}
+
 func (r *UserRepoI) Update(ctx context.Context, user User) error {
 	_, err := r.connector.ExecContext(ctx, `
 		UPDATE users
@@ -222,6 +280,42 @@ func (r *MapTemplateRepoI) ListByGameVersion(ctx context.Context, gameVersion st
 	return out, nil
 }
 
+// maxTemplateSearchResults caps SearchByTag so a one-letter query cannot
+// dump the whole table.
+const maxTemplateSearchResults = 50
+
+// SearchByTag returns templates whose tag or display name contains q,
+// ignoring case, narrowed to gameVersion when it is not empty. LIKE
+// wildcards in q match literally.
+func (r *MapTemplateRepoI) SearchByTag(ctx context.Context, q string, gameVersion string) ([]MapTemplate, error) {
+	rows, err := r.connector.QueryContext(ctx, `
+		SELECT id, tag, display_name, game_version, blob_path, created_at
+		FROM map_templates
+		WHERE (tag ILIKE '%' || $1 || '%' ESCAPE '\'
+		   OR display_name ILIKE '%' || $1 || '%' ESCAPE '\')
+		  AND ($2 = '' OR game_version = $2)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3
+	`, escapeLike(q), gameVersion, maxTemplateSearchResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]MapTemplate, 0)
+	for rows.Next() {
+		var t MapTemplate
+		if err := rows.Scan(&t.ID, &t.Tag, &t.DisplayName, &t.GameVersion, &t.BlobPath, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (r *MapTemplateRepoI) ListGameVersions(ctx context.Context) ([]string, error) {
 	rows, err := r.connector.QueryContext(ctx, `
 		SELECT DISTINCT game_version
@@ -406,16 +500,20 @@ func (r *MapInstanceRepoI) Create(ctx context.Context, inst MapInstance) (int64,
 	if healthStatus == "" {
 		healthStatus = "unknown"
 	}
+	displayName := inst.DisplayName
+	if displayName == "" {
+		displayName = alias
+	}
 	var id int64
 	err := r.connector.QueryRowContext(ctx, `
 		INSERT INTO map_instances (
 			alias, owner_id, template_id, source_type, game_version, access_mode, status,
 			health_status, last_error_msg, last_health_at,
-			created_at, updated_at, last_active_at, archived_at
+			created_at, updated_at, last_active_at, archived_at, display_name, last_compose_output, archive_pinned, notes, servertap_key, host_port, cpu_limit, mem_limit_mb, gamemode, difficulty, max_players, motd, storage_type, level_seed
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW(), NOW(), $11, $12)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW(), NOW(), $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26)
 		RETURNING id
-	`, alias, inst.OwnerID, inst.TemplateID, inst.SourceType, inst.GameVersion, accessMode, inst.Status, healthStatus, inst.LastErrorMsg, inst.LastHealthAt, inst.LastActiveAt, inst.ArchivedAt).Scan(&id)
+	`, alias, inst.OwnerID, inst.TemplateID, inst.SourceType, inst.GameVersion, accessMode, inst.Status, healthStatus, inst.LastErrorMsg, inst.LastHealthAt, inst.LastActiveAt, inst.ArchivedAt, displayName, inst.LastComposeOutput, inst.ArchivePinned, inst.Notes, inst.ServerTapKey, inst.HostPort, inst.CPULimit, inst.MemLimitMB, inst.Gamemode, inst.Difficulty, inst.MaxPlayers, inst.MOTD, inst.StorageType, inst.LevelSeed).Scan(&id)
 	if err != nil {
 		return 0, err
 	}
@@ -425,11 +523,12 @@ func (r *MapInstanceRepoI) Create(ctx context.Context, inst MapInstance) (int64,
 func (r *MapInstanceRepoI) Read(ctx context.Context, id int64) (MapInstance, error) {
 	var inst MapInstance
 	err := r.connector.QueryRowContext(ctx, `
-		SELECT id, alias, owner_id, template_id, source_type, game_version, access_mode, status, health_status, last_error_msg, last_health_at, created_at, updated_at, last_active_at, archived_at
+		SELECT id, alias, display_name, owner_id, template_id, source_type, game_version, access_mode, status, health_status, last_error_msg, last_health_at, created_at, updated_at, last_active_at, archived_at, last_compose_output, archive_pinned, notes, servertap_key, host_port, cpu_limit, mem_limit_mb, gamemode, difficulty, max_players, motd, storage_type, level_seed, recover_attempts, recover_window_at, started_on_at, prune_notice_at
 		FROM map_instances WHERE id = $1
 	`, id).Scan(
 		&inst.ID,
 		&inst.Alias,
+		&inst.DisplayName,
 		&inst.OwnerID,
 		&inst.TemplateID,
 		&inst.SourceType,
@@ -443,6 +542,23 @@ func (r *MapInstanceRepoI) Read(ctx context.Context, id int64) (MapInstance, err
 		&inst.UpdatedAt,
 		&inst.LastActiveAt,
 		&inst.ArchivedAt,
+		&inst.LastComposeOutput,
+		&inst.ArchivePinned,
+		&inst.Notes,
+		&inst.ServerTapKey,
+		&inst.HostPort,
+		&inst.CPULimit,
+		&inst.MemLimitMB,
+		&inst.Gamemode,
+		&inst.Difficulty,
+		&inst.MaxPlayers,
+		&inst.MOTD,
+		&inst.StorageType,
+		&inst.LevelSeed,
+		&inst.RecoverAttempts,
+		&inst.RecoverWindowAt,
+		&inst.StartedOnAt,
+		&inst.PruneNoticeAt,
 	)
 	if err != nil {
 		return MapInstance{}, err
@@ -453,11 +569,12 @@ func (r *MapInstanceRepoI) Read(ctx context.Context, id int64) (MapInstance, err
 func (r *MapInstanceRepoI) ReadByAlias(ctx context.Context, alias string) (MapInstance, error) {
 	var inst MapInstance
 	err := r.connector.QueryRowContext(ctx, `
-		SELECT id, alias, owner_id, template_id, source_type, game_version, access_mode, status, health_status, last_error_msg, last_health_at, created_at, updated_at, last_active_at, archived_at
+		SELECT id, alias, display_name, owner_id, template_id, source_type, game_version, access_mode, status, health_status, last_error_msg, last_health_at, created_at, updated_at, last_active_at, archived_at, last_compose_output, archive_pinned, notes, servertap_key, host_port, cpu_limit, mem_limit_mb, gamemode, difficulty, max_players, motd, storage_type, level_seed, recover_attempts, recover_window_at, started_on_at, prune_notice_at
 		FROM map_instances WHERE alias = $1
 	`, alias).Scan(
 		&inst.ID,
 		&inst.Alias,
+		&inst.DisplayName,
 		&inst.OwnerID,
 		&inst.TemplateID,
 		&inst.SourceType,
@@ -471,6 +588,23 @@ func (r *MapInstanceRepoI) ReadByAlias(ctx context.Context, alias string) (MapIn
 		&inst.UpdatedAt,
 		&inst.LastActiveAt,
 		&inst.ArchivedAt,
+		&inst.LastComposeOutput,
+		&inst.ArchivePinned,
+		&inst.Notes,
+		&inst.ServerTapKey,
+		&inst.HostPort,
+		&inst.CPULimit,
+		&inst.MemLimitMB,
+		&inst.Gamemode,
+		&inst.Difficulty,
+		&inst.MaxPlayers,
+		&inst.MOTD,
+		&inst.StorageType,
+		&inst.LevelSeed,
+		&inst.RecoverAttempts,
+		&inst.RecoverWindowAt,
+		&inst.StartedOnAt,
+		&inst.PruneNoticeAt,
 	)
 	if err != nil {
 		return MapInstance{}, err
@@ -480,7 +614,7 @@ func (r *MapInstanceRepoI) ReadByAlias(ctx context.Context, alias string) (MapIn
 
 func (r *MapInstanceRepoI) ListByOwner(ctx context.Context, ownerID int64) ([]MapInstance, error) {
 	rows, err := r.connector.QueryContext(ctx, `
-		SELECT id, alias, owner_id, template_id, source_type, game_version, access_mode, status, health_status, last_error_msg, last_health_at, created_at, updated_at, last_active_at, archived_at
+		SELECT id, alias, display_name, owner_id, template_id, source_type, game_version, access_mode, status, health_status, last_error_msg, last_health_at, created_at, updated_at, last_active_at, archived_at, last_compose_output, archive_pinned, notes, servertap_key, host_port, cpu_limit, mem_limit_mb, gamemode, difficulty, max_players, motd, storage_type, level_seed, recover_attempts, recover_window_at, started_on_at, prune_notice_at
 		FROM map_instances
 		WHERE owner_id = $1
 		ORDER BY id DESC
@@ -493,9 +627,10 @@ func (r *MapInstanceRepoI) ListByOwner(ctx context.Context, ownerID int64) ([]Ma
 	for rows.Next() {
 		var inst MapInstance
 		if err := rows.Scan(
-			&inst.ID, &inst.Alias, &inst.OwnerID, &inst.TemplateID, &inst.SourceType,
+			&inst.ID, &inst.Alias, &inst.DisplayName, &inst.OwnerID, &inst.TemplateID, &inst.SourceType,
 			&inst.GameVersion, &inst.AccessMode, &inst.Status, &inst.HealthStatus, &inst.LastErrorMsg, &inst.LastHealthAt, &inst.CreatedAt, &inst.UpdatedAt,
-			&inst.LastActiveAt, &inst.ArchivedAt,
+			&inst.LastActiveAt, &inst.ArchivedAt, &inst.LastComposeOutput, &inst.ArchivePinned, &inst.Notes, &inst.ServerTapKey, &inst.HostPort, &inst.CPULimit, &inst.MemLimitMB,
+			&inst.Gamemode, &inst.Difficulty, &inst.MaxPlayers, &inst.MOTD, &inst.StorageType, &inst.LevelSeed, &inst.RecoverAttempts, &inst.RecoverWindowAt, &inst.StartedOnAt, &inst.PruneNoticeAt,
 		); err != nil {
 			return nil, err
 		}
@@ -509,7 +644,7 @@ func (r *MapInstanceRepoI) ListByOwner(ctx context.Context, ownerID int64) ([]Ma
 
 func (r *MapInstanceRepoI) List(ctx context.Context) ([]MapInstance, error) {
 	rows, err := r.connector.QueryContext(ctx, `
-		SELECT id, alias, owner_id, template_id, source_type, game_version, access_mode, status, health_status, last_error_msg, last_health_at, created_at, updated_at, last_active_at, archived_at
+		SELECT id, alias, display_name, owner_id, template_id, source_type, game_version, access_mode, status, health_status, last_error_msg, last_health_at, created_at, updated_at, last_active_at, archived_at, last_compose_output, archive_pinned, notes, servertap_key, host_port, cpu_limit, mem_limit_mb, gamemode, difficulty, max_players, motd, storage_type, level_seed, recover_attempts, recover_window_at, started_on_at, prune_notice_at
 		FROM map_instances
 		ORDER BY id DESC
 	`)
@@ -521,9 +656,161 @@ func (r *MapInstanceRepoI) List(ctx context.Context) ([]MapInstance, error) {
 	for rows.Next() {
 		var inst MapInstance
 		if err := rows.Scan(
-			&inst.ID, &inst.Alias, &inst.OwnerID, &inst.TemplateID, &inst.SourceType,
+			&inst.ID, &inst.Alias, &inst.DisplayName, &inst.OwnerID, &inst.TemplateID, &inst.SourceType,
+			&inst.GameVersion, &inst.AccessMode, &inst.Status, &inst.HealthStatus, &inst.LastErrorMsg, &inst.LastHealthAt, &inst.CreatedAt, &inst.UpdatedAt,
+			&inst.LastActiveAt, &inst.ArchivedAt, &inst.LastComposeOutput, &inst.ArchivePinned, &inst.Notes, &inst.ServerTapKey, &inst.HostPort, &inst.CPULimit, &inst.MemLimitMB,
+			&inst.Gamemode, &inst.Difficulty, &inst.MaxPlayers, &inst.MOTD, &inst.StorageType, &inst.LevelSeed, &inst.RecoverAttempts, &inst.RecoverWindowAt, &inst.StartedOnAt, &inst.PruneNoticeAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, inst)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CountByStatus returns the number of instances in each status.
+func (r *MapInstanceRepoI) CountByStatus(ctx context.Context) (map[string]int64, error) {
+	rows, err := r.connector.QueryContext(ctx, `
+		SELECT status, COUNT(*)
+		FROM map_instances
+		GROUP BY status
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]int64)
+	for rows.Next() {
+		var status string
+		var n int64
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		out[status] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListOrphanedOwners returns instances whose owner_id no longer matches a
+// user row. The foreign key normally prevents this; it catches databases
+// restored or migrated without the constraint.
+func (r *MapInstanceRepoI) ListOrphanedOwners(ctx context.Context) ([]MapInstance, error) {
+	rows, err := r.connector.QueryContext(ctx, `
+		SELECT i.id, i.alias, i.display_name, i.owner_id, i.template_id, i.source_type, i.game_version, i.access_mode, i.status, i.health_status, i.last_error_msg, i.last_health_at, i.created_at, i.updated_at, i.last_active_at, i.archived_at, i.last_compose_output, i.archive_pinned, i.notes, i.servertap_key, i.host_port, i.cpu_limit, i.mem_limit_mb, i.gamemode, i.difficulty, i.max_players, i.motd, i.storage_type, i.level_seed, i.recover_attempts, i.recover_window_at, i.started_on_at, i.prune_notice_at
+		FROM map_instances i
+		WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = i.owner_id)
+		ORDER BY i.id ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]MapInstance, 0)
+	for rows.Next() {
+		var inst MapInstance
+		if err := rows.Scan(
+			&inst.ID, &inst.Alias, &inst.DisplayName, &inst.OwnerID, &inst.TemplateID, &inst.SourceType,
+			&inst.GameVersion, &inst.AccessMode, &inst.Status, &inst.HealthStatus, &inst.LastErrorMsg, &inst.LastHealthAt, &inst.CreatedAt, &inst.UpdatedAt,
+			&inst.LastActiveAt, &inst.ArchivedAt, &inst.LastComposeOutput, &inst.ArchivePinned, &inst.Notes, &inst.ServerTapKey, &inst.HostPort, &inst.CPULimit, &inst.MemLimitMB,
+			&inst.Gamemode, &inst.Difficulty, &inst.MaxPlayers, &inst.MOTD, &inst.StorageType, &inst.LevelSeed, &inst.RecoverAttempts, &inst.RecoverWindowAt, &inst.StartedOnAt, &inst.PruneNoticeAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, inst)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListStaleOn returns On instances whose last health check is older than
+// olderThan (or never happened), least recently checked first, so a
+// container that died without the manager noticing is probed early.
+func (r *MapInstanceRepoI) ListStaleOn(ctx context.Context, olderThan time.Time) ([]MapInstance, error) {
+	rows, err := r.connector.QueryContext(ctx, `
+		SELECT id, alias, display_name, owner_id, template_id, source_type, game_version, access_mode, status, health_status, last_error_msg, last_health_at, created_at, updated_at, last_active_at, archived_at, last_compose_output, archive_pinned, notes, servertap_key, host_port, cpu_limit, mem_limit_mb, gamemode, difficulty, max_players, motd, storage_type, level_seed, recover_attempts, recover_window_at, started_on_at, prune_notice_at
+		FROM map_instances
+		WHERE status = 'On' AND (last_health_at IS NULL OR last_health_at < $1)
+		ORDER BY last_health_at ASC NULLS FIRST, id ASC
+	`, olderThan)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]MapInstance, 0)
+	for rows.Next() {
+		var inst MapInstance
+		if err := rows.Scan(
+			&inst.ID, &inst.Alias, &inst.DisplayName, &inst.OwnerID, &inst.TemplateID, &inst.SourceType,
+			&inst.GameVersion, &inst.AccessMode, &inst.Status, &inst.HealthStatus, &inst.LastErrorMsg, &inst.LastHealthAt, &inst.CreatedAt, &inst.UpdatedAt,
+			&inst.LastActiveAt, &inst.ArchivedAt, &inst.LastComposeOutput, &inst.ArchivePinned, &inst.Notes, &inst.ServerTapKey, &inst.HostPort, &inst.CPULimit, &inst.MemLimitMB,
+			&inst.Gamemode, &inst.Difficulty, &inst.MaxPlayers, &inst.MOTD, &inst.StorageType, &inst.LevelSeed, &inst.RecoverAttempts, &inst.RecoverWindowAt, &inst.StartedOnAt, &inst.PruneNoticeAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, inst)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListAliasesWithPrefix returns every alias (archived included) that starts
+// with prefix, sorted.
+func (r *MapInstanceRepoI) ListAliasesWithPrefix(ctx context.Context, prefix string) ([]string, error) {
+	rows, err := r.connector.QueryContext(ctx, `
+		SELECT alias
+		FROM map_instances
+		WHERE alias LIKE $1 || '%' ESCAPE '\'
+		ORDER BY alias ASC
+	`, escapeLike(prefix))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]string, 0)
+	for rows.Next() {
+		var alias string
+		if err := rows.Scan(&alias); err != nil {
+			return nil, err
+		}
+		out = append(out, alias)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListArchived returns archived instances oldest first (by archived_at, rows
+// without a timestamp first), which is the order archive pruning uses.
+func (r *MapInstanceRepoI) ListArchived(ctx context.Context) ([]MapInstance, error) {
+	rows, err := r.connector.QueryContext(ctx, `
+		SELECT id, alias, display_name, owner_id, template_id, source_type, game_version, access_mode, status, health_status, last_error_msg, last_health_at, created_at, updated_at, last_active_at, archived_at, last_compose_output, archive_pinned, notes, servertap_key, host_port, cpu_limit, mem_limit_mb, gamemode, difficulty, max_players, motd, storage_type, level_seed, recover_attempts, recover_window_at, started_on_at, prune_notice_at
+		FROM map_instances
+		WHERE status = 'Archived'
+		ORDER BY archived_at ASC NULLS FIRST, id ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]MapInstance, 0)
+	for rows.Next() {
+		var inst MapInstance
+		if err := rows.Scan(
+			&inst.ID, &inst.Alias, &inst.DisplayName, &inst.OwnerID, &inst.TemplateID, &inst.SourceType,
 			&inst.GameVersion, &inst.AccessMode, &inst.Status, &inst.HealthStatus, &inst.LastErrorMsg, &inst.LastHealthAt, &inst.CreatedAt, &inst.UpdatedAt,
-			&inst.LastActiveAt, &inst.ArchivedAt,
+			&inst.LastActiveAt, &inst.ArchivedAt, &inst.LastComposeOutput, &inst.ArchivePinned, &inst.Notes, &inst.ServerTapKey, &inst.HostPort, &inst.CPULimit, &inst.MemLimitMB,
+			&inst.Gamemode, &inst.Difficulty, &inst.MaxPlayers, &inst.MOTD, &inst.StorageType, &inst.LevelSeed, &inst.RecoverAttempts, &inst.RecoverWindowAt, &inst.StartedOnAt, &inst.PruneNoticeAt,
 		); err != nil {
 			return nil, err
 		}
@@ -535,11 +822,54 @@ func (r *MapInstanceRepoI) List(ctx context.Context) ([]MapInstance, error) {
 	return out, nil
 }
 
+// ListForUser returns the instances userID owns or is a member of, by id,
+// with the user's member role and the number of non-owner members. Role is
+// empty for an owned instance without a member row. Archived instances are
+// left out unless includeArchived is set.
+func (r *MapInstanceRepoI) ListForUser(ctx context.Context, userID int64, includeArchived bool) ([]UserInstance, error) {
+	rows, err := r.connector.QueryContext(ctx, `
+		SELECT i.id, i.alias, i.display_name, i.owner_id, i.template_id, i.source_type, i.game_version, i.access_mode, i.status, i.health_status, i.last_error_msg, i.last_health_at, i.created_at, i.updated_at, i.last_active_at, i.archived_at, i.last_compose_output, i.archive_pinned, i.notes, i.servertap_key, i.host_port, i.cpu_limit, i.mem_limit_mb, i.gamemode, i.difficulty, i.max_players, i.motd, i.storage_type, i.level_seed, i.recover_attempts, i.recover_window_at, i.started_on_at, i.prune_notice_at,
+		       COALESCE(me.role, ''),
+		       (SELECT COUNT(*) FROM instance_members c WHERE c.instance_id = i.id AND c.role <> 'owner')
+		FROM map_instances i
+		LEFT JOIN instance_members me ON me.instance_id = i.id AND me.user_id = $1
+		WHERE (i.owner_id = $1 OR me.id IS NOT NULL) AND ($2 OR i.status <> 'Archived')
+		ORDER BY i.id ASC
+	`, userID, includeArchived)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]UserInstance, 0)
+	for rows.Next() {
+		var ui UserInstance
+		inst := &ui.MapInstance
+		if err := rows.Scan(
+			&inst.ID, &inst.Alias, &inst.DisplayName, &inst.OwnerID, &inst.TemplateID, &inst.SourceType,
+			&inst.GameVersion, &inst.AccessMode, &inst.Status, &inst.HealthStatus, &inst.LastErrorMsg, &inst.LastHealthAt, &inst.CreatedAt, &inst.UpdatedAt,
+			&inst.LastActiveAt, &inst.ArchivedAt, &inst.LastComposeOutput, &inst.ArchivePinned, &inst.Notes, &inst.ServerTapKey, &inst.HostPort, &inst.CPULimit, &inst.MemLimitMB,
+			&inst.Gamemode, &inst.Difficulty, &inst.MaxPlayers, &inst.MOTD, &inst.StorageType, &inst.LevelSeed, &inst.RecoverAttempts, &inst.RecoverWindowAt, &inst.StartedOnAt, &inst.PruneNoticeAt,
+			&ui.Role, &ui.MemberCount,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, ui)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (r *MapInstanceRepoI) Update(ctx context.Context, inst MapInstance) error {
 	accessMode := inst.AccessMode
 	if accessMode == "" {
 		accessMode = "privacy"
 	}
+	displayName := inst.DisplayName
+	if displayName == "" {
+		displayName = inst.Alias
+	}
 	_, err := r.connector.ExecContext(ctx, `
 		UPDATE map_instances
 		SET alias = $2,
@@ -554,9 +884,27 @@ func (r *MapInstanceRepoI) Update(ctx context.Context, inst MapInstance) error {
 		    last_health_at = $11,
 		    updated_at = NOW(),
 		    last_active_at = $12,
-		    archived_at = $13
+		    archived_at = $13,
+		    display_name = $14,
+		    last_compose_output = $15,
+		    archive_pinned = $16,
+		    notes = $17,
+		    servertap_key = $18,
+		    host_port = $19,
+		    cpu_limit = $20,
+		    mem_limit_mb = $21,
+		    gamemode = $22,
+		    difficulty = $23,
+		    max_players = $24,
+		    motd = $25,
+		    storage_type = $26,
+		    level_seed = $27,
+		    recover_attempts = $28,
+		    recover_window_at = $29,
+		    started_on_at = $30,
+		    prune_notice_at = $31
 		WHERE id = $1
-	`, inst.ID, inst.Alias, inst.OwnerID, inst.TemplateID, inst.SourceType, inst.GameVersion, accessMode, inst.Status, inst.HealthStatus, inst.LastErrorMsg, inst.LastHealthAt, inst.LastActiveAt, inst.ArchivedAt)
+	`, inst.ID, inst.Alias, inst.OwnerID, inst.TemplateID, inst.SourceType, inst.GameVersion, accessMode, inst.Status, inst.HealthStatus, inst.LastErrorMsg, inst.LastHealthAt, inst.LastActiveAt, inst.ArchivedAt, displayName, inst.LastComposeOutput, inst.ArchivePinned, inst.Notes, inst.ServerTapKey, inst.HostPort, inst.CPULimit, inst.MemLimitMB, inst.Gamemode, inst.Difficulty, inst.MaxPlayers, inst.MOTD, inst.StorageType, inst.LevelSeed, inst.RecoverAttempts, inst.RecoverWindowAt, inst.StartedOnAt, inst.PruneNoticeAt)
 	return err
 }
 
@@ -622,6 +970,36 @@ func (r *InstanceMemberRepoI) ListByInstance(ctx context.Context, instanceID int
 	return out, nil
 }
 
+// ListWithUsers returns the instance's members joined to their users in one
+// query; members whose user row is gone are left out.
+func (r *InstanceMemberRepoI) ListWithUsers(ctx context.Context, instanceID int64) ([]MemberWithUser, error) {
+	rows, err := r.connector.QueryContext(ctx, `
+		SELECT m.id, m.instance_id, m.user_id, m.role, m.created_at,
+		       u.mc_uuid, u.mc_name, u.server_role
+		FROM instance_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.instance_id = $1
+		ORDER BY m.id ASC
+	`, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]MemberWithUser, 0)
+	for rows.Next() {
+		var m MemberWithUser
+		if err := rows.Scan(&m.ID, &m.InstanceID, &m.UserID, &m.Role, &m.CreatedAt, &m.MCUUID, &m.MCName, &m.ServerRole); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (r *InstanceMemberRepoI) ListByUser(ctx context.Context, userID int64) ([]InstanceMember, error) {
 	rows, err := r.connector.QueryContext(ctx, `
 		SELECT id, instance_id, user_id, role, created_at
@@ -670,6 +1048,62 @@ func (r *InstanceMemberRepoI) DeleteByInstanceAndUser(ctx context.Context, insta
 	return err
 }
 
+type PendingWhitelistRepoI struct{ connector SQLConnector }
+
+func NewPendingWhitelistRepoI(connector SQLConnector) *PendingWhitelistRepoI {
+	return &PendingWhitelistRepoI{connector: connector}
+}
+
+// Enqueue records op, replacing any queued op for the same player so only
+// the latest add/remove is replayed. A replaced op takes a fresh id, so a
+// DeleteThrough for a replay already in progress leaves it queued.
+func (r *PendingWhitelistRepoI) Enqueue(ctx context.Context, op PendingWhitelistOp) error {
+	_, err := r.connector.ExecContext(ctx, `
+		INSERT INTO pending_whitelist_ops (instance_id, player_name, action, created_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (instance_id, LOWER(player_name))
+		DO UPDATE SET id = nextval(pg_get_serial_sequence('pending_whitelist_ops', 'id')),
+		              player_name = EXCLUDED.player_name, action = EXCLUDED.action, created_at = NOW()
+	`, op.InstanceID, op.PlayerName, op.Action)
+	return err
+}
+
+func (r *PendingWhitelistRepoI) ListByInstance(ctx context.Context, instanceID int64) ([]PendingWhitelistOp, error) {
+	rows, err := r.connector.QueryContext(ctx, `
+		SELECT id, instance_id, player_name, action, created_at
+		FROM pending_whitelist_ops
+		WHERE instance_id = $1
+		ORDER BY id ASC
+	`, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]PendingWhitelistOp, 0)
+	for rows.Next() {
+		var op PendingWhitelistOp
+		if err := rows.Scan(&op.ID, &op.InstanceID, &op.PlayerName, &op.Action, &op.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, op)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeleteThrough drops the instance's ops up to and including maxID, leaving
+// any queued while they were being replayed.
+func (r *PendingWhitelistRepoI) DeleteThrough(ctx context.Context, instanceID int64, maxID int64) error {
+	_, err := r.connector.ExecContext(ctx, `
+		DELETE FROM pending_whitelist_ops
+		WHERE instance_id = $1 AND id <= $2
+	`, instanceID, maxID)
+	return err
+}
+
 type UserRequestRepoI struct{ connector SQLConnector }
 
 func NewUserRequestRepoI(connector SQLConnector) *UserRequestRepoI {
@@ -828,6 +1262,86 @@ func (r *UserRequestRepoI) ListPending(ctx context.Context, limit int) ([]UserRe
 	return out, nil
 }
 
+// ListFiltered returns one page of requests, newest first, matching filter.
+func (r *UserRequestRepoI) ListFiltered(ctx context.Context, filter UserRequestFilter, page Page) ([]UserRequest, error) {
+	if page.Size <= 0 {
+		page.Size = 50
+	}
+	rows, err := r.connector.QueryContext(ctx, `
+		SELECT id, request_id, request_type, actor_user_id, target_instance_id, template_id,
+		       requested_alias, status, reviewed_by_user_id, review_note, response_payload,
+		       error_code, error_msg, expires_at, created_at, updated_at
+		FROM user_requests
+		WHERE ($1::text = '' OR status = $1)
+		  AND ($2::bigint = 0 OR actor_user_id = $2)
+		  AND ($5::bigint = 0 OR target_instance_id = $5)
+		ORDER BY id DESC
+		LIMIT $3 OFFSET $4
+	`, filter.Status, filter.ActorUserID, page.Size, page.Offset(), filter.TargetInstanceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]UserRequest, 0)
+	for rows.Next() {
+		var req UserRequest
+		if err := rows.Scan(
+			&req.ID, &req.RequestID, &req.RequestType, &req.ActorUserID, &req.TargetInstanceID, &req.TemplateID,
+			&req.RequestedAlias, &req.Status, &req.ReviewedByUserID, &req.ReviewNote, &req.ResponsePayload,
+			&req.ErrorCode, &req.ErrorMsg, &req.ExpiresAt, &req.CreatedAt, &req.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, req)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ExpireOverdue marks pending requests whose expires_at is at or before now
+// as expired and returns them. The status check and the write are one
+// statement, so a request approved meanwhile is left alone. Requests without
+// an expiry never expire.
+func (r *UserRequestRepoI) ExpireOverdue(ctx context.Context, now time.Time) ([]UserRequest, error) {
+	rows, err := r.connector.QueryContext(ctx, `
+		UPDATE user_requests
+		SET status = 'expired',
+		    error_code = 'expired',
+		    error_msg = 'request expired before review',
+		    updated_at = NOW()
+		WHERE status = 'pending'
+		  AND expires_at IS NOT NULL
+		  AND expires_at <= $1
+		RETURNING id, request_id, request_type, actor_user_id, target_instance_id, template_id,
+		          requested_alias, status, reviewed_by_user_id, review_note, response_payload,
+		          error_code, error_msg, expires_at, created_at, updated_at
+	`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]UserRequest, 0)
+	for rows.Next() {
+		var req UserRequest
+		if err := rows.Scan(
+			&req.ID, &req.RequestID, &req.RequestType, &req.ActorUserID, &req.TargetInstanceID, &req.TemplateID,
+			&req.RequestedAlias, &req.Status, &req.ReviewedByUserID, &req.ReviewNote, &req.ResponsePayload,
+			&req.ErrorCode, &req.ErrorMsg, &req.ExpiresAt, &req.CreatedAt, &req.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, req)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (r *UserRequestRepoI) Update(ctx context.Context, req UserRequest) error {
 	_, err := r.connector.ExecContext(ctx, `
 		UPDATE user_requests
@@ -913,6 +1427,59 @@ func (r *UserRequestRepoI) MarkRequestResult(
 	return err
 }
 
+// CountByStatus returns how many requests are currently in status.
+func (r *UserRequestRepoI) CountByStatus(ctx context.Context, status string) (int64, error) {
+	var n int64
+	err := r.connector.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM user_requests WHERE status = $1
+	`, status).Scan(&n)
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// CountPendingByActor returns how many of actorUserID's requests still wait
+// for review.
+func (r *UserRequestRepoI) CountPendingByActor(ctx context.Context, actorUserID int64) (int64, error) {
+	var n int64
+	err := r.connector.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM user_requests WHERE actor_user_id = $1 AND status = 'pending'
+	`, actorUserID).Scan(&n)
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// ArchiveTerminalBefore moves finished requests last updated before cutoff into
+// user_requests_archive, keeping the live table small while preserving audit history.
+func (r *UserRequestRepoI) ArchiveTerminalBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := r.connector.ExecContext(ctx, `
+		WITH moved AS (
+			DELETE FROM user_requests
+			WHERE status IN ('succeeded', 'failed', 'rejected', 'canceled', 'expired')
+			  AND updated_at < $1
+			RETURNING id, request_id, request_type, actor_user_id, target_instance_id, template_id,
+			          requested_alias, status, reviewed_by_user_id, review_note, response_payload,
+			          error_code, error_msg, expires_at, created_at, updated_at
+		)
+		INSERT INTO user_requests_archive (
+			id, request_id, request_type, actor_user_id, target_instance_id, template_id,
+			requested_alias, status, reviewed_by_user_id, review_note, response_payload,
+			error_code, error_msg, expires_at, created_at, updated_at, archived_at
+		)
+		SELECT id, request_id, request_type, actor_user_id, target_instance_id, template_id,
+		       requested_alias, status, reviewed_by_user_id, review_note, response_payload,
+		       error_code, error_msg, expires_at, created_at, updated_at, NOW()
+		FROM moved
+	`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 var _ UserRepo = (*UserRepoI)(nil)
 var _ MapTemplateRepo = (*MapTemplateRepoI)(nil)
 var _ ServerImageRepo = (*ServerImageRepoI)(nil)
@@ -920,3 +1487,10 @@ var _ GameVersionRepo = (*GameVersionRepoI)(nil)
 var _ MapInstanceRepo = (*MapInstanceRepoI)(nil)
 var _ InstanceMemberRepo = (*InstanceMemberRepoI)(nil)
 var _ UserRequestRepo = (*UserRequestRepoI)(nil)
+var _ PendingWhitelistRepo = (*PendingWhitelistRepoI)(nil)
+
+// escapeLike makes %, _ and the escape character itself match literally in
+// a LIKE/ILIKE pattern using ESCAPE '\'.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,375 @@
+package pgsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// queryCaptureConnector records the last query and its arguments.
+type queryCaptureConnector struct {
+	SQLConnector
+	query string
+	args  []any
+}
+
+func (c *queryCaptureConnector) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	c.query = query
+	c.args = args
+	return nil, errors.New("captured")
+}
+
+// QueryRowContext records like QueryContext; the returned row fails to scan.
+func (c *queryCaptureConnector) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	c.query = query
+	c.args = args
+	db, _ := sql.Open("mcmm-refusing", "")
+	return db.QueryRowContext(ctx, query)
+}
+
+// ExecContext records like QueryContext.
+func (c *queryCaptureConnector) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	c.query = query
+	c.args = args
+	return nil, errors.New("captured")
+}
+
+// refusingDriver fails every connection, so a captured row reports an error.
+type refusingDriver struct{}
+
+func (refusingDriver) Open(name string) (driver.Conn, error) { return nil, errors.New("captured") }
+
+// staticDriver answers every query on a DSN with the rows registered for it.
+type staticDriver struct{}
+
+type staticResult struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+var (
+	staticResultsMu sync.Mutex
+	staticResults   = map[string]staticResult{}
+)
+
+func (staticDriver) Open(name string) (driver.Conn, error) {
+	staticResultsMu.Lock()
+	defer staticResultsMu.Unlock()
+	res, ok := staticResults[name]
+	if !ok {
+		return nil, errors.New("no static result for " + name)
+	}
+	return staticConn{res: res}, nil
+}
+
+type staticConn struct{ res staticResult }
+
+func (c staticConn) Prepare(query string) (driver.Stmt, error) { return staticStmt(c), nil }
+func (staticConn) Close() error                                { return nil }
+func (staticConn) Begin() (driver.Tx, error)                   { return nil, errors.New("not supported") }
+
+// CheckNamedValue accepts any argument (e.g. []int64), as pgx does.
+func (staticConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+type staticStmt staticConn
+
+func (staticStmt) Close() error  { return nil }
+func (staticStmt) NumInput() int { return -1 }
+func (staticStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (s staticStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &staticRows{res: s.res}, nil
+}
+
+type staticRows struct {
+	res  staticResult
+	next int
+}
+
+func (r *staticRows) Columns() []string { return r.res.columns }
+func (r *staticRows) Close() error      { return nil }
+func (r *staticRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.res.rows) {
+		return io.EOF
+	}
+	copy(dest, r.res.rows[r.next])
+	r.next++
+	return nil
+}
+
+// staticRowsConnector runs queries against a staticDriver DSN and counts them.
+type staticRowsConnector struct {
+	SQLConnector
+	db      *sql.DB
+	queries []string
+}
+
+func newStaticRowsConnector(t *testing.T, res staticResult) *staticRowsConnector {
+	t.Helper()
+	staticResultsMu.Lock()
+	staticResults[t.Name()] = res
+	staticResultsMu.Unlock()
+	db, err := sql.Open("mcmm-static", t.Name())
+	if err != nil {
+		t.Fatalf("open static db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return &staticRowsConnector{db: db}
+}
+
+func (c *staticRowsConnector) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	c.queries = append(c.queries, query)
+	return c.db.QueryContext(ctx, query, args...)
+}
+
+func init() {
+	sql.Register("mcmm-refusing", refusingDriver{})
+	sql.Register("mcmm-static", staticDriver{})
+}
+
+func TestMapTemplateSearchByTag_BindsEscapedPattern(t *testing.T) {
+	c := &queryCaptureConnector{}
+	repo := NewMapTemplateRepoI(c)
+
+	if _, err := repo.SearchByTag(context.Background(), "sky_50%'; DROP TABLE map_templates; --", "1.21.1"); err == nil {
+		t.Fatalf("expected connector error to propagate")
+	}
+	q := strings.Join(strings.Fields(c.query), " ")
+	for _, want := range []string{
+		"WHERE (tag ILIKE '%' || $1 || '%' ESCAPE '\\'",
+		"OR display_name ILIKE '%' || $1 || '%' ESCAPE '\\')",
+		"AND ($2 = '' OR game_version = $2)",
+		"ORDER BY created_at DESC, id DESC",
+		"LIMIT $3",
+	} {
+		if !strings.Contains(q, want) {
+			t.Fatalf("query missing %q:\n%s", want, q)
+		}
+	}
+	if strings.Contains(q, "DROP") {
+		t.Fatalf("search text must not be inlined into SQL:\n%s", q)
+	}
+	if len(c.args) != 3 {
+		t.Fatalf("expected 3 bound args, got %v", c.args)
+	}
+	if got := c.args[0]; got != `sky\_50\%'; DROP TABLE map\_templates; --` {
+		t.Fatalf("unexpected pattern arg: %v", got)
+	}
+	if got := c.args[1]; got != "1.21.1" {
+		t.Fatalf("the version filter must be bound, got %v", got)
+	}
+	if got := c.args[2]; got != maxTemplateSearchResults {
+		t.Fatalf("unexpected limit arg: %v", got)
+	}
+}
+
+func TestMapInstanceListStaleOn_FiltersOnAndOldestFirst(t *testing.T) {
+	c := &queryCaptureConnector{}
+	repo := NewMapInstanceRepoI(c)
+	cutoff := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	if _, err := repo.ListStaleOn(context.Background(), cutoff); err == nil {
+		t.Fatalf("expected connector error to propagate")
+	}
+	q := strings.Join(strings.Fields(c.query), " ")
+	for _, want := range []string{
+		"WHERE status = 'On' AND (last_health_at IS NULL OR last_health_at < $1)",
+		"ORDER BY last_health_at ASC NULLS FIRST, id ASC",
+	} {
+		if !strings.Contains(q, want) {
+			t.Fatalf("query missing %q:\n%s", want, q)
+		}
+	}
+	if len(c.args) != 1 || c.args[0] != cutoff {
+		t.Fatalf("expected cutoff as the only bound arg, got %v", c.args)
+	}
+}
+
+func TestMapInstanceCountByStatus_GroupsInTheDatabase(t *testing.T) {
+	c := &queryCaptureConnector{}
+	repo := NewMapInstanceRepoI(c)
+
+	if _, err := repo.CountByStatus(context.Background()); err == nil {
+		t.Fatalf("expected connector error to propagate")
+	}
+	q := strings.Join(strings.Fields(c.query), " ")
+	if want := "SELECT status, COUNT(*) FROM map_instances GROUP BY status"; q != want {
+		t.Fatalf("unexpected query:\n%s\nwant:\n%s", q, want)
+	}
+}
+
+func TestUserUpsert_SingleStatementOnConflictRename(t *testing.T) {
+	c := &queryCaptureConnector{}
+	repo := NewUserRepoI(c)
+
+	if _, _, err := repo.Upsert(context.Background(), "uuid-alice", "alice2"); err == nil {
+		t.Fatalf("expected connector error to propagate")
+	}
+	q := strings.Join(strings.Fields(c.query), " ")
+	for _, want := range []string{
+		"INSERT INTO users (mc_uuid, mc_name, server_role, created_at) VALUES ($1, $2, 'user', NOW())",
+		"ON CONFLICT (mc_uuid) DO UPDATE SET mc_name = EXCLUDED.mc_name",
+		"RETURNING id, mc_uuid, mc_name, server_role, created_at, (xmax = 0)",
+	} {
+		if !strings.Contains(q, want) {
+			t.Fatalf("query missing %q:\n%s", want, q)
+		}
+	}
+	if strings.Contains(q, "server_role = ") {
+		t.Fatalf("upsert must not overwrite server_role:\n%s", q)
+	}
+	if len(c.args) != 2 || c.args[0] != "uuid-alice" || c.args[1] != "alice2" {
+		t.Fatalf("unexpected bound args: %v", c.args)
+	}
+}
+
+func TestUserList_BindsLimitAndOffset(t *testing.T) {
+	c := &queryCaptureConnector{}
+	repo := NewUserRepoI(c)
+
+	if _, err := repo.List(context.Background(), 200, 400); err == nil {
+		t.Fatalf("expected connector error to propagate")
+	}
+	q := strings.Join(strings.Fields(c.query), " ")
+	if !strings.Contains(q, "ORDER BY id ASC LIMIT $1 OFFSET $2") {
+		t.Fatalf("query should page in id order:\n%s", q)
+	}
+	if len(c.args) != 2 || c.args[0] != 200 || c.args[1] != 400 {
+		t.Fatalf("unexpected bound args: %v", c.args)
+	}
+}
+
+func TestPendingWhitelistEnqueue_ReplacedOpTakesFreshID(t *testing.T) {
+	c := &queryCaptureConnector{}
+	repo := NewPendingWhitelistRepoI(c)
+
+	if err := repo.Enqueue(context.Background(), PendingWhitelistOp{InstanceID: 5, PlayerName: "Bob", Action: "add"}); err == nil {
+		t.Fatalf("expected connector error to propagate")
+	}
+	q := strings.Join(strings.Fields(c.query), " ")
+	want := "DO UPDATE SET id = nextval(pg_get_serial_sequence('pending_whitelist_ops', 'id'))"
+	if !strings.Contains(q, want) {
+		t.Fatalf("a re-queued op must move past an in-flight DeleteThrough, query:\n%s", q)
+	}
+}
+
+func TestUserRequestExpireOverdue_ChecksStatusInTheUpdate(t *testing.T) {
+	c := &queryCaptureConnector{}
+	repo := NewUserRequestRepoI(c)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	if _, err := repo.ExpireOverdue(context.Background(), now); err == nil {
+		t.Fatalf("expected connector error to propagate")
+	}
+	q := strings.Join(strings.Fields(c.query), " ")
+	for _, want := range []string{
+		"UPDATE user_requests SET status = 'expired'",
+		"WHERE status = 'pending' AND expires_at IS NOT NULL AND expires_at <= $1 RETURNING id,",
+	} {
+		if !strings.Contains(q, want) {
+			t.Fatalf("query missing %q:\n%s", want, q)
+		}
+	}
+	if len(c.args) != 1 || c.args[0] != now {
+		t.Fatalf("unexpected bound args: %v", c.args)
+	}
+}
+
+func TestUserRequestListFiltered_BindsFilterAndPage(t *testing.T) {
+	c := &queryCaptureConnector{}
+	repo := NewUserRequestRepoI(c)
+
+	filter := UserRequestFilter{Status: "failed", ActorUserID: 7, TargetInstanceID: 5}
+	if _, err := repo.ListFiltered(context.Background(), filter, Page{Number: 3, Size: 20}); err == nil {
+		t.Fatalf("expected connector error to propagate")
+	}
+	q := strings.Join(strings.Fields(c.query), " ")
+	for _, want := range []string{
+		"WHERE ($1::text = '' OR status = $1) AND ($2::bigint = 0 OR actor_user_id = $2) AND ($5::bigint = 0 OR target_instance_id = $5)",
+		"ORDER BY id DESC LIMIT $3 OFFSET $4",
+	} {
+		if !strings.Contains(q, want) {
+			t.Fatalf("query missing %q:\n%s", want, q)
+		}
+	}
+	if len(c.args) != 5 || c.args[0] != "failed" || c.args[1] != int64(7) || c.args[2] != 20 || c.args[3] != 40 || c.args[4] != int64(5) {
+		t.Fatalf("unexpected bound args: %v", c.args)
+	}
+
+	if _, err := repo.ListFiltered(context.Background(), UserRequestFilter{}, Page{}); err == nil {
+		t.Fatalf("expected connector error to propagate")
+	}
+	if c.args[0] != "" || c.args[1] != int64(0) || c.args[2] != 50 || c.args[3] != 0 || c.args[4] != int64(0) {
+		t.Fatalf("empty filter should match everything on the first page, args=%v", c.args)
+	}
+}
+
+func TestInstanceMemberListWithUsers_SingleJoinedQuery(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	c := newStaticRowsConnector(t, staticResult{
+		columns: []string{"id", "instance_id", "user_id", "role", "created_at", "mc_uuid", "mc_name", "server_role"},
+		rows: [][]driver.Value{
+			{int64(10), int64(5), int64(1), "owner", created, "uuid-alice", "alice", "user"},
+			{int64(11), int64(5), int64(2), "manager", created, "uuid-bob", "bob", "admin"},
+		},
+	})
+	repo := NewInstanceMemberRepoI(c)
+
+	got, err := repo.ListWithUsers(context.Background(), 5)
+	if err != nil {
+		t.Fatalf("list with users: %v", err)
+	}
+	if len(c.queries) != 1 {
+		t.Fatalf("expected exactly one query, got %d", len(c.queries))
+	}
+	q := strings.Join(strings.Fields(c.queries[0]), " ")
+	if !strings.Contains(q, "FROM instance_members m JOIN users u ON u.id = m.user_id WHERE m.instance_id = $1") {
+		t.Fatalf("query should join users:\n%s", q)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 members, got %+v", got)
+	}
+	if got[0].MCName != "alice" || got[0].Role != "owner" || got[0].UserID != 1 || !got[0].CreatedAt.Equal(created) {
+		t.Fatalf("unexpected first member: %+v", got[0])
+	}
+	if got[1].MCName != "bob" || got[1].Role != "manager" || got[1].ServerRole != "admin" || got[1].MCUUID != "uuid-bob" {
+		t.Fatalf("unexpected second member: %+v", got[1])
+	}
+}
+
+func TestUserReadByIDs_BatchesIntoOneQuery(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	c := newStaticRowsConnector(t, staticResult{
+		columns: []string{"id", "mc_uuid", "mc_name", "server_role", "created_at"},
+		rows: [][]driver.Value{
+			{int64(1), "uuid-alice", "alice", "user", created},
+			{int64(3), "uuid-carol", "carol", "admin", created},
+		},
+	})
+	repo := NewUserRepoI(c)
+
+	got, err := repo.ReadByIDs(context.Background(), []int64{1, 2, 3})
+	if err != nil {
+		t.Fatalf("read by ids: %v", err)
+	}
+	if len(c.queries) != 1 || !strings.Contains(c.queries[0], "WHERE id = ANY($1)") {
+		t.Fatalf("expected one ANY($1) query, got %q", c.queries)
+	}
+	if len(got) != 2 || got[1].MCName != "alice" || got[3].MCName != "carol" || got[3].ServerRole != "admin" {
+		t.Fatalf("unexpected users: %+v", got)
+	}
+	if _, ok := got[2]; ok {
+		t.Fatalf("missing id 2 should be absent, got %+v", got[2])
+	}
+
+	if empty, err := repo.ReadByIDs(context.Background(), nil); err != nil || len(empty) != 0 || len(c.queries) != 1 {
+		t.Fatalf("no ids should not query, got=%v err=%v queries=%d", empty, err, len(c.queries))
+	}
+}
@@ -3,13 +3,22 @@ package pgsql
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"sync"
 	"time"
 
 	ilog "mcmm/internal/log"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
+const (
+	reconnectBaseDelay = time.Second
+	reconnectMaxDelay  = time.Minute
+	healthPingTimeout  = 5 * time.Second
+)
+
 type SQLConnector interface {
 	Connect(ctx context.Context) error
 	Close() error
@@ -17,31 +26,50 @@ type SQLConnector interface {
 	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
 	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
 	PingContext(ctx context.Context) error
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
 	SetMaxOpenConns(n int)
 	SetMaxIdleConns(n int)
 	SetConnMaxLifetime(d time.Duration)
 }
 
+// Connector owns the *sql.DB. The handle can be swapped by the health
+// monitor after a reconnect, so every access goes through current().
 type Connector struct {
 	dsn string
+	mu  sync.RWMutex
 	db  *sql.DB
+	// pool settings are remembered so a reconnected handle gets them too.
+	maxOpen     int
+	maxIdle     int
+	maxLifetime time.Duration
+
+	open      func(dsn string) (*sql.DB, error)
+	baseDelay time.Duration
+	maxDelay  time.Duration
 }
 
 func NewConnector(dsn string) *Connector {
-	return &Connector{dsn: dsn}
+	return &Connector{
+		dsn:       dsn,
+		open:      func(dsn string) (*sql.DB, error) { return sql.Open("pgx", dsn) },
+		baseDelay: reconnectBaseDelay,
+		maxDelay:  reconnectMaxDelay,
+	}
 }
 
 func (c *Connector) Connect(ctx context.Context) error {
 	logger := ilog.Component("pgsql")
 	logger.Infof("opening database connection")
-	db, err := sql.Open("pgx", c.dsn)
+	db, err := c.open(c.dsn)
 	if err != nil {
 		logger.Errorf("sql.Open failed: %v", err)
 		return err
 	}
+	c.mu.Lock()
 	c.db = db
+	c.mu.Unlock()
 	logger.Infof("pinging database")
-	if err := c.db.PingContext(ctx); err != nil {
+	if err := db.PingContext(ctx); err != nil {
 		logger.Errorf("ping failed: %v", err)
 		return err
 	}
@@ -51,50 +79,192 @@ func (c *Connector) Connect(ctx context.Context) error {
 
 func (c *Connector) Close() error {
 	logger := ilog.Component("pgsql")
-	if c.db == nil {
+	db := c.current()
+	if db == nil {
 		logger.Warnf("close skipped (db is nil)")
 		return nil
 	}
 	logger.Infof("closing database connection")
-	return c.db.Close()
+	return db.Close()
+}
+
+func (c *Connector) current() *sql.DB {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.db
 }
 
 func (c *Connector) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
-	return c.db.QueryRowContext(ctx, query, args...)
+	return c.current().QueryRowContext(ctx, query, args...)
 }
 
 func (c *Connector) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
-	return c.db.QueryContext(ctx, query, args...)
+	return c.current().QueryContext(ctx, query, args...)
 }
 
 func (c *Connector) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
-	return c.db.ExecContext(ctx, query, args...)
+	return c.current().ExecContext(ctx, query, args...)
 }
 
 func (c *Connector) PingContext(ctx context.Context) error {
 	logger := ilog.Component("pgsql")
-	if c.db == nil {
+	db := c.current()
+	if db == nil {
 		logger.Warnf("ping requested but db is nil")
 		return sql.ErrConnDone
 	}
 	logger.Debugf("pinging database")
-	return c.db.PingContext(ctx)
+	return db.PingContext(ctx)
+}
+
+func (c *Connector) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	db := c.current()
+	if db == nil {
+		return nil, sql.ErrConnDone
+	}
+	return db.BeginTx(ctx, opts)
 }
 
 func (c *Connector) SetMaxOpenConns(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxOpen = n
 	if c.db != nil {
 		c.db.SetMaxOpenConns(n)
 	}
 }
 
 func (c *Connector) SetMaxIdleConns(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxIdle = n
 	if c.db != nil {
 		c.db.SetMaxIdleConns(n)
 	}
 }
 
 func (c *Connector) SetConnMaxLifetime(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxLifetime = d
 	if c.db != nil {
 		c.db.SetConnMaxLifetime(d)
 	}
 }
+
+// StartHealthMonitor pings the database every interval until ctx is done.
+// When a ping fails the handle is reopened with exponential backoff and
+// swapped in, so a Postgres restart does not need a process restart.
+func (c *Connector) StartHealthMonitor(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			pingCtx, cancel := context.WithTimeout(ctx, healthPingTimeout)
+			err := c.PingContext(pingCtx)
+			cancel()
+			if err == nil || ctx.Err() != nil {
+				continue
+			}
+			ilog.Component("pgsql").Warnf("database health check failed: %v; reconnecting", err)
+			c.reconnect(ctx)
+		}
+	}()
+}
+
+// reconnect retries until a fresh handle answers a ping or ctx is done.
+func (c *Connector) reconnect(ctx context.Context) {
+	logger := ilog.Component("pgsql")
+	delay := c.baseDelay
+	for attempt := 1; ; attempt++ {
+		err := c.tryReconnect(ctx)
+		if err == nil {
+			logger.Infof("database reconnected after %d attempt(s)", attempt)
+			return
+		}
+		logger.Warnf("database reconnect attempt %d failed: %v; retrying in %s", attempt, err, delay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > c.maxDelay {
+			delay = c.maxDelay
+		}
+	}
+}
+
+func (c *Connector) tryReconnect(ctx context.Context) error {
+	db, err := c.open(c.dsn)
+	if err != nil {
+		return err
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, healthPingTimeout)
+	defer cancel()
+	if err := db.PingContext(pingCtx); err != nil {
+		_ = db.Close()
+		return err
+	}
+	c.mu.Lock()
+	old := c.db
+	if c.maxOpen > 0 {
+		db.SetMaxOpenConns(c.maxOpen)
+	}
+	if c.maxIdle > 0 {
+		db.SetMaxIdleConns(c.maxIdle)
+	}
+	if c.maxLifetime > 0 {
+		db.SetConnMaxLifetime(c.maxLifetime)
+	}
+	c.db = db
+	c.mu.Unlock()
+	if old != nil {
+		_ = old.Close()
+	}
+	return nil
+}
+
+// txConnector runs every repo query on one transaction. Lifecycle and pool
+// calls are no-ops: the caller owns the tx and commits or rolls it back.
+type txConnector struct {
+	tx *sql.Tx
+}
+
+func (c txConnector) Connect(ctx context.Context) error     { return nil }
+func (c txConnector) Close() error                          { return nil }
+func (c txConnector) PingContext(ctx context.Context) error { return nil }
+func (c txConnector) SetMaxOpenConns(n int)                 {}
+func (c txConnector) SetMaxIdleConns(n int)                 {}
+func (c txConnector) SetConnMaxLifetime(d time.Duration)    {}
+
+func (c txConnector) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return c.tx.QueryRowContext(ctx, query, args...)
+}
+
+func (c txConnector) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return c.tx.QueryContext(ctx, query, args...)
+}
+
+func (c txConnector) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return c.tx.ExecContext(ctx, query, args...)
+}
+
+func (c txConnector) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return nil, errors.New("nested transactions are not supported")
+}
+
+// IsUniqueViolation reports whether err is Postgres rejecting a write for a
+// duplicate key, e.g. two callers racing past the same alias check.
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
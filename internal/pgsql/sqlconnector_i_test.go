@@ -0,0 +1,232 @@
+package pgsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyDriver refuses connections while down is set, like a restarting Postgres.
+type flakyDriver struct {
+	down  atomic.Bool
+	opens atomic.Int32
+}
+
+func (d *flakyDriver) Open(name string) (driver.Conn, error) {
+	d.opens.Add(1)
+	if d.down.Load() {
+		return nil, errors.New("connection refused")
+	}
+	return flakyConn{}, nil
+}
+
+type flakyConn struct{}
+
+func (flakyConn) Prepare(query string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (flakyConn) Close() error                              { return nil }
+func (flakyConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+var testFlakyDriver = &flakyDriver{}
+
+func init() {
+	sql.Register("mcmm-flaky", testFlakyDriver)
+}
+
+func TestConnector_HealthMonitorReconnectsAfterRestart(t *testing.T) {
+	testFlakyDriver.down.Store(false)
+	c := NewConnector("flaky")
+	c.open = func(dsn string) (*sql.DB, error) { return sql.Open("mcmm-flaky", dsn) }
+	c.baseDelay = 5 * time.Millisecond
+	c.maxDelay = 20 * time.Millisecond
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	c.SetMaxOpenConns(7)
+	first := c.current()
+
+	// Postgres goes away: the old handle is dead and new dials fail for a while.
+	testFlakyDriver.down.Store(true)
+	_ = first.Close()
+	if err := c.PingContext(context.Background()); err == nil {
+		t.Fatalf("ping on closed db should fail")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.StartHealthMonitor(ctx, 10*time.Millisecond)
+
+	time.Sleep(60 * time.Millisecond)
+	if c.current() != first {
+		t.Fatalf("handle must not be swapped while the database is down")
+	}
+	testFlakyDriver.down.Store(false)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for c.PingContext(context.Background()) != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("connector did not recover")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if c.current() == first {
+		t.Fatalf("expected a fresh db handle after reconnect")
+	}
+	if got := c.current().Stats().MaxOpenConnections; got != 7 {
+		t.Fatalf("pool settings should carry over, max_open=%d", got)
+	}
+}
+
+// recordingDriver logs every statement and whether it ran inside a tx.
+type recordingDriver struct {
+	mu   sync.Mutex
+	log  []recordedStmt
+	inTx bool
+	ends []string
+}
+
+type recordedStmt struct {
+	query string
+	inTx  bool
+}
+
+func (d *recordingDriver) Open(name string) (driver.Conn, error) { return recordingConn{d: d}, nil }
+
+type recordingConn struct{ d *recordingDriver }
+
+func (c recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return recordingStmt{d: c.d, query: query}, nil
+}
+func (c recordingConn) Close() error { return nil }
+func (c recordingConn) Begin() (driver.Tx, error) {
+	c.d.mu.Lock()
+	c.d.inTx = true
+	c.d.mu.Unlock()
+	return recordingTx{d: c.d}, nil
+}
+
+type recordingTx struct{ d *recordingDriver }
+
+func (t recordingTx) Commit() error   { return t.end("commit") }
+func (t recordingTx) Rollback() error { return t.end("rollback") }
+func (t recordingTx) end(how string) error {
+	t.d.mu.Lock()
+	t.d.inTx = false
+	t.d.ends = append(t.d.ends, how)
+	t.d.mu.Unlock()
+	return nil
+}
+
+type recordingStmt struct {
+	d     *recordingDriver
+	query string
+}
+
+func (s recordingStmt) Close() error  { return nil }
+func (s recordingStmt) NumInput() int { return -1 }
+func (s recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.record()
+	return driver.RowsAffected(1), nil
+}
+func (s recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.record()
+	return nil, errors.New("no rows")
+}
+func (s recordingStmt) record() {
+	s.d.mu.Lock()
+	s.d.log = append(s.d.log, recordedStmt{query: strings.TrimSpace(s.query), inTx: s.d.inTx})
+	s.d.mu.Unlock()
+}
+
+var testRecordingDriver = &recordingDriver{}
+
+func init() {
+	sql.Register("mcmm-recording", testRecordingDriver)
+}
+
+func TestReposWithTx_RoutesQueriesThroughTx(t *testing.T) {
+	c := NewConnector("recording")
+	c.open = func(dsn string) (*sql.DB, error) { return sql.Open("mcmm-recording", dsn) }
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer c.Close()
+	c.SetMaxOpenConns(1)
+	ctx := context.Background()
+	repos := NewRepos(c)
+
+	tx, err := c.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin tx: %v", err)
+	}
+	txRepos := repos.WithTx(tx)
+	if err := txRepos.MapInstance.Delete(ctx, 5); err != nil {
+		t.Fatalf("delete in tx: %v", err)
+	}
+	if err := txRepos.InstanceMember.Delete(ctx, 6); err != nil {
+		t.Fatalf("delete member in tx: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if err := repos.MapInstance.Delete(ctx, 7); err != nil {
+		t.Fatalf("delete outside tx: %v", err)
+	}
+
+	testRecordingDriver.mu.Lock()
+	log := append([]recordedStmt(nil), testRecordingDriver.log...)
+	testRecordingDriver.mu.Unlock()
+	if len(log) != 3 {
+		t.Fatalf("expected 3 statements, got %+v", log)
+	}
+	if !log[0].inTx || !log[1].inTx || log[2].inTx {
+		t.Fatalf("only WithTx repos should run inside the tx: %+v", log)
+	}
+	if !strings.HasPrefix(log[0].query, "DELETE FROM map_instances") || !strings.HasPrefix(log[1].query, "DELETE FROM instance_members") {
+		t.Fatalf("unexpected statements: %+v", log)
+	}
+	if _, err := (txConnector{tx: tx}).BeginTx(ctx, nil); err == nil {
+		t.Fatalf("nested BeginTx should fail")
+	}
+}
+
+func TestReposInTx_CommitsOnSuccessAndRollsBackOnError(t *testing.T) {
+	c := NewConnector("recording")
+	c.open = func(dsn string) (*sql.DB, error) { return sql.Open("mcmm-recording", dsn) }
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer c.Close()
+	c.SetMaxOpenConns(1)
+	ctx := context.Background()
+	repos := NewRepos(c)
+	testRecordingDriver.mu.Lock()
+	testRecordingDriver.ends = nil
+	testRecordingDriver.mu.Unlock()
+
+	if err := repos.InTx(ctx, c, func(tx Repos) error { return tx.MapInstance.Delete(ctx, 5) }); err != nil {
+		t.Fatalf("in tx: %v", err)
+	}
+	boom := errors.New("boom")
+	err := repos.InTx(ctx, c, func(tx Repos) error {
+		if err := tx.InstanceMember.Delete(ctx, 6); err != nil {
+			return err
+		}
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("fn error should come back, got %v", err)
+	}
+
+	testRecordingDriver.mu.Lock()
+	ends := append([]string(nil), testRecordingDriver.ends...)
+	testRecordingDriver.mu.Unlock()
+	if strings.Join(ends, ",") != "commit,rollback" {
+		t.Fatalf("expected a commit then a rollback, got %v", ends)
+	}
+}
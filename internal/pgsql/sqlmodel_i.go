@@ -14,6 +14,22 @@ type User struct {
 	CreatedAt  time.Time `db:"created_at"`
 }
 
+// MemberWithUser is a member row together with the user it points at.
+type MemberWithUser struct {
+	InstanceMember
+	MCUUID     string `db:"mc_uuid"`
+	MCName     string `db:"mc_name"`
+	ServerRole string `db:"server_role"`
+}
+
+// UserInstance is an instance as seen by one user: their member role on it
+// and how many non-owner members it has.
+type UserInstance struct {
+	MapInstance
+	Role        string
+	MemberCount int
+}
+
 type MapTemplate struct {
 	ID          int64     `db:"id"`
 	Tag         string    `db:"tag"`
@@ -26,6 +42,7 @@ type MapTemplate struct {
 type MapInstance struct {
 	ID           int64          `db:"id"`
 	Alias        string         `db:"alias"`
+	DisplayName  string         `db:"display_name"`
 	OwnerID      int64          `db:"owner_id"`
 	TemplateID   sql.NullInt64  `db:"template_id"`
 	SourceType   string         `db:"source_type"`
@@ -39,6 +56,45 @@ type MapInstance struct {
 	UpdatedAt    time.Time      `db:"updated_at"`
 	LastActiveAt sql.NullTime   `db:"last_active_at"`
 	ArchivedAt   sql.NullTime   `db:"archived_at"`
+	// LastComposeOutput is the (truncated) docker compose output of the last
+	// start/stop, kept for diagnostics.
+	LastComposeOutput sql.NullString `db:"last_compose_output"`
+	// ArchivePinned keeps the archive out of size-based pruning.
+	ArchivePinned bool `db:"archive_pinned"`
+	// Notes is a free-form admin annotation, e.g. "event world, delete after Sunday".
+	Notes string `db:"notes"`
+	// ServerTapKey is this instance's own ServerTap key, sealed with the
+	// configured instance key secret. Empty means the global key is used.
+	ServerTapKey string `db:"servertap_key"`
+	// HostPort is the host port mapped to the game port for direct
+	// connections. Zero means no mapping (proxy only).
+	HostPort int `db:"host_port"`
+	// CPULimit and MemLimitMB override the worker's container limits for
+	// this instance. Zero uses the configured defaults.
+	CPULimit   float64 `db:"cpu_limit"`
+	MemLimitMB int     `db:"mem_limit_mb"`
+	// Gamemode, Difficulty, MaxPlayers and MOTD go into the instance's
+	// server.properties; empty/zero keeps the current value.
+	Gamemode   string `db:"gamemode"`
+	Difficulty string `db:"difficulty"`
+	MaxPlayers int    `db:"max_players"`
+	MOTD       string `db:"motd"`
+	// StorageType is the storage tier the instance was created on, one of
+	// the configured storage_types.
+	StorageType string `db:"storage_type"`
+	// LevelSeed is the level-seed the world is generated with on its first
+	// start; empty lets the server pick one.
+	LevelSeed string `db:"level_seed"`
+	// RecoverAttempts counts health-driven auto-recovery restarts in the
+	// window that began at RecoverWindowAt.
+	RecoverAttempts int          `db:"recover_attempts"`
+	RecoverWindowAt sql.NullTime `db:"recover_window_at"`
+	// StartedOnAt is when the instance last turned On; world_info reports
+	// uptime from it while the instance is still On.
+	StartedOnAt sql.NullTime `db:"started_on_at"`
+	// PruneNoticeAt is when the owner was told this archive is next in line
+	// for size-cap pruning; it is deleted once the notice period has passed.
+	PruneNoticeAt sql.NullTime `db:"prune_notice_at"`
 }
 
 type ServerImage struct {
@@ -66,6 +122,16 @@ type InstanceMember struct {
 	CreatedAt  time.Time `db:"created_at"`
 }
 
+// PendingWhitelistOp is a whitelist add or remove made while the instance
+// was Off, replayed when it next starts.
+type PendingWhitelistOp struct {
+	ID         int64     `db:"id"`
+	InstanceID int64     `db:"instance_id"`
+	PlayerName string    `db:"player_name"`
+	Action     string    `db:"action"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
 // UserRequest is idempotency request model with a shorter name.
 type UserRequest struct {
 	ID               int64           `db:"id"`
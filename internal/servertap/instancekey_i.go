@@ -0,0 +1,92 @@
+package servertap
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// InstanceKeyring generates per-instance ServerTap keys and seals them for
+// storage on map_instances.servertap_key with AES-GCM.
+type InstanceKeyring struct {
+	aead cipher.AEAD
+}
+
+// NewInstanceKeyring derives the sealing key from secret; an empty secret
+// disables per-instance keys and returns nil.
+func NewInstanceKeyring(secret string) (*InstanceKeyring, error) {
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		return nil, nil
+	}
+	sum := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, fmt.Errorf("init instance keyring: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("init instance keyring: %w", err)
+	}
+	return &InstanceKeyring{aead: aead}, nil
+}
+
+// Generate returns a fresh random key and its sealed form.
+func (k *InstanceKeyring) Generate() (plain string, sealed string, err error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", fmt.Errorf("generate instance key: %w", err)
+	}
+	plain = hex.EncodeToString(raw)
+	sealed, err = k.Seal(plain)
+	if err != nil {
+		return "", "", err
+	}
+	return plain, sealed, nil
+}
+
+// Seal encrypts plain and encodes nonce||ciphertext as base64.
+func (k *InstanceKeyring) Seal(plain string) (string, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("seal instance key: %w", err)
+	}
+	out := k.aead.Seal(nonce, nonce, []byte(plain), nil)
+	return base64.StdEncoding.EncodeToString(out), nil
+}
+
+// Open reverses Seal.
+func (k *InstanceKeyring) Open(sealed string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(sealed))
+	if err != nil {
+		return "", fmt.Errorf("decode instance key: %w", err)
+	}
+	n := k.aead.NonceSize()
+	if len(raw) < n {
+		return "", fmt.Errorf("decode instance key: sealed value too short")
+	}
+	plain, err := k.aead.Open(nil, raw[:n], raw[n:], nil)
+	if err != nil {
+		return "", fmt.Errorf("open instance key: %w", err)
+	}
+	return string(plain), nil
+}
+
+// KeyFor returns the instance's own key when one is stored and can be
+// opened, otherwise fallback (the global ServerTap key). A nil keyring
+// always returns fallback.
+func (k *InstanceKeyring) KeyFor(sealed string, fallback string) string {
+	if k == nil || strings.TrimSpace(sealed) == "" {
+		return fallback
+	}
+	plain, err := k.Open(sealed)
+	if err != nil || plain == "" {
+		return fallback
+	}
+	return plain
+}
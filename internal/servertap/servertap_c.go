@@ -2,10 +2,22 @@ package servertap
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
+var (
+	playerCountRegex = regexp.MustCompile(`(?i)there are\s+(\d+)\s+out of`)
+	playerNamesRegex = regexp.MustCompile(`(?i)players online:\s*(.+)$`)
+)
+
+// ErrUnrecognizedPlayerList means the "list" output matched neither the JSON nor the text format.
+var ErrUnrecognizedPlayerList = errors.New("unrecognized servertap player list")
+
 type Executor interface {
 	Execute(ctx context.Context, req ExecuteRequest) (ParsedResponse, error)
 }
@@ -23,7 +35,10 @@ func (s *ServiceC) OPUser(ctx context.Context, user string) (ParsedResponse, err
 	if user == "" {
 		return ParsedResponse{}, fmt.Errorf("user is required")
 	}
-	cmd := NewCommandBuilder("op").Arg(user).Build()
+	cmd, err := NewCommandBuilder("op").PlayerArg(user).BuildChecked()
+	if err != nil {
+		return ParsedResponse{}, err
+	}
 	return s.executor.Execute(ctx, ExecuteRequest{Command: cmd})
 }
 
@@ -32,7 +47,10 @@ func (s *ServiceC) DEOPUser(ctx context.Context, user string) (ParsedResponse, e
 	if user == "" {
 		return ParsedResponse{}, fmt.Errorf("user is required")
 	}
-	cmd := NewCommandBuilder("deop").Arg(user).Build()
+	cmd, err := NewCommandBuilder("deop").PlayerArg(user).BuildChecked()
+	if err != nil {
+		return ParsedResponse{}, err
+	}
 	return s.executor.Execute(ctx, ExecuteRequest{Command: cmd})
 }
 
@@ -41,20 +59,159 @@ func (s *ServiceC) ListOps(ctx context.Context) (ParsedResponse, error) {
 	return s.executor.Execute(ctx, ExecuteRequest{Command: cmd})
 }
 
+// PlayerList is the parsed result of the "list" command.
+type PlayerList struct {
+	Online int
+	Max    int
+	Names  []string
+}
+
+// ParsePlayerList reads ServerTap's JSON players array when the response is
+// application/json and falls back to the legacy "There are N out of M" text.
+func ParsePlayerList(resp ParsedResponse) (PlayerList, error) {
+	if resp.IsJSON() {
+		return parsePlayerListJSON(resp)
+	}
+	return parsePlayerListText(resp.RawBody)
+}
+
+func parsePlayerListJSON(resp ParsedResponse) (PlayerList, error) {
+	var raw json.RawMessage
+	if err := resp.DecodeJSON(&raw); err != nil {
+		return PlayerList{}, err
+	}
+	var envelope struct {
+		Online  *int              `json:"online"`
+		Max     int               `json:"max"`
+		Players []json.RawMessage `json:"players"`
+	}
+	var players []json.RawMessage
+	if err := json.Unmarshal(raw, &players); err != nil {
+		if err := json.Unmarshal(raw, &envelope); err != nil {
+			return PlayerList{}, fmt.Errorf("%w: %v", ErrUnrecognizedPlayerList, err)
+		}
+		if envelope.Players == nil && envelope.Online == nil {
+			return PlayerList{}, ErrUnrecognizedPlayerList
+		}
+		players = envelope.Players
+	}
+
+	out := PlayerList{Max: envelope.Max, Names: make([]string, 0, len(players))}
+	for _, p := range players {
+		if name := playerName(p); name != "" {
+			out.Names = append(out.Names, name)
+		}
+	}
+	out.Online = len(out.Names)
+	if envelope.Online != nil {
+		out.Online = *envelope.Online
+	}
+	return out, nil
+}
+
+// playerName accepts either a bare string or a player object.
+func playerName(raw json.RawMessage) string {
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		return strings.TrimSpace(name)
+	}
+	var obj struct {
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return ""
+	}
+	if strings.TrimSpace(obj.Name) != "" {
+		return strings.TrimSpace(obj.Name)
+	}
+	return strings.TrimSpace(obj.DisplayName)
+}
+
+func parsePlayerListText(raw string) (PlayerList, error) {
+	body := strings.TrimSpace(raw)
+	if body == "" {
+		return PlayerList{}, ErrUnrecognizedPlayerList
+	}
+	out := PlayerList{}
+	counted := false
+	if m := playerCountRegex.FindStringSubmatch(body); len(m) == 2 {
+		if n, err := strconv.Atoi(m[1]); err == nil {
+			out.Online = n
+			counted = true
+		}
+	}
+	if m := playerNamesRegex.FindStringSubmatch(body); len(m) == 2 {
+		for _, part := range strings.Split(m[1], ",") {
+			if name := strings.TrimSpace(part); name != "" {
+				out.Names = append(out.Names, name)
+			}
+		}
+	}
+	if !counted {
+		if len(out.Names) == 0 {
+			return PlayerList{}, ErrUnrecognizedPlayerList
+		}
+		out.Online = len(out.Names)
+	}
+	return out, nil
+}
+
+// MVImport registers an existing world folder with Multiverse.
+func (s *ServiceC) MVImport(ctx context.Context, name string, env string) (ParsedResponse, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return ParsedResponse{}, fmt.Errorf("world name is required")
+	}
+	env = strings.ToUpper(strings.TrimSpace(env))
+	if env == "" {
+		env = "NORMAL"
+	}
+	cmd := NewCommandBuilder("mv").RawArg("import").Arg(name).RawArg(env).Build()
+	return s.executor.Execute(ctx, ExecuteRequest{Command: cmd})
+}
+
+// MVSetAlias sets the Multiverse display alias of world.
+func (s *ServiceC) MVSetAlias(ctx context.Context, world string, alias string) (ParsedResponse, error) {
+	world = strings.TrimSpace(world)
+	alias = strings.TrimSpace(alias)
+	if world == "" || alias == "" {
+		return ParsedResponse{}, fmt.Errorf("world and alias are required")
+	}
+	cmd := NewCommandBuilder("mvm").RawArg("set").RawArg("alias").Arg(alias).Arg(world).Build()
+	return s.executor.Execute(ctx, ExecuteRequest{Command: cmd})
+}
+
+// MVUnload unloads world from memory while keeping it in the Multiverse config.
+func (s *ServiceC) MVUnload(ctx context.Context, world string) (ParsedResponse, error) {
+	world = strings.TrimSpace(world)
+	if world == "" {
+		return ParsedResponse{}, fmt.Errorf("world name is required")
+	}
+	cmd := NewCommandBuilder("mv").RawArg("unload").Arg(world).Build()
+	return s.executor.Execute(ctx, ExecuteRequest{Command: cmd})
+}
+
+// MVRemove drops world from the Multiverse config without deleting its files.
+func (s *ServiceC) MVRemove(ctx context.Context, world string) (ParsedResponse, error) {
+	world = strings.TrimSpace(world)
+	if world == "" {
+		return ParsedResponse{}, fmt.Errorf("world name is required")
+	}
+	cmd := NewCommandBuilder("mv").RawArg("remove").Arg(world).Build()
+	return s.executor.Execute(ctx, ExecuteRequest{Command: cmd})
+}
+
 /*
 Legacy command wrappers are intentionally disabled for now:
-- mv import/unload/load/remove/delete/gamerule/alias
+- mv load/delete/gamerule
 - luckperms parent add/remove/group
 
 If needed later, restore from git history and move behind feature flags.
 
-func (s *ServiceC) MVImport(ctx context.Context, name string, env string) (ParsedResponse, error) { ... }
-func (s *ServiceC) MVUnload(ctx context.Context, world string) (ParsedResponse, error) { ... }
 func (s *ServiceC) MVLoad(ctx context.Context, world string) (ParsedResponse, error) { ... }
-func (s *ServiceC) MVRemove(ctx context.Context, world string) (ParsedResponse, error) { ... }
 func (s *ServiceC) MVDelete(ctx context.Context, world string) (ParsedResponse, error) { ... }
 func (s *ServiceC) MVGameRule(ctx context.Context, rule string, value string, world string) (ParsedResponse, error) { ... }
-func (s *ServiceC) MVSetAlias(ctx context.Context, world string, alias string) (ParsedResponse, error) { ... }
 func (s *ServiceC) LPGroupListMembers(ctx context.Context, group string) (ParsedResponse, error) { ... }
 func (s *ServiceC) LPUserParentAdd(ctx context.Context, user string, group string, world string) (ParsedResponse, error) { ... }
 func (s *ServiceC) LPUserParentRemove(ctx context.Context, user string, group string, world string) (ParsedResponse, error) { ... }
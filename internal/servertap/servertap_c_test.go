@@ -55,6 +55,30 @@ func TestServiceC_ListOps(t *testing.T) {
 	}
 }
 
+func TestServiceC_MVImport(t *testing.T) {
+	fx := &fakeExecutor{resp: ParsedResponse{StatusCode: 200}}
+	svc := NewServiceC(fx)
+
+	if _, err := svc.MVImport(context.Background(), "i_12", ""); err != nil {
+		t.Fatalf("MVImport failed: %v", err)
+	}
+	if fx.lastReq.Command != "mv import i_12 NORMAL" {
+		t.Fatalf("unexpected command: %q", fx.lastReq.Command)
+	}
+}
+
+func TestServiceC_MVSetAlias(t *testing.T) {
+	fx := &fakeExecutor{resp: ParsedResponse{StatusCode: 200}}
+	svc := NewServiceC(fx)
+
+	if _, err := svc.MVSetAlias(context.Background(), "i_12", "alice castle"); err != nil {
+		t.Fatalf("MVSetAlias failed: %v", err)
+	}
+	if fx.lastReq.Command != "mvm set alias 'alice castle' i_12" {
+		t.Fatalf("unexpected command: %q", fx.lastReq.Command)
+	}
+}
+
 func TestServiceC_OPUser_RequireUser(t *testing.T) {
 	fx := &fakeExecutor{}
 	svc := NewServiceC(fx)
@@ -74,3 +98,79 @@ func TestServiceC_DEOPUser_RequireUser(t *testing.T) {
 		t.Fatalf("expected error for empty user")
 	}
 }
+
+func jsonResponse(body string) ParsedResponse {
+	return ParsedResponse{
+		StatusCode: 200,
+		Headers:    map[string][]string{"Content-Type": {"application/json; charset=utf-8"}},
+		RawBody:    body,
+	}
+}
+
+func TestParsePlayerList_JSONEnvelope(t *testing.T) {
+	list, err := ParsePlayerList(jsonResponse(`{"online":2,"max":20,"players":["alice",{"name":"bob","uuid":"x"}]}`))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if list.Online != 2 || list.Max != 20 {
+		t.Fatalf("unexpected counts: %+v", list)
+	}
+	if len(list.Names) != 2 || list.Names[0] != "alice" || list.Names[1] != "bob" {
+		t.Fatalf("unexpected names: %v", list.Names)
+	}
+}
+
+func TestParsePlayerList_JSONArray(t *testing.T) {
+	list, err := ParsePlayerList(jsonResponse(`[{"displayName":"carol"}]`))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if list.Online != 1 || len(list.Names) != 1 || list.Names[0] != "carol" {
+		t.Fatalf("unexpected list: %+v", list)
+	}
+}
+
+func TestParsePlayerList_LegacyText(t *testing.T) {
+	list, err := ParsePlayerList(ParsedResponse{StatusCode: 200, RawBody: "There are 2 out of 20 players online: dave, erin"})
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if list.Online != 2 || len(list.Names) != 2 || list.Names[1] != "erin" {
+		t.Fatalf("unexpected list: %+v", list)
+	}
+
+	empty, err := ParsePlayerList(ParsedResponse{StatusCode: 200, RawBody: "There are 0 out of 20 players online."})
+	if err != nil {
+		t.Fatalf("parse empty failed: %v", err)
+	}
+	if empty.Online != 0 || len(empty.Names) != 0 {
+		t.Fatalf("unexpected empty list: %+v", empty)
+	}
+}
+
+func TestParsePlayerList_Unrecognized(t *testing.T) {
+	if _, err := ParsePlayerList(ParsedResponse{StatusCode: 200, RawBody: "Unknown command"}); err == nil {
+		t.Fatalf("expected error for unrecognized text")
+	}
+	if _, err := ParsePlayerList(jsonResponse(`{"status":"ok"}`)); err == nil {
+		t.Fatalf("expected error for json without players")
+	}
+}
+
+func TestServiceC_MVUnloadAndRemove(t *testing.T) {
+	fx := &fakeExecutor{resp: ParsedResponse{StatusCode: 200}}
+	svc := NewServiceC(fx)
+
+	if _, err := svc.MVUnload(context.Background(), "i_3"); err != nil {
+		t.Fatalf("MVUnload failed: %v", err)
+	}
+	if fx.lastReq.Command != "mv unload i_3" {
+		t.Fatalf("unexpected command: %q", fx.lastReq.Command)
+	}
+	if _, err := svc.MVRemove(context.Background(), "i_3"); err != nil {
+		t.Fatalf("MVRemove failed: %v", err)
+	}
+	if fx.lastReq.Command != "mv remove i_3" {
+		t.Fatalf("unexpected command: %q", fx.lastReq.Command)
+	}
+}
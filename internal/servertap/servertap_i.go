@@ -2,11 +2,19 @@ package servertap
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"os"
+	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	ilog "mcmm/internal/log"
@@ -14,6 +22,10 @@ import (
 
 const (
 	DefaultExecutePath = "/v1/server/exec"
+	// DefaultPlayerNamePattern is the Java edition name charset.
+	DefaultPlayerNamePattern = `^[A-Za-z0-9_]{1,16}$`
+	// batchConcurrency caps in-flight requests per ExecuteBatch call.
+	batchConcurrency = 4
 )
 
 type Connector struct {
@@ -38,8 +50,83 @@ type ParsedResponse struct {
 	RawBody    string              `json:"raw_body"`
 }
 
+// StatusError is returned by Execute when ServerTap answers with a non-2xx status.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	if e.IsAuth() {
+		return fmt.Sprintf("servertap auth rejected (status=%d): check servertap_key and servertap_auth_header", e.StatusCode)
+	}
+	body := strings.TrimSpace(e.Body)
+	if len(body) > 240 {
+		body = body[:240] + "..."
+	}
+	return fmt.Sprintf("servertap returned status=%d body=%q", e.StatusCode, body)
+}
+
+// IsAuth reports whether ServerTap rejected the configured key.
+func (e *StatusError) IsAuth() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+}
+
+// ErrInvalidPlayerName is returned for player names outside the configured
+// charset; such names are never put into a command.
+var ErrInvalidPlayerName = errors.New("invalid player name")
+
+var playerNamePattern atomic.Pointer[regexp.Regexp]
+
+func init() {
+	playerNamePattern.Store(regexp.MustCompile(DefaultPlayerNamePattern))
+}
+
+// SetPlayerNamePattern replaces the regexp player names must match before
+// being sent to ServerTap. An empty expr restores DefaultPlayerNamePattern.
+func SetPlayerNamePattern(expr string) error {
+	if strings.TrimSpace(expr) == "" {
+		expr = DefaultPlayerNamePattern
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("invalid player name pattern: %w", err)
+	}
+	playerNamePattern.Store(re)
+	return nil
+}
+
+// ValidatePlayerName reports whether name may be used as a command argument.
+func ValidatePlayerName(name string) error {
+	if !playerNamePattern.Load().MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrInvalidPlayerName, name)
+	}
+	return nil
+}
+
+// IsAuthError reports whether err wraps a 401/403 StatusError.
+func IsAuthError(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.IsAuth()
+}
+
 type CommandBuilder struct {
 	tokens []string
+	err    error
+}
+
+// TLSOptions configures https ServerTap endpoints; the zero value uses system roots.
+type TLSOptions struct {
+	InsecureSkipVerify bool
+	CAFile             string
+}
+
+// ConnectorOptions groups optional connector settings for NewConnectorWithOptions.
+type ConnectorOptions struct {
+	Timeout    time.Duration
+	AuthHeader string
+	AuthKey    string
+	TLS        TLSOptions
 }
 
 func NewConnector(baseURL string, timeout time.Duration) (*Connector, error) {
@@ -47,6 +134,10 @@ func NewConnector(baseURL string, timeout time.Duration) (*Connector, error) {
 }
 
 func NewConnectorWithAuth(baseURL string, timeout time.Duration, authHeader string, authKey string) (*Connector, error) {
+	return NewConnectorWithOptions(baseURL, ConnectorOptions{Timeout: timeout, AuthHeader: authHeader, AuthKey: authKey})
+}
+
+func NewConnectorWithOptions(baseURL string, opts ConnectorOptions) (*Connector, error) {
 	normalized := strings.TrimSpace(baseURL)
 	if normalized == "" {
 		return nil, fmt.Errorf("servertap base url is required")
@@ -61,29 +152,58 @@ func NewConnectorWithAuth(baseURL string, timeout time.Duration, authHeader stri
 		return nil, fmt.Errorf("invalid servertap url, need scheme and host: %s", normalized)
 	}
 
-	clientTimeout := timeout
+	clientTimeout := opts.Timeout
 	if clientTimeout < 0 {
 		clientTimeout = 10 * time.Second
 	}
 
-	header := strings.TrimSpace(authHeader)
+	header := strings.TrimSpace(opts.AuthHeader)
 	if header == "" {
 		header = "key"
 	}
 
+	tlsConfig, err := opts.TLS.config()
+	if err != nil {
+		return nil, err
+	}
+
 	return &Connector{
 		baseURL: u,
 		client: &http.Client{
 			Timeout: clientTimeout,
 			Transport: &http.Transport{
-				Proxy: nil,
+				Proxy:           nil,
+				TLSClientConfig: tlsConfig,
 			},
 		},
 		authHeader: header,
-		authKey:    strings.TrimSpace(authKey),
+		authKey:    strings.TrimSpace(opts.AuthKey),
 	}, nil
 }
 
+func (o TLSOptions) config() (*tls.Config, error) {
+	caFile := strings.TrimSpace(o.CAFile)
+	if !o.InsecureSkipVerify && caFile == "" {
+		return nil, nil
+	}
+	cfg := &tls.Config{InsecureSkipVerify: o.InsecureSkipVerify}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read servertap ca file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in servertap ca file %s", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
 func NewCommandBuilder(base string) *CommandBuilder {
 	base = strings.TrimSpace(base)
 	if base == "" {
@@ -97,21 +217,87 @@ func (b *CommandBuilder) Arg(value string) *CommandBuilder {
 	return b
 }
 
+// PlayerArg appends a player name after checking it with ValidatePlayerName.
+// An invalid name poisons the builder: Build returns "" and BuildChecked the error.
+func (b *CommandBuilder) PlayerArg(name string) *CommandBuilder {
+	name = strings.TrimSpace(name)
+	if err := ValidatePlayerName(name); err != nil {
+		if b.err == nil {
+			b.err = err
+		}
+		return b
+	}
+	return b.Arg(name)
+}
+
 func (b *CommandBuilder) RawArg(value string) *CommandBuilder {
 	b.tokens = append(b.tokens, strings.TrimSpace(value))
 	return b
 }
 
 func (b *CommandBuilder) Build() string {
+	if b.err != nil {
+		return ""
+	}
 	return strings.TrimSpace(strings.Join(b.tokens, " "))
 }
 
+func (b *CommandBuilder) BuildChecked() (string, error) {
+	if b.err != nil {
+		return "", b.err
+	}
+	return b.Build(), nil
+}
+
+// FormatMessage fills {key} placeholders in a configured player-facing text
+// (e.g. a kick reason) and flattens line breaks so the result stays one
+// command argument. Unknown placeholders are left as they are.
+func FormatMessage(tmpl string, vars map[string]string) string {
+	pairs := make([]string, 0, len(vars)*2+4)
+	for k, v := range vars {
+		pairs = append(pairs, "{"+k+"}", v)
+	}
+	pairs = append(pairs, "\r", " ", "\n", " ")
+	return strings.TrimSpace(strings.NewReplacer(pairs...).Replace(tmpl))
+}
+
+// redactedArgs maps message-carrying commands to how many leading
+// arguments (usually the target player) stay visible in logs.
+var redactedArgs = map[string]int{
+	"tell":      1,
+	"msg":       1,
+	"w":         1,
+	"tellraw":   1,
+	"kick":      1,
+	"title":     2,
+	"say":       0,
+	"me":        0,
+	"broadcast": 0,
+}
+
+// RedactCommand hides free-text message contents (tell/kick reasons,
+// broadcasts) so a command can be logged at Info level without leaking
+// what players were told. Other commands are returned unchanged.
+func RedactCommand(command string) string {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return command
+	}
+	verb := strings.ToLower(strings.TrimPrefix(fields[0], "/"))
+	verb = strings.TrimPrefix(verb, "minecraft:")
+	keep, ok := redactedArgs[verb]
+	if !ok || len(fields) <= keep+1 {
+		return command
+	}
+	return strings.Join(fields[:keep+1], " ") + " <redacted>"
+}
+
 func quoteIfNeeded(value string) string {
 	trimmed := strings.TrimSpace(value)
 	if trimmed == "" {
 		return "''"
 	}
-	if !strings.ContainsAny(trimmed, " \t\"'") {
+	if !strings.ContainsAny(trimmed, " \t\r\n\"'") {
 		return trimmed
 	}
 	escaped := strings.ReplaceAll(trimmed, `'`, `'\''`)
@@ -138,7 +324,8 @@ func (c *Connector) Execute(ctx context.Context, req ExecuteRequest) (ParsedResp
 	form := url.Values{}
 	form.Set("command", payload.Command)
 
-	logger.Infof("sending command to servertap: %s", command)
+	logger.Infof("sending command to servertap: %s", RedactCommand(command))
+	logger.Debugf("servertap command full text: %s", command)
 	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), strings.NewReader(form.Encode()))
 	if err != nil {
 		return ParsedResponse{}, fmt.Errorf("build execute request failed: %w", err)
@@ -158,14 +345,125 @@ func (c *Connector) Execute(ctx context.Context, req ExecuteRequest) (ParsedResp
 	if err != nil {
 		return ParsedResponse{}, err
 	}
+	logger.Infof("servertap response status=%d body_bytes=%d", parsed.StatusCode, len(parsed.RawBody))
 	bodyPreview := strings.TrimSpace(parsed.RawBody)
 	if len(bodyPreview) > 240 {
 		bodyPreview = bodyPreview[:240] + "..."
 	}
-	logger.Infof("servertap response status=%d body_bytes=%d body=%q", parsed.StatusCode, len(parsed.RawBody), bodyPreview)
+	logger.Debugf("servertap response body=%q", bodyPreview)
+	if parsed.StatusCode < 200 || parsed.StatusCode >= 300 {
+		statusErr := &StatusError{StatusCode: parsed.StatusCode, Body: parsed.RawBody}
+		if statusErr.IsAuth() {
+			logger.Errorf("servertap rejected credentials url=%s header=%s: check servertap_key", c.baseURL.String(), c.authHeader)
+		}
+		return parsed, statusErr
+	}
 	return parsed, nil
 }
 
+// BatchError reports which commands of an ExecuteBatch call failed.
+// Errors is aligned with the request slice; nil entries succeeded.
+type BatchError struct {
+	Errors []error
+}
+
+func (e *BatchError) Error() string {
+	failed := e.Failed()
+	if len(failed) == 0 {
+		return "servertap batch: no failures"
+	}
+	return fmt.Sprintf("servertap batch: %d/%d commands failed, first (#%d): %v", len(failed), len(e.Errors), failed[0], e.Errors[failed[0]])
+}
+
+// Failed returns the indexes of failed commands in request order.
+func (e *BatchError) Failed() []int {
+	out := make([]int, 0, len(e.Errors))
+	for i, err := range e.Errors {
+		if err != nil {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// Unwrap exposes per-command errors so IsAuthError sees auth rejections.
+func (e *BatchError) Unwrap() []error {
+	out := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		if err != nil {
+			out = append(out, err)
+		}
+	}
+	return out
+}
+
+// ExecuteBatch pipelines reqs over the connector's keep-alive client and returns
+// responses in request order. When any command fails the error is a *BatchError.
+func (c *Connector) ExecuteBatch(ctx context.Context, reqs []ExecuteRequest) ([]ParsedResponse, error) {
+	results := make([]ParsedResponse, len(reqs))
+	errs := make([]error, len(reqs))
+	sem := make(chan struct{}, batchConcurrency)
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, req ExecuteRequest) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i], errs[i] = c.Execute(ctx, req)
+		}(i, req)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return results, &BatchError{Errors: errs}
+		}
+	}
+	return results, nil
+}
+
+// Ping returns nil only when ServerTap accepts a lightweight command.
+func (c *Connector) Ping(ctx context.Context) error {
+	_, err := c.Execute(ctx, ExecuteRequest{Command: "list"})
+	return err
+}
+
+// Pinger is implemented by connectors that can report readiness.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// WaitReady pings until the server responds, retrying up to retries times with delay between attempts.
+// Auth failures are returned immediately since retrying cannot fix a wrong key.
+func WaitReady(ctx context.Context, conn Pinger, retries int, delay time.Duration) error {
+	logger := ilog.Component("servertap")
+	if retries <= 0 {
+		retries = 1
+	}
+	var lastErr error
+	for i := 0; i < retries; i++ {
+		lastErr = conn.Ping(ctx)
+		if lastErr == nil {
+			return nil
+		}
+		if IsAuthError(lastErr) {
+			return lastErr
+		}
+		if i == retries-1 {
+			break
+		}
+		// A starting server fails most polls; only the final outcome is a warning.
+		logger.Debugf("servertap not ready (%d/%d): %v", i+1, retries, lastErr)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+	logger.Warnf("servertap not ready after %d attempts: %v", retries, lastErr)
+	return fmt.Errorf("servertap not ready after %d attempts: %w", retries, lastErr)
+}
+
 func ParseHTTPResponse(resp *http.Response) (ParsedResponse, error) {
 	if resp == nil {
 		return ParsedResponse{}, fmt.Errorf("nil http response")
@@ -185,6 +483,33 @@ func ParseHTTPResponse(resp *http.Response) (ParsedResponse, error) {
 	return out, nil
 }
 
+// IsJSON reports whether ServerTap labelled the body as application/json.
+func (r ParsedResponse) IsJSON() bool {
+	for k, v := range r.Headers {
+		if !strings.EqualFold(k, "Content-Type") {
+			continue
+		}
+		for _, ct := range v {
+			if strings.HasPrefix(strings.ToLower(strings.TrimSpace(ct)), "application/json") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DecodeJSON unmarshals RawBody into v.
+func (r ParsedResponse) DecodeJSON(v any) error {
+	body := strings.TrimSpace(r.RawBody)
+	if body == "" {
+		return fmt.Errorf("decode servertap json: empty body")
+	}
+	if err := json.Unmarshal([]byte(body), v); err != nil {
+		return fmt.Errorf("decode servertap json: %w", err)
+	}
+	return nil
+}
+
 func cloneHeader(h http.Header) map[string][]string {
 	out := make(map[string][]string, len(h))
 	for k, v := range h {
@@ -1,16 +1,25 @@
 package servertap
 
 import (
+	"bytes"
 	"context"
+	"encoding/pem"
+	"errors"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"mcmm/internal/config"
 	ilog "mcmm/internal/log"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 func TestNewCommandBuilder_Build(t *testing.T) {
@@ -89,3 +98,302 @@ func TestConnector_ExecuteMVList_WithConfig(t *testing.T) {
 	t.Logf("headers=%v", resp.Headers)
 	t.Logf("raw_body=%s", resp.RawBody)
 }
+
+func TestConnector_Execute_AuthRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte("forbidden"))
+	}))
+	defer srv.Close()
+
+	conn, err := NewConnectorWithAuth(srv.URL, 2*time.Second, "key", "wrong")
+	if err != nil {
+		t.Fatalf("create connector failed: %v", err)
+	}
+	resp, err := conn.Execute(context.Background(), ExecuteRequest{Command: "list"})
+	if err == nil {
+		t.Fatalf("expected error for 403 response")
+	}
+	if !IsAuthError(err) {
+		t.Fatalf("expected auth error, got: %v", err)
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+}
+
+func TestConnector_Execute_InfoLogOmitsMessageContent(t *testing.T) {
+	var buf bytes.Buffer
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&buf), zap.InfoLevel)
+	prev := ilog.Logger
+	ilog.Logger = zap.New(core).Sugar()
+	defer func() { ilog.Logger = prev }()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("whispered to alice: meet at spawn"))
+	}))
+	defer srv.Close()
+
+	conn, err := NewConnectorWithAuth(srv.URL, 2*time.Second, "key", "k")
+	if err != nil {
+		t.Fatalf("create connector failed: %v", err)
+	}
+	if _, err := conn.Execute(context.Background(), ExecuteRequest{Command: "tell alice meet at spawn"}); err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+
+	out := buf.String()
+	if strings.Contains(out, "meet at spawn") {
+		t.Fatalf("message content leaked into info log: %s", out)
+	}
+	if !strings.Contains(out, "tell alice <redacted>") {
+		t.Fatalf("expected redacted command in log: %s", out)
+	}
+	if !strings.Contains(out, "status=200") {
+		t.Fatalf("expected response status in log: %s", out)
+	}
+}
+
+func TestRedactCommand(t *testing.T) {
+	cases := map[string]string{
+		"tell alice hi there":             "tell alice <redacted>",
+		"/kick bob 'Server is closing'":   "/kick bob <redacted>",
+		"minecraft:say hello everyone":    "minecraft:say <redacted>",
+		"whitelist add alice":             "whitelist add alice",
+		"kick bob":                        "kick bob",
+		"mv tp alice alice_castle_nether": "mv tp alice alice_castle_nether",
+	}
+	for in, want := range cases {
+		if got := RedactCommand(in); got != want {
+			t.Fatalf("RedactCommand(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestConnector_Execute_ServerErrorIsNotAuth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	conn, err := NewConnectorWithAuth(srv.URL, 2*time.Second, "key", "k")
+	if err != nil {
+		t.Fatalf("create connector failed: %v", err)
+	}
+	_, err = conn.Execute(context.Background(), ExecuteRequest{Command: "list"})
+	if err == nil {
+		t.Fatalf("expected error for 500 response")
+	}
+	if IsAuthError(err) {
+		t.Fatalf("500 should not be classified as auth error")
+	}
+}
+
+func TestWaitReady_BecomesReadyAfterRetries(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("There are 0 out of 20 players online."))
+	}))
+	defer srv.Close()
+
+	conn, err := NewConnectorWithAuth(srv.URL, 2*time.Second, "key", "k")
+	if err != nil {
+		t.Fatalf("create connector failed: %v", err)
+	}
+	if err := WaitReady(context.Background(), conn, 5, 10*time.Millisecond); err != nil {
+		t.Fatalf("expected ready, got: %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Fatalf("expected 3 ping calls, got=%d", got)
+	}
+}
+
+func TestWaitReady_GivesUpAfterRetries(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	conn, err := NewConnectorWithAuth(srv.URL, 2*time.Second, "key", "k")
+	if err != nil {
+		t.Fatalf("create connector failed: %v", err)
+	}
+	if err := WaitReady(context.Background(), conn, 2, 10*time.Millisecond); err == nil {
+		t.Fatalf("expected not ready error")
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Fatalf("expected 2 ping calls, got=%d", got)
+	}
+}
+
+func TestWaitReady_AuthErrorStopsEarly(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	conn, err := NewConnectorWithAuth(srv.URL, 2*time.Second, "key", "bad")
+	if err != nil {
+		t.Fatalf("create connector failed: %v", err)
+	}
+	err = WaitReady(context.Background(), conn, 5, 10*time.Millisecond)
+	if !IsAuthError(err) {
+		t.Fatalf("expected auth error, got: %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("auth error should not be retried, calls=%d", got)
+	}
+}
+
+func TestConnector_Execute_TLSCustomCA(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, pemBytes, 0o600); err != nil {
+		t.Fatalf("write ca file: %v", err)
+	}
+
+	plain, err := NewConnectorWithOptions(srv.URL, ConnectorOptions{Timeout: 2 * time.Second})
+	if err != nil {
+		t.Fatalf("new connector: %v", err)
+	}
+	if _, err := plain.Execute(context.Background(), ExecuteRequest{Command: "list"}); err == nil {
+		t.Fatalf("expected certificate verification failure without ca_file")
+	}
+
+	withCA, err := NewConnectorWithOptions(srv.URL, ConnectorOptions{Timeout: 2 * time.Second, TLS: TLSOptions{CAFile: caFile}})
+	if err != nil {
+		t.Fatalf("new connector with ca: %v", err)
+	}
+	if _, err := withCA.Execute(context.Background(), ExecuteRequest{Command: "list"}); err != nil {
+		t.Fatalf("execute with ca_file: %v", err)
+	}
+
+	insecure, err := NewConnectorWithOptions(srv.URL, ConnectorOptions{Timeout: 2 * time.Second, TLS: TLSOptions{InsecureSkipVerify: true}})
+	if err != nil {
+		t.Fatalf("new insecure connector: %v", err)
+	}
+	if _, err := insecure.Execute(context.Background(), ExecuteRequest{Command: "list"}); err != nil {
+		t.Fatalf("execute with insecure_skip_verify: %v", err)
+	}
+}
+
+func TestNewConnectorWithOptions_MissingCAFile(t *testing.T) {
+	_, err := NewConnectorWithOptions("https://127.0.0.1:4567", ConnectorOptions{TLS: TLSOptions{CAFile: "/nonexistent/ca.pem"}})
+	if err == nil {
+		t.Fatalf("expected error for missing ca_file")
+	}
+}
+
+func TestConnector_ExecuteBatch_PreservesOrderAndReportsFailures(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cmd := r.FormValue("command")
+		if strings.HasPrefix(cmd, "fail") {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte("boom"))
+			return
+		}
+		if cmd == "slow" {
+			time.Sleep(30 * time.Millisecond)
+		}
+		_, _ = w.Write([]byte("ran " + cmd))
+	}))
+	defer srv.Close()
+
+	conn, err := NewConnector(srv.URL, 2*time.Second)
+	if err != nil {
+		t.Fatalf("new connector: %v", err)
+	}
+	cmds := []string{"slow", "a", "fail-1", "b", "c", "fail-2", "d"}
+	reqs := make([]ExecuteRequest, len(cmds))
+	for i, c := range cmds {
+		reqs[i] = ExecuteRequest{Command: c}
+	}
+
+	resps, err := conn.ExecuteBatch(context.Background(), reqs)
+	if len(resps) != len(cmds) {
+		t.Fatalf("expected %d responses, got=%d", len(cmds), len(resps))
+	}
+	for i, c := range cmds {
+		if strings.HasPrefix(c, "fail") {
+			continue
+		}
+		if resps[i].RawBody != "ran "+c {
+			t.Fatalf("response %d out of order: %q", i, resps[i].RawBody)
+		}
+	}
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected BatchError, got=%v", err)
+	}
+	failed := batchErr.Failed()
+	if len(failed) != 2 || failed[0] != 2 || failed[1] != 5 {
+		t.Fatalf("unexpected failed indexes: %v", failed)
+	}
+	if IsAuthError(err) {
+		t.Fatalf("server errors must not be reported as auth errors")
+	}
+}
+
+func TestConnector_ExecuteBatch_AuthErrorVisible(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	conn, err := NewConnector(srv.URL, 2*time.Second)
+	if err != nil {
+		t.Fatalf("new connector: %v", err)
+	}
+	_, err = conn.ExecuteBatch(context.Background(), []ExecuteRequest{{Command: "op a"}, {Command: "op b"}})
+	if !IsAuthError(err) {
+		t.Fatalf("expected auth error through batch, got=%v", err)
+	}
+}
+
+func TestCommandBuilder_PlayerArgRejectsOrQuotes(t *testing.T) {
+	cmd, err := NewCommandBuilder("whitelist").RawArg("add").PlayerArg("Steve_01").BuildChecked()
+	if err != nil || cmd != "whitelist add Steve_01" {
+		t.Fatalf("valid name: cmd=%q err=%v", cmd, err)
+	}
+	for _, name := range []string{"bob\nop mallory", "a b", "x;y", "toolongplayername_x", "§evil"} {
+		b := NewCommandBuilder("op").PlayerArg(name)
+		if _, err := b.BuildChecked(); !errors.Is(err, ErrInvalidPlayerName) {
+			t.Fatalf("name %q should be rejected, err=%v", name, err)
+		}
+		if got := b.Build(); got != "" {
+			t.Fatalf("rejected name %q must not produce a command, got %q", name, got)
+		}
+	}
+	if got := NewCommandBuilder("say").Arg("line1\nop mallory").Build(); got != "say 'line1\nop mallory'" {
+		t.Fatalf("newline argument must be quoted, got %q", got)
+	}
+}
+
+func TestSetPlayerNamePattern(t *testing.T) {
+	t.Cleanup(func() { _ = SetPlayerNamePattern("") })
+	if err := SetPlayerNamePattern(`^\.?[A-Za-z0-9_]{1,16}$`); err != nil {
+		t.Fatalf("set pattern: %v", err)
+	}
+	if err := ValidatePlayerName(".BedrockUser"); err != nil {
+		t.Fatalf("custom pattern should accept prefixed name: %v", err)
+	}
+	if err := SetPlayerNamePattern("("); err == nil {
+		t.Fatalf("invalid regexp should be rejected")
+	}
+	if err := ValidatePlayerName("a b"); err == nil {
+		t.Fatalf("pattern must still reject spaces")
+	}
+}
@@ -1 +1,116 @@
 package webservice
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"mcmm/internal/log"
+	"mcmm/internal/worker"
+)
+
+// WorkerStateSource exposes the worker internals shown by the admin endpoint.
+type WorkerStateSource interface {
+	Snapshot() worker.StateSnapshot
+}
+
+type AdminResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	Data    any    `json:"data,omitempty"`
+}
+
+type AdminHandlerI struct {
+	worker     WorkerStateSource
+	authHeader string
+	authToken  string
+	logger     interface {
+		Infof(string, ...any)
+		Warnf(string, ...any)
+		Errorf(string, ...any)
+	}
+}
+
+func NewAdminHandlerI(w WorkerStateSource, authHeader string, authToken string) *AdminHandlerI {
+	if strings.TrimSpace(authHeader) == "" {
+		authHeader = "Authorization"
+	}
+	return &AdminHandlerI{
+		worker:     w,
+		authHeader: strings.TrimSpace(authHeader),
+		authToken:  strings.TrimSpace(authToken),
+		logger:     log.Component("admin"),
+	}
+}
+
+func (h *AdminHandlerI) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/v1/admin/worker", h.handleWorkerState)
+}
+
+func (h *AdminHandlerI) handleWorkerState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, AdminResponse{Status: "error", Message: "method not allowed"})
+		return
+	}
+	if !h.authorized(r) {
+		h.logger.Warnf("admin request rejected path=%s remote=%s", r.URL.Path, r.RemoteAddr)
+		writeJSON(w, http.StatusUnauthorized, AdminResponse{Status: "error", Message: "unauthorized"})
+		return
+	}
+	writeJSON(w, http.StatusOK, AdminResponse{Status: "ok", Data: h.worker.Snapshot()})
+}
+
+// authorized accepts "Bearer <token>" or the bare token. An empty admin_token
+// disables the admin endpoints entirely.
+func (h *AdminHandlerI) authorized(r *http.Request) bool {
+	if h.authToken == "" {
+		return false
+	}
+	got := strings.TrimSpace(r.Header.Get(h.authHeader))
+	got = strings.TrimSpace(strings.TrimPrefix(got, "Bearer "))
+	return subtle.ConstantTimeCompare([]byte(got), []byte(h.authToken)) == 1
+}
+
+// ReadinessSource reports whether the service can create instances.
+type ReadinessSource interface {
+	VersionsInstalled() bool
+}
+
+type HealthData struct {
+	VersionsInstalled bool `json:"versions_installed"`
+}
+
+// HealthHandlerI serves the unauthenticated /v1/health probe. It answers 503
+// while no runnable game version is installed, so the problem shows up before
+// the first create fails.
+type HealthHandlerI struct {
+	ready ReadinessSource
+}
+
+func NewHealthHandlerI(ready ReadinessSource) *HealthHandlerI {
+	return &HealthHandlerI{ready: ready}
+}
+
+func (h *HealthHandlerI) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/v1/health", h.handleHealth)
+}
+
+func (h *HealthHandlerI) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, AdminResponse{Status: "error", Message: "method not allowed"})
+		return
+	}
+	data := HealthData{VersionsInstalled: h.ready.VersionsInstalled()}
+	if !data.VersionsInstalled {
+		writeJSON(w, http.StatusServiceUnavailable, AdminResponse{Status: "degraded", Message: "no game versions installed", Data: data})
+		return
+	}
+	writeJSON(w, http.StatusOK, AdminResponse{Status: "ok", Data: data})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -2,21 +2,93 @@ package worker
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"mcmm/internal/metrics"
 	"mcmm/internal/pgsql"
+	"mcmm/internal/servertap"
 )
 
 type Worker interface {
 	StartFromTemplate(ctx context.Context, instanceID int64, template pgsql.MapTemplate) error
 	StartFromUpload(ctx context.Context, instanceID int64, uploadWorldPath string) error
 	StartEmpty(ctx context.Context, instanceID int64, gameVersion string) error
+	Provision(ctx context.Context, instanceID int64, gameVersion string, sourceWorldPath string) error
 	StartExisting(ctx context.Context, instanceID int64) error
 	StopOnly(ctx context.Context, instanceID int64) error
 	StopAndArchive(ctx context.Context, instanceID int64) error
 	DeleteArchived(ctx context.Context, instanceID int64) error
+	PruneArchives(ctx context.Context, maxBytes int64, notice time.Duration, warn func(ctx context.Context, inst pgsql.MapInstance, size int64, deleteAfter time.Time)) ([]int64, error)
+	RestoreArchived(ctx context.Context, instanceID int64) error
+	SwitchVersion(ctx context.Context, instanceID int64, gameVersion string) error
+	RepairVolume(ctx context.Context, instanceID int64) ([]string, error)
+	SupportedVersions() ([]VersionSupport, error)
+	ValidateStart(ctx context.Context, instanceID int64, gameVersion string) error
+	RotateServerTapKey(ctx context.Context, instanceID int64) error
+	AllowAndOpUser(ctx context.Context, mcName string) ([]int64, error)
+	Capacity(ctx context.Context) (CapacityReport, error)
+	RestartCount(ctx context.Context, instanceID int64) (int, error)
+	ReconfigureAccess(ctx context.Context, instanceID int64) error
+	RefreshMultiverseAlias(ctx context.Context, instanceID int64) error
+	ComposePreview(ctx context.Context, instanceID int64) (string, error)
 }
 
+// VersionSupport is one supported game version prefix, the runtime image
+// used for it and the installed versions (paper jar present) it covers.
+type VersionSupport struct {
+	Prefix    string
+	Image     string
+	Installed []string
+}
+
+// CommandError is a failed external command (docker compose, docker network)
+// together with its truncated combined output.
+type CommandError struct {
+	Command string
+	Output  string
+	Err     error
+}
+
+func (e *CommandError) Error() string {
+	if tail := lastOutputLine(e.Output); tail != "" {
+		return fmt.Sprintf("%s failed: %v: %s", e.Command, e.Err, tail)
+	}
+	return fmt.Sprintf("%s failed: %v", e.Command, e.Err)
+}
+
+// maxErrorOutputBytes bounds how much command output ends up in an error
+// message; the full (already truncated) output stays in CommandError.Output.
+const maxErrorOutputBytes = 200
+
+// lastOutputLine returns the last non-empty line of out, which is where docker
+// usually puts the reason, cut down to maxErrorOutputBytes.
+func lastOutputLine(out string) string {
+	out = strings.TrimSpace(out)
+	if i := strings.LastIndexByte(out, '\n'); i >= 0 {
+		out = strings.TrimSpace(out[i+1:])
+	}
+	if len(out) <= maxErrorOutputBytes {
+		return out
+	}
+	out = out[:maxErrorOutputBytes]
+	// Do not end in the middle of a UTF-8 sequence.
+	for len(out) > 0 && !utf8.ValidString(out) {
+		out = out[:len(out)-1]
+	}
+	return out + "..."
+}
+
+func (e *CommandError) Unwrap() error { return e.Err }
+
+// ErrArchiveMissing is returned by RestoreArchived when the archived world
+// directory no longer exists (e.g. already purged).
+var ErrArchiveMissing = errors.New("archived world directory is missing")
+
 type Status string
 
 const (
@@ -36,6 +108,20 @@ const (
 	HealthHealthy     HealthStatus = "healthy"
 	HealthStartFailed HealthStatus = "start_failed"
 	HealthUnreachable HealthStatus = "unreachable"
+	HealthAuthFailed  HealthStatus = "auth_failed"
+)
+
+// ErrorCode is the stable class of a worker failure, surfaced in command
+// responses and user_requests.error_code; see ClassifyError.
+type ErrorCode string
+
+const (
+	CodeJarMissing           ErrorCode = "JAR_MISSING"
+	CodeImageUnsupported     ErrorCode = "IMAGE_UNSUPPORTED"
+	CodeServerTapUnreachable ErrorCode = "SERVERTAP_UNREACHABLE"
+	CodeServerTapAuth        ErrorCode = "SERVERTAP_AUTH"
+	CodeDockerFailed         ErrorCode = "DOCKER_FAILED"
+	CodeWorkerError          ErrorCode = "WORKER_ERROR"
 )
 
 // Options are fixed deployment inputs for worker runtime.
@@ -44,6 +130,7 @@ type Options struct {
 	VersionRootDir        string
 	ComposeTemplateDir    string
 	ArchiveRootDir        string
+	StagingRootDir        string
 	DefaultGameVersion    string
 	ServerTapPort         int
 	ServerTapTimeout      time.Duration
@@ -51,6 +138,158 @@ type Options struct {
 	InstanceTapURLPattern string
 	ServerTapAuthKey      string
 	ServerTapAuthName     string
+	ServerTapTLS          servertap.TLSOptions
 	BootstrapAdminName    string
-	Now                   func() time.Time
+	// InstanceKeys seals per-instance ServerTap keys; nil keeps every
+	// instance on ServerTapAuthKey.
+	InstanceKeys *servertap.InstanceKeyring
+	// HostPortMin..HostPortMax is the host port range mapped to each
+	// instance's game port for direct connections. Zero disables mapping.
+	HostPortMin int
+	HostPortMax int
+	// CPULimit (cpus) and MemLimitMB (mem_limit) cap each instance container
+	// unless the instance row overrides them. Zero leaves it unlimited.
+	CPULimit   float64
+	MemLimitMB int
+	// PostCreateHook is an optional command run after a new instance first
+	// reaches On; empty disables it. It is killed after PostCreateHookTimeout.
+	PostCreateHook        string
+	PostCreateHookTimeout time.Duration
+	// PreDestroyHook is an optional command run before an instance is
+	// archived or purged. Destroy goes on when it fails unless
+	// PreDestroyHookAbort is set.
+	PreDestroyHook        string
+	PreDestroyHookTimeout time.Duration
+	PreDestroyHookAbort   bool
+	// PreStopTimeout bounds the in-game save-all and stop sent before
+	// compose down; past it the container is taken down regardless.
+	PreStopTimeout time.Duration
+	// MaxConcurrentStarts bounds how many compose start flows run at once;
+	// zero leaves starts unlimited.
+	MaxConcurrentStarts int
+	// MultiverseImport registers each started world with Multiverse as i_<id>.
+	MultiverseImport bool
+	// StartMaxAttempts is how many times a failed start flow is tried in total
+	// when the failure is retryable (compose/network). 1 disables retries.
+	StartMaxAttempts int
+	// StartRetryBackoff is the wait before the second attempt; it grows
+	// linearly with each further attempt.
+	StartRetryBackoff time.Duration
+	// ServerTapMaxRetries is how many times a failed ServerTap command is
+	// tried in total. Between tries the wait doubles from
+	// ServerTapRetryBaseDelay up to ServerTapRetryMaxDelay, with jitter so
+	// instances starting together do not retry in lockstep.
+	ServerTapMaxRetries     int
+	ServerTapRetryBaseDelay time.Duration
+	ServerTapRetryMaxDelay  time.Duration
+	Now                     func() time.Time
+	// Metrics receives operation success/failure counts; nil disables them.
+	Metrics *metrics.Registry
+}
+
+// JobInfo describes one in-flight (or queued) worker operation.
+type JobInfo struct {
+	ID         int64     `json:"id"`
+	InstanceID int64     `json:"instance_id"`
+	Operation  string    `json:"operation"`
+	StartedAt  time.Time `json:"started_at"`
+	// Attempt is the current start attempt (1-based); zero for non-start jobs.
+	Attempt int `json:"attempt,omitempty"`
+}
+
+// StateSnapshot is a point-in-time view of the worker internals for debugging.
+// StartSlotsTotal is zero when starts are not limited.
+type StateSnapshot struct {
+	Jobs            []JobInfo `json:"jobs"`
+	StartSlotsInUse int       `json:"start_slots_in_use"`
+	StartSlotsTotal int       `json:"start_slots_total"`
+	QueuedStarts    []JobInfo `json:"queued_starts"`
+}
+
+// DefaultServerIDPrefix is the proxy server-id prefix; it also names the
+// instance containers, so the default server-id is the container hostname.
+const DefaultServerIDPrefix = "mcmm-inst-"
+
+// ServerID is the proxy server-id of an instance: prefix followed by its id.
+// An empty prefix means DefaultServerIDPrefix.
+func ServerID(prefix string, instanceID int64) string {
+	if prefix == "" {
+		prefix = DefaultServerIDPrefix
+	}
+	return prefix + strconv.FormatInt(instanceID, 10)
+}
+
+// ParseServerID maps a server-id made by ServerID with the same prefix back
+// to the instance id.
+func ParseServerID(prefix string, serverID string) (int64, error) {
+	if prefix == "" {
+		prefix = DefaultServerIDPrefix
+	}
+	rest, ok := strings.CutPrefix(strings.TrimSpace(serverID), prefix)
+	if !ok {
+		return 0, fmt.Errorf("server id %q does not start with %q", serverID, prefix)
+	}
+	id, err := strconv.ParseInt(rest, 10, 64)
+	if err != nil || id <= 0 || strconv.FormatInt(id, 10) != rest {
+		return 0, fmt.Errorf("server id %q has no instance id after %q", serverID, prefix)
+	}
+	return id, nil
+}
+
+// CapacityReport answers "can more worlds start?": instance counts, the
+// memory promised to running containers against host memory, free disk
+// under the instance and archive roots, and start slot usage.
+type CapacityReport struct {
+	TotalInstances   int `json:"total_instances"`
+	RunningInstances int `json:"running_instances"`
+	// RunningHeapMB sums mem_limit over running instances; those without a
+	// limit are counted in UnlimitedRunning instead.
+	RunningHeapMB    int64  `json:"running_heap_mb"`
+	UnlimitedRunning int    `json:"unlimited_running"`
+	HostMemoryMB     int64  `json:"host_memory_mb"`
+	InstanceDiskFree uint64 `json:"instance_disk_free"`
+	ArchiveDiskFree  uint64 `json:"archive_disk_free"`
+	StartSlotsInUse  int    `json:"start_slots_in_use"`
+	StartSlotsTotal  int    `json:"start_slots_total"`
+}
+
+// SelfTestCycle describes one throwaway create -> start -> archive -> delete run.
+type SelfTestCycle struct {
+	Alias       string
+	OwnerID     int64
+	GameVersion string
+	// Cleanup purges the archived instance (files and row) once the cycle passes.
+	Cleanup bool
+}
+
+type SelfTestStep struct {
+	Name     string
+	Duration time.Duration
+	Err      error
+}
+
+type SelfTestReport struct {
+	InstanceID int64
+	Steps      []SelfTestStep
+}
+
+func (r SelfTestReport) Passed() bool {
+	for _, s := range r.Steps {
+		if s.Err != nil {
+			return false
+		}
+	}
+	return len(r.Steps) > 0
+}
+
+func (r SelfTestReport) Summary() string {
+	parts := make([]string, 0, len(r.Steps))
+	for _, s := range r.Steps {
+		if s.Err != nil {
+			parts = append(parts, fmt.Sprintf("%s=fail(%s): %v", s.Name, s.Duration.Round(time.Millisecond), s.Err))
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s=ok(%s)", s.Name, s.Duration.Round(time.Millisecond)))
+	}
+	return strings.Join(parts, ", ")
 }
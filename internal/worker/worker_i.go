@@ -2,34 +2,67 @@ package worker
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/gzip"
 	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"text/template"
 	"time"
+	"unicode/utf8"
 
 	"mcmm/internal/log"
+	"mcmm/internal/metrics"
 	"mcmm/internal/pgsql"
 	"mcmm/internal/servertap"
+
+	"gopkg.in/yaml.v3"
 )
 
-const serverTapReadyMaxRetries = 5
-const serverTapCommandMaxRetries = 3
+const serverTapReadyPollInterval = time.Second
+const instanceReadyTimeout = 45 * time.Second
 const serverTapRetryDelay = 5 * time.Second
+const defaultServerTapMaxRetries = 3
+const defaultServerTapRetryMaxDelay = 30 * time.Second
 const failInstanceUpdateTimeout = 3 * time.Second
 const fixedInstanceNetworkName = "mcmultiverse-manager_mcmm-network"
+const multiverseDetachTimeout = 10 * time.Second
+const defaultPreStopTimeout = 30 * time.Second
+const defaultStartRetryBackoff = 15 * time.Second
+const maxCommandOutputBytes = 4096
+const instanceTapConfigName = "servertap-config.yml"
+const serverPropertiesName = "server.properties"
+const instanceGamePort = 25565
+const defaultHookTimeout = 30 * time.Second
 
 type WorkerI struct {
-	repos  pgsql.Repos
-	opts   Options
-	logger interface {
+	repos    pgsql.Repos
+	opts     Options
+	startSem chan struct{}
+	jobsMu   sync.Mutex
+	lastJob  int64
+	jobs     map[int64]JobInfo
+	queued   map[int64]JobInfo
+	runCmd   func(ctx context.Context, bin string, args ...string) (string, error)
+	sleep    func(ctx context.Context, d time.Duration) error
+	diskFree func(path string) (uint64, error)
+	hostMem  func() (int64, error)
+	authMu   sync.RWMutex // guards opts.ServerTapAuthName/ServerTapAuthKey
+	portMu   sync.Mutex   // serializes host port allocation
+	hooks    sync.WaitGroup
+	logger   interface {
 		Infof(string, ...any)
 		Warnf(string, ...any)
 		Errorf(string, ...any)
@@ -43,6 +76,9 @@ func NewWorkerI(repos pgsql.Repos, opts Options) (*WorkerI, error) {
 	if opts.ArchiveRootDir == "" {
 		opts.ArchiveRootDir = "deploy/archived"
 	}
+	if opts.StagingRootDir == "" {
+		opts.StagingRootDir = filepath.Join(filepath.Dir(filepath.Clean(opts.InstanceRootDir)), "staging")
+	}
 	if opts.DefaultGameVersion == "" {
 		opts.DefaultGameVersion = "1.21.1"
 	}
@@ -62,17 +98,208 @@ func NewWorkerI(repos pgsql.Repos, opts Options) (*WorkerI, error) {
 	if strings.TrimSpace(opts.BootstrapAdminName) == "" {
 		opts.BootstrapAdminName = "LCMonitor"
 	}
+	var startSem chan struct{}
+	if opts.MaxConcurrentStarts > 0 {
+		startSem = make(chan struct{}, opts.MaxConcurrentStarts)
+	}
+	if opts.StartMaxAttempts <= 0 {
+		opts.StartMaxAttempts = 1
+	}
+	if opts.StartRetryBackoff <= 0 {
+		opts.StartRetryBackoff = defaultStartRetryBackoff
+	}
+	if opts.ServerTapMaxRetries <= 0 {
+		opts.ServerTapMaxRetries = defaultServerTapMaxRetries
+	}
+	if opts.ServerTapRetryBaseDelay <= 0 {
+		opts.ServerTapRetryBaseDelay = serverTapRetryDelay
+	}
+	if opts.ServerTapRetryMaxDelay <= 0 {
+		opts.ServerTapRetryMaxDelay = defaultServerTapRetryMaxDelay
+	}
+	if opts.ServerTapRetryMaxDelay < opts.ServerTapRetryBaseDelay {
+		opts.ServerTapRetryMaxDelay = opts.ServerTapRetryBaseDelay
+	}
+	if opts.PreStopTimeout <= 0 {
+		opts.PreStopTimeout = defaultPreStopTimeout
+	}
+	if opts.PostCreateHookTimeout <= 0 {
+		opts.PostCreateHookTimeout = defaultHookTimeout
+	}
+	if opts.PreDestroyHookTimeout <= 0 {
+		opts.PreDestroyHookTimeout = defaultHookTimeout
+	}
 	if opts.Now == nil {
 		opts.Now = Now
 	}
 	return &WorkerI{
-		repos:  repos,
-		opts:   opts,
-		logger: log.Component("worker"),
+		repos:    repos,
+		opts:     opts,
+		startSem: startSem,
+		jobs:     make(map[int64]JobInfo),
+		queued:   make(map[int64]JobInfo),
+		runCmd:   runCmd,
+		sleep:    sleepCtx,
+		diskFree: statfsFree,
+		hostMem:  procMemTotalMB,
+		logger:   log.Component("worker"),
+	}, nil
+}
+
+// Snapshot reports running jobs, start slot usage and starts waiting for a slot.
+func (w *WorkerI) Snapshot() StateSnapshot {
+	w.jobsMu.Lock()
+	defer w.jobsMu.Unlock()
+	snap := StateSnapshot{
+		Jobs:            make([]JobInfo, 0, len(w.jobs)),
+		StartSlotsInUse: len(w.startSem),
+		StartSlotsTotal: cap(w.startSem),
+		QueuedStarts:    make([]JobInfo, 0, len(w.queued)),
+	}
+	for _, j := range w.jobs {
+		snap.Jobs = append(snap.Jobs, j)
+	}
+	for _, j := range w.queued {
+		snap.QueuedStarts = append(snap.QueuedStarts, j)
+	}
+	sortJobs(snap.Jobs)
+	sortJobs(snap.QueuedStarts)
+	return snap
+}
+
+// Capacity counts non-archived and running instances, sums the memory limits
+// of running ones and reads host memory and free disk. A missing archive
+// root reports zero free space rather than failing.
+func (w *WorkerI) Capacity(ctx context.Context) (CapacityReport, error) {
+	instances, err := w.repos.MapInstance.List(ctx)
+	if err != nil {
+		return CapacityReport{}, fmt.Errorf("list instances: %w", err)
+	}
+	snap := w.Snapshot()
+	report := CapacityReport{StartSlotsInUse: snap.StartSlotsInUse, StartSlotsTotal: snap.StartSlotsTotal}
+	for _, inst := range instances {
+		if Status(inst.Status) == StatusArchived {
+			continue
+		}
+		report.TotalInstances++
+		if Status(inst.Status) != StatusOn {
+			continue
+		}
+		report.RunningInstances++
+		if mem := w.memLimitFor(inst); mem > 0 {
+			report.RunningHeapMB += int64(mem)
+		} else {
+			report.UnlimitedRunning++
+		}
+	}
+	if report.HostMemoryMB, err = w.hostMem(); err != nil {
+		return CapacityReport{}, fmt.Errorf("read host memory: %w", err)
+	}
+	if report.InstanceDiskFree, err = w.diskFree(w.opts.InstanceRootDir); err != nil {
+		return CapacityReport{}, fmt.Errorf("statfs %s: %w", w.opts.InstanceRootDir, err)
+	}
+	report.ArchiveDiskFree, err = w.diskFree(w.opts.ArchiveRootDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return CapacityReport{}, fmt.Errorf("statfs %s: %w", w.opts.ArchiveRootDir, err)
+	}
+	return report, nil
+}
+
+// statfsFree is the space available to unprivileged users on path's filesystem.
+func statfsFree(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, &os.PathError{Op: "statfs", Path: path, Err: err}
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
+
+// procMemTotalMB reads MemTotal from /proc/meminfo.
+func procMemTotalMB() (int64, error) {
+	data, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("parse MemTotal: %w", err)
+			}
+			return kb / 1024, nil
+		}
+	}
+	return 0, errors.New("MemTotal not found in /proc/meminfo")
+}
+
+func (w *WorkerI) beginJob(instanceID int64, op string) func() {
+	_, done := w.trackJob(w.jobs, instanceID, op)
+	return done
+}
+
+// trackJob lists op in set under a fresh job id until done is called, so two
+// operations on the same instance (a stop racing a start) are both visible.
+func (w *WorkerI) trackJob(set map[int64]JobInfo, instanceID int64, op string) (int64, func()) {
+	w.jobsMu.Lock()
+	w.lastJob++
+	id := w.lastJob
+	set[id] = JobInfo{ID: id, InstanceID: instanceID, Operation: op, StartedAt: w.opts.Now()}
+	w.jobsMu.Unlock()
+	return id, func() {
+		w.jobsMu.Lock()
+		delete(set, id)
+		w.jobsMu.Unlock()
+	}
+}
+
+// acquireStartSlot registers a start job and returns its id. With
+// MaxConcurrentStarts set it first blocks until a start slot is free, the
+// instance being listed as queued while it waits; otherwise it never waits.
+func (w *WorkerI) acquireStartSlot(ctx context.Context, instanceID int64, op string) (int64, func(), error) {
+	if w.startSem == nil {
+		id, done := w.trackJob(w.jobs, instanceID, op)
+		return id, done, nil
+	}
+	_, dequeue := w.trackJob(w.queued, instanceID, op)
+	select {
+	case w.startSem <- struct{}{}:
+		dequeue()
+	case <-ctx.Done():
+		dequeue()
+		return 0, nil, fmt.Errorf("wait start slot: %w", ctx.Err())
+	}
+	id, done := w.trackJob(w.jobs, instanceID, op)
+	return id, func() {
+		done()
+		<-w.startSem
 	}, nil
 }
 
-func (w *WorkerI) StartFromTemplate(ctx context.Context, instanceID int64, template pgsql.MapTemplate) error {
+func (w *WorkerI) countOp(op string, err error) {
+	w.opts.Metrics.IncResult(metrics.WorkerOperations, metrics.Labels{"op": op}, err)
+}
+
+func (w *WorkerI) setJobAttempt(jobID int64, attempt int) {
+	w.jobsMu.Lock()
+	defer w.jobsMu.Unlock()
+	if j, ok := w.jobs[jobID]; ok {
+		j.Attempt = attempt
+		w.jobs[jobID] = j
+	}
+}
+
+func sortJobs(jobs []JobInfo) {
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].StartedAt.Equal(jobs[j].StartedAt) {
+			return jobs[i].StartedAt.Before(jobs[j].StartedAt)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+}
+
+func (w *WorkerI) StartFromTemplate(ctx context.Context, instanceID int64, template pgsql.MapTemplate) (err error) {
+	defer func() { w.countOp("start", err) }()
 	inst, err := w.repos.MapInstance.Read(ctx, instanceID)
 	if err != nil {
 		w.failInstanceByID(instanceID, fmt.Sprintf("read instance: %v", err))
@@ -88,7 +315,8 @@ func (w *WorkerI) StartFromTemplate(ctx context.Context, instanceID int64, templ
 	return w.runStartFlow(ctx, inst, version, template.BlobPath)
 }
 
-func (w *WorkerI) StartFromUpload(ctx context.Context, instanceID int64, uploadWorldPath string) error {
+func (w *WorkerI) StartFromUpload(ctx context.Context, instanceID int64, uploadWorldPath string) (err error) {
+	defer func() { w.countOp("start", err) }()
 	inst, err := w.repos.MapInstance.Read(ctx, instanceID)
 	if err != nil {
 		w.failInstanceByID(instanceID, fmt.Sprintf("read instance: %v", err))
@@ -101,7 +329,8 @@ func (w *WorkerI) StartFromUpload(ctx context.Context, instanceID int64, uploadW
 	return w.runStartFlow(ctx, inst, version, uploadWorldPath)
 }
 
-func (w *WorkerI) StartEmpty(ctx context.Context, instanceID int64, gameVersion string) error {
+func (w *WorkerI) StartEmpty(ctx context.Context, instanceID int64, gameVersion string) (err error) {
+	defer func() { w.countOp("start", err) }()
 	inst, err := w.repos.MapInstance.Read(ctx, instanceID)
 	if err != nil {
 		w.failInstanceByID(instanceID, fmt.Sprintf("read instance: %v", err))
@@ -113,7 +342,53 @@ func (w *WorkerI) StartEmpty(ctx context.Context, instanceID int64, gameVersion
 	return w.runStartFlow(ctx, inst, gameVersion, "")
 }
 
-func (w *WorkerI) StartExisting(ctx context.Context, instanceID int64) error {
+// Provision prepares the volume and compose file of a new instance and parks
+// it in Off without starting the container; StartExisting brings it up later.
+// An empty gameVersion falls back to the instance row, then the default.
+func (w *WorkerI) Provision(ctx context.Context, instanceID int64, gameVersion string, sourceWorldPath string) (err error) {
+	defer func() { w.countOp("provision", err) }()
+	inst, err := w.repos.MapInstance.Read(ctx, instanceID)
+	if err != nil {
+		w.failInstanceByID(instanceID, fmt.Sprintf("read instance: %v", err))
+		return fmt.Errorf("read instance: %w", err)
+	}
+	if strings.TrimSpace(gameVersion) == "" {
+		gameVersion = inst.GameVersion
+	}
+	if gameVersion == "" || gameVersion == "unknown" {
+		gameVersion = w.opts.DefaultGameVersion
+	}
+	defer w.beginJob(inst.ID, "provision")()
+	if err := w.setStatus(ctx, &inst, StatusPreparing); err != nil {
+		return err
+	}
+	if err := w.prepareInstanceVolume(inst.ID, sourceWorldPath); err != nil {
+		_ = w.failInstance(ctx, &inst, fmt.Sprintf("prepare instance volume: %v", err))
+		return err
+	}
+	if err := w.prepareInstanceTapConfig(&inst); err != nil {
+		_ = w.failInstance(ctx, &inst, fmt.Sprintf("prepare servertap key: %v", err))
+		return err
+	}
+	if err := w.prepareServerProperties(inst.ID, serverPropertiesOf(inst)); err != nil {
+		_ = w.failInstance(ctx, &inst, fmt.Sprintf("prepare server.properties: %v", err))
+		return err
+	}
+	if err := w.assignHostPort(ctx, &inst); err != nil {
+		_ = w.failInstance(ctx, &inst, fmt.Sprintf("assign host port: %v", err))
+		return err
+	}
+	if err := w.prepareComposeFile(inst, gameVersion); err != nil {
+		_ = w.failInstance(ctx, &inst, fmt.Sprintf("prepare compose: %v", err))
+		return err
+	}
+	inst.GameVersion = gameVersion
+	inst.LastErrorMsg = sql.NullString{}
+	return w.setStatus(ctx, &inst, StatusOff)
+}
+
+func (w *WorkerI) StartExisting(ctx context.Context, instanceID int64) (err error) {
+	defer func() { w.countOp("start_existing", err) }()
 	inst, err := w.repos.MapInstance.Read(ctx, instanceID)
 	if err != nil {
 		w.failInstanceByID(instanceID, fmt.Sprintf("read instance: %v", err))
@@ -122,15 +397,21 @@ func (w *WorkerI) StartExisting(ctx context.Context, instanceID int64) error {
 	if Status(inst.Status) == StatusOn {
 		return nil
 	}
+	_, release, err := w.acquireStartSlot(ctx, inst.ID, "start_existing")
+	if err != nil {
+		return err
+	}
+	defer release()
 	if err := w.setStatus(ctx, &inst, StatusStarting); err != nil {
 		_ = w.failInstance(ctx, &inst, fmt.Sprintf("set starting: %v", err))
 		return err
 	}
-	if err := w.startCompose(ctx, inst.ID); err != nil {
+	out, err := w.startCompose(ctx, inst.ID)
+	recordComposeOutput(&inst, out)
+	if err != nil {
 		_ = w.failInstance(ctx, &inst, fmt.Sprintf("start compose: %v", err))
 		return err
 	}
-	time.Sleep(10 * time.Second)
 	if err := w.configureInstanceAccess(ctx, inst); err != nil {
 		_ = w.failInstance(ctx, &inst, fmt.Sprintf("configure access: %v", err))
 		return err
@@ -142,7 +423,85 @@ func (w *WorkerI) StartExisting(ctx context.Context, instanceID int64) error {
 	return w.setStatus(ctx, &inst, StatusOn)
 }
 
-func (w *WorkerI) StopOnly(ctx context.Context, instanceID int64) error {
+// RestartCount is how often docker restarted the instance container on its
+// own (restart: unless-stopped) since compose last created it.
+func (w *WorkerI) RestartCount(ctx context.Context, instanceID int64) (int, error) {
+	out, err := w.runCmd(ctx, "docker", "inspect", "-f", "{{.RestartCount}}", containerName(instanceID))
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(out))
+	if err != nil {
+		return 0, fmt.Errorf("parse restart count %q: %w", out, err)
+	}
+	return n, nil
+}
+
+// ReconfigureAccess re-applies whitelist and op to an On instance whose
+// container came back from a crash without the manager, and records it
+// healthy. A failure is recorded as the health status but leaves it On.
+// The result is only written if the instance is still On afterwards.
+func (w *WorkerI) ReconfigureAccess(ctx context.Context, instanceID int64) (err error) {
+	defer func() { w.countOp("reconfigure", err) }()
+	inst, err := w.repos.MapInstance.Read(ctx, instanceID)
+	if err != nil {
+		return err
+	}
+	if Status(inst.Status) != StatusOn {
+		return fmt.Errorf("instance %d is %s, not On", instanceID, inst.Status)
+	}
+	defer w.beginJob(inst.ID, "reconfigure")()
+	accessErr := w.configureInstanceAccess(ctx, inst)
+	// Waiting for the server and replaying access can take most of a minute;
+	// re-read so a stop or archive that landed meanwhile is not written over.
+	cur, err := w.repos.MapInstance.Read(ctx, instanceID)
+	if err != nil {
+		return err
+	}
+	if Status(cur.Status) != StatusOn {
+		w.logger.Infof("instance=%d became %s during reconfigure, not recording health", instanceID, cur.Status)
+		return accessErr
+	}
+	cur.LastHealthAt = toNullTime(w.opts.Now())
+	if accessErr != nil {
+		cur.HealthStatus = string(healthForCode(ClassifyErr(accessErr)))
+		cur.LastErrorMsg = sql.NullString{String: fmt.Sprintf("reconfigure after restart: %v", accessErr), Valid: true}
+		_ = w.repos.MapInstance.Update(ctx, cur)
+		return accessErr
+	}
+	cur.HealthStatus = string(HealthHealthy)
+	cur.LastErrorMsg = sql.NullString{}
+	return w.repos.MapInstance.Update(ctx, cur)
+}
+
+// RefreshMultiverseAlias points the Multiverse alias of a running instance at
+// its current alias after a rename. It does nothing unless MultiverseImport
+// is set or when the instance is not On.
+func (w *WorkerI) RefreshMultiverseAlias(ctx context.Context, instanceID int64) error {
+	if !w.opts.MultiverseImport {
+		return nil
+	}
+	inst, err := w.repos.MapInstance.Read(ctx, instanceID)
+	if err != nil {
+		return err
+	}
+	if Status(inst.Status) != StatusOn {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, multiverseDetachTimeout)
+	defer cancel()
+	conn, err := w.newInstanceConnector(inst)
+	if err != nil {
+		return err
+	}
+	if _, err := servertap.NewServiceC(conn).MVSetAlias(ctx, MultiverseWorldName(inst.ID), inst.Alias); err != nil {
+		return fmt.Errorf("multiverse alias: %w", err)
+	}
+	return nil
+}
+
+func (w *WorkerI) StopOnly(ctx context.Context, instanceID int64) (err error) {
+	defer func() { w.countOp("stop", err) }()
 	inst, err := w.repos.MapInstance.Read(ctx, instanceID)
 	if err != nil {
 		w.failInstanceByID(instanceID, fmt.Sprintf("read instance: %v", err))
@@ -151,29 +510,51 @@ func (w *WorkerI) StopOnly(ctx context.Context, instanceID int64) error {
 	if Status(inst.Status) == StatusOff {
 		return nil
 	}
+	defer w.beginJob(inst.ID, "stop")()
+	wasOn := Status(inst.Status) == StatusOn
+	if wasOn {
+		w.detachMultiverseWorld(ctx, inst, false)
+	}
 	if err := w.setStatus(ctx, &inst, StatusStopping); err != nil {
 		_ = w.failInstance(ctx, &inst, fmt.Sprintf("set stopping: %v", err))
 		return err
 	}
-	if err := w.stopCompose(ctx, inst.ID); err != nil {
+	if wasOn {
+		w.stopServerGracefully(ctx, inst)
+	}
+	if out, err := w.stopCompose(ctx, inst.ID); err != nil {
+		recordComposeOutput(&inst, out)
 		_ = w.failInstance(ctx, &inst, fmt.Sprintf("stop compose: %v", err))
 		return err
 	}
 	return w.setStatus(ctx, &inst, StatusOff)
 }
 
-func (w *WorkerI) StopAndArchive(ctx context.Context, instanceID int64) error {
+func (w *WorkerI) StopAndArchive(ctx context.Context, instanceID int64) (err error) {
+	defer func() { w.countOp("stop_archive", err) }()
 	inst, err := w.repos.MapInstance.Read(ctx, instanceID)
 	if err != nil {
 		w.failInstanceByID(instanceID, fmt.Sprintf("read instance: %v", err))
 		return fmt.Errorf("read instance: %w", err)
 	}
+	defer w.beginJob(inst.ID, "stop_archive")()
+	if err := w.runPreDestroyHook(ctx, inst, "archive"); err != nil {
+		return err
+	}
+	wasOn := Status(inst.Status) == StatusOn
+	if wasOn {
+		w.detachMultiverseWorld(ctx, inst, true)
+	}
 
 	if err := w.setStatus(ctx, &inst, StatusStopping); err != nil {
 		_ = w.failInstance(ctx, &inst, fmt.Sprintf("set stopping: %v", err))
 		return err
 	}
-	if err := w.stopCompose(ctx, inst.ID); err != nil {
+	if wasOn {
+		w.stopServerGracefully(ctx, inst)
+	}
+	if out, err := w.stopCompose(ctx, inst.ID); err != nil {
+		recordComposeOutput(&inst, out)
 		_ = w.failInstance(ctx, &inst, fmt.Sprintf("stop compose: %v", err))
 		return err
 	}
@@ -187,6 +568,7 @@ func (w *WorkerI) StopAndArchive(ctx context.Context, instanceID int64) error {
 	}
 
 	inst.ArchivedAt = toNullTime(w.opts.Now())
+	inst.PruneNoticeAt = sql.NullTime{}
 	if err := w.setStatus(ctx, &inst, StatusArchived); err != nil {
 		_ = w.failInstance(ctx, &inst, fmt.Sprintf("set archived: %v", err))
 		return err
@@ -194,7 +576,8 @@ func (w *WorkerI) StopAndArchive(ctx context.Context, instanceID int64) error {
 	return nil
 }
 
-func (w *WorkerI) DeleteArchived(ctx context.Context, instanceID int64) error {
+func (w *WorkerI) DeleteArchived(ctx context.Context, instanceID int64) (err error) {
+	defer func() { w.countOp("purge", err) }()
 	inst, err := w.repos.MapInstance.Read(ctx, instanceID)
 	if err != nil {
 		w.failInstanceByID(instanceID, fmt.Sprintf("read instance: %v", err))
@@ -203,38 +586,244 @@ func (w *WorkerI) DeleteArchived(ctx context.Context, instanceID int64) error {
 	if Status(inst.Status) != StatusArchived {
 		return fmt.Errorf("instance %d is not archived (status=%s)", instanceID, inst.Status)
 	}
-	archiveDir := w.archiveDirPath(instanceID)
-	_ = os.RemoveAll(archiveDir)
-	_ = os.RemoveAll(instanceDir(w.opts.InstanceRootDir, instanceID))
+	defer w.beginJob(inst.ID, "purge")()
+	if err := w.runPreDestroyHook(ctx, inst, "delete"); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(w.archiveDirPath(instanceID)); err != nil {
+		return fmt.Errorf("remove archive dir: %w", err)
+	}
+	if err := os.RemoveAll(instanceDir(w.opts.InstanceRootDir, instanceID)); err != nil {
+		return fmt.Errorf("remove instance dir: %w", err)
+	}
+	// Members cascade; user_requests keep their history with a NULL target.
+	if err := w.repos.MapInstance.Delete(ctx, instanceID); err != nil {
+		return fmt.Errorf("delete instance row: %w", err)
+	}
+	w.logger.Infof("instance=%d purged (archive, files and row removed)", instanceID)
 	return nil
 }
 
-func (w *WorkerI) runStartFlow(ctx context.Context, inst pgsql.MapInstance, gameVersion string, sourceWorldPath string) error {
+// PruneArchives purges archived instances oldest first until their archive
+// directories together use at most maxBytes. Pinned archives are skipped, so
+// usage can stay above the cap. An archive is not purged the first time it is
+// picked: it gets a prune notice, warn (when set) tells the owner, and it is
+// only purged by a pass at least notice later. Archives no longer needed to
+// get under the cap lose their notice. A non-positive maxBytes disables
+// pruning.
+func (w *WorkerI) PruneArchives(ctx context.Context, maxBytes int64, notice time.Duration, warn func(ctx context.Context, inst pgsql.MapInstance, size int64, deleteAfter time.Time)) ([]int64, error) {
+	if maxBytes <= 0 {
+		return nil, nil
+	}
+	archived, err := w.repos.MapInstance.ListArchived(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list archived: %w", err)
+	}
+	sizes := make([]int64, len(archived))
+	var total int64
+	for i, inst := range archived {
+		size, err := dirSize(w.archiveDirPath(inst.ID))
+		if err != nil {
+			return nil, fmt.Errorf("measure archive of instance %d: %w", inst.ID, err)
+		}
+		sizes[i] = size
+		total += size
+	}
+	now := w.opts.Now()
+	var pruned []int64
+	var errs []error
+	// total counts archives with a pending notice as already freed, so only
+	// as many archives as the cap needs are picked.
+	for i, inst := range archived {
+		if total <= maxBytes || inst.ArchivePinned {
+			if inst.PruneNoticeAt.Valid {
+				inst.PruneNoticeAt = sql.NullTime{}
+				if err := w.repos.MapInstance.Update(ctx, inst); err != nil {
+					errs = append(errs, fmt.Errorf("instance %d: clear prune notice: %w", inst.ID, err))
+				}
+			}
+			continue
+		}
+		if !inst.PruneNoticeAt.Valid {
+			inst.PruneNoticeAt = toNullTime(now)
+			if err := w.repos.MapInstance.Update(ctx, inst); err != nil {
+				errs = append(errs, fmt.Errorf("instance %d: record prune notice: %w", inst.ID, err))
+				continue
+			}
+			w.logger.Infof("instance=%d archive (%d bytes) will be pruned after %s", inst.ID, sizes[i], now.Add(notice).Format(time.RFC3339))
+			if warn != nil {
+				warn(ctx, inst, sizes[i], now.Add(notice))
+			}
+		}
+		total -= sizes[i]
+		if now.Sub(inst.PruneNoticeAt.Time) < notice {
+			continue
+		}
+		if err := w.DeleteArchived(ctx, inst.ID); err != nil {
+			errs = append(errs, fmt.Errorf("instance %d: %w", inst.ID, err))
+			total += sizes[i]
+			continue
+		}
+		pruned = append(pruned, inst.ID)
+		w.logger.Infof("instance=%d archive pruned (%d bytes), usage now %d/%d bytes", inst.ID, sizes[i], total, maxBytes)
+	}
+	if total > maxBytes {
+		w.logger.Warnf("archive usage %d bytes still over cap %d bytes (pinned or failed archives)", total, maxBytes)
+	}
+	return pruned, errors.Join(errs...)
+}
+
+// RestoreArchived moves an archived world back into the instance root and
+// leaves the instance Off so it can be started with StartExisting.
+func (w *WorkerI) RestoreArchived(ctx context.Context, instanceID int64) (err error) {
+	defer func() { w.countOp("restore", err) }()
+	inst, err := w.repos.MapInstance.Read(ctx, instanceID)
+	if err != nil {
+		return fmt.Errorf("read instance: %w", err)
+	}
+	if Status(inst.Status) != StatusArchived {
+		return fmt.Errorf("instance %d is not archived (status=%s)", instanceID, inst.Status)
+	}
+	archiveDir := w.archiveDirPath(instanceID)
+	if !isDir(archiveDir) {
+		return fmt.Errorf("instance %d: %w", instanceID, ErrArchiveMissing)
+	}
+	dst := instanceDir(w.opts.InstanceRootDir, instanceID)
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("instance %d: instance dir already exists: %s", instanceID, dst)
+	}
+	defer w.beginJob(inst.ID, "restore")()
+
 	if err := w.setStatus(ctx, &inst, StatusPreparing); err != nil {
-		_ = w.failInstance(ctx, &inst, fmt.Sprintf("set preparing: %v", err))
 		return err
 	}
-	if err := w.prepareInstanceVolume(inst.ID, sourceWorldPath); err != nil {
-		_ = w.failInstance(ctx, &inst, fmt.Sprintf("prepare instance volume: %v", err))
+	if err := os.MkdirAll(w.opts.InstanceRootDir, 0o755); err != nil {
+		w.revertToArchived(ctx, &inst, fmt.Sprintf("mkdir instance root: %v", err))
 		return err
 	}
-	if err := w.prepareComposeFile(inst.ID, gameVersion); err != nil {
-		_ = w.failInstance(ctx, &inst, fmt.Sprintf("prepare compose: %v", err))
+	if err := moveDir(archiveDir, dst); err != nil {
+		w.revertToArchived(ctx, &inst, fmt.Sprintf("restore world: %v", err))
 		return err
 	}
-	if err := w.setStatus(ctx, &inst, StatusStarting); err != nil {
-		_ = w.failInstance(ctx, &inst, fmt.Sprintf("set starting: %v", err))
+	w.logger.Infof("instance=%d restored from %s", instanceID, archiveDir)
+
+	// Archiving released the host port; another instance may hold it now, and
+	// StartExisting reuses the restored compose file as is.
+	oldPort := inst.HostPort
+	if err := w.assignHostPort(ctx, &inst); err != nil {
+		_ = w.failInstance(ctx, &inst, fmt.Sprintf("assign host port: %v", err))
 		return err
 	}
-	if err := w.startCompose(ctx, inst.ID); err != nil {
-		_ = w.failInstance(ctx, &inst, fmt.Sprintf("start compose: %v", err))
+	if inst.HostPort != oldPort {
+		if err := w.prepareComposeFile(inst, inst.GameVersion); err != nil {
+			_ = w.failInstance(ctx, &inst, fmt.Sprintf("render compose: %v", err))
+			return err
+		}
+	}
+
+	inst.ArchivedAt = toNullTimeZero()
+	if err := w.setStatus(ctx, &inst, StatusOff); err != nil {
+		_ = w.failInstance(ctx, &inst, fmt.Sprintf("set off: %v", err))
 		return err
 	}
-	time.Sleep(10 * time.Second)
-	if err := w.configureInstanceAccess(ctx, inst); err != nil {
-		_ = w.failInstance(ctx, &inst, fmt.Sprintf("configure access: %v", err))
+	return nil
+}
+
+// SwitchVersion moves an Off or On instance onto gameVersion: a running
+// instance is stopped, the compose file is regenerated for the new runtime
+// and the instance is started again with StartExisting.
+func (w *WorkerI) SwitchVersion(ctx context.Context, instanceID int64, gameVersion string) (err error) {
+	defer func() { w.countOp("switch_version", err) }()
+	inst, err := w.repos.MapInstance.Read(ctx, instanceID)
+	if err != nil {
+		return fmt.Errorf("read instance: %w", err)
+	}
+	switch Status(inst.Status) {
+	case StatusOn:
+		if err := w.StopOnly(ctx, instanceID); err != nil {
+			return fmt.Errorf("stop before version switch: %w", err)
+		}
+		if inst, err = w.repos.MapInstance.Read(ctx, instanceID); err != nil {
+			return fmt.Errorf("read instance: %w", err)
+		}
+	case StatusOff:
+	default:
+		return fmt.Errorf("instance %d cannot switch version (status=%s)", instanceID, inst.Status)
+	}
+	if err := w.prepareInstanceTapConfig(&inst); err != nil {
+		_ = w.failInstance(ctx, &inst, fmt.Sprintf("prepare servertap key: %v", err))
+		return err
+	}
+	if err := w.prepareServerProperties(inst.ID, serverPropertiesOf(inst)); err != nil {
+		_ = w.failInstance(ctx, &inst, fmt.Sprintf("prepare server.properties: %v", err))
+		return err
+	}
+	if err := w.assignHostPort(ctx, &inst); err != nil {
+		_ = w.failInstance(ctx, &inst, fmt.Sprintf("assign host port: %v", err))
+		return err
+	}
+	if err := w.prepareComposeFile(inst, gameVersion); err != nil {
+		_ = w.failInstance(ctx, &inst, fmt.Sprintf("prepare compose for %s: %v", gameVersion, err))
 		return err
 	}
+	w.logger.Infof("instance=%d game version %s -> %s", inst.ID, inst.GameVersion, gameVersion)
+	inst.GameVersion = gameVersion
+	if err := w.repos.MapInstance.Update(ctx, inst); err != nil {
+		return fmt.Errorf("update game version: %w", err)
+	}
+	return w.StartExisting(ctx, instanceID)
+}
+
+// revertToArchived puts a failed restore back into Archived so the cron purge
+// and a later retry still see it; failInstance would strand it as Off.
+func (w *WorkerI) revertToArchived(ctx context.Context, inst *pgsql.MapInstance, reason string) {
+	w.logger.Errorf("instance=%d restore failed: %s", inst.ID, reason)
+	inst.Status = string(StatusArchived)
+	inst.LastErrorMsg = sql.NullString{String: reason, Valid: true}
+	inst.UpdatedAt = w.opts.Now()
+	dbCtx, cancel := context.WithTimeout(context.Background(), failInstanceUpdateTimeout)
+	defer cancel()
+	if err := w.repos.MapInstance.Update(dbCtx, *inst); err != nil {
+		w.logger.Errorf("instance=%d revert-to-archived update error: %v", inst.ID, err)
+	}
+}
+
+// runStartFlow prepares and starts an instance, retrying the whole sequence
+// up to StartMaxAttempts times when a step fails for a retryable reason.
+func (w *WorkerI) runStartFlow(ctx context.Context, inst pgsql.MapInstance, gameVersion string, sourceWorldPath string) error {
+	jobID, release, err := w.acquireStartSlot(ctx, inst.ID, "start")
+	if err != nil {
+		return err
+	}
+	defer release()
+	maxAttempts := w.opts.StartMaxAttempts
+	for attempt := 1; ; attempt++ {
+		w.setJobAttempt(jobID, attempt)
+		err := w.startAttempt(ctx, &inst, gameVersion, sourceWorldPath)
+		if err == nil {
+			break
+		}
+		var stepErr *startStepError
+		retryable := errors.As(err, &stepErr) && stepErr.retryable
+		if !retryable || attempt >= maxAttempts || ctx.Err() != nil {
+			reason := err.Error()
+			if attempt > 1 {
+				reason = fmt.Sprintf("%s (after %d attempts)", reason, attempt)
+			}
+			_ = w.failInstance(ctx, &inst, reason)
+			return err
+		}
+		backoff := w.opts.StartRetryBackoff * time.Duration(attempt)
+		w.logger.Warnf("instance=%d start attempt %d/%d failed, retrying in %s: %v", inst.ID, attempt, maxAttempts, backoff, err)
+		if err := w.resetForStartRetry(ctx, &inst, attempt, maxAttempts, err); err != nil {
+			_ = w.failInstance(ctx, &inst, fmt.Sprintf("reset for retry: %v", err))
+			return err
+		}
+		if err := w.sleep(ctx, backoff); err != nil {
+			_ = w.failInstance(ctx, &inst, fmt.Sprintf("wait start retry: %v", err))
+			return err
+		}
+	}
 
 	inst.GameVersion = gameVersion
 	inst.ArchivedAt = toNullTimeZero()
@@ -246,34 +835,238 @@ func (w *WorkerI) runStartFlow(ctx context.Context, inst pgsql.MapInstance, game
 		_ = w.failInstance(ctx, &inst, fmt.Sprintf("set on: %v", err))
 		return err
 	}
+	w.runPostCreateHook(inst)
+	return nil
+}
+
+// runPostCreateHook runs the configured hook in the background once a new
+// instance is On, as `<hook> <instance_id> <alias> <game_version> <owner_id>
+// <host_port>`. Its output is only logged; a failure or timeout never
+// affects the instance.
+func (w *WorkerI) runPostCreateHook(inst pgsql.MapInstance) {
+	hook := strings.TrimSpace(w.opts.PostCreateHook)
+	if hook == "" {
+		return
+	}
+	args := hookArgs(inst)
+	w.hooks.Add(1)
+	go func() {
+		defer w.hooks.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), w.opts.PostCreateHookTimeout)
+		defer cancel()
+		out, err := w.runCmd(ctx, hook, args...)
+		if err != nil {
+			w.logger.Warnf("instance=%d post-create hook failed: %v output=%q", inst.ID, err, out)
+			return
+		}
+		w.logger.Infof("instance=%d post-create hook done output=%q", inst.ID, out)
+	}()
+}
+
+// WaitHooks waits for running post-create hooks to finish, for shutdown.
+// It returns ctx.Err() if ctx ends first; the hooks are then left to their
+// own timeout.
+func (w *WorkerI) WaitHooks(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		w.hooks.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// hookArgs is the instance metadata passed to operator hooks:
+// <instance_id> <alias> <game_version> <owner_id> <host_port>.
+func hookArgs(inst pgsql.MapInstance) []string {
+	return []string{
+		strconv.FormatInt(inst.ID, 10),
+		inst.Alias,
+		inst.GameVersion,
+		strconv.FormatInt(inst.OwnerID, 10),
+		strconv.Itoa(inst.HostPort),
+	}
+}
+
+// runPreDestroyHook runs the configured hook before an instance is archived
+// or purged, as `<hook> <archive|delete> <instance_id> ...` (see hookArgs),
+// and waits for it up to PreDestroyHookTimeout. A failure is returned only
+// when PreDestroyHookAbort is set; otherwise it is logged and destroy goes on.
+func (w *WorkerI) runPreDestroyHook(ctx context.Context, inst pgsql.MapInstance, op string) error {
+	hook := strings.TrimSpace(w.opts.PreDestroyHook)
+	if hook == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, w.opts.PreDestroyHookTimeout)
+	defer cancel()
+	out, err := w.runCmd(ctx, hook, append([]string{op}, hookArgs(inst)...)...)
+	if err == nil {
+		w.logger.Infof("instance=%d pre-destroy hook (%s) done output=%q", inst.ID, op, out)
+		return nil
+	}
+	if w.opts.PreDestroyHookAbort {
+		return fmt.Errorf("pre-destroy hook: %w", err)
+	}
+	w.logger.Warnf("instance=%d pre-destroy hook (%s) failed, continuing: %v output=%q", inst.ID, op, err, out)
+	return nil
+}
+
+// startStepError tags a start failure with the step that failed and whether
+// repeating the sequence can help. Missing jars/templates never heal on their
+// own; compose and ServerTap reachability often do.
+type startStepError struct {
+	step      string
+	err       error
+	retryable bool
+}
+
+func (e *startStepError) Error() string { return e.step + ": " + e.err.Error() }
+
+func (e *startStepError) Unwrap() error { return e.err }
+
+func (w *WorkerI) startAttempt(ctx context.Context, inst *pgsql.MapInstance, gameVersion string, sourceWorldPath string) error {
+	if err := w.setStatus(ctx, inst, StatusPreparing); err != nil {
+		return &startStepError{step: "set preparing", err: err}
+	}
+	if err := w.prepareInstanceVolume(inst.ID, sourceWorldPath); err != nil {
+		return &startStepError{step: "prepare instance volume", err: err}
+	}
+	if err := w.prepareInstanceTapConfig(inst); err != nil {
+		return &startStepError{step: "prepare servertap key", err: err}
+	}
+	if err := w.prepareServerProperties(inst.ID, serverPropertiesOf(*inst)); err != nil {
+		return &startStepError{step: "prepare server.properties", err: err}
+	}
+	if err := w.assignHostPort(ctx, inst); err != nil {
+		return &startStepError{step: "assign host port", err: err}
+	}
+	if err := w.prepareComposeFile(*inst, gameVersion); err != nil {
+		return &startStepError{step: "prepare compose", err: err}
+	}
+	if err := w.setStatus(ctx, inst, StatusStarting); err != nil {
+		return &startStepError{step: "set starting", err: err}
+	}
+	out, err := w.startCompose(ctx, inst.ID)
+	recordComposeOutput(inst, out)
+	if err != nil {
+		return &startStepError{step: "start compose", err: err, retryable: true}
+	}
+	if err := w.configureInstanceAccess(ctx, *inst); err != nil {
+		return &startStepError{step: "configure access", err: err, retryable: !servertap.IsAuthError(err)}
+	}
 	return nil
 }
 
+// resetForStartRetry tears down a half-started container and parks the
+// instance in Off with the attempt recorded in last_error_msg.
+func (w *WorkerI) resetForStartRetry(ctx context.Context, inst *pgsql.MapInstance, attempt int, maxAttempts int, cause error) error {
+	if _, err := w.stopCompose(ctx, inst.ID); err != nil {
+		w.logger.Warnf("instance=%d compose down before retry failed: %v", inst.ID, err)
+	}
+	inst.LastErrorMsg = sql.NullString{String: fmt.Sprintf("start attempt %d/%d failed, retrying: %v", attempt, maxAttempts, cause), Valid: true}
+	inst.LastHealthAt = toNullTime(w.opts.Now())
+	return w.setStatus(ctx, inst, StatusOff)
+}
+
 func (w *WorkerI) configureInstanceAccess(ctx context.Context, inst pgsql.MapInstance) error {
-	tapURL := fmt.Sprintf(w.opts.InstanceTapURLPattern, inst.ID)
-	conn, err := servertap.NewConnectorWithAuth(tapURL, w.opts.ServerTapTimeout, w.opts.ServerTapAuthName, w.opts.ServerTapAuthKey)
+	conn, err := w.newInstanceConnector(inst)
 	if err != nil {
 		return err
 	}
 
-	var lastErr error
-	for i := 0; i < serverTapReadyMaxRetries; i++ {
-		lastErr = executeServerTapWithRetry(ctx, conn, inst.ID, "whitelist on", 1, w.logger)
-		if lastErr == nil {
-			break
+	// Poll instead of a fixed warmup so a fast boot is configured as soon as
+	// ServerTap answers; a slow one gets up to instanceReadyTimeout.
+	readyCtx, cancel := context.WithTimeout(ctx, instanceReadyTimeout)
+	err = servertap.WaitReady(readyCtx, conn, int(instanceReadyTimeout/serverTapReadyPollInterval), serverTapReadyPollInterval)
+	cancel()
+	if err != nil {
+		if servertap.IsAuthError(err) {
+			w.logger.Errorf("instance=%d servertap rejected credentials, check servertap_key: %v", inst.ID, err)
 		}
-		w.logger.Warnf("instance=%d servertap ready check failed (%d/%d): %v", inst.ID, i+1, serverTapReadyMaxRetries, lastErr)
-		time.Sleep(serverTapRetryDelay)
+		return err
+	}
+	if err := w.executeServerTapWithRetry(ctx, conn, inst.ID, whitelistToggle(inst.AccessMode), w.opts.ServerTapMaxRetries); err != nil {
+		return err
+	}
+
+	plan, err := w.buildAccessPlan(ctx, inst)
+	if err != nil {
+		return err
+	}
+	if len(plan.rejected) > 0 {
+		w.logger.Warnf("instance=%d skipped invalid player names: %q", inst.ID, plan.rejected)
+	}
+	if err := w.executeServerTapBatch(ctx, conn, inst.ID, plan.commands); err != nil {
+		return err
+	}
+	if err := w.replayPendingWhitelist(ctx, conn, inst.ID, plan); err != nil {
+		return fmt.Errorf("replay pending whitelist: %w", err)
 	}
-	if lastErr != nil {
-		return lastErr
+	if w.opts.MultiverseImport {
+		if err := registerMultiverseWorld(ctx, conn, inst); err != nil {
+			return fmt.Errorf("multiverse import: %w", err)
+		}
+		w.logger.Infof("instance=%d registered with multiverse as %s alias=%s", inst.ID, MultiverseWorldName(inst.ID), inst.Alias)
 	}
+	return nil
+}
 
-	processed := map[string]struct{}{}
+// replayPendingWhitelist applies whitelist changes queued while the instance
+// was Off, then drops them. Players the access plan already handled are
+// skipped: their access follows the current DB state, not the queue.
+func (w *WorkerI) replayPendingWhitelist(ctx context.Context, conn *servertap.Connector, instanceID int64, plan *accessPlan) error {
+	if w.repos.PendingWhitelist == nil {
+		return nil
+	}
+	ops, err := w.repos.PendingWhitelist.ListByInstance(ctx, instanceID)
+	if err != nil || len(ops) == 0 {
+		return err
+	}
+	commands := make([]string, 0, len(ops))
+	var maxID int64
+	for _, op := range ops {
+		maxID = max(maxID, op.ID)
+		if _, handled := plan.processed[strings.ToLower(strings.TrimSpace(op.PlayerName))]; handled {
+			continue
+		}
+		cmd, err := servertap.NewCommandBuilder("whitelist").RawArg(op.Action).PlayerArg(op.PlayerName).BuildChecked()
+		if err != nil {
+			w.logger.Warnf("instance=%d dropping queued whitelist %s %q: %v", instanceID, op.Action, op.PlayerName, err)
+			continue
+		}
+		commands = append(commands, cmd)
+	}
+	if err := w.executeServerTapBatch(ctx, conn, instanceID, commands); err != nil {
+		return err
+	}
+	w.logger.Infof("instance=%d replayed %d queued whitelist changes", instanceID, len(commands))
+	return w.repos.PendingWhitelist.DeleteThrough(ctx, instanceID, maxID)
+}
+
+// whitelistToggle is the whitelist command for an access mode: public worlds
+// run without a whitelist, every other mode enforces it.
+func whitelistToggle(accessMode string) string {
+	if strings.EqualFold(accessMode, "public") {
+		return "whitelist off"
+	}
+	return "whitelist on"
+}
+
+// buildAccessPlan grants admins, the bootstrap admin and the owner
+// whitelist+op, and whitelists every member row of the instance so members
+// added while it was Off can join once it is up. In lockdown only admins are
+// granted; the owner and members are deopped and taken off the whitelist.
+func (w *WorkerI) buildAccessPlan(ctx context.Context, inst pgsql.MapInstance) (*accessPlan, error) {
+	lockdown := strings.EqualFold(inst.AccessMode, "lockdown")
+	plan := &accessPlan{processed: map[string]struct{}{}}
 	// Grant all DB admins OP+whitelist on each instance.
 	admins, err := w.repos.User.ListByRole(ctx, "admin")
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if len(admins) == 0 {
 		w.logger.Warnf("instance=%d no admin users found in DB", inst.ID)
@@ -285,95 +1078,191 @@ func (w *WorkerI) configureInstanceAccess(ctx context.Context, inst pgsql.MapIns
 		w.logger.Infof("instance=%d granting admin access to %d users: %s", inst.ID, len(admins), strings.Join(names, ","))
 	}
 	for _, a := range admins {
-		if err := allowAndOpUser(ctx, conn, inst.ID, a.MCName, processed, w.logger); err != nil {
-			return err
-		}
+		plan.allowAndOp(a.MCName)
 	}
 	// Backward compatibility: ensure configured bootstrap admin is also granted.
-	admin := strings.TrimSpace(w.opts.BootstrapAdminName)
-	if admin != "" {
-		if err := allowAndOpUser(ctx, conn, inst.ID, admin, processed, w.logger); err != nil {
-			return err
-		}
-	}
+	plan.allowAndOp(w.opts.BootstrapAdminName)
 
 	owner, err := w.repos.User.Read(ctx, inst.OwnerID)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if err := allowAndOpUser(ctx, conn, inst.ID, owner.MCName, processed, w.logger); err != nil {
-		return err
+	if lockdown {
+		plan.revoke(owner.MCName)
+	} else {
+		plan.allowAndOp(owner.MCName)
 	}
-	// Sync invited members into whitelist (no OP).
-	members, err := w.repos.InstanceMember.ListByInstance(ctx, inst.ID)
+	// Sync every member row into the whitelist (no OP).
+	members, err := w.repos.InstanceMember.ListWithUsers(ctx, inst.ID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	for _, m := range members {
-		u, err := w.repos.User.Read(ctx, m.UserID)
-		if err != nil {
-			continue
-		}
-		if strings.EqualFold(m.Role, "member") {
-			if err := allowUserWhitelist(ctx, conn, inst.ID, u.MCName, processed, w.logger); err != nil {
-				return err
-			}
+		if lockdown {
+			plan.revoke(m.MCName)
+		} else {
+			plan.allow(m.MCName)
 		}
 	}
-	return nil
+	return plan, nil
 }
 
-func allowAndOpUser(
-	ctx context.Context,
-	conn *servertap.Connector,
-	instanceID int64,
-	name string,
-	processed map[string]struct{},
-	logger interface {
-		Warnf(string, ...any)
-	},
-) error {
-	name = strings.TrimSpace(name)
-	if name == "" {
-		return nil
+// MultiverseWorldName is the internal Multiverse world name used for routing (world=i_<id>).
+func MultiverseWorldName(instanceID int64) string {
+	return fmt.Sprintf("i_%d", instanceID)
+}
+
+// detachMultiverseWorld unloads (or, when archiving, removes) the world from
+// Multiverse while the server is still up. Failures never block the stop.
+func (w *WorkerI) detachMultiverseWorld(ctx context.Context, inst pgsql.MapInstance, remove bool) {
+	if !w.opts.MultiverseImport {
+		return
 	}
-	key := strings.ToLower(name)
-	if _, exists := processed[key]; exists {
-		return nil
+	ctx, cancel := context.WithTimeout(ctx, multiverseDetachTimeout)
+	defer cancel()
+	conn, err := w.newInstanceConnector(inst)
+	if err != nil {
+		w.logger.Warnf("instance=%d multiverse detach skipped: %v", inst.ID, err)
+		return
 	}
-	if err := executeServerTapWithRetry(ctx, conn, instanceID, "whitelist add "+name, serverTapCommandMaxRetries, logger); err != nil {
+	mv := servertap.NewServiceC(conn)
+	world := MultiverseWorldName(inst.ID)
+	op := "unload"
+	if remove {
+		op = "remove"
+		_, err = mv.MVRemove(ctx, world)
+	} else {
+		_, err = mv.MVUnload(ctx, world)
+	}
+	if err != nil {
+		w.logger.Warnf("instance=%d multiverse %s %s failed: %v", inst.ID, op, world, err)
+		return
+	}
+	w.logger.Infof("instance=%d multiverse %s %s done", inst.ID, op, world)
+}
+
+// stopServerGracefully saves the worlds and stops the server in-game, then
+// waits until ServerTap stops answering, so compose down does not SIGTERM
+// the JVM mid-write. Failures only log: compose down follows either way.
+func (w *WorkerI) stopServerGracefully(ctx context.Context, inst pgsql.MapInstance) {
+	ctx, cancel := context.WithTimeout(ctx, w.opts.PreStopTimeout)
+	defer cancel()
+	conn, err := w.newInstanceConnector(inst)
+	if err != nil {
+		w.logger.Warnf("instance=%d graceful stop skipped: %v", inst.ID, err)
+		return
+	}
+	if _, err := conn.Execute(ctx, servertap.ExecuteRequest{Command: "save-all flush"}); err != nil {
+		w.logger.Warnf("instance=%d save-all before stop failed, taking it down: %v", inst.ID, err)
+		return
+	}
+	if _, err := conn.Execute(ctx, servertap.ExecuteRequest{Command: "stop"}); err != nil {
+		// The server may drop the connection while shutting down.
+		w.logger.Infof("instance=%d stop command returned: %v", inst.ID, err)
+	}
+	for {
+		if err := conn.Ping(ctx); err != nil {
+			if ctx.Err() != nil {
+				w.logger.Warnf("instance=%d server still up after %s, taking it down", inst.ID, w.opts.PreStopTimeout)
+			}
+			return
+		}
+		if err := w.sleep(ctx, serverTapReadyPollInterval); err != nil {
+			w.logger.Warnf("instance=%d server still up after %s, taking it down", inst.ID, w.opts.PreStopTimeout)
+			return
+		}
+	}
+}
+
+func registerMultiverseWorld(ctx context.Context, exec servertap.Executor, inst pgsql.MapInstance) error {
+	mv := servertap.NewServiceC(exec)
+	world := MultiverseWorldName(inst.ID)
+	if _, err := mv.MVImport(ctx, world, "NORMAL"); err != nil {
 		return err
 	}
-	if err := executeServerTapWithRetry(ctx, conn, instanceID, servertap.NewCommandBuilder("op").Arg(name).Build(), serverTapCommandMaxRetries, logger); err != nil {
+	if _, err := mv.MVSetAlias(ctx, world, inst.Alias); err != nil {
 		return err
 	}
-	processed[key] = struct{}{}
 	return nil
 }
 
-func allowUserWhitelist(
-	ctx context.Context,
-	conn *servertap.Connector,
-	instanceID int64,
-	name string,
-	processed map[string]struct{},
-	logger interface {
-		Warnf(string, ...any)
-	},
-) error {
+// newInstanceConnector talks to inst with its own ServerTap key, falling
+// back to the global key when none is stored.
+func (w *WorkerI) newInstanceConnector(inst pgsql.MapInstance) (*servertap.Connector, error) {
+	w.authMu.RLock()
+	authName, authKey := w.opts.ServerTapAuthName, w.opts.ServerTapAuthKey
+	w.authMu.RUnlock()
+	tapURL := fmt.Sprintf(w.opts.InstanceTapURLPattern, inst.ID)
+	return servertap.NewConnectorWithOptions(tapURL, servertap.ConnectorOptions{
+		Timeout:    w.opts.ServerTapTimeout,
+		AuthHeader: authName,
+		AuthKey:    w.opts.InstanceKeys.KeyFor(inst.ServerTapKey, authKey),
+		TLS:        w.opts.ServerTapTLS,
+	})
+}
+
+// SetServerTapAuth swaps the ServerTap credentials used for new instance
+// connections (config reload).
+func (w *WorkerI) SetServerTapAuth(authName string, key string) {
+	w.authMu.Lock()
+	defer w.authMu.Unlock()
+	w.opts.ServerTapAuthName = authName
+	w.opts.ServerTapAuthKey = key
+}
+
+// accessPlan collects whitelist/op commands, granting each player at most once.
+// Names outside the player name charset are collected in rejected instead.
+type accessPlan struct {
+	processed map[string]struct{}
+	commands  []string
+	rejected  []string
+}
+
+func (p *accessPlan) allowAndOp(name string) {
+	if name, ok := p.claim(name); ok {
+		p.commands = append(p.commands,
+			servertap.NewCommandBuilder("whitelist").RawArg("add").PlayerArg(name).Build(),
+			servertap.NewCommandBuilder("op").PlayerArg(name).Build(),
+		)
+	}
+}
+
+// allow whitelists a player without op, taking away an op left over from an
+// earlier role such as a previous owner.
+func (p *accessPlan) allow(name string) {
+	if name, ok := p.claim(name); ok {
+		p.commands = append(p.commands,
+			servertap.NewCommandBuilder("whitelist").RawArg("add").PlayerArg(name).Build(),
+			servertap.NewCommandBuilder("deop").PlayerArg(name).Build(),
+		)
+	}
+}
+
+// revoke takes a player's op and whitelist entry away (lockdown).
+func (p *accessPlan) revoke(name string) {
+	if name, ok := p.claim(name); ok {
+		p.commands = append(p.commands,
+			servertap.NewCommandBuilder("deop").PlayerArg(name).Build(),
+			servertap.NewCommandBuilder("whitelist").RawArg("remove").PlayerArg(name).Build(),
+		)
+	}
+}
+
+func (p *accessPlan) claim(name string) (string, bool) {
 	name = strings.TrimSpace(name)
 	if name == "" {
-		return nil
+		return "", false
 	}
 	key := strings.ToLower(name)
-	if _, exists := processed[key]; exists {
-		return nil
+	if _, exists := p.processed[key]; exists {
+		return "", false
 	}
-	if err := executeServerTapWithRetry(ctx, conn, instanceID, "whitelist add "+name, serverTapCommandMaxRetries, logger); err != nil {
-		return err
+	p.processed[key] = struct{}{}
+	if servertap.ValidatePlayerName(name) != nil {
+		p.rejected = append(p.rejected, name)
+		return "", false
 	}
-	processed[key] = struct{}{}
-	return nil
+	return name, true
 }
 
 func (w *WorkerI) setStatus(ctx context.Context, inst *pgsql.MapInstance, to Status) error {
@@ -386,6 +1275,9 @@ func (w *WorkerI) setStatus(ctx context.Context, inst *pgsql.MapInstance, to Sta
 	}
 	inst.Status = string(to)
 	inst.UpdatedAt = w.opts.Now()
+	if to == StatusOn {
+		inst.StartedOnAt = toNullTime(inst.UpdatedAt)
+	}
 	w.logger.Infof("instance=%d status: %s -> %s", inst.ID, from, to)
 	return w.repos.MapInstance.Update(ctx, *inst)
 }
@@ -418,60 +1310,310 @@ func (w *WorkerI) failInstanceByID(instanceID int64, reason string) {
 
 func (w *WorkerI) prepareInstanceVolume(instanceID int64, sourceWorldPath string) error {
 	base := instanceDir(w.opts.InstanceRootDir, instanceID)
-	if err := os.MkdirAll(base, 0o755); err != nil {
+	if _, err := scaffoldInstanceVolume(base); err != nil {
 		return err
 	}
+
+	if strings.TrimSpace(sourceWorldPath) == "" {
+		return nil
+	}
+	templateRoot, worldSrc := resolveTemplateWorldPaths(sourceWorldPath)
+	if !isDir(worldSrc) {
+		return fmt.Errorf("source world path is not dir: %s", worldSrc)
+	}
+	staged, err := w.stageWorld(instanceID, templateRoot, worldSrc)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staged)
+	for _, name := range []string{"world", "world_nether", "world_the_end"} {
+		dst := filepath.Join(base, name)
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
+		if err := moveDir(filepath.Join(staged, name), dst); err != nil {
+			return fmt.Errorf("move staged %s: %w", name, err)
+		}
+	}
+	w.logger.Infof("instance=%d prepared volume from template=%s", instanceID, templateRoot)
+	return nil
+}
+
+// scaffoldInstanceVolume creates whatever is missing of whitelist.json and the
+// three world dirs under base, leaving existing data alone, and returns the
+// names it created. A whitelist.json dir (what docker leaves behind when it
+// mounts a missing file) is replaced if it is empty.
+func scaffoldInstanceVolume(base string) ([]string, error) {
+	if err := os.MkdirAll(base, 0o755); err != nil {
+		return nil, err
+	}
+	var created []string
 	whitelistFile := filepath.Join(base, "whitelist.json")
+	if isDir(whitelistFile) {
+		if err := os.Remove(whitelistFile); err != nil {
+			return nil, fmt.Errorf("whitelist.json is a non-empty dir: %w", err)
+		}
+	}
+	if _, err := os.Stat(whitelistFile); errors.Is(err, os.ErrNotExist) {
+		created = append(created, "whitelist.json")
+	}
 	if err := ensureFileWithDefault(whitelistFile, []byte("[]\n")); err != nil {
-		return err
+		return nil, err
 	}
-	worldDir := filepath.Join(base, "world")
-	netherDir := filepath.Join(base, "world_nether")
-	endDir := filepath.Join(base, "world_the_end")
-	for _, d := range []string{worldDir, netherDir, endDir} {
+	for _, name := range []string{"world", "world_nether", "world_the_end"} {
+		d := filepath.Join(base, name)
+		if !isDir(d) {
+			created = append(created, name)
+		}
 		if err := os.MkdirAll(d, 0o755); err != nil {
-			return err
+			return nil, err
 		}
 	}
+	return created, nil
+}
 
-	if strings.TrimSpace(sourceWorldPath) == "" {
-		return nil
+// RepairVolume recreates a missing whitelist.json and world dirs of a stopped
+// instance without touching existing data, and returns what it recreated.
+// Members are whitelisted again by the next start.
+func (w *WorkerI) RepairVolume(ctx context.Context, instanceID int64) (repaired []string, err error) {
+	defer func() { w.countOp("repair_volume", err) }()
+	inst, err := w.repos.MapInstance.Read(ctx, instanceID)
+	if err != nil {
+		return nil, fmt.Errorf("read instance: %w", err)
 	}
-	templateRoot, worldSrc := resolveTemplateWorldPaths(sourceWorldPath)
-	if !isDir(worldSrc) {
-		return fmt.Errorf("source world path is not dir: %s", worldSrc)
+	if Status(inst.Status) != StatusOff {
+		return nil, fmt.Errorf("instance %d must be Off to repair (status=%s)", instanceID, inst.Status)
+	}
+	defer w.beginJob(inst.ID, "repair_volume")()
+	repaired, err = scaffoldInstanceVolume(instanceDir(w.opts.InstanceRootDir, instanceID))
+	if err != nil {
+		return nil, err
+	}
+	w.logger.Infof("instance=%d volume repaired recreated=%v", instanceID, repaired)
+	return repaired, nil
+}
+
+// RotateServerTapKey replaces the instance's ServerTap key. A running
+// instance is stopped with the old key and started again so the container
+// loads the new config; cron and cmdreceiver read the key from the row on
+// each call and follow without a reload.
+func (w *WorkerI) RotateServerTapKey(ctx context.Context, instanceID int64) (err error) {
+	defer func() { w.countOp("rotate_servertap_key", err) }()
+	if w.opts.InstanceKeys == nil {
+		return errors.New("per-instance servertap keys are not configured (instance_key_secret)")
+	}
+	inst, err := w.repos.MapInstance.Read(ctx, instanceID)
+	if err != nil {
+		return fmt.Errorf("read instance: %w", err)
+	}
+	wasOn := false
+	switch Status(inst.Status) {
+	case StatusOn:
+		wasOn = true
+		if err := w.StopOnly(ctx, instanceID); err != nil {
+			return fmt.Errorf("stop before key rotation: %w", err)
+		}
+		if inst, err = w.repos.MapInstance.Read(ctx, instanceID); err != nil {
+			return fmt.Errorf("read instance: %w", err)
+		}
+	case StatusOff:
+	default:
+		return fmt.Errorf("instance %d cannot rotate servertap key (status=%s)", instanceID, inst.Status)
 	}
-	if err := clearDir(worldDir); err != nil {
+	_, sealed, err := w.opts.InstanceKeys.Generate()
+	if err != nil {
 		return err
 	}
-	if err := clearDir(netherDir); err != nil {
-		return err
+	inst.ServerTapKey = sealed
+	if err := w.repos.MapInstance.Update(ctx, inst); err != nil {
+		return fmt.Errorf("save servertap key: %w", err)
+	}
+	if err := w.prepareInstanceTapConfig(&inst); err != nil {
+		return fmt.Errorf("write servertap config: %w", err)
+	}
+	// A compose file rendered before the instance had its own key does not
+	// mount the config, and StartExisting reuses it as is.
+	if err := w.prepareComposeFile(inst, inst.GameVersion); err != nil {
+		return fmt.Errorf("render compose: %w", err)
+	}
+	w.logger.Infof("instance=%d servertap key rotated", instanceID)
+	if wasOn {
+		return w.StartExisting(ctx, instanceID)
+	}
+	return nil
+}
+
+// AllowAndOpUser whitelists and ops mcName on every instance that is On,
+// the same grant configureInstanceAccess gives admins at start. It returns
+// the instances that were granted; failures on the others are joined.
+func (w *WorkerI) AllowAndOpUser(ctx context.Context, mcName string) (granted []int64, err error) {
+	defer func() { w.countOp("allow_and_op_user", err) }()
+	plan := &accessPlan{processed: map[string]struct{}{}}
+	plan.allowAndOp(mcName)
+	if len(plan.commands) == 0 {
+		return nil, fmt.Errorf("invalid player name %q", mcName)
+	}
+	instances, err := w.repos.MapInstance.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list instances: %w", err)
+	}
+	var errs []error
+	for _, inst := range instances {
+		if Status(inst.Status) != StatusOn {
+			continue
+		}
+		conn, cErr := w.newInstanceConnector(inst)
+		if cErr == nil {
+			cErr = w.executeServerTapBatch(ctx, conn, inst.ID, plan.commands)
+		}
+		if cErr != nil {
+			w.logger.Warnf("instance=%d grant op to %s failed: %v", inst.ID, mcName, cErr)
+			errs = append(errs, fmt.Errorf("instance %d: %w", inst.ID, cErr))
+			continue
+		}
+		granted = append(granted, inst.ID)
+	}
+	w.logger.Infof("granted op to %s on %d instances", mcName, len(granted))
+	return granted, errors.Join(errs...)
+}
+
+// DrainAll stops every On instance one after another, for a manager host
+// restart; StopOnly saves in-game first and still stops when that fails.
+// Instances not reached before ctx ends are left running and reported in the
+// joined error.
+func (w *WorkerI) DrainAll(ctx context.Context) (stopped []int64, err error) {
+	defer func() { w.countOp("drain", err) }()
+	instances, err := w.repos.MapInstance.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list instances: %w", err)
+	}
+	var errs []error
+	for _, inst := range instances {
+		if Status(inst.Status) != StatusOn {
+			continue
+		}
+		if ctx.Err() != nil {
+			errs = append(errs, fmt.Errorf("instance %d: not drained: %w", inst.ID, ctx.Err()))
+			continue
+		}
+		if sErr := w.StopOnly(ctx, inst.ID); sErr != nil {
+			w.logger.Errorf("instance=%d drain stop failed: %v", inst.ID, sErr)
+			errs = append(errs, fmt.Errorf("instance %d: %w", inst.ID, sErr))
+			continue
+		}
+		w.logger.Infof("instance=%d drained", inst.ID)
+		stopped = append(stopped, inst.ID)
+	}
+	return stopped, errors.Join(errs...)
+}
+
+// ValidateStart checks that a start of the instance on gameVersion (its own
+// version when empty) would find the version dir, a paper jar and a runtime
+// image, without touching Docker. All problems found are returned joined.
+func (w *WorkerI) ValidateStart(ctx context.Context, instanceID int64, gameVersion string) error {
+	inst, err := w.repos.MapInstance.Read(ctx, instanceID)
+	if err != nil {
+		return fmt.Errorf("read instance: %w", err)
+	}
+	version := strings.TrimSpace(gameVersion)
+	if version == "" {
+		version = inst.GameVersion
+	}
+	if version == "" {
+		version = w.opts.DefaultGameVersion
+	}
+	versionDir, err := w.versionDir(version)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	if !isDir(versionDir) {
+		errs = append(errs, fmt.Errorf("version dir missing: %s", versionDir))
+	} else if _, err := detectPaperJar(versionDir); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := runtimeImageByVersion(version); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// stageWorld copies a template/upload into a fresh staging dir and validates
+// it there, so a bad source never touches the instance dir. The staging dir
+// is removed on failure; on success the caller moves its contents and removes it.
+func (w *WorkerI) stageWorld(instanceID int64, templateRoot string, worldSrc string) (_ string, err error) {
+	if err := os.MkdirAll(w.opts.StagingRootDir, 0o755); err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp(w.opts.StagingRootDir, fmt.Sprintf("instance-%d-", instanceID))
+	if err != nil {
+		return "", err
 	}
-	if err := clearDir(endDir); err != nil {
-		return err
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(dir)
+		}
+	}()
+	if err := copyDir(worldSrc, filepath.Join(dir, "world")); err != nil {
+		return "", fmt.Errorf("stage world: %w", err)
 	}
-	if err := copyDir(worldSrc, worldDir); err != nil {
-		return err
+	if _, err := os.Stat(filepath.Join(dir, "world", "level.dat")); err != nil {
+		return "", fmt.Errorf("source world has no level.dat: %s", worldSrc)
 	}
 	// Optional dimensions: some template only has overworld.
-	netherSrc := filepath.Join(templateRoot, "world_nether")
-	if isDir(netherSrc) {
-		if err := copyDir(netherSrc, netherDir); err != nil {
-			return err
+	for _, name := range []string{"world_nether", "world_the_end"} {
+		src := filepath.Join(templateRoot, name)
+		dst := filepath.Join(dir, name)
+		if isDir(src) {
+			if err := copyDir(src, dst); err != nil {
+				return "", fmt.Errorf("stage %s: %w", name, err)
+			}
+		} else if err := os.MkdirAll(dst, 0o755); err != nil {
+			return "", err
 		}
 	}
-	endSrc := filepath.Join(templateRoot, "world_the_end")
-	if isDir(endSrc) {
-		if err := copyDir(endSrc, endDir); err != nil {
-			return err
+	return dir, nil
+}
+
+// SweepStaleFiles removes leftovers of interrupted imports: every stageWorld
+// dir in the staging root whose mtime is older than maxAge. It returns the
+// removed paths; a failing entry is skipped so one bad file does not block the
+// rest.
+func (w *WorkerI) SweepStaleFiles(maxAge time.Duration) ([]string, error) {
+	entries, err := os.ReadDir(w.opts.StagingRootDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
 		}
+		return nil, err
 	}
-	w.logger.Infof("instance=%d prepared volume from template=%s", instanceID, templateRoot)
-	return nil
+	cutoff := w.opts.Now().Add(-maxAge)
+	var removed []string
+	var errs []error
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		path := filepath.Join(w.opts.StagingRootDir, e.Name())
+		if err := os.RemoveAll(path); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed = append(removed, path)
+	}
+	return removed, errors.Join(errs...)
 }
 
-func (w *WorkerI) prepareComposeFile(instanceID int64, version string) error {
-	versionDir := filepath.Join(w.opts.VersionRootDir, version)
+// prepareComposeFile writes the instance's compose file. A positive
+// inst.HostPort is published to the game port so players can connect without
+// the proxy; CPU/memory limits come from the instance or the worker defaults.
+func (w *WorkerI) prepareComposeFile(inst pgsql.MapInstance, version string) error {
+	instanceID := inst.ID
+	versionDir, err := w.versionDir(version)
+	if err != nil {
+		return err
+	}
 	jarName, err := detectPaperJar(versionDir)
 	if err != nil {
 		return err
@@ -513,82 +1655,448 @@ func (w *WorkerI) prepareComposeFile(instanceID int64, version string) error {
 		return err
 	}
 
-	coreMount, err := filepath.Abs(coreDst)
+	data, err := w.composeDataFor(inst, imageTag, jarName)
 	if err != nil {
 		return err
 	}
-	cacheMount, err := filepath.Abs(cacheDst)
+	content, err := w.renderCompose(data)
 	if err != nil {
 		return err
 	}
-	versionsMount, err := filepath.Abs(versionsDst)
+	return os.WriteFile(filepath.Join(base, "docker-compose.yml"), content, 0o644)
+}
+
+// composeDataFor fills the compose template data for inst from its limits,
+// host port and instance directory.
+func (w *WorkerI) composeDataFor(inst pgsql.MapInstance, imageTag string, jarName string) (composeData, error) {
+	base := instanceDir(w.opts.InstanceRootDir, inst.ID)
+	data := composeData{
+		InstanceID:  inst.ID,
+		ServiceName: containerName(inst.ID),
+		Image:       imageTag,
+		JarName:     jarName,
+		MemLimitMB:  w.memLimitFor(inst),
+		HostPort:    inst.HostPort,
+		GamePort:    instanceGamePort,
+		Network:     w.opts.InstanceNetwork,
+	}
+	if cpus := w.cpuLimitFor(inst); cpus > 0 {
+		data.CPUs = strconv.FormatFloat(cpus, 'f', -1, 64)
+	}
+	var err error
+	for _, m := range []struct {
+		dst *string
+		src string
+	}{
+		{&data.Mounts.Core, filepath.Join(base, jarName)},
+		{&data.Mounts.Cache, filepath.Join(base, "cache")},
+		{&data.Mounts.Versions, filepath.Join(base, "versions")},
+		{&data.Mounts.World, filepath.Join(base, "world")},
+		{&data.Mounts.Nether, filepath.Join(base, "world_nether")},
+		{&data.Mounts.End, filepath.Join(base, "world_the_end")},
+		{&data.Mounts.Whitelist, filepath.Join(base, "whitelist.json")},
+	} {
+		if *m.dst, err = filepath.Abs(m.src); err != nil {
+			return composeData{}, err
+		}
+	}
+	if tapConfig := filepath.Join(base, instanceTapConfigName); fileExists(tapConfig) {
+		if data.Mounts.TapConfig, err = filepath.Abs(tapConfig); err != nil {
+			return composeData{}, err
+		}
+	}
+	if props := filepath.Join(base, serverPropertiesName); fileExists(props) {
+		if data.Mounts.ServerProperties, err = filepath.Abs(props); err != nil {
+			return composeData{}, err
+		}
+	}
+	return data, nil
+}
+
+// ComposePreview returns the instance's docker-compose.yml with secrets
+// redacted. An instance that was never started has no file yet; it then gets
+// what the next start would write from its current settings, without copying
+// or starting anything.
+func (w *WorkerI) ComposePreview(ctx context.Context, instanceID int64) (string, error) {
+	inst, err := w.repos.MapInstance.Read(ctx, instanceID)
 	if err != nil {
-		return err
+		return "", err
+	}
+	content, err := os.ReadFile(filepath.Join(instanceDir(w.opts.InstanceRootDir, instanceID), "docker-compose.yml"))
+	if errors.Is(err, os.ErrNotExist) {
+		content, err = w.renderComposePreview(inst)
 	}
-	worldMount, err := filepath.Abs(filepath.Join(base, "world"))
 	if err != nil {
-		return err
+		return "", err
+	}
+	w.authMu.RLock()
+	secrets := []string{w.opts.ServerTapAuthKey}
+	w.authMu.RUnlock()
+	if w.opts.InstanceKeys != nil && inst.ServerTapKey != "" {
+		if plain, err := w.opts.InstanceKeys.Open(inst.ServerTapKey); err == nil {
+			secrets = append(secrets, plain)
+		}
+	}
+	return redactCompose(string(content), secrets...), nil
+}
+
+func (w *WorkerI) renderComposePreview(inst pgsql.MapInstance) ([]byte, error) {
+	version := inst.GameVersion
+	if version == "" {
+		version = w.opts.DefaultGameVersion
 	}
-	netherMount, err := filepath.Abs(filepath.Join(base, "world_nether"))
+	versionDir, err := w.versionDir(version)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	endMount, err := filepath.Abs(filepath.Join(base, "world_the_end"))
+	jarName, err := detectPaperJar(versionDir)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	imageTag, err := runtimeImageByVersion(version)
+	if err != nil {
+		return nil, err
 	}
-	whitelistMount, err := filepath.Abs(filepath.Join(base, "whitelist.json"))
+	data, err := w.composeDataFor(inst, imageTag, jarName)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return w.renderCompose(data)
+}
+
+// composeSecretLine matches "key: value" / "KEY=value" entries whose name
+// looks like a credential, as an operator compose template might add.
+var composeSecretLine = regexp.MustCompile(`(?im)^(\s*-?\s*"?[\w.-]*(?:key|secret|token|password)[\w.-]*"?\s*[:=]\s*).+$`)
+
+// redactCompose hides credential-looking values and any of the given secrets.
+func redactCompose(content string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			content = strings.ReplaceAll(content, secret, "<redacted>")
+		}
+	}
+	return composeSecretLine.ReplaceAllString(content, "${1}<redacted>")
+}
+
+// composeTemplateName is the optional operator template in ComposeTemplateDir
+// that replaces defaultComposeTemplate.
+const composeTemplateName = "docker-compose.tmpl"
+
+// composeData is what the compose template is rendered with. Mount fields are
+// absolute host paths; TapConfig and ServerProperties are empty when the
+// instance has no such file of its own, CPUs/MemLimitMB/HostPort are empty/zero when unset.
+type composeData struct {
+	InstanceID  int64
+	ServiceName string
+	Image       string
+	JarName     string
+	CPUs        string
+	MemLimitMB  int
+	HostPort    int
+	GamePort    int
+	Network     string
+	Mounts      struct {
+		Core, Cache, Versions, World, Nether, End, Whitelist, TapConfig, ServerProperties string
 	}
+}
 
-	composePath := filepath.Join(base, "docker-compose.yml")
-	content := fmt.Sprintf(`services:
-  mcmm-inst-%d:
-    image: %s
-    container_name: mcmm-inst-%d
+var defaultComposeTemplate = template.Must(template.New("compose").Parse(`services:
+  {{.ServiceName}}:
+    image: {{.Image}}
+    container_name: {{.ServiceName}}
     restart: unless-stopped
+{{- if .CPUs}}
+    cpus: "{{.CPUs}}"
+{{- end}}
+{{- if .MemLimitMB}}
+    mem_limit: {{.MemLimitMB}}m
+{{- end}}
     environment:
       JAVA_TOOL_OPTIONS: "-Xms1G -Xmx2G"
-      PAPER_JAR: "%s"
+      PAPER_JAR: "{{.JarName}}"
     volumes:
-      - %s:/data/server/%s:ro
-      - %s:/data/server/cache
-      - %s:/data/server/versions
-      - %s:/data/server/world
-      - %s:/data/server/world_nether
-      - %s:/data/server/world_the_end
-      - %s:/data/server/whitelist.json
+      - {{.Mounts.Core}}:/data/server/{{.JarName}}:ro
+      - {{.Mounts.Cache}}:/data/server/cache
+      - {{.Mounts.Versions}}:/data/server/versions
+      - {{.Mounts.World}}:/data/server/world
+      - {{.Mounts.Nether}}:/data/server/world_nether
+      - {{.Mounts.End}}:/data/server/world_the_end
+      - {{.Mounts.Whitelist}}:/data/server/whitelist.json
+{{- if .Mounts.TapConfig}}
+      - {{.Mounts.TapConfig}}:/data/server/plugins/ServerTap/config.yml:ro
+{{- end}}
+{{- if .Mounts.ServerProperties}}
+      - {{.Mounts.ServerProperties}}:/data/server/server.properties
+{{- end}}
+{{- if .HostPort}}
+    ports:
+      - "{{.HostPort}}:{{.GamePort}}"
+{{- end}}
     networks:
-      - %s
+      - {{.Network}}
 networks:
-  %s:
+  {{.Network}}:
     external: true
-`, instanceID, imageTag, instanceID, jarName,
-		coreMount, jarName,
-		cacheMount,
-		versionsMount,
-		worldMount,
-		netherMount,
-		endMount,
-		whitelistMount,
-		w.opts.InstanceNetwork,
-		w.opts.InstanceNetwork,
-	)
-	return os.WriteFile(composePath, []byte(content), 0o644)
-}
-
-func (w *WorkerI) startCompose(ctx context.Context, instanceID int64) error {
+`))
+
+// renderCompose renders docker-compose.tmpl from ComposeTemplateDir when
+// present (re-read on every call so edits apply to the next start), else the
+// built-in template, and checks the result is a YAML mapping with services.
+func (w *WorkerI) renderCompose(data composeData) ([]byte, error) {
+	tmpl := defaultComposeTemplate
+	custom := filepath.Join(w.opts.ComposeTemplateDir, composeTemplateName)
+	if fileExists(custom) {
+		raw, err := os.ReadFile(custom)
+		if err != nil {
+			return nil, fmt.Errorf("read compose template: %w", err)
+		}
+		if tmpl, err = template.New(composeTemplateName).Option("missingkey=error").Parse(string(raw)); err != nil {
+			return nil, fmt.Errorf("parse compose template %s: %w", custom, err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("render compose template: %w", err)
+	}
+	var doc struct {
+		Services map[string]any `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		return nil, fmt.Errorf("rendered compose is not valid yaml: %w", err)
+	}
+	if len(doc.Services) == 0 {
+		return nil, errors.New("rendered compose defines no services")
+	}
+	return buf.Bytes(), nil
+}
+
+// cpuLimitFor is the instance's CPU override, else the worker default; zero
+// means unlimited.
+func (w *WorkerI) cpuLimitFor(inst pgsql.MapInstance) float64 {
+	if inst.CPULimit > 0 {
+		return inst.CPULimit
+	}
+	return w.opts.CPULimit
+}
+
+// memLimitFor is the instance's memory override in MB, else the worker
+// default; zero means unlimited.
+func (w *WorkerI) memLimitFor(inst pgsql.MapInstance) int {
+	if inst.MemLimitMB > 0 {
+		return inst.MemLimitMB
+	}
+	return w.opts.MemLimitMB
+}
+
+// assignHostPort gives inst a host port from the configured range, or clears
+// it when no range is set. The current port is kept unless another
+// non-archived instance holds it. The choice is persisted while portMu is
+// held so concurrent starts never hand out the same port.
+func (w *WorkerI) assignHostPort(ctx context.Context, inst *pgsql.MapInstance) error {
+	lo, hi := w.opts.HostPortMin, w.opts.HostPortMax
+	if lo <= 0 || hi < lo {
+		inst.HostPort = 0
+		return nil
+	}
+	w.portMu.Lock()
+	defer w.portMu.Unlock()
+	all, err := w.repos.MapInstance.List(ctx)
+	if err != nil {
+		return fmt.Errorf("list instances: %w", err)
+	}
+	used := make(map[int]bool, len(all))
+	for _, other := range all {
+		if other.ID == inst.ID || other.HostPort <= 0 || Status(other.Status) == StatusArchived {
+			continue
+		}
+		used[other.HostPort] = true
+	}
+	if p := inst.HostPort; p >= lo && p <= hi && !used[p] {
+		return nil
+	}
+	for p := lo; p <= hi; p++ {
+		if used[p] {
+			continue
+		}
+		inst.HostPort = p
+		if err := w.repos.MapInstance.Update(ctx, *inst); err != nil {
+			return fmt.Errorf("save host port: %w", err)
+		}
+		w.logger.Infof("instance=%d assigned host port %d", inst.ID, p)
+		return nil
+	}
+	return fmt.Errorf("no free host port in %d-%d", lo, hi)
+}
+
+// ServerProperties are the per-instance server.properties settings. Empty
+// or zero fields keep the current value (or the built-in default).
+// LevelSeed only applies until the world has been generated.
+type ServerProperties struct {
+	Gamemode   string
+	Difficulty string
+	MaxPlayers int
+	MOTD       string
+	LevelSeed  string
+}
+
+func serverPropertiesOf(inst pgsql.MapInstance) ServerProperties {
+	return ServerProperties{Gamemode: inst.Gamemode, Difficulty: inst.Difficulty, MaxPlayers: inst.MaxPlayers, MOTD: inst.MOTD, LevelSeed: inst.LevelSeed}
+}
+
+var (
+	validGamemodes    = map[string]bool{"survival": true, "creative": true, "adventure": true, "spectator": true}
+	validDifficulties = map[string]bool{"peaceful": true, "easy": true, "normal": true, "hard": true}
+)
+
+// defaultServerProperties mirrors the runtime image's server.properties for
+// the keys the proxy setup depends on; it seeds an instance's first file.
+// enforce-secure-profile is left to the server default: it only applies in
+// online mode, which the proxy setup turns off.
+const defaultServerProperties = `#Minecraft server properties
+level-name=world
+server-port=25565
+online-mode=false
+allow-flight=true
+gamemode=survival
+difficulty=easy
+max-players=20
+motd=A Minecraft Server
+white-list=false
+enforce-whitelist=false
+view-distance=10
+simulation-distance=10
+spawn-protection=16
+`
+
+// Validate rejects values the server would not understand.
+func (p ServerProperties) Validate() error {
+	var errs []error
+	if p.Gamemode != "" && !validGamemodes[p.Gamemode] {
+		errs = append(errs, fmt.Errorf("invalid gamemode %q", p.Gamemode))
+	}
+	if p.Difficulty != "" && !validDifficulties[p.Difficulty] {
+		errs = append(errs, fmt.Errorf("invalid difficulty %q", p.Difficulty))
+	}
+	if p.MaxPlayers < 0 {
+		errs = append(errs, fmt.Errorf("invalid max-players %d", p.MaxPlayers))
+	}
+	return errors.Join(errs...)
+}
+
+// prepareServerProperties writes the instance's server.properties: the file
+// left by the last run (or defaultServerProperties) with the set fields of
+// props applied. Other keys and comments are kept, so runtime changes such as
+// white-list survive.
+func (w *WorkerI) prepareServerProperties(instanceID int64, props ServerProperties) error {
+	if err := props.Validate(); err != nil {
+		return err
+	}
+	path := filepath.Join(instanceDir(w.opts.InstanceRootDir, instanceID), serverPropertiesName)
+	current := defaultServerProperties
+	if raw, err := os.ReadFile(path); err == nil {
+		current = string(raw)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	set := map[string]string{}
+	if props.Gamemode != "" {
+		set["gamemode"] = props.Gamemode
+	}
+	if props.Difficulty != "" {
+		set["difficulty"] = props.Difficulty
+	}
+	if props.MaxPlayers > 0 {
+		set["max-players"] = strconv.Itoa(props.MaxPlayers)
+	}
+	if motd := strings.Join(strings.Fields(props.MOTD), " "); motd != "" {
+		set["motd"] = motd
+	}
+	// The seed is only read when the world is generated; once level.dat
+	// exists, whatever the file says no longer matters and is left alone.
+	if seed := strings.Join(strings.Fields(props.LevelSeed), " "); seed != "" && !worldGenerated(instanceDir(w.opts.InstanceRootDir, instanceID)) {
+		set["level-seed"] = seed
+	}
+	lines := strings.Split(strings.TrimRight(current, "\n"), "\n")
+	for i, line := range lines {
+		key, _, ok := strings.Cut(line, "=")
+		if !ok || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		if v, ok := set[key]; ok {
+			lines[i] = key + "=" + v
+			delete(set, key)
+		}
+	}
+	for _, key := range []string{"gamemode", "difficulty", "max-players", "motd", "level-seed"} {
+		if v, ok := set[key]; ok {
+			lines = append(lines, key+"="+v)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644)
+}
+
+// worldGenerated reports whether the instance's overworld has a level.dat.
+func worldGenerated(base string) bool {
+	_, err := os.Stat(filepath.Join(base, "world", "level.dat"))
+	return err == nil
+}
+
+// prepareInstanceTapConfig writes the ServerTap config.yml mounted into the
+// container. With a keyring configured, an instance without a key gets one
+// here; the caller's next Update persists it. Without a keyring the file is
+// removed so the image's own config (global key) applies.
+func (w *WorkerI) prepareInstanceTapConfig(inst *pgsql.MapInstance) error {
+	path := filepath.Join(instanceDir(w.opts.InstanceRootDir, inst.ID), instanceTapConfigName)
+	if w.opts.InstanceKeys == nil {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	key := ""
+	if inst.ServerTapKey != "" {
+		plain, err := w.opts.InstanceKeys.Open(inst.ServerTapKey)
+		if err != nil {
+			w.logger.Warnf("instance=%d stored servertap key unreadable, generating a new one: %v", inst.ID, err)
+		} else {
+			key = plain
+		}
+	}
+	if key == "" {
+		plain, sealed, err := w.opts.InstanceKeys.Generate()
+		if err != nil {
+			return err
+		}
+		key, inst.ServerTapKey = plain, sealed
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	content := fmt.Sprintf("port: %d\nuseKeyAuth: true\nkey: %q\n", w.opts.ServerTapPort, key)
+	return os.WriteFile(path, []byte(content), 0o600)
+}
+
+func (w *WorkerI) startCompose(ctx context.Context, instanceID int64) (string, error) {
 	composePath := filepath.Join(instanceDir(w.opts.InstanceRootDir, instanceID), "docker-compose.yml")
-	if err := ensureDockerNetwork(ctx, w.opts.InstanceNetwork); err != nil {
-		return fmt.Errorf("ensure network %s: %w", w.opts.InstanceNetwork, err)
+	if out, err := ensureDockerNetwork(ctx, w.runCmd, w.opts.InstanceNetwork); err != nil {
+		return out, fmt.Errorf("ensure network %s: %w", w.opts.InstanceNetwork, err)
 	}
-	return runCmd(ctx, "docker", "compose", "-f", composePath, "up", "-d")
+	return w.runCmd(ctx, "docker", "compose", "-f", composePath, "up", "-d")
 }
 
-func (w *WorkerI) stopCompose(ctx context.Context, instanceID int64) error {
+func (w *WorkerI) stopCompose(ctx context.Context, instanceID int64) (string, error) {
 	composePath := filepath.Join(instanceDir(w.opts.InstanceRootDir, instanceID), "docker-compose.yml")
-	return runCmd(ctx, "docker", "compose", "-f", composePath, "down")
+	return w.runCmd(ctx, "docker", "compose", "-f", composePath, "down")
+}
+
+// recordComposeOutput stores the output on inst; the next status update
+// persists it to map_instances.last_compose_output.
+func recordComposeOutput(inst *pgsql.MapInstance, output string) {
+	inst.LastComposeOutput = sql.NullString{String: output, Valid: output != ""}
 }
 
 func (w *WorkerI) archiveWorld(instanceID int64) error {
@@ -622,7 +2130,7 @@ func canTransit(from, to Status) bool {
 		StatusOn:        {StatusStopping: true},
 		StatusStopping:  {StatusOff: true},
 		StatusOff:       {StatusPreparing: true, StatusStarting: true, StatusArchived: true},
-		StatusArchived:  {},
+		StatusArchived:  {StatusPreparing: true},
 	}
 	if next, ok := allowed[from]; ok {
 		return next[to]
@@ -630,17 +2138,69 @@ func canTransit(from, to Status) bool {
 	return false
 }
 
+// runtimeImages maps game version prefixes to the jlink runtime image that
+// runs them; first match wins.
+var runtimeImages = []struct {
+	prefix string
+	image  string
+}{
+	{"1.16", "mcmm-mini:java16-jlink"},
+	{"1.17", "mcmm-mini:java17-jlink"},
+	{"1.18", "mcmm-mini:java17-jlink"},
+	{"1.19", "mcmm-mini:java17-jlink"},
+	{"1.20", "mcmm-mini:java17-jlink"},
+	{"1.21", "mcmm-mini:java21-jlink"},
+}
+
 func runtimeImageByVersion(version string) (string, error) {
-	switch {
-	case strings.HasPrefix(version, "1.16"):
-		return "mcmm-mini:java16-jlink", nil
-	case strings.HasPrefix(version, "1.17"), strings.HasPrefix(version, "1.18"), strings.HasPrefix(version, "1.19"), strings.HasPrefix(version, "1.20"):
-		return "mcmm-mini:java17-jlink", nil
-	case strings.HasPrefix(version, "1.21"):
-		return "mcmm-mini:java21-jlink", nil
-	default:
-		return "", fmt.Errorf("unsupported game version: %s", version)
+	for _, r := range runtimeImages {
+		if strings.HasPrefix(version, r.prefix) {
+			return r.image, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported game version: %s", version)
+}
+
+// SupportedVersions lists every supported version prefix with its runtime
+// image and the versions under VersionRootDir that have a paper jar.
+func (w *WorkerI) SupportedVersions() ([]VersionSupport, error) {
+	entries, err := os.ReadDir(w.opts.VersionRootDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	runnable := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := detectPaperJar(filepath.Join(w.opts.VersionRootDir, e.Name())); err == nil {
+			runnable = append(runnable, e.Name())
+		}
+	}
+	sort.Strings(runnable)
+	out := make([]VersionSupport, 0, len(runtimeImages))
+	for _, r := range runtimeImages {
+		vs := VersionSupport{Prefix: r.prefix, Image: r.image}
+		for _, v := range runnable {
+			if strings.HasPrefix(v, r.prefix) {
+				vs.Installed = append(vs.Installed, v)
+			}
+		}
+		out = append(out, vs)
+	}
+	return out, nil
+}
+
+// gameVersionPattern is what a game version looks like, e.g. 1.21 or 1.21.1.
+// It keeps a version from naming a path outside VersionRootDir.
+var gameVersionPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+){1,3}$`)
+
+// versionDir is the directory of version under VersionRootDir.
+func (w *WorkerI) versionDir(version string) (string, error) {
+	if !gameVersionPattern.MatchString(version) {
+		return "", fmt.Errorf("invalid game version %q", version)
 	}
+	return filepath.Join(w.opts.VersionRootDir, version), nil
 }
 
 func detectPaperJar(versionDir string) (string, error) {
@@ -676,25 +2236,69 @@ func resolveTemplateWorldPaths(input string) (templateRoot string, worldPath str
 	return filepath.Dir(clean), clean
 }
 
-func runCmd(ctx context.Context, bin string, args ...string) error {
+// containerName is the compose service and container name of an instance.
+func containerName(instanceID int64) string {
+	return ServerID(DefaultServerIDPrefix, instanceID)
+}
+
+// runCmd runs a command and returns its truncated combined output. Failures
+// come back as *CommandError so callers can persist what the tool said.
+func runCmd(ctx context.Context, bin string, args ...string) (string, error) {
 	cmd := exec.CommandContext(ctx, bin, args...)
 	out, err := cmd.CombinedOutput()
+	output := truncateCommandOutput(string(out))
 	if err != nil {
-		return fmt.Errorf("%s %s failed: %w, output=%s", bin, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+		return output, &CommandError{Command: bin + " " + strings.Join(args, " "), Output: output, Err: err}
 	}
-	return nil
+	return output, nil
 }
 
-func ensureDockerNetwork(ctx context.Context, network string) error {
+// truncateCommandOutput keeps the tail, where docker prints the actual error.
+func truncateCommandOutput(out string) string {
+	out = strings.TrimSpace(out)
+	if len(out) <= maxCommandOutputBytes {
+		return out
+	}
+	tail := out[len(out)-maxCommandOutputBytes:]
+	// Do not start in the middle of a UTF-8 sequence.
+	for len(tail) > 0 && !utf8.RuneStart(tail[0]) {
+		tail = tail[1:]
+	}
+	return "...(truncated)\n" + tail
+}
+
+func ensureDockerNetwork(ctx context.Context, run func(ctx context.Context, bin string, args ...string) (string, error), network string) (string, error) {
 	network = strings.TrimSpace(network)
 	if network == "" {
-		return nil
+		return "", nil
+	}
+	if _, inspectErr := run(ctx, "docker", "network", "inspect", network); inspectErr == nil {
+		return "", nil
 	}
-	inspectErr := runCmd(ctx, "docker", "network", "inspect", network)
-	if inspectErr == nil {
+	return run(ctx, "docker", "network", "create", "--driver", "bridge", network)
+}
+
+// dirSize sums the regular files under root; a missing root counts as empty.
+func dirSize(root string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		total += info.Size()
 		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
 	}
-	return runCmd(ctx, "docker", "network", "create", "--driver", "bridge", network)
+	return total, err
 }
 
 func isDir(path string) bool {
@@ -702,17 +2306,9 @@ func isDir(path string) bool {
 	return err == nil && st.IsDir()
 }
 
-func clearDir(path string) error {
-	entries, err := os.ReadDir(path)
-	if err != nil {
-		return err
-	}
-	for _, e := range entries {
-		if err := os.RemoveAll(filepath.Join(path, e.Name())); err != nil {
-			return err
-		}
-	}
-	return nil
+func fileExists(path string) bool {
+	st, err := os.Stat(path)
+	return err == nil && !st.IsDir()
 }
 
 func ensureFileWithDefault(path string, content []byte) error {
@@ -820,6 +2416,17 @@ func moveDir(src, dst string) error {
 	return os.RemoveAll(src)
 }
 
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
 func toNullTime(t time.Time) sql.NullTime {
 	return sql.NullTime{Time: t, Valid: true}
 }
@@ -829,25 +2436,81 @@ func toNullTimeZero() sql.NullTime {
 }
 
 func classifyHealthFailure(reason string) HealthStatus {
-	lower := strings.ToLower(reason)
-	if strings.Contains(lower, "context deadline exceeded") ||
-		strings.Contains(lower, "servertap") ||
-		strings.Contains(lower, "connection refused") ||
-		strings.Contains(lower, "i/o timeout") {
+	return healthForCode(ClassifyError(reason))
+}
+
+// healthForCode is the health status recorded for a failure with code.
+func healthForCode(code ErrorCode) HealthStatus {
+	switch code {
+	case CodeServerTapAuth:
+		return HealthAuthFailed
+	case CodeServerTapUnreachable:
 		return HealthUnreachable
 	}
 	return HealthStartFailed
 }
 
-func executeServerTapWithRetry(
+// ClassifyErr maps a worker failure to its ErrorCode by the error types in
+// its chain, falling back to ClassifyError on the message for plain errors.
+func ClassifyErr(err error) ErrorCode {
+	if err == nil {
+		return ""
+	}
+	var statusErr *servertap.StatusError
+	if errors.As(err, &statusErr) {
+		if statusErr.IsAuth() {
+			return CodeServerTapAuth
+		}
+		return CodeServerTapUnreachable
+	}
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		if strings.HasPrefix(cmdErr.Command, "docker ") {
+			return CodeDockerFailed
+		}
+		return CodeWorkerError
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return CodeServerTapUnreachable
+	}
+	return ClassifyError(err.Error())
+}
+
+// ClassifyError maps a worker failure message to its ErrorCode. It is for
+// messages that only survive as text, such as last_error_msg; live errors
+// go through ClassifyErr. Anything unrecognised is CodeWorkerError.
+func ClassifyError(reason string) ErrorCode {
+	lower := strings.ToLower(reason)
+	switch {
+	// Auth errors also mention "servertap", so they must be matched first.
+	case strings.Contains(lower, "servertap auth rejected"):
+		return CodeServerTapAuth
+	case strings.Contains(lower, "no paper jar found"),
+		strings.Contains(lower, "version dir missing"),
+		strings.Contains(lower, "copy core jar"):
+		return CodeJarMissing
+	case strings.Contains(lower, "unsupported game version"):
+		return CodeImageUnsupported
+	case strings.Contains(lower, "context deadline exceeded"),
+		strings.Contains(lower, "servertap"),
+		strings.Contains(lower, "connection refused"),
+		strings.Contains(lower, "i/o timeout"):
+		return CodeServerTapUnreachable
+	case strings.Contains(lower, "docker "):
+		return CodeDockerFailed
+	}
+	return CodeWorkerError
+}
+
+// executeServerTapWithRetry tries command up to maxRetries times, backing
+// off between tries (see serverTapBackoff). Auth errors are not retried and
+// a cancelled ctx aborts the wait.
+func (w *WorkerI) executeServerTapWithRetry(
 	ctx context.Context,
 	conn *servertap.Connector,
 	instanceID int64,
 	command string,
 	maxRetries int,
-	logger interface {
-		Warnf(string, ...any)
-	},
 ) error {
 	if maxRetries <= 0 {
 		maxRetries = 1
@@ -858,14 +2521,121 @@ func executeServerTapWithRetry(
 		if lastErr == nil {
 			return nil
 		}
+		if servertap.IsAuthError(lastErr) {
+			return lastErr
+		}
 		if i < maxRetries-1 {
-			logger.Warnf("instance=%d servertap command failed (%d/%d) cmd=%q err=%v", instanceID, i+1, maxRetries, command, lastErr)
-			time.Sleep(serverTapRetryDelay)
+			delay := w.serverTapBackoff(i + 1)
+			w.logger.Warnf("instance=%d servertap command failed (%d/%d), retrying in %s cmd=%q err=%v", instanceID, i+1, maxRetries, delay, command, lastErr)
+			if err := w.sleep(ctx, delay); err != nil {
+				return fmt.Errorf("%w (retry aborted: %w)", lastErr, err)
+			}
 		}
 	}
 	return lastErr
 }
 
+// serverTapBackoff is the wait after the given failed try (1-based): the base
+// delay doubled per try, capped at the max delay, then jittered into its
+// upper half.
+func (w *WorkerI) serverTapBackoff(try int) time.Duration {
+	d := w.opts.ServerTapRetryBaseDelay
+	for i := 1; i < try && d < w.opts.ServerTapRetryMaxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, w.opts.ServerTapRetryMaxDelay)
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
+
+// executeServerTapBatch sends commands in one pipelined batch and retries only
+// the failed ones sequentially.
+func (w *WorkerI) executeServerTapBatch(
+	ctx context.Context,
+	conn *servertap.Connector,
+	instanceID int64,
+	commands []string,
+) error {
+	if len(commands) == 0 {
+		return nil
+	}
+	reqs := make([]servertap.ExecuteRequest, len(commands))
+	for i, cmd := range commands {
+		reqs[i] = servertap.ExecuteRequest{Command: cmd}
+	}
+	_, err := conn.ExecuteBatch(ctx, reqs)
+	if err == nil {
+		return nil
+	}
+	if servertap.IsAuthError(err) {
+		return err
+	}
+	retry := make([]int, 0, len(commands))
+	var batchErr *servertap.BatchError
+	if errors.As(err, &batchErr) {
+		retry = batchErr.Failed()
+	} else {
+		for i := range commands {
+			retry = append(retry, i)
+		}
+	}
+	w.logger.Warnf("instance=%d servertap batch failed, retrying %d/%d commands sequentially: %v", instanceID, len(retry), len(commands), err)
+	for _, i := range retry {
+		if err := w.executeServerTapWithRetry(ctx, conn, instanceID, commands[i], w.opts.ServerTapMaxRetries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunSelfTestCycle exercises the full instance lifecycle against a throwaway alias.
+// On failure the instance is stopped but kept for inspection.
+func RunSelfTestCycle(ctx context.Context, repos pgsql.Repos, w Worker, cycle SelfTestCycle) SelfTestReport {
+	var report SelfTestReport
+	step := func(name string, fn func() error) bool {
+		started := time.Now()
+		err := fn()
+		report.Steps = append(report.Steps, SelfTestStep{Name: name, Duration: time.Since(started), Err: err})
+		return err == nil
+	}
+
+	ok := step("create_instance", func() error {
+		id, err := repos.MapInstance.Create(ctx, pgsql.MapInstance{
+			Alias:       cycle.Alias,
+			OwnerID:     cycle.OwnerID,
+			SourceType:  "empty",
+			GameVersion: cycle.GameVersion,
+			AccessMode:  "privacy",
+			Status:      string(StatusWaiting),
+		})
+		if err != nil {
+			existing, readErr := repos.MapInstance.ReadByAlias(ctx, cycle.Alias)
+			if readErr != nil {
+				return err
+			}
+			id = existing.ID
+		}
+		report.InstanceID = id
+		_, _ = repos.InstanceMember.Create(ctx, pgsql.InstanceMember{InstanceID: id, UserID: cycle.OwnerID, Role: "owner"})
+		return nil
+	})
+	if !ok {
+		return report
+	}
+	if !step("start_empty", func() error { return w.StartEmpty(ctx, report.InstanceID, cycle.GameVersion) }) {
+		_ = w.StopOnly(context.Background(), report.InstanceID)
+		return report
+	}
+	if !step("stop_archive", func() error { return w.StopAndArchive(ctx, report.InstanceID) }) {
+		return report
+	}
+	if !cycle.Cleanup {
+		return report
+	}
+	step("delete_archived", func() error { return w.DeleteArchived(ctx, report.InstanceID) })
+	return report
+}
+
 func Now() time.Time {
 	return time.Now()
 }
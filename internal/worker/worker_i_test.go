@@ -3,18 +3,30 @@ package worker
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"mcmm/internal/pgsql"
+	"mcmm/internal/servertap"
 )
 
 type mapInstanceRepoMock struct {
-	readFn   func(ctx context.Context, id int64) (pgsql.MapInstance, error)
-	updateFn func(ctx context.Context, inst pgsql.MapInstance) error
+	readFn         func(ctx context.Context, id int64) (pgsql.MapInstance, error)
+	updateFn       func(ctx context.Context, inst pgsql.MapInstance) error
+	listArchivedFn func(ctx context.Context) ([]pgsql.MapInstance, error)
+	listFn         func(ctx context.Context) ([]pgsql.MapInstance, error)
+	deleteFn       func(ctx context.Context, id int64) error
 }
 
 func (m mapInstanceRepoMock) Create(ctx context.Context, inst pgsql.MapInstance) (int64, error) {
@@ -30,12 +42,41 @@ func (m mapInstanceRepoMock) ListByOwner(ctx context.Context, ownerID int64) ([]
 	return nil, nil
 }
 func (m mapInstanceRepoMock) List(ctx context.Context) ([]pgsql.MapInstance, error) {
+	if m.listFn == nil {
+		return nil, nil
+	}
+	return m.listFn(ctx)
+}
+func (m mapInstanceRepoMock) CountByStatus(ctx context.Context) (map[string]int64, error) {
+	return nil, nil
+}
+func (m mapInstanceRepoMock) ListArchived(ctx context.Context) ([]pgsql.MapInstance, error) {
+	if m.listArchivedFn == nil {
+		return nil, nil
+	}
+	return m.listArchivedFn(ctx)
+}
+func (m mapInstanceRepoMock) ListAliasesWithPrefix(ctx context.Context, prefix string) ([]string, error) {
+	return nil, nil
+}
+func (m mapInstanceRepoMock) ListOrphanedOwners(ctx context.Context) ([]pgsql.MapInstance, error) {
+	return nil, nil
+}
+func (m mapInstanceRepoMock) ListStaleOn(ctx context.Context, olderThan time.Time) ([]pgsql.MapInstance, error) {
+	return nil, nil
+}
+func (m mapInstanceRepoMock) ListForUser(ctx context.Context, userID int64, includeArchived bool) ([]pgsql.UserInstance, error) {
 	return nil, nil
 }
 func (m mapInstanceRepoMock) Update(ctx context.Context, inst pgsql.MapInstance) error {
 	return m.updateFn(ctx, inst)
 }
-func (m mapInstanceRepoMock) Delete(ctx context.Context, id int64) error { return nil }
+func (m mapInstanceRepoMock) Delete(ctx context.Context, id int64) error {
+	if m.deleteFn == nil {
+		return nil
+	}
+	return m.deleteFn(ctx, id)
+}
 
 func TestRuntimeImageByVersion(t *testing.T) {
 	tests := []struct {
@@ -73,6 +114,9 @@ func TestCanTransit(t *testing.T) {
 	if !canTransit(StatusOff, StatusArchived) {
 		t.Fatalf("Off -> Archived should be allowed")
 	}
+	if !canTransit(StatusArchived, StatusPreparing) {
+		t.Fatalf("Archived -> Preparing should be allowed for restore")
+	}
 }
 
 func TestPrepareComposeFile(t *testing.T) {
@@ -103,7 +147,7 @@ func TestPrepareComposeFile(t *testing.T) {
 	if err != nil {
 		t.Fatalf("new worker failed: %v", err)
 	}
-	if err := w.prepareComposeFile(101, "1.21.1"); err != nil {
+	if err := w.prepareComposeFile(pgsql.MapInstance{ID: 101}, "1.21.1"); err != nil {
 		t.Fatalf("prepare compose failed: %v", err)
 	}
 
@@ -118,6 +162,27 @@ func TestPrepareComposeFile(t *testing.T) {
 	if !strings.Contains(content, "/data/server/cache") || !strings.Contains(content, "/data/server/versions") {
 		t.Fatalf("compose should include cache/versions mounts, got:\n%s", content)
 	}
+	if strings.Contains(content, "cpus:") || strings.Contains(content, "mem_limit:") {
+		t.Fatalf("compose should not set limits by default, got:\n%s", content)
+	}
+
+	w.opts.CPULimit = 1.5
+	w.opts.MemLimitMB = 3072
+	if err := w.prepareComposeFile(pgsql.MapInstance{ID: 101}, "1.21.1"); err != nil {
+		t.Fatalf("prepare compose failed: %v", err)
+	}
+	b, _ = os.ReadFile(filepath.Join(instRoot, "101", "docker-compose.yml"))
+	if !strings.Contains(string(b), "cpus: \"1.5\"") || !strings.Contains(string(b), "mem_limit: 3072m") {
+		t.Fatalf("compose should carry configured limits, got:\n%s", b)
+	}
+
+	if err := w.prepareComposeFile(pgsql.MapInstance{ID: 101, CPULimit: 0.5, MemLimitMB: 1024}, "1.21.1"); err != nil {
+		t.Fatalf("prepare compose failed: %v", err)
+	}
+	b, _ = os.ReadFile(filepath.Join(instRoot, "101", "docker-compose.yml"))
+	if !strings.Contains(string(b), "cpus: \"0.5\"") || !strings.Contains(string(b), "mem_limit: 1024m") {
+		t.Fatalf("instance limits should override the defaults, got:\n%s", b)
+	}
 }
 
 func TestSetStatusWithMockRepo(t *testing.T) {
@@ -159,6 +224,16 @@ func TestSetStatusWithMockRepo(t *testing.T) {
 	if !updated.UpdatedAt.Equal(now) {
 		t.Fatalf("updated_at mismatch: got=%v want=%v", updated.UpdatedAt, now)
 	}
+	if updated.StartedOnAt.Valid {
+		t.Fatalf("started_on_at should only be set on the way to On")
+	}
+	inst.Status = string(StatusStarting)
+	if err := w.setStatus(context.Background(), &inst, StatusOn); err != nil {
+		t.Fatalf("set status failed: %v", err)
+	}
+	if !updated.StartedOnAt.Valid || !updated.StartedOnAt.Time.Equal(now) {
+		t.Fatalf("started_on_at mismatch: got=%v want=%v", updated.StartedOnAt, now)
+	}
 }
 
 func TestResolveTemplateWorldPaths(t *testing.T) {
@@ -219,3 +294,2296 @@ func TestPrepareInstanceVolume_WorldOnlyTemplate(t *testing.T) {
 	}
 	_ = updated
 }
+
+func TestClassifyHealthFailure_AuthRejected(t *testing.T) {
+	err := &servertap.StatusError{StatusCode: 403, Body: "forbidden"}
+	got := classifyHealthFailure(fmt.Sprintf("configure access: %v", err))
+	if got != HealthAuthFailed {
+		t.Fatalf("403 should classify as %s, got=%s", HealthAuthFailed, got)
+	}
+	if got := classifyHealthFailure("configure access: servertap returned status=500 body=\"\""); got != HealthUnreachable {
+		t.Fatalf("500 should classify as %s, got=%s", HealthUnreachable, got)
+	}
+}
+
+func TestClassifyError_MapsFailuresToCodes(t *testing.T) {
+	cases := []struct {
+		reason string
+		want   ErrorCode
+	}{
+		{"prepare compose: no paper jar found under /data/versions/1.20.4", CodeJarMissing},
+		{"version dir missing: /data/versions/1.21.1", CodeJarMissing},
+		{"prepare compose for 1.12.2: unsupported game version: 1.12.2", CodeImageUnsupported},
+		{"configure access: " + (&servertap.StatusError{StatusCode: 401, Body: "nope"}).Error(), CodeServerTapAuth},
+		{"configure access: Post \"http://mc-5:4567/v1/server/exec\": dial tcp: connection refused", CodeServerTapUnreachable},
+		{"configure access: context deadline exceeded", CodeServerTapUnreachable},
+		{"start compose: " + (&CommandError{Command: "docker compose -f /x/docker-compose.yml up -d", Err: errors.New("exit status 1")}).Error(), CodeDockerFailed},
+		{"set starting: pq: connection reset by peer", CodeWorkerError},
+	}
+	for _, c := range cases {
+		if got := ClassifyError(c.reason); got != c.want {
+			t.Errorf("ClassifyError(%q) = %s, want %s", c.reason, got, c.want)
+		}
+	}
+	if got := classifyHealthFailure("prepare compose: no paper jar found under /v"); got != HealthStartFailed {
+		t.Fatalf("jar missing should be %s health, got=%s", HealthStartFailed, got)
+	}
+}
+
+func TestClassifyErr_UsesErrorTypesBeforeText(t *testing.T) {
+	cases := []struct {
+		err  error
+		want ErrorCode
+	}{
+		{fmt.Errorf("configure access: %w", &servertap.StatusError{StatusCode: 403}), CodeServerTapAuth},
+		// The body would read as a missing jar if only the text were checked.
+		{fmt.Errorf("configure access: %w", &servertap.StatusError{StatusCode: 500, Body: "no paper jar found"}), CodeServerTapUnreachable},
+		{fmt.Errorf("start compose: %w", &CommandError{Command: "docker compose -f /x/docker-compose.yml up -d", Err: errors.New("exit status 1")}), CodeDockerFailed},
+		{fmt.Errorf("pre_start hook: %w", &CommandError{Command: "/hooks/pre.sh start", Err: errors.New("connection refused")}), CodeWorkerError},
+		{fmt.Errorf("wait ready: %w", context.DeadlineExceeded), CodeServerTapUnreachable},
+		{errors.New("prepare compose for 1.12.2: unsupported game version: 1.12.2"), CodeImageUnsupported},
+		{nil, ""},
+	}
+	for _, c := range cases {
+		if got := ClassifyErr(c.err); got != c.want {
+			t.Errorf("ClassifyErr(%v) = %s, want %s", c.err, got, c.want)
+		}
+	}
+}
+
+type instanceMemberRepoMock struct {
+	pgsql.InstanceMemberRepo
+	members []pgsql.MemberWithUser
+}
+
+func (m instanceMemberRepoMock) Create(ctx context.Context, member pgsql.InstanceMember) (int64, error) {
+	return 1, nil
+}
+
+type cycleRepoMock struct {
+	mapInstanceRepoMock
+	deleted []int64
+}
+
+func (m *cycleRepoMock) Create(ctx context.Context, inst pgsql.MapInstance) (int64, error) {
+	return 55, nil
+}
+
+func (m *cycleRepoMock) Delete(ctx context.Context, id int64) error {
+	m.deleted = append(m.deleted, id)
+	return nil
+}
+
+type cycleWorkerMock struct {
+	Worker
+	calls    []string
+	startErr error
+}
+
+func (m *cycleWorkerMock) StartEmpty(ctx context.Context, instanceID int64, gameVersion string) error {
+	m.calls = append(m.calls, fmt.Sprintf("start:%d:%s", instanceID, gameVersion))
+	return m.startErr
+}
+
+func (m *cycleWorkerMock) StopOnly(ctx context.Context, instanceID int64) error {
+	m.calls = append(m.calls, fmt.Sprintf("stop:%d", instanceID))
+	return nil
+}
+
+func (m *cycleWorkerMock) StopAndArchive(ctx context.Context, instanceID int64) error {
+	m.calls = append(m.calls, fmt.Sprintf("archive:%d", instanceID))
+	return nil
+}
+
+func (m *cycleWorkerMock) DeleteArchived(ctx context.Context, instanceID int64) error {
+	m.calls = append(m.calls, fmt.Sprintf("delete:%d", instanceID))
+	return nil
+}
+
+func TestRunSelfTestCycle_PassesAndCleansUp(t *testing.T) {
+	instRepo := &cycleRepoMock{}
+	repos := pgsql.Repos{MapInstance: instRepo, InstanceMember: instanceMemberRepoMock{}}
+	wm := &cycleWorkerMock{}
+
+	report := RunSelfTestCycle(context.Background(), repos, wm, SelfTestCycle{
+		Alias:       "selftest-1",
+		OwnerID:     1,
+		GameVersion: "1.21.1",
+		Cleanup:     true,
+	})
+	if !report.Passed() {
+		t.Fatalf("expected pass, got: %s", report.Summary())
+	}
+	want := []string{"start:55:1.21.1", "archive:55", "delete:55"}
+	if strings.Join(wm.calls, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected worker calls: %v", wm.calls)
+	}
+	if len(report.Steps) != 4 {
+		t.Fatalf("expected 4 steps, got=%d (%s)", len(report.Steps), report.Summary())
+	}
+}
+
+func TestRunSelfTestCycle_StartFailureStopsEarly(t *testing.T) {
+	instRepo := &cycleRepoMock{}
+	repos := pgsql.Repos{MapInstance: instRepo, InstanceMember: instanceMemberRepoMock{}}
+	wm := &cycleWorkerMock{startErr: fmt.Errorf("compose up failed")}
+
+	report := RunSelfTestCycle(context.Background(), repos, wm, SelfTestCycle{
+		Alias:       "selftest-2",
+		OwnerID:     1,
+		GameVersion: "1.21.1",
+		Cleanup:     true,
+	})
+	if report.Passed() {
+		t.Fatalf("expected failure")
+	}
+	last := report.Steps[len(report.Steps)-1]
+	if last.Name != "start_empty" || last.Err == nil {
+		t.Fatalf("expected start_empty failure as last step, got: %s", report.Summary())
+	}
+	if len(instRepo.deleted) != 0 {
+		t.Fatalf("failed instance should be kept for inspection")
+	}
+}
+
+func TestSnapshot_TracksJobsAndQueuedStarts(t *testing.T) {
+	now := time.Date(2026, 2, 13, 0, 0, 0, 0, time.UTC)
+	w, err := NewWorkerI(pgsql.Repos{}, Options{
+		InstanceRootDir:     t.TempDir(),
+		VersionRootDir:      t.TempDir(),
+		ComposeTemplateDir:  t.TempDir(),
+		MaxConcurrentStarts: 1,
+		Now:                 func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("new worker failed: %v", err)
+	}
+
+	_, release, err := w.acquireStartSlot(context.Background(), 1, "start")
+	if err != nil {
+		t.Fatalf("acquire slot: %v", err)
+	}
+	doneStop := w.beginJob(3, "stop")
+
+	acquired := make(chan func())
+	go func() {
+		_, r, err := w.acquireStartSlot(context.Background(), 2, "start_existing")
+		if err != nil {
+			t.Errorf("queued acquire: %v", err)
+			close(acquired)
+			return
+		}
+		acquired <- r
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	var snap StateSnapshot
+	for time.Now().Before(deadline) {
+		snap = w.Snapshot()
+		if len(snap.QueuedStarts) == 1 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if snap.StartSlotsInUse != 1 || snap.StartSlotsTotal != 1 {
+		t.Fatalf("unexpected slot usage: %+v", snap)
+	}
+	if len(snap.QueuedStarts) != 1 || snap.QueuedStarts[0].InstanceID != 2 {
+		t.Fatalf("expected instance 2 queued, got=%+v", snap.QueuedStarts)
+	}
+	if len(snap.Jobs) != 2 || snap.Jobs[0].InstanceID != 1 || snap.Jobs[1].Operation != "stop" {
+		t.Fatalf("unexpected jobs: %+v", snap.Jobs)
+	}
+
+	release()
+	doneStop()
+	r2 := <-acquired
+	if r2 == nil {
+		t.Fatalf("queued start never acquired a slot")
+	}
+	snap = w.Snapshot()
+	if len(snap.QueuedStarts) != 0 || len(snap.Jobs) != 1 || snap.Jobs[0].Operation != "start_existing" {
+		t.Fatalf("unexpected snapshot after release: %+v", snap)
+	}
+	r2()
+	if snap = w.Snapshot(); len(snap.Jobs) != 0 || snap.StartSlotsInUse != 0 {
+		t.Fatalf("expected idle worker, got=%+v", snap)
+	}
+}
+
+func TestSnapshot_UnlimitedStartsKeepOverlappingJobsOnOneInstance(t *testing.T) {
+	w, err := NewWorkerI(pgsql.Repos{}, Options{
+		InstanceRootDir:    t.TempDir(),
+		VersionRootDir:     t.TempDir(),
+		ComposeTemplateDir: t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("new worker failed: %v", err)
+	}
+
+	startID, releaseStart, err := w.acquireStartSlot(context.Background(), 7, "start")
+	if err != nil {
+		t.Fatalf("acquire slot: %v", err)
+	}
+	_, releaseOther, err := w.acquireStartSlot(context.Background(), 8, "start")
+	if err != nil {
+		t.Fatalf("unlimited starts should never wait: %v", err)
+	}
+	doneStop := w.beginJob(7, "stop")
+	w.setJobAttempt(startID, 2)
+
+	snap := w.Snapshot()
+	if snap.StartSlotsTotal != 0 || len(snap.QueuedStarts) != 0 {
+		t.Fatalf("expected no start slots without a limit, got=%+v", snap)
+	}
+	if len(snap.Jobs) != 3 {
+		t.Fatalf("expected both jobs on instance 7 and the one on 8, got=%+v", snap.Jobs)
+	}
+	var sawStart, sawStop bool
+	for _, j := range snap.Jobs {
+		if j.InstanceID != 7 {
+			continue
+		}
+		switch j.Operation {
+		case "start":
+			sawStart = j.Attempt == 2
+		case "stop":
+			sawStop = true
+		}
+	}
+	if !sawStart || !sawStop {
+		t.Fatalf("a later job on the same instance must not replace the earlier one: %+v", snap.Jobs)
+	}
+
+	doneStop()
+	snap = w.Snapshot()
+	if len(snap.Jobs) != 2 || snap.Jobs[0].ID != startID || snap.Jobs[0].Operation != "start" {
+		t.Fatalf("finishing the stop should leave the start listed, got=%+v", snap.Jobs)
+	}
+	releaseStart()
+	releaseOther()
+	if snap = w.Snapshot(); len(snap.Jobs) != 0 {
+		t.Fatalf("expected idle worker, got=%+v", snap)
+	}
+}
+
+func TestAccessPlan_GrantsEachPlayerOnce(t *testing.T) {
+	plan := &accessPlan{processed: map[string]struct{}{}}
+	plan.allowAndOp("Admin")
+	plan.allowAndOp("admin")
+	plan.allow("Owner_Two")
+	plan.allow("")
+	plan.allowAndOp("owner_two")
+	plan.allow("bad name\nop mallory")
+
+	want := []string{"whitelist add Admin", "op Admin", "whitelist add Owner_Two", "deop Owner_Two"}
+	if len(plan.rejected) != 1 || plan.rejected[0] != "bad name\nop mallory" {
+		t.Fatalf("invalid name should be rejected, got=%q", plan.rejected)
+	}
+	if len(plan.commands) != len(want) {
+		t.Fatalf("unexpected commands: %v", plan.commands)
+	}
+	for i := range want {
+		if plan.commands[i] != want[i] {
+			t.Fatalf("command %d mismatch: got=%q want=%q", i, plan.commands[i], want[i])
+		}
+	}
+}
+
+type recordingExecutor struct {
+	commands []string
+}
+
+func (r *recordingExecutor) Execute(ctx context.Context, req servertap.ExecuteRequest) (servertap.ParsedResponse, error) {
+	r.commands = append(r.commands, req.Command)
+	return servertap.ParsedResponse{StatusCode: 200}, nil
+}
+
+func TestRegisterMultiverseWorld_ImportsNewInstance(t *testing.T) {
+	exec := &recordingExecutor{}
+	inst := pgsql.MapInstance{ID: 42, Alias: "alice_castle"}
+	if err := registerMultiverseWorld(context.Background(), exec, inst); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	want := []string{"mv import i_42 NORMAL", "mvm set alias alice_castle i_42"}
+	if len(exec.commands) != len(want) {
+		t.Fatalf("unexpected commands: %v", exec.commands)
+	}
+	for i := range want {
+		if exec.commands[i] != want[i] {
+			t.Fatalf("command %d mismatch: got=%q want=%q", i, exec.commands[i], want[i])
+		}
+	}
+}
+
+// tapRecorder records ServerTap commands. The request right after "stop"
+// fails like a server that has shut down (all instances share one server).
+type tapRecorder struct {
+	mu       sync.Mutex
+	commands []string
+	stopped  bool
+}
+
+func (r *tapRecorder) handler(fail bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		r.commands = append(r.commands, req.FormValue("command"))
+		down := r.stopped
+		r.stopped = req.FormValue("command") == "stop"
+		r.mu.Unlock()
+		if fail || down {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}
+}
+
+func newMultiverseStopWorker(t *testing.T, tapURL string, status Status) (*WorkerI, *[]string) {
+	t.Helper()
+	inst := pgsql.MapInstance{ID: 7, Alias: "alice_castle", Status: string(status)}
+	repos := pgsql.Repos{MapInstance: mapInstanceRepoMock{
+		readFn: func(ctx context.Context, id int64) (pgsql.MapInstance, error) { return inst, nil },
+		updateFn: func(ctx context.Context, updated pgsql.MapInstance) error {
+			inst = updated
+			return nil
+		},
+	}}
+	root := t.TempDir()
+	w, err := NewWorkerI(repos, Options{
+		InstanceRootDir:       filepath.Join(root, "instance"),
+		VersionRootDir:        t.TempDir(),
+		ComposeTemplateDir:    t.TempDir(),
+		ArchiveRootDir:        filepath.Join(root, "archived"),
+		InstanceTapURLPattern: tapURL + "/inst-%d",
+		ServerTapTimeout:      2 * time.Second,
+		MultiverseImport:      true,
+	})
+	if err != nil {
+		t.Fatalf("new worker failed: %v", err)
+	}
+	if err := os.MkdirAll(instanceDir(w.opts.InstanceRootDir, 7), 0o755); err != nil {
+		t.Fatalf("mkdir instance: %v", err)
+	}
+	var cmds []string
+	w.runCmd = func(ctx context.Context, bin string, args ...string) (string, error) {
+		cmds = append(cmds, bin+" "+strings.Join(args, " "))
+		return "", nil
+	}
+	return w, &cmds
+}
+
+func TestAllowAndOpUser_GrantsOnRunningInstancesOnly(t *testing.T) {
+	rec := &tapRecorder{}
+	srv := httptest.NewServer(rec.handler(false))
+	defer srv.Close()
+	w, _ := newMultiverseStopWorker(t, srv.URL, StatusOn)
+	w.repos.MapInstance = mapInstanceRepoMock{listFn: func(ctx context.Context) ([]pgsql.MapInstance, error) {
+		return []pgsql.MapInstance{
+			{ID: 1, Status: string(StatusOn)},
+			{ID: 2, Status: string(StatusOff)},
+			{ID: 3, Status: string(StatusOn)},
+			{ID: 4, Status: string(StatusArchived)},
+		}, nil
+	}}
+
+	granted, err := w.AllowAndOpUser(context.Background(), "Carol")
+	if err != nil {
+		t.Fatalf("grant failed: %v", err)
+	}
+	if len(granted) != 2 || granted[0] != 1 || granted[1] != 3 {
+		t.Fatalf("expected instances 1 and 3, got=%v", granted)
+	}
+	sort.Strings(rec.commands)
+	want := []string{"op Carol", "op Carol", "whitelist add Carol", "whitelist add Carol"}
+	if strings.Join(rec.commands, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected commands: %v", rec.commands)
+	}
+
+	if _, err := w.AllowAndOpUser(context.Background(), "bad name"); err == nil {
+		t.Fatalf("invalid player names should be refused")
+	}
+}
+
+func TestStopOnly_UnloadsMultiverseWorld(t *testing.T) {
+	rec := &tapRecorder{}
+	srv := httptest.NewServer(rec.handler(false))
+	defer srv.Close()
+	w, cmds := newMultiverseStopWorker(t, srv.URL, StatusOn)
+
+	if err := w.StopOnly(context.Background(), 7); err != nil {
+		t.Fatalf("stop failed: %v", err)
+	}
+	if got := strings.Join(rec.commands, ","); got != "mv unload i_7,save-all flush,stop,list" {
+		t.Fatalf("expected mv unload then a graceful stop, got=%v", rec.commands)
+	}
+	if len(*cmds) != 1 || !strings.HasSuffix((*cmds)[0], " down") {
+		t.Fatalf("expected compose down, got=%v", *cmds)
+	}
+}
+
+func TestStopAndArchive_RemovesMultiverseWorldEvenOnFailure(t *testing.T) {
+	rec := &tapRecorder{}
+	srv := httptest.NewServer(rec.handler(true))
+	defer srv.Close()
+	w, cmds := newMultiverseStopWorker(t, srv.URL, StatusOn)
+
+	if err := w.StopAndArchive(context.Background(), 7); err != nil {
+		t.Fatalf("archive should not be blocked by multiverse failure: %v", err)
+	}
+	if got := strings.Join(rec.commands, ","); got != "mv remove i_7,save-all flush" {
+		t.Fatalf("expected mv remove and no stop after a failed save, got=%v", rec.commands)
+	}
+	if len(*cmds) != 1 {
+		t.Fatalf("expected compose down, got=%v", *cmds)
+	}
+	if !isDir(w.archiveDirPath(7)) {
+		t.Fatalf("world should be archived")
+	}
+}
+
+func TestExecuteServerTapWithRetry_BacksOffExponentially(t *testing.T) {
+	rec := &tapRecorder{}
+	srv := httptest.NewServer(rec.handler(true))
+	defer srv.Close()
+	w, _ := newMultiverseStopWorker(t, srv.URL, StatusOn)
+	w.opts.ServerTapRetryBaseDelay = time.Second
+	w.opts.ServerTapRetryMaxDelay = 4 * time.Second
+	var waits []time.Duration
+	w.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	conn, err := servertap.NewConnector(srv.URL, 2*time.Second)
+	if err != nil {
+		t.Fatalf("connector: %v", err)
+	}
+
+	if err := w.executeServerTapWithRetry(context.Background(), conn, 7, "save-all", 5); err == nil {
+		t.Fatalf("expected failure from failing servertap")
+	}
+	if len(rec.commands) != 5 || len(waits) != 4 {
+		t.Fatalf("expected 5 tries and 4 waits, got tries=%d waits=%v", len(rec.commands), waits)
+	}
+	// Each wait is jittered into the upper half of 1s, 2s, 4s, 4s (capped),
+	// so the ranges never overlap downwards.
+	ceilings := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second}
+	for i, d := range waits {
+		if d < ceilings[i]/2 || d > ceilings[i] {
+			t.Fatalf("wait %d=%s outside [%s, %s]", i+1, d, ceilings[i]/2, ceilings[i])
+		}
+	}
+}
+
+func TestExecuteServerTapWithRetry_CancelledContextAbortsWait(t *testing.T) {
+	rec := &tapRecorder{}
+	srv := httptest.NewServer(rec.handler(true))
+	defer srv.Close()
+	w, _ := newMultiverseStopWorker(t, srv.URL, StatusOn)
+	w.opts.ServerTapRetryBaseDelay = time.Minute
+	w.opts.ServerTapRetryMaxDelay = time.Minute
+	conn, err := servertap.NewConnector(srv.URL, 2*time.Second)
+	if err != nil {
+		t.Fatalf("connector: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	err = w.executeServerTapWithRetry(ctx, conn, 7, "save-all", 3)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Fatalf("cancelled retry should return promptly, took %s", elapsed)
+	}
+	if len(rec.commands) != 1 {
+		t.Fatalf("no retry should be sent after cancellation, got %v", rec.commands)
+	}
+}
+
+func TestCapacity_AggregatesInstancesMemoryAndDisk(t *testing.T) {
+	repos := pgsql.Repos{MapInstance: mapInstanceRepoMock{listFn: func(ctx context.Context) ([]pgsql.MapInstance, error) {
+		return []pgsql.MapInstance{
+			{ID: 1, Status: string(StatusOn)},
+			{ID: 2, Status: string(StatusOn), MemLimitMB: 4096},
+			{ID: 3, Status: string(StatusOff), MemLimitMB: 8192},
+			{ID: 4, Status: string(StatusArchived)},
+		}, nil
+	}}}
+	w, err := NewWorkerI(repos, Options{
+		InstanceRootDir:     "/srv/instance",
+		VersionRootDir:      t.TempDir(),
+		ComposeTemplateDir:  t.TempDir(),
+		ArchiveRootDir:      "/srv/archived",
+		MemLimitMB:          2048,
+		MaxConcurrentStarts: 2,
+	})
+	if err != nil {
+		t.Fatalf("new worker failed: %v", err)
+	}
+	w.hostMem = func() (int64, error) { return 16384, nil }
+	w.diskFree = func(path string) (uint64, error) {
+		switch path {
+		case "/srv/instance":
+			return 50 << 30, nil
+		case "/srv/archived":
+			return 0, &os.PathError{Op: "statfs", Path: path, Err: os.ErrNotExist}
+		}
+		return 0, fmt.Errorf("unexpected path %s", path)
+	}
+
+	report, err := w.Capacity(context.Background())
+	if err != nil {
+		t.Fatalf("capacity failed: %v", err)
+	}
+	want := CapacityReport{
+		TotalInstances:   3,
+		RunningInstances: 2,
+		RunningHeapMB:    2048 + 4096,
+		HostMemoryMB:     16384,
+		InstanceDiskFree: 50 << 30,
+		StartSlotsTotal:  2,
+	}
+	if report != want {
+		t.Fatalf("unexpected report:\n got=%+v\nwant=%+v", report, want)
+	}
+
+	w.hostMem = func() (int64, error) { return 0, errors.New("no meminfo") }
+	if _, err := w.Capacity(context.Background()); err == nil || !strings.Contains(err.Error(), "host memory") {
+		t.Fatalf("host memory failure should surface, got %v", err)
+	}
+}
+
+func TestReconfigureAccess_ReappliesAccessAndMarksHealthy(t *testing.T) {
+	rec := &tapRecorder{}
+	srv := httptest.NewServer(rec.handler(false))
+	defer srv.Close()
+	w, _ := newMultiverseStopWorker(t, srv.URL, StatusOn)
+	w.opts.MultiverseImport = false
+	w.repos.User = startUserRepoMock{}
+	w.repos.InstanceMember = instanceMemberRepoMock{}
+	inst, _ := w.repos.MapInstance.Read(context.Background(), 7)
+	inst.HealthStatus = string(HealthUnreachable)
+	inst.LastErrorMsg = sql.NullString{String: "connection refused", Valid: true}
+	_ = w.repos.MapInstance.Update(context.Background(), inst)
+	w.runCmd = func(ctx context.Context, bin string, args ...string) (string, error) {
+		if strings.Join(args, " ") != "inspect -f {{.RestartCount}} mcmm-inst-7" {
+			t.Fatalf("unexpected command: %v", args)
+		}
+		return "2\n", nil
+	}
+
+	if n, err := w.RestartCount(context.Background(), 7); err != nil || n != 2 {
+		t.Fatalf("restart count: n=%d err=%v", n, err)
+	}
+	if err := w.ReconfigureAccess(context.Background(), 7); err != nil {
+		t.Fatalf("reconfigure failed: %v", err)
+	}
+	inst, _ = w.repos.MapInstance.Read(context.Background(), 7)
+	if inst.HealthStatus != string(HealthHealthy) || inst.LastErrorMsg.Valid || inst.Status != string(StatusOn) {
+		t.Fatalf("instance should be On and healthy again, got %+v", inst)
+	}
+	if !slices.Contains(rec.commands, "whitelist on") || !slices.Contains(rec.commands, "op LCMonitor") {
+		t.Fatalf("access should be configured again, got %v", rec.commands)
+	}
+}
+
+func TestRefreshMultiverseAlias_OnlySetsTheAlias(t *testing.T) {
+	rec := &tapRecorder{}
+	srv := httptest.NewServer(rec.handler(false))
+	defer srv.Close()
+	w, _ := newMultiverseStopWorker(t, srv.URL, StatusOn)
+
+	if err := w.RefreshMultiverseAlias(context.Background(), 7); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if !slices.Equal(rec.commands, []string{"mvm set alias alice_castle i_7"}) {
+		t.Fatalf("a rename should only touch the Multiverse alias, got %v", rec.commands)
+	}
+
+	w.opts.MultiverseImport = false
+	if err := w.RefreshMultiverseAlias(context.Background(), 7); err != nil || len(rec.commands) != 1 {
+		t.Fatalf("without multiverse_import nothing should be sent: err=%v commands=%v", err, rec.commands)
+	}
+}
+
+func TestReconfigureAccess_DoesNotRevertAStopThatLandedMeanwhile(t *testing.T) {
+	var w *WorkerI
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.FormValue("command") == "whitelist on" {
+			inst, _ := w.repos.MapInstance.Read(req.Context(), 7)
+			inst.Status = string(StatusOff)
+			_ = w.repos.MapInstance.Update(req.Context(), inst)
+		}
+		_, _ = rw.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	w, _ = newMultiverseStopWorker(t, srv.URL, StatusOn)
+	w.opts.MultiverseImport = false
+	w.repos.User = startUserRepoMock{}
+	w.repos.InstanceMember = instanceMemberRepoMock{}
+
+	if err := w.ReconfigureAccess(context.Background(), 7); err != nil {
+		t.Fatalf("reconfigure failed: %v", err)
+	}
+	inst, _ := w.repos.MapInstance.Read(context.Background(), 7)
+	if inst.Status != string(StatusOff) {
+		t.Fatalf("a stop during reconfigure must survive, got status=%s", inst.Status)
+	}
+}
+
+func TestStopOnly_SavesAndStopsInGameBeforeComposeDown(t *testing.T) {
+	var mu sync.Mutex
+	var steps []string
+	stopped := false
+	stayUp := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		cmd := req.FormValue("command")
+		steps = append(steps, "tap "+cmd)
+		if stopped && !stayUp {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		stopped = stopped || cmd == "stop"
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	w, _ := newMultiverseStopWorker(t, srv.URL, StatusOn)
+	w.opts.MultiverseImport = false
+	w.runCmd = func(ctx context.Context, bin string, args ...string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		steps = append(steps, "compose "+args[len(args)-1])
+		return "", nil
+	}
+
+	if err := w.StopOnly(context.Background(), 7); err != nil {
+		t.Fatalf("stop failed: %v", err)
+	}
+	if got := strings.Join(steps, ","); got != "tap save-all flush,tap stop,tap list,compose down" {
+		t.Fatalf("save-all and stop must precede compose down, got %s", got)
+	}
+
+	// A server that never goes away is taken down once PreStopTimeout passes.
+	inst, _ := w.repos.MapInstance.Read(context.Background(), 7)
+	inst.Status = string(StatusOn)
+	_ = w.repos.MapInstance.Update(context.Background(), inst)
+	steps, stopped, stayUp = nil, false, true
+	w.opts.PreStopTimeout = 200 * time.Millisecond
+	w.sleep = func(ctx context.Context, d time.Duration) error { return sleepCtx(ctx, 20*time.Millisecond) }
+	started := time.Now()
+	if err := w.StopOnly(context.Background(), 7); err != nil {
+		t.Fatalf("stop failed: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Fatalf("pre-stop wait should end at the timeout, took %s", elapsed)
+	}
+	if len(steps) == 0 || steps[len(steps)-1] != "compose down" {
+		t.Fatalf("compose down should follow the timeout, got %v", steps)
+	}
+}
+
+func newDrainWorker(t *testing.T, tapURL string, instances map[int64]*pgsql.MapInstance) (*WorkerI, *[]string) {
+	t.Helper()
+	var mu sync.Mutex
+	repos := pgsql.Repos{MapInstance: mapInstanceRepoMock{
+		readFn: func(ctx context.Context, id int64) (pgsql.MapInstance, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return *instances[id], nil
+		},
+		listFn: func(ctx context.Context) ([]pgsql.MapInstance, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			out := make([]pgsql.MapInstance, 0, len(instances))
+			for id := int64(1); id <= int64(len(instances)); id++ {
+				out = append(out, *instances[id])
+			}
+			return out, nil
+		},
+		updateFn: func(ctx context.Context, updated pgsql.MapInstance) error {
+			mu.Lock()
+			defer mu.Unlock()
+			*instances[updated.ID] = updated
+			return nil
+		},
+	}}
+	w, err := NewWorkerI(repos, Options{
+		InstanceRootDir:       t.TempDir(),
+		VersionRootDir:        t.TempDir(),
+		ComposeTemplateDir:    t.TempDir(),
+		InstanceTapURLPattern: tapURL + "/inst-%d",
+		ServerTapTimeout:      2 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new worker failed: %v", err)
+	}
+	var downs []string
+	w.runCmd = func(ctx context.Context, bin string, args ...string) (string, error) {
+		downs = append(downs, args[len(args)-2]+" "+args[len(args)-1])
+		return "", nil
+	}
+	return w, &downs
+}
+
+func TestDrainAll_SavesThenStopsEveryRunningInstance(t *testing.T) {
+	rec := &tapRecorder{}
+	srv := httptest.NewServer(rec.handler(false))
+	defer srv.Close()
+	instances := map[int64]*pgsql.MapInstance{
+		1: {ID: 1, Status: string(StatusOn)},
+		2: {ID: 2, Status: string(StatusOff)},
+		3: {ID: 3, Status: string(StatusOn)},
+	}
+	w, downs := newDrainWorker(t, srv.URL, instances)
+
+	stopped, err := w.DrainAll(context.Background())
+	if err != nil {
+		t.Fatalf("drain failed: %v", err)
+	}
+	if len(stopped) != 2 || stopped[0] != 1 || stopped[1] != 3 {
+		t.Fatalf("expected instances 1 and 3 drained, got=%v", stopped)
+	}
+	if got := strings.Join(rec.commands, ","); got != "save-all flush,stop,list,save-all flush,stop,list" {
+		t.Fatalf("expected a save-all and stop per running instance, got=%v", rec.commands)
+	}
+	if len(*downs) != 2 {
+		t.Fatalf("expected two compose downs, got=%v", *downs)
+	}
+	for id, inst := range instances {
+		if inst.Status != string(StatusOff) {
+			t.Fatalf("instance %d should end Off, got %s", id, inst.Status)
+		}
+	}
+}
+
+func TestDrainAll_StopsEvenWhenSaveFailsAndHonoursDeadline(t *testing.T) {
+	rec := &tapRecorder{}
+	srv := httptest.NewServer(rec.handler(true))
+	defer srv.Close()
+	instances := map[int64]*pgsql.MapInstance{
+		1: {ID: 1, Status: string(StatusOn)},
+	}
+	w, downs := newDrainWorker(t, srv.URL, instances)
+	if stopped, err := w.DrainAll(context.Background()); err != nil || len(stopped) != 1 || len(*downs) != 1 {
+		t.Fatalf("a failed save-all must not block the stop: stopped=%v err=%v downs=%v", stopped, err, *downs)
+	}
+
+	instances[1].Status = string(StatusOn)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stopped, err := w.DrainAll(ctx)
+	if err == nil || !strings.Contains(err.Error(), "instance 1: not drained") || len(stopped) != 0 {
+		t.Fatalf("past the deadline nothing should be stopped: stopped=%v err=%v", stopped, err)
+	}
+	if len(*downs) != 1 || instances[1].Status != string(StatusOn) {
+		t.Fatalf("instance should be left running, downs=%v status=%s", *downs, instances[1].Status)
+	}
+}
+
+func TestStopOnly_SkipsMultiverseWhenAlreadyStopping(t *testing.T) {
+	rec := &tapRecorder{}
+	srv := httptest.NewServer(rec.handler(false))
+	defer srv.Close()
+	w, _ := newMultiverseStopWorker(t, srv.URL, StatusStarting)
+
+	_ = w.StopOnly(context.Background(), 7)
+	if len(rec.commands) != 0 {
+		t.Fatalf("multiverse should only be touched for On instances, got=%v", rec.commands)
+	}
+}
+
+func TestRestoreArchived_MovesWorldBackAndTurnsOff(t *testing.T) {
+	inst := pgsql.MapInstance{
+		ID:         9,
+		Status:     string(StatusArchived),
+		ArchivedAt: sql.NullTime{Time: time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+	}
+	var transitions []string
+	repos := pgsql.Repos{MapInstance: mapInstanceRepoMock{
+		readFn: func(ctx context.Context, id int64) (pgsql.MapInstance, error) { return inst, nil },
+		updateFn: func(ctx context.Context, updated pgsql.MapInstance) error {
+			transitions = append(transitions, updated.Status)
+			inst = updated
+			return nil
+		},
+	}}
+	root := t.TempDir()
+	w, err := NewWorkerI(repos, Options{
+		InstanceRootDir:    filepath.Join(root, "instance"),
+		VersionRootDir:     t.TempDir(),
+		ComposeTemplateDir: t.TempDir(),
+		ArchiveRootDir:     filepath.Join(root, "archived"),
+	})
+	if err != nil {
+		t.Fatalf("new worker failed: %v", err)
+	}
+	archived := filepath.Join(w.archiveDirPath(9), "data", "world")
+	if err := os.MkdirAll(archived, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(archived, "level.dat"), []byte("lvl"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.RestoreArchived(context.Background(), 9); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	restored := filepath.Join(instanceDir(w.opts.InstanceRootDir, 9), "data", "world", "level.dat")
+	if b, err := os.ReadFile(restored); err != nil || string(b) != "lvl" {
+		t.Fatalf("world not restored: %v", err)
+	}
+	if isDir(w.archiveDirPath(9)) {
+		t.Fatalf("archive dir should be moved away")
+	}
+	if got := strings.Join(transitions, ","); got != "Preparing,Off" {
+		t.Fatalf("unexpected transitions: %s", got)
+	}
+	if inst.ArchivedAt.Valid {
+		t.Fatalf("archived_at should be cleared")
+	}
+
+	inst.Status = string(StatusArchived)
+	if err := w.RestoreArchived(context.Background(), 9); !errors.Is(err, ErrArchiveMissing) {
+		t.Fatalf("expected ErrArchiveMissing, got %v", err)
+	}
+}
+
+func TestRestoreArchived_ReassignsHostPortTakenWhileArchived(t *testing.T) {
+	var mu sync.Mutex
+	store := map[int64]pgsql.MapInstance{
+		// The restored world had 30000 before it was archived.
+		9: {ID: 9, Status: string(StatusArchived), GameVersion: "1.21.1", HostPort: 30000},
+		1: {ID: 1, Status: string(StatusOn), HostPort: 30000},
+	}
+	repos := pgsql.Repos{MapInstance: mapInstanceRepoMock{
+		readFn: func(ctx context.Context, id int64) (pgsql.MapInstance, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return store[id], nil
+		},
+		listFn: func(ctx context.Context) ([]pgsql.MapInstance, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			out := make([]pgsql.MapInstance, 0, len(store))
+			for _, inst := range store {
+				out = append(out, inst)
+			}
+			return out, nil
+		},
+		updateFn: func(ctx context.Context, inst pgsql.MapInstance) error {
+			mu.Lock()
+			defer mu.Unlock()
+			store[inst.ID] = inst
+			return nil
+		},
+	}}
+	root := t.TempDir()
+	versionRoot := t.TempDir()
+	writeTestPaperJar(t, versionRoot, "1.21.1")
+	w, err := NewWorkerI(repos, Options{
+		InstanceRootDir:    filepath.Join(root, "instance"),
+		VersionRootDir:     versionRoot,
+		ComposeTemplateDir: t.TempDir(),
+		ArchiveRootDir:     filepath.Join(root, "archived"),
+		HostPortMin:        30000,
+		HostPortMax:        30009,
+	})
+	if err != nil {
+		t.Fatalf("new worker failed: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(w.archiveDirPath(9), "world"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	stale := "services:\n  mc:\n    ports:\n      - \"30000:25565\"\n"
+	if err := os.WriteFile(filepath.Join(w.archiveDirPath(9), "docker-compose.yml"), []byte(stale), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.RestoreArchived(context.Background(), 9); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	got := store[9]
+	if got.Status != string(StatusOff) || got.HostPort != 30001 {
+		t.Fatalf("restored world should be Off on a free port, got status=%s port=%d", got.Status, got.HostPort)
+	}
+	b, err := os.ReadFile(filepath.Join(instanceDir(w.opts.InstanceRootDir, 9), "docker-compose.yml"))
+	if err != nil {
+		t.Fatalf("read compose: %v", err)
+	}
+	if !strings.Contains(string(b), "\"30001:25565\"") || strings.Contains(string(b), "30000:") {
+		t.Fatalf("compose should be re-rendered for the new port, got:\n%s", b)
+	}
+}
+
+type startUserRepoMock struct {
+	pgsql.UserRepo
+	admins []pgsql.User
+}
+
+func (m startUserRepoMock) ListByRole(ctx context.Context, role string) ([]pgsql.User, error) {
+	return m.admins, nil
+}
+
+func (m startUserRepoMock) Read(ctx context.Context, id int64) (pgsql.User, error) {
+	return pgsql.User{ID: id, MCName: "alice"}, nil
+}
+
+func (m instanceMemberRepoMock) ListByInstance(ctx context.Context, instanceID int64) ([]pgsql.InstanceMember, error) {
+	return nil, nil
+}
+
+func (m instanceMemberRepoMock) ListWithUsers(ctx context.Context, instanceID int64) ([]pgsql.MemberWithUser, error) {
+	return m.members, nil
+}
+
+func newRetryStartWorker(t *testing.T, tapURL string, withJar bool) (*WorkerI, *[]string, *[]time.Duration) {
+	t.Helper()
+	tmp := t.TempDir()
+	versionDir := filepath.Join(tmp, "version", "1.21.1")
+	if err := os.MkdirAll(versionDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if withJar {
+		if err := os.WriteFile(filepath.Join(versionDir, "paper-1.21.1-133.jar"), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	inst := pgsql.MapInstance{ID: 12, OwnerID: 1, Alias: "alice_retry", Status: string(StatusWaiting)}
+	var statuses []string
+	repos := pgsql.Repos{
+		MapInstance: mapInstanceRepoMock{
+			readFn: func(ctx context.Context, id int64) (pgsql.MapInstance, error) { return inst, nil },
+			updateFn: func(ctx context.Context, updated pgsql.MapInstance) error {
+				statuses = append(statuses, updated.Status)
+				inst = updated
+				return nil
+			},
+		},
+		User:           startUserRepoMock{},
+		InstanceMember: instanceMemberRepoMock{},
+	}
+	w, err := NewWorkerI(repos, Options{
+		InstanceRootDir:       filepath.Join(tmp, "instance"),
+		VersionRootDir:        filepath.Join(tmp, "version"),
+		ComposeTemplateDir:    filepath.Join(tmp, "compose"),
+		InstanceTapURLPattern: tapURL + "/inst-%d",
+		ServerTapTimeout:      2 * time.Second,
+		StartMaxAttempts:      3,
+		StartRetryBackoff:     time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new worker failed: %v", err)
+	}
+	var waits []time.Duration
+	w.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	return w, &statuses, &waits
+}
+
+func TestConfigureInstanceAccess_WhitelistsEveryMember(t *testing.T) {
+	rec := &tapRecorder{}
+	srv := httptest.NewServer(rec.handler(false))
+	defer srv.Close()
+	member := func(id int64, name, role string) pgsql.MemberWithUser {
+		return pgsql.MemberWithUser{InstanceMember: pgsql.InstanceMember{InstanceID: 12, UserID: id, Role: role}, MCName: name}
+	}
+	w, err := NewWorkerI(pgsql.Repos{
+		User: startUserRepoMock{},
+		InstanceMember: instanceMemberRepoMock{members: []pgsql.MemberWithUser{
+			member(1, "alice", "owner"),
+			member(2, "bob", "member"),
+			member(3, "Carol", "manager"),
+			member(4, "dave", "owner"),
+			member(5, "BOB", "member"),
+		}},
+	}, Options{
+		InstanceRootDir:       t.TempDir(),
+		VersionRootDir:        t.TempDir(),
+		ComposeTemplateDir:    t.TempDir(),
+		InstanceTapURLPattern: srv.URL + "/inst-%d",
+		ServerTapTimeout:      2 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new worker failed: %v", err)
+	}
+
+	if err := w.configureInstanceAccess(context.Background(), pgsql.MapInstance{ID: 12, OwnerID: 1}); err != nil {
+		t.Fatalf("configure access: %v", err)
+	}
+	got := map[string]int{}
+	for _, c := range rec.commands {
+		got[c]++
+	}
+	for _, want := range []string{"whitelist add alice", "op alice", "whitelist add bob", "whitelist add Carol", "whitelist add dave"} {
+		if got[want] != 1 {
+			t.Fatalf("expected %q exactly once, commands=%v", want, rec.commands)
+		}
+	}
+	if got["whitelist add BOB"] != 0 || got["op bob"] != 0 || got["op dave"] != 0 {
+		t.Fatalf("members should be whitelisted once and never opped, commands=%v", rec.commands)
+	}
+}
+
+func TestConfigureInstanceAccess_FollowsAccessMode(t *testing.T) {
+	tests := []struct {
+		mode string
+		want []string
+	}{
+		{"privacy", []string{"whitelist on", "whitelist add root", "op root", "whitelist add LCMonitor", "op LCMonitor", "whitelist add alice", "op alice", "whitelist add bob", "deop bob"}},
+		{"public", []string{"whitelist off", "whitelist add root", "op root", "whitelist add LCMonitor", "op LCMonitor", "whitelist add alice", "op alice", "whitelist add bob", "deop bob"}},
+		{"lockdown", []string{"whitelist on", "whitelist add root", "op root", "whitelist add LCMonitor", "op LCMonitor", "deop alice", "whitelist remove alice", "deop bob", "whitelist remove bob"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.mode, func(t *testing.T) {
+			rec := &tapRecorder{}
+			srv := httptest.NewServer(rec.handler(false))
+			defer srv.Close()
+			w, err := NewWorkerI(pgsql.Repos{
+				User: startUserRepoMock{admins: []pgsql.User{{ID: 9, MCName: "root", ServerRole: "admin"}}},
+				InstanceMember: instanceMemberRepoMock{members: []pgsql.MemberWithUser{
+					{InstanceMember: pgsql.InstanceMember{InstanceID: 12, UserID: 2, Role: "member"}, MCName: "bob"},
+				}},
+			}, Options{
+				InstanceRootDir:       t.TempDir(),
+				VersionRootDir:        t.TempDir(),
+				ComposeTemplateDir:    t.TempDir(),
+				InstanceTapURLPattern: srv.URL + "/inst-%d",
+				ServerTapTimeout:      2 * time.Second,
+			})
+			if err != nil {
+				t.Fatalf("new worker failed: %v", err)
+			}
+
+			inst := pgsql.MapInstance{ID: 12, OwnerID: 1, AccessMode: tc.mode}
+			if err := w.configureInstanceAccess(context.Background(), inst); err != nil {
+				t.Fatalf("configure access: %v", err)
+			}
+			// Drop the readiness ping; the batch runs concurrently, so
+			// compare as sets.
+			got := append([]string(nil), rec.commands[1:]...)
+			want := append([]string(nil), tc.want...)
+			sort.Strings(got)
+			sort.Strings(want)
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Fatalf("mode %s commands:\n got=%v\nwant=%v", tc.mode, got, want)
+			}
+			if rec.commands[1] != tc.want[0] {
+				t.Fatalf("mode %s should toggle the whitelist first, got=%v", tc.mode, rec.commands)
+			}
+		})
+	}
+}
+
+func TestStartEmpty_RetriesTransientComposeFailure(t *testing.T) {
+	rec := &tapRecorder{}
+	srv := httptest.NewServer(rec.handler(false))
+	defer srv.Close()
+	w, statuses, waits := newRetryStartWorker(t, srv.URL, true)
+	ups := 0
+	var downs int
+	w.runCmd = func(ctx context.Context, bin string, args ...string) (string, error) {
+		switch args[len(args)-1] {
+		case "-d":
+			ups++
+			if ups == 1 {
+				return "", fmt.Errorf("pull access denied: timeout")
+			}
+		case "down":
+			downs++
+		}
+		return "", nil
+	}
+
+	if err := w.StartEmpty(context.Background(), 12, "1.21.1"); err != nil {
+		t.Fatalf("start should succeed on retry: %v", err)
+	}
+	if ups != 2 || downs != 1 {
+		t.Fatalf("expected 2 compose up and 1 down, got up=%d down=%d", ups, downs)
+	}
+	want := "Preparing,Starting,Off,Preparing,Starting,On"
+	if got := strings.Join(*statuses, ","); got != want {
+		t.Fatalf("status sequence got=%s want=%s", got, want)
+	}
+	if len(*waits) != 1 || (*waits)[0] != time.Second {
+		t.Fatalf("expected only the retry backoff wait, got %v", *waits)
+	}
+}
+
+func TestStartEmpty_ProceedsAsSoonAsServerTapAnswers(t *testing.T) {
+	rec := &tapRecorder{}
+	srv := httptest.NewServer(rec.handler(false))
+	defer srv.Close()
+	w, statuses, _ := newRetryStartWorker(t, srv.URL, true)
+	w.sleep = sleepCtx
+	w.runCmd = func(ctx context.Context, bin string, args ...string) (string, error) { return "", nil }
+
+	started := time.Now()
+	if err := w.StartEmpty(context.Background(), 12, "1.21.1"); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Fatalf("a ready server should not wait out a fixed warmup, took %s", elapsed)
+	}
+	if got := strings.Join(*statuses, ","); !strings.HasSuffix(got, "On") {
+		t.Fatalf("instance should be On, statuses=%s", got)
+	}
+	if len(rec.commands) == 0 || rec.commands[0] != "list" {
+		t.Fatalf("readiness should be polled with list first, got %v", rec.commands)
+	}
+}
+
+type pendingWhitelistRepoMock struct {
+	pgsql.PendingWhitelistRepo
+	ops         []pgsql.PendingWhitelistOp
+	deletedUpTo int64
+}
+
+func (m *pendingWhitelistRepoMock) ListByInstance(ctx context.Context, instanceID int64) ([]pgsql.PendingWhitelistOp, error) {
+	return m.ops, nil
+}
+
+func (m *pendingWhitelistRepoMock) DeleteThrough(ctx context.Context, instanceID int64, maxID int64) error {
+	m.deletedUpTo = maxID
+	return nil
+}
+
+func TestStartEmpty_ReplaysWhitelistQueuedWhileOff(t *testing.T) {
+	rec := &tapRecorder{}
+	srv := httptest.NewServer(rec.handler(false))
+	defer srv.Close()
+	w, _, _ := newRetryStartWorker(t, srv.URL, true)
+	w.runCmd = func(ctx context.Context, bin string, args ...string) (string, error) { return "", nil }
+	pending := &pendingWhitelistRepoMock{ops: []pgsql.PendingWhitelistOp{
+		{ID: 1, InstanceID: 12, PlayerName: "bob", Action: "remove"},
+		{ID: 2, InstanceID: 12, PlayerName: "Alice", Action: "remove"},
+		{ID: 3, InstanceID: 12, PlayerName: "not a name", Action: "add"},
+	}}
+	w.repos.PendingWhitelist = pending
+
+	if err := w.StartEmpty(context.Background(), 12, "1.21.1"); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	got := map[string]int{}
+	for _, c := range rec.commands {
+		got[c]++
+	}
+	if got["whitelist remove bob"] != 1 {
+		t.Fatalf("queued remove should be replayed once, commands=%v", rec.commands)
+	}
+	if got["whitelist remove Alice"] != 0 || got["whitelist add alice"] != 1 {
+		t.Fatalf("the owner's access follows the DB, not the queue, commands=%v", rec.commands)
+	}
+	if pending.deletedUpTo != 3 {
+		t.Fatalf("replayed ops should be cleared through id 3, got %d", pending.deletedUpTo)
+	}
+}
+
+func TestStartEmpty_MissingJarIsNotRetried(t *testing.T) {
+	w, statuses, waits := newRetryStartWorker(t, "http://127.0.0.1:1", false)
+	w.runCmd = func(ctx context.Context, bin string, args ...string) (string, error) {
+		t.Fatalf("compose must not run without a jar: %v", args)
+		return "", nil
+	}
+	if err := w.StartEmpty(context.Background(), 12, "1.21.1"); err == nil {
+		t.Fatalf("expected start failure")
+	}
+	if got := strings.Join(*statuses, ","); got != "Preparing,Off" {
+		t.Fatalf("missing jar should fail on first attempt, statuses=%s", got)
+	}
+	if len(*waits) != 0 {
+		t.Fatalf("no backoff expected, got %v", *waits)
+	}
+}
+
+func TestProvision_LeavesInstanceOffWithReadyVolume(t *testing.T) {
+	w, statuses, _ := newRetryStartWorker(t, "http://127.0.0.1:1", true)
+	w.runCmd = func(ctx context.Context, bin string, args ...string) (string, error) {
+		t.Fatalf("provision must not run compose: %v", args)
+		return "", nil
+	}
+
+	if err := w.Provision(context.Background(), 12, "1.21.1", ""); err != nil {
+		t.Fatalf("provision failed: %v", err)
+	}
+	if got := strings.Join(*statuses, ","); got != "Preparing,Off" {
+		t.Fatalf("unexpected status sequence: %s", got)
+	}
+	base := instanceDir(w.opts.InstanceRootDir, 12)
+	for _, name := range []string{"world", "world_nether", "world_the_end"} {
+		if !isDir(filepath.Join(base, name)) {
+			t.Fatalf("%s dir missing after provision", name)
+		}
+	}
+	for _, name := range []string{"whitelist.json", "paper-1.21.1-133.jar", "docker-compose.yml"} {
+		if _, err := os.Stat(filepath.Join(base, name)); err != nil {
+			t.Fatalf("%s missing after provision: %v", name, err)
+		}
+	}
+	if len(w.Snapshot().Jobs) != 0 {
+		t.Fatalf("provision job should be finished")
+	}
+}
+
+func TestRepairVolume_RecreatesWhitelistAndKeepsWorld(t *testing.T) {
+	w, _, _ := newRetryStartWorker(t, "http://127.0.0.1:1", true)
+	ctx := context.Background()
+	if _, err := w.RepairVolume(ctx, 12); err == nil {
+		t.Fatalf("repair must refuse an instance that is not Off")
+	}
+	if err := w.Provision(ctx, 12, "1.21.1", ""); err != nil {
+		t.Fatalf("provision failed: %v", err)
+	}
+	base := instanceDir(w.opts.InstanceRootDir, 12)
+	levelDat := filepath.Join(base, "world", "level.dat")
+	if err := os.WriteFile(levelDat, []byte("keep"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(base, "whitelist.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(base, "world_the_end")); err != nil {
+		t.Fatal(err)
+	}
+
+	repaired, err := w.RepairVolume(ctx, 12)
+	if err != nil {
+		t.Fatalf("repair failed: %v", err)
+	}
+	if got := strings.Join(repaired, ","); got != "whitelist.json,world_the_end" {
+		t.Fatalf("unexpected repaired list: %s", got)
+	}
+	if b, err := os.ReadFile(filepath.Join(base, "whitelist.json")); err != nil || string(b) != "[]\n" {
+		t.Fatalf("whitelist.json not recreated: %q %v", b, err)
+	}
+	if b, err := os.ReadFile(levelDat); err != nil || string(b) != "keep" {
+		t.Fatalf("existing world data must be kept: %q %v", b, err)
+	}
+	if repaired, err := w.RepairVolume(ctx, 12); err != nil || len(repaired) != 0 {
+		t.Fatalf("healthy volume should need no repair: %v %v", repaired, err)
+	}
+}
+
+func TestSupportedVersions_GroupsInstalledJarsByPrefix(t *testing.T) {
+	root := t.TempDir()
+	for ver, jar := range map[string]bool{"1.21.1": true, "1.20.4": true, "1.21.4": true, "1.19.2": false, "1.8.9": true} {
+		dir := filepath.Join(root, ver)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if jar {
+			if err := os.WriteFile(filepath.Join(dir, "paper-"+ver+".jar"), []byte("jar"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	w := &WorkerI{opts: Options{VersionRootDir: root}}
+
+	supported, err := w.SupportedVersions()
+	if err != nil {
+		t.Fatalf("supported versions failed: %v", err)
+	}
+	got := make([]string, 0, len(supported))
+	for _, v := range supported {
+		got = append(got, fmt.Sprintf("%s=%s[%s]", v.Prefix, v.Image, strings.Join(v.Installed, ",")))
+	}
+	want := "1.16=mcmm-mini:java16-jlink[] " +
+		"1.17=mcmm-mini:java17-jlink[] " +
+		"1.18=mcmm-mini:java17-jlink[] " +
+		"1.19=mcmm-mini:java17-jlink[] " +
+		"1.20=mcmm-mini:java17-jlink[1.20.4] " +
+		"1.21=mcmm-mini:java21-jlink[1.21.1,1.21.4]"
+	if strings.Join(got, " ") != want {
+		t.Fatalf("unexpected support table:\n got=%s\nwant=%s", strings.Join(got, " "), want)
+	}
+
+	w.opts.VersionRootDir = filepath.Join(root, "missing")
+	if supported, err := w.SupportedVersions(); err != nil || len(supported) != len(runtimeImages) {
+		t.Fatalf("missing version root should list prefixes without installs: %v %v", supported, err)
+	}
+}
+
+func TestValidateStart_ReportsMissingJarAndUnsupportedVersion(t *testing.T) {
+	ctx := context.Background()
+	w, _, _ := newRetryStartWorker(t, "http://127.0.0.1:1", true)
+	if err := w.ValidateStart(ctx, 12, "1.21.1"); err != nil {
+		t.Fatalf("valid version should pass: %v", err)
+	}
+	if err := w.ValidateStart(ctx, 12, "1.21.4"); err == nil || !strings.Contains(err.Error(), "version dir missing") {
+		t.Fatalf("expected missing version dir, got %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(w.opts.VersionRootDir, "1.12.2"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	err := w.ValidateStart(ctx, 12, "1.12.2")
+	if err == nil || !strings.Contains(err.Error(), "no paper jar") || !strings.Contains(err.Error(), "unsupported game version: 1.12.2") {
+		t.Fatalf("expected missing jar and unsupported version, got %v", err)
+	}
+	for _, bad := range []string{"../../etc", "1.21.1/../../x", "/tmp"} {
+		if err := w.ValidateStart(ctx, 12, bad); err == nil || !strings.Contains(err.Error(), "invalid game version") {
+			t.Fatalf("version %q must be rejected before touching the filesystem, got %v", bad, err)
+		}
+	}
+
+	noJar, _, _ := newRetryStartWorker(t, "http://127.0.0.1:1", false)
+	if err := noJar.ValidateStart(ctx, 12, ""); err == nil || !strings.Contains(err.Error(), "no paper jar") {
+		t.Fatalf("expected missing jar for the instance's default version, got %v", err)
+	}
+}
+
+func TestDeleteArchived_RemovesFilesAndRow(t *testing.T) {
+	status := StatusOff
+	instRepo := &cycleRepoMock{mapInstanceRepoMock: mapInstanceRepoMock{
+		readFn: func(ctx context.Context, id int64) (pgsql.MapInstance, error) {
+			return pgsql.MapInstance{ID: id, Status: string(status)}, nil
+		},
+	}}
+	root := t.TempDir()
+	w, err := NewWorkerI(pgsql.Repos{MapInstance: instRepo}, Options{
+		InstanceRootDir:    filepath.Join(root, "instance"),
+		VersionRootDir:     t.TempDir(),
+		ComposeTemplateDir: t.TempDir(),
+		ArchiveRootDir:     filepath.Join(root, "archived"),
+	})
+	if err != nil {
+		t.Fatalf("new worker failed: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(w.archiveDirPath(21), "world"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.DeleteArchived(context.Background(), 21); err == nil {
+		t.Fatalf("non-archived instance must not be purged")
+	}
+	if !isDir(w.archiveDirPath(21)) || len(instRepo.deleted) != 0 {
+		t.Fatalf("guard should leave files and row untouched")
+	}
+
+	status = StatusArchived
+	if err := w.DeleteArchived(context.Background(), 21); err != nil {
+		t.Fatalf("purge failed: %v", err)
+	}
+	if isDir(w.archiveDirPath(21)) {
+		t.Fatalf("archive dir should be removed")
+	}
+	if len(instRepo.deleted) != 1 || instRepo.deleted[0] != 21 {
+		t.Fatalf("instance row should be deleted, got=%v", instRepo.deleted)
+	}
+}
+
+func TestStartEmpty_PersistsFailingComposeOutput(t *testing.T) {
+	w, _, _ := newRetryStartWorker(t, "http://127.0.0.1:1", true)
+	w.opts.StartMaxAttempts = 1
+	dockerSaid := " mc Pulling \n mc Pulled \nError response from daemon: pull access denied for mcmm-mini, repository does not exist"
+	w.runCmd = func(ctx context.Context, bin string, args ...string) (string, error) {
+		if args[len(args)-1] == "-d" {
+			return dockerSaid, &CommandError{Command: bin + " " + strings.Join(args, " "), Output: dockerSaid, Err: fmt.Errorf("exit status 1")}
+		}
+		return "", nil
+	}
+	if err := w.StartEmpty(context.Background(), 12, "1.21.1"); err == nil {
+		t.Fatalf("expected start failure")
+	}
+	inst, _ := w.repos.MapInstance.Read(context.Background(), 12)
+	if inst.Status != string(StatusOff) || inst.HealthStatus != string(HealthStartFailed) {
+		t.Fatalf("unexpected final state status=%s health=%s", inst.Status, inst.HealthStatus)
+	}
+	if !inst.LastComposeOutput.Valid || inst.LastComposeOutput.String != dockerSaid {
+		t.Fatalf("compose output not persisted: %+v", inst.LastComposeOutput)
+	}
+	if !strings.Contains(inst.LastErrorMsg.String, "pull access denied") || strings.Contains(inst.LastErrorMsg.String, "Pulling") {
+		t.Fatalf("last_error_msg should carry only the last output line, got %q", inst.LastErrorMsg.String)
+	}
+}
+
+func TestCommandError_IncludesLastOutputLine(t *testing.T) {
+	err := &CommandError{Command: "docker compose up -d", Output: "step 1\nstep 2\n\nno space left on device\n", Err: errors.New("exit status 1")}
+	if got, want := err.Error(), "docker compose up -d failed: exit status 1: no space left on device"; got != want {
+		t.Fatalf("Error()=%q want %q", got, want)
+	}
+	long := &CommandError{Command: "docker", Output: strings.Repeat("é", maxErrorOutputBytes), Err: errors.New("exit status 1")}
+	msg := long.Error()
+	if !utf8.ValidString(msg) || !strings.HasSuffix(msg, "...") || len(msg) > len("docker failed: exit status 1: ")+maxErrorOutputBytes+3 {
+		t.Fatalf("long output not cut down: %q", msg)
+	}
+	if got := (&CommandError{Command: "docker", Err: errors.New("exit status 1")}).Error(); got != "docker failed: exit status 1" {
+		t.Fatalf("Error() without output=%q", got)
+	}
+}
+
+func TestPruneArchives_NotifiesThenPurgesAfterNotice(t *testing.T) {
+	day := func(d int) sql.NullTime {
+		return sql.NullTime{Time: time.Date(2026, 3, d, 0, 0, 0, 0, time.UTC), Valid: true}
+	}
+	// Oldest first, as ListArchived returns them.
+	archived := map[int64]pgsql.MapInstance{
+		1: {ID: 1, OwnerID: 10, Status: string(StatusArchived), ArchivedAt: day(1), ArchivePinned: true},
+		2: {ID: 2, OwnerID: 20, Status: string(StatusArchived), ArchivedAt: day(2)},
+		3: {ID: 3, OwnerID: 30, Status: string(StatusArchived), ArchivedAt: day(3)},
+		4: {ID: 4, OwnerID: 40, Status: string(StatusArchived), ArchivedAt: day(4)},
+	}
+	order := []int64{1, 2, 3, 4}
+	var deleted []int64
+	repos := pgsql.Repos{MapInstance: mapInstanceRepoMock{
+		readFn: func(ctx context.Context, id int64) (pgsql.MapInstance, error) { return archived[id], nil },
+		updateFn: func(ctx context.Context, inst pgsql.MapInstance) error {
+			archived[inst.ID] = inst
+			return nil
+		},
+		listArchivedFn: func(ctx context.Context) ([]pgsql.MapInstance, error) {
+			out := make([]pgsql.MapInstance, 0, len(order))
+			for _, id := range order {
+				if inst, ok := archived[id]; ok {
+					out = append(out, inst)
+				}
+			}
+			return out, nil
+		},
+		deleteFn: func(ctx context.Context, id int64) error {
+			deleted = append(deleted, id)
+			delete(archived, id)
+			return nil
+		},
+	}}
+	now := time.Date(2026, 4, 1, 12, 0, 0, 0, time.UTC)
+	root := t.TempDir()
+	w, err := NewWorkerI(repos, Options{
+		InstanceRootDir:    filepath.Join(root, "instance"),
+		VersionRootDir:     t.TempDir(),
+		ComposeTemplateDir: t.TempDir(),
+		ArchiveRootDir:     filepath.Join(root, "archived"),
+		Now:                func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("new worker failed: %v", err)
+	}
+	for _, id := range order {
+		dir := filepath.Join(w.archiveDirPath(id), "world")
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "region.mca"), make([]byte, 100), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const notice = 72 * time.Hour
+	var notified []string
+	warn := func(ctx context.Context, inst pgsql.MapInstance, size int64, deleteAfter time.Time) {
+		if size != 100 {
+			t.Fatalf("unexpected size for instance %d: %d", inst.ID, size)
+		}
+		notified = append(notified, fmt.Sprintf("%d@%s", inst.OwnerID, deleteAfter.Format(time.RFC3339)))
+	}
+	prune := func() []int64 {
+		t.Helper()
+		pruned, err := w.PruneArchives(context.Background(), 250, notice, warn)
+		if err != nil {
+			t.Fatalf("prune failed: %v", err)
+		}
+		return pruned
+	}
+
+	// 400 bytes total, cap 250: #1 is pinned, so #2 and #3 are picked, but
+	// the first pass only warns their owners.
+	if pruned := prune(); len(pruned) != 0 || len(deleted) != 0 {
+		t.Fatalf("first pass must only notify: pruned=%v deleted=%v", pruned, deleted)
+	}
+	if fmt.Sprint(notified) != "[20@2026-04-04T12:00:00Z 30@2026-04-04T12:00:00Z]" {
+		t.Fatalf("owners should be notified a notice period ahead: %v", notified)
+	}
+	if !archived[2].PruneNoticeAt.Valid || archived[4].PruneNoticeAt.Valid {
+		t.Fatalf("prune notice should be recorded only for picked archives")
+	}
+
+	// An OP pins #3 during the notice period: its notice is dropped and #4
+	// is picked in its place, with its own notice period.
+	inst := archived[3]
+	inst.ArchivePinned = true
+	archived[3] = inst
+	now = now.Add(24 * time.Hour)
+	notified = nil
+	if pruned := prune(); len(pruned) != 0 {
+		t.Fatalf("nothing is due yet: %v", pruned)
+	}
+	if archived[3].PruneNoticeAt.Valid {
+		t.Fatalf("pinning should clear the prune notice")
+	}
+	if fmt.Sprint(notified) != "[40@2026-04-05T12:00:00Z]" {
+		t.Fatalf("only the newly picked archive should be notified: %v", notified)
+	}
+
+	now = now.Add(48 * time.Hour)
+	if pruned := prune(); fmt.Sprint(pruned) != "[2]" || fmt.Sprint(deleted) != "[2]" {
+		t.Fatalf("only the archive past its notice should go: pruned=%v deleted=%v", pruned, deleted)
+	}
+	if !isDir(w.archiveDirPath(1)) || !isDir(w.archiveDirPath(4)) || isDir(w.archiveDirPath(2)) {
+		t.Fatalf("unexpected archive dirs after prune")
+	}
+
+	now = now.Add(24 * time.Hour)
+	if pruned := prune(); fmt.Sprint(pruned) != "[4]" {
+		t.Fatalf("#4 should go once its notice ran out: %v", pruned)
+	}
+	if pruned := prune(); len(pruned) != 0 {
+		t.Fatalf("usage under cap must not prune: %v", pruned)
+	}
+}
+
+func TestTruncateCommandOutput_KeepsTail(t *testing.T) {
+	long := strings.Repeat("a", maxCommandOutputBytes) + "\nERROR: the real failure"
+	got := truncateCommandOutput(long)
+	if !strings.HasPrefix(got, "...(truncated)") || !strings.HasSuffix(got, "ERROR: the real failure") {
+		t.Fatalf("unexpected truncation: %q", got[:40])
+	}
+	if len(got) > maxCommandOutputBytes+len("...(truncated)\n") {
+		t.Fatalf("output too long: %d", len(got))
+	}
+}
+
+func TestPrepareInstanceVolume_FailedImportLeavesNoStagingResidue(t *testing.T) {
+	tmp := t.TempDir()
+	templateWorld := filepath.Join(tmp, "template", "broken", "world")
+	if err := os.MkdirAll(filepath.Join(templateWorld, "region"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(templateWorld, "region", "r.0.0.mca"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	staging := filepath.Join(tmp, "staging")
+	w, err := NewWorkerI(pgsql.Repos{}, Options{
+		InstanceRootDir:    filepath.Join(tmp, "instance"),
+		VersionRootDir:     filepath.Join(tmp, "version"),
+		ComposeTemplateDir: filepath.Join(tmp, "compose"),
+		StagingRootDir:     staging,
+	})
+	if err != nil {
+		t.Fatalf("new worker failed: %v", err)
+	}
+	existing := filepath.Join(tmp, "instance", "43", "world", "level.dat")
+	if err := os.MkdirAll(filepath.Dir(existing), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(existing, []byte("keep"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.prepareInstanceVolume(43, templateWorld); err == nil {
+		t.Fatalf("world without level.dat should be rejected")
+	}
+	entries, err := os.ReadDir(staging)
+	if err != nil {
+		t.Fatalf("read staging: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("staging should be empty after failed import, got %d entries", len(entries))
+	}
+	if b, err := os.ReadFile(existing); err != nil || string(b) != "keep" {
+		t.Fatalf("existing world must be untouched by a failed import")
+	}
+}
+
+func TestSweepStaleFiles_RemovesOldAndKeepsRecent(t *testing.T) {
+	tmp := t.TempDir()
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	w, err := NewWorkerI(pgsql.Repos{}, Options{
+		InstanceRootDir:    filepath.Join(tmp, "instance"),
+		VersionRootDir:     filepath.Join(tmp, "version"),
+		ComposeTemplateDir: filepath.Join(tmp, "compose"),
+		ArchiveRootDir:     filepath.Join(tmp, "archived"),
+		StagingRootDir:     filepath.Join(tmp, "staging"),
+		Now:                func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("new worker failed: %v", err)
+	}
+	mk := func(path string, age time.Duration) string {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		ts := now.Add(-age)
+		if err := os.Chtimes(path, ts, ts); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	oldStaged := mk(filepath.Join(tmp, "staging", "instance-3-123"), 48*time.Hour)
+	newStaged := mk(filepath.Join(tmp, "staging", "instance-4-456"), time.Hour)
+	oldRegular := mk(filepath.Join(tmp, "instance", "3", "server.properties"), 48*time.Hour)
+	oldArchived := mk(filepath.Join(tmp, "archived", "4", "world", "level.dat"), 48*time.Hour)
+
+	removed, err := w.SweepStaleFiles(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("sweep failed: %v", err)
+	}
+	if len(removed) != 1 || removed[0] != oldStaged {
+		t.Fatalf("expected only %s removed, got %v", oldStaged, removed)
+	}
+	if _, err := os.Stat(oldStaged); !os.IsNotExist(err) {
+		t.Fatalf("%s should be removed", oldStaged)
+	}
+	for _, p := range []string{newStaged, oldRegular, oldArchived} {
+		if _, err := os.Stat(p); err != nil {
+			t.Fatalf("%s should be kept: %v", p, err)
+		}
+	}
+}
+
+func TestInstanceServerTapKey_GeneratedMountedAndUsed(t *testing.T) {
+	keys, err := servertap.NewInstanceKeyring("test-secret")
+	if err != nil {
+		t.Fatalf("keyring: %v", err)
+	}
+	var mu sync.Mutex
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		seen = append(seen, req.Header.Get("key"))
+		mu.Unlock()
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	tmp := t.TempDir()
+	versionDir := filepath.Join(tmp, "version", "1.21.1")
+	if err := os.MkdirAll(versionDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(versionDir, "paper-1.21.1-133.jar"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWorkerI(pgsql.Repos{}, Options{
+		InstanceRootDir:       filepath.Join(tmp, "instance"),
+		VersionRootDir:        filepath.Join(tmp, "version"),
+		ComposeTemplateDir:    t.TempDir(),
+		InstanceTapURLPattern: srv.URL + "/inst-%d",
+		ServerTapAuthKey:      "global-key",
+		ServerTapTimeout:      2 * time.Second,
+		InstanceKeys:          keys,
+	})
+	if err != nil {
+		t.Fatalf("new worker failed: %v", err)
+	}
+
+	inst := pgsql.MapInstance{ID: 7}
+	if err := w.prepareInstanceTapConfig(&inst); err != nil {
+		t.Fatalf("prepare tap config: %v", err)
+	}
+	plain, err := keys.Open(inst.ServerTapKey)
+	if err != nil || plain == "" || plain == "global-key" {
+		t.Fatalf("expected a sealed per-instance key, got plain=%q err=%v", plain, err)
+	}
+	cfg, err := os.ReadFile(filepath.Join(instanceDir(w.opts.InstanceRootDir, 7), instanceTapConfigName))
+	if err != nil || !strings.Contains(string(cfg), plain) {
+		t.Fatalf("servertap config should carry the instance key, got %q err=%v", cfg, err)
+	}
+	if err := w.prepareComposeFile(inst, "1.21.1"); err != nil {
+		t.Fatalf("prepare compose failed: %v", err)
+	}
+	compose, _ := os.ReadFile(filepath.Join(instanceDir(w.opts.InstanceRootDir, 7), "docker-compose.yml"))
+	if !strings.Contains(string(compose), ":/data/server/plugins/ServerTap/config.yml:ro") {
+		t.Fatalf("compose should mount the instance servertap config, got:\n%s", compose)
+	}
+
+	for _, target := range []pgsql.MapInstance{inst, {ID: 8}} {
+		conn, err := w.newInstanceConnector(target)
+		if err != nil {
+			t.Fatalf("connector: %v", err)
+		}
+		if _, err := conn.Execute(context.Background(), servertap.ExecuteRequest{Command: "list"}); err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seen) != 2 || seen[0] != plain {
+		t.Fatalf("instance 7 should use its own key, seen=%v", seen)
+	}
+	if seen[1] != "global-key" {
+		t.Fatalf("instance without a key should fall back to the global key, seen=%v", seen)
+	}
+}
+
+func TestAssignHostPort_DistinctPortsInCompose(t *testing.T) {
+	tmp := t.TempDir()
+	versionDir := filepath.Join(tmp, "version", "1.21.1")
+	if err := os.MkdirAll(versionDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(versionDir, "paper-1.21.1-133.jar"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	store := map[int64]pgsql.MapInstance{
+		1: {ID: 1, Status: string(StatusOff)},
+		2: {ID: 2, Status: string(StatusOff)},
+		// An archived instance's port is free again.
+		3: {ID: 3, Status: string(StatusArchived), HostPort: 30000},
+	}
+	repos := pgsql.Repos{MapInstance: mapInstanceRepoMock{
+		listFn: func(ctx context.Context) ([]pgsql.MapInstance, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			out := make([]pgsql.MapInstance, 0, len(store))
+			for _, inst := range store {
+				out = append(out, inst)
+			}
+			return out, nil
+		},
+		updateFn: func(ctx context.Context, inst pgsql.MapInstance) error {
+			mu.Lock()
+			defer mu.Unlock()
+			store[inst.ID] = inst
+			return nil
+		},
+	}}
+	w, err := NewWorkerI(repos, Options{
+		InstanceRootDir:    filepath.Join(tmp, "instance"),
+		VersionRootDir:     filepath.Join(tmp, "version"),
+		ComposeTemplateDir: t.TempDir(),
+		HostPortMin:        30000,
+		HostPortMax:        30009,
+	})
+	if err != nil {
+		t.Fatalf("new worker failed: %v", err)
+	}
+
+	ports := map[int64]int{}
+	for _, id := range []int64{1, 2} {
+		inst := store[id]
+		if err := w.assignHostPort(context.Background(), &inst); err != nil {
+			t.Fatalf("assign instance %d: %v", id, err)
+		}
+		if err := os.MkdirAll(instanceDir(w.opts.InstanceRootDir, id), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.prepareComposeFile(inst, "1.21.1"); err != nil {
+			t.Fatalf("prepare compose %d: %v", id, err)
+		}
+		ports[id] = inst.HostPort
+	}
+	if ports[1] == ports[2] || ports[1] < 30000 || ports[2] > 30009 {
+		t.Fatalf("expected distinct ports in range, got %v", ports)
+	}
+	if store[1].HostPort != ports[1] || store[2].HostPort != ports[2] {
+		t.Fatalf("ports should be persisted, store=%v", store)
+	}
+	for id, port := range ports {
+		b, err := os.ReadFile(filepath.Join(instanceDir(w.opts.InstanceRootDir, id), "docker-compose.yml"))
+		if err != nil {
+			t.Fatalf("read compose: %v", err)
+		}
+		if want := fmt.Sprintf("ports:\n      - \"%d:25565\"", port); !strings.Contains(string(b), want) {
+			t.Fatalf("compose for %d should map %q, got:\n%s", id, want, b)
+		}
+	}
+
+	// Reassigning keeps an instance on its current port.
+	inst := store[1]
+	if err := w.assignHostPort(context.Background(), &inst); err != nil || inst.HostPort != ports[1] {
+		t.Fatalf("expected port %d to be kept, got %d err=%v", ports[1], inst.HostPort, err)
+	}
+}
+
+func TestRotateServerTapKey_ChangesStoredKeyAndConnections(t *testing.T) {
+	keys, err := servertap.NewInstanceKeyring("test-secret")
+	if err != nil {
+		t.Fatalf("keyring: %v", err)
+	}
+	var mu sync.Mutex
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		seen = append(seen, req.Header.Get("key"))
+		mu.Unlock()
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	versionRoot := t.TempDir()
+	writeTestPaperJar(t, versionRoot, "1.21.1")
+	inst := pgsql.MapInstance{ID: 7, Alias: "alice_castle", Status: string(StatusOff), GameVersion: "1.21.1"}
+	repos := pgsql.Repos{MapInstance: mapInstanceRepoMock{
+		readFn: func(ctx context.Context, id int64) (pgsql.MapInstance, error) { return inst, nil },
+		updateFn: func(ctx context.Context, updated pgsql.MapInstance) error {
+			inst = updated
+			return nil
+		},
+	}}
+	w, err := NewWorkerI(repos, Options{
+		InstanceRootDir:       t.TempDir(),
+		VersionRootDir:        versionRoot,
+		ComposeTemplateDir:    t.TempDir(),
+		InstanceTapURLPattern: srv.URL + "/inst-%d",
+		ServerTapAuthKey:      "global-key",
+		ServerTapTimeout:      2 * time.Second,
+		InstanceKeys:          keys,
+	})
+	if err != nil {
+		t.Fatalf("new worker failed: %v", err)
+	}
+	if err := w.prepareInstanceTapConfig(&inst); err != nil {
+		t.Fatalf("prepare tap config: %v", err)
+	}
+	oldKey, _ := keys.Open(inst.ServerTapKey)
+
+	if err := w.RotateServerTapKey(context.Background(), 7); err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+	newKey, err := keys.Open(inst.ServerTapKey)
+	if err != nil || newKey == "" || newKey == oldKey {
+		t.Fatalf("stored key should change, old=%q new=%q err=%v", oldKey, newKey, err)
+	}
+	cfg, _ := os.ReadFile(filepath.Join(instanceDir(w.opts.InstanceRootDir, 7), instanceTapConfigName))
+	if !strings.Contains(string(cfg), newKey) {
+		t.Fatalf("servertap config should carry the new key, got %q", cfg)
+	}
+
+	conn, err := w.newInstanceConnector(inst)
+	if err != nil {
+		t.Fatalf("connector: %v", err)
+	}
+	if _, err := conn.Execute(context.Background(), servertap.ExecuteRequest{Command: "list"}); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seen) != 1 || seen[0] != newKey {
+		t.Fatalf("calls after rotation should use the new key, seen=%v", seen)
+	}
+}
+
+// writeTestPaperJar puts a paper jar for version under versionRoot, enough
+// for prepareComposeFile.
+func writeTestPaperJar(t *testing.T, versionRoot string, version string) {
+	t.Helper()
+	dir := filepath.Join(versionRoot, version)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "paper-"+version+"-133.jar"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRotateServerTapKey_RerendersComposeToMountTapConfig(t *testing.T) {
+	keys, err := servertap.NewInstanceKeyring("test-secret")
+	if err != nil {
+		t.Fatalf("keyring: %v", err)
+	}
+	versionRoot := t.TempDir()
+	writeTestPaperJar(t, versionRoot, "1.21.1")
+	inst := pgsql.MapInstance{ID: 8, Alias: "bob_base", Status: string(StatusOff), GameVersion: "1.21.1"}
+	repos := pgsql.Repos{MapInstance: mapInstanceRepoMock{
+		readFn: func(ctx context.Context, id int64) (pgsql.MapInstance, error) { return inst, nil },
+		updateFn: func(ctx context.Context, updated pgsql.MapInstance) error {
+			inst = updated
+			return nil
+		},
+	}}
+	w, err := NewWorkerI(repos, Options{
+		InstanceRootDir:    t.TempDir(),
+		VersionRootDir:     versionRoot,
+		ComposeTemplateDir: t.TempDir(),
+		InstanceKeys:       keys,
+	})
+	if err != nil {
+		t.Fatalf("new worker failed: %v", err)
+	}
+	base := instanceDir(w.opts.InstanceRootDir, 8)
+	if err := os.MkdirAll(base, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Rendered while the instance still ran on the global key.
+	if err := w.prepareComposeFile(inst, inst.GameVersion); err != nil {
+		t.Fatalf("prepare compose: %v", err)
+	}
+	composePath := filepath.Join(base, "docker-compose.yml")
+	b, _ := os.ReadFile(composePath)
+	if strings.Contains(string(b), instanceTapConfigName) {
+		t.Fatalf("compose should not mount a tap config that does not exist yet:\n%s", b)
+	}
+
+	if err := w.RotateServerTapKey(context.Background(), 8); err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+	b, _ = os.ReadFile(composePath)
+	tapConfig, _ := filepath.Abs(filepath.Join(base, instanceTapConfigName))
+	if !strings.Contains(string(b), tapConfig) {
+		t.Fatalf("compose should mount %s after rotation, got:\n%s", tapConfig, b)
+	}
+}
+
+func TestComposePreview_RendersUnstartedAndRedactsWrittenFile(t *testing.T) {
+	w, _, _ := newRetryStartWorker(t, "http://127.0.0.1:1", true)
+	ctx := context.Background()
+	inst, _ := w.repos.MapInstance.Read(ctx, 12)
+	inst.GameVersion = "1.21.1"
+	inst.MemLimitMB = 1536
+	_ = w.repos.MapInstance.Update(ctx, inst)
+	composePath := filepath.Join(instanceDir(w.opts.InstanceRootDir, 12), "docker-compose.yml")
+
+	preview, err := w.ComposePreview(ctx, 12)
+	if err != nil {
+		t.Fatalf("preview: %v", err)
+	}
+	for _, want := range []string{"container_name: mcmm-inst-12", "mem_limit: 1536m", "PAPER_JAR: \"paper-1.21.1-133.jar\""} {
+		if !strings.Contains(preview, want) {
+			t.Fatalf("preview missing %q:\n%s", want, preview)
+		}
+	}
+	if fileExists(composePath) {
+		t.Fatalf("a preview must not write the compose file")
+	}
+
+	w.opts.ServerTapAuthKey = "global-tap-key"
+	if err := w.prepareComposeFile(inst, "1.21.1"); err != nil {
+		t.Fatalf("prepare compose: %v", err)
+	}
+	written, _ := os.ReadFile(composePath)
+	extra := "      SERVERTAP_KEY: \"hunter2\"\n      EXTRA_ARGS: \"--auth global-tap-key\"\n"
+	content := strings.Replace(string(written), "    environment:\n", "    environment:\n"+extra, 1)
+	if err := os.WriteFile(composePath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	preview, err = w.ComposePreview(ctx, 12)
+	if err != nil {
+		t.Fatalf("preview: %v", err)
+	}
+	if strings.Contains(preview, "hunter2") || strings.Contains(preview, "global-tap-key") {
+		t.Fatalf("secrets should be redacted:\n%s", preview)
+	}
+	if !strings.Contains(preview, "SERVERTAP_KEY: <redacted>") || !strings.Contains(preview, "mem_limit: 1536m") {
+		t.Fatalf("preview should be the written file with secrets redacted:\n%s", preview)
+	}
+}
+
+func TestPrepareComposeFile_CustomTemplate(t *testing.T) {
+	tmp := t.TempDir()
+	versionDir := filepath.Join(tmp, "version", "1.21.1")
+	if err := os.MkdirAll(versionDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(versionDir, "paper-1.21.1-133.jar"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	templateDir := filepath.Join(tmp, "compose")
+	if err := os.MkdirAll(templateDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	custom := `services:
+  {{.ServiceName}}:
+    image: {{.Image}}
+    labels:
+      mcmm.instance: "{{.InstanceID}}"
+    volumes:
+      - {{.Mounts.World}}:/data/server/world
+      - /srv/extra:/data/server/extra:ro
+    networks:
+      - {{.Network}}
+networks:
+  {{.Network}}:
+    external: true
+`
+	if err := os.WriteFile(filepath.Join(templateDir, composeTemplateName), []byte(custom), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWorkerI(pgsql.Repos{}, Options{
+		InstanceRootDir:    filepath.Join(tmp, "instance"),
+		VersionRootDir:     filepath.Join(tmp, "version"),
+		ComposeTemplateDir: templateDir,
+	})
+	if err != nil {
+		t.Fatalf("new worker failed: %v", err)
+	}
+	if err := os.MkdirAll(instanceDir(w.opts.InstanceRootDir, 42), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.prepareComposeFile(pgsql.MapInstance{ID: 42}, "1.21.1"); err != nil {
+		t.Fatalf("prepare compose failed: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(instanceDir(w.opts.InstanceRootDir, 42), "docker-compose.yml"))
+	if err != nil {
+		t.Fatalf("read compose failed: %v", err)
+	}
+	content := string(b)
+	for _, want := range []string{"mcmm-inst-42:", `mcmm.instance: "42"`, "/srv/extra:/data/server/extra:ro", "mcmm-mini:java21-jlink"} {
+		if !strings.Contains(content, want) {
+			t.Fatalf("custom compose missing %q, got:\n%s", want, content)
+		}
+	}
+
+	// A template that renders broken YAML is rejected.
+	if err := os.WriteFile(filepath.Join(templateDir, composeTemplateName), []byte("services: [unclosed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.prepareComposeFile(pgsql.MapInstance{ID: 42}, "1.21.1"); err == nil || !strings.Contains(err.Error(), "not valid yaml") {
+		t.Fatalf("expected yaml validation error, got %v", err)
+	}
+}
+
+func TestPostCreateHook_ReceivesInstanceAndSkipsWhenUnset(t *testing.T) {
+	w, err := NewWorkerI(pgsql.Repos{}, Options{
+		InstanceRootDir:    t.TempDir(),
+		VersionRootDir:     t.TempDir(),
+		ComposeTemplateDir: t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("new worker failed: %v", err)
+	}
+	var mu sync.Mutex
+	var calls []string
+	w.runCmd = func(ctx context.Context, bin string, args ...string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, ok := ctx.Deadline(); !ok {
+			t.Errorf("hook should run with a timeout")
+		}
+		calls = append(calls, bin+" "+strings.Join(args, " "))
+		return "registered", nil
+	}
+	inst := pgsql.MapInstance{ID: 42, Alias: "alice_castle", GameVersion: "1.21.1", OwnerID: 1, HostPort: 30001}
+
+	w.runPostCreateHook(inst)
+	w.hooks.Wait()
+	if len(calls) != 0 {
+		t.Fatalf("hook must be skipped when unset, got %v", calls)
+	}
+
+	w.opts.PostCreateHook = "/opt/mcmm/post-create.sh"
+	w.runPostCreateHook(inst)
+	w.hooks.Wait()
+	if len(calls) != 1 || calls[0] != "/opt/mcmm/post-create.sh 42 alice_castle 1.21.1 1 30001" {
+		t.Fatalf("unexpected hook calls: %v", calls)
+	}
+}
+
+func TestWaitHooks_WaitsForRunningHookUntilContextEnds(t *testing.T) {
+	w, err := NewWorkerI(pgsql.Repos{}, Options{
+		InstanceRootDir:    t.TempDir(),
+		VersionRootDir:     t.TempDir(),
+		ComposeTemplateDir: t.TempDir(),
+		PostCreateHook:     "/opt/mcmm/post-create.sh",
+	})
+	if err != nil {
+		t.Fatalf("new worker failed: %v", err)
+	}
+	release := make(chan struct{})
+	w.runCmd = func(ctx context.Context, bin string, args ...string) (string, error) {
+		<-release
+		return "", nil
+	}
+	w.runPostCreateHook(pgsql.MapInstance{ID: 42})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := w.WaitHooks(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the wait to time out while the hook runs, got %v", err)
+	}
+	close(release)
+	if err := w.WaitHooks(context.Background()); err != nil {
+		t.Fatalf("wait after the hook finished: %v", err)
+	}
+}
+
+func TestPreDestroyHook_RunsBeforeArchive(t *testing.T) {
+	rec := &tapRecorder{}
+	srv := httptest.NewServer(rec.handler(false))
+	defer srv.Close()
+	w, cmds := newMultiverseStopWorker(t, srv.URL, StatusOn)
+	w.opts.PreDestroyHook = "/opt/mcmm/pre-destroy.sh"
+
+	if err := w.StopAndArchive(context.Background(), 7); err != nil {
+		t.Fatalf("archive failed: %v", err)
+	}
+	if len(*cmds) != 2 || (*cmds)[0] != "/opt/mcmm/pre-destroy.sh archive 7 alice_castle  0 0" || !strings.HasSuffix((*cmds)[1], " down") {
+		t.Fatalf("hook should run with instance args before compose down, got=%v", *cmds)
+	}
+	if !isDir(w.archiveDirPath(7)) {
+		t.Fatalf("world should be archived")
+	}
+}
+
+func TestPreDestroyHook_FailureAbortsOnlyWhenConfigured(t *testing.T) {
+	for _, abort := range []bool{false, true} {
+		rec := &tapRecorder{}
+		srv := httptest.NewServer(rec.handler(false))
+		w, _ := newMultiverseStopWorker(t, srv.URL, StatusOn)
+		w.opts.PreDestroyHook = "/opt/mcmm/pre-destroy.sh"
+		w.opts.PreDestroyHookAbort = abort
+		w.runCmd = func(ctx context.Context, bin string, args ...string) (string, error) {
+			if bin == "/opt/mcmm/pre-destroy.sh" {
+				return "dns api down", errors.New("exit status 1")
+			}
+			return "", nil
+		}
+
+		err := w.StopAndArchive(context.Background(), 7)
+		srv.Close()
+		if abort {
+			if err == nil || isDir(w.archiveDirPath(7)) {
+				t.Fatalf("abort=true: destroy should stop on hook failure, err=%v", err)
+			}
+			continue
+		}
+		if err != nil || !isDir(w.archiveDirPath(7)) {
+			t.Fatalf("abort=false: destroy should go on after hook failure, err=%v", err)
+		}
+	}
+}
+
+func TestPrepareServerProperties_WritesOptions(t *testing.T) {
+	w, err := NewWorkerI(pgsql.Repos{}, Options{
+		InstanceRootDir:    t.TempDir(),
+		VersionRootDir:     t.TempDir(),
+		ComposeTemplateDir: t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("new worker failed: %v", err)
+	}
+	path := filepath.Join(instanceDir(w.opts.InstanceRootDir, 9), serverPropertiesName)
+
+	props := ServerProperties{Gamemode: "creative", Difficulty: "hard", MaxPlayers: 8, MOTD: "Alice's\nbuild world"}
+	if err := w.prepareServerProperties(9, props); err != nil {
+		t.Fatalf("prepare server.properties: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read server.properties: %v", err)
+	}
+	content := string(b)
+	for _, want := range []string{"gamemode=creative\n", "difficulty=hard\n", "max-players=8\n", "motd=Alice's build world\n", "online-mode=false\n", "server-port=25565\n"} {
+		if !strings.Contains(content, want) {
+			t.Fatalf("server.properties missing %q:\n%s", want, content)
+		}
+	}
+
+	// Keys changed at runtime survive, unset options keep the current value.
+	if err := os.WriteFile(path, []byte(strings.Replace(content, "white-list=false", "white-list=true", 1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.prepareServerProperties(9, ServerProperties{Difficulty: "peaceful"}); err != nil {
+		t.Fatalf("prepare server.properties: %v", err)
+	}
+	b, _ = os.ReadFile(path)
+	content = string(b)
+	for _, want := range []string{"white-list=true\n", "difficulty=peaceful\n", "gamemode=creative\n"} {
+		if !strings.Contains(content, want) {
+			t.Fatalf("server.properties missing %q:\n%s", want, content)
+		}
+	}
+	if strings.Count(content, "difficulty=") != 1 {
+		t.Fatalf("difficulty should be replaced in place:\n%s", content)
+	}
+
+	if err := w.prepareServerProperties(9, ServerProperties{Gamemode: "god"}); err == nil {
+		t.Fatalf("invalid gamemode should be rejected")
+	}
+}
+
+func TestStartEmpty_WritesLevelSeedOnlyBeforeGeneration(t *testing.T) {
+	rec := &tapRecorder{}
+	srv := httptest.NewServer(rec.handler(false))
+	defer srv.Close()
+	w, _, _ := newRetryStartWorker(t, srv.URL, true)
+	w.runCmd = func(ctx context.Context, bin string, args ...string) (string, error) { return "", nil }
+	ctx := context.Background()
+	inst, _ := w.repos.MapInstance.Read(ctx, 12)
+	inst.LevelSeed = "-4172144997902289642"
+	_ = w.repos.MapInstance.Update(ctx, inst)
+
+	if err := w.StartEmpty(ctx, 12, "1.21.1"); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	base := instanceDir(w.opts.InstanceRootDir, 12)
+	path := filepath.Join(base, serverPropertiesName)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read server.properties: %v", err)
+	}
+	if !strings.Contains(string(b), "level-seed=-4172144997902289642\n") {
+		t.Fatalf("first start should render the seed:\n%s", b)
+	}
+
+	// Once the world exists the seed is left as generated.
+	if err := os.WriteFile(filepath.Join(base, "world", "level.dat"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.prepareServerProperties(12, ServerProperties{LevelSeed: "42"}); err != nil {
+		t.Fatalf("prepare server.properties: %v", err)
+	}
+	b, _ = os.ReadFile(path)
+	if strings.Contains(string(b), "level-seed=42") || !strings.Contains(string(b), "level-seed=-4172144997902289642\n") {
+		t.Fatalf("restart must not change the seed of a generated world:\n%s", b)
+	}
+}
+
+func TestSwitchVersion_RegeneratesCompose(t *testing.T) {
+	rec := &tapRecorder{}
+	srv := httptest.NewServer(rec.handler(false))
+	defer srv.Close()
+	w, _, _ := newRetryStartWorker(t, srv.URL, true)
+	w.runCmd = func(ctx context.Context, bin string, args ...string) (string, error) { return "", nil }
+	oldDir := filepath.Join(w.opts.VersionRootDir, "1.20.4")
+	if err := os.MkdirAll(oldDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(oldDir, "paper-1.20.4-499.jar"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	inst, _ := w.repos.MapInstance.Read(ctx, 12)
+	inst.Status = string(StatusOff)
+	inst.GameVersion = "1.21.1"
+	if err := w.repos.MapInstance.Update(ctx, inst); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(instanceDir(w.opts.InstanceRootDir, 12), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.SwitchVersion(ctx, 12, "1.20.4"); err != nil {
+		t.Fatalf("switch version failed: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(instanceDir(w.opts.InstanceRootDir, 12), "docker-compose.yml"))
+	if err != nil {
+		t.Fatalf("read compose: %v", err)
+	}
+	image, _ := runtimeImageByVersion("1.20.4")
+	content := string(b)
+	if !strings.Contains(content, `PAPER_JAR: "paper-1.20.4-499.jar"`) || !strings.Contains(content, "image: "+image) {
+		t.Fatalf("compose should use the 1.20.4 jar and image %s, got:\n%s", image, content)
+	}
+	if strings.Contains(content, "paper-1.21.1") {
+		t.Fatalf("compose should not reference the old jar:\n%s", content)
+	}
+	if got, _ := w.repos.MapInstance.Read(ctx, 12); got.GameVersion != "1.20.4" || got.Status != string(StatusOn) {
+		t.Fatalf("instance should be On with the new version, got version=%s status=%s", got.GameVersion, got.Status)
+	}
+}
+
+func TestServerID_RoundTripsWithPrefix(t *testing.T) {
+	for _, prefix := range []string{"", DefaultServerIDPrefix, "world-"} {
+		sid := ServerID(prefix, 42)
+		id, err := ParseServerID(prefix, sid)
+		if err != nil || id != 42 {
+			t.Fatalf("prefix %q: %s parsed to %d err=%v", prefix, sid, id, err)
+		}
+	}
+	if got := ServerID("", 7); got != "mcmm-inst-7" {
+		t.Fatalf("default server id should match the container name, got %s", got)
+	}
+	for _, bad := range []string{"lobby", "world-42", "mcmm-inst-", "mcmm-inst-x1", "mcmm-inst-007", "mcmm-inst--3"} {
+		if id, err := ParseServerID("", bad); err == nil {
+			t.Fatalf("%q should not parse, got %d", bad, id)
+		}
+	}
+}
@@ -42,6 +42,23 @@ public final class BackendClient {
         kv.put("template_name", req.templateName);
         kv.put("reason", req.reason);
         kv.put("access_mode", req.accessMode);
+        kv.put("display_name", req.displayName);
+        kv.put("new_alias", req.newAlias);
+        kv.put("role", req.role);
+        kv.put("note", req.note);
+        kv.put("query", req.query);
+        kv.put("restart", req.restart ? "true" : "");
+        kv.put("force", req.force ? "true" : "");
+        kv.put("include_archived", req.includeArchived ? "true" : "");
+        kv.put("status", req.status);
+        kv.put("page", req.page);
+        kv.put("page_size", req.pageSize);
+        kv.put("gamemode", req.gamemode);
+        kv.put("difficulty", req.difficulty);
+        kv.put("max_players", req.maxPlayers);
+        kv.put("motd", req.motd);
+        kv.put("cpu_limit", req.cpuLimit);
+        kv.put("mem_limit_mb", req.memLimitMb);
         kv.put("request_id", req.requestId == null || req.requestId.trim().isEmpty() ? UUID.randomUUID().toString() : req.requestId);
 
         StringBuilder form = new StringBuilder();
@@ -159,6 +176,23 @@ public final class BackendClient {
         private String templateName = "";
         private String reason = "";
         private String accessMode = "";
+        private String displayName = "";
+        private String newAlias = "";
+        private String role = "";
+        private String note = "";
+        private String query = "";
+        private boolean restart;
+        private boolean force;
+        private boolean includeArchived;
+        private String status = "";
+        private String page = "";
+        private String pageSize = "";
+        private String gamemode = "";
+        private String difficulty = "";
+        private String maxPlayers = "";
+        private String motd = "";
+        private String cpuLimit = "";
+        private String memLimitMb = "";
 
         public WorldAction(String action, String actorUuid, String actorName) {
             this.action = action;
@@ -200,5 +234,90 @@ public final class BackendClient {
             this.accessMode = value;
             return this;
         }
+
+        public WorldAction displayName(String value) {
+            this.displayName = value;
+            return this;
+        }
+
+        public WorldAction newAlias(String value) {
+            this.newAlias = value;
+            return this;
+        }
+
+        public WorldAction role(String value) {
+            this.role = value;
+            return this;
+        }
+
+        public WorldAction note(String value) {
+            this.note = value;
+            return this;
+        }
+
+        public WorldAction query(String value) {
+            this.query = value;
+            return this;
+        }
+
+        public WorldAction restart(boolean value) {
+            this.restart = value;
+            return this;
+        }
+
+        public WorldAction force(boolean value) {
+            this.force = value;
+            return this;
+        }
+
+        public WorldAction includeArchived(boolean value) {
+            this.includeArchived = value;
+            return this;
+        }
+
+        public WorldAction status(String value) {
+            this.status = value;
+            return this;
+        }
+
+        public WorldAction page(String value) {
+            this.page = value;
+            return this;
+        }
+
+        public WorldAction pageSize(String value) {
+            this.pageSize = value;
+            return this;
+        }
+
+        public WorldAction gamemode(String value) {
+            this.gamemode = value;
+            return this;
+        }
+
+        public WorldAction difficulty(String value) {
+            this.difficulty = value;
+            return this;
+        }
+
+        public WorldAction maxPlayers(String value) {
+            this.maxPlayers = value;
+            return this;
+        }
+
+        public WorldAction motd(String value) {
+            this.motd = value;
+            return this;
+        }
+
+        public WorldAction cpuLimit(String value) {
+            this.cpuLimit = value;
+            return this;
+        }
+
+        public WorldAction memLimitMb(String value) {
+            this.memLimitMb = value;
+            return this;
+        }
     }
 }
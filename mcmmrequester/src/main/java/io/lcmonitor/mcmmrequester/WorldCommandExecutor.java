@@ -28,9 +28,11 @@ public final class WorldCommandExecutor implements CommandExecutor, TabCompleter
     private static final long TEMPLATE_CACHE_TTL_SECONDS = 60;
     private static final long REQUEST_CACHE_TTL_SECONDS = 15;
     private static final long PLAYER_CACHE_TTL_SECONDS = 10;
+    private static final String PROPS_USAGE = "Usage: /mcmm world props <instance_id|alias> [gamemode=<mode>] [difficulty=<level>] [max_players=<n>] [motd=<text...>]";
     private static final Pattern MESSAGE_PATTERN = Pattern.compile("\"message\"\\s*:\\s*\"((?:\\\\.|[^\"])*)\"");
-    private static final Pattern WORLD_ITEM_PATTERN = Pattern.compile("^#(\\d+):([^:]+):([^\\(]+)\\(([^\\)]+)\\)$");
+    private static final Pattern WORLD_ITEM_PATTERN = Pattern.compile("^#(\\d+):([^:]+):([^\\(]+)\\(([^\\)]+)\\)(?:\\s+name=.*)?$");
     private static final Pattern TEMPLATE_ITEM_PATTERN = Pattern.compile("^#(\\d+):([^\\(]+)\\(.*\\)$");
+    private static final Pattern GAME_VERSION_PATTERN = Pattern.compile("^\\d+\\.\\d+(?:\\.\\d+)?$");
     private static final Pattern REQUEST_ITEM_PATTERN = Pattern.compile("^#(\\d+):([^\\s]+)\\s+player=.*\\sworld=([^\\s,]+).*$");
 
     private final JavaPlugin plugin;
@@ -95,16 +97,34 @@ public final class WorldCommandExecutor implements CommandExecutor, TabCompleter
     }
 
     private boolean handleTemplate(Player player, String[] args) {
-        if (args.length == 2 && "list".equalsIgnoreCase(args[1])) {
-            return dispatch(player, new BackendClient.WorldAction("template_list", player.getUniqueId().toString(), player.getName()), "template list");
+        if (args.length >= 2 && args.length <= 4 && "list".equalsIgnoreCase(args[1])) {
+            BackendClient.WorldAction action = new BackendClient.WorldAction("template_list", player.getUniqueId().toString(), player.getName());
+            int next = 2;
+            if (args.length > next && GAME_VERSION_PATTERN.matcher(args[next]).matches()) {
+                action.gameVersion(args[next]);
+                next++;
+            }
+            if (args.length > next + 1) {
+                player.sendMessage("Usage: /mcmm template list [版本] [关键词]");
+                return true;
+            }
+            if (args.length > next) {
+                action.query(args[next]);
+            }
+            return dispatch(player, action, "template list");
         }
-        player.sendMessage("Usage: /mcmm template list");
+        if (args.length == 2 && "versions".equalsIgnoreCase(args[1])) {
+            return dispatch(player,
+                    new BackendClient.WorldAction("version_list", player.getUniqueId().toString(), player.getName()),
+                    "version list");
+        }
+        player.sendMessage("Usage: /mcmm template <list [版本] [关键词]|versions>");
         return true;
     }
 
     private boolean handleReq(Player player, String[] args) {
         if (args.length < 2) {
-            player.sendMessage("Usage: /mcmm req <create|list|approve|reject|cancel> ...");
+            player.sendMessage("Usage: /mcmm req <create|list|history|approve|reject|cancel|resubmit> ...");
             return true;
         }
         String op = args[1].toLowerCase(Locale.ROOT);
@@ -120,10 +140,36 @@ public final class WorldCommandExecutor implements CommandExecutor, TabCompleter
                     action.templateName(args[3]);
                 }
                 return dispatch(player, action, "request create");
-            case "list":
-                return dispatch(player,
-                        new BackendClient.WorldAction("request_list", player.getUniqueId().toString(), player.getName()),
-                        "request list");
+            case "list": {
+                if (args.length > 4) {
+                    player.sendMessage("Usage: /mcmm req list [status] [page]");
+                    return true;
+                }
+                BackendClient.WorldAction action = new BackendClient.WorldAction("request_list", player.getUniqueId().toString(), player.getName());
+                for (int i = 2; i < args.length; i++) {
+                    if (args[i].matches("\\d+")) {
+                        action.page(args[i]);
+                    } else {
+                        action.status(args[i].toLowerCase());
+                    }
+                }
+                return dispatch(player, action, "request list");
+            }
+            case "history": {
+                if (args.length > 4) {
+                    player.sendMessage("Usage: /mcmm req history [status] [page]");
+                    return true;
+                }
+                BackendClient.WorldAction action = new BackendClient.WorldAction("request_history", player.getUniqueId().toString(), player.getName());
+                for (int i = 2; i < args.length; i++) {
+                    if (args[i].matches("\\d+")) {
+                        action.page(args[i]);
+                    } else {
+                        action.status(args[i].toLowerCase());
+                    }
+                }
+                return dispatch(player, action, "request history");
+            }
             case "approve":
                 if (args.length != 3) {
                     player.sendMessage("Usage: /mcmm req approve <request_no|request_id>");
@@ -153,6 +199,20 @@ public final class WorldCommandExecutor implements CommandExecutor, TabCompleter
                                 .requestId(args[2])
                                 .reason(joinTail(args, 3)),
                         "request cancel");
+            case "resubmit":
+                if (args.length < 3 || args.length > 5) {
+                    player.sendMessage("Usage: /mcmm req resubmit <request_no|request_id> [world_alias] [template_id|template_name]");
+                    return true;
+                }
+                BackendClient.WorldAction resubmit = new BackendClient.WorldAction("request_resubmit", player.getUniqueId().toString(), player.getName())
+                        .requestId(args[2]);
+                if (args.length >= 4) {
+                    resubmit.worldAlias(args[3]);
+                }
+                if (args.length == 5) {
+                    resubmit.templateName(args[4]);
+                }
+                return dispatch(player, resubmit, "request resubmit");
             default:
                 player.sendMessage("Unsupported req action.");
                 return true;
@@ -167,7 +227,24 @@ public final class WorldCommandExecutor implements CommandExecutor, TabCompleter
 
         String sub = args[1].toLowerCase(Locale.ROOT);
         if ("list".equals(sub)) {
-            return dispatch(player, new BackendClient.WorldAction("world_list", player.getUniqueId().toString(), player.getName()), "world list");
+            if (args.length > 3 || (args.length == 3 && !"archived".equalsIgnoreCase(args[2]))) {
+                player.sendMessage("Usage: /mcmm world list [archived]");
+                return true;
+            }
+            return dispatch(player,
+                    new BackendClient.WorldAction("world_list", player.getUniqueId().toString(), player.getName())
+                            .includeArchived(args.length == 3),
+                    args.length == 3 ? "world list archived" : "world list");
+        }
+        if ("mine".equals(sub)) {
+            if (args.length > 3 || (args.length == 3 && !"archived".equalsIgnoreCase(args[2]))) {
+                player.sendMessage("Usage: /mcmm world mine [archived]");
+                return true;
+            }
+            return dispatch(player,
+                    new BackendClient.WorldAction("world_mine", player.getUniqueId().toString(), player.getName())
+                            .includeArchived(args.length == 3),
+                    "world mine");
         }
         if ("info".equals(sub)) {
             BackendClient.WorldAction action = new BackendClient.WorldAction("world_info", player.getUniqueId().toString(), player.getName());
@@ -186,6 +263,28 @@ public final class WorldCommandExecutor implements CommandExecutor, TabCompleter
                             .accessMode(args[2].toLowerCase(Locale.ROOT)),
                     "world set access");
         }
+        if ("rename".equals(sub)) {
+            if (args.length < 4) {
+                player.sendMessage("Usage: /mcmm world rename <instance_id|alias> <display_name>");
+                return true;
+            }
+            return dispatch(player,
+                    new BackendClient.WorldAction("world_set_name", player.getUniqueId().toString(), player.getName())
+                            .worldAlias(args[2])
+                            .displayName(joinTail(args, 3)),
+                    "world rename");
+        }
+        if ("alias".equals(sub)) {
+            if (args.length != 4) {
+                player.sendMessage("Usage: /mcmm world alias <instance_id|alias> <new_alias>");
+                return true;
+            }
+            return dispatch(player,
+                    new BackendClient.WorldAction("world_rename", player.getUniqueId().toString(), player.getName())
+                            .worldAlias(args[2])
+                            .newAlias(args[3]),
+                    "world alias");
+        }
         if ("on".equals(sub) || "off".equals(sub)) {
             if (args.length != 3) {
                 player.sendMessage("Usage: /mcmm world <on|off> <instance_id|alias>");
@@ -197,6 +296,71 @@ public final class WorldCommandExecutor implements CommandExecutor, TabCompleter
                             .worldAlias(args[2]),
                     "world " + sub);
         }
+        if ("transfer".equals(sub)) {
+            if (args.length != 4) {
+                player.sendMessage("Usage: /mcmm world transfer <instance_id|alias> <player_name>");
+                return true;
+            }
+            return dispatch(player,
+                    new BackendClient.WorldAction("world_transfer", player.getUniqueId().toString(), player.getName())
+                            .worldAlias(args[2])
+                            .targetName(args[3]),
+                    "world transfer");
+        }
+        if ("props".equals(sub)) {
+            if (args.length < 4) {
+                player.sendMessage(PROPS_USAGE);
+                return true;
+            }
+            BackendClient.WorldAction action = new BackendClient.WorldAction("world_set_properties", player.getUniqueId().toString(), player.getName())
+                    .worldAlias(args[2]);
+            for (int i = 3; i < args.length; i++) {
+                int eq = args[i].indexOf('=');
+                if (eq <= 0) {
+                    player.sendMessage(PROPS_USAGE);
+                    return true;
+                }
+                String key = args[i].substring(0, eq).toLowerCase(Locale.ROOT);
+                String value = args[i].substring(eq + 1);
+                if ("motd".equals(key)) {
+                    // The MOTD may contain spaces, so it takes the rest of the line.
+                    String tail = joinTail(args, i + 1);
+                    action.motd(tail.isEmpty() ? value : value + " " + tail);
+                    break;
+                }
+                if ("gamemode".equals(key)) {
+                    action.gamemode(value);
+                } else if ("difficulty".equals(key)) {
+                    action.difficulty(value);
+                } else if ("max_players".equals(key)) {
+                    action.maxPlayers(value);
+                } else {
+                    player.sendMessage(PROPS_USAGE);
+                    return true;
+                }
+            }
+            return dispatch(player, action, "world props");
+        }
+        if ("logs".equals(sub)) {
+            if (args.length != 3) {
+                player.sendMessage("Usage: /mcmm world logs <instance_id|alias>");
+                return true;
+            }
+            return dispatch(player,
+                    new BackendClient.WorldAction("world_logs", player.getUniqueId().toString(), player.getName())
+                            .worldAlias(args[2]),
+                    "world logs");
+        }
+        if ("restore".equals(sub)) {
+            if (args.length != 3) {
+                player.sendMessage("Usage: /mcmm world restore <instance_id|alias>");
+                return true;
+            }
+            return dispatch(player,
+                    new BackendClient.WorldAction("world_restore", player.getUniqueId().toString(), player.getName())
+                            .worldAlias(args[2]),
+                    "world restore");
+        }
         if ("remove".equals(sub)) {
             if (args.length != 3) {
                 player.sendMessage("Usage: /mcmm world remove <instance_id|alias>");
@@ -214,6 +378,20 @@ public final class WorldCommandExecutor implements CommandExecutor, TabCompleter
                     "world join");
         }
 
+        // /mcmm world <alias> role <name> <member|manager>
+        if (args.length >= 3 && "role".equalsIgnoreCase(args[2])) {
+            if (args.length != 5 || (!"member".equalsIgnoreCase(args[4]) && !"manager".equalsIgnoreCase(args[4]))) {
+                player.sendMessage("Usage: /mcmm world <world_alias> role <player> <member|manager>");
+                return true;
+            }
+            return dispatch(player,
+                    new BackendClient.WorldAction("member_set_role", player.getUniqueId().toString(), player.getName())
+                            .worldAlias(args[1])
+                            .targetName(args[3])
+                            .role(args[4].toLowerCase(Locale.ROOT)),
+                    "member role");
+        }
+
         // /mcmm world <alias> add/remove user <name>
         if (args.length >= 5 &&
                 ("add".equalsIgnoreCase(args[2]) || "remove".equalsIgnoreCase(args[2])) &&
@@ -244,6 +422,14 @@ public final class WorldCommandExecutor implements CommandExecutor, TabCompleter
             }
             return dispatch(player, action, "instance create");
         }
+        if (args.length >= 3 && "provision".equalsIgnoreCase(args[1])) {
+            BackendClient.WorldAction action = new BackendClient.WorldAction("instance_provision", player.getUniqueId().toString(), player.getName())
+                    .worldAlias(args[2]);
+            if (args.length >= 4) {
+                action.templateName(args[3]);
+            }
+            return dispatch(player, action, "instance provision");
+        }
         if (args.length == 3 && "on".equalsIgnoreCase(args[1])) {
             return dispatch(player,
                     new BackendClient.WorldAction("instance_on", player.getUniqueId().toString(), player.getName())
@@ -262,6 +448,111 @@ public final class WorldCommandExecutor implements CommandExecutor, TabCompleter
                             .worldAlias(args[2]),
                     "instance remove");
         }
+        if (args.length == 3 && "purge".equalsIgnoreCase(args[1])) {
+            return dispatch(player,
+                    new BackendClient.WorldAction("instance_purge", player.getUniqueId().toString(), player.getName())
+                            .worldAlias(args[2]),
+                    "instance purge");
+        }
+        if (args.length >= 4 && args.length <= 6 && "version".equalsIgnoreCase(args[1])) {
+            boolean restart = false;
+            boolean force = false;
+            for (int i = 4; i < args.length; i++) {
+                if ("restart".equalsIgnoreCase(args[i])) {
+                    restart = true;
+                } else if ("force".equalsIgnoreCase(args[i])) {
+                    force = true;
+                } else {
+                    player.sendMessage("Usage: /mcmm instance version <instance> <game_version> [restart] [force]");
+                    return true;
+                }
+            }
+            return dispatch(player,
+                    new BackendClient.WorldAction("instance_set_version", player.getUniqueId().toString(), player.getName())
+                            .worldAlias(args[2])
+                            .gameVersion(args[3])
+                            .restart(restart)
+                            .force(force),
+                    "instance version");
+        }
+        if (args.length == 3 && ("pin".equalsIgnoreCase(args[1]) || "unpin".equalsIgnoreCase(args[1]))) {
+            String sub = args[1].toLowerCase(Locale.ROOT);
+            return dispatch(player,
+                    new BackendClient.WorldAction("instance_" + sub, player.getUniqueId().toString(), player.getName())
+                            .worldAlias(args[2]),
+                    "instance " + sub);
+        }
+        if (args.length >= 4 && args.length <= 5 && "limits".equalsIgnoreCase(args[1])) {
+            BackendClient.WorldAction action = new BackendClient.WorldAction("instance_set_limits", player.getUniqueId().toString(), player.getName())
+                    .worldAlias(args[2]);
+            for (int i = 3; i < args.length; i++) {
+                String arg = args[i].toLowerCase(Locale.ROOT);
+                if (arg.startsWith("cpu=")) {
+                    action.cpuLimit(arg.substring(4));
+                } else if (arg.startsWith("mem=")) {
+                    action.memLimitMb(arg.substring(4));
+                } else {
+                    player.sendMessage("Usage: /mcmm instance limits <instance> [cpu=<n>] [mem=<mb>]");
+                    return true;
+                }
+            }
+            return dispatch(player, action, "instance limits");
+        }
+        if (args.length >= 3 && "note".equalsIgnoreCase(args[1])) {
+            return dispatch(player,
+                    new BackendClient.WorldAction("world_note", player.getUniqueId().toString(), player.getName())
+                            .worldAlias(args[2])
+                            .note(joinTail(args, 3)),
+                    "instance note");
+        }
+        if (args.length == 3 && "timeline".equalsIgnoreCase(args[1])) {
+            return dispatch(player,
+                    new BackendClient.WorldAction("world_timeline", player.getUniqueId().toString(), player.getName())
+                            .worldAlias(args[2]),
+                    "instance timeline");
+        }
+        if (args.length == 2 && "versions".equalsIgnoreCase(args[1])) {
+            return dispatch(player,
+                    new BackendClient.WorldAction("version_supported", player.getUniqueId().toString(), player.getName()),
+                    "instance versions");
+        }
+        if (args.length == 2 && "capacity".equalsIgnoreCase(args[1])) {
+            return dispatch(player,
+                    new BackendClient.WorldAction("capacity", player.getUniqueId().toString(), player.getName()),
+                    "instance capacity");
+        }
+        if (args.length == 2 && ("startall".equalsIgnoreCase(args[1]) || "stopall".equalsIgnoreCase(args[1]))) {
+            String action = "startall".equalsIgnoreCase(args[1]) ? "instance_start_all" : "instance_stop_all";
+            return dispatch(player,
+                    new BackendClient.WorldAction(action, player.getUniqueId().toString(), player.getName()),
+                    "instance " + args[1].toLowerCase());
+        }
+        if ((args.length == 3 || args.length == 4) && "validate".equalsIgnoreCase(args[1])) {
+            BackendClient.WorldAction action = new BackendClient.WorldAction("instance_validate", player.getUniqueId().toString(), player.getName())
+                    .worldAlias(args[2]);
+            if (args.length == 4) {
+                action.gameVersion(args[3]);
+            }
+            return dispatch(player, action, "instance validate");
+        }
+        if (args.length == 3 && "rotatekey".equalsIgnoreCase(args[1])) {
+            return dispatch(player,
+                    new BackendClient.WorldAction("world_rotate_key", player.getUniqueId().toString(), player.getName())
+                            .worldAlias(args[2]),
+                    "instance rotatekey");
+        }
+        if (args.length == 3 && "compose".equalsIgnoreCase(args[1])) {
+            return dispatch(player,
+                    new BackendClient.WorldAction("world_compose", player.getUniqueId().toString(), player.getName())
+                            .worldAlias(args[2]),
+                    "instance compose");
+        }
+        if (args.length == 3 && "repair".equalsIgnoreCase(args[1])) {
+            return dispatch(player,
+                    new BackendClient.WorldAction("world_repair", player.getUniqueId().toString(), player.getName())
+                            .worldAlias(args[2]),
+                    "instance repair");
+        }
         if (args.length == 3 && "stop".equalsIgnoreCase(args[1])) {
             return dispatch(player,
                     new BackendClient.WorldAction("instance_stop", player.getUniqueId().toString(), player.getName())
@@ -280,13 +571,24 @@ public final class WorldCommandExecutor implements CommandExecutor, TabCompleter
                             .worldAlias(args[2]),
                     "instance unlock");
         }
-        player.sendMessage("Usage: /mcmm instance <list|create|on|off|remove|lockdown|unlock> ...");
+        player.sendMessage("Usage: /mcmm instance <list|create|provision|on|off|remove|purge|pin|unpin|version|versions|validate|rotatekey|compose|repair|note|lockdown|unlock> ...");
         return true;
     }
 
     private boolean handlePlayer(Player player, String[] args) {
+        if (args.length >= 2 && "role".equalsIgnoreCase(args[1])) {
+            if (args.length != 4) {
+                player.sendMessage("Usage: /mcmm player role <player_name> <user|admin>");
+                return true;
+            }
+            return dispatch(player,
+                    new BackendClient.WorldAction("player_set_role", player.getUniqueId().toString(), player.getName())
+                            .targetName(args[2])
+                            .role(args[3].toLowerCase(Locale.ROOT)),
+                    "player role");
+        }
         if (args.length != 4) {
-            player.sendMessage("Usage: /mcmm player <invite|reject> <player_name> <world_id|alias>");
+            player.sendMessage("Usage: /mcmm player <invite|reject|role> <player_name> <world_id|alias|role>");
             return true;
         }
         String sub = args[1].toLowerCase(Locale.ROOT);
@@ -410,23 +712,32 @@ public final class WorldCommandExecutor implements CommandExecutor, TabCompleter
         if (page == 1) {
             sender.sendMessage("/mcmm help [页码]  查看帮助");
             sender.sendMessage("/mcmm req create <世界名> [模板]  申请创建");
-            sender.sendMessage("/mcmm req list  查看请求");
+            sender.sendMessage("/mcmm req list [状态] [页码]  查看请求（管理员默认只看 pending）");
             sender.sendMessage("/mcmm req approve <#请求号>  管理员通过");
             sender.sendMessage("/mcmm req reject <#请求号> [原因]  管理员拒绝");
             sender.sendMessage("/mcmm req cancel <#请求号> [原因]  取消请求");
-            sender.sendMessage("/mcmm template list  查看模板");
+            sender.sendMessage("/mcmm req resubmit <#请求号> [新世界名] [模板]  重新提交被拒绝/取消/失败的请求");
+            sender.sendMessage("/mcmm template list [版本] [关键词]  查看/筛选模板");
+            sender.sendMessage("/mcmm template versions  查看可用于创建的游戏版本");
             sender.sendMessage("/mcmm lobby  返回大厅");
             sender.sendMessage("下一页: /mcmm help 2");
             return;
         }
         if (page == 2) {
-            sender.sendMessage("/mcmm world list  查看可加入世界");
+            sender.sendMessage("/mcmm world list [archived]  查看可加入世界");
+            sender.sendMessage("/mcmm world mine [archived]  我拥有/参与的世界");
             sender.sendMessage("/mcmm world <#id:alias|alias>  进入世界");
             sender.sendMessage("/mcmm world info [世界]  查看信息");
             sender.sendMessage("/mcmm world set <public|privacy>  设置公开性");
+            sender.sendMessage("/mcmm world rename <世界> <展示名>  修改展示名");
+            sender.sendMessage("/mcmm world alias <世界> <新别名>  修改世界别名(自动加 owner 前缀)");
+            sender.sendMessage("/mcmm world transfer <世界> <玩家>  转让世界(原owner降为成员)");
+            sender.sendMessage("/mcmm world props <世界> [gamemode=] [difficulty=] [max_players=] [motd=]  修改游戏模式/难度/人数/MOTD(下次启动生效)");
             sender.sendMessage("/mcmm world on <世界>  启动自己的世界");
             sender.sendMessage("/mcmm world off <世界>  关闭自己的世界");
             sender.sendMessage("/mcmm world remove <世界>  删除/归档(需confirm)");
+            sender.sendMessage("/mcmm world restore <世界>  从归档恢复(恢复后为关闭状态)");
+            sender.sendMessage("/mcmm world logs <世界>  查看最近一次启动的 compose 输出");
             sender.sendMessage("/mcmm confirm  确认删除");
             sender.sendMessage("下一页: /mcmm help 3");
             return;
@@ -436,15 +747,32 @@ public final class WorldCommandExecutor implements CommandExecutor, TabCompleter
             sender.sendMessage("/mcmm player reject <玩家> <世界>  移除成员");
             sender.sendMessage("/mcmm world <世界> add user <玩家>  兼容旧写法");
             sender.sendMessage("/mcmm world <世界> remove user <玩家>  兼容旧写法");
+            sender.sendMessage("/mcmm world <世界> role <玩家> <member|manager>  设置成员角色");
             sender.sendMessage("提示: 离线玩家也可邀请(需已入库)");
             sender.sendMessage("下一页: /mcmm help 4");
             return;
         }
         sender.sendMessage("/mcmm instance list  管理员查看全部实例");
         sender.sendMessage("/mcmm instance create <世界名> [模板]  管理员直建");
+        sender.sendMessage("/mcmm instance provision <世界名> [模板]  仅准备不启动(之后用on启动)");
         sender.sendMessage("/mcmm instance on <实例>  管理员启动");
         sender.sendMessage("/mcmm instance off <实例>  管理员关闭");
         sender.sendMessage("/mcmm instance remove <实例>  管理员归档");
+        sender.sendMessage("/mcmm instance purge <实例>  彻底删除已归档实例(不可恢复)");
+        sender.sendMessage("/mcmm instance pin <实例>  固定归档(不被容量清理)");
+        sender.sendMessage("/mcmm instance unpin <实例>  取消固定归档");
+        sender.sendMessage("/mcmm instance repair <实例>  补回缺失的 whitelist.json/世界目录(需关闭)");
+        sender.sendMessage("/mcmm instance limits <实例> [cpu=<n>] [mem=<mb>]  设置 CPU/内存上限(0为全局默认, 下次启动生效)");
+        sender.sendMessage("/mcmm instance note <实例> [备注]  设置管理员备注(留空清除)");
+        sender.sendMessage("/mcmm instance timeline <实例>  查看实例生命周期时间线(创建/成员/请求/故障/归档)");
+        sender.sendMessage("/mcmm instance version <实例> <版本> [restart] [force]  修改游戏版本(降级需force)");
+        sender.sendMessage("/mcmm instance versions  查看支持的版本、运行镜像与已安装核心");
+        sender.sendMessage("/mcmm instance capacity  查看实例数、内存、磁盘与启动槽位");
+        sender.sendMessage("/mcmm instance startall|stopall  批量启动所有 Off 实例 / 关闭所有 On 实例");
+        sender.sendMessage("/mcmm instance validate <实例> [版本]  预检启动所需核心与镜像(不启动)");
+        sender.sendMessage("/mcmm instance rotatekey <实例>  更换实例 ServerTap key(运行中会重启)");
+        sender.sendMessage("/mcmm instance compose <实例>  查看实例 docker-compose.yml(已隐去密钥,不启动)");
+        sender.sendMessage("/mcmm player role <玩家> <user|admin>  设置服务器角色(提升为admin时立即在运行中实例授予OP)");
         sender.sendMessage("/mcmm instance lockdown <实例>  锁定仅OP可进");
         sender.sendMessage("/mcmm instance unlock <实例>  解除锁定");
         sender.sendMessage("/mcmm instance stop <实例>  等同off");
@@ -471,18 +799,19 @@ public final class WorldCommandExecutor implements CommandExecutor, TabCompleter
             if (sender instanceof Player) {
                 Player p = (Player) sender;
                 String subPrefix = args[1] == null ? "" : args[1].toLowerCase(Locale.ROOT);
-                if ("create".startsWith(subPrefix)) {
+                if ("create".startsWith(subPrefix) || "provision".startsWith(subPrefix)) {
                     maybeRefreshWorldCache(p);
                     maybeRefreshTemplateCache(p);
                 }
-                if ("approve".startsWith(subPrefix) || "reject".startsWith(subPrefix) || "cancel".startsWith(subPrefix)) {
+                if ("approve".startsWith(subPrefix) || "reject".startsWith(subPrefix) || "cancel".startsWith(subPrefix) ||
+                    "resubmit".startsWith(subPrefix)) {
                     maybeRefreshRequestCache(p);
                 }
             }
             if (adminView) {
-                return prefixMatch(Arrays.asList("create", "list", "approve", "reject", "cancel"), args[1]);
+                return prefixMatch(Arrays.asList("create", "list", "history", "approve", "reject", "cancel", "resubmit"), args[1]);
             }
-            return prefixMatch(Arrays.asList("create", "list", "cancel"), args[1]);
+            return prefixMatch(Arrays.asList("create", "list", "cancel", "resubmit"), args[1]);
         }
         if ("req".equalsIgnoreCase(args[0]) && args.length == 3 && "create".equalsIgnoreCase(args[1])) {
             if (sender instanceof Player) {
@@ -501,14 +830,19 @@ public final class WorldCommandExecutor implements CommandExecutor, TabCompleter
             return prefixMatch(Collections.singletonList("<template_id|template_name>"), args[3]);
         }
         if ("req".equalsIgnoreCase(args[0]) && args.length == 3 &&
-                ("approve".equalsIgnoreCase(args[1]) || "reject".equalsIgnoreCase(args[1]) || "cancel".equalsIgnoreCase(args[1])) &&
+                ("approve".equalsIgnoreCase(args[1]) || "reject".equalsIgnoreCase(args[1]) || "cancel".equalsIgnoreCase(args[1]) ||
+                 "resubmit".equalsIgnoreCase(args[1])) &&
                 sender instanceof Player) {
             Player p = (Player) sender;
             maybeRefreshRequestCache(p);
             return prefixMatch(getRequestHints(p.getUniqueId()), args[2]);
         }
+        if ("req".equalsIgnoreCase(args[0]) && args.length == 3 &&
+                ("list".equalsIgnoreCase(args[1]) || "history".equalsIgnoreCase(args[1]))) {
+            return prefixMatch(Arrays.asList("pending", "processing", "succeeded", "failed", "rejected", "canceled", "expired"), args[2]);
+        }
         if ("template".equalsIgnoreCase(args[0]) && args.length == 2) {
-            return prefixMatch(Collections.singletonList("list"), args[1]);
+            return prefixMatch(Arrays.asList("list", "versions"), args[1]);
         }
         if ("instance".equalsIgnoreCase(args[0]) && args.length == 2 && adminView) {
             if (sender instanceof Player) {
@@ -519,13 +853,19 @@ public final class WorldCommandExecutor implements CommandExecutor, TabCompleter
                 }
                 if ("on".startsWith(subPrefix) || "off".startsWith(subPrefix) ||
                     "stop".startsWith(subPrefix) || "remove".startsWith(subPrefix) ||
+                    "purge".startsWith(subPrefix) || "version".startsWith(subPrefix) ||
+                    "pin".startsWith(subPrefix) || "unpin".startsWith(subPrefix) ||
+                    "repair".startsWith(subPrefix) || "note".startsWith(subPrefix) || "limits".startsWith(subPrefix) ||
+                    "validate".startsWith(subPrefix) || "rotatekey".startsWith(subPrefix) ||
+                    "compose".startsWith(subPrefix) || "timeline".startsWith(subPrefix) ||
                     "lockdown".startsWith(subPrefix) || "unlock".startsWith(subPrefix)) {
                     maybeRefreshWorldCache(p);
                 }
             }
-            return prefixMatch(Arrays.asList("list", "create", "on", "off", "stop", "remove", "lockdown", "unlock"), args[1]);
+            return prefixMatch(Arrays.asList("list", "create", "provision", "on", "off", "stop", "remove", "purge", "pin", "unpin", "version", "versions", "capacity", "startall", "stopall", "validate", "rotatekey", "compose", "repair", "note", "limits", "timeline", "lockdown", "unlock"), args[1]);
         }
-        if ("instance".equalsIgnoreCase(args[0]) && args.length == 4 && "create".equalsIgnoreCase(args[1]) && adminView) {
+        if ("instance".equalsIgnoreCase(args[0]) && args.length == 4 &&
+                ("create".equalsIgnoreCase(args[1]) || "provision".equalsIgnoreCase(args[1])) && adminView) {
             if (sender instanceof Player) {
                 Player p = (Player) sender;
                 maybeRefreshTemplateCache(p);
@@ -536,27 +876,43 @@ public final class WorldCommandExecutor implements CommandExecutor, TabCompleter
         if ("instance".equalsIgnoreCase(args[0]) && args.length == 3 &&
                 ("on".equalsIgnoreCase(args[1]) || "off".equalsIgnoreCase(args[1]) ||
                  "stop".equalsIgnoreCase(args[1]) || "remove".equalsIgnoreCase(args[1]) ||
+                 "purge".equalsIgnoreCase(args[1]) || "version".equalsIgnoreCase(args[1]) ||
+                 "pin".equalsIgnoreCase(args[1]) || "unpin".equalsIgnoreCase(args[1]) ||
+                 "repair".equalsIgnoreCase(args[1]) || "note".equalsIgnoreCase(args[1]) ||
+                 "limits".equalsIgnoreCase(args[1]) || "timeline".equalsIgnoreCase(args[1]) ||
+                 "validate".equalsIgnoreCase(args[1]) || "rotatekey".equalsIgnoreCase(args[1]) ||
+                 "compose".equalsIgnoreCase(args[1]) ||
                  "lockdown".equalsIgnoreCase(args[1]) || "unlock".equalsIgnoreCase(args[1])) &&
                 sender instanceof Player) {
             Player p = (Player) sender;
             maybeRefreshWorldCache(p);
             return prefixMatch(getWorldHints(p.getUniqueId()), args[2]);
         }
+        if ("instance".equalsIgnoreCase(args[0]) && (args.length == 5 || args.length == 6) &&
+                "version".equalsIgnoreCase(args[1]) && adminView) {
+            return prefixMatch(Arrays.asList("restart", "force"), args[args.length - 1]);
+        }
         if ("world".equalsIgnoreCase(args[0]) && args.length == 2) {
             if (sender instanceof Player) {
                 Player p = (Player) sender;
                 maybeRefreshWorldCache(p);
-                List<String> base = new ArrayList<>(Arrays.asList("list", "info", "set", "on", "off", "remove"));
+                List<String> base = new ArrayList<>(Arrays.asList("list", "mine", "info", "set", "rename", "alias", "transfer", "props", "on", "off", "remove", "restore", "logs"));
                 base.addAll(getWorldHints(p.getUniqueId()));
                 return prefixMatch(base, args[1]);
             }
-            return prefixMatch(Arrays.asList("list", "info", "set", "on", "off", "remove", "<world_alias>"), args[1]);
+            return prefixMatch(Arrays.asList("list", "mine", "info", "set", "rename", "alias", "transfer", "props", "on", "off", "remove", "restore", "logs", "<world_alias>"), args[1]);
+        }
+        if ("world".equalsIgnoreCase(args[0]) && args.length == 3 &&
+                ("mine".equalsIgnoreCase(args[1]) || "list".equalsIgnoreCase(args[1]))) {
+            return prefixMatch(Collections.singletonList("archived"), args[2]);
         }
         if ("world".equalsIgnoreCase(args[0]) && args.length == 3 && "set".equalsIgnoreCase(args[1])) {
             return prefixMatch(Arrays.asList("public", "privacy"), args[2]);
         }
         if ("world".equalsIgnoreCase(args[0]) && args.length == 3 &&
-                ("info".equalsIgnoreCase(args[1]) || "remove".equalsIgnoreCase(args[1])) &&
+                ("info".equalsIgnoreCase(args[1]) || "remove".equalsIgnoreCase(args[1]) || "rename".equalsIgnoreCase(args[1]) ||
+                 "alias".equalsIgnoreCase(args[1]) || "transfer".equalsIgnoreCase(args[1]) || "props".equalsIgnoreCase(args[1]) ||
+                 "restore".equalsIgnoreCase(args[1]) || "logs".equalsIgnoreCase(args[1])) &&
                 sender instanceof Player) {
             Player p = (Player) sender;
             maybeRefreshWorldCache(p);
@@ -570,7 +926,19 @@ public final class WorldCommandExecutor implements CommandExecutor, TabCompleter
             return prefixMatch(getWorldHints(p.getUniqueId()), args[2]);
         }
         if ("world".equalsIgnoreCase(args[0]) && args.length == 3 && !isKeyword(args[1])) {
-            return prefixMatch(Arrays.asList("add", "remove"), args[2]);
+            return prefixMatch(Arrays.asList("add", "remove", "role"), args[2]);
+        }
+        if ("world".equalsIgnoreCase(args[0]) && args.length == 4 && "transfer".equalsIgnoreCase(args[1]) &&
+                sender instanceof Player) {
+            Player p = (Player) sender;
+            maybeRefreshPlayerCache(p);
+            return prefixMatch(getPlayerHints(p.getUniqueId()), args[3]);
+        }
+        if ("world".equalsIgnoreCase(args[0]) && args.length >= 4 && "props".equalsIgnoreCase(args[1])) {
+            return prefixMatch(Arrays.asList("gamemode=", "difficulty=", "max_players=", "motd="), args[args.length - 1]);
+        }
+        if ("world".equalsIgnoreCase(args[0]) && args.length == 5 && "role".equalsIgnoreCase(args[2])) {
+            return prefixMatch(Arrays.asList("member", "manager"), args[4]);
         }
         if ("world".equalsIgnoreCase(args[0]) && args.length == 4 &&
                 ("add".equalsIgnoreCase(args[2]) || "remove".equalsIgnoreCase(args[2]))) {
@@ -580,15 +948,18 @@ public final class WorldCommandExecutor implements CommandExecutor, TabCompleter
             if (sender instanceof Player) {
                 Player p = (Player) sender;
                 String subPrefix = args[1] == null ? "" : args[1].toLowerCase(Locale.ROOT);
-                if ("invite".startsWith(subPrefix) || "reject".startsWith(subPrefix)) {
+                if ("invite".startsWith(subPrefix) || "reject".startsWith(subPrefix) || "role".startsWith(subPrefix)) {
                     maybeRefreshPlayerCache(p);
                     maybeRefreshWorldCache(p);
                 }
             }
-            return prefixMatch(Arrays.asList("invite", "reject"), args[1]);
+            return prefixMatch(Arrays.asList("invite", "reject", "role"), args[1]);
+        }
+        if ("player".equalsIgnoreCase(args[0]) && args.length == 4 && "role".equalsIgnoreCase(args[1])) {
+            return prefixMatch(Arrays.asList("user", "admin"), args[3]);
         }
         if ("player".equalsIgnoreCase(args[0]) && args.length == 3 &&
-                ("invite".equalsIgnoreCase(args[1]) || "reject".equalsIgnoreCase(args[1])) &&
+                ("invite".equalsIgnoreCase(args[1]) || "reject".equalsIgnoreCase(args[1]) || "role".equalsIgnoreCase(args[1])) &&
                 sender instanceof Player) {
             Player p = (Player) sender;
             maybeRefreshPlayerCache(p);
@@ -606,7 +977,7 @@ public final class WorldCommandExecutor implements CommandExecutor, TabCompleter
 
     private static boolean isKeyword(String s) {
         String k = s.toLowerCase(Locale.ROOT);
-        return "list".equals(k) || "info".equals(k) || "set".equals(k) || "remove".equals(k);
+        return "list".equals(k) || "info".equals(k) || "set".equals(k) || "rename".equals(k) || "alias".equals(k) || "transfer".equals(k) || "props".equals(k) || "remove".equals(k) || "restore".equals(k) || "logs".equals(k);
     }
 
     private static List<String> prefixMatch(List<String> candidates, String rawPrefix) {
@@ -833,8 +1204,9 @@ public final class WorldCommandExecutor implements CommandExecutor, TabCompleter
             return Collections.emptyList();
         }
         String raw = message.trim();
-        if (raw.toLowerCase(Locale.ROOT).startsWith("players:")) {
-            raw = raw.substring("players:".length()).trim();
+        // "players: a, b" or, when paged, "players (page 1/3, total=450): a, b"
+        if (raw.toLowerCase(Locale.ROOT).startsWith("players") && raw.indexOf(':') >= 0) {
+            raw = raw.substring(raw.indexOf(':') + 1).trim();
         }
         if (raw.isEmpty()) {
             return Collections.emptyList();